@@ -0,0 +1,80 @@
+// Spreading the listings of check and size over the pool
+//
+// check, size and the checking phase of copy and sync list directories
+// --checkers at a time, but every listing is made with the SA in use, so
+// a full pool of preloaded services sits idle while one account carries
+// the rate limits. With sa_spread_checks each listing is made with the
+// next preloaded SA in turn instead, so the checkers are spread over the
+// pool and metadata heavy phases go faster the bigger it is.
+//
+// A preloaded SA which hits its rate limit, or turns out to be dead, is
+// dealt with on its own: it is dropped from the preloaded services and
+// the listing carries on with the SA in use, which did nothing wrong so
+// is left alone.
+package drive
+
+import (
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// listService returns the service to make a listing with: the next
+// preloaded one with sa_spread_checks, otherwise the one in use. spread
+// is the preloaded service used, or nil for the one in use.
+func (f *Fs) listService() (svc *drive.Service, spread *ServiceAccountInfo) {
+	if f.opt.ServiceAccountSpreadChecks && f.ServiceAccountFiles != nil {
+		if info, ok := f.ServiceAccountFiles.nextService(); ok && info.Service != nil {
+			return info.Service, &info
+		}
+	}
+	return f.svc, nil
+}
+
+// spreadFailed returns true if err, from a listing made with the
+// preloaded service spread, means that service shouldn't be used for
+// now, in which case it has been dropped from the pool. The listing
+// should be retried with the service in use.
+func (p *ServiceAccountPool) spreadFailed(spread *ServiceAccountInfo, err error) bool {
+	if spread == nil || err == nil {
+		return false
+	}
+	reason, dead := isDeadServiceAccountError(err)
+	if !dead && !isRateLimitError(err) {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	svcs := make([]ServiceAccountInfo, 0, len(p.svcs))
+	for _, svc := range p.svcs {
+		if svc.Service != spread.Service {
+			svcs = append(svcs, svc)
+		}
+	}
+	p.setServices(svcs)
+	if spread.File != "" {
+		if dead {
+			p.markDead(spread.File, reason)
+		} else if !isBlacklisted(spread.File) {
+			p.blacklist(spread.File)
+			p.syncShared([]string{spread.File}, p.claimed)
+		}
+	}
+	saDebugf(nil, "Dropped preloaded Service Account %s from spread listings: %v", spread.File, err)
+	return true
+}
+
+// isRateLimitError returns true if err is a rate limit on the SA, rather
+// than on a file, which another SA would get past.
+func isRateLimitError(err error) bool {
+	gerr, ok := err.(*googleapi.Error)
+	if !ok || len(gerr.Errors) == 0 {
+		return false
+	}
+	item := gerr.Errors[0]
+	if isFileRateLimit(gerr) {
+		return false
+	}
+	return item.Reason == "rateLimitExceeded" || item.Reason == "userRateLimitExceeded" || item.Reason == "dailyLimitExceededUnreg" || strings.HasPrefix(item.Message, "Daily Limit")
+}
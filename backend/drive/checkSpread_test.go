@@ -0,0 +1,93 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+func TestListService(t *testing.T) {
+	ctx := context.Background()
+	newService := func() *drive.Service {
+		svc, err := drive.NewService(ctx, option.WithHTTPClient(clientNamed("x")))
+		require.NoError(t, err)
+		return svc
+	}
+	active, one, two := newService(), newService(), newService()
+	pool := NewServiceAccountPool(ctx, 10)
+	f := &Fs{svc: active, ServiceAccountFiles: pool}
+
+	// Off, or without preloaded SAs, listings use the Fs's own
+	svc, spread := f.listService()
+	assert.Same(t, active, svc)
+	assert.Nil(t, spread)
+	f.opt.ServiceAccountSpreadChecks = true
+	svc, _ = f.listService()
+	assert.Same(t, active, svc)
+
+	// On they take turns
+	pool.AddService(nil, two)
+	pool.AddService(nil, one)
+	var got []*drive.Service
+	for range 4 {
+		svc, spread = f.listService()
+		assert.Same(t, svc, spread.Service)
+		got = append(got, svc)
+	}
+	assert.Equal(t, []*drive.Service{one, two, one, two}, got)
+
+	f.opt.ServiceAccountSpreadChecks = false
+	svc, _ = f.listService()
+	assert.Same(t, active, svc)
+}
+
+func TestSpreadFailed(t *testing.T) {
+	ctx := context.Background()
+	pool := NewServiceAccountPool(ctx, 10)
+	setFiles(pool, "/sa/spread1.json", "/sa/spread2.json", "/sa/spread3.json")
+	infos := []ServiceAccountInfo{
+		{Service: &drive.Service{BasePath: "1"}, File: "/sa/spread1.json"},
+		{Service: &drive.Service{BasePath: "2"}, File: "/sa/spread2.json"},
+		{Service: &drive.Service{BasePath: "3"}, File: "/sa/spread3.json"},
+	}
+	pool.mu.Lock()
+	pool.setServices(infos)
+	pool.mu.Unlock()
+	defer func() {
+		for _, info := range infos {
+			serviceAccountBlacklist.Delete(info.File)
+		}
+	}()
+	rateLimit := &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}}}
+
+	// Listings with the service in use, or which went fine, aren't
+	// the pool's business, and nor are other errors
+	assert.False(t, pool.spreadFailed(nil, rateLimit))
+	assert.False(t, pool.spreadFailed(&infos[0], nil))
+	assert.False(t, pool.spreadFailed(&infos[0], errors.New("connection reset")))
+	assert.False(t, pool.spreadFailed(&infos[0], apiError(403, bodyFileRateLimit)))
+	assert.Equal(t, 3, pool.Preloaded())
+
+	// A rate limit drops and blacklists the SA which hit it
+	assert.True(t, pool.spreadFailed(&infos[0], rateLimit))
+	assert.Equal(t, 2, pool.Preloaded())
+	assert.True(t, isBlacklisted("/sa/spread1.json"))
+	assert.False(t, isBlacklisted("/sa/spread2.json"))
+
+	// A dead SA is dropped for good
+	dead := &oauth2.RetrieveError{ErrorCode: "invalid_grant", ErrorDescription: "account not found"}
+	assert.True(t, pool.spreadFailed(&infos[1], dead))
+	assert.Equal(t, 1, pool.Preloaded())
+	assert.True(t, pool.isDead("/sa/spread2.json"))
+
+	info, ok := pool.nextService()
+	require.True(t, ok)
+	assert.Same(t, infos[2].Service, info.Service)
+}
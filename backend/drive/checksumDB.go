@@ -0,0 +1,269 @@
+// Plaintext checksums of crypt files
+//
+// Drive only knows the MD5 of the encrypted content of the files a crypt
+// remote stores on it, so checking them against their source meant
+// downloading one side or the other. With checksum_db set on the drive
+// remote under a crypt remote, every file uploaded through the crypt
+// remote has the MD5 of its plaintext recorded against its Drive ID,
+// along with the MD5 Drive has for the encrypted file. eclone check looks
+// the hashes of crypt files up there, trusting a record only while the
+// encrypted MD5 still matches so a file replaced since isn't taken for
+// the one recorded.
+//
+// The plaintext MD5 is that of the source, asked for once the upload is
+// done, so a source which hashes by reading the file, like a local disk,
+// is read a second time. Server side copies carry over the record of the
+// file copied, and moves keep the Drive ID so their record stays valid.
+// The database is a bbolt file, buffered and shared like the history.
+package drive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/backend/crypt"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/lib/env"
+	bolt "go.etcd.io/bbolt"
+	drive "google.golang.org/api/drive/v3"
+)
+
+// checksumsBucket is the bucket holding the checksums by Drive ID
+var checksumsBucket = []byte("checksums")
+
+var (
+	checksumDBsMu sync.Mutex
+	checksumDBs   = map[string]*checksums{} // by file
+)
+
+// checksumEntry is the record of a file uploaded through crypt.
+type checksumEntry struct {
+	Path         string `json:"path"`          // path of the encrypted file when recorded
+	Size         int64  `json:"size"`          // size of the plaintext
+	MD5          string `json:"md5"`           // MD5 of the plaintext
+	EncryptedMD5 string `json:"encrypted_md5"` // MD5 Drive has for the encrypted file
+}
+
+// checksums buffers the checksums to record in file and looks them up.
+type checksums struct {
+	file    string
+	mu      sync.Mutex
+	pending map[string]checksumEntry // by Drive ID, not written yet
+	timer   *time.Timer              // flushes pending, nil if there is nothing to flush
+	loaded  map[string]checksumEntry // by Drive ID, nil until the first lookup
+}
+
+// newChecksums returns the checksums recorded in file, nil if file is
+// empty.
+func newChecksums(file string) *checksums {
+	if file == "" {
+		return nil
+	}
+	file = env.ShellExpand(file)
+	checksumDBsMu.Lock()
+	defer checksumDBsMu.Unlock()
+	c, ok := checksumDBs[file]
+	if !ok {
+		c = &checksums{file: file, pending: map[string]checksumEntry{}}
+		checksumDBs[file] = c
+	}
+	return c
+}
+
+// add records entry for the file with id, arranging for it to be
+// written.
+func (c *checksums) add(id string, entry checksumEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending[id] = entry
+	if c.loaded != nil {
+		c.loaded[id] = entry
+	}
+	if c.timer == nil {
+		c.timer = time.AfterFunc(historyFlushInterval, func() {
+			if err := c.flush(); err != nil {
+				fs.Errorf(nil, "%v", err)
+			}
+		})
+	}
+}
+
+// flush writes the buffered checksums to the database.
+func (c *checksums) flush() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = map[string]checksumEntry{}
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	c.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+	err := writeChecksums(c.file, pending)
+	if err != nil {
+		// Keep them for the next flush, unless recorded again since
+		c.mu.Lock()
+		for id, entry := range pending {
+			if _, ok := c.pending[id]; !ok {
+				c.pending[id] = entry
+			}
+		}
+		c.mu.Unlock()
+		return fmt.Errorf("failed to record %d checksums: %w", len(pending), err)
+	}
+	fs.Debugf(nil, "Recorded %d checksums in %q", len(pending), c.file)
+	return nil
+}
+
+// writeChecksums writes entries, by Drive ID, to the database in file.
+func writeChecksums(file string, entries map[string]checksumEntry) error {
+	db, err := openDatabase(file, false)
+	if err != nil {
+		return err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(checksumsBucket)
+		if err != nil {
+			return err
+		}
+		for id, entry := range entries {
+			value, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if err = b.Put([]byte(id), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// readChecksums reads the checksums in the database in file, by Drive
+// ID. A missing file has none.
+func readChecksums(file string) (map[string]checksumEntry, error) {
+	entries := map[string]checksumEntry{}
+	if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	db, err := openDatabase(file, true)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = db.Close() }()
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(checksumsBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(key, value []byte) error {
+			var entry checksumEntry
+			if err := json.Unmarshal(value, &entry); err != nil {
+				return fmt.Errorf("corrupt checksum record %q: %w", key, err)
+			}
+			entries[string(key)] = entry
+			return nil
+		})
+	})
+	return entries, err
+}
+
+// lookup returns the record of the file with id, reading the database
+// the first time.
+func (c *checksums) lookup(id string) (entry checksumEntry, ok bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.loaded == nil {
+		loaded, err := readChecksums(c.file)
+		if err != nil {
+			return entry, false, fmt.Errorf("failed to read checksums: %w", err)
+		}
+		for id, entry := range c.pending {
+			loaded[id] = entry
+		}
+		c.loaded = loaded
+	}
+	entry, ok = c.loaded[id]
+	return entry, ok, nil
+}
+
+// recordChecksum records the plaintext MD5 of src, if it was uploaded
+// through a crypt remote, against the file info uploaded to remote.
+func (f *Fs) recordChecksum(ctx context.Context, remote string, src fs.ObjectInfo, info *drive.File) {
+	if f.checksums == nil || info == nil || info.Md5Checksum == "" {
+		return
+	}
+	cryptSrc, ok := src.(*crypt.ObjectInfo)
+	if !ok {
+		return
+	}
+	plain := cryptSrc.UnWrap()
+	if plain == nil {
+		return
+	}
+	md5, err := plain.Hash(ctx, hash.MD5)
+	if err != nil || md5 == "" {
+		fs.Debugf(plain, "No MD5 to record in the checksum database: %v", err)
+		return
+	}
+	f.checksums.add(info.Id, checksumEntry{
+		Path:         path.Join(f.root, remote),
+		Size:         plain.Size(),
+		MD5:          md5,
+		EncryptedMD5: info.Md5Checksum,
+	})
+}
+
+// copyChecksum records the checksum of the file srcObj, if it has one,
+// for its server side copy info at remote.
+func (f *Fs) copyChecksum(remote string, srcObj *baseObject, info *drive.File) {
+	if f.checksums == nil || srcObj.fs.checksums == nil || info == nil {
+		return
+	}
+	entry, ok, err := srcObj.fs.checksums.lookup(actualID(srcObj.id))
+	if err != nil {
+		fs.Errorf(f, "%v", err)
+		return
+	}
+	if !ok || entry.EncryptedMD5 != info.Md5Checksum {
+		return
+	}
+	entry.Path = path.Join(f.root, remote)
+	f.checksums.add(info.Id, entry)
+}
+
+// HasChecksums returns true if f records the checksums of the files
+// uploaded to it through crypt.
+func (f *Fs) HasChecksums() bool {
+	return f.checksums != nil
+}
+
+// PlaintextMD5 returns the MD5 recorded for the plaintext of o, a file
+// uploaded through crypt, or "" if there is none or o has changed since.
+func PlaintextMD5(o fs.Object) (string, error) {
+	do, ok := o.(*Object)
+	if !ok || do.fs.checksums == nil {
+		return "", nil
+	}
+	entry, ok, err := do.fs.checksums.lookup(actualID(do.id))
+	if err != nil || !ok || entry.EncryptedMD5 != do.md5sum {
+		return "", err
+	}
+	return entry.MD5, nil
+}
@@ -0,0 +1,114 @@
+package drive
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/backend/crypt"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	drive "google.golang.org/api/drive/v3"
+)
+
+func TestChecksums(t *testing.T) {
+	assert.Nil(t, newChecksums(""))
+	var none *checksums
+	assert.NoError(t, none.flush())
+
+	file := filepath.Join(t.TempDir(), "sub", "checksums.db")
+	c := newChecksums(file)
+	assert.Same(t, c, newChecksums(file))
+	defer func() {
+		checksumDBsMu.Lock()
+		delete(checksumDBs, file)
+		checksumDBsMu.Unlock()
+	}()
+
+	// A missing database has no checksums
+	_, ok, err := c.lookup("1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	c.add("1", checksumEntry{Path: "a.bin", Size: 10, MD5: "plain", EncryptedMD5: "enc"})
+	entry, ok, err := c.lookup("1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "plain", entry.MD5)
+	_, err = os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+
+	// Once written another process reads them
+	require.NoError(t, c.flush())
+	other := &checksums{file: file, pending: map[string]checksumEntry{}}
+	entry, ok, err = other.lookup("1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, checksumEntry{Path: "a.bin", Size: 10, MD5: "plain", EncryptedMD5: "enc"}, entry)
+
+	// Records are trusted while the encrypted file is unchanged
+	f := &Fs{checksums: c}
+	o := &Object{baseObject: baseObject{fs: f, id: "1"}, md5sum: "enc"}
+	md5sum, err := PlaintextMD5(o)
+	require.NoError(t, err)
+	assert.Equal(t, "plain", md5sum)
+	o.md5sum = "changed"
+	md5sum, err = PlaintextMD5(o)
+	require.NoError(t, err)
+	assert.Equal(t, "", md5sum)
+
+	// Server side copies carry the record over
+	f.copyChecksum("copy.bin", &baseObject{fs: f, id: "1"}, &drive.File{Id: "2", Md5Checksum: "enc"})
+	entry, ok, err = c.lookup("2")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "copy.bin", entry.Path)
+	assert.Equal(t, "plain", entry.MD5)
+
+	// Uploads not made through crypt aren't recorded
+	src := object.NewStaticObjectInfo("plain.bin", time.Now(), 3, true, nil, nil)
+	f.recordChecksum(context.Background(), "plain.bin", src, &drive.File{Id: "3", Md5Checksum: "x"})
+	_, ok, err = c.lookup("3")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestChecksumsCryptUpload(t *testing.T) {
+	ctx := context.Background()
+	srv := newSplitServer(t)
+	defer srv.Close()
+	f := newSplitFs(ctx, t, srv)
+	f.opt.SplitSize = -1
+	f.features = (&fs.Features{}).Fill(ctx, f)
+	file := filepath.Join(t.TempDir(), "checksums.db")
+	f.checksums = newChecksums(file)
+	defer func() {
+		checksumDBsMu.Lock()
+		delete(checksumDBs, file)
+		checksumDBsMu.Unlock()
+	}()
+	cache.Put("checksumtest:", f)
+	defer cache.Clear()
+
+	cf, err := fs.NewFs(ctx, ":crypt,remote='checksumtest:',password="+obscure.MustObscure("secret")+":")
+	require.NoError(t, err)
+	content := strings.Repeat("plaintext ", 100)
+	src := object.NewMemoryObject("file.txt", time.Now(), []byte(content))
+	obj, err := cf.Features().PutUnchecked(ctx, strings.NewReader(content), src)
+	require.NoError(t, err)
+
+	md5sum, err := PlaintextMD5(obj.(*crypt.Object).UnWrap())
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%x", md5.Sum([]byte(content))), md5sum)
+	assert.True(t, f.HasChecksums())
+	assert.False(t, (&Fs{}).HasChecksums())
+}
@@ -0,0 +1,103 @@
+// Bulk shared drive creation
+//
+// Provisioning a pool usually ends with shared drives for the SAs to
+// write to. The create-teamdrives command makes N of them named
+// PREFIX-01 to PREFIX-N, optionally adds the SAs of the pool, or a group
+// holding them, as members, and returns the IDs to put in the config.
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/random"
+	"google.golang.org/api/drive/v3"
+)
+
+// createdTeamDrive is a shared drive made by create-teamdrives
+type createdTeamDrive struct {
+	Name    string `json:"name"`
+	ID      string `json:"id"`
+	Members int    `json:"members"`
+}
+
+// teamDriveNames returns n names starting with prefix, numbered from 1
+// and padded to sort in order.
+func teamDriveNames(prefix string, n int) []string {
+	width := max(len(strconv.Itoa(n)), 2)
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s-%0*d", prefix, width, i+1)
+	}
+	return names
+}
+
+// files returns the file of every SA in the pool.
+func (p *ServiceAccountPool) files() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	files := make([]string, 0, len(p.sas))
+	for _, sa := range p.sas {
+		files = append(files, sa.saPath)
+	}
+	return files
+}
+
+// emails returns the client_email of every SA in the pool which has one.
+func (p *ServiceAccountPool) emails() []string {
+	var emails []string
+	for _, file := range p.files() {
+		if email := p.emailOf(file); email != "" {
+			emails = append(emails, email)
+		}
+	}
+	return emails
+}
+
+// createTeamDrivesCommand runs the create-teamdrives backend command.
+func (f *Fs) createTeamDrivesCommand(ctx context.Context, arg []string, opt map[string]string) ([]createdTeamDrive, error) {
+	if len(arg) != 2 {
+		return nil, errors.New("need a name prefix and the number of shared drives")
+	}
+	n, err := strconv.Atoi(arg[1])
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid number of shared drives %q", arg[1])
+	}
+	members, err := f.teamDriveMembersFor(nil, opt)
+	if err != nil {
+		return nil, err
+	}
+	return f.createTeamDrives(ctx, teamDriveNames(arg[0], n), members, memberRole(opt))
+}
+
+// createTeamDrives makes a shared drive for each name and adds members to
+// it with role. A member which can't be added is logged and skipped.
+func (f *Fs) createTeamDrives(ctx context.Context, names []string, members []teamDriveMember, role string) (created []createdTeamDrive, err error) {
+	for _, name := range names {
+		// Drive makes a single drive for each request ID, so retries
+		// don't make duplicates
+		requestID := random.String(32)
+		var td *drive.Drive
+		err = f.pacer.Call(func() (bool, error) {
+			td, err = f.svc.Drives.Create(requestID, &drive.Drive{Name: name}).Fields("id,name").Context(ctx).Do()
+			return f.shouldRetry(ctx, err)
+		})
+		if err != nil {
+			return created, fmt.Errorf("failed to create shared drive %q: %w", name, err)
+		}
+		fs.Infof(f, "Created shared drive %q with ID %s", name, td.Id)
+		result := createdTeamDrive{Name: td.Name, ID: td.Id}
+		for _, member := range members {
+			if err = f.addTeamDriveMember(ctx, td.Id, member, role); err != nil {
+				fs.Errorf(f, "Failed to add %s %q to shared drive %q: %v", member.kind, member.email, name, err)
+				continue
+			}
+			result.Members++
+		}
+		created = append(created, result)
+	}
+	return created, nil
+}
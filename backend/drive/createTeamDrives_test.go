@@ -0,0 +1,37 @@
+package drive
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTeamDriveNames(t *testing.T) {
+	assert.Equal(t, []string{"media-01", "media-02", "media-03"}, teamDriveNames("media", 3))
+	names := teamDriveNames("td", 100)
+	assert.Equal(t, "td-001", names[0])
+	assert.Equal(t, "td-100", names[99])
+}
+
+func TestPoolEmails(t *testing.T) {
+	const a, b = "mem:a.json", "mem:b.json"
+	serviceAccountCredentials.Store(a, []byte(`{"client_email":"a@p.iam.gserviceaccount.com"}`))
+	defer serviceAccountCredentials.Delete(a)
+	serviceAccountCredentials.Store(b, []byte(`{}`))
+	defer serviceAccountCredentials.Delete(b)
+	p := newTestPool()
+	setFiles(p, a, b)
+	assert.Equal(t, []string{"a@p.iam.gserviceaccount.com"}, p.emails())
+}
+
+func TestCreateTeamDrivesArgs(t *testing.T) {
+	ctx := context.Background()
+	f := &Fs{ServiceAccountFiles: newTestPool()}
+	_, err := f.createTeamDrivesCommand(ctx, []string{"media"}, nil)
+	assert.ErrorContains(t, err, "need a name prefix and the number")
+	_, err = f.createTeamDrivesCommand(ctx, []string{"media", "0"}, nil)
+	assert.ErrorContains(t, err, `invalid number of shared drives "0"`)
+	_, err = f.createTeamDrivesCommand(ctx, []string{"media", "2"}, map[string]string{"sa": ""})
+	assert.ErrorContains(t, err, "no service accounts in the pool")
+}
@@ -11,6 +11,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -82,6 +83,7 @@ const (
 	defaultSAPacerMinSleep = fs.Duration(50 * time.Millisecond)  // lower pacer sleep when many SAs
 	defaultMaxServices     = 100                                 // max preloaded services in memory
 	defaultPreloadServices = 50                                  // services to preload at startup
+	defaultSATimeout       = fs.Duration(30 * time.Second)       // max time to create one SA service
 	//-----------------------------------------------------------
 )
 
@@ -245,7 +247,12 @@ func init() {
 				if driveScopesContainsAppFolder(driveConfig.Scopes) {
 					m.Set("root_folder_id", "appDataFolder")
 				}
-
+				//-----------------------------------------------------------
+				return fs.ConfigGoto("sa_pool")
+			case "sa_pool", "sa_pool_ok", "sa_folder", "sa_folder_check", "sa_rolling", "sa_test", "sa_test_target", "sa_test_again":
+				return serviceAccountConfig(ctx, name, m, opt, config)
+			case "auth":
+				//-----------------------------------------------------------
 				if opt.ServiceAccountFile == "" && opt.ServiceAccountCredentials == "" && !opt.EnvAuth {
 					return oauthutil.ConfigOut("teamdrive", &oauthutil.Options{
 						OAuth2Config: driveConfig,
@@ -332,7 +339,7 @@ a non root folder as its starting point.
 			Sensitive: true,
 		}, {
 			Name: "service_account_file",
-			Help: "Service Account Credentials JSON file path.\n\nLeave blank normally.\nNeeded only if you want use SA instead of interactive login." + env.ShellExpandHelp,
+			Help: "Service Account Credentials JSON file path.\n\nLeave blank normally.\nNeeded only if you want use SA instead of interactive login.\n\nA directory is used as service_account_file_path, starting with one of\nthe service accounts in it." + env.ShellExpandHelp,
 		}, {
 			Name:      "service_account_credentials",
 			Help:      "Service Account Credentials JSON blob.\n\nLeave blank normally.\nNeeded only if you want use SA instead of interactive login.",
@@ -774,11 +781,43 @@ See: https://developers.google.com/workspace/drive/api/guides/limited-expansive-
 			//-----------------------------------------------------------
 			{
 				Name: "service_account_file",
-				Help: "Service Account Credentials JSON file path.\n\nLeave blank normally.\nNeeded only if you want use SA instead of interactive login." + env.ShellExpandHelp,
+				Help: "Service Account Credentials JSON file path.\n\nLeave blank normally.\nNeeded only if you want use SA instead of interactive login.\n\nA directory is used as service_account_file_path, starting with one of\nthe service accounts in it." + env.ShellExpandHelp,
+			}, {
+				Name:     "sa_profile",
+				Help:     "Name of a service account profile to take pool options from.\n\nThe profile is a [sa_profile:NAME] section in the config file holding\nany of the service account pool options. Options set on the remote\noverride the profile.",
+				Advanced: true,
 			}, {
 				Name:     "service_account_file_path",
 				Help:     "Service Account Credentials JSON files directory.\n\nLeave blank normally.\nNeeded only if you want use SA auto switch." + env.ShellExpandHelp,
 				Advanced: true,
+			}, {
+				Name:       "service_account_keys",
+				Help:       "Service account keys for the pool, stored in the config file.\n\nBase64 of a JSON array of keys or a tar of key files, as for the\nECLONE_DRIVE_SA_BUNDLE environment variable. Usually set with the\nsaembed backend command. Set a config encryption password to encrypt\nthe keys at rest.",
+				Advanced:   true,
+				IsPassword: true,
+			}, {
+				Name:     "service_account_vault_path",
+				Help:     "HashiCorp Vault KV v2 path holding Service Account keys.\n\nE.g. \"secret/eclone/sa\". Every secret under this path is added to the\nService Account pool. Keys are kept in memory only.\n\nLeave blank normally.",
+				Advanced: true,
+			}, {
+				Name:     "service_account_vault_addr",
+				Help:     "Address of the HashiCorp Vault server.\n\nLeave blank to use the VAULT_ADDR environment variable.",
+				Advanced: true,
+			}, {
+				Name:      "service_account_vault_token",
+				Help:      "Token for the HashiCorp Vault server.\n\nLeave blank to use AppRole or the VAULT_TOKEN environment variable.",
+				Advanced:  true,
+				Sensitive: true,
+			}, {
+				Name:      "service_account_vault_role_id",
+				Help:      "AppRole role ID to log in to HashiCorp Vault with.",
+				Advanced:  true,
+				Sensitive: true,
+			}, {
+				Name:      "service_account_vault_secret_id",
+				Help:      "AppRole secret ID to log in to HashiCorp Vault with.",
+				Advanced:  true,
+				Sensitive: true,
 			}, {
 				Name:     "rolling_sa",
 				Help:     "Automaticly switching Service Account avoid account limit",
@@ -812,6 +851,244 @@ See: https://developers.google.com/workspace/drive/api/guides/limited-expansive-
 				Help:     "Maximum number of preloaded Drive services kept in memory.",
 				Hide:     fs.OptionHideConfigurator,
 				Advanced: true,
+			}, {
+				Name:     "services_prewarm",
+				Default:  false,
+				Help:     "Open a connection to the Drive API for each preloaded service.\n\nAfter preloading each service makes a request to the API host in the\nbackground, without its credentials so it costs no quota, so the first\ntransfer with each service account doesn't wait for the connection to\nbe set up.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "service_account_state_file",
+				Help:     "File to persist the service account pool state in.\n\nIf set, blacklist timers and rate limit counters are loaded from this\nfile at startup and saved back to it on shutdown, so they survive\nrestarts." + env.ShellExpandHelp,
+				Advanced: true,
+			}, {
+				Name:     "service_account_metrics",
+				Default:  "stats",
+				Help:     "Where to send the service account pool metrics.\n\nThe stats sink keeps them in memory and adds them to the core/stats rc\ncall, as serviceAccounts, and to the sametrics backend command and the\ndrive/sametrics rc call.\nThe prometheus sink publishes them on the rc metrics endpoint.",
+				Advanced: true,
+				Examples: []fs.OptionExample{{
+					Value: "none",
+					Help:  "Discard metrics.",
+				}, {
+					Value: "stats",
+					Help:  "Keep metrics in memory and add them to core/stats.",
+				}, {
+					Value: "prometheus",
+					Help:  "Publish metrics to Prometheus.",
+				}},
+			}, {
+				Name:     "service_account_timeout",
+				Default:  defaultSATimeout,
+				Help:     "Timeout for creating a service account's Drive service.\n\nThis includes fetching its first OAuth token. A service account which\ntimes out repeatedly is blacklisted. Set to 0 to disable the timeout.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "service_account_probe_interval",
+				Default:  fs.Duration(0),
+				Help:     "How often to check whether stale service accounts work again.\n\nStale service accounts are skipped by rolling rotation. Once its\nblacklist has run out each one is probed with a minimal request and\nthose which succeed are used again. The probe checks the credentials,\nnot the upload quota.\n\nLeave at 0 to leave stale service accounts out for the rest of the run.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "service_account_manifest_strict",
+				Default:  false,
+				Help:     "Refuse service account files which fail the folder's SHA256SUMS check.\n\nIf the service account folder contains a SHA256SUMS manifest every key\nis checked against it. Keys which are missing from it or don't match are\nlogged, and with this flag left out of the pool.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "service_account_shared_state",
+				Help:     "File shared with other eclone processes to coordinate service accounts.\n\nProcesses using the same service account folder on one machine should\npoint this at the same file. Each records the SAs it blacklists and the\nSA it is using in it, so the others skip the SAs it has used up and\nprefer ones it isn't using. Access is serialized with a lock file\nalongside it." + env.ShellExpandHelp,
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "sa_strict",
+				Default:  false,
+				Help:     "Fail before starting if any service account key is malformed.\n\nEvery key loaded into the pool is checked and a summary of valid,\nmalformed and duplicate keys logged. Without this flag malformed keys\nare only logged; with it they, or a scope service accounts can't use,\nstop the backend from starting.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "sa_status_file",
+				Default:  false,
+				Help:     "Add a virtual .eclone/sa-status.json file showing the pool state.\n\nReading the file returns the active service account, the blacklist\ntimers and the bytes uploaded with each service account as JSON. The\nfile isn't in the listing of the root, only read by its path or by\nlisting or mounting the .eclone directory itself.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "sa_spread_reads",
+				Default:  false,
+				Help:     "Spread reads over the preloaded service accounts.\n\nEach file opened for reading uses the preloaded SA with the fewest\nreads in flight instead of the SA in use. This spreads servers with\nmany simultaneous readers, e.g. serve http, over several accounts.\nNeeds services_preload to be set.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "list_batch",
+				Default:  0,
+				Help:     "Pass the entries of listings on in batches of this size.\n\nThe batches are passed on while the next page is listed, with at most\none waiting, so a folder of millions of entries is listed in bounded\nmemory however slowly its entries are dealt with. 0 passes them on\n100 at a time, listing nothing meanwhile.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "sa_spread_checks",
+				Default:  false,
+				Help:     "Spread listings over the preloaded service accounts.\n\nEach directory listing is made with the next preloaded SA in turn\ninstead of the SA in use, so the checkers of check, size and the\nchecking phase of copy and sync are spread over the pool. Needs\nservices_preload to be set.\n\nA preloaded SA which hits its rate limit is blacklisted and dropped,\nand the listing carries on with the SA in use.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "sa_log_switches",
+				Default:  false,
+				Help:     "Log every service account switch at INFO level.\n\nEach switch is logged with the email of the new SA, how many are left\nin the pool and why it switched, at DEBUG level unless this is set.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "upload_dedupe",
+				Default:  "",
+				Help:     "Upload each content once, copying it for files with the same content.\n\nThe MD5 and size of the files uploaded and listed are remembered. A file\nwith content already on the remote is made with a server side copy, or a\nshortcut, of the file holding it instead of being uploaded. Only files of\nat least upload_cutoff are deduped, and only against content seen by this\nprocess.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+				Examples: []fs.OptionExample{{
+					Value: "",
+					Help:  "Upload every file.",
+				}, {
+					Value: "copy",
+					Help:  "Copy the file holding the content server side.",
+				}, {
+					Value: "shortcut",
+					Help:  "Make a shortcut to the file holding the content.",
+				}},
+			}, {
+				Name:     "move_fallback",
+				Default:  fs.CommaSepList{},
+				Help:     "Comma separated ways to move a file when Drive refuses a server side move.\n\nDrive won't move files between drives in some cases, e.g. files owned\nby someone outside the destination shared drive. These moves then try\neach of the listed ways in turn:\n\n- copy: copy the file server side, then delete the source\n- shortcut: make a shortcut to the source, which is left in place\n- transfer: download and upload the file, then delete the source\n\nE.g. \"copy,transfer\". Empty to return the error.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "owner_filter",
+				Default:  fs.CommaSepList{},
+				Help:     "Only list files owned by these accounts.\n\nComma separated email addresses of the owners, \"me\" for the account\nin use or \"others\" for files owned by anyone else. Folders are always\nlisted. Only the listings of a copy source, ls and the like are\nnarrowed. Files on shared drives have no owner, so this can't be used\nwith them.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "state_filter",
+				Default:  fs.CommaSepList{},
+				Help:     "Only list files in these Drive states.\n\nComma separated states, all of which a file must be in:\n\n- starred: starred files\n- shared: files in \"Shared with me\"\n- trashed: files trashed explicitly, not just with their folder\n\nFolders are always listed. Only the listings of a copy source, ls and\nthe like are narrowed. trashed implies trashed_only.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "overflow_drive",
+				Default:  "",
+				Help:     "ID of a shared drive to put new files on once this one is full.\n\nA shared drive holds at most 400,000 items. When Drive refuses to add\nmore, the refused file and all new files after it are put at the same\npath on this shared drive instead. Files already on the full drive are\nupdated in place.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "overflow_map",
+				Default:  "",
+				Help:     "File to record the files put on overflow_drive in.\n\nEach file put on the overflow drive is appended as a line of JSON with\nits path and the ID of the overflow drive.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "item_warn",
+				Default:  0,
+				Help:     "Warn when a shared drive or folder gets this full, in percent.\n\nA shared drive holds at most 400,000 items and a folder at most\n500,000. Items made on the destination are counted and a warning logged\nthe first time either reaches this percentage of its limit. The\nwarning is only logged. The shared drive is counted in the background\nfrom when the first item is made on it. 0 turns this off.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "sa_eta_interval",
+				Default:  fs.Duration(0),
+				Help:     "How often to log when the service account pool will run out.\n\nThe quota left on the pool is logged with the stats, with when it will\nbe used up at the current speed and whether the rest of the job fits\nin it. Each SA is taken to have 750 GiB a day less what it uploaded.\nSet to 0 to disable.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "sa_stats",
+				Default:  true,
+				Help:     "Log a line on the service account pool with the stats.\n\nEvery --stats interval the number of SAs available, blacklisted and\ndead is logged with the SA in use, at the level of the stats.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "sa_bwlimit",
+				Default:  fs.BwTimetable{},
+				Help:     "Bandwidth limit for each service account.\n\nEach SA of the pool gets a budget of its own so one account can't\ntake all of --bwlimit while the others idle. The syntax is that of\n--bwlimit, so \"10M:100M\" sets upload and download separately and\n\"08:00,1M 19:00,off\" follows a timetable.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "rate_limit_timeline",
+				Default:  "",
+				Help:     "File to write a CSV timeline of the rate limits to at the end of the run.\n\nThe pacer backoffs, with the time slept in them, and the 403 errors\nwith their reasons are counted per minute and per service account, to\nshow when and why throughput collapsed.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "history_file",
+				Default:  "",
+				Help:     "File to record every transfer to the remote in.\n\nThe path, size, MD5, service account and duration of each upload,\noverwrite and server side copy are kept in a database which\n\"eclone history\" queries.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "max_daily_transfer",
+				Default:  fs.SizeSuffix(-1),
+				Help:     "Maximum bytes transferred in 24 hours with all service accounts combined.\n\nUploads and server side copies with any SA of the pool count towards\nit. Once the last 24 hours add up to it further transfers fail with a\nfatal error, stopping the run. Set service_account_state_file to\nkeep counting over successive runs.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "split_size",
+				Default:  fs.SizeSuffix(-1),
+				Help:     "Split files bigger than this into parts of this size.\n\nDrive won't hold a file over 5 TiB, so bigger files are uploaded as\nparts with a manifest under the name of the file, which reads back as\nthe whole file. The parts are hidden from listings. Set it to 5T or\nless; off by default.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "checksum_db",
+				Default:  "",
+				Help:     "File to record the plaintext MD5 of files uploaded through crypt in.\n\nDrive only has the MD5 of the encrypted files of a crypt remote over\nthis one, so the MD5 of the source of each is recorded against its\nDrive ID for \"eclone check\" to compare without downloading.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "overwrite_revision",
+				Default:  false,
+				Help:     "Overwrite files with a new revision even when copying server side.\n\nA server side copy over an existing file makes a new file and removes\nthe old one, losing its ID, sharing links and comments. With this set\nthe content is uploaded as a new revision of the existing file instead,\nwhich is what other overwrites do.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "keep_revisions",
+				Default:  0,
+				Help:     "Number of revisions to keep of overwritten files.\n\nOnce a file is overwritten with a new revision its oldest revisions\nare deleted, including those kept forever, leaving this many. 0 leaves\nthem to Drive, which deletes them after 30 days or 100 revisions.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "exhausted_pause",
+				Default:  fs.Duration(0),
+				Help:     "Pause for up to this long when every service account is blacklisted.\n\nInstead of failing the transfers once the pool is exhausted, the run\nwaits, with its state and preloaded services, until the first service\naccount comes off the blacklist, if that is within this time, and then\ncarries on. 0 never pauses.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "blacklist_until_reset",
+				Default:  false,
+				Help:     "Take service accounts off the blacklist when the daily quota resets.\n\nGoogle resets the daily quotas at midnight Pacific time, so rather than\nsitting out 25 hours a blacklisted service account comes back just\nafter the first reset since it was blacklisted. This applies to every\npool of the process.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "sa_max_idle_conns",
+				Default:  0,
+				Help:     "Idle connections each service account's client keeps open.\n\nEach SA has an HTTP client of its own, which by default keeps twice\n--checkers plus --transfers idle connections. With many services\npreloaded they add up, so lower this for big pools. 0 keeps the\ndefault.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "sa_idle_timeout",
+				Default:  fs.Duration(0),
+				Help:     "How long the client of a service account keeps an idle connection.\n\n0 keeps the default of 1m.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "sa_http2_ping",
+				Default:  fs.Duration(0),
+				Help:     "Ping HTTP/2 connections which have been quiet this long.\n\nA connection which doesn't answer the ping is closed, so one the\nnetwork has dropped isn't used again. Only applies with\ndisable_http2 = false. 0 doesn't ping.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "metadata_gzip",
+				Default:  true,
+				Help:     "Ask for the listings and other metadata gzipped.\n\nThe Drive API only compresses responses for requests whose User-Agent\nsays they take gzip, which cuts the time listings take over slow links.\nThe bytes saved are logged at debug level when the backend shuts down.\nUploads and downloads aren't affected. --no-gzip-encoding turns it off\ntoo.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
+			}, {
+				Name:     "sa_token_cache",
+				Default:  true,
+				Help:     "Keep the access tokens of the service accounts for later runs.\n\nThe token each service account gets for its key is saved in the cache\ndirectory, readable only by the user, and used by later runs until it\nexpires. This saves a big pool asking for a token for every SA it\npreloads each time it starts.",
+				Hide:     fs.OptionHideConfigurator,
+				Advanced: true,
 			},
 			//-----------------------------------------------------------
 		}...),
@@ -878,13 +1155,57 @@ type Options struct {
 	Enc                       encoder.MultiEncoder `config:"encoding"`
 	EnvAuth                   bool                 `config:"env_auth"`
 	//-----------------------------------------------------------
-	ServiceAccountFilePath string `config:"service_account_file_path"`
-	RollingSA              bool   `config:"rolling_sa"`
-	RollingCount           int    `config:"rolling_count"`
-	RandomPickSA           bool   `config:"random_pick_sa"`
-	ServiceAccountMinSleep fs.Duration `config:"service_account_min_sleep"`
-	ServicesPreload        int         `config:"services_preload"`
-	ServicesMax            int         `config:"services_max"`
+	ServiceAccountFilePath       string          `config:"service_account_file_path"`
+	ServiceAccountVaultPath      string          `config:"service_account_vault_path"`
+	ServiceAccountVaultAddr      string          `config:"service_account_vault_addr"`
+	ServiceAccountVaultToken     string          `config:"service_account_vault_token"`
+	ServiceAccountVaultRoleID    string          `config:"service_account_vault_role_id"`
+	ServiceAccountVaultSecretID  string          `config:"service_account_vault_secret_id"`
+	RollingSA                    bool            `config:"rolling_sa"`
+	RollingCount                 int             `config:"rolling_count"`
+	RandomPickSA                 bool            `config:"random_pick_sa"`
+	ServiceAccountMinSleep       fs.Duration     `config:"service_account_min_sleep"`
+	ServicesPreload              int             `config:"services_preload"`
+	ServicesMax                  int             `config:"services_max"`
+	ServicesPrewarm              bool            `config:"services_prewarm"`
+	ServiceAccountTimeout        fs.Duration     `config:"service_account_timeout"`
+	ServiceAccountState          string          `config:"service_account_state_file"`
+	ServiceAccountMetrics        string          `config:"service_account_metrics"`
+	ServiceAccountManifestStrict bool            `config:"service_account_manifest_strict"`
+	ServiceAccountProfile        string          `config:"sa_profile"`
+	ServiceAccountStrict         bool            `config:"sa_strict"`
+	ServiceAccountSharedState    string          `config:"service_account_shared_state"`
+	ServiceAccountSpreadReads    bool            `config:"sa_spread_reads"`
+	ServiceAccountSpreadChecks   bool            `config:"sa_spread_checks"`
+	ListBatch                    int             `config:"list_batch"`
+	ServiceAccountLogSwitches    bool            `config:"sa_log_switches"`
+	ServiceAccountStatusFile     bool            `config:"sa_status_file"`
+	MaxDailyTransfer             fs.SizeSuffix   `config:"max_daily_transfer"`
+	ServiceAccountBwLimit        fs.BwTimetable  `config:"sa_bwlimit"`
+	UploadDedupe                 string          `config:"upload_dedupe"`
+	MoveFallback                 fs.CommaSepList `config:"move_fallback"`
+	OwnerFilter                  fs.CommaSepList `config:"owner_filter"`
+	StateFilter                  fs.CommaSepList `config:"state_filter"`
+	OverflowDrive                string          `config:"overflow_drive"`
+	OverflowMap                  string          `config:"overflow_map"`
+	ItemWarn                     int             `config:"item_warn"`
+	ServiceAccountEtaInterval    fs.Duration     `config:"sa_eta_interval"`
+	RateLimitTimeline            string          `config:"rate_limit_timeline"`
+	HistoryFile                  string          `config:"history_file"`
+	SplitSize                    fs.SizeSuffix   `config:"split_size"`
+	ChecksumDB                   string          `config:"checksum_db"`
+	OverwriteRevision            bool            `config:"overwrite_revision"`
+	KeepRevisions                int             `config:"keep_revisions"`
+	ExhaustedPause               fs.Duration     `config:"exhausted_pause"`
+	BlacklistUntilReset          bool            `config:"blacklist_until_reset"`
+	ServiceAccountStats          bool            `config:"sa_stats"`
+	ServiceAccountKeys           string          `config:"service_account_keys"`
+	ServiceAccountProbeInterval  fs.Duration     `config:"service_account_probe_interval"`
+	ServiceAccountTokenCache     bool            `config:"sa_token_cache"`
+	MetadataGzip                 bool            `config:"metadata_gzip"`
+	ServiceAccountMaxIdleConns   int             `config:"sa_max_idle_conns"`
+	ServiceAccountIdleTimeout    fs.Duration     `config:"sa_idle_timeout"`
+	ServiceAccountHTTP2Ping      fs.Duration     `config:"sa_http2_ping"`
 	//-----------------------------------------------------------
 }
 
@@ -918,6 +1239,18 @@ type Fs struct {
 	lastChangeSATime    time.Time
 	FileObj             *fs.Object
 	maybeIsFile         bool
+	dedupe              *uploadDedupe // content already on the remote, if upload_dedupe is set
+	ownerQuery          string        // search term for owner_filter, if set
+	stateQuery          string        // search term for state_filter, if set
+	explicitlyTrashed   bool          // list only explicitly trashed files
+	overflow            *overflow     // where new files go once the drive is full, if overflow_drive is set
+	items               *itemBudget   // counts items towards the Drive limits, if item_warn is set
+	timeline            *rateTimeline // records the rate limits, if rate_limit_timeline is set
+	history             *history      // records the transfers, if history_file is set
+	checksums           *checksums    // records the plaintext MD5 of crypt files, if checksum_db is set
+	revisions           bool          // list the revisions of files, set by EnableRevisions
+	exhaustedMu         *sync.Mutex   // held while waiting out an exhausted pool
+	errorReasons        *errorReasons // counts the errors Drive returns by reason
 	//-----------------------------------------------------------
 }
 
@@ -931,6 +1264,10 @@ type baseObject struct {
 	parents      []string     // IDs of the parent directories
 	resourceKey  *string      // resourceKey is needed for link shared objects
 	metadata     *fs.Metadata // metadata if known
+	//-----------------------------------------------------------
+	revision       string // head revision ID, or version, if listed with revisions
+	sourceRevision string // revision of the source recorded on the file
+	//-----------------------------------------------------------
 }
 type documentObject struct {
 	baseObject
@@ -952,6 +1289,9 @@ type Object struct {
 	sha1sum    string // sha1sum of the object
 	sha256sum  string // sha256sum of the object
 	v2Download bool   // generate v2 download link ondemand
+	//-----------------------------------------------------------
+	split bool // set if this is the manifest of a file split into parts
+	//-----------------------------------------------------------
 }
 
 // Directory describes a drive directory
@@ -982,13 +1322,34 @@ func (f *Fs) Features() *fs.Features {
 }
 
 // shouldRetry determines whether a given err rates being retried
-func (f *Fs) shouldRetry(ctx context.Context, err error) (bool, error) {
+func (f *Fs) shouldRetry(ctx context.Context, err error) (retry bool, retryErr error) {
 	if fserrors.ContextError(ctx, &err) {
 		return false, err
 	}
 	if err == nil {
 		return false, nil
 	}
+	//-----------------------------------------------------------
+	f.errorReasons.record(f.opt.ServiceAccountFile, err)
+	defer func() {
+		// Say what to do about the errors which won't be retried
+		if !retry {
+			retryErr = explainError(retryErr)
+		}
+	}()
+	if reason, dead := isDeadServiceAccountError(err); dead && f.opt.usesServiceAccountPool() {
+		// The SA can never work again so take it out and switch straight away
+		f.waitChangeSvc.Lock()
+		f.ServiceAccountFiles.MarkDead(f.opt.ServiceAccountFile, reason)
+		changeErr := f.changeSvc(ctx, reason)
+		f.waitChangeSvc.Unlock()
+		if changeErr != nil {
+			fs.Errorf(f, "Failed to replace dead service account: %v", changeErr)
+			return false, err
+		}
+		return true, err
+	}
+	//-----------------------------------------------------------
 	if fserrors.ShouldRetry(err) {
 		return true, err
 	}
@@ -1003,11 +1364,28 @@ func (f *Fs) shouldRetry(ctx context.Context, err error) (bool, error) {
 			message := gerr.Errors[0].Message
 			if reason == "rateLimitExceeded" || reason == "userRateLimitExceeded" || reason == "dailyLimitExceededUnreg" || strings.HasPrefix(message, "Daily Limit") {
 				//-----------------------------------------------------------
+				if isFileRateLimit(gerr) {
+					// The limit is on this file so another SA won't help
+					f.ServiceAccountFiles.Metrics.Inc(metricFileRateLimits)
+					saDebugf(f, "Rate limit is on the file, retrying without changing service account: %v", err)
+					return true, err
+				}
+				if f.opt.usesServiceAccountPool() && !f.opt.StopOnUploadLimit {
+					f.ServiceAccountFiles.RecordQuotaError(f.opt.ServiceAccountFile, reason)
+				}
 				// Switch SA if: SA path configured, throttle allows it, and not stopping on upload limit
 				if f.shouldChangeSA() && !f.opt.StopOnUploadLimit {
 					f.waitChangeSvc.Lock()
-					f.changeSvc(ctx)
+					changeErr := f.changeSvc(ctx, reason)
 					f.waitChangeSvc.Unlock()
+					if errors.Is(changeErr, ErrPoolEmpty) {
+						f.ServiceAccountFiles.Metrics.Inc(metricExhausted)
+						fs.Errorf(f, "Service account pool exhausted, retrying with current SA: %v", changeErr)
+						f.ServiceAccountFiles.exhausted()
+						f.pauseExhausted(ctx)
+					} else if changeErr != nil {
+						fs.Errorf(f, "Failed to change service account: %v", changeErr)
+					}
 					return true, err
 				}
 				//-----------------------------------------------------------
@@ -1025,6 +1403,14 @@ func (f *Fs) shouldRetry(ctx context.Context, err error) (bool, error) {
 			} else if f.opt.StopOnUploadLimit && reason == "teamDriveFileLimitExceeded" {
 				fs.Errorf(f, "Received Shared Drive file limit error: %v", err)
 				return false, fserrors.FatalError(err)
+				//-----------------------------------------------------------
+			} else if reason == "downloadQuotaExceeded" {
+				// Don't retry or change the SA of the Fs - opening the
+				// file retries with the preloaded SAs instead
+				f.ServiceAccountFiles.Metrics.Inc(metricFileRateLimits)
+				fs.Debugf(f, "Download quota exceeded for the file, not changing service account: %v", err)
+				return false, err
+				//-----------------------------------------------------------
 			}
 		}
 	}
@@ -1033,10 +1419,57 @@ func (f *Fs) shouldRetry(ctx context.Context, err error) (bool, error) {
 
 //-----------------------------------------------------------
 
+// isFileRateLimit returns true if the rate limit error gerr is about the
+// file being accessed, e.g. one read too often, rather than the account.
+// Drive reports the limits of the user and the project in the
+// "usageLimits" domain and those of a single item in the "global" one.
+//
+// Changing SA doesn't help with these so they shouldn't spend one.
+func isFileRateLimit(gerr *googleapi.Error) bool {
+	return errorDomain(gerr) == "global"
+}
+
+// errorDomain returns the domain of the first error in the body of gerr,
+// which googleapi doesn't parse, or "" if it has none.
+func errorDomain(gerr *googleapi.Error) string {
+	var reply struct {
+		Error struct {
+			Errors []struct {
+				Domain string `json:"domain"`
+			} `json:"errors"`
+		} `json:"error"`
+	}
+	if json.Unmarshal([]byte(gerr.Body), &reply) != nil || len(reply.Error.Errors) == 0 {
+		return ""
+	}
+	return reply.Error.Errors[0].Domain
+}
+
+// IsQuotaError returns true if err is a Drive quota or rate limit error
+// which another service account, or waiting for the quota to reset, could
+// get past. Rate limits on a single file don't count.
+func IsQuotaError(err error) bool {
+	if errors.Is(err, ErrPoolEmpty) {
+		return true
+	}
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) || len(gerr.Errors) == 0 {
+		return false
+	}
+	item := gerr.Errors[0]
+	switch item.Reason {
+	case "rateLimitExceeded", "userRateLimitExceeded", "dailyLimitExceededUnreg":
+		return !isFileRateLimit(gerr)
+	case "quotaExceeded":
+		return true
+	}
+	return strings.HasPrefix(item.Message, "Daily Limit")
+}
+
 // shouldChangeSA determines whether enough time has passed since the last SA change.
 // This prevents rapid SA exhaustion under heavy rate limiting (anti-thrashing).
 func (f *Fs) shouldChangeSA() bool {
-	if f.opt.ServiceAccountFilePath == "" {
+	if !f.opt.usesServiceAccountPool() {
 		return false
 	}
 	return time.Duration(f.opt.ServiceAccountMinSleep) == 0 ||
@@ -1045,28 +1478,29 @@ func (f *Fs) shouldChangeSA() bool {
 
 // changeSvc switches to a new service account when the current one hits rate limits.
 // Uses the pool's blacklist-aware random selection and recycles the old service.
-func (f *Fs) changeSvc(ctx context.Context) {
+//
+// reason is the reason of the error the switch is for, which is logged.
+//
+// If the pool has run dry the error wraps ErrPoolEmpty.
+func (f *Fs) changeSvc(ctx context.Context, reason string) error {
 	opt := &f.opt
 	pool := f.ServiceAccountFiles
 
 	// Load SA files if pool is empty
-	if len(pool.Files) == 0 {
+	if pool.Available() == 0 {
 		if _, err := pool.Load(opt); err != nil {
-			fs.Errorf(nil, "Failed to load service accounts: %v", err)
-			return
+			return fmt.Errorf("failed to load service accounts: %w", err)
 		}
 	}
-	if len(pool.Files) == 0 {
-		fs.Errorf(nil, "No available service account files")
-		return
+	if pool.Available() == 0 {
+		return ErrPoolEmpty
 	}
 
 	// Get a new SA file, blacklisting the current one
 	oldFile := opt.ServiceAccountFile
 	newFile, err := pool.GetFile(oldFile)
 	if err != nil {
-		fs.Errorf(nil, "Failed to get new service account file: %v", err)
-		return
+		return fmt.Errorf("failed to get new service account file: %w", err)
 	}
 
 	// Recycle the old service into the preloaded pool before switching
@@ -1076,13 +1510,16 @@ func (f *Fs) changeSvc(ctx context.Context) {
 
 	// Switch to the new SA file
 	if err := f.changeServiceAccountFile(ctx, newFile); err != nil {
-		fs.Errorf(nil, "Failed to change to SA file %s: %v", newFile, err)
-		return
+		return fmt.Errorf("failed to change to SA file %s: %w", newFile, err)
 	}
 
 	// Update the gclone-style index for rollup compatibility
+	pool.mu.Lock()
 	pool.activeSa(newFile)
-	fs.Debugf(nil, "Service Account changed to %s (remaining: %d)", opt.ServiceAccountFile, len(pool.Files))
+	pool.mu.Unlock()
+	pool.Metrics.Inc(metricSwitches)
+	f.logSwitch(reason)
+	return nil
 }
 
 // rollingSvc proactively switches to the next SA in sequential order (rollup).
@@ -1091,19 +1528,29 @@ func (f *Fs) changeSvc(ctx context.Context) {
 func (f *Fs) rollingSvc(ctx context.Context) {
 	opt := &f.opt
 	pool := f.ServiceAccountFiles
-	if pool.isPoolEmpty() {
+	pool.mu.Lock()
+	empty := pool.isPoolEmpty()
+	pool.mu.Unlock()
+	if empty {
 		if _, err := pool.Load(opt); err != nil {
 			fs.Errorf(nil, "Failed to load service accounts: %v", err)
 			return
 		}
 	}
+	// The stale probe may be changing the index in the background
+	pool.mu.Lock()
 	newSa := pool.rollup()
+	pool.mu.Unlock()
 	if newSa == "" {
 		fs.Errorf(nil, "No available SA for rolling rotation")
 		return
 	}
 	if err := f.changeServiceAccountFile(ctx, newSa); err == nil {
+		pool.mu.Lock()
 		pool.activeSa(newSa)
+		pool.mu.Unlock()
+		pool.claimShared(newSa)
+		pool.Metrics.Inc(metricRolls)
 		fs.Infof(nil, "Rolling SA to: %s", newSa)
 	} else {
 		fs.Errorf(nil, "Rolling SA to %s failed: %v", newSa, err)
@@ -1243,32 +1690,53 @@ func (f *Fs) list(ctx context.Context, dirIDs []string, title string, directorie
 		queryByTime(">=", fi.ModTimeFrom)
 		queryByTime("<=", fi.ModTimeTo)
 	}
-
-	list := f.svc.Files.List()
-	queryString := strings.Join(query, " and ")
-	if queryString != "" {
-		list.Q(queryString)
-		// fs.Debugf(f, "list query: %q", queryString)
+	//-----------------------------------------------------------
+	// Constrain it to the owners of owner_filter and the states of
+	// state_filter in the same way
+	useFilter := filter.GetUseFilter(ctx)
+	if useFilter {
+		for _, q := range []string{f.ownerQuery, f.stateQuery} {
+			if q != "" {
+				query = append(query, q)
+			}
+		}
 	}
-	f.lastQuery = queryString // for unit tests
 
-	if f.opt.ListChunk > 0 {
-		list.PageSize(f.opt.ListChunk)
-	}
-	list.SupportsAllDrives(true)
-	list.IncludeItemsFromAllDrives(true)
-	if f.isTeamDrive && !f.opt.SharedWithMe {
-		list.DriveId(f.opt.TeamDriveID)
-		list.Corpora("drive")
-	}
-	// If using appDataFolder then need to add Spaces
-	if f.rootFolderID == "appDataFolder" {
-		list.Spaces("appDataFolder")
-	}
-	// Add resource Keys if necessary
-	if resourceKeysHeader != "" {
-		list.Header().Add("X-Goog-Drive-Resource-Keys", resourceKeysHeader)
-	}
+	//-----------------------------------------------------------
+	// newList makes the listing with svc, so that a listing spread to a
+	// preloaded service can be made again with the one in use
+	svc, spread := f.listService()
+	newList := func(svc *drive.Service) *drive.FilesListCall {
+		list := svc.Files.List()
+		queryString := strings.Join(query, " and ")
+		if queryString != "" {
+			list.Q(queryString)
+			// fs.Debugf(f, "list query: %q", queryString)
+		}
+		f.lastQuery = queryString // for unit tests
+
+		if f.opt.ListChunk > 0 {
+			list.PageSize(f.opt.ListChunk)
+		}
+		list.SupportsAllDrives(true)
+		list.IncludeItemsFromAllDrives(true)
+		if f.isTeamDrive && !f.opt.SharedWithMe {
+			list.DriveId(f.opt.TeamDriveID)
+			list.Corpora("drive")
+		}
+		// If using appDataFolder then need to add Spaces
+		if f.rootFolderID == "appDataFolder" {
+			list.Spaces("appDataFolder")
+		}
+		// Add resource Keys if necessary
+		if resourceKeysHeader != "" {
+			list.Header().Add("X-Goog-Drive-Resource-Keys", resourceKeysHeader)
+		}
+		return list
+	}
+	list := newList(svc)
+	pageToken := "" // of the page being listed, for newList
+	//-----------------------------------------------------------
 
 	fields := fmt.Sprintf("files(%s),nextPageToken,incompleteSearch", f.getFileFields(ctx))
 
@@ -1277,6 +1745,14 @@ OUTER:
 		var files *drive.FileList
 		err = f.pacer.Call(func() (bool, error) {
 			files, err = list.Fields(googleapi.Field(fields)).Context(ctx).Do()
+			//-----------------------------------------------------------
+			if f.ServiceAccountFiles.spreadFailed(spread, err) {
+				// Carry on with the service in use from the same page
+				spread = nil
+				list = newList(f.svc).PageToken(pageToken)
+				return true, err
+			}
+			//-----------------------------------------------------------
 			return f.shouldRetry(ctx, err)
 		})
 		if err != nil {
@@ -1322,6 +1798,12 @@ OUTER:
 					continue
 				}
 			}
+			//-----------------------------------------------------------
+			// Drive can't search for explicitly trashed files
+			if f.explicitlyTrashed && useFilter && item.MimeType != driveFolderType && !item.ExplicitlyTrashed {
+				continue
+			}
+			//-----------------------------------------------------------
 			if fn(item) {
 				found = true
 				break OUTER
@@ -1331,6 +1813,7 @@ OUTER:
 			break
 		}
 		list.PageToken(files.NextPageToken)
+		pageToken = files.NextPageToken
 	}
 	return
 }
@@ -1417,10 +1900,20 @@ func getClient(ctx context.Context, opt *Options) *http.Client {
 		if opt.DisableHTTP2 {
 			t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
 		}
+		//-----------------------------------------------------------
+		tuneTransport(t, opt)
+		//-----------------------------------------------------------
 	})
-	return &http.Client{
-		Transport: t,
+	//-----------------------------------------------------------
+	var rt http.RoundTripper = t
+	if opt.MetadataGzip && !fs.GetConfig(ctx).NoGzip {
+		t.SetRequestFilter(gzipUserAgent)
+		rt = &gzipTransport{base: t}
 	}
+	return guardVerifyOnly(&http.Client{
+		Transport: rt,
+	})
+	//-----------------------------------------------------------
 }
 
 func getServiceAccountClient(ctx context.Context, opt *Options, credentialsData []byte) (*http.Client, error) {
@@ -1442,7 +1935,7 @@ func createOAuthClient(ctx context.Context, opt *Options, name string, m configm
 
 	// try loading service account credentials from env variable, then from a file
 	if len(opt.ServiceAccountCredentials) == 0 && opt.ServiceAccountFile != "" {
-		loadedCreds, err := os.ReadFile(env.ShellExpand(opt.ServiceAccountFile))
+		loadedCreds, err := readServiceAccountFile(opt.ServiceAccountFile)
 		if err != nil {
 			return nil, fmt.Errorf("error opening service account credentials file: %w", err)
 		}
@@ -1453,12 +1946,18 @@ func createOAuthClient(ctx context.Context, opt *Options, name string, m configm
 		if err != nil {
 			return nil, fmt.Errorf("failed to create oauth client from service account: %w", err)
 		}
+		//-----------------------------------------------------------
+		limitServiceAccountBandwidth(oAuthClient, opt.ServiceAccountFile, opt)
+		//-----------------------------------------------------------
 	} else if opt.EnvAuth {
 		scopes := driveScopes(opt.Scope)
 		oAuthClient, err = google.DefaultClient(ctx, scopes...)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create client from environment: %w", err)
 		}
+		//-----------------------------------------------------------
+		guardVerifyOnly(oAuthClient)
+		//-----------------------------------------------------------
 	} else {
 		oAuthClient, _, err = oauthutil.NewClientWithBaseClient(ctx, name, m, driveConfig, getClient(ctx, opt))
 		if err != nil {
@@ -1503,13 +2002,29 @@ func (f *Fs) setUploadCutoff(cs fs.SizeSuffix) (old fs.SizeSuffix, err error) {
 //
 // It constructs a valid Fs but doesn't attempt to figure out whether
 // it is a file or a directory.
-func newFs(ctx context.Context, name, path string, m configmap.Mapper) (*Fs, error) {
+func newFs(ctx context.Context, name, path string, m configmap.Mapper) (_ *Fs, err error) {
 	// Parse config into Options struct
 	opt := new(Options)
-	err := configstruct.Set(m, opt)
+	err = configstruct.Set(m, opt)
 	//-----------------------------------------------------------
+	if err == nil && opt.ServiceAccountProfile != "" {
+		err = applyServiceAccountProfile(m, opt)
+	}
+	if err == nil {
+		useServiceAccountFileDir(opt)
+	}
 	maybeIsFile := false
 	saPool := NewServiceAccountPool(ctx, opt.ServicesMax)
+	defer func() {
+		if err != nil {
+			// Stop what the pool started
+			_ = saPool.Close()
+		}
+	}()
+	saPool.MaxDailyTransfer = int64(opt.MaxDailyTransfer)
+	if err == nil {
+		saPool.Metrics, err = newMetrics(opt.ServiceAccountMetrics)
+	}
 	// Add {id} as root directory support
 	if path != "" && path[0:1] == "{" {
 		idIndex := strings.Index(path, "}")
@@ -1528,19 +2043,53 @@ func newFs(ctx context.Context, name, path string, m configmap.Mapper) (*Fs, err
 		}
 	}
 	// Load SA pool and optionally auto-assign initial SA
-	if opt.ServiceAccountFilePath != "" {
+	if opt.usesServiceAccountPool() {
+		if opt.BlacklistUntilReset {
+			blacklistUntilReset.Store(true)
+		}
 		if _, err := saPool.Load(opt); err != nil {
+			if opt.ServiceAccountStrict {
+				return nil, fmt.Errorf("failed to load service accounts: %w", err)
+			}
 			fs.Errorf(nil, "Failed to load service accounts: %v", err)
-		} else if opt.RandomPickSA {
-			// Random pick from loaded SAs
-			if ranIdx := saPool.randomPick(); ranIdx != -1 {
-				opt.ServiceAccountFile = saPool.sas[ranIdx].saPath
+		} else {
+			if opt.ServiceAccountState != "" {
+				// Carry blacklist timers over from previous runs before picking
+				saPool.StateFile = env.ShellExpand(opt.ServiceAccountState)
+				if err := saPool.LoadState(saPool.StateFile); err != nil {
+					fs.Errorf(nil, "Failed to load service account state: %v", err)
+				}
+			}
+			if interval := time.Duration(opt.ServiceAccountProbeInterval); interval > 0 {
+				saPool.StartStaleProbe(interval, saPool.serviceAccountProber(opt))
+			}
+			if interval := time.Duration(opt.ServiceAccountEtaInterval); interval > 0 {
+				saPool.StartEtaLog(interval)
 			}
-		} else if opt.ServiceAccountFile == "" && len(saPool.Files) > 0 {
-			// Auto-assign first available SA if none configured
-			if file, err := saPool.GetFile(""); err == nil {
-				opt.ServiceAccountFile = file
-				fs.Debugf(nil, "Auto-assigned Service Account File: %s", file)
+			if interval := statsInterval(fs.GetConfig(ctx)); opt.ServiceAccountStats && interval > 0 {
+				saPool.StartStatsLine(interval)
+			}
+			if opt.ServiceAccountSharedState != "" {
+				// Coordinate with other processes before picking
+				saPool.UseSharedState(env.ShellExpand(opt.ServiceAccountSharedState), opt.ServiceAccountFile)
+			}
+			if opt.RandomPickSA {
+				// Random pick from loaded SAs
+				saPool.mu.Lock()
+				ranIdx := saPool.randomPick()
+				if ranIdx != -1 {
+					opt.ServiceAccountFile = saPool.sas[ranIdx].saPath
+				}
+				saPool.mu.Unlock()
+				if ranIdx != -1 {
+					saPool.claimShared(opt.ServiceAccountFile)
+				}
+			} else if opt.ServiceAccountFile == "" && saPool.Available() > 0 {
+				// Auto-assign first available SA if none configured
+				if file, err := saPool.GetFile(""); err == nil {
+					opt.ServiceAccountFile = file
+					saDebugf(nil, "Auto-assigned Service Account File: %s", file)
+				}
 			}
 		}
 	}
@@ -1570,6 +2119,38 @@ func newFs(ctx context.Context, name, path string, m configmap.Mapper) (*Fs, err
 
 	ci := fs.GetConfig(ctx)
 	//-----------------------------------------------------------
+	dedupe, err := newUploadDedupe(opt.UploadDedupe)
+	if err != nil {
+		return nil, fmt.Errorf("drive: %w", err)
+	}
+	if err = checkMoveFallback(opt.MoveFallback); err != nil {
+		return nil, fmt.Errorf("drive: %w", err)
+	}
+	owners, err := ownerQuery(opt.OwnerFilter)
+	if err != nil {
+		return nil, fmt.Errorf("drive: %w", err)
+	}
+	if owners != "" && opt.TeamDriveID != "" {
+		return nil, errors.New("drive: owner_filter can't be used with a shared drive as its files have no owner")
+	}
+	states, explicitlyTrashed, err := stateQuery(opt.StateFilter)
+	if err != nil {
+		return nil, fmt.Errorf("drive: %w", err)
+	}
+	if explicitlyTrashed {
+		opt.TrashedOnly = true
+	}
+	overflow, err := newOverflow(opt)
+	if err != nil {
+		return nil, fmt.Errorf("drive: %w", err)
+	}
+	items, err := newItemBudget(name, opt)
+	if err != nil {
+		return nil, fmt.Errorf("drive: %w", err)
+	}
+	if err = checkSplitSize(opt.SplitSize); err != nil {
+		return nil, fmt.Errorf("drive: %w", err)
+	}
 	// if enable rolling sa
 	if opt.RollingSA {
 		if opt.RollingCount > 0 {
@@ -1594,9 +2175,26 @@ func newFs(ctx context.Context, name, path string, m configmap.Mapper) (*Fs, err
 		permissions:     make(map[string]*drive.Permission),
 		//-----------------------------------------------------------
 		waitChangeSvc:       new(sync.Mutex),
+		exhaustedMu:         new(sync.Mutex),
 		ServiceAccountFiles: saPool,
+		dedupe:              dedupe,
+		ownerQuery:          owners,
+		stateQuery:          states,
+		explicitlyTrashed:   explicitlyTrashed,
+		overflow:            overflow,
+		items:               items,
+		timeline:            newRateTimeline(opt.RateLimitTimeline),
+		history:             newHistory(opt.HistoryFile),
+		checksums:           newChecksums(opt.ChecksumDB),
+		errorReasons:        newErrorReasons(),
 		//-----------------------------------------------------------
 	}
+	//-----------------------------------------------------------
+	if f.timeline != nil {
+		// Record the backoffs of the first SA too
+		f.pacer = f.newPacer(ctx)
+	}
+	//-----------------------------------------------------------
 	f.isTeamDrive = opt.TeamDriveID != ""
 	f.features = (&fs.Features{
 		DuplicateFiles:           true,
@@ -1631,15 +2229,19 @@ func newFs(ctx context.Context, name, path string, m configmap.Mapper) (*Fs, err
 
 	//-----------------------------------------------------------
 	f.maybeIsFile = maybeIsFile
+	f.ServiceAccountFiles.publishMetrics(name)
 
 	// Preload SA services for instant switching (fclone feature)
-	if len(f.ServiceAccountFiles.Files) > 0 {
+	if f.ServiceAccountFiles.Available() > 0 {
 		if svcs, err := f.ServiceAccountFiles.PreloadServices(f, f.opt.ServicesPreload); err == nil {
+			if f.opt.ServicesPrewarm {
+				f.ServiceAccountFiles.StartPrewarm(svcs)
+			}
 			// Auto-lower pacer min sleep when many SAs are available
 			// (more SAs = more headroom, less need for conservative pacing)
 			if len(svcs) > 10 && opt.PacerMinSleep >= defaultMinSleep {
 				f.opt.PacerMinSleep = defaultSAPacerMinSleep
-				f.pacer = fs.NewPacer(ctx, pacer.NewGoogleDrive(pacer.MinSleep(f.opt.PacerMinSleep), pacer.Burst(f.opt.PacerBurst)))
+				f.pacer = f.newPacer(ctx)
 				fs.Debugf(nil, "Auto-lowered pacer min sleep to %v (>10 SAs preloaded)", f.opt.PacerMinSleep)
 			}
 		}
@@ -1650,11 +2252,19 @@ func newFs(ctx context.Context, name, path string, m configmap.Mapper) (*Fs, err
 }
 
 // NewFs constructs an Fs from the path, container:path
-func NewFs(ctx context.Context, name, path string, m configmap.Mapper) (fs.Fs, error) {
+func NewFs(ctx context.Context, name, path string, m configmap.Mapper) (_ fs.Fs, err error) {
 	f, err := newFs(ctx, name, path, m)
 	if err != nil {
 		return nil, err
 	}
+	//-----------------------------------------------------------
+	defer func() {
+		if err != nil && !errors.Is(err, fs.ErrorIsFile) {
+			// Stop what the pool started
+			_ = f.ServiceAccountFiles.Close()
+		}
+	}()
+	//-----------------------------------------------------------
 
 	// Set the root folder ID
 	if f.opt.RootFolderID != "" {
@@ -1727,6 +2337,14 @@ func NewFs(ctx context.Context, name, path string, m configmap.Mapper) (fs.Fs, e
 	}
 	//-----------------------------------------------------------
 
+	//-----------------------------------------------------------
+	if f.statusPath("") == statusFile {
+		f.root = statusDir
+		f.dirCache = dircache.New(f.root, f.rootFolderID, f)
+		return f, fs.ErrorIsFile
+	}
+	//-----------------------------------------------------------
+
 	// Find the current root
 	err = f.dirCache.FindRoot(ctx, false)
 	if err != nil {
@@ -1777,6 +2395,9 @@ func (f *Fs) newBaseObject(ctx context.Context, remote string, info *drive.File)
 		bytes:        size,
 		parents:      info.Parents,
 	}
+	//-----------------------------------------------------------
+	f.noteRevision(&o, info)
+	//-----------------------------------------------------------
 	err = nil
 	if fs.GetConfig(ctx).Metadata {
 		err = o.parseMetadata(ctx, info)
@@ -1802,6 +2423,14 @@ func (f *Fs) getFileFields(ctx context.Context) (fields googleapi.Field) {
 	if fs.GetConfig(ctx).Metadata {
 		fields += "," + metadataFields
 	}
+	//-----------------------------------------------------------
+	if f.opt.SplitSize > 0 || f.revisions {
+		fields += ",appProperties"
+	}
+	if f.revisions {
+		fields += ",headRevisionId,version"
+	}
+	//-----------------------------------------------------------
 	return fields
 }
 
@@ -1829,6 +2458,11 @@ func (f *Fs) newRegularObject(ctx context.Context, remote string, info *drive.Fi
 	if info.ResourceKey != "" {
 		o.resourceKey = &info.ResourceKey
 	}
+	//-----------------------------------------------------------
+	if !f.splitObject(o, info) {
+		f.noteObject(o)
+	}
+	//-----------------------------------------------------------
 	return o, nil
 }
 
@@ -1957,6 +2591,12 @@ func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
 	if f.FileObj != nil {
 		return *f.FileObj, nil
 	}
+	switch f.statusPath(remote) {
+	case statusDir:
+		return nil, fs.ErrorIsDir
+	case statusFile:
+		return f.newStatusObject(remote), nil
+	}
 	//-----------------------------------------------------------
 	if strings.HasSuffix(remote, "/") {
 		return nil, fs.ErrorIsDir
@@ -2028,6 +2668,9 @@ func (f *Fs) createDir(ctx context.Context, pathID, leaf string, metadata fs.Met
 	if err != nil {
 		return nil, err
 	}
+	//-----------------------------------------------------------
+	f.itemCreated(ctx, pathID)
+	//-----------------------------------------------------------
 	if updateMetadata != nil {
 		err = updateMetadata(ctx, info)
 		if err != nil {
@@ -2250,7 +2893,13 @@ func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err e
 // callback returns an error then the listing will stop
 // immediately.
 func (f *Fs) ListP(ctx context.Context, dir string, callback fs.ListRCallback) error {
-	list := list.NewHelper(callback)
+	//-----------------------------------------------------------
+	if entries := f.statusEntries(dir); entries != nil {
+		return callback(entries)
+	}
+	list, stopList := f.newListHelper(callback)
+	defer stopList()
+	//-----------------------------------------------------------
 	entriesAdded := 0
 	directoryID, err := f.dirCache.FindDir(ctx, dir, false)
 	if err != nil {
@@ -2259,7 +2908,9 @@ func (f *Fs) ListP(ctx context.Context, dir string, callback fs.ListRCallback) e
 	directoryID = actualID(directoryID)
 
 	var iErr error
+	var listed int64
 	_, err = f.list(ctx, []string{directoryID}, "", false, false, f.opt.TrashedOnly, false, func(item *drive.File) bool {
+		listed++
 		entry, err := f.itemToDirEntry(ctx, path.Join(dir, item.Name), item)
 		if err != nil {
 			iErr = err
@@ -2289,6 +2940,9 @@ func (f *Fs) ListP(ctx context.Context, dir string, callback fs.ListRCallback) e
 			return err
 		}
 	}
+	//-----------------------------------------------------------
+	f.itemsListed(directoryID, dir, listed)
+	//-----------------------------------------------------------
 	return list.Flush()
 }
 
@@ -2471,6 +3125,11 @@ func (f *Fs) listRRunner(ctx context.Context, wg *sync.WaitGroup, in chan listRE
 // Don't implement this unless you have a more efficient way
 // of listing recursively that doing a directory traversal.
 func (f *Fs) ListR(ctx context.Context, dir string, callback fs.ListRCallback) (err error) {
+	//-----------------------------------------------------------
+	if entries := f.statusEntries(dir); entries != nil {
+		return callback(entries)
+	}
+	//-----------------------------------------------------------
 	directoryID, err := f.dirCache.FindDir(ctx, dir, false)
 	if err != nil {
 		return err
@@ -2481,7 +3140,10 @@ func (f *Fs) ListR(ctx context.Context, dir string, callback fs.ListRCallback) (
 	wg := sync.WaitGroup{}
 	in := make(chan listREntry, listRInputBuffer)
 	out := make(chan error, f.ci.Checkers)
-	list := list.NewHelper(callback)
+	//-----------------------------------------------------------
+	list, stopList := f.newListHelper(callback)
+	defer stopList()
+	//-----------------------------------------------------------
 	overflow := []listREntry{}
 	listed := 0
 
@@ -2688,6 +3350,10 @@ func (f *Fs) itemToDirEntry(ctx context.Context, remote string, item *drive.File
 		return d, nil
 	case f.opt.AuthOwnerOnly && !isAuthOwned(item):
 		// ignore object
+	//-----------------------------------------------------------
+	case f.opt.SplitSize > 0 && isSplitPart(item.Name):
+		// ignore the parts of a split file
+	//-----------------------------------------------------------
 	default:
 		entry, err = f.newObjectWithInfo(ctx, remote, item)
 		if err == fs.ErrorObjectNotFound {
@@ -2737,7 +3403,19 @@ func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options .
 		return existingObj, existingObj.Update(ctx, in, src, options...)
 	case fs.ErrorObjectNotFound:
 		// Not found so create it
-		return f.PutUnchecked(ctx, in, src, options...)
+		//-----------------------------------------------------------
+		of, err := f.overflowTarget(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if of != nil {
+			return f.putOverflow(ctx, of, in, src, options...)
+		}
+		o, err := f.putDedupe(ctx, src, func() (fs.Object, error) {
+			return f.PutUnchecked(ctx, in, src, options...)
+		})
+		return o, f.checkItemLimit(err)
+		//-----------------------------------------------------------
 	default:
 		return nil, err
 	}
@@ -2753,6 +3431,11 @@ func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, opt
 // This will create a duplicate if we upload a new file without
 // checking to see if there is one already - use Put() for that.
 func (f *Fs) PutUnchecked(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	//-----------------------------------------------------------
+	if f.splits(src.Size()) {
+		return f.putSplit(ctx, in, src)
+	}
+	//-----------------------------------------------------------
 	remote := src.Remote()
 	size := src.Size()
 	modTime := src.ModTime(ctx)
@@ -2791,10 +3474,17 @@ func (f *Fs) PutUnchecked(ctx context.Context, in io.Reader, src fs.ObjectInfo,
 		return nil, err
 	}
 
+	//-----------------------------------------------------------
+	if err = f.ServiceAccountFiles.CheckDailyTransfer(size); err != nil {
+		return nil, err
+	}
+	historySa, historyStart := f.opt.ServiceAccountFile, time.Now()
+	//-----------------------------------------------------------
 	var info *drive.File
 	if size >= 0 && size < int64(f.opt.UploadCutoff) {
 		// Make the API request to upload metadata and file data.
 		// Don't retry, return a retry error instead
+		file := f.opt.ServiceAccountFile
 		err = f.pacer.CallNoRetry(func() (bool, error) {
 			info, err = f.svc.Files.Create(createInfo).
 				Media(in, googleapi.ContentType(srcMimeType), googleapi.ChunkSize(0)).
@@ -2807,6 +3497,7 @@ func (f *Fs) PutUnchecked(ctx context.Context, in io.Reader, src fs.ObjectInfo,
 		if err != nil {
 			return nil, err
 		}
+		f.ServiceAccountFiles.RecordUpload(file, size)
 	} else {
 		// Upload the file in chunks
 		info, err = f.Upload(ctx, in, size, srcMimeType, "", remote, createInfo)
@@ -2814,6 +3505,11 @@ func (f *Fs) PutUnchecked(ctx context.Context, in io.Reader, src fs.ObjectInfo,
 			return nil, err
 		}
 	}
+	//-----------------------------------------------------------
+	f.itemCreated(ctx, createInfo.Parents[0])
+	f.recordHistory(remote, info, historySa, historyStart, false)
+	f.recordChecksum(ctx, remote, src, info)
+	//-----------------------------------------------------------
 	err = updateMetadata(ctx, info)
 	if err != nil {
 		return nil, err
@@ -2940,6 +3636,9 @@ func (f *Fs) DirSetModTime(ctx context.Context, dir string, modTime time.Time) e
 func (f *Fs) delete(ctx context.Context, id string, useTrash bool) error {
 	return f.pacer.Call(func() (bool, error) {
 		var err error
+		//-----------------------------------------------------------
+		file := f.opt.ServiceAccountFile
+		//-----------------------------------------------------------
 		if useTrash {
 			info := drive.File{
 				Trashed: true,
@@ -2955,6 +3654,12 @@ func (f *Fs) delete(ctx context.Context, id string, useTrash bool) error {
 				Context(ctx).Do()
 		}
 		//-----------------------------------------------------------
+		if err == nil {
+			f.ServiceAccountFiles.RecordDelete(file)
+			if file != "" {
+				fs.Debugf(f, "Deleted %s with service account %s", id, file)
+			}
+		}
 		defer func(f *Fs) {
 			if f.opt.RollingSA {
 				f.waitChangeSvc.Lock()
@@ -3044,6 +3749,12 @@ func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	isDoc := false
 	switch src := src.(type) {
 	case *Object:
+		//-----------------------------------------------------------
+		if src.split {
+			fs.Debugf(src, "Can't copy - split into parts")
+			return nil, fs.ErrorCantCopy
+		}
+		//-----------------------------------------------------------
 		srcObj = &src.baseObject
 	case *documentObject:
 		srcObj, ext = &src.baseObject, src.ext()
@@ -3055,9 +3766,25 @@ func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object,
 		return nil, fs.ErrorCantCopy
 	}
 
+	//-----------------------------------------------------------
+	of, err := f.overflowTarget(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if of != nil {
+		return f.copyOverflow(ctx, of, src, remote)
+	}
+	//-----------------------------------------------------------
+
 	// Look to see if there is an existing object before we remove
 	// the extension from the remote
 	existingObject, _ := f.NewObject(ctx, remote)
+	//-----------------------------------------------------------
+	if f.overwritesRevision(existingObject) {
+		fs.Debugf(src, "Can't copy - overwriting %v with a new revision", existingObject)
+		return nil, fs.ErrorCantCopy
+	}
+	//-----------------------------------------------------------
 
 	// Adjust the remote name to be without the extension if we
 	// are about to create a doc.
@@ -3104,6 +3831,12 @@ func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object,
 		id = actualID(srcObj.id)
 	}
 
+	//-----------------------------------------------------------
+	if err = f.ServiceAccountFiles.CheckDailyTransfer(src.Size()); err != nil {
+		return nil, err
+	}
+	file, start := f.opt.ServiceAccountFile, time.Now()
+	//-----------------------------------------------------------
 	var info *drive.File
 	err = f.pacer.Call(func() (bool, error) {
 		copy := f.svc.Files.Copy(id, createInfo).
@@ -3114,9 +3847,20 @@ func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object,
 		info, err = copy.Context(ctx).Do()
 		return f.shouldRetry(ctx, err)
 	})
+	//-----------------------------------------------------------
+	err = f.checkItemLimit(err)
+	//-----------------------------------------------------------
 	if err != nil {
 		return nil, err
 	}
+	//-----------------------------------------------------------
+	f.ServiceAccountFiles.RecordUpload(file, src.Size())
+	if existingObject == nil {
+		f.itemCreated(ctx, createInfo.Parents[0])
+	}
+	f.recordHistory(remote, info, file, start, true)
+	f.copyChecksum(remote, srcObj, info)
+	//-----------------------------------------------------------
 	newObject, err := f.newObjectWithInfo(ctx, remote, info)
 	if err != nil {
 		return nil, err
@@ -3291,10 +4035,19 @@ func (f *Fs) About(ctx context.Context) (*fs.Usage, error) {
 //
 // If it isn't possible then return fs.ErrorCantMove
 func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	//-----------------------------------------------------------
+	// remote loses the extension of documents below
+	dstRemote := remote
+	//-----------------------------------------------------------
 	var srcObj *baseObject
 	ext := ""
 	switch src := src.(type) {
 	case *Object:
+		//-----------------------------------------------------------
+		if src.split {
+			return f.moveSplit(ctx, src, remote)
+		}
+		//-----------------------------------------------------------
 		srcObj = &src.baseObject
 	case *documentObject:
 		srcObj, ext = &src.baseObject, src.ext()
@@ -3344,6 +4097,11 @@ func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object,
 			Context(ctx).Do()
 		return f.shouldRetry(ctx, err)
 	})
+	//-----------------------------------------------------------
+	if err != nil && len(f.opt.MoveFallback) > 0 && isMoveRestricted(err) {
+		return f.moveFallback(ctx, src, dstRemote, err)
+	}
+	//-----------------------------------------------------------
 	if err != nil {
 		return nil, err
 	}
@@ -3631,11 +4389,18 @@ func (f *Fs) changeChunkSize(chunkSizeString string) (err error) {
 	return err
 }
 
+// newPacer returns a pacer for the SA in use, recording on the rate
+// limit timeline if there is one.
+func (f *Fs) newPacer(ctx context.Context) *fs.Pacer {
+	calculator := pacer.NewGoogleDrive(pacer.MinSleep(f.opt.PacerMinSleep), pacer.Burst(f.opt.PacerBurst))
+	return fs.NewPacer(ctx, f.timeline.calculator(calculator, f.opt.ServiceAccountFile))
+}
+
 func (f *Fs) changeServiceAccountFile(ctx context.Context, file string) (err error) {
 	// Record the time of SA change for throttle guard
 	f.lastChangeSATime = time.Now()
 
-	fs.Debugf(nil, "Changing Service Account File from %s to %s", f.opt.ServiceAccountFile, file)
+	saDebugf(nil, "Changing Service Account File from %s to %s", f.opt.ServiceAccountFile, file)
 	if file == f.opt.ServiceAccountFile {
 		return nil
 	}
@@ -3656,14 +4421,16 @@ func (f *Fs) changeServiceAccountFile(ctx context.Context, file string) (err err
 	}()
 	f.opt.ServiceAccountFile = file
 	f.opt.ServiceAccountCredentials = ""
-	oAuthClient, err := createOAuthClient(ctx, &f.opt, f.name, f.m)
+	//-----------------------------------------------------------
+	oAuthClient, err := f.ServiceAccountFiles.oauthClient(ctx, &f.opt, file)
+	//-----------------------------------------------------------
 	if err != nil {
 		return fmt.Errorf("drive: failed when making oauth client: %w", err)
 	}
 
 	// Reset the pacer for the new SA — fresh backoff avoids inheriting
 	// the old SA's exponential sleep times
-	f.pacer = fs.NewPacer(ctx, pacer.NewGoogleDrive(pacer.MinSleep(f.opt.PacerMinSleep), pacer.Burst(f.opt.PacerBurst)))
+	f.pacer = f.newPacer(ctx)
 
 	f.client = oAuthClient
 	f.svc, err = drive.NewService(context.Background(), option.WithHTTPClient(f.client))
@@ -4113,6 +4880,19 @@ use via the API.
 Use the --interactive/-i or --dry-run flag to see what would be restored before
 restoring it.
 
+The filter flags restore only the items they select, with --min-age and
+--max-age applying to the time an item was trashed, and -o by only those
+trashed by the users given, or -o sa by the service accounts of the pool,
+for instance to undo a sync run with a bad filter:
+
+` + "```console" + `
+rclone backend untrash drive:backup --max-age 2h --include "/photos/**" -o sa
+` + "```" + `
+
+Drive only records when and by whom an item was trashed in shared drives,
+elsewhere the ages apply to its modification time and -o by selects
+nothing. A restored directory brings back what was trashed with it.
+
 Result:
 
 ` + "```json" + `
@@ -4121,6 +4901,10 @@ Result:
     "Errors": 0
 }
 ` + "```",
+	Opts: map[string]string{
+		"by": "Only restore items trashed by these comma separated users",
+		"sa": "Only restore items trashed by the service accounts of the pool",
+	},
 }, {
 	Name:  "copyid",
 	Short: "Copy files by ID.",
@@ -4260,6 +5044,276 @@ Third delete all orphaned files to the trash:
 ` + "```console" + `
 rclone backend rescue drive: -o delete
 ` + "```",
+}, {
+	Name:  "sasnapshot",
+	Short: "Dump the state of the service account pool.",
+	Long: `This command returns a JSON snapshot of the service account pool: each
+SA with its stale flag, whether it is available for selection, when it
+was blacklisted and how many times it hit a rate limit.
+
+Usage examples:
+
+` + "```console" + `
+eclone backend sasnapshot drive:
+eclone rc backend/command command=sasnapshot fs=drive:
+` + "```" + `
+
+The output can be saved and loaded back with the sarestore command.`,
+}, {
+	Name:  "sadead",
+	Short: "Show the service accounts which have been marked dead.",
+	Long: `This command returns the service accounts which failed to authenticate
+because their key was revoked or the account deleted or disabled, with the
+error each one gave. Dead service accounts are never used again - with
+service_account_state_file set this carries over to later runs.
+
+Usage example:
+
+` + "```console" + `
+eclone backend sadead drive:
+` + "```",
+}, {
+	Name:  "sametrics",
+	Short: "Show the service account pool metrics.",
+	Long: `This command returns the counters and gauges recorded by the service
+account pool: SA switches, rate limit hits, service creation times and
+the number of available and preloaded SAs.
+
+It needs service_account_metrics = stats (the default). The
+drive/sametrics rc call returns the same for every drive remote in use
+by a running eclone.
+
+Usage example:
+
+` + "```console" + `
+eclone backend sametrics drive:
+` + "```",
+}, {
+	Name:  "saembed",
+	Short: "Store the service account keys in the config file.",
+	Long: `This command reads the valid service account keys in the folder given,
+or service_account_file_path if none is given, and stores them obscured
+in the service_account_keys option of the remote's config section.
+
+The folder is no longer needed afterwards. Set a config encryption
+password with "eclone config encryption set" to have the keys encrypted
+at rest.
+
+Usage example:
+
+` + "```console" + `
+eclone backend saembed drive: /path/to/accounts
+` + "```",
+}, {
+	Name:  "sarestore",
+	Short: "Restore the state of the service account pool.",
+	Long: `This command loads a JSON snapshot previously produced by the sasnapshot
+command and replaces the state of the service account pool with it.
+
+Usage example:
+
+` + "```console" + `
+eclone backend sarestore drive: /path/to/snapshot.json
+` + "```",
+}, {
+	Name:  "create-teamdrives",
+	Short: "Create shared drives in bulk.",
+	Long: `This command creates N shared drives named PREFIX-01 to PREFIX-N and
+returns their names and IDs. Run it with a remote authorized as the user
+who should own the drives.
+
+Usage examples:
+
+` + "```console" + `
+eclone backend create-teamdrives drive: media 10
+eclone backend create-teamdrives drive: media 10 -o sa
+eclone backend create-teamdrives drive: media 10 -o group=sas@example.com
+` + "```" + `
+
+With -o sa every service account of the pool is added as a member, with
+-o group=EMAIL the group is. Members get the Content manager role
+(fileOrganizer) unless -o role=ROLE says otherwise. Members which can't
+be added are logged and skipped.`,
+	Opts: map[string]string{
+		"sa":    "Add the service accounts of the pool as members",
+		"group": "Add this group as a member",
+		"role":  "Role of the members (default fileOrganizer)",
+	},
+}, {
+	Name:  "members",
+	Short: "List the members of a shared drive.",
+	Long: `This command returns the members of the remote's shared drive, or of
+the one given with -o drive=ID, with their type, role and email.
+
+Usage example:
+
+` + "```console" + `
+eclone backend members drive:
+eclone backend members drive: -o drive=0ABCdefGHIjklMNOpqr
+` + "```",
+	Opts: map[string]string{
+		"drive": "ID of the shared drive (default the remote's)",
+	},
+}, {
+	Name:  "member-add",
+	Short: "Add members to a shared drive.",
+	Long: `This command adds the users given as arguments, the service accounts
+of the pool with -o sa and the group given with -o group=EMAIL to the
+remote's shared drive, or the one given with -o drive=ID.
+
+Members get the Content manager role (fileOrganizer) unless -o role=ROLE
+says otherwise. Members already there with another role have it changed.
+It returns how many members were added, updated, unchanged and failed.
+
+Usage examples:
+
+` + "```console" + `
+eclone backend member-add drive: -o sa
+eclone backend member-add drive: alice@example.com -o role=organizer
+` + "```",
+	Opts: map[string]string{
+		"drive": "ID of the shared drive (default the remote's)",
+		"sa":    "Add the service accounts of the pool",
+		"group": "Add this group",
+		"role":  "Role of the members (default fileOrganizer)",
+	},
+}, {
+	Name:  "member-remove",
+	Short: "Remove members from a shared drive.",
+	Long: `This command removes the users given as arguments, the service
+accounts of the pool with -o sa and the group given with -o group=EMAIL
+from the remote's shared drive, or the one given with -o drive=ID.
+
+Usage example:
+
+` + "```console" + `
+eclone backend member-remove drive: old-sa@project.iam.gserviceaccount.com
+` + "```",
+	Opts: map[string]string{
+		"drive": "ID of the shared drive (default the remote's)",
+		"sa":    "Remove the service accounts of the pool",
+		"group": "Remove this group",
+	},
+}, {
+	Name:  "owners",
+	Short: "Report the storage used by each owner.",
+	Long: `This command walks the remote, or the directory given, and returns the
+number of files and bytes owned by each owner email, largest first.
+quota_bytes is what counts against the owners' storage, including Google
+docs. Files on shared drives have no owner and are counted as "(none)".
+Shortcuts aren't followed.
+
+Usage examples:
+
+` + "```console" + `
+eclone backend owners drive:
+eclone backend owners drive: Projects
+` + "```",
+}, {
+	Name:  "transfer-owner",
+	Short: "Make a user the owner of the files in the remote.",
+	Long: `This command walks the remote, applying any filter flags, and makes the
+user given the owner of each file found. The files are done in batches,
+with up to --checkers calls in flight, rotating service accounts on rate
+limits.
+
+Only the current owner can transfer a file, so use a remote which acts as
+them, e.g. with --drive-impersonate. Files owned by anyone else are logged
+and counted as failed. Folders and shortcuts keep their owner. Shared
+drive files have no owner so can't be transferred.
+
+Usage examples:
+
+` + "```console" + `
+eclone backend transfer-owner drive:Projects new.owner@example.com --drive-impersonate leaver@example.com
+eclone backend transfer-owner drive: new.owner@example.com --include "*.pdf" -o batch=500
+` + "```" + `
+
+Consumer accounts can't be given files outright. With -o pending the user
+is made a pending owner instead and has to accept each file.`,
+	Opts: map[string]string{
+		"batch":   "Number of files to transfer between progress reports (default 100)",
+		"pending": "Make the user a pending owner, for consumer accounts",
+	},
+}, {
+	Name:  "orphans",
+	Short: "List files without a parent folder.",
+	Long: `This command searches for the files owned by the account in use which
+have no parent folder it can see, usually because the folder they were in
+was deleted by someone else. They still use up storage but can only be
+found by searching.
+
+With -o sa every service account of the pool is searched in turn, and with
+-o user=EMAIL the files of that user visible to the account in use. With
+-o rescue=DIR the orphans are moved into DIR on the remote, created if
+needed, and with -o trash they are trashed. Either is done by the account
+which found the files, so with -o sa the service accounts need to be able
+to write to DIR.
+
+Usage examples:
+
+` + "```console" + `
+eclone backend orphans drive:
+eclone backend orphans drive: -o sa -o rescue=orphans
+eclone backend orphans drive: -o user=leaver@example.com -o trash
+` + "```",
+	Opts: map[string]string{
+		"sa":     "Search every service account of the pool",
+		"user":   "Search the files owned by this user",
+		"rescue": "Move the orphans into this directory",
+		"trash":  "Trash the orphans",
+	},
+}, {
+	Name:  "sa-blacklist",
+	Short: "List or clear the blacklisted service accounts.",
+	Long: `This command lists the blacklisted service accounts of the pool, with
+when each was blacklisted and how long it still has to sit out, those
+expiring first first.
+
+With clear the service accounts given, by file, file name or email, are
+taken off the blacklist and returned to rotation, and with clear-all
+every blacklisted service account is. Use it when the quota an account
+hit has been raised, rather than deleting the state or waiting. The
+accounts are also cleared in service_account_state_file and
+service_account_shared_state if set.
+
+Usage examples:
+
+` + "```console" + `
+eclone backend sa-blacklist drive:
+eclone backend sa-blacklist drive: clear sa-045.json sa-046@project.iam.gserviceaccount.com
+eclone backend sa-blacklist drive: clear-all
+` + "```",
+}, {
+	Name:  "revisions",
+	Short: "List the revisions of files, or restore or download old ones.",
+	Long: `This command lists the revisions of the file given, or of every file
+under the directory given, applying any filter flags, oldest first with
+their ID, time, size, MD5 and who made them.
+
+To undo a mass overwrite, -o before=TIME picks for each file the newest
+revision modified before TIME, an RFC 3339 time or a duration ago, and
+-o restore uploads it as a new head revision, checking its MD5, while
+-o download=DIR saves it under the local directory DIR instead. Files
+not changed since TIME are left alone. For a single file the revision
+can be given with -o revision=ID instead. The files are done --checkers
+at a time, each with the next preloaded service account, and files
+which fail are reported with their error. Google docs are skipped.
+
+Usage examples:
+
+` + "```console" + `
+eclone backend revisions drive: Reports/q3.xlsx
+eclone backend revisions drive: Reports/q3.xlsx -o revision=0B1abc -o restore
+eclone backend revisions drive: Projects -o before=2026-10-14T08:00:00Z -o restore
+eclone backend revisions drive: Projects -o before=48h -o download=/srv/recovered
+` + "```",
+	Opts: map[string]string{
+		"before":   "Pick the newest revision modified before this time, or this long ago",
+		"revision": "Pick the revision with this ID, for a single file",
+		"restore":  "Upload the revision picked as the new head revision",
+		"download": "Save the revision picked under this local directory",
+	},
 }}
 
 // Command the backend to run a named command
@@ -4355,11 +5409,9 @@ func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[str
 		}
 		return drives, nil
 	case "untrash":
-		dir := ""
-		if len(arg) > 0 {
-			dir = arg[0]
-		}
-		return f.unTrashDir(ctx, dir, true)
+		//-----------------------------------------------------------
+		return f.unTrashCommand(ctx, arg, opt)
+		//-----------------------------------------------------------
 	case "copyid", "moveid":
 		if len(arg)%2 != 0 {
 			return nil, errors.New("need an even number of arguments")
@@ -4403,11 +5455,85 @@ func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[str
 			return nil, errors.New("syntax error: need 0 or 1 args or -o delete")
 		}
 		return nil, f.rescue(ctx, dirID, delete)
+	case "sasnapshot":
+		return f.ServiceAccountFiles.Snapshot(), nil
+	case "sadead":
+		return f.ServiceAccountFiles.Dead(), nil
+	case "sametrics":
+		if m, ok := f.ServiceAccountFiles.Metrics.(*MemoryMetrics); ok {
+			return m.Values(), nil
+		}
+		return nil, errors.New("service account metrics are only kept with service_account_metrics = stats")
+	case "saembed":
+		saFolder := f.opt.ServiceAccountFilePath
+		if len(arg) > 0 {
+			saFolder = arg[0]
+		}
+		n, err := embedServiceAccounts(f.name, env.ShellExpand(saFolder))
+		if err != nil {
+			return nil, err
+		}
+		return fmt.Sprintf("Stored %d service account key(s) in the config of %q", n, f.name), nil
+	case "create-teamdrives":
+		return f.createTeamDrivesCommand(ctx, arg, opt)
+	case "members", "member-add", "member-remove":
+		return f.memberCommand(ctx, name, arg, opt)
+	case "owners":
+		dir := ""
+		if len(arg) > 0 {
+			dir = arg[0]
+		}
+		return f.ownerReport(ctx, dir)
+	case "transfer-owner":
+		return f.transferOwnerCommand(ctx, arg, opt)
+	case "orphans":
+		return f.orphansCommand(ctx, opt)
+	case "sarestore":
+		if len(arg) != 1 {
+			return nil, errors.New("need exactly 1 argument")
+		}
+		buf, err := os.ReadFile(arg[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		var snap PoolSnapshot
+		if err = json.Unmarshal(buf, &snap); err != nil {
+			return nil, fmt.Errorf("failed to decode snapshot: %w", err)
+		}
+		if err = f.ServiceAccountFiles.Restore(&snap); err != nil {
+			return nil, err
+		}
+		return f.ServiceAccountFiles.Snapshot(), nil
+	case "sa-blacklist":
+		return f.saBlacklistCommand(arg)
+	case "revisions":
+		return f.revisionsCommand(ctx, arg, opt)
 	default:
 		return nil, fs.ErrorCommandNotFound
 	}
 }
 
+// Shutdown the backend, closing the service account pool and any idle
+// connections.
+func (f *Fs) Shutdown(ctx context.Context) error {
+	if m, ok := f.ServiceAccountFiles.Metrics.(*MemoryMetrics); ok {
+		fs.Debugf(f, "Service account metrics: %v", m)
+	}
+	logGzipSavings(f)
+	closeIdleConnections(f.client)
+	if err := f.timeline.write(); err != nil {
+		fs.Errorf(f, "%v", err)
+	}
+	if err := f.history.flush(); err != nil {
+		fs.Errorf(f, "%v", err)
+	}
+	if err := f.checksums.flush(); err != nil {
+		fs.Errorf(f, "%v", err)
+	}
+	f.logErrorReasons()
+	return f.ServiceAccountFiles.Close()
+}
+
 // ------------------------------------------------------------
 
 // Fs returns the parent Fs
@@ -4551,6 +5677,11 @@ func (o *baseObject) addResourceKey(header http.Header) {
 // httpResponse gets an http.Response object for the object
 // using the url and method passed in
 func (o *baseObject) httpResponse(ctx context.Context, url, method string, options []fs.OpenOption) (req *http.Request, res *http.Response, err error) {
+	return o.httpResponseWith(ctx, o.fs.client, url, method, options)
+}
+
+// httpResponseWith is httpResponse using client for the request
+func (o *baseObject) httpResponseWith(ctx context.Context, client *http.Client, url, method string, options []fs.OpenOption) (req *http.Request, res *http.Response, err error) {
 	if url == "" {
 		return nil, nil, errors.New("forbidden to download - check sharing permission")
 	}
@@ -4565,7 +5696,7 @@ func (o *baseObject) httpResponse(ctx context.Context, url, method string, optio
 	}
 	o.addResourceKey(req.Header)
 	err = o.fs.pacer.Call(func() (bool, error) {
-		res, err = o.fs.client.Do(req)
+		res, err = client.Do(req)
 		if err == nil {
 			err = googleapi.CheckResponse(res)
 			if err != nil {
@@ -4618,7 +5749,11 @@ var _ io.ReadCloser = (*openDocumentFile)(nil)
 
 // Checks to see if err is a googleapi.Error with of type what
 func isGoogleError(err error, what string) bool {
-	if gerr, ok := err.(*googleapi.Error); ok {
+	//-----------------------------------------------------------
+	// errors.As to see through explainError
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		//-----------------------------------------------------------
 		for _, error := range gerr.Errors {
 			if error.Reason == what {
 				return true
@@ -4630,6 +5765,18 @@ func isGoogleError(err error, what string) bool {
 
 // open a url for reading
 func (o *baseObject) open(ctx context.Context, url string, options ...fs.OpenOption) (in io.ReadCloser, err error) {
+	//-----------------------------------------------------------
+	if o.fs.opt.ServiceAccountSpreadReads && o.fs.ServiceAccountFiles != nil {
+		if client, release, clientErr := o.fs.ServiceAccountFiles.ReadClient(); clientErr == nil {
+			_, res, err := o.httpResponseWith(ctx, client, url, "GET", options)
+			if err == nil {
+				return &releaseOnClose{ReadCloser: res.Body, release: release}, nil
+			}
+			release()
+			fs.Debugf(o, "Read with a preloaded service account failed, using the current one: %v", err)
+		}
+	}
+	//-----------------------------------------------------------
 	_, res, err := o.httpResponse(ctx, url, "GET", options)
 	if err != nil {
 		if isGoogleError(err, "cannotDownloadAbusiveFile") {
@@ -4646,6 +5793,13 @@ func (o *baseObject) open(ctx context.Context, url string, options ...fs.OpenOpt
 				err = fmt.Errorf("use the --drive-acknowledge-abuse flag to download this file: %w", err)
 			}
 		}
+		//-----------------------------------------------------------
+		if isGoogleError(err, "downloadQuotaExceeded") {
+			if body, rotateErr := o.openWithPreloaded(ctx, url, options); rotateErr == nil {
+				return body, nil
+			}
+		}
+		//-----------------------------------------------------------
 		if err != nil {
 			return nil, fmt.Errorf("open file failed: %w", err)
 		}
@@ -4653,11 +5807,50 @@ func (o *baseObject) open(ctx context.Context, url string, options ...fs.OpenOpt
 	return res.Body, nil
 }
 
+//-----------------------------------------------------------
+
+// openWithPreloaded retries a read which hit the download quota with each
+// preloaded SA client in turn, returning the body of the first to succeed.
+//
+// This leaves the SA the Fs is using alone, so a mount serving many files
+// keeps going when a few of them hit their quota.
+func (o *baseObject) openWithPreloaded(ctx context.Context, url string, options []fs.OpenOption) (in io.ReadCloser, err error) {
+	pool := o.fs.ServiceAccountFiles
+	err = ErrNoPreloaded
+	for range pool.Preloaded() {
+		client, clientErr := pool.GetClient()
+		if clientErr != nil {
+			break
+		}
+		if client == nil || client == o.fs.client {
+			continue
+		}
+		var res *http.Response
+		_, res, err = o.httpResponseWith(ctx, client, url, "GET", options)
+		if err == nil {
+			pool.Metrics.Inc(metricReadRotations)
+			fs.Debugf(o, "Download quota exceeded - read with another service account")
+			return res.Body, nil
+		}
+		if !isGoogleError(err, "downloadQuotaExceeded") {
+			break
+		}
+	}
+	return nil, err
+}
+
+//-----------------------------------------------------------
+
 // Open an object for read
 func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (in io.ReadCloser, err error) {
 	if o.mimeType == shortcutMimeTypeDangling {
 		return nil, errors.New("can't read dangling shortcut")
 	}
+	//-----------------------------------------------------------
+	if o.split {
+		return o.openSplit(ctx, options...)
+	}
+	//-----------------------------------------------------------
 	if o.v2Download {
 		var v2File *drive_v2.File
 		err = o.fs.pacer.Call(func() (bool, error) {
@@ -4740,8 +5933,21 @@ func (o *baseObject) update(ctx context.Context, updateInfo *drive.File, uploadM
 ) (info *drive.File, err error) {
 	// Make the API request to upload metadata and file data.
 	size := src.Size()
+	//-----------------------------------------------------------
+	if err = o.fs.ServiceAccountFiles.CheckDailyTransfer(size); err != nil {
+		return nil, err
+	}
+	historySa, historyStart := o.fs.opt.ServiceAccountFile, time.Now()
+	defer func() {
+		if err == nil {
+			o.fs.recordHistory(o.remote, info, historySa, historyStart, false)
+			o.fs.recordChecksum(ctx, o.remote, src, info)
+		}
+	}()
+	//-----------------------------------------------------------
 	if size >= 0 && size < int64(o.fs.opt.UploadCutoff) {
 		// Don't retry, return a retry error instead
+		file := o.fs.opt.ServiceAccountFile
 		err = o.fs.pacer.CallNoRetry(func() (bool, error) {
 			info, err = o.fs.svc.Files.Update(actualID(o.id), updateInfo).
 				Media(in, googleapi.ContentType(uploadMimeType), googleapi.ChunkSize(0)).
@@ -4751,6 +5957,9 @@ func (o *baseObject) update(ctx context.Context, updateInfo *drive.File, uploadM
 				Context(ctx).Do()
 			return o.fs.shouldRetry(ctx, err)
 		})
+		if err == nil {
+			o.fs.ServiceAccountFiles.RecordUpload(file, size)
+		}
 		return
 	}
 	// Upload the file in chunks
@@ -4763,6 +5972,11 @@ func (o *baseObject) update(ctx context.Context, updateInfo *drive.File, uploadM
 //
 // The new object may have been created if an error is returned
 func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	//-----------------------------------------------------------
+	if o.split || o.fs.splits(src.Size()) {
+		return o.updateSplit(ctx, in, src, options...)
+	}
+	//-----------------------------------------------------------
 	// If o is a shortcut
 	if isShortcutID(o.id) {
 		// Delete it first
@@ -4812,6 +6026,9 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 	default:
 		return errors.New("object type changed by update")
 	}
+	//-----------------------------------------------------------
+	o.fs.pruneRevisions(ctx, o)
+	//-----------------------------------------------------------
 
 	return nil
 }
@@ -5000,6 +6217,7 @@ var (
 	_ fs.DirSetModTimer  = (*Fs)(nil)
 	_ fs.MkdirMetadataer = (*Fs)(nil)
 	_ fs.Abouter         = (*Fs)(nil)
+	_ fs.Shutdowner      = (*Fs)(nil)
 	_ fs.Object          = (*Object)(nil)
 	_ fs.MimeTyper       = (*Object)(nil)
 	_ fs.IDer            = (*Object)(nil)
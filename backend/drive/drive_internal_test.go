@@ -8,10 +8,13 @@ import (
 	"fmt"
 	"io"
 	"mime"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	gosync "sync"
 	"testing"
 	"time"
 
@@ -24,11 +27,13 @@ import (
 	"github.com/rclone/rclone/fs/sync"
 	"github.com/rclone/rclone/fstest"
 	"github.com/rclone/rclone/fstest/fstests"
+	"github.com/rclone/rclone/lib/pacer"
 	"github.com/rclone/rclone/lib/random"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
 )
 
 func TestDriveScopes(t *testing.T) {
@@ -215,7 +220,7 @@ func (f *Fs) InternalTestShouldRetry(t *testing.T) {
 		f.opt.StopOnUploadLimit = oldStopUpload
 		f.opt.StopOnDownloadLimit = oldStopDownload
 	}()
-	expectedRLError := fserrors.FatalError(&generic403)
+	expectedRLError := explainError(fserrors.FatalError(&generic403))
 	rateLimitRetry, rateLimitErr := f.shouldRetry(ctx, &generic403)
 	assert.False(t, rateLimitRetry)
 	assert.Equal(t, rateLimitErr, expectedRLError)
@@ -223,7 +228,7 @@ func (f *Fs) InternalTestShouldRetry(t *testing.T) {
 		Reason: "downloadQuotaExceeded",
 	}
 	generic403.Errors[0] = dQEItem
-	expectedDQError := fserrors.FatalError(&generic403)
+	expectedDQError := explainError(fserrors.FatalError(&generic403))
 	downloadQuotaRetry, downloadQuotaError := f.shouldRetry(ctx, &generic403)
 	assert.False(t, downloadQuotaRetry)
 	assert.Equal(t, downloadQuotaError, expectedDQError)
@@ -231,7 +236,7 @@ func (f *Fs) InternalTestShouldRetry(t *testing.T) {
 		Reason: "teamDriveFileLimitExceeded",
 	}
 	generic403.Errors[0] = tDFLEItem
-	expectedTDFLError := fserrors.FatalError(&generic403)
+	expectedTDFLError := explainError(fserrors.FatalError(&generic403))
 	teamDriveFileLimitRetry, teamDriveFileLimitError := f.shouldRetry(ctx, &generic403)
 	assert.False(t, teamDriveFileLimitRetry)
 	assert.Equal(t, teamDriveFileLimitError, expectedTDFLError)
@@ -239,7 +244,7 @@ func (f *Fs) InternalTestShouldRetry(t *testing.T) {
 		Reason: "quotaExceeded",
 	}
 	generic403.Errors[0] = qEItem
-	expectedQuotaError := fserrors.FatalError(&generic403)
+	expectedQuotaError := explainError(fserrors.FatalError(&generic403))
 	quotaExceededRetry, quotaExceededError := f.shouldRetry(ctx, &generic403)
 	assert.False(t, quotaExceededRetry)
 	assert.Equal(t, quotaExceededError, expectedQuotaError)
@@ -248,7 +253,7 @@ func (f *Fs) InternalTestShouldRetry(t *testing.T) {
 		Reason: "storageQuotaExceeded",
 	}
 	generic403.Errors[0] = sqEItem
-	expectedStorageQuotaError := fserrors.FatalError(&generic403)
+	expectedStorageQuotaError := explainError(fserrors.FatalError(&generic403))
 	storageQuotaExceededRetry, storageQuotaExceededError := f.shouldRetry(ctx, &generic403)
 	assert.False(t, storageQuotaExceededRetry)
 	assert.Equal(t, storageQuotaExceededError, expectedStorageQuotaError)
@@ -666,3 +671,231 @@ func (f *Fs) InternalTest(t *testing.T) {
 }
 
 var _ fstests.InternalTester = (*Fs)(nil)
+
+// apiError makes the error googleapi returns for a response with body
+func apiError(code int, body string) *googleapi.Error {
+	err := googleapi.CheckResponse(&http.Response{StatusCode: code, Body: io.NopCloser(strings.NewReader(body))})
+	return err.(*googleapi.Error)
+}
+
+// Error bodies as returned by the Drive API
+const (
+	bodyUserRateLimit = `{"error":{"errors":[{"domain":"usageLimits","reason":"userRateLimitExceeded","message":"User Rate Limit Exceeded. Rate of requests for user exceed configured project quota. You may consider re-evaluating expected per-user traffic to the API and adjust project quota limits accordingly. You may monitor aggregate quota usage and adjust limits in the API Console: https://console.developers.google.com/apis/api/drive.googleapis.com/quotas?project=123456789"}],"code":403,"message":"User Rate Limit Exceeded. Rate of requests for user exceed configured project quota. You may consider re-evaluating expected per-user traffic to the API and adjust project quota limits accordingly. You may monitor aggregate quota usage and adjust limits in the API Console: https://console.developers.google.com/apis/api/drive.googleapis.com/quotas?project=123456789"}}`
+	bodyRateLimit     = `{"error":{"errors":[{"domain":"usageLimits","reason":"rateLimitExceeded","message":"Rate Limit Exceeded"}],"code":403,"message":"Rate Limit Exceeded"}}`
+	bodyFileRateLimit = `{"error":{"errors":[{"domain":"global","reason":"rateLimitExceeded","message":"Rate Limit Exceeded"}],"code":403,"message":"Rate Limit Exceeded"}}`
+	bodyDownloadQuota = `{"error":{"errors":[{"domain":"global","reason":"downloadQuotaExceeded","message":"The download quota for this file has been exceeded."}],"code":403,"message":"The download quota for this file has been exceeded."}}`
+	bodyDailyLimit    = `{"error":{"errors":[{"domain":"usageLimits","reason":"dailyLimitExceededUnreg","message":"Daily Limit for Unauthenticated Use Exceeded. Continued use requires signup.","extendedHelp":"https://code.google.com/apis/console"}],"code":403,"message":"Daily Limit for Unauthenticated Use Exceeded. Continued use requires signup."}}`
+	bodyNotFound      = `{"error":{"errors":[{"domain":"global","reason":"notFound","message":"File not found: 1a2b3c.","locationType":"parameter","location":"fileId"}],"code":404,"message":"File not found: 1a2b3c."}}`
+)
+
+func TestIsFileRateLimit(t *testing.T) {
+	assert.True(t, isFileRateLimit(apiError(403, bodyFileRateLimit)))
+	assert.False(t, isFileRateLimit(apiError(403, bodyUserRateLimit)))
+	assert.False(t, isFileRateLimit(apiError(403, bodyRateLimit)))
+	assert.False(t, isFileRateLimit(apiError(403, bodyDailyLimit)))
+	// Without a body there is no telling, so it counts against the SA
+	assert.False(t, isFileRateLimit(&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}))
+}
+
+func TestShouldRetryFileRateLimitKeepsSA(t *testing.T) {
+	metrics := NewMemoryMetrics()
+	pool := NewServiceAccountPool(context.Background(), 10)
+	pool.Metrics = metrics
+	f := &Fs{
+		opt:                 Options{ServiceAccountFilePath: "/sa/", ServiceAccountFile: "/sa/1.json"},
+		ServiceAccountFiles: pool,
+	}
+	hot := apiError(403, bodyFileRateLimit)
+	retry, err := f.shouldRetry(context.Background(), hot)
+	assert.True(t, retry)
+	assert.Equal(t, hot, err)
+	assert.Equal(t, "/sa/1.json", f.opt.ServiceAccountFile)
+
+	quota := apiError(403, bodyDownloadQuota)
+	retry, _ = f.shouldRetry(context.Background(), quota)
+	assert.False(t, retry)
+	assert.Equal(t, int64(2), metrics.Counter(metricFileRateLimits))
+	assert.Equal(t, int64(0), metrics.Counter(metricSwitches))
+}
+
+func TestIsQuotaError(t *testing.T) {
+	quota := func(reason, message string) error {
+		return fmt.Errorf("copy failed: %w", &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: reason, Message: message}}})
+	}
+	assert.True(t, IsQuotaError(quota("userRateLimitExceeded", "User rate limit exceeded.")))
+	assert.True(t, IsQuotaError(quota("", "Daily Limit Exceeded")))
+	assert.True(t, IsQuotaError(fmt.Errorf("no SA: %w", ErrAllBlacklisted)))
+	assert.False(t, IsQuotaError(quota("downloadQuotaExceeded", "")))
+	assert.False(t, IsQuotaError(quota("notFound", "File not found")))
+	assert.False(t, IsQuotaError(errors.New("boom")))
+
+	for body, want := range map[string]bool{
+		bodyUserRateLimit: true,
+		bodyRateLimit:     true,
+		bodyDailyLimit:    true,
+		bodyFileRateLimit: false,
+		bodyDownloadQuota: false,
+		bodyNotFound:      false,
+	} {
+		assert.Equal(t, want, IsQuotaError(fmt.Errorf("copy failed: %w", apiError(403, body))), body)
+	}
+}
+
+// clientNamed makes a client which tells the server which SA it is
+func clientNamed(name string) *http.Client {
+	return &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		req.Header.Set("X-Test-SA", name)
+		return http.DefaultTransport.RoundTrip(req)
+	})}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return fn(req) }
+
+func TestOpenRotatesOnDownloadQuota(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Test-SA") != "spare" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = io.WriteString(w, `{"error":{"code":403,"errors":[{"reason":"downloadQuotaExceeded","message":"The download quota for this file has been exceeded."}]}}`)
+			return
+		}
+		_, _ = io.WriteString(w, "hello")
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	metrics := NewMemoryMetrics()
+	pool := NewServiceAccountPool(ctx, 10)
+	pool.Metrics = metrics
+	f := &Fs{
+		client:              clientNamed("active"),
+		pacer:               fs.NewPacer(ctx, pacer.NewGoogleDrive(pacer.MinSleep(time.Millisecond))),
+		ServiceAccountFiles: pool,
+	}
+	o := &baseObject{fs: f, remote: "file", bytes: 5}
+
+	// Without preloaded SAs the quota error comes back
+	_, err := o.open(ctx, srv.URL)
+	assert.True(t, isGoogleError(errors.Unwrap(err), "downloadQuotaExceeded"), "%v", err)
+
+	// With them the read goes through another SA, the Fs keeping its own
+	pool.AddService(clientNamed("spare"), nil)
+	pool.AddService(f.client, nil)
+	pool.AddService(clientNamed("spent"), nil)
+	in, err := o.open(ctx, srv.URL)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, "hello", string(data))
+	assert.Equal(t, int64(1), metrics.Counter(metricReadRotations))
+}
+
+func TestUploadHandOffOnServiceAccountChange(t *testing.T) {
+	for _, handOffOK := range []bool{true, false} {
+		t.Run(fmt.Sprintf("handOffOK=%v", handOffOK), func(t *testing.T) {
+			var (
+				mu       gosync.Mutex
+				received int64
+				oneSent  int
+				chunks   []string
+			)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				sa := r.Header.Get("X-Test-SA")
+				var start, end, total int64
+				if _, err := fmt.Sscanf(r.Header.Get("Content-Range"), "bytes */%d", &total); err == nil {
+					// Status query
+					if !handOffOK {
+						w.WriteHeader(http.StatusForbidden)
+						return
+					}
+					w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", received-1))
+					w.WriteHeader(statusResumeIncomplete)
+					return
+				}
+				_, err := fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total)
+				require.NoError(t, err)
+				if sa == "one" {
+					oneSent++
+					// The SA which started the session fails once it has been replaced
+					if oneSent == 2 {
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+				}
+				chunks = append(chunks, sa)
+				received = end + 1
+				if received < total {
+					w.WriteHeader(statusResumeIncomplete)
+					return
+				}
+				_, _ = io.WriteString(w, `{"id":"done"}`)
+			}))
+			defer srv.Close()
+
+			ctx := context.Background()
+			f := &Fs{
+				client:              clientNamed("two"),
+				pacer:               fs.NewPacer(ctx, pacer.NewGoogleDrive(pacer.MinSleep(time.Millisecond))),
+				ServiceAccountFiles: NewServiceAccountPool(ctx, 10),
+			}
+			f.opt.ChunkSize = 4
+			f.opt.ServiceAccountFile = "two.json"
+			// The session was started before the Fs switched to "two"
+			rx := &resumableUpload{
+				f:             f,
+				remote:        "file",
+				URI:           srv.URL,
+				Media:         strings.NewReader("abcdefgh"),
+				ContentLength: 8,
+				client:        clientNamed("one"),
+				file:          "one.json",
+			}
+			info, err := rx.Upload(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, "done", info.Id)
+			if handOffOK {
+				assert.Equal(t, []string{"one", "two"}, chunks)
+				assert.Equal(t, map[string]int64{"one.json": 4, "two.json": 4}, f.ServiceAccountFiles.uploaded)
+			} else {
+				assert.Equal(t, []string{"one", "one"}, chunks)
+				assert.Equal(t, map[string]int64{"one.json": 8}, f.ServiceAccountFiles.uploaded)
+			}
+		})
+	}
+}
+
+func TestUploadReceived(t *testing.T) {
+	assert.Equal(t, int64(0), uploadReceived(""))
+	assert.Equal(t, int64(1024), uploadReceived("bytes=0-1023"))
+	assert.Equal(t, int64(0), uploadReceived("bytes=5-1023"))
+}
+
+func TestDeleteRecordsServiceAccount(t *testing.T) {
+	var deleted []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			deleted = append(deleted, path.Base(r.URL.Path))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	svc, err := drive.NewService(ctx, option.WithHTTPClient(srv.Client()), option.WithEndpoint(srv.URL+"/"))
+	require.NoError(t, err)
+	f := &Fs{
+		svc:                 svc,
+		pacer:               fs.NewPacer(ctx, pacer.NewGoogleDrive(pacer.MinSleep(time.Millisecond))),
+		ServiceAccountFiles: NewServiceAccountPool(ctx, 10),
+	}
+	f.opt.ServiceAccountFile = "sa1.json"
+
+	require.NoError(t, f.delete(ctx, "id1", false))
+	require.NoError(t, f.delete(ctx, "id2", false))
+	assert.Equal(t, []string{"id1", "id2"}, deleted)
+	assert.Equal(t, map[string]int64{"sa1.json": 2}, f.ServiceAccountFiles.deleted)
+}
@@ -0,0 +1,76 @@
+// Error explanations
+//
+// The errors Drive returns say what went wrong in its own terms, e.g.
+// "googleapi: Error 403: The user's Drive storage quota has been
+// exceeded., storageQuotaExceeded", which leaves working out what to do
+// about it to the user. The errors rclone gives up on with a reason
+// which has a known fix are returned with that fix in front:
+//
+//	storageQuotaExceeded: the destination My Drive is full - use a shared drive or a different owner: googleapi: Error 403: ...
+//
+// The Drive error is wrapped, not replaced, so code looking for its
+// reason still finds it.
+package drive
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/api/googleapi"
+)
+
+// errorHints are what to do about the Drive errors by reason
+var errorHints = map[string]string{
+	"storageQuotaExceeded":              "the destination My Drive is full - use a shared drive or a different owner",
+	"quotaExceeded":                     "the account has used up its daily 750 GiB upload quota - add more service accounts or wait a day",
+	"teamDriveFileLimitExceeded":        "the shared drive holds 400,000 items, as many as it can - use another shared drive or set overflow_drive",
+	"numChildrenInNonRootLimitExceeded": "the folder holds 500,000 items, as many as it can - split it into subfolders",
+	"downloadQuotaExceeded":             "the file has been downloaded too often - wait 24 hours or copy it server side first",
+	"cannotDownloadAbusiveFile":         "Drive flagged the file as malware or spam - use --drive-acknowledge-abuse to download it anyway",
+	"cannotCopyFile":                    "the owner has turned off copying of the file - ask them to allow it or download it instead",
+	"fileNotDownloadable":               "the file is a Google doc - set --drive-export-formats to download it",
+	"insufficientFilePermissions":       "the account can't change the file - give it the Content manager role or use the owner",
+	"teamDriveMembershipRequired":       "the account isn't a member of the shared drive - add it, or a group holding it, to the drive",
+	"notFound":                          "the file or folder doesn't exist or isn't shared with the account - check the ID and the sharing",
+	"dailyLimitExceeded":                "the project has used up its daily API quota - use service accounts from another project or wait a day",
+	"userRateLimitExceeded":             "the account is still rate limited after the retries - lower --tpslimit or add more service accounts",
+	"rateLimitExceeded":                 "the account is still rate limited after the retries - lower --tpslimit or add more service accounts",
+	"sharingRateLimitExceeded":          "the account has shared too many files - wait a day before sharing more",
+	"authError":                         "the credentials were refused - reconnect the remote or check the service account key",
+}
+
+// explainedError is a Drive error with what to do about it.
+type explainedError struct {
+	reason string
+	hint   string
+	err    error
+}
+
+// Error returns the reason and hint in front of the Drive error.
+func (e *explainedError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", e.reason, e.hint, e.err)
+}
+
+// Unwrap returns the Drive error.
+func (e *explainedError) Unwrap() error {
+	return e.err
+}
+
+// explainError returns err with what to do about it if it is a Drive
+// error with a reason in errorHints, or err as it is.
+func explainError(err error) error {
+	var explained *explainedError
+	if err == nil || errors.As(err, &explained) {
+		return err
+	}
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) || len(gerr.Errors) == 0 {
+		return err
+	}
+	reason := gerr.Errors[0].Reason
+	hint, ok := errorHints[reason]
+	if !ok {
+		return err
+	}
+	return &explainedError{reason: reason, hint: hint, err: err}
+}
@@ -0,0 +1,50 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+func TestExplainError(t *testing.T) {
+	full := &googleapi.Error{Code: 403, Message: "The user's Drive storage quota has been exceeded.", Errors: []googleapi.ErrorItem{{Reason: "storageQuotaExceeded"}}}
+	err := explainError(fmt.Errorf("upload failed: %w", full))
+	assert.ErrorContains(t, err, "storageQuotaExceeded: the destination My Drive is full - use a shared drive or a different owner: upload failed: googleapi: Error 403: The user's Drive storage quota has been exceeded.")
+	var gerr *googleapi.Error
+	assert.True(t, errors.As(err, &gerr))
+	assert.Equal(t, full, gerr)
+	assert.True(t, isGoogleError(err, "storageQuotaExceeded"))
+	assert.Equal(t, err, explainError(err), "explained twice")
+
+	fatal := fserrors.FatalError(full)
+	assert.True(t, fserrors.IsFatalError(explainError(fatal)))
+
+	assert.NoError(t, explainError(nil))
+	plain := errors.New("EOF")
+	assert.Equal(t, plain, explainError(plain))
+	unknown := &googleapi.Error{Code: 400, Errors: []googleapi.ErrorItem{{Reason: "badRequest"}}}
+	assert.Equal(t, unknown, explainError(unknown))
+	noReason := &googleapi.Error{Code: 502}
+	assert.Equal(t, noReason, explainError(noReason))
+}
+
+func TestShouldRetryExplains(t *testing.T) {
+	ctx := context.Background()
+	f := &Fs{}
+	notFound := &googleapi.Error{Code: 404, Errors: []googleapi.ErrorItem{{Reason: "notFound"}}}
+	retry, err := f.shouldRetry(ctx, notFound)
+	assert.False(t, retry)
+	assert.ErrorContains(t, err, "notFound: the file or folder doesn't exist")
+	assert.ErrorIs(t, err, notFound)
+
+	// Retried errors are left alone
+	rateLimit := &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}}}
+	retry, err = f.shouldRetry(ctx, rateLimit)
+	assert.True(t, retry)
+	assert.Equal(t, rateLimit, err)
+}
@@ -0,0 +1,150 @@
+// Errors by reason
+//
+// A run going wrong logs the same Drive error over and over, once per
+// file and retry, so working out what went wrong meant counting log
+// lines. Every error Drive returns is counted by its reason, with the SAs
+// it came back for, and when the Fs shuts down at the end of the run the
+// counts are logged, most frequent first:
+//
+//	Drive errors by reason:
+//	  userRateLimitExceeded: 532 with 12 SAs (sa-001@p.iam.gserviceaccount.com: 61, ...)
+//	  notFound: 3 with 1 SA (sa-002@p.iam.gserviceaccount.com: 3)
+package drive
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"google.golang.org/api/googleapi"
+)
+
+// errorReasonsShown is how many SAs are listed for each reason
+const errorReasonsShown = 5
+
+// reasonCount counts the errors with one reason.
+type reasonCount struct {
+	n   int64
+	sas map[string]int64 // by SA file, "" without one
+}
+
+// errorReasons counts the errors Drive returned by reason.
+type errorReasons struct {
+	mu      sync.Mutex
+	reasons map[string]*reasonCount
+}
+
+// newErrorReasons returns an empty count.
+func newErrorReasons() *errorReasons {
+	return &errorReasons{reasons: make(map[string]*reasonCount)}
+}
+
+// errorReason returns the reason of a Drive error, false if err isn't one.
+func errorReason(err error) (string, bool) {
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) {
+		return "", false
+	}
+	if len(gerr.Errors) > 0 && gerr.Errors[0].Reason != "" {
+		return gerr.Errors[0].Reason, true
+	}
+	if text := http.StatusText(gerr.Code); text != "" {
+		return fmt.Sprintf("%d %s", gerr.Code, text), true
+	}
+	return fmt.Sprintf("HTTP %d", gerr.Code), true
+}
+
+// record counts err if it is a Drive error returned for sa.
+func (e *errorReasons) record(sa string, err error) {
+	if e == nil {
+		return
+	}
+	reason, ok := errorReason(err)
+	if !ok {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	c, ok := e.reasons[reason]
+	if !ok {
+		c = &reasonCount{sas: make(map[string]int64)}
+		e.reasons[reason] = c
+	}
+	c.n++
+	c.sas[sa]++
+}
+
+// lines describes the counts, one line per reason, most frequent first.
+func (e *errorReasons) lines() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	reasons := make([]string, 0, len(e.reasons))
+	for reason := range e.reasons {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		ni, nj := e.reasons[reasons[i]].n, e.reasons[reasons[j]].n
+		if ni != nj {
+			return ni > nj
+		}
+		return reasons[i] < reasons[j]
+	})
+	lines := make([]string, 0, len(reasons))
+	for _, reason := range reasons {
+		c := e.reasons[reason]
+		sas := make([]string, 0, len(c.sas))
+		for sa := range c.sas {
+			sas = append(sas, sa)
+		}
+		sort.Slice(sas, func(i, j int) bool {
+			if c.sas[sas[i]] != c.sas[sas[j]] {
+				return c.sas[sas[i]] > c.sas[sas[j]]
+			}
+			return sas[i] < sas[j]
+		})
+		line := fmt.Sprintf("%s: %d", reason, c.n)
+		if len(sas) == 1 && sas[0] == "" {
+			lines = append(lines, line)
+			continue
+		}
+		var counts []string
+		for i, sa := range sas {
+			if i == errorReasonsShown {
+				counts = append(counts, "...")
+				break
+			}
+			name := "no SA"
+			if sa != "" {
+				name = serviceAccountEmail(sa)
+				if name == "" {
+					name = filepath.Base(sa)
+				}
+			}
+			counts = append(counts, fmt.Sprintf("%s: %d", name, c.sas[sa]))
+		}
+		noun := "SAs"
+		if len(sas) == 1 {
+			noun = "SA"
+		}
+		lines = append(lines, fmt.Sprintf("%s with %d %s (%s)", line, len(sas), noun, strings.Join(counts, ", ")))
+	}
+	return lines
+}
+
+// logErrorReasons logs the errors Drive returned by reason, if there
+// were any.
+func (f *Fs) logErrorReasons() {
+	if f.errorReasons == nil {
+		return
+	}
+	lines := f.errorReasons.lines()
+	if len(lines) == 0 {
+		return
+	}
+	fs.Logf(f, "Drive errors by reason:\n  %s", strings.Join(lines, "\n  "))
+}
@@ -0,0 +1,50 @@
+package drive
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+func TestErrorReasons(t *testing.T) {
+	const a = "bundle:a@p.iam.gserviceaccount.com"
+	serviceAccountCredentials.Store(a, []byte(`{"client_email":"a@p.iam.gserviceaccount.com"}`))
+	defer serviceAccountCredentials.Delete(a)
+
+	rateLimit := &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}}}
+	notFound := &googleapi.Error{Code: 404, Errors: []googleapi.ErrorItem{{Reason: "notFound"}}}
+
+	var none *errorReasons
+	none.record(a, rateLimit)
+	(&Fs{}).logErrorReasons()
+
+	e := newErrorReasons()
+	assert.Empty(t, e.lines())
+	for range 3 {
+		e.record(a, rateLimit)
+	}
+	e.record("/sa/b.json", fmt.Errorf("upload failed: %w", rateLimit))
+	e.record("/sa/b.json", notFound)
+	e.record("", &googleapi.Error{Code: 502})
+	e.record("", &googleapi.Error{Code: 499})
+	e.record(a, errors.New("EOF"))
+	assert.Equal(t, []string{
+		"userRateLimitExceeded: 4 with 2 SAs (a@p.iam.gserviceaccount.com: 3, b.json: 1)",
+		"502 Bad Gateway: 1",
+		"HTTP 499: 1",
+		"notFound: 1 with 1 SA (b.json: 1)",
+	}, e.lines())
+
+	// Only the SAs with the most errors are listed
+	e = newErrorReasons()
+	for i := range errorReasonsShown + 2 {
+		e.record(fmt.Sprintf("/sa/%d.json", i), notFound)
+	}
+	e.record("/sa/0.json", notFound)
+	assert.Equal(t, []string{
+		"notFound: 8 with 7 SAs (0.json: 2, 1.json: 1, 2.json: 1, 3.json: 1, 4.json: 1, ...)",
+	}, e.lines())
+}
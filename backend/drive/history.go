@@ -0,0 +1,343 @@
+// Transfer history
+//
+// Finding out when a file was uploaded, with which SA and how long it
+// took meant grepping old logs, if they were kept at debug level. With
+// history_file every upload, overwrite and server side copy to the remote
+// is recorded in a database which the history command queries.
+//
+// The database is a bbolt file rather than sqlite: bbolt is pure Go, so
+// eclone still builds without cgo for every platform rclone does, and
+// rclone already depends on it, where the sqlite drivers either need cgo
+// or add a large module for one table.
+//
+// It holds one JSON record per transfer, keyed by the time it finished
+// and a sequence number so they are kept in time order and --since seeks
+// straight to its start. Two index buckets map the path and the SA of
+// each transfer to its key, so --path and --sa read only the records
+// they select.
+//
+// bbolt locks the file while it is open, so records are buffered and
+// written every historyFlushInterval, opening the file only for that,
+// and the history command can read it while a run is going. Fs instances
+// writing to the same file share the buffer.
+package drive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/env"
+	bolt "go.etcd.io/bbolt"
+	drive "google.golang.org/api/drive/v3"
+)
+
+const (
+	// historyFlushInterval is how long transfers are buffered for
+	historyFlushInterval = 10 * time.Second
+	// databaseLockTimeout is how long to wait for another process to
+	// close a database
+	databaseLockTimeout = 30 * time.Second
+	// historyKeyLen is the length of a historyKey
+	historyKeyLen = 16
+)
+
+// Buckets of the history database
+var (
+	historyBucket = []byte("transfers")      // records by historyKey
+	historyByPath = []byte("transfers_path") // path, 0, historyKey
+	historyBySA   = []byte("transfers_sa")   // SA, 0, historyKey
+)
+
+// historySeparator ends the names in the index buckets
+var historySeparator = []byte{0}
+
+var (
+	historiesMu sync.Mutex
+	histories   = map[string]*history{} // by file
+)
+
+// HistoryEntry is a transfer recorded in the history.
+type HistoryEntry struct {
+	Time           time.Time     `json:"time"`                      // when it finished
+	Remote         string        `json:"remote"`                    // name of the remote
+	Path           string        `json:"path"`                      // path of the object on the remote
+	ID             string        `json:"id"`                        // Drive ID of the object
+	Size           int64         `json:"size"`                      // bytes transferred
+	MD5            string        `json:"md5,omitempty"`             // MD5 of the object, if Drive has one
+	ServiceAccount string        `json:"service_account,omitempty"` // email of the SA used, or its file if unreadable
+	Duration       time.Duration `json:"duration"`                  // how long the transfer took
+	ServerSide     bool          `json:"server_side,omitempty"`     // set for server side copies
+}
+
+// history buffers the transfers to record in file.
+type history struct {
+	file    string
+	mu      sync.Mutex
+	pending []HistoryEntry
+	timer   *time.Timer // flushes pending, nil if there is nothing to flush
+}
+
+// newHistory returns the history recorded in file, nil if file is empty.
+func newHistory(file string) *history {
+	if file == "" {
+		return nil
+	}
+	file = env.ShellExpand(file)
+	historiesMu.Lock()
+	defer historiesMu.Unlock()
+	h, ok := histories[file]
+	if !ok {
+		h = &history{file: file}
+		histories[file] = h
+	}
+	return h
+}
+
+// add buffers entry, arranging for it to be written.
+func (h *history) add(entry HistoryEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pending = append(h.pending, entry)
+	if h.timer == nil {
+		h.timer = time.AfterFunc(historyFlushInterval, func() {
+			if err := h.flush(); err != nil {
+				fs.Errorf(nil, "%v", err)
+			}
+		})
+	}
+}
+
+// flush writes the buffered transfers to the database.
+func (h *history) flush() error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	pending := h.pending
+	h.pending = nil
+	if h.timer != nil {
+		h.timer.Stop()
+		h.timer = nil
+	}
+	h.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+	err := WriteHistory(h.file, pending)
+	if err != nil {
+		// Keep them for the next flush
+		h.mu.Lock()
+		h.pending = append(pending, h.pending...)
+		h.mu.Unlock()
+		return fmt.Errorf("failed to record %d transfers in history: %w", len(pending), err)
+	}
+	fs.Debugf(nil, "Recorded %d transfers in history %q", len(pending), h.file)
+	return nil
+}
+
+// openDatabase opens the bbolt database in file.
+func openDatabase(file string, readOnly bool) (*bolt.DB, error) {
+	if !readOnly {
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			return nil, err
+		}
+	}
+	return bolt.Open(file, 0600, &bolt.Options{Timeout: databaseLockTimeout, ReadOnly: readOnly})
+}
+
+// historyKey returns the key of the transfer made at t, numbered seq,
+// which sorts in time order.
+func historyKey(t time.Time, seq uint64) []byte {
+	var nanos uint64
+	if t.After(time.Unix(0, 0)) {
+		nanos = uint64(t.UnixNano())
+	}
+	key := binary.BigEndian.AppendUint64(make([]byte, 0, historyKeyLen), nanos)
+	return binary.BigEndian.AppendUint64(key, seq)
+}
+
+// WriteHistory appends entries to the history database in file.
+func WriteHistory(file string, entries []HistoryEntry) error {
+	db, err := openDatabase(file, false)
+	if err != nil {
+		return err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		var buckets [3]*bolt.Bucket
+		for i, name := range [][]byte{historyBucket, historyByPath, historyBySA} {
+			if buckets[i], err = tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		b, byPath, bySA := buckets[0], buckets[1], buckets[2]
+		for _, entry := range entries {
+			value, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			key := historyKey(entry.Time, seq)
+			if err = b.Put(key, value); err != nil {
+				return err
+			}
+			if err = byPath.Put(slices.Concat([]byte(entry.Path), historySeparator, key), nil); err != nil {
+				return err
+			}
+			if entry.ServiceAccount == "" {
+				continue
+			}
+			if err = bySA.Put(slices.Concat([]byte(entry.ServiceAccount), historySeparator, key), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// HistoryQuery selects transfers from the history.
+type HistoryQuery struct {
+	Path           string    // only this file or those under this directory, from the root of the drive
+	ServiceAccount string    // only those made with this SA, by email, the name before the @ or file name
+	Since          time.Time // only those made after this
+}
+
+// matchesPath returns true if p is selected by q.Path.
+func (q *HistoryQuery) matchesPath(p string) bool {
+	dir := strings.Trim(q.Path, "/")
+	return dir == "" || p == dir || strings.HasPrefix(p, dir+"/")
+}
+
+// matchesSA returns true if sa is selected by q.ServiceAccount.
+func (q *HistoryQuery) matchesSA(sa string) bool {
+	return q.ServiceAccount == "" || sa == q.ServiceAccount || strings.HasPrefix(sa, q.ServiceAccount+"@")
+}
+
+// matches returns true if entry is selected by q.
+func (q *HistoryQuery) matches(entry HistoryEntry) bool {
+	return q.matchesPath(entry.Path) && q.matchesSA(entry.ServiceAccount) &&
+		(q.Since.IsZero() || !entry.Time.Before(q.Since))
+}
+
+// indexed returns the keys of the records in the index bucket b whose
+// name starts with prefix and is selected by match, in time order.
+func indexed(b *bolt.Bucket, prefix string, match func(name string) bool) (keys [][]byte) {
+	if b == nil {
+		return nil
+	}
+	c := b.Cursor()
+	for k, _ := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, _ = c.Next() {
+		if len(k) <= historyKeyLen {
+			continue
+		}
+		name, key := k[:len(k)-historyKeyLen-1], k[len(k)-historyKeyLen:]
+		if match(string(name)) {
+			keys = append(keys, bytes.Clone(key))
+		}
+	}
+	slices.SortFunc(keys, bytes.Compare)
+	return keys
+}
+
+// ReadHistory calls fn with each transfer selected by q in the history
+// database in file, oldest first, stopping at the first error.
+func ReadHistory(file string, q HistoryQuery, fn func(entry HistoryEntry) error) error {
+	if _, err := os.Stat(file); err != nil {
+		return fmt.Errorf("can't read history: %w", err)
+	}
+	db, err := openDatabase(file, true)
+	if err != nil {
+		return fmt.Errorf("can't read history: %w", err)
+	}
+	defer func() { _ = db.Close() }()
+	return db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(historyBucket)
+		if b == nil {
+			return nil
+		}
+		call := func(key, value []byte) error {
+			var entry HistoryEntry
+			if err := json.Unmarshal(value, &entry); err != nil {
+				return fmt.Errorf("corrupt history record %x: %w", key, err)
+			}
+			if !q.matches(entry) {
+				return nil
+			}
+			return fn(entry)
+		}
+		var keys [][]byte
+		switch {
+		case strings.Trim(q.Path, "/") != "":
+			keys = indexed(tx.Bucket(historyByPath), strings.Trim(q.Path, "/"), q.matchesPath)
+		case q.ServiceAccount != "":
+			keys = indexed(tx.Bucket(historyBySA), q.ServiceAccount, q.matchesSA)
+		default:
+			c := b.Cursor()
+			for key, value := c.Seek(historyKey(q.Since, 0)); key != nil; key, value = c.Next() {
+				if err := call(key, value); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		since := historyKey(q.Since, 0)
+		for _, key := range keys {
+			if bytes.Compare(key, since) < 0 {
+				continue
+			}
+			if value := b.Get(key); value != nil {
+				if err := call(key, value); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// recordHistory records that the object remote with info was transferred
+// with the SA file in the time since start.
+func (f *Fs) recordHistory(remote string, info *drive.File, file string, start time.Time, serverSide bool) {
+	if f.history == nil || info == nil {
+		return
+	}
+	sa := ""
+	if file != "" {
+		if f.ServiceAccountFiles != nil {
+			sa = f.ServiceAccountFiles.emailOf(file)
+		} else {
+			sa = serviceAccountEmail(file)
+		}
+		if sa == "" {
+			sa = filepath.Base(file)
+		}
+	}
+	now := time.Now()
+	f.history.add(HistoryEntry{
+		Time:           now,
+		Remote:         f.name,
+		Path:           path.Join(f.root, remote),
+		ID:             info.Id,
+		Size:           info.Size,
+		MD5:            info.Md5Checksum,
+		ServiceAccount: sa,
+		Duration:       now.Sub(start),
+		ServerSide:     serverSide,
+	})
+}
@@ -0,0 +1,142 @@
+package drive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	drive "google.golang.org/api/drive/v3"
+)
+
+func readHistory(t *testing.T, file string, q HistoryQuery) (entries []HistoryEntry) {
+	require.NoError(t, ReadHistory(file, q, func(entry HistoryEntry) error {
+		entries = append(entries, entry)
+		return nil
+	}))
+	return entries
+}
+
+func TestHistory(t *testing.T) {
+	const a = "bundle:a@p.iam.gserviceaccount.com"
+	serviceAccountCredentials.Store(a, []byte(`{"client_email":"a@p.iam.gserviceaccount.com"}`))
+	defer serviceAccountCredentials.Delete(a)
+
+	assert.Nil(t, newHistory(""))
+	var none *history
+	assert.NoError(t, none.flush())
+	(&Fs{}).recordHistory("x", &drive.File{}, a, time.Now(), false)
+
+	file := filepath.Join(t.TempDir(), "sub", "history.db")
+	h := newHistory(file)
+	assert.Same(t, h, newHistory(file))
+	defer func() {
+		historiesMu.Lock()
+		delete(histories, file)
+		historiesMu.Unlock()
+	}()
+
+	f := &Fs{name: "gd", root: "backup", history: h, ServiceAccountFiles: newTestPool()}
+	start := time.Now().Add(-time.Second)
+	f.recordHistory("dir/a.txt", &drive.File{Id: "1", Size: 100, Md5Checksum: "abc"}, a, start, false)
+	f.recordHistory("b.txt", &drive.File{Id: "2", Size: 200}, "/sa/b.json", start, true)
+	f.recordHistory("c.txt", &drive.File{Id: "3"}, "", start, false)
+	f.recordHistory("nil.txt", nil, a, start, false)
+
+	// Nothing is written until the flush
+	_, err := os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+	assert.ErrorContains(t, ReadHistory(file, HistoryQuery{}, nil), "can't read history")
+	require.NoError(t, h.flush())
+
+	entries := readHistory(t, file, HistoryQuery{})
+	require.Len(t, entries, 3)
+	assert.Equal(t, "gd", entries[0].Remote)
+	assert.Equal(t, "backup/dir/a.txt", entries[0].Path)
+	assert.Equal(t, "1", entries[0].ID)
+	assert.Equal(t, int64(100), entries[0].Size)
+	assert.Equal(t, "abc", entries[0].MD5)
+	assert.Equal(t, "a@p.iam.gserviceaccount.com", entries[0].ServiceAccount)
+	assert.GreaterOrEqual(t, entries[0].Duration, time.Second)
+	assert.False(t, entries[0].ServerSide)
+	assert.Equal(t, "b.json", entries[1].ServiceAccount)
+	assert.True(t, entries[1].ServerSide)
+	assert.Equal(t, "", entries[2].ServiceAccount)
+
+	// Later flushes append in order
+	f.recordHistory("d.txt", &drive.File{Id: "4"}, a, start, false)
+	require.NoError(t, h.flush())
+	entries = readHistory(t, file, HistoryQuery{})
+	require.Len(t, entries, 4)
+	assert.Equal(t, "backup/d.txt", entries[3].Path)
+
+	// Transfers which can't be written are kept for the next flush
+	bad := &history{file: filepath.Join(file, "history.db")}
+	bad.add(HistoryEntry{Path: "e.txt"})
+	assert.ErrorContains(t, bad.flush(), "failed to record 1 transfers")
+	assert.Len(t, bad.pending, 1)
+
+	// The email of each SA is read once
+	assert.Equal(t, "a@p.iam.gserviceaccount.com", f.ServiceAccountFiles.clientEmails[a])
+}
+
+func TestHistoryQuery(t *testing.T) {
+	now := time.Now()
+	entry := HistoryEntry{Time: now, Path: "backup/Photos/a.jpg", ServiceAccount: "sa-1@p.iam.gserviceaccount.com"}
+	for _, test := range []struct {
+		q    HistoryQuery
+		want bool
+	}{
+		{HistoryQuery{}, true},
+		{HistoryQuery{Path: "backup/Photos"}, true},
+		{HistoryQuery{Path: "/backup/Photos/"}, true},
+		{HistoryQuery{Path: "backup/Photos/a.jpg"}, true},
+		{HistoryQuery{Path: "backup/Pho"}, false},
+		{HistoryQuery{Path: "Photos"}, false},
+		{HistoryQuery{ServiceAccount: "sa-1@p.iam.gserviceaccount.com"}, true},
+		{HistoryQuery{ServiceAccount: "sa-1"}, true},
+		{HistoryQuery{ServiceAccount: "sa-10"}, false},
+		{HistoryQuery{Since: now.Add(-time.Hour)}, true},
+		{HistoryQuery{Since: now.Add(time.Hour)}, false},
+	} {
+		assert.Equal(t, test.want, test.q.matches(entry), "%+v", test.q)
+	}
+	q := HistoryQuery{ServiceAccount: "sa-2.json"}
+	assert.True(t, q.matches(HistoryEntry{ServiceAccount: "sa-2.json"}))
+}
+
+func TestReadHistoryQuery(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history.db")
+	start := time.Now().Add(-time.Hour)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+	// Written out of time order, as Fs instances flushing together may
+	require.NoError(t, WriteHistory(file, []HistoryEntry{
+		{Time: at(30), Path: "backup/Photos/b.jpg", ServiceAccount: "sa-2@p"},
+		{Time: at(10), Path: "backup/Photos/a.jpg", ServiceAccount: "sa-1@p"},
+		{Time: at(20), Path: "backup/Photos2/c.jpg", ServiceAccount: "sa-10@p"},
+		{Time: at(40), Path: "backup/Photos", ServiceAccount: "sa-1.json"},
+		{Time: at(50), Path: "other/d.txt"},
+	}))
+	paths := func(q HistoryQuery) (paths []string) {
+		for _, entry := range readHistory(t, file, q) {
+			paths = append(paths, entry.Path)
+		}
+		return paths
+	}
+	assert.Equal(t, []string{"backup/Photos/a.jpg", "backup/Photos2/c.jpg", "backup/Photos/b.jpg", "backup/Photos", "other/d.txt"}, paths(HistoryQuery{}))
+	assert.Equal(t, []string{"backup/Photos/b.jpg", "backup/Photos", "other/d.txt"}, paths(HistoryQuery{Since: at(25)}))
+	assert.Equal(t, []string{"backup/Photos/a.jpg", "backup/Photos/b.jpg", "backup/Photos"}, paths(HistoryQuery{Path: "backup/Photos"}))
+	assert.Equal(t, []string{"backup/Photos/b.jpg", "backup/Photos"}, paths(HistoryQuery{Path: "backup/Photos", Since: at(25)}))
+	assert.Equal(t, []string{"backup/Photos/a.jpg"}, paths(HistoryQuery{ServiceAccount: "sa-1"}))
+	assert.Equal(t, []string{"backup/Photos"}, paths(HistoryQuery{ServiceAccount: "sa-1.json"}))
+	assert.Equal(t, []string{"backup/Photos/a.jpg"}, paths(HistoryQuery{Path: "backup", ServiceAccount: "sa-1@p"}))
+	assert.Empty(t, paths(HistoryQuery{Path: "none"}))
+	assert.Empty(t, paths(HistoryQuery{ServiceAccount: "none"}))
+
+	// Later writes are found through the indexes too
+	require.NoError(t, WriteHistory(file, []HistoryEntry{{Time: at(5), Path: "other/e.txt", ServiceAccount: "sa-1@p"}}))
+	assert.Equal(t, []string{"other/e.txt", "backup/Photos/a.jpg"}, paths(HistoryQuery{ServiceAccount: "sa-1"}))
+	assert.Equal(t, []string{"other/e.txt", "other/d.txt"}, paths(HistoryQuery{Path: "other"}))
+}
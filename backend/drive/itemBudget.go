@@ -0,0 +1,211 @@
+// Item budget
+//
+// A shared drive holds at most 400,000 items and a folder at most 500,000
+// direct children, and Drive refuses to create anything past that. With
+// item_warn the items on the destination are counted as they are made,
+// and a warning is logged the first time the shared drive or a folder
+// reaches that percentage of its limit, while there is still room to
+// move to another drive.
+//
+// The shared drive is counted once, in the background from when the
+// first item is made on it, and the items made meanwhile are added to
+// the count. Folders start from the number of items their listing
+// found, or from zero if they weren't listed. Fs instances on the same
+// drive share the counts. The warnings are only logged and don't change
+// how the run ends.
+package drive
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"google.golang.org/api/drive/v3"
+)
+
+const (
+	// teamDriveItemLimit is the most items a shared drive can hold
+	teamDriveItemLimit = 400000
+	// folderItemLimit is the most items a folder can hold directly
+	folderItemLimit = 500000
+)
+
+var (
+	itemBudgetsMu sync.Mutex
+	itemBudgets   = map[string]*itemBudget{} // by shared drive ID, or remote name for My Drive
+)
+
+// itemBudget counts the items on a drive and in its folders.
+type itemBudget struct {
+	warn       int64     // percentage of a limit to warn at
+	driveOnce  sync.Once // starts counting the shared drive
+	mu         sync.Mutex
+	driveItems int64                 // items on the shared drive, -1 if not known
+	driveMade  int64                 // items made while the shared drive is counted
+	driveWarn  bool                  // set once the shared drive reached item_warn
+	folders    map[string]*itemCount // by folder ID
+}
+
+// itemCount is the number of items in a folder.
+type itemCount struct {
+	path   string // path of the folder, if known
+	items  int64
+	warned bool
+}
+
+// newItemBudget returns the item budget for the drive of the remote
+// called name, nil if item_warn is off.
+func newItemBudget(name string, opt *Options) (*itemBudget, error) {
+	if opt.ItemWarn == 0 {
+		return nil, nil
+	}
+	if opt.ItemWarn < 0 || opt.ItemWarn > 100 {
+		return nil, fmt.Errorf("item_warn must be a percentage between 1 and 100, not %d", opt.ItemWarn)
+	}
+	key := opt.TeamDriveID
+	if key == "" {
+		key = name + ":"
+	}
+	itemBudgetsMu.Lock()
+	defer itemBudgetsMu.Unlock()
+	b, ok := itemBudgets[key]
+	if !ok {
+		b = &itemBudget{
+			warn:       int64(opt.ItemWarn),
+			driveItems: -1,
+			folders:    make(map[string]*itemCount),
+		}
+		itemBudgets[key] = b
+	}
+	return b, nil
+}
+
+// folder returns the count of the folder with ID dirID - call with b.mu
+// held.
+func (b *itemBudget) folder(dirID string) *itemCount {
+	count, ok := b.folders[dirID]
+	if !ok {
+		count = &itemCount{}
+		b.folders[dirID] = count
+	}
+	return count
+}
+
+// reached returns true if n items are at item_warn of limit.
+func (b *itemBudget) reached(n, limit int64) bool {
+	return n*100 >= limit*b.warn
+}
+
+// checkFolder warns if the folder with ID dirID reached item_warn - call
+// with b.mu held.
+func (b *itemBudget) checkFolder(f *Fs, dirID string) {
+	count := b.folders[dirID]
+	if count.warned || !b.reached(count.items, folderItemLimit) {
+		return
+	}
+	count.warned = true
+	name := fmt.Sprintf("folder %q", count.path)
+	if count.path == "" {
+		name = fmt.Sprintf("folder with ID %s", dirID)
+	}
+	b.warning(f, name, count.items, folderItemLimit)
+}
+
+// checkDrive warns if the shared drive reached item_warn - call with
+// b.mu held.
+func (b *itemBudget) checkDrive(f *Fs) {
+	if b.driveWarn || !b.reached(b.driveItems, teamDriveItemLimit) {
+		return
+	}
+	b.driveWarn = true
+	b.warning(f, fmt.Sprintf("shared drive %s", f.opt.TeamDriveID), b.driveItems, teamDriveItemLimit)
+}
+
+// warning logs that name holds n of its limit of items.
+func (b *itemBudget) warning(f *Fs, name string, n, limit int64) {
+	fs.Logf(f, "Item budget: %s holds %d items, %d%% of the %d Drive allows - new items will be refused at the limit", name, n, n*100/limit, limit)
+}
+
+// itemsListed records that listing the folder dir with ID dirID found n
+// items.
+func (f *Fs) itemsListed(dirID, dir string, n int64) {
+	b := f.items
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	count := b.folder(dirID)
+	count.path = path.Join(f.root, dir)
+	count.items = max(count.items, n)
+	b.checkFolder(f, dirID)
+}
+
+// itemCreated records that an item was made in the folder with ID dirID.
+func (f *Fs) itemCreated(ctx context.Context, dirID string) {
+	b := f.items
+	if b == nil {
+		return
+	}
+	if f.isTeamDrive {
+		b.driveOnce.Do(func() {
+			// Counting a full drive takes hundreds of listings, so the
+			// upload which made the first item doesn't wait for it
+			go b.countDrive(context.WithoutCancel(ctx), f)
+		})
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.driveItems >= 0 {
+		b.driveItems++
+		b.checkDrive(f)
+	} else {
+		b.driveMade++
+	}
+	b.folder(dirID).items++
+	b.checkFolder(f, dirID)
+}
+
+// countDrive counts the items on the shared drive of f and adds those
+// made meanwhile, which may count some of them twice.
+func (b *itemBudget) countDrive(ctx context.Context, f *Fs) {
+	n, err := f.countDriveItems(ctx)
+	if err != nil {
+		fs.Errorf(f, "Item budget: failed to count the items on the shared drive: %v", err)
+		return
+	}
+	fs.Debugf(f, "Item budget: shared drive holds %d items", n)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.driveItems = n + b.driveMade
+	b.checkDrive(f)
+}
+
+// countDriveItems returns the number of items on the shared drive,
+// trashed ones included as they count towards the limit.
+func (f *Fs) countDriveItems(ctx context.Context) (n int64, err error) {
+	list := f.svc.Files.List().
+		DriveId(f.opt.TeamDriveID).
+		Corpora("drive").
+		Fields("files(id),nextPageToken").
+		PageSize(1000).
+		SupportsAllDrives(true).
+		IncludeItemsFromAllDrives(true)
+	for {
+		var files *drive.FileList
+		err = f.pacer.Call(func() (bool, error) {
+			files, err = list.Context(ctx).Do()
+			return f.shouldRetry(ctx, err)
+		})
+		if err != nil {
+			return n, err
+		}
+		n += int64(len(files.Files))
+		if files.NextPageToken == "" {
+			return n, nil
+		}
+		list.PageToken(files.NextPageToken)
+	}
+}
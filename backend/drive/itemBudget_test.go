@@ -0,0 +1,115 @@
+package drive
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/pacer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+// forgetItemBudget drops the budget under key once the test is done.
+func forgetItemBudget(t *testing.T, key string) {
+	t.Cleanup(func() {
+		itemBudgetsMu.Lock()
+		delete(itemBudgets, key)
+		itemBudgetsMu.Unlock()
+	})
+}
+
+func TestNewItemBudget(t *testing.T) {
+	b, err := newItemBudget("remote", &Options{})
+	require.NoError(t, err)
+	assert.Nil(t, b)
+	_, err = newItemBudget("remote", &Options{ItemWarn: 101})
+	assert.ErrorContains(t, err, "between 1 and 100")
+
+	// Remotes on the same drive share the counts
+	b1, err := newItemBudget("one", &Options{ItemWarn: 90, TeamDriveID: "TestNewItemBudget"})
+	require.NoError(t, err)
+	b2, err := newItemBudget("two", &Options{ItemWarn: 80, TeamDriveID: "TestNewItemBudget"})
+	require.NoError(t, err)
+	assert.Same(t, b1, b2)
+	b3, err := newItemBudget("one", &Options{ItemWarn: 90})
+	require.NoError(t, err)
+	assert.NotSame(t, b1, b3)
+}
+
+func TestItemBudgetFolder(t *testing.T) {
+	ctx := context.Background()
+	b, err := newItemBudget("TestItemBudgetFolder", &Options{ItemWarn: 90})
+	require.NoError(t, err)
+	forgetItemBudget(t, "TestItemBudgetFolder:")
+	f := &Fs{root: "media", items: b}
+
+	f.itemsListed("dir", "tv", folderItemLimit*9/10-2)
+	f.itemCreated(ctx, "dir")
+	assert.False(t, b.folders["dir"].warned)
+	f.itemCreated(ctx, "dir")
+	f.itemCreated(ctx, "dir")
+	f.itemCreated(ctx, "other")
+
+	assert.Equal(t, &itemCount{path: "media/tv", items: folderItemLimit*9/10 + 1, warned: true}, b.folders["dir"])
+	assert.Equal(t, &itemCount{items: 1}, b.folders["other"])
+}
+
+func TestItemBudgetTeamDrive(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		assert.Equal(t, "td", r.URL.Query().Get("driveId"))
+		if r.URL.Query().Get("pageToken") == "" {
+			_, _ = io.WriteString(w, `{"files":[{"id":"1"},{"id":"2"}],"nextPageToken":"next"}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"files":[{"id":"3"}]}`)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	svc, err := drive.NewService(ctx, option.WithHTTPClient(srv.Client()), option.WithEndpoint(srv.URL+"/"))
+	require.NoError(t, err)
+	b, err := newItemBudget("remote", &Options{ItemWarn: 1, TeamDriveID: "td"})
+	require.NoError(t, err)
+	forgetItemBudget(t, "td")
+	f := &Fs{
+		svc:         svc,
+		pacer:       fs.NewPacer(ctx, pacer.NewGoogleDrive(pacer.MinSleep(time.Millisecond))),
+		isTeamDrive: true,
+		items:       b,
+	}
+	f.opt.TeamDriveID = "td"
+
+	driveItems := func() int64 {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return b.driveItems
+	}
+
+	// The items made while the drive is counted are added to the count
+	cancelled, cancel := context.WithCancel(ctx)
+	f.itemCreated(cancelled, "dir")
+	cancel()
+	f.itemCreated(ctx, "dir")
+	assert.Eventually(t, func() bool { return driveItems() == 5 }, time.Second, time.Millisecond)
+	assert.Equal(t, int32(2), requests.Load())
+	assert.False(t, b.driveWarn)
+
+	f.itemCreated(ctx, "dir")
+	assert.Equal(t, int64(6), driveItems())
+	b.mu.Lock()
+	b.driveItems = teamDriveItemLimit/100 - 1
+	b.mu.Unlock()
+	f.itemCreated(ctx, "dir")
+	assert.True(t, b.driveWarn)
+	assert.Equal(t, int32(2), requests.Load())
+}
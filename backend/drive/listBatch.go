@@ -0,0 +1,133 @@
+// Listing gigantic folders in bounded memory
+//
+// Listings hand their entries to the caller 100 at a time, each hand
+// over made while the listing waits. With list_batch set they are handed
+// over in batches of that size by a goroutine of its own instead, so the
+// next page is fetched while the caller works through the last batch.
+// At most one batch waits to be handed over: once the caller falls
+// behind the listing blocks until it catches up, so a folder of millions
+// of entries is listed in the memory of a couple of batches however
+// slow the caller is.
+package drive
+
+import (
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/list"
+)
+
+// listHelper collects the entries of a listing for its callback, as
+// list.Helper does.
+type listHelper interface {
+	// Add adds an entry, passing the entries on if there are enough
+	Add(entry fs.DirEntry) error
+	// Flush passes on any entries left
+	Flush() error
+}
+
+// newListHelper returns the helper passing the entries of a listing to
+// callback and a function to call once the listing is done, whether it
+// was flushed or not.
+func (f *Fs) newListHelper(callback fs.ListRCallback) (helper listHelper, stop func()) {
+	if f.opt.ListBatch <= 0 {
+		return list.NewHelper(callback), func() {}
+	}
+	b := newListBatcher(f.opt.ListBatch, callback)
+	return b, b.stop
+}
+
+// listBatcher passes entries to a callback in batches from a goroutine
+// of its own, Add blocking while a batch is already waiting.
+//
+// Add and Flush must not be called concurrently.
+type listBatcher struct {
+	size     int
+	batch    fs.DirEntries
+	batches  chan fs.DirEntries
+	failed   chan struct{} // closed once the callback has returned an error
+	done     chan struct{} // closed once every batch has been passed on
+	err      error         // of the callback, set before failed is closed
+	stopOnce sync.Once
+}
+
+// newListBatcher returns a listBatcher passing batches of size entries
+// to callback.
+func newListBatcher(size int, callback fs.ListRCallback) *listBatcher {
+	b := &listBatcher{
+		size:    size,
+		batch:   make(fs.DirEntries, 0, size),
+		batches: make(chan fs.DirEntries, 1),
+		failed:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go func() {
+		defer close(b.done)
+		for batch := range b.batches {
+			if b.err != nil {
+				continue // drain so senders don't block
+			}
+			if err := callback(batch); err != nil {
+				b.err = err
+				close(b.failed)
+			}
+		}
+	}()
+	return b
+}
+
+// Add adds entry to the batch, passing it on once it is full. It returns
+// the error of the callback once it has failed.
+func (b *listBatcher) Add(entry fs.DirEntry) error {
+	if entry == nil {
+		return nil
+	}
+	b.batch = append(b.batch, entry)
+	if len(b.batch) < b.size {
+		return b.failure()
+	}
+	return b.send()
+}
+
+// send passes the batch on, waiting if one is waiting already.
+func (b *listBatcher) send() error {
+	select {
+	case b.batches <- b.batch:
+	case <-b.failed:
+		return b.err
+	}
+	b.batch = make(fs.DirEntries, 0, b.size)
+	return b.failure()
+}
+
+// failure returns the error of the callback, if it has failed.
+func (b *listBatcher) failure() error {
+	select {
+	case <-b.failed:
+		return b.err
+	default:
+		return nil
+	}
+}
+
+// Flush passes on the entries left and waits for the callback to be
+// done with them all.
+func (b *listBatcher) Flush() error {
+	if len(b.batch) > 0 {
+		if err := b.send(); err != nil {
+			b.stop()
+			return err
+		}
+	}
+	b.stop()
+	return b.err
+}
+
+// stop stops passing batches on once those waiting have been, dropping
+// any entries not flushed.
+func (b *listBatcher) stop() {
+	b.stopOnce.Do(func() {
+		close(b.batches)
+		<-b.done
+	})
+}
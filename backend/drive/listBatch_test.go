@@ -0,0 +1,96 @@
+package drive
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListBatcher(t *testing.T) {
+	var got []int
+	var remotes []string
+	release := make(chan struct{})
+	b := newListBatcher(3, func(entries fs.DirEntries) error {
+		<-release
+		got = append(got, len(entries))
+		for _, entry := range entries {
+			remotes = append(remotes, entry.Remote())
+		}
+		return nil
+	})
+	defer b.stop()
+
+	// One batch is handed over and one waits, then Add blocks
+	added := make(chan int)
+	go func() {
+		for i := range 10 {
+			assert.NoError(t, b.Add(mockobject.Object(fmt.Sprintf("f%d", i))))
+			added <- i
+		}
+		close(added)
+	}()
+	for i := range 8 {
+		assert.Equal(t, i, <-added)
+	}
+	select {
+	case i := <-added:
+		t.Fatalf("added %d with two batches waiting", i)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	for range added {
+	}
+	require.NoError(t, b.Flush())
+	assert.Equal(t, []int{3, 3, 3, 1}, got)
+	assert.Len(t, remotes, 10)
+	assert.Equal(t, "f9", remotes[9])
+}
+
+func TestListBatcherError(t *testing.T) {
+	boom := errors.New("boom")
+	calls := 0
+	b := newListBatcher(2, func(entries fs.DirEntries) error {
+		calls++
+		return boom
+	})
+	var err error
+	for i := 0; err == nil && i < 100; i++ {
+		err = b.Add(mockobject.Object(fmt.Sprintf("f%d", i)))
+	}
+	assert.Equal(t, boom, err)
+	assert.Equal(t, boom, b.Flush())
+	assert.Equal(t, 1, calls)
+	b.stop() // twice is harmless
+}
+
+func TestNewListHelper(t *testing.T) {
+	var got []int
+	callback := func(entries fs.DirEntries) error {
+		got = append(got, len(entries))
+		return nil
+	}
+	for _, test := range []struct {
+		batch int
+		want  []int
+	}{
+		{0, []int{100, 50}},
+		{40, []int{40, 40, 40, 30}},
+	} {
+		got = nil
+		f := &Fs{}
+		f.opt.ListBatch = test.batch
+		helper, stop := f.newListHelper(callback)
+		for i := range 150 {
+			require.NoError(t, helper.Add(mockobject.Object(fmt.Sprintf("f%d", i))))
+		}
+		require.NoError(t, helper.Flush())
+		stop()
+		assert.Equal(t, test.want, got, "batch %d", test.batch)
+	}
+}
@@ -0,0 +1,141 @@
+// Spreading listings over the pool
+//
+// ListR lists directories --checkers at a time, but all with the SA in
+// use, so listing a tree of millions of files runs into the per-user
+// rate limits of one account. SpreadListR lists the same way with each
+// directory listed with the next preloaded SA of the pool, for commands
+// like eclone manifest which only need the metadata of a whole tree.
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// SpreadListR lists dir in f recursively like ListR, listing each
+// directory with the next preloaded SA of the pool. callback is called
+// with the entries as they are listed, never concurrently.
+func SpreadListR(ctx context.Context, f fs.Fs, dir string, callback fs.ListRCallback) error {
+	df, ok := f.(*Fs)
+	if !ok {
+		return errors.New("spreading listings over service accounts needs a drive remote")
+	}
+	return df.spreadListR(ctx, dir, callback)
+}
+
+// spreadListR implements SpreadListR.
+func (f *Fs) spreadListR(ctx context.Context, dir string, callback fs.ListRCallback) error {
+	dirID, err := f.dirCache.FindDir(ctx, dir, false)
+	if err != nil {
+		return err
+	}
+	preloaded := f.ServiceAccountFiles.Preloaded()
+	if preloaded == 0 {
+		fs.Debugf(f, "No preloaded service accounts - listing with the one in use")
+	}
+	fs.Debugf(f, "Listing %q with %d service accounts", dir, max(preloaded, 1))
+	var mu sync.Mutex // serialises list
+	list, stopList := f.newListHelper(callback)
+	defer stopList()
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(f.ci.Checkers)
+	var listDir func(id, remote string) error
+	listDir = func(id, remote string) error {
+		svc, err := f.ServiceAccountFiles.GetService()
+		if err != nil {
+			svc = f.svc
+		}
+		var subdirs []fs.Directory
+		err = f.listChildren(gCtx, svc, id, func(item *drive.File) (err error) {
+			if isShortcut(item) {
+				if f.opt.SkipShortcuts {
+					return nil
+				}
+				item, err = f.resolveShortcut(gCtx, item)
+				if err != nil {
+					return fmt.Errorf("list: %w", err)
+				}
+				if f.opt.SkipDanglingShortcuts && item.MimeType == shortcutMimeTypeDangling {
+					return nil
+				}
+			}
+			entry, err := f.itemToDirEntry(gCtx, path.Join(remote, item.Name), item)
+			if err != nil || entry == nil {
+				return err
+			}
+			if d, isDir := entry.(fs.Directory); isDir {
+				subdirs = append(subdirs, d)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			return list.Add(entry)
+		})
+		if err != nil {
+			return fmt.Errorf("%q: %w", remote, err)
+		}
+		for _, d := range subdirs {
+			job := func() error { return listDir(actualID(d.ID()), d.Remote()) }
+			// List it here if all the workers are busy
+			if !g.TryGo(job) {
+				if err := job(); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	g.Go(func() error { return listDir(actualID(dirID), dir) })
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	return list.Flush()
+}
+
+// listChildren calls fn with each of the files and directories, not
+// trashed, in the directory with ID dirID, listed with svc, a page at a
+// time. It stops at the first error fn returns.
+func (f *Fs) listChildren(ctx context.Context, svc *drive.Service, dirID string, fn func(*drive.File) error) (err error) {
+	list := svc.Files.List().
+		Q(fmt.Sprintf("'%s' in parents and trashed=false", dirID)).
+		SupportsAllDrives(true).
+		IncludeItemsFromAllDrives(true)
+	if f.opt.ListChunk > 0 {
+		list.PageSize(f.opt.ListChunk)
+	}
+	if f.isTeamDrive && !f.opt.SharedWithMe {
+		list.DriveId(f.opt.TeamDriveID)
+		list.Corpora("drive")
+	}
+	if resourceKey, ok := f.dirResourceKeys.Load(dirID); ok {
+		list.Header().Add("X-Goog-Drive-Resource-Keys", fmt.Sprintf("%s/%s", dirID, resourceKey))
+	}
+	fields := googleapi.Field(fmt.Sprintf("files(%s),nextPageToken", f.getFileFields(ctx)))
+	for {
+		var files *drive.FileList
+		err = f.pacer.Call(func() (bool, error) {
+			files, err = list.Fields(fields).Context(ctx).Do()
+			return f.shouldRetry(ctx, err)
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't list directory: %w", err)
+		}
+		for _, item := range files.Files {
+			item.Name = f.opt.Enc.ToStandardName(item.Name)
+			if err = fn(item); err != nil {
+				return err
+			}
+		}
+		if files.NextPageToken == "" {
+			return nil
+		}
+		list.PageToken(files.NextPageToken)
+	}
+}
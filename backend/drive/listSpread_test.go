@@ -0,0 +1,86 @@
+package drive
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/dircache"
+	"github.com/rclone/rclone/lib/pacer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+// listServer serves a tree of root with a.txt and sub, holding b.txt and
+// sub2 with c.txt, the root listed in two pages.
+func listServer(t *testing.T, hits *atomic.Int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		hits.Add(1)
+		q := r.URL.Query()
+		switch {
+		case q.Get("q") == "'root' in parents and trashed=false" && q.Get("pageToken") == "":
+			_, _ = io.WriteString(w, `{"nextPageToken":"next","files":[
+				{"id":"a","name":"a.txt","mimeType":"text/plain","size":"1","md5Checksum":"aa","modifiedTime":"2026-01-02T03:04:05Z"}]}`)
+		case q.Get("q") == "'root' in parents and trashed=false":
+			_, _ = io.WriteString(w, `{"files":[
+				{"id":"sub","name":"sub","mimeType":"application/vnd.google-apps.folder"}]}`)
+		case q.Get("q") == "'sub' in parents and trashed=false":
+			_, _ = io.WriteString(w, `{"files":[
+				{"id":"b","name":"b.txt","mimeType":"text/plain","size":"2","md5Checksum":"bb"},
+				{"id":"sub2","name":"sub2","mimeType":"application/vnd.google-apps.folder"}]}`)
+		case q.Get("q") == "'sub2' in parents and trashed=false":
+			_, _ = io.WriteString(w, `{"files":[
+				{"id":"c","name":"c.txt","mimeType":"text/plain","size":"3","md5Checksum":"cc"}]}`)
+		default:
+			t.Errorf("unexpected query %q", q.Get("q"))
+			_, _ = io.WriteString(w, `{"files":[]}`)
+		}
+	}))
+}
+
+func TestSpreadListR(t *testing.T) {
+	ctx := context.Background()
+	var hits [2]atomic.Int64
+	p := newTestPool()
+	var svcs []*drive.Service
+	for i := range hits {
+		srv := listServer(t, &hits[i])
+		defer srv.Close()
+		svc, err := drive.NewService(ctx, option.WithHTTPClient(srv.Client()), option.WithEndpoint(srv.URL+"/"))
+		require.NoError(t, err)
+		p.AddService(srv.Client(), svc)
+		svcs = append(svcs, svc)
+	}
+	f := &Fs{
+		name:                "remote",
+		svc:                 svcs[0],
+		ci:                  fs.GetConfig(ctx),
+		pacer:               fs.NewPacer(ctx, pacer.NewGoogleDrive(pacer.MinSleep(time.Millisecond))),
+		ServiceAccountFiles: p,
+		dirResourceKeys:     new(sync.Map),
+	}
+	f.dirCache = dircache.New("", "root", f)
+
+	var remotes []string
+	err := SpreadListR(ctx, f, "", func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			remotes = append(remotes, entry.Remote())
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	sort.Strings(remotes)
+	assert.Equal(t, []string{"a.txt", "sub", "sub/b.txt", "sub/sub2", "sub/sub2/c.txt"}, remotes)
+	// Each directory is listed with the next SA, its pages with the same
+	assert.ElementsMatch(t, []int64{3, 1}, []int64{hits[0].Load(), hits[1].Load()})
+}
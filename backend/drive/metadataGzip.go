@@ -0,0 +1,125 @@
+// Gzipped metadata responses
+//
+// Listings are made of large JSON responses which compress well, but the
+// Drive API only gzips a response when the User-Agent of the request
+// contains "gzip" as well as it accepting it. With metadata_gzip the API
+// requests other than uploads and downloads say so, and their responses
+// are decompressed here rather than by the HTTP transport so the bytes
+// saved can be counted. They are logged with the other stats when the
+// backend shuts down.
+package drive
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// Bytes of the gzipped metadata responses, of all the remotes
+var (
+	gzipWire    atomic.Int64 // as received
+	gzipDecoded atomic.Int64 // once decompressed
+)
+
+// metadataRequest returns true if req asks for metadata, not the content
+// of a file.
+func metadataRequest(req *http.Request) bool {
+	return req.Method == http.MethodGet &&
+		req.URL.Host == "www.googleapis.com" &&
+		!strings.HasPrefix(req.URL.Path, "/upload/") &&
+		req.URL.Query().Get("alt") != "media" &&
+		req.Header.Get("Range") == ""
+}
+
+// gzipUserAgent adds gzip to the User-Agent of the metadata requests so
+// the Drive API compresses their responses. It is run by the innermost
+// transport as that sets the User-Agent.
+func gzipUserAgent(req *http.Request) {
+	if ua := req.Header.Get("User-Agent"); metadataRequest(req) && !strings.Contains(ua, "gzip") {
+		req.Header.Set("User-Agent", strings.TrimSpace(ua+" (gzip)"))
+	}
+}
+
+// gzipTransport asks for gzipped metadata responses and decompresses
+// them, counting the bytes.
+type gzipTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *gzipTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !metadataRequest(req) || req.Header.Get("Accept-Encoding") != "" {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return resp, err
+	}
+	wire := &countingReader{r: resp.Body}
+	body, err := gzip.NewReader(wire)
+	if err != nil {
+		_ = resp.Body.Close()
+		return nil, err
+	}
+	resp.Body = &gzipBody{Reader: body, wire: wire, closer: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// countingReader counts the bytes read from r
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read implements io.Reader
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// gzipBody is the decompressed body of a response, which adds its bytes
+// to the totals when it is closed.
+type gzipBody struct {
+	*gzip.Reader
+	wire    *countingReader
+	closer  io.Closer
+	decoded int64
+	closed  bool
+}
+
+// Read implements io.Reader
+func (b *gzipBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	b.decoded += int64(n)
+	return n, err
+}
+
+// Close implements io.Closer
+func (b *gzipBody) Close() error {
+	if !b.closed {
+		b.closed = true
+		gzipWire.Add(b.wire.n)
+		gzipDecoded.Add(b.decoded)
+	}
+	return b.closer.Close()
+}
+
+// logGzipSavings logs the bytes the gzipped metadata responses saved.
+func logGzipSavings(f *Fs) {
+	wire, decoded := gzipWire.Load(), gzipDecoded.Load()
+	if decoded <= 0 {
+		return
+	}
+	fs.Debugf(f, "Gzipped metadata responses: received %v for %v (%d%% saved)", fs.SizeSuffix(wire), fs.SizeSuffix(decoded), 100*(decoded-wire)/decoded)
+}
@@ -0,0 +1,95 @@
+package drive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadataRequest(t *testing.T) {
+	for _, test := range []struct {
+		method, url, rng string
+		want             bool
+	}{
+		{"GET", "https://www.googleapis.com/drive/v3/files?q=x", "", true},
+		{"GET", "https://www.googleapis.com/drive/v3/files/id?alt=media", "", false},
+		{"GET", "https://www.googleapis.com/drive/v3/files/id", "bytes=0-", false},
+		{"GET", "https://www.googleapis.com/upload/drive/v3/files?uploadType=resumable", "", false},
+		{"POST", "https://www.googleapis.com/drive/v3/files", "", false},
+		{"GET", "https://oauth2.googleapis.com/token", "", false},
+	} {
+		req, err := http.NewRequest(test.method, test.url, nil)
+		require.NoError(t, err)
+		if test.rng != "" {
+			req.Header.Set("Range", test.rng)
+		}
+		assert.Equal(t, test.want, metadataRequest(req), test.url)
+	}
+}
+
+func TestGzipUserAgent(t *testing.T) {
+	req, err := http.NewRequest("GET", "https://www.googleapis.com/drive/v3/files", nil)
+	require.NoError(t, err)
+	req.Header.Set("User-Agent", "eclone/v1")
+	gzipUserAgent(req)
+	assert.Equal(t, "eclone/v1 (gzip)", req.Header.Get("User-Agent"))
+	gzipUserAgent(req)
+	assert.Equal(t, "eclone/v1 (gzip)", req.Header.Get("User-Agent"))
+
+	req, err = http.NewRequest("GET", "https://www.googleapis.com/drive/v3/files/id?alt=media", nil)
+	require.NoError(t, err)
+	req.Header.Set("User-Agent", "eclone/v1")
+	gzipUserAgent(req)
+	assert.Equal(t, "eclone/v1", req.Header.Get("User-Agent"))
+}
+
+func TestGzipTransport(t *testing.T) {
+	listing := strings.Repeat(`{"kind":"drive#file","name":"file.txt"},`, 1000)
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, err := zw.Write([]byte(listing))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	transport := &gzipTransport{base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		header := http.Header{}
+		body := listing
+		if req.Header.Get("Accept-Encoding") == "gzip" {
+			header.Set("Content-Encoding", "gzip")
+			body = compressed.String()
+		}
+		return &http.Response{StatusCode: 200, Header: header, Body: io.NopCloser(strings.NewReader(body)), ContentLength: int64(len(body))}, nil
+	})}
+	get := func(url string) (*http.Response, string) {
+		req, err := http.NewRequest("GET", url, nil)
+		require.NoError(t, err)
+		resp, err := transport.RoundTrip(req)
+		require.NoError(t, err)
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Empty(t, req.Header.Get("Accept-Encoding"), "request changed")
+		return resp, string(data)
+	}
+
+	wire, decoded := gzipWire.Load(), gzipDecoded.Load()
+	resp, body := get("https://www.googleapis.com/drive/v3/files")
+	assert.Equal(t, listing, body)
+	assert.True(t, resp.Uncompressed)
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, int64(-1), resp.ContentLength)
+	assert.Equal(t, int64(compressed.Len()), gzipWire.Load()-wire)
+	assert.Equal(t, int64(len(listing)), gzipDecoded.Load()-decoded)
+
+	// Downloads are left alone
+	resp, body = get("https://www.googleapis.com/drive/v3/files/id?alt=media")
+	assert.Equal(t, listing, body)
+	assert.False(t, resp.Uncompressed)
+	assert.Equal(t, int64(len(listing)), gzipDecoded.Load()-decoded)
+}
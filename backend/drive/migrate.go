@@ -0,0 +1,62 @@
+// My Drive to shared drive migration
+//
+// The migrate command moves, or with --copy copies, a My Drive into a
+// shared drive. The files are moved server side where Drive allows it.
+// Files it won't move, usually because they are owned by someone outside
+// the shared drive, go through move_fallback: a server side copy, and if
+// that is refused too a download and upload. Modification times are kept
+// whichever way a file goes.
+package drive
+
+import (
+	"errors"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// migrationOptions are the options a migration sets unless given
+var migrationOptions = []struct {
+	key, value string
+}{
+	{"server_side_across_configs", "true"},
+	{"move_fallback", moveFallbackCopy + "," + moveFallbackTransfer},
+}
+
+// SetMigrationOptions sets the drive options a migration relies on, as
+// if given on the command line, leaving any already given.
+func SetMigrationOptions() error {
+	ri, err := fs.Find("drive")
+	if err != nil {
+		return err
+	}
+	for _, o := range migrationOptions {
+		opt := ri.Options.Get(o.key)
+		if opt == nil || !opt.IsDefault() {
+			continue
+		}
+		if err = opt.Set(o.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckMigration returns an error unless src is in a My Drive and dst in
+// a shared drive.
+func CheckMigration(src, dst fs.Fs) error {
+	srcDrive, ok := src.(*Fs)
+	if !ok {
+		return errors.New("the source must be a drive remote")
+	}
+	dstDrive, ok := dst.(*Fs)
+	if !ok {
+		return errors.New("the destination must be a drive remote")
+	}
+	if srcDrive.isTeamDrive {
+		return errors.New("the source must be in a My Drive, not a shared drive")
+	}
+	if !dstDrive.isTeamDrive {
+		return errors.New("the destination must be in a shared drive - set team_drive")
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package drive
+
+import (
+	"testing"
+
+	"github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetMigrationOptions(t *testing.T) {
+	ri, err := fs.Find("drive")
+	require.NoError(t, err)
+	fallback := ri.Options.Get("move_fallback")
+	across := ri.Options.Get("server_side_across_configs")
+	defer func() {
+		fallback.Value = nil
+		across.Value = nil
+	}()
+	require.NoError(t, fallback.Set("shortcut"))
+
+	require.NoError(t, SetMigrationOptions())
+	assert.Equal(t, "shortcut", fallback.String())
+	assert.Equal(t, "true", across.String())
+}
+
+func TestCheckMigration(t *testing.T) {
+	myDrive := &Fs{}
+	shared := &Fs{isTeamDrive: true}
+	assert.NoError(t, CheckMigration(myDrive, shared))
+	assert.ErrorContains(t, CheckMigration(shared, shared), "source must be in a My Drive")
+	assert.ErrorContains(t, CheckMigration(myDrive, myDrive), "destination must be in a shared drive")
+	assert.ErrorContains(t, CheckMigration(&local.Fs{}, shared), "source must be a drive remote")
+}
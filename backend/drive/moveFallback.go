@@ -0,0 +1,143 @@
+// Server side move fallback
+//
+// Moving a file between drives fails when Drive won't change its parents,
+// e.g. because it is owned by someone outside the destination shared drive
+// or the destination is in another domain. With move_fallback those moves
+// go through the listed steps in order until one works:
+//
+//   - copy: copy the file server side, then delete the source
+//   - shortcut: make a shortcut to the source at the destination, leaving
+//     the source where it is as deleting it would break the shortcut. If
+//     the source isn't on a drive remote this returns fs.ErrorCantMove,
+//     so the move is done as a copy and delete if no step is left
+//   - transfer: download and upload the file, then delete the source
+//
+// If the source can't be deleted after a copy or transfer the new file is
+// removed again so the file doesn't end up in both places.
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rclone/rclone/fs"
+	"google.golang.org/api/googleapi"
+)
+
+// Steps of move_fallback
+const (
+	moveFallbackCopy     = "copy"
+	moveFallbackShortcut = "shortcut"
+	moveFallbackTransfer = "transfer"
+)
+
+// moveRestrictedReasons are the reasons Drive gives for refusing to
+// change the parents of a file which another way of moving it may get
+// past.
+var moveRestrictedReasons = map[string]struct{}{
+	"cannotAddParent":                           {},
+	"cannotMoveTrashedItemIntoTeamDrive":        {},
+	"crossDomainMoveRestriction":                {},
+	"fileOwnerNotMemberOfTeamDrive":             {},
+	"fileWriterTeamDriveMoveInDisabled":         {},
+	"insufficientFilePermissions":               {},
+	"shareOutNotPermitted":                      {},
+	"teamDrivesFolderMoveInNotSupported":        {},
+	"teamDrivesParentLimit":                     {},
+	"targetUserRoleLimitedByLicenseRestriction": {},
+}
+
+// isMoveRestricted returns true if err is Drive refusing a move for
+// ownership or parent restrictions.
+func isMoveRestricted(err error) bool {
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) || len(gerr.Errors) == 0 {
+		return false
+	}
+	_, ok := moveRestrictedReasons[gerr.Errors[0].Reason]
+	return ok
+}
+
+// checkMoveFallback returns an error if steps has an unknown step.
+func checkMoveFallback(steps fs.CommaSepList) error {
+	for _, step := range steps {
+		switch step {
+		case moveFallbackCopy, moveFallbackShortcut, moveFallbackTransfer:
+		default:
+			return fmt.Errorf("unknown move_fallback step %q - use %q, %q or %q", step, moveFallbackCopy, moveFallbackShortcut, moveFallbackTransfer)
+		}
+	}
+	return nil
+}
+
+// moveFallback moves src to remote through the move_fallback steps after
+// the server side move failed with moveErr.
+func (f *Fs) moveFallback(ctx context.Context, src fs.Object, remote string, moveErr error) (fs.Object, error) {
+	err := moveErr
+	for _, step := range f.opt.MoveFallback {
+		fs.Infof(src, "Server side move failed (%v) - trying %s", err, step)
+		var o fs.Object
+		switch step {
+		case moveFallbackCopy:
+			o, err = f.Copy(ctx, src, remote)
+			if err == nil {
+				err = removeMoved(ctx, src, o)
+			}
+		case moveFallbackShortcut:
+			o, err = f.moveShortcut(ctx, src, remote)
+		case moveFallbackTransfer:
+			o, err = f.moveTransfer(ctx, src, remote)
+			if err == nil {
+				err = removeMoved(ctx, src, o)
+			}
+		}
+		if err == nil {
+			return o, nil
+		}
+	}
+	if errors.Is(err, fs.ErrorCantMove) {
+		// Compared as it is by the caller, which then copies and deletes
+		return nil, fs.ErrorCantMove
+	}
+	return nil, fmt.Errorf("move fallback failed: %w", err)
+}
+
+// moveShortcut makes a shortcut to src at remote.
+func (f *Fs) moveShortcut(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcFs, ok := src.Fs().(*Fs)
+	if !ok {
+		return nil, fs.ErrorCantMove
+	}
+	return srcFs.makeShortcut(ctx, src.Remote(), f, remote)
+}
+
+// moveTransfer downloads src and uploads it as remote.
+func (f *Fs) moveTransfer(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	if _, ok := src.(*Object); !ok {
+		return nil, errors.New("only files can be transferred, not documents")
+	}
+	in, err := src.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	o, err := f.Put(ctx, in, fs.NewOverrideRemote(src, remote))
+	closeErr := in.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return o, err
+}
+
+// removeMoved deletes src now it has been copied to o, removing o again
+// if src can't be deleted.
+func removeMoved(ctx context.Context, src, o fs.Object) error {
+	err := src.Remove(ctx)
+	if err == nil {
+		return nil
+	}
+	if rmErr := o.Remove(ctx); rmErr != nil {
+		fs.Errorf(o, "Failed to remove copy after failing to delete the source: %v", rmErr)
+	}
+	return fmt.Errorf("failed to delete source: %w", err)
+}
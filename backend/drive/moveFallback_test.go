@@ -0,0 +1,50 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+func TestIsMoveRestricted(t *testing.T) {
+	restricted := &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "teamDrivesParentLimit"}}}
+	assert.True(t, isMoveRestricted(restricted))
+	assert.True(t, isMoveRestricted(fmt.Errorf("wrapped: %w", restricted)))
+	assert.False(t, isMoveRestricted(&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}}}))
+	assert.False(t, isMoveRestricted(&googleapi.Error{Code: 404}))
+	assert.False(t, isMoveRestricted(errors.New("other")))
+}
+
+func TestCheckMoveFallback(t *testing.T) {
+	assert.NoError(t, checkMoveFallback(nil))
+	assert.NoError(t, checkMoveFallback(fs.CommaSepList{"copy", "shortcut", "transfer"}))
+	assert.ErrorContains(t, checkMoveFallback(fs.CommaSepList{"copy", "rename"}), `unknown move_fallback step "rename"`)
+}
+
+func TestMoveFallbackSteps(t *testing.T) {
+	ctx := context.Background()
+	f := &Fs{}
+	src := mockobject.Object("file.bin")
+	moveErr := &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "cannotAddParent"}}}
+
+	// Every step is tried in turn and the last error returned, with a
+	// shortcut which can't be made returned as it is so the move is
+	// done as a copy and delete
+	f.opt.MoveFallback = fs.CommaSepList{"transfer", "shortcut"}
+	_, err := f.moveFallback(ctx, src, "dst/file.bin", moveErr)
+	assert.Equal(t, fs.ErrorCantMove, err)
+
+	f.opt.MoveFallback = fs.CommaSepList{"shortcut", "transfer"}
+	_, err = f.moveFallback(ctx, src, "dst/file.bin", moveErr)
+	assert.ErrorContains(t, err, "move fallback failed: only files can be transferred")
+
+	// A source which can't be deleted fails the step
+	err = removeMoved(ctx, src, mockobject.Object("dst/file.bin"))
+	assert.ErrorContains(t, err, "failed to delete source")
+}
@@ -0,0 +1,180 @@
+// Orphaned files
+//
+// A file whose folder was deleted by someone else, or which was uploaded
+// into a folder the uploader later lost access to, has no parent its
+// owner can see. It still uses its owner's storage but can only be found
+// by searching. SAs collect these when they upload into folders that are
+// then removed, and nobody ever logs in as them to clean up.
+//
+// The orphans command searches for the files owned by the account in
+// use, a given user, or with -o sa every SA of the pool in turn, and
+// returns those without a parent. With -o rescue=DIR they are moved into
+// DIR on the remote, and with -o trash they are trashed, each by the
+// account which found them.
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+	"google.golang.org/api/drive/v3"
+)
+
+// Actions of the orphans command
+const (
+	orphanRescued = "rescued"
+	orphanTrashed = "trashed"
+)
+
+// orphan is a file without a parent
+type orphan struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Owner  string `json:"owner"`
+	Size   int64  `json:"size"`
+	Folder bool   `json:"folder,omitempty"`
+	Action string `json:"action,omitempty"` // orphanRescued or orphanTrashed if done
+}
+
+// orphanQuery returns the search query for the untrashed files owned by
+// owner.
+func orphanQuery(owner string) string {
+	owner = strings.ReplaceAll(owner, `\`, `\\`)
+	owner = strings.ReplaceAll(owner, `'`, `\'`)
+	return fmt.Sprintf("'%s' in owners and trashed=false", owner)
+}
+
+// findOrphans returns the files owned by owner, as seen with svc, which
+// have no parent.
+func (f *Fs) findOrphans(ctx context.Context, svc *drive.Service, owner string) (orphans []orphan, err error) {
+	list := svc.Files.List().
+		Q(orphanQuery(owner)).
+		Fields("files(id,name,mimeType,size,parents,owners(emailAddress)),nextPageToken").
+		PageSize(1000)
+	for {
+		var files *drive.FileList
+		err = f.pacer.Call(func() (bool, error) {
+			files, err = list.Context(ctx).Do()
+			return f.shouldRetry(ctx, err)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("couldn't search for the files of %s: %w", owner, err)
+		}
+		for _, item := range files.Files {
+			if len(item.Parents) > 0 {
+				continue
+			}
+			o := orphan{
+				ID:     item.Id,
+				Name:   item.Name,
+				Owner:  owner,
+				Size:   item.Size,
+				Folder: item.MimeType == driveFolderType,
+			}
+			if len(item.Owners) > 0 && item.Owners[0].EmailAddress != "" {
+				o.Owner = item.Owners[0].EmailAddress
+			}
+			orphans = append(orphans, o)
+		}
+		if files.NextPageToken == "" {
+			return orphans, nil
+		}
+		list.PageToken(files.NextPageToken)
+	}
+}
+
+// fixOrphan moves o into the folder with ID rescueID, or trashes it if
+// rescueID is empty, using svc.
+func (f *Fs) fixOrphan(ctx context.Context, svc *drive.Service, o *orphan, rescueID string) (err error) {
+	update := svc.Files.Update(o.ID, &drive.File{Trashed: true})
+	o.Action = orphanTrashed
+	if rescueID != "" {
+		update = svc.Files.Update(o.ID, &drive.File{}).AddParents(rescueID)
+		o.Action = orphanRescued
+	}
+	if f.ci.DryRun {
+		fs.Logf(f, "Not %s orphan %q (%s) as --dry-run is set", o.Action, o.Name, o.ID)
+		o.Action = ""
+		return nil
+	}
+	err = f.pacer.Call(func() (bool, error) {
+		_, err = update.Fields("").SupportsAllDrives(true).Context(ctx).Do()
+		return f.shouldRetry(ctx, err)
+	})
+	if err != nil {
+		o.Action = ""
+		return err
+	}
+	fs.Infof(f, "Orphan %q (%s) of %s %s", o.Name, o.ID, o.Owner, o.Action)
+	return nil
+}
+
+// orphansOf finds the orphans owned by owner as seen with svc and fixes
+// them as asked. A file which can't be fixed is logged and left.
+func (f *Fs) orphansOf(ctx context.Context, svc *drive.Service, owner, rescueID string, fix bool) ([]orphan, error) {
+	orphans, err := f.findOrphans(ctx, svc, owner)
+	if err != nil || !fix {
+		return orphans, err
+	}
+	for i := range orphans {
+		if err := f.fixOrphan(ctx, svc, &orphans[i], rescueID); err != nil {
+			fs.Errorf(f, "Failed to fix orphan %q (%s): %v", orphans[i].Name, orphans[i].ID, err)
+		}
+	}
+	return orphans, nil
+}
+
+// orphansCommand runs the orphans backend command.
+func (f *Fs) orphansCommand(ctx context.Context, opt map[string]string) ([]orphan, error) {
+	rescue, rescueSet := opt["rescue"]
+	_, trash := opt["trash"]
+	_, sa := opt["sa"]
+	user := opt["user"]
+	if rescueSet && trash {
+		return nil, errors.New("can't both rescue and trash orphans")
+	}
+	if sa && user != "" {
+		return nil, errors.New("can't look for the orphans of both the service accounts and a user")
+	}
+	rescueID := ""
+	if rescueSet {
+		var err error
+		rescueID, err = f.dirCache.FindDir(ctx, rescue, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find rescue folder: %w", err)
+		}
+		rescueID = actualID(rescueID)
+	}
+	fix := rescueSet || trash
+	if !sa {
+		owner := "me"
+		if user != "" {
+			owner = user
+		}
+		return f.orphansOf(ctx, f.svc, owner, rescueID, fix)
+	}
+	files := f.ServiceAccountFiles.files()
+	if len(files) == 0 {
+		return nil, errors.New("no service accounts in the pool")
+	}
+	var orphans []orphan
+	for _, file := range files {
+		svc, err := f.ServiceAccountFiles.createService(&f.opt, file)
+		if err != nil {
+			fs.Errorf(f, "Skipping service account %s: %v", file, err)
+			continue
+		}
+		found, err := f.orphansOf(ctx, svc.Service, "me", rescueID, fix)
+		closeIdleConnections(svc.Client)
+		if err != nil {
+			fs.Errorf(f, "Skipping service account %s: %v", file, err)
+			continue
+		}
+		fs.Debugf(f, "Service account %s has %d orphans", file, len(found))
+		orphans = append(orphans, found...)
+	}
+	return orphans, nil
+}
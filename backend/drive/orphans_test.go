@@ -0,0 +1,104 @@
+package drive
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/dircache"
+	"github.com/rclone/rclone/lib/pacer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+func TestOrphanQuery(t *testing.T) {
+	assert.Equal(t, "'me' in owners and trashed=false", orphanQuery("me"))
+	assert.Equal(t, `'o\'neil@example.com' in owners and trashed=false`, orphanQuery("o'neil@example.com"))
+}
+
+// orphanServer fakes the Drive API holding one orphan and one file in a
+// folder, recording the changes made.
+func orphanServer(t *testing.T) (*httptest.Server, *[]string) {
+	var (
+		mu      sync.Mutex
+		changes []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			_, _ = io.WriteString(w, `{"files":[
+				{"id":"lost","name":"lost.txt","size":"5","owners":[{"emailAddress":"sa@example.com"}]},
+				{"id":"kept","name":"kept.txt","parents":["root"]}]}`)
+		case http.MethodPatch:
+			body, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			changes = append(changes, strings.TrimPrefix(r.URL.Path, "/files/")+" "+r.URL.Query().Get("addParents")+" "+strings.TrimSpace(string(body)))
+			mu.Unlock()
+			_, _ = io.WriteString(w, `{}`)
+		}
+	}))
+	return srv, &changes
+}
+
+func TestOrphans(t *testing.T) {
+	srv, changes := orphanServer(t)
+	defer srv.Close()
+	ctx := context.Background()
+	svc, err := drive.NewService(ctx, option.WithHTTPClient(srv.Client()), option.WithEndpoint(srv.URL+"/"))
+	require.NoError(t, err)
+	f := &Fs{
+		svc:   svc,
+		ci:    fs.GetConfig(ctx),
+		pacer: fs.NewPacer(ctx, pacer.NewGoogleDrive(pacer.MinSleep(time.Millisecond))),
+	}
+
+	orphans, err := f.orphansCommand(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []orphan{{ID: "lost", Name: "lost.txt", Owner: "sa@example.com", Size: 5}}, orphans)
+	assert.Empty(t, *changes)
+
+	orphans, err = f.orphansCommand(ctx, map[string]string{"trash": ""})
+	require.NoError(t, err)
+	assert.Equal(t, orphanTrashed, orphans[0].Action)
+	assert.Equal(t, []string{`lost  {"trashed":true}`}, *changes)
+
+	_, err = f.orphansCommand(ctx, map[string]string{"trash": "", "rescue": "x"})
+	assert.ErrorContains(t, err, "can't both")
+}
+
+func TestOrphansServiceAccounts(t *testing.T) {
+	srv, changes := orphanServer(t)
+	defer srv.Close()
+	ctx := context.Background()
+	p := newTestPool()
+	setFiles(p, "a.json", "b.json")
+	p.Factory = ServiceFactoryFunc(func(ctx context.Context, opt *Options, file string) (ServiceAccountInfo, error) {
+		svc, err := drive.NewService(ctx, option.WithHTTPClient(srv.Client()), option.WithEndpoint(srv.URL+"/"))
+		return ServiceAccountInfo{Service: svc, Client: srv.Client()}, err
+	})
+	f := &Fs{
+		ci:                  fs.GetConfig(ctx),
+		pacer:               fs.NewPacer(ctx, pacer.NewGoogleDrive(pacer.MinSleep(time.Millisecond))),
+		ServiceAccountFiles: p,
+	}
+	f.dirCache = dircache.New("", "root", f)
+	require.NoError(t, f.dirCache.FindRoot(ctx, false))
+	f.dirCache.Put("rescue", "rescueID")
+
+	orphans, err := f.orphansCommand(ctx, map[string]string{"sa": "", "rescue": "rescue"})
+	require.NoError(t, err)
+	require.Len(t, orphans, 2)
+	assert.Equal(t, orphanRescued, orphans[1].Action)
+	assert.Equal(t, []string{"lost rescueID {}", "lost rescueID {}"}, *changes)
+
+	_, err = f.orphansCommand(ctx, map[string]string{"sa": "", "user": "u@example.com"})
+	assert.ErrorContains(t, err, "both the service accounts and a user")
+}
@@ -0,0 +1,182 @@
+// Overflow shared drive
+//
+// A shared drive holds at most 400,000 items. With overflow_drive set,
+// once Drive refuses to add more to the destination shared drive, that
+// file and every new file after it go to the same path in the overflow
+// shared drive instead of failing. Files already on the full drive are
+// still updated in place.
+//
+// The refused upload is returned as a retry error, so rclone sends the
+// file again with a fresh reader and it lands on the overflow drive.
+// Every file put there is logged, and appended to overflow_map if set as
+// a line of JSON with its path and the ID of the drive holding it.
+package drive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/lib/env"
+	"google.golang.org/api/googleapi"
+)
+
+// itemLimitReason is the reason Drive gives when a shared drive is full
+const itemLimitReason = "teamDriveFileLimitExceeded"
+
+// isItemLimit returns true if err is Drive refusing an item because the
+// shared drive holds as many as it can.
+func isItemLimit(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && len(gerr.Errors) > 0 && gerr.Errors[0].Reason == itemLimitReason
+}
+
+// overflowMapping is a line of overflow_map
+type overflowMapping struct {
+	Path  string `json:"path"`
+	Drive string `json:"drive"`
+}
+
+// overrideMapper reads the config from Mapper, except for the keys in
+// overrides.
+type overrideMapper struct {
+	configmap.Mapper
+	overrides configmap.Simple
+}
+
+// Get the value of key, from overrides if there.
+func (m overrideMapper) Get(key string) (string, bool) {
+	if value, ok := m.overrides[key]; ok {
+		return value, true
+	}
+	return m.Mapper.Get(key)
+}
+
+// overflow sends new files to the overflow drive once the destination is
+// full.
+type overflow struct {
+	mu   sync.Mutex
+	full bool // the destination refused an item
+	fs   *Fs  // the overflow drive, made when first needed
+	err  error
+}
+
+// newOverflow returns the overflow for the options, nil if it is off.
+func newOverflow(opt *Options) (*overflow, error) {
+	if opt.OverflowDrive == "" {
+		return nil, nil
+	}
+	if opt.TeamDriveID == "" {
+		return nil, errors.New("overflow_drive can only be used with a shared drive")
+	}
+	if opt.OverflowDrive == opt.TeamDriveID {
+		return nil, errors.New("overflow_drive must be another shared drive")
+	}
+	return &overflow{}, nil
+}
+
+// overflowTarget returns the overflow drive if new files should go there,
+// nil if they should go to f.
+func (f *Fs) overflowTarget(ctx context.Context) (*Fs, error) {
+	if f.overflow == nil {
+		return nil, nil
+	}
+	o := f.overflow
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.full {
+		return nil, nil
+	}
+	if o.fs == nil && o.err == nil {
+		m := overrideMapper{Mapper: f.m, overrides: configmap.Simple{
+			"team_drive":     f.opt.OverflowDrive,
+			"root_folder_id": "",
+			"overflow_drive": "",
+		}}
+		var newFs fs.Fs
+		newFs, o.err = NewFs(ctx, f.name, f.root, m)
+		if errors.Is(o.err, fs.ErrorIsFile) {
+			o.err = nil
+		}
+		if o.err == nil {
+			o.fs = newFs.(*Fs)
+		} else {
+			o.err = fmt.Errorf("failed to open overflow drive: %w", o.err)
+		}
+	}
+	return o.fs, o.err
+}
+
+// checkItemLimit returns err, or if it is the destination being full and
+// there is an overflow drive, switches to it and returns a retry error.
+func (f *Fs) checkItemLimit(err error) error {
+	if f.overflow == nil || !isItemLimit(err) {
+		return err
+	}
+	f.overflow.mu.Lock()
+	if !f.overflow.full {
+		f.overflow.full = true
+		fs.Logf(f, "Shared drive is full - putting new files on overflow drive %s", f.opt.OverflowDrive)
+	}
+	f.overflow.mu.Unlock()
+	return fserrors.RetryError(err)
+}
+
+// recordOverflow notes that o was put on the overflow drive.
+func (f *Fs) recordOverflow(o fs.Object) {
+	fs.Infof(o, "Put on overflow drive %s", f.opt.OverflowDrive)
+	if f.opt.OverflowMap == "" {
+		return
+	}
+	f.overflow.mu.Lock()
+	defer f.overflow.mu.Unlock()
+	err := appendOverflowMapping(env.ShellExpand(f.opt.OverflowMap), overflowMapping{
+		Path:  path.Join(f.root, o.Remote()),
+		Drive: f.opt.OverflowDrive,
+	})
+	if err != nil {
+		fs.Errorf(o, "Failed to record overflow: %v", err)
+	}
+}
+
+// appendOverflowMapping appends mapping to file.
+func appendOverflowMapping(file string, mapping overflowMapping) error {
+	out, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(out).Encode(mapping)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// putOverflow puts src on the overflow drive of, recording it.
+func (f *Fs) putOverflow(ctx context.Context, of *Fs, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	o, err := of.Put(ctx, in, src, options...)
+	if err != nil {
+		return nil, err
+	}
+	f.recordOverflow(o)
+	return o, nil
+}
+
+// copyOverflow copies src to remote on the overflow drive of, recording
+// it.
+func (f *Fs) copyOverflow(ctx context.Context, of *Fs, src fs.Object, remote string) (fs.Object, error) {
+	o, err := of.Copy(ctx, src, remote)
+	if err != nil {
+		return nil, err
+	}
+	f.recordOverflow(o)
+	return o, nil
+}
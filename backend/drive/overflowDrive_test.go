@@ -0,0 +1,80 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+)
+
+func TestNewOverflow(t *testing.T) {
+	o, err := newOverflow(&Options{})
+	require.NoError(t, err)
+	assert.Nil(t, o)
+	_, err = newOverflow(&Options{OverflowDrive: "td2"})
+	assert.ErrorContains(t, err, "only be used with a shared drive")
+	_, err = newOverflow(&Options{OverflowDrive: "td1", TeamDriveID: "td1"})
+	assert.ErrorContains(t, err, "must be another shared drive")
+	o, err = newOverflow(&Options{OverflowDrive: "td2", TeamDriveID: "td1"})
+	require.NoError(t, err)
+	assert.NotNil(t, o)
+}
+
+func TestCheckItemLimit(t *testing.T) {
+	ctx := context.Background()
+	full := &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "teamDriveFileLimitExceeded"}}}
+	other := errors.New("other")
+
+	// Without an overflow drive errors are returned as they are
+	f := &Fs{}
+	assert.Equal(t, full, f.checkItemLimit(full))
+
+	f.overflow = &overflow{}
+	assert.Nil(t, f.checkItemLimit(nil))
+	assert.Equal(t, other, f.checkItemLimit(other))
+	of, err := f.overflowTarget(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, of)
+
+	// The drive being full switches to the overflow drive and retries
+	err = f.checkItemLimit(fserrors.FatalError(full))
+	assert.True(t, fserrors.IsRetryError(err))
+	assert.True(t, f.overflow.full)
+}
+
+func TestOverrideMapper(t *testing.T) {
+	m := overrideMapper{
+		Mapper:    configmap.Simple{"team_drive": "td1", "scope": "drive"},
+		overrides: configmap.Simple{"team_drive": "td2", "root_folder_id": ""},
+	}
+	value, _ := m.Get("team_drive")
+	assert.Equal(t, "td2", value)
+	value, _ = m.Get("scope")
+	assert.Equal(t, "drive", value)
+	value, ok := m.Get("root_folder_id")
+	assert.True(t, ok)
+	assert.Equal(t, "", value)
+}
+
+func TestRecordOverflow(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "overflow.jsonl")
+	f := &Fs{root: "media", overflow: &overflow{}}
+	f.opt.OverflowDrive = "td2"
+	f.recordOverflow(mockobject.Object("a/one.mkv"))
+	f.opt.OverflowMap = file
+	f.recordOverflow(mockobject.Object("a/two.mkv"))
+	f.recordOverflow(mockobject.Object("three.mkv"))
+	buf, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, `{"path":"media/a/two.mkv","drive":"td2"}
+{"path":"media/three.mkv","drive":"td2"}
+`, string(buf))
+}
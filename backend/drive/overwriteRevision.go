@@ -0,0 +1,74 @@
+// Overwriting files with new revisions
+//
+// Overwriting a file uploads its new content as a new revision of the
+// same file, keeping its ID, sharing links and comments, except when the
+// new content comes from a server side copy: Drive can only copy into a
+// new file, so the old one is removed after and everything attached to
+// it is lost. With overwrite_revision set such copies are refused, and
+// the file is downloaded and uploaded as a new revision like any other
+// overwrite. Server side moves over an existing file still replace it.
+//
+// Each revision counts towards the quota until Drive drops it, after 30
+// days or 100 revisions unless kept forever, so keep_revisions deletes
+// the oldest revisions of a file once it is overwritten, down to the
+// number given.
+package drive
+
+import (
+	"context"
+
+	"github.com/rclone/rclone/fs"
+	"google.golang.org/api/drive/v3"
+)
+
+// overwritesRevision returns true if a server side copy over existing
+// should be refused so it is overwritten with a new revision instead.
+func (f *Fs) overwritesRevision(existing fs.Object) bool {
+	if !f.opt.OverwriteRevision {
+		return false
+	}
+	o, ok := existing.(*Object)
+	return ok && !o.split && !isShortcutID(o.id)
+}
+
+// pruneRevisions deletes the oldest revisions of o, just overwritten,
+// leaving keep_revisions of them. Failures are only logged as the
+// overwrite itself succeeded.
+func (f *Fs) pruneRevisions(ctx context.Context, o *Object) {
+	if f.opt.KeepRevisions <= 0 {
+		return
+	}
+	id := actualID(o.id)
+	var revisions []*drive.Revision
+	err := f.pacer.Call(func() (bool, error) {
+		revisions = nil
+		list := f.svc.Revisions.List(id).Fields("revisions(id,modifiedTime),nextPageToken")
+		err := list.Pages(ctx, func(page *drive.RevisionList) error {
+			revisions = append(revisions, page.Revisions...)
+			return nil
+		})
+		return f.shouldRetry(ctx, err)
+	})
+	if err != nil {
+		fs.Errorf(o, "Failed to list revisions to prune: %v", err)
+		return
+	}
+	// Revisions are listed oldest first, the head revision last
+	old := len(revisions) - f.opt.KeepRevisions
+	if old <= 0 {
+		return
+	}
+	deleted := 0
+	for _, revision := range revisions[:old] {
+		err := f.pacer.Call(func() (bool, error) {
+			err := f.svc.Revisions.Delete(id, revision.Id).Context(ctx).Do()
+			return f.shouldRetry(ctx, err)
+		})
+		if err != nil {
+			fs.Errorf(o, "Failed to delete revision %s from %s: %v", revision.Id, revision.ModifiedTime, err)
+			continue
+		}
+		deleted++
+	}
+	fs.Debugf(o, "Deleted %d old revisions, keeping %d", deleted, f.opt.KeepRevisions)
+}
@@ -0,0 +1,76 @@
+package drive
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/pacer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+func TestOverwritesRevision(t *testing.T) {
+	f := &Fs{}
+	o := &Object{baseObject: baseObject{fs: f, id: "id"}}
+	assert.False(t, f.overwritesRevision(o))
+	f.opt.OverwriteRevision = true
+	assert.True(t, f.overwritesRevision(o))
+	assert.False(t, f.overwritesRevision(nil))
+	assert.False(t, f.overwritesRevision(&documentObject{}))
+	assert.False(t, f.overwritesRevision(&Object{split: true}))
+	assert.False(t, f.overwritesRevision(&Object{baseObject: baseObject{id: "shortcut\ttarget"}}))
+}
+
+func TestPruneRevisions(t *testing.T) {
+	ctx := context.Background()
+	var (
+		mu      sync.Mutex
+		deleted []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/files/id1/revisions" && r.URL.Query().Get("pageToken") == "":
+			_, _ = io.WriteString(w, `{"nextPageToken":"next","revisions":[{"id":"r1"},{"id":"r2"}]}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/files/id1/revisions":
+			_, _ = io.WriteString(w, `{"revisions":[{"id":"r3"},{"id":"r4"}]}`)
+		case r.Method == http.MethodDelete:
+			mu.Lock()
+			deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/files/id1/revisions/"))
+			mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL)
+		}
+	}))
+	defer srv.Close()
+	svc, err := drive.NewService(ctx, option.WithHTTPClient(srv.Client()), option.WithEndpoint(srv.URL+"/"))
+	require.NoError(t, err)
+	f := &Fs{
+		svc:   svc,
+		ci:    fs.GetConfig(ctx),
+		pacer: fs.NewPacer(ctx, pacer.NewGoogleDrive(pacer.MinSleep(time.Millisecond))),
+	}
+	o := &Object{baseObject: baseObject{fs: f, id: "id1"}}
+
+	// Off by default
+	f.pruneRevisions(ctx, o)
+	assert.Empty(t, deleted)
+
+	f.opt.KeepRevisions = 2
+	f.pruneRevisions(ctx, o)
+	assert.Equal(t, []string{"r1", "r2"}, deleted)
+
+	deleted = nil
+	f.opt.KeepRevisions = 10
+	f.pruneRevisions(ctx, o)
+	assert.Empty(t, deleted)
+}
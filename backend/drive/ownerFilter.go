@@ -0,0 +1,51 @@
+// Owner filter
+//
+// Moving the data of someone leaving usually means copying only the files
+// they own out of folders shared with others. With owner_filter listings
+// only return the files owned by the given accounts, or those owned by
+// the account in use ("me") or anyone else ("others"). Folders are always
+// listed so owned files inside folders of other owners are found.
+//
+// The filter goes into the search query, so only listings made for a
+// filter-aware walk (the source of a copy, ls, etc) are narrowed. Looking
+// up a single file still finds it whoever owns it.
+package drive
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// Special values of owner_filter
+const (
+	ownerMe     = "me"
+	ownerOthers = "others"
+)
+
+// ownerQuery returns the search term listing the files owned by owners,
+// "" if there are none.
+func ownerQuery(owners fs.CommaSepList) (string, error) {
+	if len(owners) == 0 {
+		return "", nil
+	}
+	terms := []string{fmt.Sprintf("mimeType='%s'", driveFolderType)}
+	for _, owner := range owners {
+		owner = strings.TrimSpace(owner)
+		switch {
+		case owner == ownerOthers:
+			if len(owners) > 1 {
+				return "", fmt.Errorf("owner_filter %q can't be combined with other owners", ownerOthers)
+			}
+			terms = append(terms, "not 'me' in owners")
+		case owner == ownerMe || strings.Contains(owner, "@"):
+			owner = strings.ReplaceAll(owner, `\`, `\\`)
+			owner = strings.ReplaceAll(owner, `'`, `\'`)
+			terms = append(terms, fmt.Sprintf("'%s' in owners", owner))
+		default:
+			return "", fmt.Errorf("owner_filter %q isn't an email address, %q or %q", owner, ownerMe, ownerOthers)
+		}
+	}
+	return "(" + strings.Join(terms, " or ") + ")", nil
+}
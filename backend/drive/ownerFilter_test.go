@@ -0,0 +1,32 @@
+package drive
+
+import (
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOwnerQuery(t *testing.T) {
+	folder := "mimeType='application/vnd.google-apps.folder'"
+	for _, test := range []struct {
+		owners fs.CommaSepList
+		want   string
+		err    string
+	}{
+		{nil, "", ""},
+		{fs.CommaSepList{"me"}, "(" + folder + " or 'me' in owners)", ""},
+		{fs.CommaSepList{"others"}, "(" + folder + " or not 'me' in owners)", ""},
+		{fs.CommaSepList{"leaver@example.com", " o'neil@example.com"}, "(" + folder + ` or 'leaver@example.com' in owners or 'o\'neil@example.com' in owners)`, ""},
+		{fs.CommaSepList{"others", "me"}, "", `"others" can't be combined`},
+		{fs.CommaSepList{"leaver"}, "", `owner_filter "leaver" isn't an email address`},
+	} {
+		got, err := ownerQuery(test.owners)
+		if test.err != "" {
+			assert.ErrorContains(t, err, test.err, "%v", test.owners)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, test.want, got, "%v", test.owners)
+	}
+}
@@ -0,0 +1,70 @@
+package drive
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/dircache"
+	"github.com/rclone/rclone/lib/pacer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+func TestOwnerReportAdd(t *testing.T) {
+	r := make(ownerReport)
+	r.add(&drive.File{Size: 10, QuotaBytesUsed: 10, Owners: []*drive.User{{EmailAddress: "Bob@example.com"}}})
+	r.add(&drive.File{Size: 30, QuotaBytesUsed: 30, Owners: []*drive.User{{EmailAddress: "alice@example.com"}}})
+	r.add(&drive.File{QuotaBytesUsed: 5, Owners: []*drive.User{{EmailAddress: "bob@example.com"}}})
+	r.add(&drive.File{Size: 10})
+	assert.Equal(t, []ownerUsage{
+		{Owner: "alice@example.com", Files: 1, Bytes: 30, QuotaBytes: 30},
+		{Owner: ownerNone, Files: 1, Bytes: 10},
+		{Owner: "bob@example.com", Files: 2, Bytes: 10, QuotaBytes: 15},
+	}, r.sorted())
+}
+
+func TestOwnerReportWalk(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query().Get("q")
+		queries = append(queries, q)
+		switch {
+		case strings.Contains(q, "'root' in parents"):
+			_, _ = io.WriteString(w, `{"files":[
+				{"id":"sub","mimeType":"application/vnd.google-apps.folder"},
+				{"id":"sc","mimeType":"application/vnd.google-apps.shortcut"},
+				{"id":"f1","mimeType":"text/plain","size":"100","owners":[{"emailAddress":"alice@example.com"}]}]}`)
+		case strings.Contains(q, "'sub' in parents"):
+			_, _ = io.WriteString(w, `{"files":[
+				{"id":"f2","mimeType":"text/plain","size":"7","owners":[{"emailAddress":"bob@example.com"}]}]}`)
+		default:
+			_, _ = io.WriteString(w, `{}`)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	svc, err := drive.NewService(ctx, option.WithHTTPClient(srv.Client()), option.WithEndpoint(srv.URL+"/"))
+	require.NoError(t, err)
+	f := &Fs{
+		svc:   svc,
+		pacer: fs.NewPacer(ctx, pacer.NewGoogleDrive(pacer.MinSleep(time.Millisecond))),
+	}
+	f.dirCache = dircache.New("", "root", f)
+
+	usages, err := f.ownerReport(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []ownerUsage{
+		{Owner: "alice@example.com", Files: 1, Bytes: 100},
+		{Owner: "bob@example.com", Files: 1, Bytes: 7},
+	}, usages)
+	assert.Equal(t, []string{"('root' in parents) and trashed=false", "('sub' in parents) and trashed=false"}, queries)
+}
@@ -0,0 +1,143 @@
+// Bulk ownership transfer
+//
+// Consolidating personal drives means handing the files of one account
+// to another. The transfer-owner command walks the remote, applying the
+// filter flags, and makes the target user the owner of each file found,
+// a batch of files at a time with up to --checkers calls in flight. Rate
+// limits rotate the SA like any other call.
+//
+// Only the owner can give a file away, so the remote should act as the
+// current owner, e.g. with impersonate. Files owned by someone else fail
+// and are counted as such. Consumer accounts can't be given files
+// outright: with -o pending the target becomes a pending owner who has
+// to accept each file.
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/walk"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/api/drive/v3"
+)
+
+// defaultTransferBatch is the number of files transferred between
+// progress reports
+const defaultTransferBatch = 100
+
+// ownerTransfer is the result of transfer-owner
+type ownerTransfer struct {
+	Owner       string `json:"owner"`
+	Transferred int64  `json:"transferred"`
+	Failed      int64  `json:"failed"`
+}
+
+// ownedFile is a file to transfer
+type ownedFile struct {
+	remote string
+	id     string
+}
+
+// filesToTransfer walks the remote with the filters in ctx and returns
+// the files found, leaving out shortcuts.
+func (f *Fs) filesToTransfer(ctx context.Context) (files []ownedFile, err error) {
+	err = walk.ListR(ctx, f, "", false, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			o, ok := entry.(fs.IDer)
+			if !ok || isShortcutID(o.ID()) {
+				continue
+			}
+			files = append(files, ownedFile{remote: entry.Remote(), id: o.ID()})
+		}
+		return nil
+	})
+	return files, err
+}
+
+// transferOwner makes email the owner of the file with ID id, or its
+// pending owner if pending is set.
+func (f *Fs) transferOwner(ctx context.Context, id, email string, pending bool) (err error) {
+	permission := &drive.Permission{
+		Type:         "user",
+		Role:         "owner",
+		EmailAddress: email,
+	}
+	if pending {
+		permission.Role = "writer"
+		permission.PendingOwner = true
+	}
+	return f.pacer.Call(func() (bool, error) {
+		_, err = f.svc.Permissions.Create(id, permission).
+			Fields("").
+			TransferOwnership(!pending).
+			Context(ctx).Do()
+		return f.shouldRetry(ctx, err)
+	})
+}
+
+// transferOwnerCommand runs the transfer-owner backend command.
+func (f *Fs) transferOwnerCommand(ctx context.Context, arg []string, opt map[string]string) (*ownerTransfer, error) {
+	if len(arg) != 1 || !strings.Contains(arg[0], "@") {
+		return nil, errors.New("need the email of the new owner")
+	}
+	if f.isTeamDrive {
+		return nil, errors.New("files on shared drives have no owner to transfer")
+	}
+	batch := defaultTransferBatch
+	if value, ok := opt["batch"]; ok {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid batch size %q", value)
+		}
+		batch = n
+	}
+	_, pending := opt["pending"]
+	files, err := f.filesToTransfer(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+	return f.transferOwners(ctx, files, strings.TrimSpace(arg[0]), pending, batch)
+}
+
+// transferOwners gives files to email batch files at a time. A file which
+// can't be transferred is logged and counted.
+func (f *Fs) transferOwners(ctx context.Context, files []ownedFile, email string, pending bool, batch int) (*ownerTransfer, error) {
+	result := &ownerTransfer{Owner: email}
+	var transferred, failed atomic.Int64
+	for start := 0; start < len(files); start += batch {
+		g, gCtx := errgroup.WithContext(ctx)
+		g.SetLimit(f.ci.Checkers)
+		for _, file := range files[start:min(start+batch, len(files))] {
+			if f.ci.DryRun {
+				fs.Logf(file.remote, "Not transferring ownership to %s as --dry-run is set", email)
+				continue
+			}
+			g.Go(func() error {
+				if err := f.transferOwner(gCtx, actualID(file.id), email, pending); err != nil {
+					if gCtx.Err() != nil {
+						return gCtx.Err()
+					}
+					fs.Errorf(file.remote, "Failed to transfer ownership to %s: %v", email, err)
+					failed.Add(1)
+					return nil
+				}
+				fs.Debugf(file.remote, "Transferred ownership to %s", email)
+				transferred.Add(1)
+				return nil
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return nil, err
+		}
+		fs.Infof(f, "Ownership transfer: %d/%d files done", min(start+batch, len(files)), len(files))
+	}
+	result.Transferred = transferred.Load()
+	result.Failed = failed.Load()
+	return result, nil
+}
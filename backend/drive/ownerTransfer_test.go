@@ -0,0 +1,78 @@
+package drive
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/pacer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+func TestTransferOwners(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls = map[string]string{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.Split(strings.TrimPrefix(r.URL.Path, "/files/"), "/")[0]
+		var permission drive.Permission
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&permission))
+		mu.Lock()
+		calls[id] = r.URL.Query().Get("transferOwnership") + " " + permission.Role + " " + permission.EmailAddress
+		mu.Unlock()
+		if id == "notmine" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"code":404,"message":"File not found","errors":[{"reason":"notFound"}]}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	svc, err := drive.NewService(ctx, option.WithHTTPClient(srv.Client()), option.WithEndpoint(srv.URL+"/"))
+	require.NoError(t, err)
+	f := &Fs{
+		svc:   svc,
+		ci:    fs.GetConfig(ctx),
+		pacer: fs.NewPacer(ctx, pacer.NewGoogleDrive(pacer.MinSleep(time.Millisecond))),
+	}
+	files := []ownedFile{{"a", "one"}, {"b", "two"}, {"c", "notmine"}}
+
+	result, err := f.transferOwners(ctx, files, "new@example.com", false, 2)
+	require.NoError(t, err)
+	assert.Equal(t, &ownerTransfer{Owner: "new@example.com", Transferred: 2, Failed: 1}, result)
+	assert.Equal(t, map[string]string{
+		"one":     "true owner new@example.com",
+		"two":     "true owner new@example.com",
+		"notmine": "true owner new@example.com",
+	}, calls)
+
+	calls = map[string]string{}
+	result, err = f.transferOwners(ctx, files[:1], "new@example.com", true, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.Transferred)
+	assert.Equal(t, map[string]string{"one": "false writer new@example.com"}, calls)
+}
+
+func TestTransferOwnerCommandArgs(t *testing.T) {
+	ctx := context.Background()
+	f := &Fs{}
+	_, err := f.transferOwnerCommand(ctx, nil, nil)
+	assert.ErrorContains(t, err, "need the email")
+	_, err = f.transferOwnerCommand(ctx, []string{"new@example.com"}, map[string]string{"batch": "0"})
+	assert.ErrorContains(t, err, "invalid batch size")
+	f.isTeamDrive = true
+	_, err = f.transferOwnerCommand(ctx, []string{"new@example.com"}, nil)
+	assert.ErrorContains(t, err, "shared drives")
+}
@@ -0,0 +1,79 @@
+// Pool events
+//
+// What the pools do is only logged, so something following a run from
+// outside, like the event stream of rcd, had to scrape the log for it.
+// SubscribePoolEvents passes each switch, blacklisting and SA marked dead
+// to a function as it happens instead.
+package drive
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Types of pool event
+const (
+	PoolEventSwitch    = "switch"
+	PoolEventBlacklist = "blacklist"
+	PoolEventDead      = "dead"
+)
+
+// PoolEvent is something a pool did.
+type PoolEvent struct {
+	Time   time.Time `json:"time"`
+	Type   string    `json:"type"`
+	SA     string    `json:"sa"`               // email of the SA, or its file if unreadable
+	Reason string    `json:"reason,omitempty"` // of the switch or death
+	Left   int       `json:"left,omitempty"`   // SAs available after a switch
+	Until  time.Time `json:"until,omitzero"`   // end of a blacklisting
+}
+
+// poolEvents are the functions subscribed to the pool events
+var poolEvents struct {
+	mu   sync.Mutex
+	n    atomic.Int32 // number subscribed, read without mu
+	next int
+	fns  map[int]func(PoolEvent)
+}
+
+// SubscribePoolEvents calls fn with each event of the pools until the
+// returned function is called. fn is called with the pool locked so it
+// mustn't block or call the pool.
+func SubscribePoolEvents(fn func(PoolEvent)) (unsubscribe func()) {
+	poolEvents.mu.Lock()
+	defer poolEvents.mu.Unlock()
+	if poolEvents.fns == nil {
+		poolEvents.fns = make(map[int]func(PoolEvent))
+	}
+	id := poolEvents.next
+	poolEvents.next++
+	poolEvents.fns[id] = fn
+	poolEvents.n.Add(1)
+	return func() {
+		poolEvents.mu.Lock()
+		defer poolEvents.mu.Unlock()
+		if _, ok := poolEvents.fns[id]; ok {
+			delete(poolEvents.fns, id)
+			poolEvents.n.Add(-1)
+		}
+	}
+}
+
+// poolEventsSubscribed returns true if anything is subscribed to the pool
+// events, so they need making.
+func poolEventsSubscribed() bool {
+	return poolEvents.n.Load() > 0
+}
+
+// publishPoolEvent passes e to the functions subscribed.
+func publishPoolEvent(e PoolEvent) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	poolEvents.mu.Lock()
+	defer poolEvents.mu.Unlock()
+	for _, fn := range poolEvents.fns {
+		fn(e)
+	}
+}
@@ -0,0 +1,45 @@
+package drive
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolEvents(t *testing.T) {
+	assert.False(t, poolEventsSubscribed())
+	var events []PoolEvent
+	unsubscribe := SubscribePoolEvents(func(e PoolEvent) {
+		events = append(events, e)
+	})
+	assert.True(t, poolEventsSubscribed())
+
+	pool := newTestPool()
+	setFiles(pool, "/sa/1.json", "/sa/2.json", "/sa/3.json")
+	defer serviceAccountBlacklist.Delete("/sa/1.json")
+	_, err := pool.GetFile("/sa/1.json")
+	require.NoError(t, err)
+	pool.MarkDead("/sa/2.json", "deleted_client")
+	f := &Fs{
+		opt:                 Options{ServiceAccountFile: "/sa/3.json"},
+		ServiceAccountFiles: pool,
+	}
+	f.logSwitch("userRateLimitExceeded")
+
+	require.Len(t, events, 3)
+	assert.Equal(t, PoolEventBlacklist, events[0].Type)
+	assert.Equal(t, "1.json", events[0].SA)
+	assert.False(t, events[0].Until.IsZero())
+	assert.Equal(t, PoolEvent{Time: events[1].Time, Type: PoolEventDead, SA: "2.json", Reason: "deleted_client"}, events[1])
+	assert.Equal(t, PoolEvent{Time: events[2].Time, Type: PoolEventSwitch, SA: "3.json", Reason: "userRateLimitExceeded", Left: 1}, events[2])
+	for _, e := range events {
+		assert.False(t, e.Time.IsZero())
+	}
+
+	unsubscribe()
+	unsubscribe()
+	assert.False(t, poolEventsSubscribed())
+	pool.MarkDead("/sa/3.json", "deleted_client")
+	assert.Len(t, events, 3)
+}
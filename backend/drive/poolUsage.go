@@ -0,0 +1,40 @@
+// Pool usage for about
+//
+// about reports the quota of the account in use, which says nothing
+// about the pool a drive remote uploads with. PoolUsage is what about
+// adds for a remote with SAs: how many there are, how many are
+// blacklisted or dead, and an estimate of what they can still upload
+// today at saDailyQuota each, less what the state carried over from
+// earlier runs says they uploaded.
+package drive
+
+import (
+	"github.com/rclone/rclone/fs"
+)
+
+// PoolUsage is the pool-wide part of the about output.
+type PoolUsage struct {
+	ServiceAccounts int   `json:"serviceAccounts"` // SAs loaded
+	Blacklisted     int   `json:"blacklisted"`     // SAs resting after a rate limit
+	Dead            int   `json:"dead"`            // SAs which can never be used again
+	UploadLeft      int64 `json:"uploadLeft"`      // bytes the pool can still upload today
+	WithQuota       int   `json:"withQuota"`       // SAs with quota left today
+}
+
+// GetPoolUsage returns the usage of the pool of f, false if f isn't a
+// drive remote with SAs.
+func GetPoolUsage(f fs.Fs) (PoolUsage, bool) {
+	df, ok := f.(*Fs)
+	if !ok || df.ServiceAccountFiles == nil || df.ServiceAccountFiles.Len() == 0 {
+		return PoolUsage{}, false
+	}
+	pool := df.ServiceAccountFiles
+	h := pool.health()
+	u := PoolUsage{
+		ServiceAccounts: pool.Len(),
+		Blacklisted:     h.blacklisted,
+		Dead:            h.dead,
+	}
+	u.UploadLeft, u.WithQuota = pool.quotaLeft()
+	return u, true
+}
@@ -0,0 +1,45 @@
+package drive
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetPoolUsage(t *testing.T) {
+	gib := int64(fs.Gibi)
+	p := newTestPool()
+	setFiles(p, "usage-a.json", "usage-b.json", "usage-c.json", "usage-d.json")
+	p.uploaded["usage-a.json"] = 250 * gib
+	p.uploaded["usage-b.json"] = saDailyQuota
+	p.dead["usage-c.json"] = "deleted"
+	blacklistSA("usage-d.json", time.Now())
+	defer serviceAccountBlacklist.Delete("usage-d.json")
+
+	u, ok := GetPoolUsage(&Fs{ServiceAccountFiles: p})
+	require.True(t, ok)
+	assert.Equal(t, PoolUsage{
+		ServiceAccounts: 4,
+		Blacklisted:     1,
+		Dead:            1,
+		UploadLeft:      500 * gib,
+		WithQuota:       1,
+	}, u)
+
+	// No pool
+	_, ok = GetPoolUsage(&Fs{})
+	assert.False(t, ok)
+	_, ok = GetPoolUsage(&Fs{ServiceAccountFiles: newTestPool()})
+	assert.False(t, ok)
+
+	// Not a drive remote
+	f, err := mockfs.NewFs(context.Background(), "mock", "root", nil)
+	require.NoError(t, err)
+	_, ok = GetPoolUsage(f)
+	assert.False(t, ok)
+}
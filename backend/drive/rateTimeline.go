@@ -0,0 +1,196 @@
+// Rate limit timeline
+//
+// When throughput collapses part way through a long run, the stats only
+// say that it did. With rate_limit_timeline every backoff of the pacer
+// and every 403 Drive returns is counted per minute and per SA, and
+// written to a CSV file when the run ends:
+//
+//	minute,service_account,pacer_sleeps,pacer_sleep_seconds,errors_403,reasons
+//	2026-10-16T14:02:00Z,sa-045@project.iam.gserviceaccount.com,12,31.4,12,userRateLimitExceeded:12
+//
+// Each pacer is made for a single SA, so the SA of an event is the one
+// the pacer was made for. Fs instances writing to the same file share
+// the timeline, and each writes all of it as it shuts down.
+package drive
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/env"
+	"github.com/rclone/rclone/lib/pacer"
+	"google.golang.org/api/googleapi"
+)
+
+var (
+	rateTimelinesMu sync.Mutex
+	rateTimelines   = map[string]*rateTimeline{} // by file
+)
+
+// timelineKey identifies a bucket of the timeline.
+type timelineKey struct {
+	minute time.Time
+	sa     string // file of the SA, "" without one
+}
+
+// timelineBucket is what happened in one minute with one SA.
+type timelineBucket struct {
+	sleeps    int64            // backoffs of the pacer
+	sleep     time.Duration    // time slept in them
+	forbidden int64            // 403 errors
+	reasons   map[string]int64 // 403 errors by reason
+}
+
+// rateTimeline counts the rate limit events of a run.
+type rateTimeline struct {
+	file    string
+	mu      sync.Mutex
+	buckets map[timelineKey]*timelineBucket
+}
+
+// newRateTimeline returns the timeline written to file, nil if file is
+// empty.
+func newRateTimeline(file string) *rateTimeline {
+	if file == "" {
+		return nil
+	}
+	file = env.ShellExpand(file)
+	rateTimelinesMu.Lock()
+	defer rateTimelinesMu.Unlock()
+	t, ok := rateTimelines[file]
+	if !ok {
+		t = &rateTimeline{
+			file:    file,
+			buckets: make(map[timelineKey]*timelineBucket),
+		}
+		rateTimelines[file] = t
+	}
+	return t
+}
+
+// record records the outcome of a pacer call made with sa which slept
+// sleep before the next.
+func (t *rateTimeline) record(at time.Time, sa string, state pacer.State, sleep time.Duration) {
+	var gerr *googleapi.Error
+	forbidden := errors.As(state.LastError, &gerr) && gerr.Code == 403
+	if state.ConsecutiveRetries == 0 && !forbidden {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := timelineKey{minute: at.Truncate(time.Minute), sa: sa}
+	b, ok := t.buckets[key]
+	if !ok {
+		b = &timelineBucket{reasons: make(map[string]int64)}
+		t.buckets[key] = b
+	}
+	if state.ConsecutiveRetries > 0 {
+		b.sleeps++
+		b.sleep += sleep
+	}
+	if forbidden {
+		b.forbidden++
+		reason := "unknown"
+		if len(gerr.Errors) > 0 && gerr.Errors[0].Reason != "" {
+			reason = gerr.Errors[0].Reason
+		}
+		b.reasons[reason]++
+	}
+}
+
+// timelineCalculator is a pacer calculator recording what it calculates
+// on a timeline.
+type timelineCalculator struct {
+	pacer.Calculator
+	timeline *rateTimeline
+	sa       string
+}
+
+// Calculate implements pacer.Calculator.
+func (c *timelineCalculator) Calculate(state pacer.State) time.Duration {
+	sleep := c.Calculator.Calculate(state)
+	c.timeline.record(time.Now(), c.sa, state, sleep)
+	return sleep
+}
+
+// calculator returns calculator recording on the timeline what happens
+// with sa.
+func (t *rateTimeline) calculator(calculator pacer.Calculator, sa string) pacer.Calculator {
+	if t == nil {
+		return calculator
+	}
+	return &timelineCalculator{Calculator: calculator, timeline: t, sa: sa}
+}
+
+// rows returns the CSV rows of the timeline, header first.
+func (t *rateTimeline) rows() [][]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	keys := make([]timelineKey, 0, len(t.buckets))
+	for key := range t.buckets {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].minute.Equal(keys[j].minute) {
+			return keys[i].minute.Before(keys[j].minute)
+		}
+		return keys[i].sa < keys[j].sa
+	})
+	names := map[string]string{}
+	rows := [][]string{{"minute", "service_account", "pacer_sleeps", "pacer_sleep_seconds", "errors_403", "reasons"}}
+	for _, key := range keys {
+		b := t.buckets[key]
+		name, ok := names[key.sa]
+		if !ok && key.sa != "" {
+			name = serviceAccountEmail(key.sa)
+			if name == "" {
+				name = filepath.Base(key.sa)
+			}
+			names[key.sa] = name
+		}
+		reasons := make([]string, 0, len(b.reasons))
+		for reason, n := range b.reasons {
+			reasons = append(reasons, fmt.Sprintf("%s:%d", reason, n))
+		}
+		sort.Strings(reasons)
+		rows = append(rows, []string{
+			key.minute.UTC().Format(time.RFC3339),
+			name,
+			strconv.FormatInt(b.sleeps, 10),
+			strconv.FormatFloat(b.sleep.Seconds(), 'f', 1, 64),
+			strconv.FormatInt(b.forbidden, 10),
+			strings.Join(reasons, ";"),
+		})
+	}
+	return rows
+}
+
+// write writes the timeline to its file.
+func (t *rateTimeline) write() error {
+	if t == nil {
+		return nil
+	}
+	out, err := os.Create(t.file)
+	if err != nil {
+		return fmt.Errorf("failed to write rate limit timeline: %w", err)
+	}
+	w := csv.NewWriter(out)
+	err = w.WriteAll(t.rows())
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write rate limit timeline: %w", err)
+	}
+	fs.Infof(nil, "Wrote rate limit timeline to %q", t.file)
+	return nil
+}
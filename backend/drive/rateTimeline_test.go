@@ -0,0 +1,64 @@
+package drive
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/lib/pacer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+)
+
+// fixedCalculator always sleeps the same
+type fixedCalculator time.Duration
+
+func (c fixedCalculator) Calculate(state pacer.State) time.Duration {
+	return time.Duration(c)
+}
+
+func TestRateTimeline(t *testing.T) {
+	const a = "bundle:a@p.iam.gserviceaccount.com"
+	serviceAccountCredentials.Store(a, []byte(`{"client_email":"a@p.iam.gserviceaccount.com"}`))
+	defer serviceAccountCredentials.Delete(a)
+
+	assert.Nil(t, newRateTimeline(""))
+	var none *rateTimeline
+	assert.Equal(t, fixedCalculator(0), none.calculator(fixedCalculator(0), a))
+	assert.NoError(t, none.write())
+
+	file := filepath.Join(t.TempDir(), "timeline.csv")
+	timeline := newRateTimeline(file)
+	assert.Same(t, timeline, newRateTimeline(file))
+
+	rateLimit := &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}}}
+	minute := time.Date(2026, 10, 16, 14, 2, 0, 0, time.UTC)
+	timeline.record(minute.Add(10*time.Second), a, pacer.State{ConsecutiveRetries: 1, LastError: rateLimit}, 2*time.Second)
+	timeline.record(minute.Add(20*time.Second), a, pacer.State{ConsecutiveRetries: 2, LastError: rateLimit}, 1500*time.Millisecond)
+	timeline.record(minute.Add(30*time.Second), a, pacer.State{LastError: &googleapi.Error{Code: 403}}, 0)
+	timeline.record(minute.Add(40*time.Second), "/sa/b.json", pacer.State{ConsecutiveRetries: 1, LastError: errors.New("EOF")}, time.Second)
+	// Calls which succeeded or failed for good otherwise aren't recorded
+	timeline.record(minute, a, pacer.State{}, 100*time.Millisecond)
+	timeline.record(minute, a, pacer.State{LastError: &googleapi.Error{Code: 404}}, 100*time.Millisecond)
+	timeline.record(minute.Add(time.Minute), "", pacer.State{ConsecutiveRetries: 1}, time.Second)
+
+	// The calculator records what it returns
+	calculator := timeline.calculator(fixedCalculator(time.Second), a)
+	assert.Equal(t, time.Second, calculator.Calculate(pacer.State{ConsecutiveRetries: 1, LastError: rateLimit}))
+
+	rows := timeline.rows()
+	require.Len(t, rows, 5)
+	assert.Equal(t, []string{"minute", "service_account", "pacer_sleeps", "pacer_sleep_seconds", "errors_403", "reasons"}, rows[0])
+	assert.Equal(t, []string{"2026-10-16T14:02:00Z", "b.json", "1", "1.0", "0", ""}, rows[1])
+	assert.Equal(t, []string{"2026-10-16T14:02:00Z", "a@p.iam.gserviceaccount.com", "2", "3.5", "3", "unknown:1;userRateLimitExceeded:2"}, rows[2])
+	assert.Equal(t, []string{"2026-10-16T14:03:00Z", "", "1", "1.0", "0", ""}, rows[3])
+	assert.Equal(t, "a@p.iam.gserviceaccount.com", rows[4][1])
+
+	require.NoError(t, timeline.write())
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "2026-10-16T14:02:00Z,a@p.iam.gserviceaccount.com,2,3.5,3,unknown:1;userRateLimitExceeded:2\n")
+}
@@ -0,0 +1,329 @@
+// Listing and restoring revisions
+//
+// After a mass overwrite, by ransomware or a sync run the wrong way, the
+// previous content of every file is still there as an older revision,
+// but Drive only lets it be restored one file at a time in the web UI.
+//
+// The revisions command lists the revisions of a file, or of every file
+// under a directory, and with -o restore uploads the one picked as a new
+// head revision, or with -o download=DIR saves it locally instead. The
+// revision is given by ID for a single file, or with -o before=TIME as
+// the newest one modified before that time, files not changed since
+// being left alone. The files are done --checkers at a time, each with
+// the next preloaded SA of the pool, and a restore is checked against
+// the MD5 of the revision.
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/walk"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// Actions of the revisions command
+const (
+	revisionRestored   = "restored"
+	revisionDownloaded = "downloaded"
+	revisionUnchanged  = "unchanged"
+)
+
+// fileRevision is a revision of a file
+type fileRevision struct {
+	ID           string `json:"id"`
+	ModifiedTime string `json:"modified_time"`
+	Size         int64  `json:"size"`
+	MD5          string `json:"md5,omitempty"`
+	KeepForever  bool   `json:"keep_forever,omitempty"`
+	ModifiedBy   string `json:"modified_by,omitempty"`
+}
+
+// revisionsResult is what the revisions command found or did for a file
+type revisionsResult struct {
+	Path      string         `json:"path"`
+	Revisions []fileRevision `json:"revisions,omitempty"` // all of them, when listing
+	Revision  string         `json:"revision,omitempty"`  // ID of the one picked
+	Action    string         `json:"action,omitempty"`    // revisionRestored, revisionDownloaded or revisionUnchanged
+	Error     string         `json:"error,omitempty"`
+}
+
+// revisionsOptions are the options of the revisions command
+type revisionsOptions struct {
+	revision string    // ID of the revision to pick
+	before   time.Time // pick the newest revision modified before this
+	restore  bool      // upload the revision picked as the head revision
+	download string    // save the revision picked under this local directory
+}
+
+// parseRevisionsOptions parses the options of the revisions command.
+func parseRevisionsOptions(opt map[string]string) (o revisionsOptions, err error) {
+	o.revision = opt["revision"]
+	if before, ok := opt["before"]; ok {
+		o.before, err = fs.ParseTime(before)
+		if err != nil {
+			return o, fmt.Errorf("bad before: %w", err)
+		}
+	}
+	_, o.restore = opt["restore"]
+	o.download = opt["download"]
+	if o.revision != "" && !o.before.IsZero() {
+		return o, errors.New("can't pick a revision both by ID and by time")
+	}
+	if (o.restore || o.download != "") && o.revision == "" && o.before.IsZero() {
+		return o, errors.New("need -o revision=ID or -o before=TIME to pick the revision")
+	}
+	if o.restore && o.download != "" {
+		return o, errors.New("can't both restore and download")
+	}
+	return o, nil
+}
+
+// pickRevision returns the revision picked by opt from revisions, listed
+// oldest first, or nil if that is the head revision.
+func pickRevision(revisions []*drive.Revision, opt revisionsOptions) (*drive.Revision, error) {
+	var picked *drive.Revision
+	if opt.revision != "" {
+		for _, revision := range revisions {
+			if revision.Id == opt.revision {
+				picked = revision
+			}
+		}
+		if picked == nil {
+			return nil, fmt.Errorf("no revision %q", opt.revision)
+		}
+	} else {
+		for _, revision := range revisions {
+			modified, err := time.Parse(time.RFC3339, revision.ModifiedTime)
+			if err != nil {
+				return nil, fmt.Errorf("bad modified time of revision %q: %w", revision.Id, err)
+			}
+			if modified.Before(opt.before) {
+				picked = revision
+			}
+		}
+		if picked == nil {
+			return nil, fmt.Errorf("no revision before %v", opt.before.Format(time.RFC3339))
+		}
+	}
+	if picked == revisions[len(revisions)-1] {
+		return nil, nil
+	}
+	return picked, nil
+}
+
+// listRevisions returns the revisions of the file with id, oldest first.
+func (f *Fs) listRevisions(ctx context.Context, svc *drive.Service, id string) (revisions []*drive.Revision, err error) {
+	err = f.pacer.Call(func() (bool, error) {
+		revisions = nil
+		list := svc.Revisions.List(id).
+			Fields("revisions(id,modifiedTime,size,md5Checksum,keepForever,lastModifyingUser(emailAddress)),nextPageToken")
+		err := list.Pages(ctx, func(page *drive.RevisionList) error {
+			revisions = append(revisions, page.Revisions...)
+			return nil
+		})
+		return f.shouldRetry(ctx, err)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list revisions: %w", err)
+	}
+	if len(revisions) == 0 {
+		return nil, errors.New("no revisions")
+	}
+	return revisions, nil
+}
+
+// openRevision returns the content of revision of the file with id.
+func (f *Fs) openRevision(ctx context.Context, svc *drive.Service, id string, revision *drive.Revision) (body io.ReadCloser, err error) {
+	var res *http.Response
+	err = f.pacer.Call(func() (bool, error) {
+		res, err = svc.Revisions.Get(id, revision.Id).Context(ctx).Download()
+		return f.shouldRetry(ctx, err)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download revision %q: %w", revision.Id, err)
+	}
+	return res.Body, nil
+}
+
+// restoreRevision uploads revision of o as its new head revision with
+// svc, checking its MD5.
+func (f *Fs) restoreRevision(ctx context.Context, svc *drive.Service, o *Object, revision *drive.Revision) (err error) {
+	id := actualID(o.id)
+	body, err := f.openRevision(ctx, svc, id, revision)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(body, &err)
+	var info *drive.File
+	err = f.pacer.CallNoRetry(func() (bool, error) {
+		info, err = svc.Files.Update(id, &drive.File{ModifiedTime: revision.ModifiedTime}).
+			Media(body, googleapi.ChunkSize(int(f.opt.ChunkSize))).
+			Fields("id,md5Checksum").
+			SupportsAllDrives(true).
+			KeepRevisionForever(f.opt.KeepRevisionForever).
+			Context(ctx).Do()
+		return f.shouldRetry(ctx, err)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload revision %q: %w", revision.Id, err)
+	}
+	if revision.Md5Checksum != "" && info.Md5Checksum != revision.Md5Checksum {
+		return fmt.Errorf("restored MD5 %q differs from the MD5 %q of revision %q", info.Md5Checksum, revision.Md5Checksum, revision.Id)
+	}
+	return nil
+}
+
+// downloadRevision saves revision of o under dir, with its modification
+// time.
+func (f *Fs) downloadRevision(ctx context.Context, svc *drive.Service, o *Object, revision *drive.Revision, dir string) (err error) {
+	body, err := f.openRevision(ctx, svc, actualID(o.id), revision)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(body, &err)
+	file := filepath.Join(dir, filepath.FromSlash(o.remote))
+	if err = os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+		return err
+	}
+	out, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, body)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save revision %q: %w", revision.Id, err)
+	}
+	if modified, err := time.Parse(time.RFC3339, revision.ModifiedTime); err == nil {
+		_ = os.Chtimes(file, modified, modified)
+	}
+	return nil
+}
+
+// fileRevisions does the revisions command for o with svc.
+func (f *Fs) fileRevisions(ctx context.Context, svc *drive.Service, o *Object, opt revisionsOptions) (result revisionsResult, err error) {
+	result.Path = o.remote
+	revisions, err := f.listRevisions(ctx, svc, actualID(o.id))
+	if err != nil {
+		return result, err
+	}
+	if opt.revision == "" && opt.before.IsZero() {
+		for _, revision := range revisions {
+			r := fileRevision{
+				ID:           revision.Id,
+				ModifiedTime: revision.ModifiedTime,
+				Size:         revision.Size,
+				MD5:          revision.Md5Checksum,
+				KeepForever:  revision.KeepForever,
+			}
+			if revision.LastModifyingUser != nil {
+				r.ModifiedBy = revision.LastModifyingUser.EmailAddress
+			}
+			result.Revisions = append(result.Revisions, r)
+		}
+		return result, nil
+	}
+	picked, err := pickRevision(revisions, opt)
+	if err != nil {
+		return result, err
+	}
+	if picked == nil {
+		result.Revision, result.Action = revisions[len(revisions)-1].Id, revisionUnchanged
+		return result, nil
+	}
+	result.Revision = picked.Id
+	switch {
+	case opt.restore && f.ci.DryRun:
+		fs.Logf(o, "Not restoring revision %s from %s as --dry-run is set", picked.Id, picked.ModifiedTime)
+	case opt.restore:
+		if err = f.restoreRevision(ctx, svc, o, picked); err != nil {
+			return result, err
+		}
+		result.Action = revisionRestored
+		fs.Infof(o, "Restored revision %s from %s", picked.Id, picked.ModifiedTime)
+	case opt.download != "":
+		if err = f.downloadRevision(ctx, svc, o, picked, opt.download); err != nil {
+			return result, err
+		}
+		result.Action = revisionDownloaded
+		fs.Infof(o, "Downloaded revision %s from %s", picked.Id, picked.ModifiedTime)
+	}
+	return result, nil
+}
+
+// revisionsCommand lists or restores the revisions of the file, or the
+// files under the directory, given.
+func (f *Fs) revisionsCommand(ctx context.Context, arg []string, opt map[string]string) ([]revisionsResult, error) {
+	options, err := parseRevisionsOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	remote := ""
+	if len(arg) > 0 {
+		remote = arg[0]
+	}
+	var objects []*Object
+	o, err := f.NewObject(ctx, remote)
+	switch {
+	case err == nil:
+		do, ok := o.(*Object)
+		if !ok {
+			return nil, errors.New("the revisions of Google docs can't be restored")
+		}
+		objects = append(objects, do)
+	case errors.Is(err, fs.ErrorObjectNotFound), errors.Is(err, fs.ErrorIsDir), errors.Is(err, fs.ErrorNotAFile):
+		if options.revision != "" {
+			return nil, errors.New("a revision can only be picked by ID for a single file")
+		}
+		err = walk.ListR(ctx, f, remote, true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+			for _, entry := range entries {
+				if do, ok := entry.(*Object); ok && !do.split {
+					objects = append(objects, do)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+	results := make([]revisionsResult, len(objects))
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(f.ci.Checkers)
+	for i, o := range objects {
+		svc, err := f.ServiceAccountFiles.GetService()
+		if err != nil {
+			svc = f.svc
+		}
+		g.Go(func() error {
+			result, err := f.fileRevisions(gCtx, svc, o, options)
+			if err != nil {
+				if gCtx.Err() != nil {
+					return gCtx.Err()
+				}
+				fs.Errorf(o, "Revisions: %v", err)
+				result.Error = err.Error()
+			}
+			results[i] = result
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
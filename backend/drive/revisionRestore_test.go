@@ -0,0 +1,142 @@
+package drive
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/pacer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+func TestParseRevisionsOptions(t *testing.T) {
+	opt, err := parseRevisionsOptions(map[string]string{})
+	require.NoError(t, err)
+	assert.Equal(t, revisionsOptions{}, opt)
+
+	opt, err = parseRevisionsOptions(map[string]string{"before": "2026-10-14T08:00:00Z", "restore": ""})
+	require.NoError(t, err)
+	assert.True(t, opt.restore)
+	assert.Equal(t, time.Date(2026, 10, 14, 8, 0, 0, 0, time.UTC), opt.before.UTC())
+
+	for _, bad := range []map[string]string{
+		{"before": "soon"},
+		{"before": "1h", "revision": "r1"},
+		{"restore": ""},
+		{"download": "/tmp"},
+		{"revision": "r1", "restore": "", "download": "/tmp"},
+	} {
+		_, err = parseRevisionsOptions(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestPickRevision(t *testing.T) {
+	revisions := []*drive.Revision{
+		{Id: "r1", ModifiedTime: "2026-10-01T00:00:00Z"},
+		{Id: "r2", ModifiedTime: "2026-10-10T00:00:00Z"},
+		{Id: "r3", ModifiedTime: "2026-10-14T09:00:00Z"},
+	}
+	at := func(s string) time.Time {
+		tm, err := time.Parse(time.RFC3339, s)
+		require.NoError(t, err)
+		return tm
+	}
+	picked, err := pickRevision(revisions, revisionsOptions{before: at("2026-10-14T08:00:00Z")})
+	require.NoError(t, err)
+	assert.Equal(t, "r2", picked.Id)
+	picked, err = pickRevision(revisions, revisionsOptions{revision: "r1"})
+	require.NoError(t, err)
+	assert.Equal(t, "r1", picked.Id)
+
+	// Unchanged since
+	picked, err = pickRevision(revisions, revisionsOptions{before: at("2026-10-15T00:00:00Z")})
+	require.NoError(t, err)
+	assert.Nil(t, picked)
+
+	_, err = pickRevision(revisions, revisionsOptions{before: at("2026-09-01T00:00:00Z")})
+	assert.Error(t, err)
+	_, err = pickRevision(revisions, revisionsOptions{revision: "r9"})
+	assert.Error(t, err)
+}
+
+func TestFileRevisions(t *testing.T) {
+	ctx := context.Background()
+	old, current := []byte("old content"), []byte("encrypted!!")
+	var uploaded []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/files/id1/revisions":
+			_ = json.NewEncoder(w).Encode(drive.RevisionList{Revisions: []*drive.Revision{
+				{Id: "r1", ModifiedTime: "2026-10-01T00:00:00Z", Size: int64(len(old)), Md5Checksum: fmt.Sprintf("%x", md5.Sum(old)),
+					LastModifyingUser: &drive.User{EmailAddress: "me@example.com"}},
+				{Id: "r2", ModifiedTime: "2026-10-14T09:00:00Z", Size: int64(len(current)), Md5Checksum: fmt.Sprintf("%x", md5.Sum(current))},
+			}})
+		case r.Method == http.MethodGet && r.URL.Path == "/files/id1/revisions/r1":
+			_, _ = w.Write(old)
+		case r.Method == http.MethodPatch:
+			_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			require.NoError(t, err)
+			mr := multipart.NewReader(r.Body, params["boundary"])
+			part, err := mr.NextPart()
+			require.NoError(t, err)
+			var info drive.File
+			require.NoError(t, json.NewDecoder(part).Decode(&info))
+			assert.Equal(t, "2026-10-01T00:00:00Z", info.ModifiedTime)
+			part, err = mr.NextPart()
+			require.NoError(t, err)
+			uploaded, err = io.ReadAll(part)
+			require.NoError(t, err)
+			_ = json.NewEncoder(w).Encode(drive.File{Id: "id1", Md5Checksum: fmt.Sprintf("%x", md5.Sum(uploaded))})
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL)
+		}
+	}))
+	defer srv.Close()
+	svc, err := drive.NewService(ctx, option.WithHTTPClient(srv.Client()), option.WithEndpoint(srv.URL+"/"))
+	require.NoError(t, err)
+	f := &Fs{
+		svc:   svc,
+		ci:    fs.GetConfig(ctx),
+		pacer: fs.NewPacer(ctx, pacer.NewGoogleDrive(pacer.MinSleep(time.Millisecond))),
+	}
+	f.opt.ChunkSize = fs.SizeSuffix(fs.Mebi)
+	o := &Object{baseObject: baseObject{fs: f, id: "id1", remote: "dir/file.txt"}}
+
+	result, err := f.fileRevisions(ctx, svc, o, revisionsOptions{})
+	require.NoError(t, err)
+	require.Len(t, result.Revisions, 2)
+	assert.Equal(t, "me@example.com", result.Revisions[0].ModifiedBy)
+
+	before := time.Date(2026, 10, 14, 8, 0, 0, 0, time.UTC)
+	result, err = f.fileRevisions(ctx, svc, o, revisionsOptions{before: before, restore: true})
+	require.NoError(t, err)
+	assert.Equal(t, revisionsResult{Path: "dir/file.txt", Revision: "r1", Action: revisionRestored}, result)
+	assert.Equal(t, old, uploaded)
+
+	dir := t.TempDir()
+	result, err = f.fileRevisions(ctx, svc, o, revisionsOptions{revision: "r1", download: dir})
+	require.NoError(t, err)
+	assert.Equal(t, revisionDownloaded, result.Action)
+	data, err := os.ReadFile(filepath.Join(dir, "dir", "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, old, data)
+
+	result, err = f.fileRevisions(ctx, svc, o, revisionsOptions{before: time.Now(), restore: true})
+	require.NoError(t, err)
+	assert.Equal(t, revisionUnchanged, result.Action)
+}
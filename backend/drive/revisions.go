@@ -0,0 +1,105 @@
+// Comparing files by Drive revision
+//
+// copy and sync decide whether a file changed by its size and
+// modification time, so an edit in place which keeps both is missed, and
+// a modification time which drifted makes the file go again although it
+// hasn't changed. Drive gives every file a head revision ID, or for
+// Google Docs a version, which changes when, and only when, its content
+// does. With copy and sync --compare-revision the revision of the source
+// file is recorded in the appProperties of its copy, and later runs
+// compare that with the revision of the source instead.
+//
+// EnableRevisions makes listings return the revisions and the recorded
+// source revisions, and SetSourceRevision records one.
+package drive
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/rclone/rclone/fs"
+	"google.golang.org/api/drive/v3"
+)
+
+// sourceRevisionProperty is the appProperty holding the revision of the
+// source of a file.
+const sourceRevisionProperty = "ecloneSourceRevision"
+
+// EnableRevisions makes the listings of f return the revisions of files
+// from now on, returning false if f isn't a drive remote.
+func EnableRevisions(f fs.Fs) bool {
+	df, ok := f.(*Fs)
+	if ok {
+		df.revisions = true
+	}
+	return ok
+}
+
+// noteRevision sets the revisions of o from info, if listed.
+func (f *Fs) noteRevision(o *baseObject, info *drive.File) {
+	if !f.revisions {
+		return
+	}
+	o.revision = info.HeadRevisionId
+	if o.revision == "" && info.Version != 0 {
+		o.revision = "v" + strconv.FormatInt(info.Version, 10)
+	}
+	o.sourceRevision = info.AppProperties[sourceRevisionProperty]
+}
+
+// base returns the baseObject of o, nil if o isn't a drive file.
+func base(o fs.Object) *baseObject {
+	switch o := o.(type) {
+	case *Object:
+		return &o.baseObject
+	case *documentObject:
+		return &o.baseObject
+	case *linkObject:
+		return &o.baseObject
+	}
+	return nil
+}
+
+// Revision returns the head revision ID, or version, of the drive file
+// o, "" if it isn't known.
+func Revision(o fs.Object) string {
+	if b := base(o); b != nil {
+		return b.revision
+	}
+	return ""
+}
+
+// SourceRevision returns the revision of the source recorded on the
+// drive file o, "" if there is none.
+func SourceRevision(o fs.Object) string {
+	if b := base(o); b != nil {
+		return b.sourceRevision
+	}
+	return ""
+}
+
+// SetSourceRevision records revision as that of the source of the drive
+// file o, keeping its modification time.
+func SetSourceRevision(ctx context.Context, o fs.Object, revision string) error {
+	b := base(o)
+	if b == nil {
+		return fmt.Errorf("can't record the source revision of %v: not a drive file", o)
+	}
+	updateInfo := &drive.File{
+		ModifiedTime:  b.modifiedDate,
+		AppProperties: map[string]string{sourceRevisionProperty: revision},
+	}
+	err := b.fs.pacer.Call(func() (bool, error) {
+		_, err := b.fs.svc.Files.Update(actualID(b.id), updateInfo).
+			Fields("id").
+			SupportsAllDrives(true).
+			Context(ctx).Do()
+		return b.fs.shouldRetry(ctx, err)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record the source revision of %v: %w", o, err)
+	}
+	b.sourceRevision = revision
+	return nil
+}
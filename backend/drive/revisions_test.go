@@ -0,0 +1,75 @@
+package drive
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/rclone/rclone/lib/pacer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+func TestNoteRevision(t *testing.T) {
+	ctx := context.Background()
+	f := &Fs{}
+	info := &drive.File{
+		HeadRevisionId: "rev1",
+		Version:        7,
+		AppProperties:  map[string]string{sourceRevisionProperty: "src1"},
+	}
+	var o baseObject
+	f.noteRevision(&o, info)
+	assert.Equal(t, "", o.revision)
+	assert.NotContains(t, string(f.getFileFields(ctx)), "headRevisionId")
+
+	assert.True(t, EnableRevisions(f))
+	assert.False(t, EnableRevisions(nil))
+	assert.Contains(t, string(f.getFileFields(ctx)), ",appProperties,headRevisionId,version")
+	f.noteRevision(&o, info)
+	assert.Equal(t, "rev1", o.revision)
+	assert.Equal(t, "src1", o.sourceRevision)
+
+	// Docs have no head revision
+	f.noteRevision(&o, &drive.File{Version: 7})
+	assert.Equal(t, "v7", o.revision)
+	assert.Equal(t, "", o.sourceRevision)
+
+	doc := &documentObject{baseObject: o}
+	assert.Equal(t, "v7", Revision(doc))
+	assert.Equal(t, "", Revision(mockobject.Object("file")))
+	assert.Equal(t, "", SourceRevision(mockobject.Object("file")))
+}
+
+func TestSetSourceRevision(t *testing.T) {
+	ctx := context.Background()
+	var got drive.File
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPatch, r.Method)
+		assert.Equal(t, "/files/id1", r.URL.Path)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		_, _ = w.Write([]byte(`{"id":"id1"}`))
+	}))
+	defer srv.Close()
+	svc, err := drive.NewService(ctx, option.WithHTTPClient(srv.Client()), option.WithEndpoint(srv.URL+"/"))
+	require.NoError(t, err)
+	f := &Fs{
+		svc:   svc,
+		ci:    fs.GetConfig(ctx),
+		pacer: fs.NewPacer(ctx, pacer.NewGoogleDrive(pacer.MinSleep(time.Millisecond))),
+	}
+	o := &Object{baseObject: baseObject{fs: f, id: "id1", modifiedDate: "2026-01-02T03:04:05.000Z"}}
+	require.NoError(t, SetSourceRevision(ctx, o, "rev2"))
+	assert.Equal(t, "rev2", SourceRevision(o))
+	assert.Equal(t, map[string]string{sourceRevisionProperty: "rev2"}, got.AppProperties)
+	assert.Equal(t, "2026-01-02T03:04:05.000Z", got.ModifiedTime)
+
+	assert.Error(t, SetSourceRevision(ctx, mockobject.Object("file"), "rev2"))
+}
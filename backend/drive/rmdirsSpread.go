@@ -0,0 +1,251 @@
+// Spreading rmdirs over the pool
+//
+// rmdirs removes empty directories one at a time, deepest first, each
+// after listing it to check it is empty, and all with the SA in use.
+// Cleaning up a deep tree of thousands of folders that way crawls.
+//
+// SpreadRmdirs lists the tree once instead and removes only the top of
+// each empty subtree: Drive removes a folder together with everything in
+// it, so one call takes out a whole tree of empty folders. The calls are
+// made --checkers at a time, each with the next preloaded SA of the pool,
+// so no single SA carries the rate limits.
+//
+// The listing leaves out what the remote hides (skipped gdocs, objects of
+// other owners, split parts...), so before each tree goes it is listed
+// again with no filtering at all, like Rmdir does, and kept if anything
+// but folders is found in it.
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/walk"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/api/drive/v3"
+)
+
+// emptyDir is the top of a tree of empty directories
+type emptyDir struct {
+	remote string
+	id     string
+}
+
+// emptyDirTops lists dir and returns the tops of its empty trees.
+func (f *Fs) emptyDirTops(ctx context.Context, dir string, leaveRoot bool) ([]emptyDir, error) {
+	rootID, err := f.dirCache.FindDir(ctx, dir, false)
+	if err != nil {
+		return nil, err
+	}
+	var all fs.DirEntries
+	err = walk.ListR(ctx, f, dir, true, -1, walk.ListAll, func(entries fs.DirEntries) error {
+		all = append(all, entries...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return emptyTrees(f.root, dir, rootID, leaveRoot, all), nil
+}
+
+// emptyTrees returns the directories in entries, found under dir with ID
+// dirID, which have no files below them but whose parent has. dir itself
+// is returned if it is empty, unless leaveRoot is set.
+func emptyTrees(root, dir, dirID string, leaveRoot bool, entries fs.DirEntries) []emptyDir {
+	ids := map[string]string{dir: dirID}
+	empty := map[string]bool{dir: !leaveRoot}
+	keep := func(remote string) {
+		for remote != dir {
+			remote = parentDir(remote)
+			empty[remote] = false
+		}
+	}
+	for _, entry := range entries {
+		d, isDir := entry.(fs.Directory)
+		if !isDir || isShortcutID(d.ID()) {
+			// Shortcuts are left alone like files
+			keep(entry.Remote())
+			continue
+		}
+		ids[d.Remote()] = d.ID()
+		if _, ok := empty[d.Remote()]; !ok {
+			empty[d.Remote()] = true
+		}
+	}
+	var tops []emptyDir
+	for remote, isEmpty := range empty {
+		if !isEmpty || (remote != dir && empty[parentDir(remote)]) {
+			continue
+		}
+		if path.Join(root, remote) == "" {
+			// The root of the drive can't be removed
+			continue
+		}
+		tops = append(tops, emptyDir{remote: remote, id: actualID(ids[remote])})
+	}
+	sort.Slice(tops, func(i, j int) bool { return tops[i].remote < tops[j].remote })
+	return tops
+}
+
+// parentDir returns the directory holding remote, "" for the root.
+func parentDir(remote string) string {
+	parent := path.Dir(remote)
+	if parent == "." {
+		return ""
+	}
+	return parent
+}
+
+// errTreeNotEmpty is returned by checkEmptyTree for a tree with files
+var errTreeNotEmpty = errors.New("directory tree contains files hidden from the listing")
+
+// checkEmptyTree lists the tree of directories with ID id with svc and no
+// filtering, returning errTreeNotEmpty if there is anything but folders
+// in it, and whether there are trashed items in it.
+func (f *Fs) checkEmptyTree(ctx context.Context, svc *drive.Service, id string) (trashed bool, err error) {
+	dirs := []string{id}
+	for len(dirs) > 0 {
+		n := min(len(dirs), listRGrouping)
+		query := make([]string, n)
+		for i, dirID := range dirs[:n] {
+			query[i] = fmt.Sprintf("'%s' in parents", dirID)
+		}
+		dirs = dirs[n:]
+		list := svc.Files.List().
+			Q("(" + strings.Join(query, " or ") + ")").
+			Fields("nextPageToken,files(id,name,mimeType,trashed)").
+			SupportsAllDrives(true).
+			IncludeItemsFromAllDrives(true)
+		if f.isTeamDrive {
+			list.DriveId(f.opt.TeamDriveID).Corpora("drive")
+		}
+		err = list.Pages(ctx, func(files *drive.FileList) error {
+			for _, item := range files.Files {
+				switch {
+				case item.Trashed:
+					trashed = true
+				case item.MimeType == driveFolderType:
+					dirs = append(dirs, item.Id)
+				default:
+					fs.Debugf(nil, "Rmdirs: %q found in directory tree", item.Name)
+					return errTreeNotEmpty
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return trashed, err
+		}
+	}
+	return trashed, nil
+}
+
+// removeEmptyDir removes the directory with ID id and everything in it
+// with svc, trashing it if trash is set.
+func (f *Fs) removeEmptyDir(ctx context.Context, svc *drive.Service, id string, trash bool) error {
+	return f.pacer.Call(func() (bool, error) {
+		var err error
+		if trash {
+			_, err = svc.Files.Update(id, &drive.File{Trashed: true}).
+				Fields("").
+				SupportsAllDrives(true).
+				Context(ctx).Do()
+		} else {
+			err = svc.Files.Delete(id).
+				SupportsAllDrives(true).
+				Context(ctx).Do()
+		}
+		return f.shouldRetry(ctx, err)
+	})
+}
+
+// SpreadRmdirs removes the empty directories under dir in f, and dir
+// itself unless leaveRoot is set, like operations.Rmdirs, spreading the
+// calls over the preloaded SAs of the pool.
+func SpreadRmdirs(ctx context.Context, f fs.Fs, dir string, leaveRoot bool) error {
+	df, ok := f.(*Fs)
+	if !ok {
+		return errors.New("spreading rmdirs over service accounts needs a drive remote")
+	}
+	return df.spreadRmdirs(ctx, dir, leaveRoot)
+}
+
+// spreadRmdirs implements SpreadRmdirs.
+func (f *Fs) spreadRmdirs(ctx context.Context, dir string, leaveRoot bool) error {
+	tops, err := f.emptyDirTops(ctx, dir, leaveRoot)
+	if err != nil {
+		return err
+	}
+	return f.removeEmptyTrees(ctx, tops)
+}
+
+// removeEmptyTrees removes tops, each with the next preloaded SA.
+func (f *Fs) removeEmptyTrees(ctx context.Context, tops []emptyDir) error {
+	preloaded := f.ServiceAccountFiles.Preloaded()
+	if preloaded == 0 {
+		fs.Logf(f, "No preloaded service accounts - removing empty directories with the one in use")
+	}
+	fs.Infof(f, "Removing %d empty directory trees with %d service accounts", len(tops), max(preloaded, 1))
+	var removed, failed atomic.Int64
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(f.ci.Checkers)
+	for _, top := range tops {
+		if f.ci.DryRun {
+			fs.Logf(top.remote, "Not removing empty directory tree as --dry-run is set")
+			continue
+		}
+		svc, err := f.ServiceAccountFiles.GetService()
+		if err != nil {
+			svc = f.svc
+		}
+		g.Go(func() error {
+			var trashed bool
+			err := f.pacer.Call(func() (bool, error) {
+				var err error
+				trashed, err = f.checkEmptyTree(gCtx, svc, top.id)
+				if errors.Is(err, errTreeNotEmpty) {
+					return false, err
+				}
+				return f.shouldRetry(gCtx, err)
+			})
+			if errors.Is(err, errTreeNotEmpty) {
+				fs.Errorf(top.remote, "Not removing directory tree: %v", err)
+				failed.Add(1)
+				return nil
+			}
+			if err == nil {
+				// Trashed items go to the trash with the tree, as Rmdir does
+				err = f.removeEmptyDir(gCtx, svc, top.id, trashed || f.opt.UseTrash)
+			}
+			if err != nil {
+				if gCtx.Err() != nil {
+					return gCtx.Err()
+				}
+				fs.Errorf(top.remote, "Failed to remove empty directory tree: %v", err)
+				failed.Add(1)
+				return nil
+			}
+			fs.Infof(top.remote, "Removed empty directory tree")
+			removed.Add(1)
+			return nil
+		})
+	}
+	err := g.Wait()
+	for _, top := range tops {
+		f.dirCache.FlushDir(top.remote)
+	}
+	if err != nil {
+		return err
+	}
+	fs.Infof(f, "Removed %d empty directory trees", removed.Load())
+	if n := failed.Load(); n > 0 {
+		return fmt.Errorf("failed to remove %d empty directory trees", n)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package drive
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/rclone/rclone/lib/dircache"
+	"github.com/rclone/rclone/lib/pacer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+func dirWithID(remote, id string) fs.Directory {
+	return fs.NewDir(remote, time.Time{}).SetID(id)
+}
+
+func TestEmptyTrees(t *testing.T) {
+	entries := fs.DirEntries{
+		dirWithID("a", "idA"),
+		dirWithID("a/b", "idB"),
+		dirWithID("a/b/c", "idC"),
+		dirWithID("d", "idD"),
+		mockobject.Object("d/file"),
+		dirWithID("d/e", "idE"),
+		dirWithID("d/e/f", "idF"),
+		dirWithID("g", "idG"),
+		dirWithID("g/sc", "idSC\tidTarget"),
+	}
+	assert.Equal(t, []emptyDir{{"a", "idA"}, {"d/e", "idE"}}, emptyTrees("media", "", "root", false, entries))
+
+	// Everything empty removes the root, unless it is kept or is the
+	// root of the drive
+	entries = fs.DirEntries{dirWithID("a", "idA"), dirWithID("a/b", "idB")}
+	assert.Equal(t, []emptyDir{{"", "root"}}, emptyTrees("media", "", "root", false, entries))
+	assert.Equal(t, []emptyDir{{"a", "idA"}}, emptyTrees("media", "", "root", true, entries))
+	assert.Empty(t, emptyTrees("", "", "root", false, entries))
+
+	// Listing a subdirectory
+	entries = fs.DirEntries{dirWithID("x/a", "idA"), mockobject.Object("x/f")}
+	assert.Equal(t, []emptyDir{{"x/a", "idA"}}, emptyTrees("", "x", "idX", false, entries))
+}
+
+func TestRemoveEmptyTrees(t *testing.T) {
+	ctx := context.Background()
+	var hits [2]atomic.Int64
+	p := newTestPool()
+	for i := range hits {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet {
+				// The unfiltered listing of the trees: d holds a file
+				// hidden from the first listing
+				switch q := r.URL.Query().Get("q"); q {
+				case "('idA' in parents)":
+					_, _ = w.Write([]byte(`{"files":[{"id":"idA1","mimeType":"application/vnd.google-apps.folder"}]}`))
+				case "('idD' in parents)":
+					_, _ = w.Write([]byte(`{"files":[{"id":"idDoc","name":"doc","mimeType":"application/vnd.google-apps.document"}]}`))
+				default:
+					_, _ = w.Write([]byte(`{"files":[]}`))
+				}
+				return
+			}
+			assert.Equal(t, http.MethodPatch, r.Method)
+			assert.NotContains(t, r.URL.Path, "idD")
+			hits[i].Add(1)
+			_, _ = w.Write([]byte(`{}`))
+		}))
+		defer srv.Close()
+		svc, err := drive.NewService(ctx, option.WithHTTPClient(srv.Client()), option.WithEndpoint(srv.URL+"/"))
+		require.NoError(t, err)
+		p.AddService(srv.Client(), svc)
+	}
+	f := &Fs{
+		ci:                  fs.GetConfig(ctx),
+		pacer:               fs.NewPacer(ctx, pacer.NewGoogleDrive(pacer.MinSleep(time.Millisecond))),
+		ServiceAccountFiles: p,
+	}
+	f.opt.UseTrash = true
+	f.dirCache = dircache.New("", "root", f)
+
+	tops := []emptyDir{{"a", "idA"}, {"b", "idB"}, {"c", "idC"}, {"d", "idD"}}
+	assert.EqualError(t, f.removeEmptyTrees(ctx, tops), "failed to remove 1 empty directory trees")
+	assert.Equal(t, int64(3), hits[0].Load()+hits[1].Load())
+	assert.NotZero(t, hits[0].Load())
+	assert.NotZero(t, hits[1].Load())
+}
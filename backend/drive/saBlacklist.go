@@ -0,0 +1,123 @@
+// Viewing and editing the blacklist
+//
+// A blacklisted SA sits out blacklistDuration, carried over between runs
+// by the state file and between processes by the shared state. When the
+// quota it hit has been raised, or it was blacklisted by mistake, the
+// only ways to get it back were deleting the state or waiting.
+//
+// The sa-blacklist command lists the blacklisted SAs of the pool with
+// how long each still has to sit out, and clears some or all of them,
+// returning them to rotation. Cleared entries are dropped from the state
+// file and the shared state too, so they stay cleared.
+package drive
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// blacklistEntry is a blacklisted SA as listed by sa-blacklist.
+type blacklistEntry struct {
+	File      string    `json:"file"`
+	Email     string    `json:"email,omitempty"`
+	Since     time.Time `json:"since"`
+	Expires   time.Time `json:"expires"`
+	Remaining string    `json:"remaining"`
+}
+
+// blacklisted returns the blacklisted SAs of the pool, those expiring
+// first first.
+func (p *ServiceAccountPool) blacklisted() []blacklistEntry {
+	p.mu.Lock()
+	var entries []blacklistEntry
+	for file := range p.saIndex {
+		if !isBlacklisted(file) {
+			continue
+		}
+		blackTime, ok := serviceAccountBlacklist.Load(file)
+		if !ok {
+			continue
+		}
+		since := blacklistAnchor(blackTime.(time.Time))
+		remaining := blacklistLeft(blackTime.(time.Time))
+		entries = append(entries, blacklistEntry{
+			File:      file,
+			Since:     since,
+			Expires:   blacklistExpiry(since),
+			Remaining: remaining.Truncate(time.Second).String(),
+		})
+	}
+	p.mu.Unlock()
+	for i := range entries {
+		entries[i].Email = serviceAccountEmail(entries[i].File)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Since.Before(entries[j].Since) })
+	return entries
+}
+
+// matches returns true if the SA of e is one of names, by file, file
+// name or email.
+func (e blacklistEntry) matches(names ...string) bool {
+	for _, name := range names {
+		if name == e.File || name == filepath.Base(e.File) || (e.Email != "" && name == e.Email) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClearBlacklist takes the SAs called names, by file, file name or email,
+// off the blacklist and returns them to rotation, or every blacklisted SA
+// of the pool if names is empty. It returns the files cleared.
+func (p *ServiceAccountPool) ClearBlacklist(names ...string) (cleared []string, err error) {
+	entries := p.blacklisted()
+	for _, name := range names {
+		if !slices.ContainsFunc(entries, func(e blacklistEntry) bool { return e.matches(name) }) {
+			return nil, fmt.Errorf("service account %q isn't blacklisted", name)
+		}
+	}
+	for _, e := range entries {
+		if len(names) == 0 || e.matches(names...) {
+			cleared = append(cleared, e.File)
+		}
+	}
+	p.mu.Lock()
+	for _, file := range cleared {
+		serviceAccountBlacklist.Delete(file)
+		p.revertStaleSa(file)
+		fs.Infof(nil, "Service Account %s taken off the blacklist - returned to rotation", file)
+	}
+	p.clearShared(cleared)
+	p.Metrics.SetGauge(metricAvailable, float64(p.availableCount()))
+	p.mu.Unlock()
+	if p.StateFile != "" && len(cleared) > 0 {
+		if err := p.SaveState(p.StateFile); err != nil {
+			return cleared, err
+		}
+	}
+	return cleared, nil
+}
+
+// saBlacklistCommand runs the sa-blacklist backend command.
+func (f *Fs) saBlacklistCommand(arg []string) (any, error) {
+	pool := f.ServiceAccountFiles
+	if len(arg) == 0 || arg[0] == "list" {
+		return pool.blacklisted(), nil
+	}
+	switch arg[0] {
+	case "clear":
+		if len(arg) < 2 {
+			return nil, errors.New("need the service accounts to clear - use clear-all to clear them all")
+		}
+		return pool.ClearBlacklist(arg[1:]...)
+	case "clear-all":
+		return pool.ClearBlacklist()
+	}
+	return nil, fmt.Errorf("unknown sa-blacklist subcommand %q - use list, clear or clear-all", arg[0])
+}
@@ -0,0 +1,75 @@
+package drive
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlacklistCommand(t *testing.T) {
+	const c = "bundle:c@p.iam.gserviceaccount.com"
+	serviceAccountCredentials.Store(c, []byte(`{"client_email":"c@p.iam.gserviceaccount.com"}`))
+	defer serviceAccountCredentials.Delete(c)
+	dir := t.TempDir()
+	shared := filepath.Join(dir, "shared.json")
+	p := newSharedTestPool(t, shared, "a", "/sa/a.json", "/sa/b.json", c)
+	p.StateFile = filepath.Join(dir, "state.json")
+	f := &Fs{ServiceAccountFiles: p}
+	for _, file := range []string{"/sa/a.json", "/sa/b.json", c} {
+		defer serviceAccountBlacklist.Delete(file)
+	}
+
+	blacklistSA("/sa/a.json", time.Now().Add(-time.Hour))
+	blacklistSA(c, time.Now().Add(-2*time.Hour))
+	p.mu.Lock()
+	p.retireSa("/sa/a.json")
+	p.retireSa(c)
+	p.syncShared([]string{"/sa/a.json", c}, "")
+	p.mu.Unlock()
+
+	out, err := f.saBlacklistCommand(nil)
+	require.NoError(t, err)
+	entries := out.([]blacklistEntry)
+	require.Len(t, entries, 2)
+	assert.Equal(t, c, entries[0].File)
+	assert.Equal(t, "c@p.iam.gserviceaccount.com", entries[0].Email)
+	remaining, err := time.ParseDuration(entries[0].Remaining)
+	require.NoError(t, err)
+	assert.InDelta(t, 23*time.Hour, remaining, float64(time.Minute))
+	assert.Equal(t, "/sa/a.json", entries[1].File)
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), entries[1].Expires, time.Minute)
+
+	_, err = f.saBlacklistCommand([]string{"clear"})
+	assert.Error(t, err)
+	_, err = f.saBlacklistCommand([]string{"clear", "b.json"})
+	assert.ErrorContains(t, err, "isn't blacklisted")
+	_, err = f.saBlacklistCommand([]string{"bogus"})
+	assert.Error(t, err)
+
+	// Cleared by email, it is back in rotation and gone from the state
+	out, err = f.saBlacklistCommand([]string{"clear", "c@p.iam.gserviceaccount.com"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{c}, out)
+	assert.False(t, isBlacklisted(c))
+	assert.Contains(t, p.availableFiles(), c)
+	var state sharedState
+	buf, err := os.ReadFile(shared)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(buf, &state))
+	assert.True(t, state.Accounts[c].Blacklisted.IsZero())
+	assert.False(t, state.Accounts["/sa/a.json"].Blacklisted.IsZero())
+	_, err = os.Stat(p.StateFile)
+	assert.NoError(t, err)
+
+	// clear-all takes the rest, by file name too
+	out, err = f.saBlacklistCommand([]string{"clear-all"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/sa/a.json"}, out)
+	assert.Empty(t, p.blacklisted())
+	assert.Len(t, p.availableFiles(), 3)
+}
@@ -0,0 +1,159 @@
+// Service Account keys from a base64 bundle in the environment
+//
+// ECLONE_DRIVE_SA_BUNDLE may hold every SA key for the pool so containers
+// and CI jobs can run without any mounted key files. The value is base64 of
+// either a JSON array of keys, a single JSON key, or a tar archive (which
+// may be gzipped) of .json key files. Keys are kept in
+// serviceAccountCredentials under a "bundle:" pseudo path.
+package drive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// saBundleEnv is the environment variable holding the SA bundle
+const saBundleEnv = "ECLONE_DRIVE_SA_BUNDLE"
+
+// bundlePrefix marks pool entries whose key came from the SA bundle
+const bundlePrefix = "bundle:"
+
+// maxBundleKeySize limits the size of a single key read from a tar bundle
+const maxBundleKeySize = 1 << 20
+
+// decodeServiceAccountBundle decodes a base64 SA bundle into its keys.
+//
+// The returned names are the key's client_email if it has one, otherwise
+// the file name within the tar or the position in the JSON array.
+func decodeServiceAccountBundle(encoded string) (names []string, keys [][]byte, err error) {
+	encoded = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, encoded)
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		data, err = base64.RawStdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, nil, fmt.Errorf("bundle isn't valid base64: %w", err)
+		}
+	}
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil, fmt.Errorf("bundle isn't valid gzip: %w", err)
+		}
+		data, err = io.ReadAll(zr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("bundle isn't valid gzip: %w", err)
+		}
+	}
+	switch trimmed := bytes.TrimSpace(data); {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		var raw []json.RawMessage
+		if err = json.Unmarshal(trimmed, &raw); err != nil {
+			return nil, nil, fmt.Errorf("bundle isn't a valid JSON array: %w", err)
+		}
+		for i, key := range raw {
+			names = append(names, bundleKeyName(key, fmt.Sprintf("%d", i)))
+			keys = append(keys, key)
+		}
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		if !json.Valid(trimmed) {
+			return nil, nil, errors.New("bundle isn't a valid JSON key")
+		}
+		names = append(names, bundleKeyName(trimmed, "0"))
+		keys = append(keys, trimmed)
+	default:
+		names, keys, err = readServiceAccountTar(data)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil, errors.New("bundle doesn't contain any service account keys")
+	}
+	return names, keys, nil
+}
+
+// readServiceAccountTar reads the .json files out of a tar archive
+func readServiceAccountTar(data []byte) (names []string, keys [][]byte, err error) {
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("bundle isn't a JSON array or tar archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg || !strings.HasSuffix(hdr.Name, ".json") {
+			continue
+		}
+		if hdr.Size > maxBundleKeySize {
+			return nil, nil, fmt.Errorf("bundle key %q is too large", hdr.Name)
+		}
+		key, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read bundle key %q: %w", hdr.Name, err)
+		}
+		if !json.Valid(key) {
+			return nil, nil, fmt.Errorf("bundle key %q isn't valid JSON", hdr.Name)
+		}
+		names = append(names, bundleKeyName(key, path.Base(hdr.Name)))
+		keys = append(keys, key)
+	}
+	return names, keys, nil
+}
+
+// bundleKeyName returns the client_email of key, or fallback if it has none
+func bundleKeyName(key []byte, fallback string) string {
+	var info struct {
+		ClientEmail string `json:"client_email"`
+	}
+	if json.Unmarshal(key, &info) == nil && info.ClientEmail != "" {
+		return info.ClientEmail
+	}
+	return fallback
+}
+
+// loadServiceAccountBundle reads the SA bundle from the environment into
+// serviceAccountCredentials, returning the pseudo paths of the keys.
+func loadServiceAccountBundle() ([]string, error) {
+	return storeServiceAccountBundle(bundlePrefix, os.Getenv(saBundleEnv))
+}
+
+// storeServiceAccountBundle decodes encoded into serviceAccountCredentials
+// under prefix, returning the pseudo paths of the keys.
+func storeServiceAccountBundle(prefix, encoded string) ([]string, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+	names, keys, err := decodeServiceAccountBundle(encoded)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]struct{}, len(names))
+	out := make([]string, 0, len(names))
+	for i, name := range names {
+		name = prefix + name
+		if _, dup := seen[name]; dup {
+			continue
+		}
+		seen[name] = struct{}{}
+		serviceAccountCredentials.Store(name, keys[i])
+		out = append(out, name)
+	}
+	return out, nil
+}
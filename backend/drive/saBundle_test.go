@@ -0,0 +1,70 @@
+package drive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeServiceAccountBundle(t *testing.T) {
+	key1 := `{"type":"service_account","client_email":"sa1@p.iam.gserviceaccount.com"}`
+	key2 := `{"type":"service_account"}`
+
+	// JSON array
+	names, keys, err := decodeServiceAccountBundle(base64.StdEncoding.EncodeToString([]byte("[" + key1 + "," + key2 + "]")))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sa1@p.iam.gserviceaccount.com", "1"}, names)
+	assert.JSONEq(t, key2, string(keys[1]))
+
+	// Single key, wrapped base64
+	encoded := base64.StdEncoding.EncodeToString([]byte(key1))
+	names, _, err = decodeServiceAccountBundle(encoded[:10] + "\n" + encoded[10:])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sa1@p.iam.gserviceaccount.com"}, names)
+
+	// Gzipped tar
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for name, body := range map[string]string{"accounts/2.json": key2, "README": "ignored"} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(body)), Typeflag: tar.TypeReg}))
+		_, err = tw.Write([]byte(body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, zw.Close())
+	names, keys, err = decodeServiceAccountBundle(base64.StdEncoding.EncodeToString(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2.json"}, names)
+	assert.JSONEq(t, key2, string(keys[0]))
+
+	// Errors
+	for _, bad := range []string{"!!!", base64.StdEncoding.EncodeToString([]byte("[]")), base64.StdEncoding.EncodeToString([]byte("{bad"))} {
+		_, _, err = decodeServiceAccountBundle(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestLoadServiceAccountBundle(t *testing.T) {
+	key := `{"type":"service_account","client_email":"sa1@p.iam.gserviceaccount.com"}`
+	t.Setenv(saBundleEnv, base64.StdEncoding.EncodeToString([]byte("["+key+","+key+"]")))
+
+	opt := &Options{ServiceAccountFile: "bundle:sa1@p.iam.gserviceaccount.com"}
+	assert.True(t, opt.usesServiceAccountPool())
+	pool := newTestPool()
+	_, err := pool.Load(opt)
+	require.NoError(t, err)
+	assert.Len(t, pool.sas, 1, "duplicate keys are dropped")
+
+	creds, err := readServiceAccountFile("bundle:sa1@p.iam.gserviceaccount.com")
+	require.NoError(t, err)
+	assert.JSONEq(t, key, string(creds))
+
+	t.Setenv(saBundleEnv, "")
+	assert.False(t, (&Options{}).usesServiceAccountPool())
+}
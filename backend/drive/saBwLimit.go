@@ -0,0 +1,156 @@
+// Per service account bandwidth limit
+//
+// --bwlimit limits the whole process, so with a pool one SA can take all of
+// it while the others idle. With sa_bwlimit every SA gets a bandwidth budget
+// of its own, in the --bwlimit syntax so it can follow a timetable and set
+// upload and download separately.
+//
+// The limit is applied by the transport of each SA's HTTP client, so
+// uploads, downloads and reads through preloaded services all count towards
+// the budget of the SA doing them. The budgets are process-wide, like the
+// blacklist, so several remotes using the same SA share its budget.
+package drive
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"golang.org/x/oauth2"
+	"golang.org/x/time/rate"
+)
+
+// bwMinBurst is the smallest token bucket used, as for --bwlimit
+const bwMinBurst = 4 * 1024 * 1024
+
+// serviceAccountBandwidth holds the *saBandwidth of each SA file.
+var serviceAccountBandwidth sync.Map
+
+// saBandwidth is the bandwidth budget of one SA.
+type saBandwidth struct {
+	mu        sync.Mutex
+	timetable fs.BwTimetable
+	tx, rx    *rate.Limiter
+}
+
+// bandwidthFor returns the budget of the SA file following timetable.
+func bandwidthFor(file string, timetable fs.BwTimetable) *saBandwidth {
+	v, _ := serviceAccountBandwidth.LoadOrStore(file, &saBandwidth{
+		tx: rate.NewLimiter(rate.Inf, bwMinBurst),
+		rx: rate.NewLimiter(rate.Inf, bwMinBurst),
+	})
+	bw := v.(*saBandwidth)
+	bw.mu.Lock()
+	bw.timetable = timetable
+	bw.mu.Unlock()
+	return bw
+}
+
+// limiter returns the token bucket for uploads (tx) or downloads, set to
+// the limit in the timetable now, or nil if there is no limit.
+func (bw *saBandwidth) limiter(tx bool) *rate.Limiter {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	pair := bw.timetable.LimitAt(time.Now()).Bandwidth
+	limiter, limit := bw.rx, pair.Rx
+	if tx {
+		limiter, limit = bw.tx, pair.Tx
+	}
+	if limit <= 0 {
+		return nil
+	}
+	if rate.Limit(limit) != limiter.Limit() {
+		limiter.SetLimit(rate.Limit(limit))
+		limiter.SetBurst(max(int(limit), bwMinBurst))
+	}
+	return limiter
+}
+
+// wait blocks until n bytes may be transferred in the direction given.
+func (bw *saBandwidth) wait(ctx context.Context, tx bool, n int) error {
+	for n > 0 {
+		limiter := bw.limiter(tx)
+		if limiter == nil {
+			return nil
+		}
+		chunk := min(n, limiter.Burst())
+		if err := limiter.WaitN(ctx, chunk); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// bwReader limits the bandwidth of the body of a request or response.
+type bwReader struct {
+	io.ReadCloser
+	ctx context.Context
+	bw  *saBandwidth
+	tx  bool
+}
+
+// Read reads from the body, waiting for the budget to allow it
+func (r *bwReader) Read(p []byte) (n int, err error) {
+	n, err = r.ReadCloser.Read(p)
+	if waitErr := r.bw.wait(r.ctx, r.tx, n); waitErr != nil && err == nil {
+		err = waitErr
+	}
+	return n, err
+}
+
+// bwTransport applies the budget of an SA to the requests sent through it.
+type bwTransport struct {
+	base http.RoundTripper
+	bw   *saBandwidth
+}
+
+// RoundTrip sends req, limiting the bandwidth of its body and that of the
+// response
+func (t *bwTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if req.Body != nil && req.Body != http.NoBody {
+		req = req.Clone(ctx)
+		req.Body = &bwReader{ReadCloser: req.Body, ctx: ctx, bw: t.bw, tx: true}
+	}
+	res, err := t.base.RoundTrip(req)
+	if err == nil && res.Body != nil {
+		res.Body = &bwReader{ReadCloser: res.Body, ctx: ctx, bw: t.bw}
+	}
+	return res, err
+}
+
+// CloseIdleConnections closes the idle connections of the base transport
+func (t *bwTransport) CloseIdleConnections() {
+	if closer, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// limitServiceAccountBandwidth makes the client of the SA file keep to
+// the sa_bwlimit budget of that SA.
+//
+// The token requests go through a client of their own, so only the
+// requests made with the SA's token are limited.
+func limitServiceAccountBandwidth(client *http.Client, file string, opt *Options) {
+	if len(opt.ServiceAccountBwLimit) == 0 || file == "" {
+		return
+	}
+	bw := bandwidthFor(file, opt.ServiceAccountBwLimit)
+	if t, ok := client.Transport.(*oauth2.Transport); ok {
+		base := t.Base
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		t.Base = &bwTransport{base: base, bw: bw}
+		return
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client.Transport = &bwTransport{base: base, bw: bw}
+}
@@ -0,0 +1,72 @@
+package drive
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	"golang.org/x/time/rate"
+)
+
+func TestSaBandwidthLimiter(t *testing.T) {
+	var timetable fs.BwTimetable
+	require.NoError(t, timetable.Set("1M:2M"))
+	bw := bandwidthFor(t.Name(), timetable)
+	assert.Same(t, bw, bandwidthFor(t.Name(), timetable))
+
+	tx, rx := bw.limiter(true), bw.limiter(false)
+	require.NotNil(t, tx)
+	require.NotNil(t, rx)
+	assert.Equal(t, rate.Limit(1<<20), tx.Limit())
+	assert.Equal(t, rate.Limit(2<<20), rx.Limit())
+	assert.Equal(t, bwMinBurst, tx.Burst())
+
+	// The burst goes through at once, then the budget is spent
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, bw.wait(ctx, true, bwMinBurst))
+	cancel()
+	assert.Error(t, bw.wait(ctx, true, 1))
+
+	// Off means no limit
+	require.NoError(t, timetable.Set("off"))
+	bw = bandwidthFor(t.Name(), timetable)
+	assert.Nil(t, bw.limiter(true))
+	assert.NoError(t, bw.wait(ctx, true, 1))
+}
+
+func TestLimitServiceAccountBandwidth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	}))
+	defer srv.Close()
+
+	opt := &Options{}
+	client := oauth2.NewClient(context.Background(), oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}))
+
+	// Without sa_bwlimit the client is left alone
+	limitServiceAccountBandwidth(client, "sa.json", opt)
+	_, limited := client.Transport.(*oauth2.Transport).Base.(*bwTransport)
+	assert.False(t, limited)
+
+	require.NoError(t, opt.ServiceAccountBwLimit.Set("10M"))
+	limitServiceAccountBandwidth(client, t.Name(), opt)
+	transport, limited := client.Transport.(*oauth2.Transport).Base.(*bwTransport)
+	require.True(t, limited)
+	assert.Same(t, bandwidthFor(t.Name(), opt.ServiceAccountBwLimit), transport.bw)
+
+	res, err := client.Post(srv.URL, "text/plain", strings.NewReader("hello"))
+	require.NoError(t, err)
+	defer func() { _ = res.Body.Close() }()
+	assert.IsType(t, &bwReader{}, res.Body)
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+}
@@ -0,0 +1,191 @@
+// Interactive Service Account pool setup
+//
+// These are the "sa_" states of the drive config flow. They ask for the SA
+// folder, check the keys in it, optionally test that one of them can access
+// the Shared Drive or root folder the remote is for, catching a drive not
+// shared with the SAs at setup time rather than on the first transfer, and
+// store the pool options, before handing back to the normal auth flow.
+package drive
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/lib/env"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+// validateServiceAccountKey checks data looks like a Google service account
+// key, returning its client_email.
+func validateServiceAccountKey(data []byte) (email string, err error) {
+	var key struct {
+		Type        string `json:"type"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+	}
+	if err = json.Unmarshal(data, &key); err != nil {
+		return "", fmt.Errorf("invalid JSON: %w", err)
+	}
+	switch {
+	case key.Type != "service_account":
+		return "", fmt.Errorf("type is %q not \"service_account\"", key.Type)
+	case key.ClientEmail == "":
+		return "", errors.New("missing client_email")
+	case key.PrivateKey == "":
+		return "", errors.New("missing private_key")
+	}
+	if block, _ := pem.Decode([]byte(key.PrivateKey)); block == nil || !strings.Contains(block.Type, "PRIVATE KEY") {
+		return "", errors.New("private_key isn't a PEM encoded private key")
+	}
+	return key.ClientEmail, nil
+}
+
+// validServiceAccountFiles returns the files in saFolder holding valid keys
+// and the number of invalid ones, which are logged.
+func validServiceAccountFiles(saFolder string) (valid []string, invalid int, err error) {
+	files, err := listServiceAccountFolder(saFolder)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, file := range files {
+		data, err := readServiceAccountFile(file)
+		if err == nil {
+			_, err = validateServiceAccountKey(data)
+		}
+		if err != nil {
+			fs.Logf(nil, "Skipping service account %q: %v", file, err)
+			invalid++
+			continue
+		}
+		valid = append(valid, file)
+	}
+	return valid, invalid, nil
+}
+
+// checkServiceAccountAccess checks svc can see id, a Shared Drive or a
+// folder, or the root of its own drive if id is "". It returns the name of
+// what it found and whether that is a Shared Drive.
+func checkServiceAccountAccess(ctx context.Context, svc *drive.Service, id string) (name string, sharedDrive bool, err error) {
+	if id == "" {
+		root, err := svc.Files.Get("root").Fields("id,name").Context(ctx).Do()
+		if err != nil {
+			return "", false, explainError(err)
+		}
+		return root.Name, false, nil
+	}
+	td, err := svc.Drives.Get(id).Fields("id,name").Context(ctx).Do()
+	if err == nil {
+		return td.Name, true, nil
+	}
+	if !isGoogleError(err, "notFound") {
+		return "", false, explainError(err)
+	}
+	// Not a Shared Drive, or one it isn't a member of, so try a folder
+	info, err := svc.Files.Get(id).Fields("id,name,mimeType").SupportsAllDrives(true).Context(ctx).Do()
+	if err != nil {
+		return "", false, explainError(err)
+	}
+	if info.MimeType != driveFolderType {
+		return "", false, fmt.Errorf("%q is a file, not a folder", info.Name)
+	}
+	return info.Name, false, nil
+}
+
+// serviceAccountService returns a drive service using the service account
+// of opt alone. Only one SA is needed for the access test, so this doesn't
+// make an Fs, which would load the whole pool.
+func serviceAccountService(ctx context.Context, opt *Options) (*drive.Service, error) {
+	data := []byte(opt.ServiceAccountCredentials)
+	if len(data) == 0 {
+		var err error
+		data, err = readServiceAccountFile(opt.ServiceAccountFile)
+		if err != nil {
+			return nil, fmt.Errorf("error opening service account credentials file: %w", err)
+		}
+	}
+	client, err := getServiceAccountClient(ctx, opt, data)
+	if err != nil {
+		return nil, err
+	}
+	return drive.NewService(ctx, option.WithHTTPClient(client))
+}
+
+// serviceAccountConfig runs the "sa_" states of the config flow, going to
+// the "auth" state when done.
+func serviceAccountConfig(ctx context.Context, name string, m configmap.Mapper, opt *Options, config fs.ConfigIn) (*fs.ConfigOut, error) {
+	switch config.State {
+	case "sa_pool":
+		if opt.usesServiceAccountPool() {
+			return fs.ConfigGoto("auth")
+		}
+		return fs.ConfigConfirm("sa_pool_ok", false, "config_sa_pool", "Use a pool of service accounts, switched automatically on rate limits?\n")
+	case "sa_pool_ok":
+		if config.Result == "false" {
+			return fs.ConfigGoto("auth")
+		}
+		return fs.ConfigGoto("sa_folder")
+	case "sa_folder":
+		return fs.ConfigInput("sa_folder_check", "config_sa_folder", "Folder containing the service account JSON files.\n")
+	case "sa_folder_check":
+		saFolder := config.Result
+		valid, invalid, err := validServiceAccountFiles(env.ShellExpand(saFolder))
+		if err != nil {
+			return fs.ConfigError("sa_folder", err.Error())
+		}
+		if len(valid) == 0 {
+			return fs.ConfigError("sa_folder", fmt.Sprintf("No valid service account keys found in %q (%d invalid)", saFolder, invalid))
+		}
+		m.Set("service_account_file_path", saFolder)
+		if opt.ServiceAccountFile == "" {
+			m.Set("service_account_file", valid[0])
+		}
+		return fs.ConfigConfirm("sa_rolling", false, "config_rolling_sa",
+			fmt.Sprintf("Found %d valid service account(s), skipped %d invalid.\nRotate service accounts proactively before each operation (rolling_sa)?\n", len(valid), invalid))
+	case "sa_rolling":
+		m.Set("rolling_sa", config.Result)
+		return fs.ConfigConfirm("sa_test", true, "config_sa_test", "Test access to the drive with a service account now?\n")
+	case "sa_test":
+		if config.Result == "false" {
+			return fs.ConfigGoto("auth")
+		}
+		out, _ := fs.ConfigInputOptional("sa_test_target", "config_sa_test_target", "ID of the Shared Drive or root folder to test the service account against.\nLeave blank to test the root of its own drive.\n")
+		out.Option.Default = opt.TeamDriveID
+		if opt.TeamDriveID == "" {
+			out.Option.Default = opt.RootFolderID
+		}
+		return out, nil
+	case "sa_test_target":
+		id := strings.TrimSpace(config.Result)
+		sa := serviceAccountName(opt.ServiceAccountFile)
+		svc, err := serviceAccountService(ctx, opt)
+		if err != nil {
+			return fs.ConfigError("sa_test_again", fmt.Sprintf("Service account %s couldn't be used: %v", sa, err))
+		}
+		found, sharedDrive, err := checkServiceAccountAccess(ctx, svc, id)
+		if err != nil {
+			return fs.ConfigError("sa_test_again", fmt.Sprintf("Service account %s can't access %q: %v\nAdd it, or a group holding the service accounts, as a member of the Shared Drive or share the folder with it.", sa, id, err))
+		}
+		switch {
+		case sharedDrive:
+			m.Set("team_drive", id)
+			m.Set("root_folder_id", "")
+			fs.Logf(nil, "Service account %s can access Shared Drive %q", sa, found)
+		case id != "":
+			m.Set("root_folder_id", id)
+			fs.Logf(nil, "Service account %s can access folder %q", sa, found)
+		default:
+			fs.Logf(nil, "Service account %s can access its own drive", sa)
+		}
+		return fs.ConfigGoto("auth")
+	case "sa_test_again":
+		return fs.ConfigConfirm("sa_test", true, "config_sa_test", "Test access again?\n")
+	}
+	return nil, fmt.Errorf("unknown state %q", config.State)
+}
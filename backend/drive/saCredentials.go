@@ -0,0 +1,81 @@
+// Parsed service account credentials
+//
+// Every time a service is built for a SA, when preloading or when an Fs
+// switches to it, its JSON key was read and parsed again. The pool keeps
+// the parsed key of each file instead, keyed by its path and modification
+// time so a key replaced on disk is read afresh.
+package drive
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/rclone/rclone/lib/env"
+	"github.com/rclone/rclone/lib/oauthutil"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"golang.org/x/oauth2/jwt"
+)
+
+// saCredentials is a parsed key cached by the pool
+type saCredentials struct {
+	modTime time.Time // of the file, zero for keys held in memory
+	scope   string    // the scope option conf was parsed with
+	conf    *jwt.Config
+}
+
+// credentials returns the key in file parsed with the scopes of opt,
+// reading it only if it isn't cached or the file has changed since.
+func (p *ServiceAccountPool) credentials(opt *Options, file string) (*jwt.Config, error) {
+	var modTime time.Time
+	if _, ok := serviceAccountCredentials.Load(file); !ok {
+		info, err := os.Stat(env.ShellExpand(file))
+		if err != nil {
+			return nil, fmt.Errorf("error opening service account credentials file: %w", err)
+		}
+		modTime = info.ModTime()
+	}
+	p.mu.Lock()
+	cached, ok := p.creds[file]
+	p.mu.Unlock()
+	if ok && cached.modTime.Equal(modTime) && cached.scope == opt.Scope {
+		return cached.conf, nil
+	}
+
+	data, err := readServiceAccountFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error opening service account credentials file: %w", err)
+	}
+	conf, err := google.JWTConfigFromJSON(data, driveScopes(opt.Scope)...)
+	if err != nil {
+		return nil, fmt.Errorf("error processing credentials: %w", err)
+	}
+	p.mu.Lock()
+	p.creds[file] = saCredentials{modTime: modTime, scope: opt.Scope, conf: conf}
+	p.mu.Unlock()
+	return conf, nil
+}
+
+// oauthClient returns an HTTP client authorised as the SA in file, as
+// getServiceAccountClient does but with the key from the cache.
+func (p *ServiceAccountPool) oauthClient(ctx context.Context, opt *Options, file string) (*http.Client, error) {
+	cached, err := p.credentials(opt, file)
+	if err != nil {
+		return nil, err
+	}
+	conf := *cached // Subject is set per client
+	if opt.Impersonate != "" {
+		conf.Subject = opt.Impersonate
+	}
+	ctxWithSpecialClient := oauthutil.Context(ctx, getClient(ctx, opt))
+	src := conf.TokenSource(ctxWithSpecialClient)
+	if opt.ServiceAccountTokenCache {
+		src = cachedTokenSource(&conf, src)
+	}
+	client := oauth2.NewClient(ctxWithSpecialClient, src)
+	limitServiceAccountBandwidth(client, file, opt)
+	return client, nil
+}
@@ -0,0 +1,66 @@
+package drive
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialsCached(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "1.json")
+	write := func(email string, modTime time.Time) {
+		require.NoError(t, os.WriteFile(file, []byte(`{"type":"service_account","client_email":"`+email+`","private_key":"`+testPrivateKey+`"}`), 0600))
+		require.NoError(t, os.Chtimes(file, modTime, modTime))
+	}
+	modTime := time.Now().Add(-time.Hour)
+	write("a@p.iam.gserviceaccount.com", modTime)
+
+	pool := newTestPool()
+	opt := &Options{}
+	conf, err := pool.credentials(opt, file)
+	require.NoError(t, err)
+	assert.Equal(t, "a@p.iam.gserviceaccount.com", conf.Email)
+
+	// Not read again while the file is unchanged
+	again, err := pool.credentials(opt, file)
+	require.NoError(t, err)
+	assert.Same(t, conf, again)
+
+	// But read again when it is replaced or the scope changes
+	write("b@p.iam.gserviceaccount.com", modTime.Add(time.Minute))
+	conf, err = pool.credentials(opt, file)
+	require.NoError(t, err)
+	assert.Equal(t, "b@p.iam.gserviceaccount.com", conf.Email)
+	again, err = pool.credentials(&Options{Scope: "drive.readonly"}, file)
+	require.NoError(t, err)
+	assert.NotSame(t, conf, again)
+	assert.Equal(t, []string{scopePrefix + "drive.readonly"}, again.Scopes)
+
+	// Clients impersonate without changing the cached key
+	client, err := pool.oauthClient(context.Background(), &Options{Impersonate: "user@example.com"}, file)
+	require.NoError(t, err)
+	assert.NotNil(t, client)
+	assert.Empty(t, conf.Subject)
+
+	_, err = pool.credentials(opt, filepath.Join(dir, "missing.json"))
+	assert.ErrorContains(t, err, "error opening service account credentials file")
+}
+
+func TestCredentialsInMemory(t *testing.T) {
+	const file = "bundle:mem@p.iam.gserviceaccount.com"
+	serviceAccountCredentials.Store(file, []byte(`{"type":"service_account","client_email":"mem@p.iam.gserviceaccount.com","private_key":"`+testPrivateKey+`"}`))
+	defer serviceAccountCredentials.Delete(file)
+
+	pool := newTestPool()
+	conf, err := pool.credentials(&Options{}, file)
+	require.NoError(t, err)
+	again, err := pool.credentials(&Options{}, file)
+	require.NoError(t, err)
+	assert.Same(t, conf, again)
+}
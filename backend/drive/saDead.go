@@ -0,0 +1,97 @@
+// Dead service accounts
+//
+// An SA whose key has been revoked, or which has been deleted or disabled,
+// fails every token request with invalid_grant. Unlike a rate limited SA it
+// will never recover, so rather than blacklisting it for 25 hours it is
+// marked dead: it is removed from rotation for the life of the pool, isn't
+// picked up again by Load and, with a state file, stays dead across runs.
+package drive
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+	"golang.org/x/oauth2"
+)
+
+// deadGrantDescriptions are the invalid_grant descriptions which mean the
+// SA itself is gone rather than e.g. the clock being out.
+var deadGrantDescriptions = []string{
+	"account not found",
+	"deleted",
+	"disabled",
+	"invalid jwt signature",
+}
+
+// isDeadServiceAccountError returns the reason if err means the SA used
+// can never authenticate again.
+func isDeadServiceAccountError(err error) (reason string, dead bool) {
+	if err == nil {
+		return "", false
+	}
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		if retrieveErr.ErrorCode != "invalid_grant" {
+			return "", false
+		}
+		reason = retrieveErr.ErrorCode + ": " + retrieveErr.ErrorDescription
+	} else {
+		// Token errors can lose their type on the way through the transport
+		reason = err.Error()
+		if !strings.Contains(reason, "invalid_grant") {
+			return "", false
+		}
+	}
+	lower := strings.ToLower(reason)
+	for _, description := range deadGrantDescriptions {
+		if strings.Contains(lower, description) {
+			return reason, true
+		}
+	}
+	return "", false
+}
+
+// MarkDead removes file from rotation for good, recording why.
+func (p *ServiceAccountPool) MarkDead(file, reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.markDead(file, reason)
+}
+
+// markDead does the work of MarkDead - call with p.mu held.
+func (p *ServiceAccountPool) markDead(file, reason string) {
+	if file == "" {
+		return
+	}
+	if _, already := p.dead[file]; already {
+		return
+	}
+	fs.Errorf(nil, "Service Account %s is dead and won't be used again: %s", file, reason)
+	p.dead[file] = reason
+	p.retireSa(file)
+	p.Metrics.Inc(metricDead)
+	p.Metrics.SetGauge(metricAvailable, float64(p.availableCount()))
+	if poolEventsSubscribed() {
+		publishPoolEvent(PoolEvent{Type: PoolEventDead, SA: serviceAccountName(file), Reason: reason})
+	}
+}
+
+// isDead returns true if file has been marked dead.
+func (p *ServiceAccountPool) isDead(file string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, dead := p.dead[file]
+	return dead
+}
+
+// Dead returns the dead SAs with the reason each was marked dead.
+func (p *ServiceAccountPool) Dead() map[string]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make(map[string]string, len(p.dead))
+	for file, reason := range p.dead {
+		out[file] = reason
+	}
+	return out
+}
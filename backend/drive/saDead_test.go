@@ -0,0 +1,92 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestIsDeadServiceAccountError(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		dead bool
+	}{
+		{nil, false},
+		{errors.New("boom"), false},
+		{&oauth2.RetrieveError{ErrorCode: "invalid_grant", ErrorDescription: "Invalid grant: account not found"}, true},
+		{&url.Error{Op: "Get", URL: "x", Err: &oauth2.RetrieveError{ErrorCode: "invalid_grant", ErrorDescription: "Invalid JWT Signature."}}, true},
+		{&oauth2.RetrieveError{ErrorCode: "invalid_grant", ErrorDescription: "Invalid JWT: Token must be a short-lived token"}, false},
+		{&oauth2.RetrieveError{ErrorCode: "invalid_client", ErrorDescription: "account disabled"}, false},
+		{errors.New(`oauth2: "invalid_grant" "Service account has been disabled"`), true},
+	} {
+		_, dead := isDeadServiceAccountError(test.err)
+		assert.Equal(t, test.dead, dead, fmt.Sprint(test.err))
+	}
+}
+
+func TestMarkDead(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	for _, name := range []string{"1.json", "2.json", "3.json"} {
+		file := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(file, []byte("{}"), 0600))
+		files = append(files, file)
+	}
+	opt := &Options{ServiceAccountFilePath: dir, ServiceAccountFile: files[0]}
+	metrics := NewMemoryMetrics()
+	pool := newTestPool()
+	pool.Metrics = metrics
+	_, err := pool.Load(opt)
+	require.NoError(t, err)
+
+	pool.MarkDead(files[1], "invalid_grant: account not found")
+	pool.MarkDead(files[1], "again")
+	assert.Equal(t, int64(1), metrics.Counter(metricDead))
+	assert.Equal(t, map[string]string{files[1]: "invalid_grant: account not found"}, pool.Dead())
+	assert.NotContains(t, pool.availableFiles(), files[1])
+	assert.True(t, pool.sas[pool.saIndex[files[1]]].isStale)
+
+	// Excluding a dead SA doesn't blacklist it
+	pool.MarkDead(files[0], "invalid_grant: deleted")
+	got, err := pool.GetFile(files[0])
+	require.NoError(t, err)
+	assert.Equal(t, files[2], got)
+	_, blacklisted := serviceAccountBlacklist.Load(files[0])
+	assert.False(t, blacklisted)
+
+	// Reloading leaves dead SAs out
+	_, err = pool.Load(&Options{ServiceAccountFilePath: dir, ServiceAccountFile: files[2]})
+	require.NoError(t, err)
+	assert.Empty(t, pool.availableFiles())
+	assert.Len(t, pool.sas, 1)
+
+	// and so does a new pool loading the saved state
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, pool.SaveState(stateFile))
+	fresh := newTestPool()
+	_, err = fresh.Load(opt)
+	require.NoError(t, err)
+	require.NoError(t, fresh.LoadState(stateFile))
+	assert.Len(t, fresh.Dead(), 2)
+	assert.Equal(t, map[string]struct{}{files[2]: {}}, fresh.availableFiles())
+}
+
+func TestPreloadMarksDead(t *testing.T) {
+	pool := newTestPool()
+	pool.Factory = ServiceFactoryFunc(func(ctx context.Context, opt *Options, file string) (ServiceAccountInfo, error) {
+		return ServiceAccountInfo{}, &oauth2.RetrieveError{ErrorCode: "invalid_grant", ErrorDescription: "account not found"}
+	})
+	setFiles(pool, "/sa/gone.json")
+	_, err := pool.PreloadServices(&Fs{}, 1)
+	require.NoError(t, err)
+	assert.Contains(t, pool.Dead(), "/sa/gone.json")
+	assert.Empty(t, pool.availableFiles())
+}
@@ -0,0 +1,75 @@
+// Verbose pool logging at runtime
+//
+// What the pool does - which SA it picks, when it rotates and which SAs
+// it blacklists - is logged at debug level, so following it on a running
+// daemon meant restarting it with -vv and wading through everything else
+// too. The drive/sadebug rc call turns these messages up to NOTICE level,
+// where the daemon logs them whatever its verbosity, and back down again.
+package drive
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+)
+
+// saDebug is set while the pool messages are logged at NOTICE level
+var saDebug atomic.Bool
+
+func init() {
+	rc.Add(rc.Call{
+		Path:  "drive/sadebug",
+		Fn:    rcSaDebug,
+		Title: "Turn verbose service account pool logging on or off",
+		Help: `
+Log what the service account pools do - the SAs picked, rotations and
+blacklisting - at NOTICE level rather than DEBUG, so a running daemon
+shows them without switching the whole process to -vv.
+
+Params:
+  - enable = true/false to turn the verbose logging on or off (optional)
+
+Returns the state after the call:
+  - enabled = whether the verbose logging is on
+
+Eg
+
+    eclone rc drive/sadebug enable=true
+    eclone rc drive/sadebug enable=false
+`,
+	})
+}
+
+// rcSaDebug implements the drive/sadebug rc call.
+func rcSaDebug(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	enable, err := in.GetBool("enable")
+	switch {
+	case rc.IsErrParamNotFound(err):
+	case err != nil:
+		return nil, err
+	default:
+		saDebug.Store(enable)
+		if enable {
+			fs.Logf(nil, "Verbose service account pool logging turned on")
+		} else {
+			fs.Logf(nil, "Verbose service account pool logging turned off")
+		}
+	}
+	return rc.Params{"enabled": saDebug.Load()}, nil
+}
+
+// saDebugLevel returns the level saDebugf logs at.
+func saDebugLevel() fs.LogLevel {
+	if saDebug.Load() {
+		return fs.LogLevelNotice
+	}
+	return fs.LogLevelDebug
+}
+
+// saDebugf logs what the pool does: at DEBUG level, or NOTICE level while
+// drive/sadebug has turned it on.
+func saDebugf(o any, format string, args ...any) {
+	fs.LogLevelPrintf(saDebugLevel(), o, format, args...)
+}
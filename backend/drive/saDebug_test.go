@@ -0,0 +1,34 @@
+package drive
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRcSaDebug(t *testing.T) {
+	defer saDebug.Store(false)
+	call := rc.Calls.Get("drive/sadebug")
+	require.NotNil(t, call)
+	ctx := context.Background()
+
+	out, err := call.Fn(ctx, rc.Params{})
+	require.NoError(t, err)
+	assert.Equal(t, rc.Params{"enabled": false}, out)
+
+	out, err = call.Fn(ctx, rc.Params{"enable": "true"})
+	require.NoError(t, err)
+	assert.Equal(t, rc.Params{"enabled": true}, out)
+	assert.True(t, saDebug.Load())
+
+	out, err = call.Fn(ctx, rc.Params{"enable": false})
+	require.NoError(t, err)
+	assert.Equal(t, rc.Params{"enabled": false}, out)
+
+	_, err = call.Fn(ctx, rc.Params{"enable": "maybe"})
+	assert.Error(t, err)
+	assert.False(t, saDebug.Load())
+}
@@ -0,0 +1,95 @@
+// Duplicate service account keys
+//
+// It is easy to end up with several JSON files for the same SA, e.g. after
+// generating a fresh key without deleting the old one. Quota is per SA not
+// per key, so treating them as separate SAs only means more rate limited
+// switches. Load collapses keys with the same client_email into one,
+// keeping the newest.
+package drive
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/env"
+)
+
+// serviceAccountEmail returns the client_email of the key in file, or ""
+// if it can't be read.
+func serviceAccountEmail(file string) string {
+	var key struct {
+		ClientEmail string `json:"client_email"`
+	}
+	if data, err := readServiceAccountFile(file); err == nil {
+		_ = json.Unmarshal(data, &key)
+	}
+	return key.ClientEmail
+}
+
+// emailOf returns the client_email of the SA in file, or "" if it can't
+// be read, reading the key only the first time.
+func (p *ServiceAccountPool) emailOf(file string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	email, ok := p.clientEmails[file]
+	if !ok {
+		email = serviceAccountEmail(file)
+		p.clientEmails[file] = email
+	}
+	return email
+}
+
+// serviceAccountModTime returns when the key in file was last modified.
+//
+// Keys held in memory have no modification time and return the zero time
+// so a key on disk always wins over them.
+func serviceAccountModTime(file string) time.Time {
+	if _, ok := serviceAccountCredentials.Load(file); ok {
+		return time.Time{}
+	}
+	info, err := os.Stat(env.ShellExpand(file))
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// dedupeServiceAccounts drops the files which hold a key for the same
+// client_email as another, keeping the most recently modified of each. On
+// a tie the first one wins. Files whose client_email can't be read are
+// kept. The order of the files kept is unchanged.
+func dedupeServiceAccounts(files []string) []string {
+	type newest struct {
+		file    string
+		modTime time.Time
+	}
+	emails := make([]string, len(files))
+	modTimes := make([]time.Time, len(files))
+	forEachServiceAccount(files, func(i int, file string) {
+		if emails[i] = serviceAccountEmail(file); emails[i] != "" {
+			modTimes[i] = serviceAccountModTime(file)
+		}
+	})
+	byEmail := make(map[string]newest, len(files))
+	for i, file := range files {
+		email, modTime := emails[i], modTimes[i]
+		if email == "" {
+			continue
+		}
+		if best, ok := byEmail[email]; ok && !modTime.After(best.modTime) {
+			continue
+		}
+		byEmail[email] = newest{file: file, modTime: modTime}
+	}
+	out := files[:0:0]
+	for i, file := range files {
+		if email := emails[i]; email != "" && byEmail[email].file != file {
+			fs.Infof(nil, "Ignoring service account %q: duplicate key for %s, using %q", file, email, byEmail[email].file)
+			continue
+		}
+		out = append(out, file)
+	}
+	return out
+}
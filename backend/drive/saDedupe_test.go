@@ -0,0 +1,54 @@
+package drive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedupeServiceAccounts(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, email string, age time.Duration) string {
+		file := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(file, []byte(`{"type":"service_account","client_email":"`+email+`"}`), 0600))
+		modTime := time.Now().Add(-age)
+		require.NoError(t, os.Chtimes(file, modTime, modTime))
+		return file
+	}
+	oldA := write("1.json", "a@p.iam.gserviceaccount.com", time.Hour)
+	b := write("2.json", "b@p.iam.gserviceaccount.com", time.Hour)
+	newA := write("3.json", "a@p.iam.gserviceaccount.com", time.Minute)
+	noEmail := write("4.json", "", time.Minute)
+	missing := filepath.Join(dir, "missing.json")
+
+	// An in-memory key loses to one on disk
+	const memA = "bundle:a@p.iam.gserviceaccount.com"
+	serviceAccountCredentials.Store(memA, []byte(`{"client_email":"a@p.iam.gserviceaccount.com"}`))
+	defer serviceAccountCredentials.Delete(memA)
+
+	got := dedupeServiceAccounts([]string{oldA, b, newA, noEmail, missing, memA})
+	assert.Equal(t, []string{b, newA, noEmail, missing}, got)
+
+	// Duplicates with the same age keep the first
+	sameA := write("5.json", "a@p.iam.gserviceaccount.com", time.Minute)
+	info, err := os.Stat(newA)
+	require.NoError(t, err)
+	require.NoError(t, os.Chtimes(sameA, info.ModTime(), info.ModTime()))
+	assert.Equal(t, []string{newA}, dedupeServiceAccounts([]string{newA, sameA}))
+}
+
+func TestLoadDedupes(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"1.json", "2.json"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(`{"type":"service_account","client_email":"a@p.iam.gserviceaccount.com"}`), 0600))
+	}
+	pool := newTestPool()
+	files, err := pool.Load(&Options{ServiceAccountFilePath: dir})
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.Len(t, pool.sas, 1)
+}
@@ -0,0 +1,78 @@
+// Service Account keys embedded in the config file
+//
+// service_account_keys holds every SA key for the pool in the same format
+// as ECLONE_DRIVE_SA_BUNDLE, obscured like any other rclone password. Set
+// a config encryption password to have them encrypted at rest too. The keys
+// are only ever revealed into serviceAccountCredentials under a "config:"
+// pseudo path.
+package drive
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/config/obscure"
+)
+
+// embedPrefix marks pool entries whose key came from service_account_keys
+const embedPrefix = "config:"
+
+// loadEmbeddedServiceAccounts reveals the keys in service_account_keys into
+// serviceAccountCredentials, returning their pseudo paths.
+func loadEmbeddedServiceAccounts(opt *Options) ([]string, error) {
+	if opt.ServiceAccountKeys == "" {
+		return nil, nil
+	}
+	encoded, err := obscure.Reveal(opt.ServiceAccountKeys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reveal service_account_keys: %w", err)
+	}
+	return storeServiceAccountBundle(embedPrefix, encoded)
+}
+
+// encodeServiceAccountFolder reads the valid keys in saFolder into an
+// obscured bundle suitable for service_account_keys.
+func encodeServiceAccountFolder(saFolder string) (obscured string, n int, err error) {
+	files, _, err := validServiceAccountFiles(saFolder)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(files) == 0 {
+		return "", 0, fmt.Errorf("no valid service account keys found in %q", saFolder)
+	}
+	keys := make([]json.RawMessage, 0, len(files))
+	for _, file := range files {
+		key, err := readServiceAccountFile(file)
+		if err != nil {
+			return "", 0, err
+		}
+		keys = append(keys, key)
+	}
+	buf, err := json.Marshal(keys)
+	if err != nil {
+		return "", 0, err
+	}
+	obscured, err = obscure.Obscure(base64.StdEncoding.EncodeToString(buf))
+	return obscured, len(keys), err
+}
+
+// embedServiceAccounts stores the keys in saFolder in the config section of
+// the remote called name and saves the config file.
+func embedServiceAccounts(name, saFolder string) (n int, err error) {
+	if !config.LoadedData().HasSection(name) {
+		return 0, fmt.Errorf("remote %q isn't in the config file", name)
+	}
+	if saFolder == "" {
+		return 0, errors.New("no service account folder - pass one or set service_account_file_path")
+	}
+	obscured, n, err := encodeServiceAccountFolder(saFolder)
+	if err != nil {
+		return 0, err
+	}
+	config.FileSetValue(name, "service_account_keys", obscured)
+	config.SaveConfig()
+	return n, nil
+}
@@ -0,0 +1,49 @@
+package drive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rclone/rclone/fs/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbedServiceAccounts(t *testing.T) {
+	dir := t.TempDir()
+	key := `{"type":"service_account","client_email":"embed@p.iam.gserviceaccount.com","private_key":"` + testPrivateKey + `"}`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "1.json"), []byte(key), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2.json"), []byte(`{}`), 0600))
+
+	// Saving the config mustn't touch the user's config file
+	oldPath := config.GetConfigPath()
+	require.NoError(t, config.SetConfigPath(filepath.Join(t.TempDir(), "rclone.conf")))
+	defer func() { _ = config.SetConfigPath(oldPath) }()
+
+	const remote = "TestEmbedServiceAccounts"
+	_, err := embedServiceAccounts(remote, dir)
+	assert.ErrorContains(t, err, "isn't in the config file")
+
+	config.FileSetValue(remote, "type", "drive")
+	defer config.LoadedData().DeleteSection(remote)
+	n, err := embedServiceAccounts(remote, dir)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	obscured, ok := config.FileGetValue(remote, "service_account_keys")
+	require.True(t, ok)
+	assert.NotContains(t, obscured, "private_key")
+
+	opt := &Options{ServiceAccountKeys: obscured, ServiceAccountFile: "config:embed@p.iam.gserviceaccount.com"}
+	assert.True(t, opt.usesServiceAccountPool())
+	names, err := loadEmbeddedServiceAccounts(opt)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"config:embed@p.iam.gserviceaccount.com"}, names)
+	creds, err := readServiceAccountFile(names[0])
+	require.NoError(t, err)
+	assert.JSONEq(t, key, string(creds))
+
+	_, err = loadEmbeddedServiceAccounts(&Options{ServiceAccountKeys: "not obscured"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,110 @@
+// Pre-flight estimate
+//
+// A transfer bigger than the pool can upload in a day stalls part way
+// through once the quota runs out, which is a bad time to find out that
+// more SAs were needed. EstimateTransfer works out from the size of a
+// transfer how many SAs it takes at saDailyQuota each and, from the state
+// of the destination's pool, whether it fits in the quota left today and
+// over how many days it will run otherwise.
+//
+// The SAs which aren't dead upload saDailyQuota each on the days after
+// today; stale and blacklisted SAs are counted there too as they will be
+// back by then. max_daily_transfer caps each day if set.
+package drive
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// TransferEstimate is what a transfer needs of the destination's pool.
+type TransferEstimate struct {
+	Size          int64 // bytes to transfer
+	SAsNeeded     int   // SAs it takes at their full daily quota
+	Pool          bool  // set if the destination is a drive remote
+	SAs           int   // SAs in the pool which aren't dead, 0 without a pool
+	QuotaLeft     int64 // bytes the pool can still upload today
+	SAsWithQuota  int   // SAs with quota left today
+	DailyCapacity int64 // bytes the pool can upload on a fresh day
+	Days          int   // days it will run for, counting today, -1 if it never finishes
+}
+
+// ceilDiv returns a/b rounded up.
+func ceilDiv(a, b int64) int64 {
+	return (a + b - 1) / b
+}
+
+// dailyCapacity returns how much the pool can upload on a fresh day and
+// with how many SAs.
+func (p *ServiceAccountPool) dailyCapacity() (capacity int64, sas int) {
+	p.mu.Lock()
+	for _, entry := range p.sas {
+		if _, dead := p.dead[entry.saPath]; !dead {
+			sas++
+		}
+	}
+	p.mu.Unlock()
+	capacity = int64(sas) * saDailyQuota
+	if p.MaxDailyTransfer >= 0 {
+		capacity = min(capacity, p.MaxDailyTransfer)
+	}
+	return capacity, sas
+}
+
+// EstimateTransfer estimates what transferring size bytes to f needs of
+// its pool. A drive remote without SAs counts as a pool of one account.
+func EstimateTransfer(f fs.Fs, size int64) TransferEstimate {
+	e := TransferEstimate{
+		Size:      size,
+		SAsNeeded: int(ceilDiv(size, saDailyQuota)),
+		Days:      -1,
+	}
+	df, ok := f.(*Fs)
+	if !ok {
+		return e
+	}
+	e.Pool = true
+	if pool := df.ServiceAccountFiles; pool != nil && pool.Len() > 0 {
+		e.QuotaLeft, e.SAsWithQuota = pool.quotaLeft()
+		e.DailyCapacity, e.SAs = pool.dailyCapacity()
+	} else {
+		// The account of the remote has the same limit as an SA
+		e.SAs, e.SAsWithQuota = 1, 1
+		e.QuotaLeft, e.DailyCapacity = saDailyQuota, saDailyQuota
+	}
+	switch {
+	case size <= e.QuotaLeft:
+		e.Days = 1
+	case e.DailyCapacity > 0:
+		e.Days = 1 + int(ceilDiv(size-e.QuotaLeft, e.DailyCapacity))
+	}
+	return e
+}
+
+// String describes the estimate for the user.
+func (e TransferEstimate) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Transfer size: %v, needing %d service accounts at %v a day each\n",
+		fs.SizeSuffix(e.Size).ByteUnit(), e.SAsNeeded, fs.SizeSuffix(saDailyQuota).ByteUnit())
+	if !e.Pool {
+		b.WriteString("The destination isn't a drive remote, so there is no pool to check\n")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "Pool: %d service accounts, %v a day, %v left today on %d of them\n",
+		e.SAs, fs.SizeSuffix(e.DailyCapacity).ByteUnit(), fs.SizeSuffix(e.QuotaLeft).ByteUnit(), e.SAsWithQuota)
+	switch {
+	case e.Days == 1:
+		b.WriteString("The transfer fits in the quota left today\n")
+	case e.Days < 0:
+		b.WriteString("The pool has no quota and the transfer will never finish - add service accounts\n")
+	default:
+		fmt.Fprintf(&b, "The transfer doesn't fit in the quota left today and will take %d days", e.Days)
+		if short := e.SAsNeeded - e.SAs; short > 0 && e.DailyCapacity == int64(e.SAs)*saDailyQuota {
+			fmt.Fprintf(&b, " - add %d service accounts to fit it in one day's quota", short)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
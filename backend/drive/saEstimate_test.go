@@ -0,0 +1,69 @@
+package drive
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateTransfer(t *testing.T) {
+	gib := int64(fs.Gibi)
+	p := newTestPool()
+	setFiles(p, "a.json", "b.json", "c.json", "d.json")
+	p.uploaded["a.json"] = 250 * gib
+	p.uploaded["b.json"] = saDailyQuota
+	p.dead["c.json"] = "deleted"
+	f := &Fs{ServiceAccountFiles: p}
+
+	// Fits in the 1250 GiB left today
+	e := EstimateTransfer(f, 1000*gib)
+	assert.Equal(t, TransferEstimate{
+		Size:          1000 * gib,
+		SAsNeeded:     2,
+		Pool:          true,
+		SAs:           3,
+		QuotaLeft:     1250 * gib,
+		SAsWithQuota:  2,
+		DailyCapacity: 2250 * gib,
+		Days:          1,
+	}, e)
+	assert.Contains(t, e.String(), "The transfer fits in the quota left today")
+
+	// 1250 GiB today then 2250 GiB a day
+	e = EstimateTransfer(f, 5000*gib)
+	assert.Equal(t, 7, e.SAsNeeded)
+	assert.Equal(t, 3, e.Days)
+	assert.Equal(t, `Transfer size: 4.883 TiB, needing 7 service accounts at 750 GiB a day each
+Pool: 3 service accounts, 2.197 TiB a day, 1.221 TiB left today on 2 of them
+The transfer doesn't fit in the quota left today and will take 3 days - add 4 service accounts to fit it in one day's quota
+`, e.String())
+
+	// max_daily_transfer caps each day, so more SAs don't help
+	p.MaxDailyTransfer = 1000 * gib
+	e = EstimateTransfer(f, 5000*gib)
+	assert.Equal(t, 1000*gib, e.DailyCapacity)
+	assert.Equal(t, 5, e.Days)
+	assert.NotContains(t, e.String(), "add")
+
+	p.MaxDailyTransfer = 0
+	e = EstimateTransfer(f, gib)
+	assert.Equal(t, -1, e.Days)
+	assert.Contains(t, e.String(), "will never finish")
+
+	// Without SAs the account of the remote is the pool
+	e = EstimateTransfer(&Fs{}, 1000*gib)
+	assert.Equal(t, 1, e.SAs)
+	assert.Equal(t, 2, e.Days)
+
+	// Other remotes have no pool
+	other, err := mockfs.NewFs(context.Background(), "other", "", nil)
+	require.NoError(t, err)
+	e = EstimateTransfer(other, 1000*gib)
+	assert.False(t, e.Pool)
+	assert.Equal(t, -1, e.Days)
+	assert.Contains(t, e.String(), "isn't a drive remote")
+}
@@ -0,0 +1,107 @@
+// Time to pool exhaustion
+//
+// On a long upload the question is less how long the job will take than
+// whether the pool will last that long. With sa_eta_interval the quota
+// left on the pool is logged with the stats every interval, along with
+// when it will run out at the current speed and whether what is left of
+// the job fits in it.
+//
+// Each SA is taken to have saDailyQuota to upload a day, less what it has
+// uploaded, unless it is dead, stale or blacklisted, in which case it has
+// none. max_daily_transfer caps the total if set.
+package drive
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/rc"
+)
+
+// saDailyQuota is how much one SA may upload a day
+const saDailyQuota = int64(750 * fs.Gibi)
+
+// poolEstimate is the quota left on the pool and what it means for the
+// running job.
+type poolEstimate struct {
+	quotaLeft int64   // bytes the pool can still upload
+	sas       int     // SAs with quota left
+	speed     float64 // current transfer speed in bytes/s
+	jobLeft   int64   // bytes of the job still to transfer, -1 if unknown
+}
+
+// quotaLeft returns how much the pool can still upload and with how many
+// SAs.
+func (p *ServiceAccountPool) quotaLeft() (left int64, sas int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, entry := range p.sas {
+		if _, dead := p.dead[entry.saPath]; dead || entry.isStale || isBlacklisted(entry.saPath) {
+			continue
+		}
+		if n := saDailyQuota - p.uploaded[entry.saPath]; n > 0 {
+			left += n
+			sas++
+		}
+	}
+	if p.MaxDailyTransfer >= 0 {
+		left = min(left, max(p.MaxDailyTransfer-p.dailyTransferred(), 0))
+	}
+	return left, sas
+}
+
+// estimate returns the pool estimate given the stats of the job.
+func (p *ServiceAccountPool) estimate(stats rc.Params) poolEstimate {
+	e := poolEstimate{jobLeft: -1}
+	e.quotaLeft, e.sas = p.quotaLeft()
+	e.speed, _ = stats["speed"].(float64)
+	total, _ := stats["totalBytes"].(int64)
+	done, _ := stats["bytes"].(int64)
+	if total > 0 {
+		e.jobLeft = max(total-done, 0)
+	}
+	return e
+}
+
+// String returns the line logged with the stats
+func (e poolEstimate) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Service accounts: %v quota left on %d SAs", fs.SizeSuffix(e.quotaLeft).ByteUnit(), e.sas)
+	if e.speed > 0 {
+		exhausted := time.Duration(float64(e.quotaLeft) / e.speed * float64(time.Second))
+		fmt.Fprintf(&b, ", exhausted in %v at %v/s", exhausted.Truncate(time.Second), fs.SizeSuffix(e.speed).ByteUnit())
+	}
+	switch {
+	case e.jobLeft < 0:
+	case e.jobLeft <= e.quotaLeft:
+		fmt.Fprintf(&b, " - the %v left of the job fits", fs.SizeSuffix(e.jobLeft).ByteUnit())
+	default:
+		fmt.Fprintf(&b, " - the job won't finish, %v of the %v left won't fit", fs.SizeSuffix(e.jobLeft-e.quotaLeft).ByteUnit(), fs.SizeSuffix(e.jobLeft).ByteUnit())
+	}
+	return b.String()
+}
+
+// StartEtaLog logs the pool estimate with the stats every interval until
+// the pool is closed.
+func (p *ServiceAccountPool) StartEtaLog(interval time.Duration) {
+	ci := fs.GetConfig(p.ctx)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.ctx.Done():
+				return
+			case <-ticker.C:
+				stats, err := accounting.GlobalStats().RemoteStats(true)
+				if err != nil {
+					continue
+				}
+				fs.LogLevelPrintf(ci.StatsLogLevel, nil, "%v", p.estimate(stats))
+			}
+		}
+	}()
+}
@@ -0,0 +1,40 @@
+package drive
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolQuotaLeft(t *testing.T) {
+	p := newTestPool()
+	setFiles(p, "a.json", "b.json", "c.json", "d.json")
+	p.uploaded["a.json"] = 250 * int64(fs.Gibi)
+	p.uploaded["b.json"] = saDailyQuota
+	p.dead["c.json"] = "deleted"
+	left, sas := p.quotaLeft()
+	assert.Equal(t, 1250*int64(fs.Gibi), left)
+	assert.Equal(t, 2, sas)
+
+	p.MaxDailyTransfer = 100
+	p.transfers[time.Now().Truncate(transferBucket)] = 40
+	left, _ = p.quotaLeft()
+	assert.Equal(t, int64(60), left)
+}
+
+func TestPoolEstimate(t *testing.T) {
+	p := newTestPool()
+	setFiles(p, "a.json")
+	e := p.estimate(rc.Params{"speed": float64(100 * fs.Mebi), "totalBytes": 2000 * int64(fs.Gibi), "bytes": 1000 * int64(fs.Gibi)})
+	assert.Equal(t, poolEstimate{quotaLeft: saDailyQuota, sas: 1, speed: float64(100 * fs.Mebi), jobLeft: 1000 * int64(fs.Gibi)}, e)
+	assert.Equal(t, "Service accounts: 750 GiB quota left on 1 SAs, exhausted in 2h8m0s at 100 MiB/s - the job won't finish, 250 GiB of the 1000 GiB left won't fit", e.String())
+
+	e.jobLeft = 10 * int64(fs.Gibi)
+	assert.Equal(t, "Service accounts: 750 GiB quota left on 1 SAs, exhausted in 2h8m0s at 100 MiB/s - the 10 GiB left of the job fits", e.String())
+
+	e = p.estimate(rc.Params{})
+	assert.Equal(t, "Service accounts: 750 GiB quota left on 1 SAs", e.String())
+}
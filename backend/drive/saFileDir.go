@@ -0,0 +1,35 @@
+// Service account directory as service_account_file
+//
+// service_account_file is the obvious option to point at the SAs, so it
+// is often given the folder of keys rather than one of them, which then
+// failed trying to read the folder as a key. A directory given there is
+// used as service_account_file_path instead and the first SA is picked
+// from it as if service_account_file had been left blank.
+package drive
+
+import (
+	"os"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/env"
+)
+
+// useServiceAccountFileDir moves service_account_file to
+// service_account_file_path in opt if it is a directory.
+func useServiceAccountFileDir(opt *Options) {
+	if opt.ServiceAccountFile == "" {
+		return
+	}
+	info, err := os.Stat(env.ShellExpand(opt.ServiceAccountFile))
+	if err != nil || !info.IsDir() {
+		return
+	}
+	dir := opt.ServiceAccountFile
+	opt.ServiceAccountFile = ""
+	if opt.ServiceAccountFilePath != "" && opt.ServiceAccountFilePath != dir {
+		fs.Logf(nil, "service_account_file %q is a directory - ignoring it and using service_account_file_path %q", dir, opt.ServiceAccountFilePath)
+		return
+	}
+	opt.ServiceAccountFilePath = dir
+	fs.Debugf(nil, "service_account_file %q is a directory - using it as service_account_file_path", dir)
+}
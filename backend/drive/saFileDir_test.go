@@ -0,0 +1,36 @@
+package drive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUseServiceAccountFileDir(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "1.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{}`), 0600))
+
+	opt := &Options{ServiceAccountFile: file}
+	useServiceAccountFileDir(opt)
+	assert.Equal(t, &Options{ServiceAccountFile: file}, opt)
+
+	opt = &Options{ServiceAccountFile: filepath.Join(dir, "missing.json")}
+	useServiceAccountFileDir(opt)
+	assert.Equal(t, filepath.Join(dir, "missing.json"), opt.ServiceAccountFile)
+
+	opt = &Options{ServiceAccountFile: dir}
+	useServiceAccountFileDir(opt)
+	assert.Equal(t, "", opt.ServiceAccountFile)
+	assert.Equal(t, dir, opt.ServiceAccountFilePath)
+	assert.True(t, opt.usesServiceAccountPool())
+
+	// service_account_file_path wins
+	opt = &Options{ServiceAccountFile: dir, ServiceAccountFilePath: "/other"}
+	useServiceAccountFileDir(opt)
+	assert.Equal(t, "", opt.ServiceAccountFile)
+	assert.Equal(t, "/other", opt.ServiceAccountFilePath)
+}
@@ -0,0 +1,49 @@
+// Loading large service account folders
+//
+// Load reads every key several times over: to check it against the
+// manifest, to validate it and to find its client_email for dedupe. One
+// key after the other that made startup grow with the size of the
+// folder, taking minutes for tens of thousands of keys. The reads and
+// parses are now spread over a pool of workers, each stage filling in
+// its results by index so the pool is built in the order of the files
+// and logs come out as before.
+package drive
+
+import (
+	"runtime"
+	"sync"
+)
+
+// saLoadWorkers is how many keys Load reads at once. Reading keys is
+// mostly waiting on the disk, so it is several per CPU.
+var saLoadWorkers = 8 * runtime.GOMAXPROCS(0)
+
+// forEachServiceAccount calls fn with the index and path of each of
+// files on up to saLoadWorkers goroutines, returning when they are all
+// done. fn is called concurrently, so it should only write to the i-th
+// entry of its results.
+func forEachServiceAccount(files []string, fn func(i int, file string)) {
+	workers := min(saLoadWorkers, len(files))
+	if workers <= 1 {
+		for i, file := range files {
+			fn(i, file)
+		}
+		return
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for range workers {
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i, files[i])
+			}
+		}()
+	}
+	for i := range files {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
@@ -0,0 +1,61 @@
+package drive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForEachServiceAccount(t *testing.T) {
+	oldWorkers := saLoadWorkers
+	defer func() { saLoadWorkers = oldWorkers }()
+
+	files := make([]string, 100)
+	for i := range files {
+		files[i] = fmt.Sprintf("sa%d.json", i)
+	}
+	for _, workers := range []int{0, 1, 3} {
+		saLoadWorkers = workers
+		var running, most atomic.Int32
+		got := make([]string, len(files))
+		forEachServiceAccount(files, func(i int, file string) {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+			}
+			time.Sleep(time.Millisecond)
+			got[i] = file
+		})
+		assert.Equal(t, files, got, "workers %d", workers)
+		assert.LessOrEqual(t, most.Load(), int32(max(workers, 1)), "workers %d", workers)
+	}
+	forEachServiceAccount(nil, func(int, string) { t.Fatal("called for no files") })
+}
+
+func TestLoadMany(t *testing.T) {
+	dir := t.TempDir()
+	const n = 2000
+	for i := range n {
+		// Every tenth key is a duplicate of the one before
+		email := fmt.Sprintf("sa%d@p.iam.gserviceaccount.com", i)
+		if i%10 == 9 {
+			email = fmt.Sprintf("sa%d@p.iam.gserviceaccount.com", i-1)
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("%04d.json", i)), []byte(`{"type":"service_account","client_email":"`+email+`"}`), 0600))
+	}
+	pool := newTestPool()
+	files, err := pool.Load(&Options{ServiceAccountFilePath: dir})
+	require.NoError(t, err)
+	assert.Len(t, files, n-n/10)
+
+	// Indexed in the order of the folder
+	for idx := range len(pool.sas) - 1 {
+		assert.Less(t, pool.sas[idx].saPath, pool.sas[idx+1].saPath)
+	}
+}
@@ -0,0 +1,106 @@
+// Service Account folder integrity manifest
+//
+// A SHA256SUMS file in the SA folder, in the format written by sha256sum,
+// lists the expected checksum of every key. When it is present Load checks
+// each key against it. Keys which don't match, or aren't listed, are logged
+// and kept unless service_account_manifest_strict is set, in which case
+// they are left out of the pool.
+package drive
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// saManifestName is the name of the checksum manifest in the SA folder
+const saManifestName = "SHA256SUMS"
+
+// readServiceAccountManifest parses the manifest in saFolder into a map
+// of file name to lower case hex SHA-256. It returns nil if there isn't
+// a manifest.
+func readServiceAccountManifest(saFolder string) (map[string]string, error) {
+	f, err := os.Open(filepath.Join(saFolder, saManifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open service account manifest: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sum, name, ok := strings.Cut(line, " ")
+		name = strings.TrimPrefix(strings.TrimLeft(name, " "), "*") // binary mode marker
+		if !ok || len(sum) != sha256.Size*2 || name == "" {
+			return nil, fmt.Errorf("service account manifest line %d: invalid entry", lineNo)
+		}
+		if _, err := hex.DecodeString(sum); err != nil {
+			return nil, fmt.Errorf("service account manifest line %d: invalid checksum: %w", lineNo, err)
+		}
+		sums[filepath.Base(name)] = strings.ToLower(sum)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read service account manifest: %w", err)
+	}
+	return sums, nil
+}
+
+// verifyServiceAccountManifest checks fileNames against the manifest in
+// saFolder, returning the files which may be used.
+//
+// If strict is set files which fail verification are dropped, otherwise
+// they are only logged.
+func verifyServiceAccountManifest(saFolder string, fileNames []string, strict bool) ([]string, error) {
+	sums, err := readServiceAccountManifest(saFolder)
+	if err != nil || sums == nil {
+		return fileNames, err
+	}
+	errs := make([]error, len(fileNames))
+	forEachServiceAccount(fileNames, func(i int, file string) {
+		errs[i] = verifyServiceAccountFile(file, sums)
+	})
+	verified := fileNames[:0:0]
+	for i, file := range fileNames {
+		if err := errs[i]; err != nil {
+			if strict {
+				fs.Errorf(nil, "Ignoring service account %q: %v", file, err)
+				continue
+			}
+			fs.Logf(nil, "Service account %q: %v", file, err)
+		}
+		verified = append(verified, file)
+	}
+	fs.Debugf(nil, "Verified %d/%d service account file(s) against %s", len(verified), len(fileNames), saManifestName)
+	return verified, nil
+}
+
+// verifyServiceAccountFile checks the SHA-256 of file against sums
+func verifyServiceAccountFile(file string, sums map[string]string) error {
+	want, ok := sums[filepath.Base(file)]
+	if !ok {
+		return fmt.Errorf("not listed in %s", saManifestName)
+	}
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	got := sha256.Sum256(buf)
+	if hex.EncodeToString(got[:]) != want {
+		return fmt.Errorf("checksum doesn't match %s - key is corrupted or has been modified", saManifestName)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package drive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyServiceAccountManifest(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, body string) string {
+		file := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(file, []byte(body), 0600))
+		return file
+	}
+	sum := func(body string) string {
+		s := sha256.Sum256([]byte(body))
+		return hex.EncodeToString(s[:])
+	}
+	good := write("1.json", `{"n":1}`)
+	tampered := write("2.json", `{"n":2, "evil":true}`)
+	unlisted := write("3.json", `{"n":3}`)
+	files := []string{good, tampered, unlisted}
+
+	// No manifest - everything passes
+	got, err := verifyServiceAccountManifest(dir, files, true)
+	require.NoError(t, err)
+	assert.Equal(t, files, got)
+
+	write(saManifestName, "# checksums\n"+sum(`{"n":1}`)+"  1.json\n"+sum(`{"n":2}`)+" *2.json\n")
+
+	got, err = verifyServiceAccountManifest(dir, files, false)
+	require.NoError(t, err)
+	assert.Equal(t, files, got)
+
+	got, err = verifyServiceAccountManifest(dir, files, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{good}, got)
+
+	// Load uses it too
+	pool := newTestPool()
+	_, err = pool.Load(&Options{ServiceAccountFilePath: dir, ServiceAccountFile: good, ServiceAccountManifestStrict: true})
+	require.NoError(t, err)
+	assert.Len(t, pool.sas, 1)
+
+	write(saManifestName, "nonsense\n")
+	_, err = verifyServiceAccountManifest(dir, files, false)
+	assert.ErrorContains(t, err, "line 1")
+}
@@ -0,0 +1,375 @@
+// Metrics sinks for the service account pool
+//
+// The pool and the drive backend report what they do (switches, rate limit
+// hits, service creation times, pool size) through the Metrics interface so
+// every counter ends up in one place whichever sink is configured.
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+)
+
+// Names of the metrics written by the pool and the drive backend
+const (
+	metricSwitches         = "sa_switches_total"                // SA changed after a rate limit
+	metricRolls            = "sa_rolls_total"                   // SA changed by rolling rotation
+	metricRateLimits       = "sa_rate_limits_total"             // SA excluded for rate limiting
+	metricFileRateLimits   = "sa_file_rate_limits_total"        // rate limits on a file, SA kept
+	metricReadRotations    = "sa_read_rotations_total"          // reads retried with a preloaded SA
+	metricExhausted        = "sa_pool_exhausted_total"          // no SA left to switch to
+	metricCreateTimeouts   = "sa_service_create_timeouts_total" // service creation timed out
+	metricDead             = "sa_dead_total"                    // SA marked dead for good
+	metricUnstaled         = "sa_unstaled_total"                // stale SA returned to rotation by a probe
+	metricProjectExhausted = "sa_project_exhausted_total"       // project's SAs blacklisted together
+	metricDailyLimit       = "sa_daily_transfer_limit_total"    // transfers refused by max_daily_transfer
+	metricCreateSeconds    = "sa_service_create_seconds"        // time taken to create a service
+	metricAvailable        = "sa_pool_available"                // SA files available for selection
+	metricPreloaded        = "sa_pool_preloaded"                // preloaded services held
+)
+
+// Metrics is a sink for the counters, observations and gauges produced
+// by the service account pool.
+//
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	// Inc adds one to the counter name
+	Inc(name string)
+	// Observe records value in the distribution name
+	Observe(name string, value float64)
+	// SetGauge sets the gauge name to value
+	SetGauge(name string, value float64)
+}
+
+// newMetrics returns the Metrics sink called kind.
+func newMetrics(kind string) (Metrics, error) {
+	switch strings.ToLower(kind) {
+	case "", "none":
+		return noopMetrics{}, nil
+	case "stats":
+		return NewMemoryMetrics(), nil
+	case "prometheus":
+		return newPrometheusMetrics(prometheus.DefaultRegisterer), nil
+	}
+	return nil, fmt.Errorf("unknown service account metrics sink %q", kind)
+}
+
+// ------------------------------------------------------------
+
+// noopMetrics discards everything.
+type noopMetrics struct{}
+
+func (noopMetrics) Inc(string)               {}
+func (noopMetrics) Observe(string, float64)  {}
+func (noopMetrics) SetGauge(string, float64) {}
+
+// ------------------------------------------------------------
+
+// observation summarises the values passed to Observe.
+type observation struct {
+	Count int64   `json:"count"`
+	Sum   float64 `json:"sum"`
+	Max   float64 `json:"max"`
+}
+
+// MemoryMetrics is an in-memory sink, the one the stats setting uses. The
+// metrics it keeps are added to core/stats with those of the transfers,
+// and returned by the sametrics backend command and the drive/sametrics
+// rc call.
+type MemoryMetrics struct {
+	mu           sync.Mutex
+	counters     map[string]int64
+	gauges       map[string]float64
+	observations map[string]observation
+}
+
+// NewMemoryMetrics makes an empty MemoryMetrics.
+func NewMemoryMetrics() *MemoryMetrics {
+	return &MemoryMetrics{
+		counters:     make(map[string]int64),
+		gauges:       make(map[string]float64),
+		observations: make(map[string]observation),
+	}
+}
+
+// Inc adds one to the counter name
+func (m *MemoryMetrics) Inc(name string) {
+	m.mu.Lock()
+	m.counters[name]++
+	m.mu.Unlock()
+}
+
+// Observe records value in the distribution name
+func (m *MemoryMetrics) Observe(name string, value float64) {
+	m.mu.Lock()
+	o := m.observations[name]
+	o.Count++
+	o.Sum += value
+	if value > o.Max {
+		o.Max = value
+	}
+	m.observations[name] = o
+	m.mu.Unlock()
+}
+
+// SetGauge sets the gauge name to value
+func (m *MemoryMetrics) SetGauge(name string, value float64) {
+	m.mu.Lock()
+	m.gauges[name] = value
+	m.mu.Unlock()
+}
+
+// Counter returns the current value of the counter name
+func (m *MemoryMetrics) Counter(name string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counters[name]
+}
+
+// Gauge returns the current value of the gauge name
+func (m *MemoryMetrics) Gauge(name string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.gauges[name]
+}
+
+// Values returns a copy of all the metrics, suitable for JSON encoding
+func (m *MemoryMetrics) Values() map[string]any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[string]any, len(m.counters)+len(m.gauges)+len(m.observations))
+	for name, v := range m.counters {
+		out[name] = v
+	}
+	for name, v := range m.gauges {
+		out[name] = v
+	}
+	for name, v := range m.observations {
+		out[name] = v
+	}
+	return out
+}
+
+// String returns the counters and gauges as a single line for logging
+func (m *MemoryMetrics) String() string {
+	values := m.Values()
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var out strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		switch v := values[name].(type) {
+		case observation:
+			fmt.Fprintf(&out, "%s=%d/%.3g", name, v.Count, v.Sum)
+		default:
+			fmt.Fprintf(&out, "%s=%v", name, v)
+		}
+	}
+	return out.String()
+}
+
+// liveStats holds the names of the remotes of the pools in use with
+// MemoryMetrics, for core/stats and the drive/sametrics rc call.
+var liveStats = struct {
+	mu    sync.Mutex
+	pools map[*ServiceAccountPool]string
+}{pools: make(map[*ServiceAccountPool]string)}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:  "drive/sametrics",
+		Fn:    rcSaMetrics,
+		Title: "Show the service account pool metrics of the drive remotes in use",
+		Help: `
+Returns the counters, gauges and observations the service account pools
+of the drive remotes in use have recorded so far, as the sametrics
+backend command does for one remote. Only pools with
+service_account_metrics = stats (the default) keep them, and core/stats
+returns them too, as serviceAccounts.
+
+Params:
+  - remote = the name of the remote to show, eg "drive" (optional)
+
+Returns:
+  - pools = a list of the pools, each with
+    - remote = the name of its remote
+    - metrics = the metrics, by name
+
+Eg
+
+    eclone rc drive/sametrics
+    eclone rc drive/sametrics remote=drive
+`,
+	})
+	addToCoreStats()
+}
+
+// publishMetrics makes the metrics of p, the pool of the remote called
+// name, available to core/stats and the drive/sametrics rc call until p
+// is closed.
+func (p *ServiceAccountPool) publishMetrics(name string) {
+	if _, ok := p.Metrics.(*MemoryMetrics); !ok {
+		return
+	}
+	liveStats.mu.Lock()
+	liveStats.pools[p] = name
+	liveStats.mu.Unlock()
+}
+
+// unpublishMetrics undoes publishMetrics.
+func (p *ServiceAccountPool) unpublishMetrics() {
+	liveStats.mu.Lock()
+	delete(liveStats.pools, p)
+	liveStats.mu.Unlock()
+}
+
+// rcSaMetrics implements the drive/sametrics rc call.
+func rcSaMetrics(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	remote, err := in.GetString("remote")
+	if err != nil && !rc.IsErrParamNotFound(err) {
+		return nil, err
+	}
+	return rc.Params{"pools": livePools(remote)}, nil
+}
+
+// livePools returns the metrics of the published pools of remote, or of
+// all of them if remote is "", sorted by remote.
+func livePools(remote string) []rc.Params {
+	liveStats.mu.Lock()
+	pools := []rc.Params{}
+	for p, name := range liveStats.pools {
+		if remote == "" || name == remote {
+			pools = append(pools, rc.Params{"remote": name, "metrics": p.Metrics.(*MemoryMetrics).Values()})
+		}
+	}
+	liveStats.mu.Unlock()
+	sort.SliceStable(pools, func(i, j int) bool {
+		return pools[i]["remote"].(string) < pools[j]["remote"].(string)
+	})
+	return pools
+}
+
+// addToCoreStats makes core/stats return the metrics of the published
+// pools as serviceAccounts, in the format of drive/sametrics, along with
+// the stats of the transfers.
+func addToCoreStats() {
+	call := rc.Calls.Get("core/stats")
+	if call == nil {
+		return
+	}
+	coreStats := call.Fn
+	call.Fn = func(ctx context.Context, in rc.Params) (rc.Params, error) {
+		out, err := coreStats(ctx, in)
+		if err != nil {
+			return out, err
+		}
+		if pools := livePools(""); len(pools) > 0 {
+			out["serviceAccounts"] = pools
+		}
+		return out, nil
+	}
+}
+
+// ------------------------------------------------------------
+
+// prometheusMetrics registers a collector per metric name on first use.
+//
+// Metrics are prefixed with "eclone_drive_" and land on the rc metrics
+// endpoint when registered with the default registerer.
+type prometheusMetrics struct {
+	reg        prometheus.Registerer
+	mu         sync.Mutex
+	counters   map[string]prometheus.Counter
+	histograms map[string]prometheus.Histogram
+	gauges     map[string]prometheus.Gauge
+}
+
+func newPrometheusMetrics(reg prometheus.Registerer) *prometheusMetrics {
+	return &prometheusMetrics{
+		reg:        reg,
+		counters:   make(map[string]prometheus.Counter),
+		histograms: make(map[string]prometheus.Histogram),
+		gauges:     make(map[string]prometheus.Gauge),
+	}
+}
+
+// register c, returning the already registered collector if there is one
+func (m *prometheusMetrics) register(c prometheus.Collector) prometheus.Collector {
+	if err := m.reg.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			return are.ExistingCollector
+		}
+		fs.Errorf(nil, "Failed to register service account metric: %v", err)
+	}
+	return c
+}
+
+func prometheusName(name string) string {
+	return "eclone_drive_" + name
+}
+
+// Inc adds one to the counter name
+func (m *prometheusMetrics) Inc(name string) {
+	m.mu.Lock()
+	c, ok := m.counters[name]
+	if !ok {
+		c = m.register(prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheusName(name),
+			Help: "Service account pool counter " + name,
+		})).(prometheus.Counter)
+		m.counters[name] = c
+	}
+	m.mu.Unlock()
+	c.Inc()
+}
+
+// Observe records value in the distribution name
+func (m *prometheusMetrics) Observe(name string, value float64) {
+	m.mu.Lock()
+	h, ok := m.histograms[name]
+	if !ok {
+		h = m.register(prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name: prometheusName(name),
+			Help: "Service account pool distribution " + name,
+		})).(prometheus.Histogram)
+		m.histograms[name] = h
+	}
+	m.mu.Unlock()
+	h.Observe(value)
+}
+
+// SetGauge sets the gauge name to value
+func (m *prometheusMetrics) SetGauge(name string, value float64) {
+	m.mu.Lock()
+	g, ok := m.gauges[name]
+	if !ok {
+		g = m.register(prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: prometheusName(name),
+			Help: "Service account pool gauge " + name,
+		})).(prometheus.Gauge)
+		m.gauges[name] = g
+	}
+	m.mu.Unlock()
+	g.Set(value)
+}
+
+// Check the interfaces are satisfied
+var (
+	_ Metrics = noopMetrics{}
+	_ Metrics = (*MemoryMetrics)(nil)
+	_ Metrics = (*prometheusMetrics)(nil)
+)
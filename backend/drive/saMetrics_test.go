@@ -0,0 +1,120 @@
+package drive
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMetrics(t *testing.T) {
+	for _, test := range []struct {
+		kind    string
+		want    Metrics
+		wantErr bool
+	}{
+		{"", noopMetrics{}, false},
+		{"none", noopMetrics{}, false},
+		{"Stats", &MemoryMetrics{}, false},
+		{"prometheus", &prometheusMetrics{}, false},
+		{"potato", nil, true},
+	} {
+		got, err := newMetrics(test.kind)
+		if test.wantErr {
+			assert.Error(t, err, test.kind)
+			continue
+		}
+		require.NoError(t, err, test.kind)
+		assert.IsType(t, test.want, got, test.kind)
+	}
+}
+
+func TestMemoryMetrics(t *testing.T) {
+	m := NewMemoryMetrics()
+	m.Inc(metricSwitches)
+	m.Inc(metricSwitches)
+	m.SetGauge(metricAvailable, 7)
+	m.Observe(metricCreateSeconds, 0.5)
+	m.Observe(metricCreateSeconds, 1.5)
+
+	assert.Equal(t, int64(2), m.Counter(metricSwitches))
+	assert.Equal(t, 7.0, m.Gauge(metricAvailable))
+	assert.Equal(t, observation{Count: 2, Sum: 2, Max: 1.5}, m.Values()[metricCreateSeconds])
+	assert.Equal(t, "sa_pool_available=7, sa_service_create_seconds=2/2, sa_switches_total=2", m.String())
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := newPrometheusMetrics(reg)
+	m.Inc(metricRateLimits)
+	m.Inc(metricRateLimits)
+	m.SetGauge(metricPreloaded, 3)
+	m.Observe(metricCreateSeconds, 0.25)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.counters[metricRateLimits]))
+	assert.Equal(t, 3.0, testutil.ToFloat64(m.gauges[metricPreloaded]))
+
+	// A second sink on the same registry shares the collectors
+	m2 := newPrometheusMetrics(reg)
+	m2.Inc(metricRateLimits)
+	assert.Equal(t, 3.0, testutil.ToFloat64(m.counters[metricRateLimits]))
+}
+
+func TestPoolMetrics(t *testing.T) {
+	m := NewMemoryMetrics()
+	pool := newTestPool()
+	pool.Metrics = m
+	setFiles(pool, "/sa/sa1.json", "/sa/sa2.json")
+	defer serviceAccountBlacklist.Delete("/sa/sa1.json")
+
+	_, err := pool.GetFile("/sa/sa1.json")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), m.Counter(metricRateLimits))
+	assert.Equal(t, 1.0, m.Gauge(metricAvailable))
+
+	pool.AddService(nil, nil)
+	assert.Equal(t, 1.0, m.Gauge(metricPreloaded))
+	require.NoError(t, pool.Close())
+	assert.Equal(t, 0.0, m.Gauge(metricPreloaded))
+}
+
+func TestRcSaMetrics(t *testing.T) {
+	ctx := context.Background()
+	one, two := newTestPool(), newTestPool()
+	one.Metrics, two.Metrics = NewMemoryMetrics(), NewMemoryMetrics()
+	one.Metrics.Inc(metricSwitches)
+	one.publishMetrics("rcone")
+	two.publishMetrics("rctwo")
+	none := newTestPool()
+	none.publishMetrics("rcnone") // noopMetrics aren't kept
+
+	call := rc.Calls.Get("drive/sametrics")
+	require.NotNil(t, call)
+	out, err := call.Fn(ctx, rc.Params{"remote": "rcone"})
+	require.NoError(t, err)
+	pools := out["pools"].([]rc.Params)
+	require.Len(t, pools, 1)
+	assert.Equal(t, "rcone", pools[0]["remote"])
+	assert.Equal(t, int64(1), pools[0]["metrics"].(map[string]any)[metricSwitches])
+
+	out, err = call.Fn(ctx, rc.Params{"remote": "rcnone"})
+	require.NoError(t, err)
+	assert.Empty(t, out["pools"])
+
+	// core/stats has them along with the stats of the transfers
+	out, err = rc.Calls.Get("core/stats").Fn(ctx, rc.Params{})
+	require.NoError(t, err)
+	assert.Contains(t, out, "transfers")
+	assert.Contains(t, out["serviceAccounts"], rc.Params{"remote": "rcone", "metrics": one.Metrics.(*MemoryMetrics).Values()})
+
+	// Closed pools are gone
+	require.NoError(t, one.Close())
+	out, err = call.Fn(ctx, rc.Params{"remote": "rcone"})
+	require.NoError(t, err)
+	assert.Empty(t, out["pools"])
+	require.NoError(t, two.Close())
+}
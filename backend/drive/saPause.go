@@ -0,0 +1,102 @@
+// Pausing when the pool is exhausted
+//
+// Once every SA of the pool is blacklisted the transfers keep retrying
+// with the current one until they run out of retries and fail, and the
+// run has to be started again the next day, listing everything again and
+// preloading the pool from scratch.
+//
+// With exhausted_pause set the first transfer to find the pool exhausted
+// waits instead, until the first SA comes off the blacklist, as long as
+// that is within exhausted_pause, and then retries. The others finding
+// the pool exhausted meanwhile wait for it, so the whole run pauses and
+// carries on where it was, its preloaded services refreshing their tokens
+// on first use.
+package drive
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// pausing counts the transfers waiting in pauseExhausted
+var pausing atomic.Int32
+
+// Pausing returns true while a transfer is paused waiting for the pool to
+// come off the blacklist, so the run isn't taken to be hung.
+func Pausing() bool {
+	return pausing.Load() > 0
+}
+
+// nextRelease returns how long until the first blacklisted SA of the pool
+// comes off the blacklist, or false if none is blacklisted.
+func (p *ServiceAccountPool) nextRelease() (next time.Duration, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, entry := range p.sas {
+		if _, dead := p.dead[entry.saPath]; dead {
+			continue
+		}
+		blackTime, blacklisted := serviceAccountBlacklist.Load(entry.saPath)
+		if !blacklisted {
+			continue
+		}
+		left := max(blacklistLeft(blackTime.(time.Time)), 0)
+		if !ok || left < next {
+			next, ok = left, true
+		}
+	}
+	return next, ok
+}
+
+// usable returns true if GetFile has an SA to pick.
+func (p *ServiceAccountPool) usable() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, entry := range p.sas {
+		if entry.available && !isBlacklisted(entry.saPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// pauseExhausted waits, when the pool is exhausted and exhausted_pause is
+// set, until the first SA comes off the blacklist if that is soon enough,
+// and returns whether it did. Only one caller waits at a time, the others
+// waiting for it.
+func (f *Fs) pauseExhausted(ctx context.Context) bool {
+	limit := time.Duration(f.opt.ExhaustedPause)
+	if limit <= 0 {
+		return false
+	}
+	f.exhaustedMu.Lock()
+	defer f.exhaustedMu.Unlock()
+	pool := f.ServiceAccountFiles
+	if pool.usable() {
+		// Another caller has waited already
+		return true
+	}
+	wait, ok := pool.nextRelease()
+	if !ok {
+		return false
+	}
+	if wait > limit {
+		fs.Errorf(f, "Service account pool exhausted until %v, longer than exhausted_pause %v - not pausing", time.Now().Add(wait).Round(time.Second), limit)
+		return false
+	}
+	fs.Logf(f, "Service account pool exhausted - pausing for %v until %v", wait.Round(time.Second), time.Now().Add(wait).Round(time.Second))
+	pausing.Add(1)
+	defer pausing.Add(-1)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+	}
+	fs.Logf(f, "Service account coming off the blacklist - resuming")
+	return true
+}
@@ -0,0 +1,71 @@
+package drive
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextRelease(t *testing.T) {
+	p := newTestPool()
+	setFiles(p, "pause-a", "pause-b", "pause-c")
+	defer func() {
+		for _, file := range []string{"pause-a", "pause-b", "pause-c"} {
+			serviceAccountBlacklist.Delete(file)
+		}
+	}()
+	_, ok := p.nextRelease()
+	assert.False(t, ok)
+	assert.True(t, p.usable())
+
+	now := time.Now()
+	blacklistSA("pause-a", now.Add(-time.Hour))
+	blacklistSA("pause-b", now.Add(-3*time.Hour))
+	assert.True(t, p.usable())
+	blacklistSA("pause-c", now)
+	assert.False(t, p.usable())
+	next, ok := p.nextRelease()
+	require.True(t, ok)
+	assert.InDelta(t, float64(blacklistDuration-3*time.Hour), float64(next), float64(time.Minute))
+
+	// Dead SAs never come back
+	p.MarkDead("pause-b", "deleted")
+	next, ok = p.nextRelease()
+	require.True(t, ok)
+	assert.InDelta(t, float64(blacklistDuration-time.Hour), float64(next), float64(time.Minute))
+}
+
+func TestPauseExhausted(t *testing.T) {
+	ctx := context.Background()
+	p := newTestPool()
+	setFiles(p, "pause-d")
+	defer serviceAccountBlacklist.Delete("pause-d")
+	f := &Fs{ServiceAccountFiles: p, exhaustedMu: new(sync.Mutex)}
+
+	blacklistSA("pause-d", time.Now())
+	assert.False(t, f.pauseExhausted(ctx), "exhausted_pause not set")
+	f.opt.ExhaustedPause = fs.Duration(time.Hour)
+	assert.False(t, f.pauseExhausted(ctx), "released too late")
+
+	// Released in a moment
+	blacklistSA("pause-d", time.Now().Add(-blacklistDuration+50*time.Millisecond))
+	start := time.Now()
+	paused := make(chan bool)
+	go func() { paused <- f.pauseExhausted(ctx) }()
+	assert.Eventually(t, Pausing, time.Second, time.Millisecond)
+	assert.True(t, <-paused)
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+	assert.False(t, Pausing())
+	assert.True(t, p.usable())
+	assert.True(t, f.pauseExhausted(ctx), "already released")
+
+	blacklistSA("pause-d", time.Now().Add(-blacklistDuration+time.Minute))
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.False(t, f.pauseExhausted(cancelled))
+}
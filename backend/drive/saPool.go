@@ -18,32 +18,108 @@ package drive
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
 	"math/rand"
 	"net/http"
 	"os"
 	"path"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/lib/env"
+	"golang.org/x/oauth2"
 	drive "google.golang.org/api/drive/v3"
 )
 
 // serviceAccountBlacklist tracks SA files that hit rate limits.
 // Keys are file paths (string), values are time.Time of when they were blacklisted.
-// Entries expire after 25 hours, aligning with Google's daily quota reset.
+// Entries expire after 25 hours, aligning with Google's daily quota reset,
+// or at the reset itself with blacklist_until_reset (see blacklistExpiry).
+//
+// Values always carry a monotonic clock reading (see blacklistSA) so NTP
+// adjustments and other wall clock jumps don't change when they expire.
 var serviceAccountBlacklist sync.Map
 
 const blacklistDuration = 25 * time.Hour
 
-// SaEntry represents a single service account file with its stale state.
-// The isStale flag is used by rollup() to skip exhausted SAs during sequential rotation.
+// blacklistSA blacklists file as of the wall clock time at.
+//
+// at is only used as an anchor for how long ago the SA was blacklisted,
+// which matters for entries carried over from a previous run. The stored
+// time is rebuilt from the monotonic clock so from then on expiry only
+// depends on elapsed time. Anchors in the future count as now, and entries
+// which have already expired are not stored.
+func blacklistSA(file string, at time.Time) {
+	now := time.Now()
+	since := now.Add(-max(now.Round(0).Sub(at.Round(0)), 0))
+	if !now.Before(blacklistExpiry(since)) {
+		return
+	}
+	serviceAccountBlacklist.Store(file, since)
+}
+
+// blacklistElapsed returns how long ago t, a blacklist time, was.
+func blacklistElapsed(t time.Time) time.Duration {
+	return max(time.Since(t), 0)
+}
+
+// isBlacklisted returns true if file is blacklisted, clearing its entry if
+// the blacklist has expired.
+func isBlacklisted(file string) bool {
+	blackTime, ok := serviceAccountBlacklist.Load(file)
+	if !ok {
+		return false
+	}
+	if blacklistLeft(blackTime.(time.Time)) < 0 {
+		serviceAccountBlacklist.Delete(file)
+		return false
+	}
+	return true
+}
+
+// blacklistAnchor returns the wall clock time to persist for the blacklist
+// time t, derived from the monotonic time elapsed since it.
+func blacklistAnchor(t time.Time) time.Time {
+	return time.Now().Add(-blacklistElapsed(t)).Round(0)
+}
+
+// serviceAccountCredentials holds SA keys which only exist in memory, such
+// as those loaded from Vault or the SA bundle. Keys are the pseudo paths
+// which stand in for file paths in the pool, values are the JSON key as
+// []byte.
+var serviceAccountCredentials sync.Map
+
+// Errors returned by the pool. Callers should compare with errors.Is.
+var (
+	// ErrPoolEmpty is returned when the pool has no SA files left to pick from.
+	ErrPoolEmpty = errors.New("no available service account file")
+	// ErrAllBlacklisted is returned when every SA file left in the pool is
+	// blacklisted. It wraps ErrPoolEmpty.
+	ErrAllBlacklisted = fmt.Errorf("%w (all blacklisted)", ErrPoolEmpty)
+	// ErrNoPreloaded is returned when there are no preloaded services to hand out.
+	ErrNoPreloaded = errors.New("no available preloaded services")
+)
+
+// maxServiceTimeouts is the number of times creating a service for an SA
+// may time out before that SA is blacklisted.
+const maxServiceTimeouts = 3
+
+// SaEntry is the pool's record of a single service account file.
+//
+// Both rotation strategies work off the same entries: rollup() and
+// randomPick() skip stale ones and GetFile() only hands out available ones.
+// Taking an SA out of rotation on either path clears both flags so the two
+// can't drift apart.
 type SaEntry struct {
-	saPath  string
-	isStale bool
+	saPath    string
+	isStale   bool // skipped by sequential rollup and staleSa
+	available bool // may be picked by GetFile
 }
 
 // ServiceAccountInfo holds a pre-created Drive service and its HTTP client,
@@ -51,6 +127,7 @@ type SaEntry struct {
 type ServiceAccountInfo struct {
 	Service *drive.Service
 	Client  *http.Client
+	File    string // the SA file, if known
 }
 
 // ServiceAccountPool manages service account files and preloaded services.
@@ -60,77 +137,188 @@ type ServiceAccountInfo struct {
 //   - Random selection with blacklist (from fclone): picks random SA, skipping
 //     recently-exhausted ones via GetFile()
 //
+// Both strategies share a single SaEntry per SA.
+//
 // The pool also maintains a slice of pre-created ServiceAccountInfo for instant
 // SA switches without OAuth setup overhead.
 type ServiceAccountPool struct {
-	// --- From gclone: sequential rollup support ---
-	sas       map[int]SaEntry  // indexed SA entries for rollup
-	activeIdx int              // current active index in sas
-	saPool    map[string]int   // reverse lookup: path → index
-
-	// --- From fclone: preloaded services + file pool ---
-	ctx   context.Context
-	Files map[string]struct{} // available SA file paths (for GetFile)
-	Max   int                 // max preloaded services to keep
-	svcs  []ServiceAccountInfo
-	mu    *sync.Mutex
+	// --- SA entries shared by both rotation strategies ---
+	sas       map[int]SaEntry // SA entries by index, in rollup order
+	order     []int           // indexes of sas, sorted, for the random picks
+	activeIdx int             // current active index in sas
+	saIndex   map[string]int  // reverse lookup: path → index
+
+	// --- From fclone: preloaded services ---
+	ctx    context.Context
+	cancel context.CancelFunc // cancels ctx, stopping any preloading
+	Max    int                // max preloaded services to keep
+	svcs   []ServiceAccountInfo
+	mu     *sync.Mutex
+	ring   atomic.Pointer[[]ServiceAccountInfo] // svcs, for nextService
+	turn   atomic.Uint64                        // counts nextService picks
+
+	// StateFile, if set, is where Close saves the pool state
+	StateFile string
+	// Metrics receives the pool's counters and gauges
+	Metrics Metrics
+	// Factory creates the Drive services for preloading
+	Factory ServiceFactory
+	// MaxDailyTransfer is how many bytes may be transferred with the pool
+	// in 24 hours, < 0 for no limit
+	MaxDailyTransfer int64
+
+	rateLimitHits  map[string]int64           // times each SA was excluded by GetFile
+	uploaded       map[string]int64           // bytes uploaded with each SA
+	deleted        map[string]int64           // files and directories deleted with each SA
+	createTimeouts map[string]int             // times creating each SA's service timed out
+	dead           map[string]string          // SAs which can never be used again, with why
+	projects       map[string]string          // project_id of each SA, cached
+	clientEmails   map[string]string          // client_email of each SA, cached
+	quotaFailures  map[string][]quotaFailure  // recent quota errors by project
+	shared         *sharedStateFile           // state shared with other processes, if any
+	claimed        string                     // SA claimed in the shared state
+	reads          map[*http.Client]*readLoad // reads in flight by preloaded client
+	readSeq        uint64                     // counts ReadClient picks
+	transfers      map[time.Time]int64        // bytes transferred with any SA by hour
+	creds          map[string]saCredentials   // parsed keys by file
+	rand           *rand.Rand                 // picks SAs, guarded by mu
+	exhaustedHooks map[int]func()             // called when no SA is left, by id
+	nextHook       int                        // id of the next exhausted hook
 }
 
 // NewServiceAccountPool creates a new empty pool.
 // max controls how many preloaded services to keep in memory.
 func NewServiceAccountPool(ctx context.Context, max int) *ServiceAccountPool {
-	return &ServiceAccountPool{
-		sas:    make(map[int]SaEntry),
-		saPool: make(map[string]int),
-		ctx:    ctx,
-		Files:  make(map[string]struct{}),
-		Max:    max,
-		mu:     new(sync.Mutex),
+	ctx, cancel := context.WithCancel(ctx)
+	p := &ServiceAccountPool{
+		sas:     make(map[int]SaEntry),
+		saIndex: make(map[string]int),
+		ctx:     ctx,
+		cancel:  cancel,
+		Max:     max,
+		mu:      new(sync.Mutex),
+		Metrics: noopMetrics{},
+
+		MaxDailyTransfer: -1,
+
+		rateLimitHits:  make(map[string]int64),
+		uploaded:       make(map[string]int64),
+		deleted:        make(map[string]int64),
+		createTimeouts: make(map[string]int),
+		dead:           make(map[string]string),
+		projects:       make(map[string]string),
+		clientEmails:   make(map[string]string),
+		quotaFailures:  make(map[string][]quotaFailure),
+		transfers:      make(map[time.Time]int64),
+		creds:          make(map[string]saCredentials),
+		rand:           rand.New(rand.NewSource(rand.Int63())),
+	}
+	p.Factory = ServiceFactoryFunc(p.createDriveService)
+	return p
+}
+
+// OnExhausted calls fn whenever a rate limit leaves no SA to switch to,
+// until the returned function is called. The pool is shared by every
+// remote using it, so each user registers a hook of its own.
+func (p *ServiceAccountPool) OnExhausted(fn func()) (unregister func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.exhaustedHooks == nil {
+		p.exhaustedHooks = make(map[int]func())
+	}
+	id := p.nextHook
+	p.nextHook++
+	p.exhaustedHooks[id] = fn
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(p.exhaustedHooks, id)
 	}
 }
 
+// exhausted calls the hooks registered with OnExhausted, without the
+// pool locked so they may use it.
+func (p *ServiceAccountPool) exhausted() {
+	p.mu.Lock()
+	hooks := slices.Collect(maps.Values(p.exhaustedHooks))
+	p.mu.Unlock()
+	for _, fn := range hooks {
+		fn()
+	}
+}
+
+// Seed makes the random picks of the pool repeat for seed, for tests.
+func (p *ServiceAccountPool) Seed(seed int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rand.Seed(seed)
+}
+
 // =====================================================================
 // gclone-compatible methods (sequential rollup, stale tracking)
 // =====================================================================
 
 // updateSas initializes the SA index from a list of file paths.
-// If activeSa is not in the list, it gets appended.
+// If activeSa is not in the list, it gets appended. Every SA but activeSa,
+// which is already in use, is made available to GetFile.
 func (p *ServiceAccountPool) updateSas(data []string, activeSa string) {
-	if len(data) == 0 || activeSa == "" {
-		return
+	p.sas = make(map[int]SaEntry, len(data)+1)
+	p.order = make([]int, 0, len(data)+1)
+	p.saIndex = make(map[string]int, len(data)+1)
+	p.activeIdx = -1
+	for _, v := range data {
+		idx := p.addSa(v)
+		if v != activeSa {
+			p.setAvailable(idx, true)
+		}
+	}
+	if activeSa != "" {
+		p.activeIdx = p.addSa(activeSa)
+	}
+}
+
+// addSa returns the index of saPath, adding a fresh entry for it after
+// the others if it isn't known yet.
+func (p *ServiceAccountPool) addSa(saPath string) int {
+	if idx, ok := p.saIndex[saPath]; ok {
+		return idx
+	}
+	idx := 0
+	if n := len(p.order); n > 0 {
+		idx = p.order[n-1] + 1
 	}
-	convSas := make(map[int]SaEntry)
-	convData := make(map[string]int)
+	p.sas[idx] = SaEntry{saPath: saPath}
+	p.order = append(p.order, idx)
+	p.saIndex[saPath] = idx
+	return idx
+}
 
-	for i, v := range data {
-		convSas[i] = SaEntry{saPath: v, isStale: false}
-		convData[v] = i
+// setAvailable sets whether the entry at idx may be picked by GetFile.
+func (p *ServiceAccountPool) setAvailable(idx int, available bool) {
+	if entry, ok := p.sas[idx]; ok {
+		entry.available = available
+		p.sas[idx] = entry
 	}
-	p.sas = convSas
-	p.saPool = convData
+}
 
-	if result := p.findIdxByStrInPool(activeSa); result != -1 {
-		p.activeIdx = result
-	} else {
-		existLen := len(p.sas)
-		p.sas[existLen] = SaEntry{saPath: activeSa, isStale: false}
-		p.saPool[activeSa] = existLen
-		p.activeIdx = existLen
+// retireSa takes saPath out of both rotations: it is marked stale so
+// rollup skips it and made unavailable so GetFile won't pick it.
+func (p *ServiceAccountPool) retireSa(saPath string) {
+	if idx, ok := p.saIndex[saPath]; ok {
+		p.sas[idx] = SaEntry{saPath: saPath, isStale: true}
 	}
 }
 
 func (p *ServiceAccountPool) findIdxByStrInPool(str string) int {
-	if idx, ok := p.saPool[str]; ok {
+	if idx, ok := p.saIndex[str]; ok && !p.sas[idx].isStale {
 		return idx
 	}
 	return -1
 }
 
 func (p *ServiceAccountPool) findIdxByStr(str string) int {
-	for k, v := range p.sas {
-		if v.saPath == str {
-			return k
-		}
+	if idx, ok := p.saIndex[str]; ok {
+		return idx
 	}
 	return -1
 }
@@ -158,8 +346,8 @@ func (p *ServiceAccountPool) rollup() string {
 
 // activeSa sets the active index to the given SA path.
 func (p *ServiceAccountPool) activeSa(saPath string) {
-	if entry, ok := p.saPool[saPath]; ok {
-		p.activeIdx = entry
+	if idx := p.findIdxByStrInPool(saPath); idx != -1 {
+		p.activeIdx = idx
 	}
 }
 
@@ -170,12 +358,7 @@ func (p *ServiceAccountPool) staleSa(target string) (bool, string) {
 	if target == "" {
 		target = p.sas[p.activeIdx].saPath
 	}
-	oldIdx := p.saPool[target]
-	if entry, ok := p.sas[oldIdx]; ok {
-		entry.isStale = true
-		p.sas[oldIdx] = entry
-	}
-	delete(p.saPool, target)
+	p.retireSa(target)
 	if p.isPoolEmpty() {
 		p.activeIdx = -1
 		return true, ""
@@ -187,38 +370,48 @@ func (p *ServiceAccountPool) staleSa(target string) (bool, string) {
 	return true, ""
 }
 
-// randomPick selects a random index from the non-stale SA pool.
+// randomPick selects a random index from the non-stale SA pool - call
+// with p.mu held.
 func (p *ServiceAccountPool) randomPick() int {
-	existLen := len(p.saPool)
-	if existLen == 0 {
+	// In index order, so a seeded pool picks the same
+	live := make([]int, 0, len(p.order))
+	for _, idx := range p.order {
+		if !p.sas[idx].isStale {
+			live = append(live, idx)
+		}
+	}
+	if len(live) == 0 {
 		return -1
 	}
+	return live[p.rand.Intn(len(live))]
+}
 
-	r := rand.Intn(existLen)
-	for _, v := range p.saPool {
-		if r == 0 {
-			return v
+// liveCount returns the number of non-stale SAs.
+func (p *ServiceAccountPool) liveCount() (n int) {
+	for _, entry := range p.sas {
+		if !entry.isStale {
+			n++
 		}
-		r--
 	}
-	return -1
+	return n
 }
 
 // isPoolEmpty returns true if no non-stale SAs remain.
 func (p *ServiceAccountPool) isPoolEmpty() bool {
-	return len(p.saPool) == 0
+	return p.liveCount() == 0
 }
 
 // revertStaleSa un-stales a previously staled SA, returning it to the pool.
+// It is only made available to GetFile again if it isn't blacklisted or dead.
 func (p *ServiceAccountPool) revertStaleSa(target string) {
 	if target == "" {
 		return
 	}
 	if oldIdx := p.findIdxByStr(target); oldIdx != -1 {
-		if entry, ok := p.sas[oldIdx]; ok {
-			entry.isStale = false
-			p.saPool[target] = oldIdx
-			p.sas[oldIdx] = entry
+		_, dead := p.dead[target]
+		p.sas[oldIdx] = SaEntry{
+			saPath:    target,
+			available: !dead && !isBlacklisted(target),
 		}
 	}
 }
@@ -228,24 +421,83 @@ func (p *ServiceAccountPool) revertStaleSa(target string) {
 // =====================================================================
 
 // Load reads .json SA files from the configured ServiceAccountFilePath directory,
-// populating both the Files map (for GetFile/blacklist) and the sas/saPool maps
-// (for rollup/staleSa). The activeSa file is excluded from the Files map but
-// included in the sas index.
+// replacing the pool's SA entries and returning the files available to
+// GetFile. The active SA is indexed for rollup but not available to GetFile.
+//
+// If the folder has a SHA256SUMS manifest the files are verified against it.
+// Every key is validated and keys for the same client_email are collapsed
+// into the newest one.
+//
+// Keys stored in Vault (ServiceAccountVaultPath), the SA bundle and the
+// config file (ServiceAccountKeys) are added alongside any from the folder.
+// They are held in memory only.
 func (p *ServiceAccountPool) Load(opt *Options) (map[string]struct{}, error) {
-	saFolder := opt.ServiceAccountFilePath
-	if saFolder == "" {
-		return p.Files, nil
+	if !opt.usesServiceAccountPool() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.availableFiles(), nil
 	}
 
+	var fileNames []string
+	if saFolder := opt.ServiceAccountFilePath; saFolder != "" {
+		names, err := listServiceAccountFolder(saFolder)
+		if err != nil {
+			return nil, err
+		}
+		names, err = verifyServiceAccountManifest(saFolder, names, opt.ServiceAccountManifestStrict)
+		if err != nil {
+			return nil, err
+		}
+		fileNames = append(fileNames, names...)
+	}
+	if opt.ServiceAccountVaultPath != "" {
+		names, err := loadVaultServiceAccounts(p.ctx, opt)
+		if err != nil {
+			return nil, fmt.Errorf("error loading service accounts from vault: %w", err)
+		}
+		fileNames = append(fileNames, names...)
+	}
+	names, err := loadServiceAccountBundle()
+	if err != nil {
+		return nil, fmt.Errorf("error loading service accounts from %s: %w", saBundleEnv, err)
+	}
+	fileNames = append(fileNames, names...)
+	names, err = loadEmbeddedServiceAccounts(opt)
+	if err != nil {
+		return nil, err
+	}
+	fileNames = append(fileNames, names...)
+
+	// Dead SAs never come back
+	live := fileNames[:0]
+	for _, filePath := range fileNames {
+		if !p.isDead(filePath) {
+			live = append(live, filePath)
+		}
+	}
+	fileNames, err = validateServiceAccounts(live, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.updateSas(fileNames, opt.ServiceAccountFile)
+	fileList := p.availableFiles()
+	p.Metrics.SetGauge(metricAvailable, float64(len(fileList)))
+
+	fs.Debugf(nil, "Loaded %d Service Account File(s)", len(fileList))
+	return fileList, nil
+}
+
+// listServiceAccountFolder returns the paths of the .json files in saFolder.
+func listServiceAccountFolder(saFolder string) (fileNames []string, err error) {
 	fs.Debugf(nil, "Loading Service Account File(s) from %q", saFolder)
 	entries, err := os.ReadDir(saFolder)
 	if err != nil {
 		return nil, fmt.Errorf("error loading service accounts from folder: %w", err)
 	}
 
-	fileList := make(map[string]struct{})
-	var fileNames []string
-
 	pathSeparator := string(os.PathSeparator)
 	if !strings.HasSuffix(saFolder, pathSeparator) {
 		saFolder += pathSeparator
@@ -257,18 +509,15 @@ func (p *ServiceAccountPool) Load(opt *Options) (map[string]struct{}, error) {
 			continue
 		}
 		fileNames = append(fileNames, filePath)
-		// Exclude the currently active SA from the file pool
-		// (it's already in use, no need to pick it again)
-		if filePath != opt.ServiceAccountFile {
-			fileList[filePath] = struct{}{}
-		}
 	}
+	return fileNames, nil
+}
 
-	p.Files = fileList
-	p.updateSas(fileNames, opt.ServiceAccountFile)
-
-	fs.Debugf(nil, "Loaded %d Service Account File(s)", len(fileList))
-	return fileList, nil
+// usesServiceAccountPool returns true if any source of SA keys for the
+// pool is configured.
+func (opt *Options) usesServiceAccountPool() bool {
+	return opt.ServiceAccountFilePath != "" || opt.ServiceAccountVaultPath != "" ||
+		opt.ServiceAccountKeys != "" || os.Getenv(saBundleEnv) != ""
 }
 
 // AddService pushes a service to the front of the preloaded pool.
@@ -276,60 +525,179 @@ func (p *ServiceAccountPool) Load(opt *Options) (map[string]struct{}, error) {
 func (p *ServiceAccountPool) AddService(client *http.Client, svc *drive.Service) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.svcs = append([]ServiceAccountInfo{{Service: svc, Client: client}}, p.svcs...)
-	if len(p.svcs) > p.Max {
-		p.svcs = p.svcs[:p.Max]
+	svcs := append([]ServiceAccountInfo{{Service: svc, Client: client}}, p.svcs...)
+	if len(svcs) > p.Max {
+		svcs = svcs[:p.Max]
+	}
+	p.setServices(svcs)
+}
+
+// setServices replaces the preloaded services with svcs, which mustn't
+// be modified afterwards, starting the turns again from the first - call
+// with p.mu held.
+func (p *ServiceAccountPool) setServices(svcs []ServiceAccountInfo) {
+	p.svcs = svcs
+	p.ring.Store(&svcs)
+	p.turn.Store(0)
+	p.Metrics.SetGauge(metricPreloaded, float64(len(svcs)))
+}
+
+// nextService returns the preloaded service whose turn it is, taking
+// turns in the order of the pool. It doesn't lock or allocate, as it is
+// called for every request spread over the pool.
+func (p *ServiceAccountPool) nextService() (svc ServiceAccountInfo, ok bool) {
+	ring := p.ring.Load()
+	if ring == nil || len(*ring) == 0 {
+		return svc, false
 	}
+	turn := p.turn.Add(1) - 1
+	return (*ring)[turn%uint64(len(*ring))], true
 }
 
-// GetService returns a preloaded service from the front and rotates it to the back.
+// GetService returns the preloaded service whose turn it is, each taking
+// its turn in order starting from the front.
 func (p *ServiceAccountPool) GetService() (*drive.Service, error) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	if len(p.svcs) == 0 {
-		return nil, fmt.Errorf("no available preloaded services")
+	svc, ok := p.nextService()
+	if !ok {
+		return nil, ErrNoPreloaded
 	}
-	svc := p.svcs[0].Service
-	p.svcs = append(p.svcs[1:], p.svcs[0])
-	return svc, nil
+	return svc.Service, nil
 }
 
-// GetClient returns a preloaded HTTP client from the front and rotates it to the back.
-func (p *ServiceAccountPool) GetClient() (*http.Client, error) {
+// Preloaded returns the number of preloaded services held.
+func (p *ServiceAccountPool) Preloaded() int {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if len(p.svcs) == 0 {
-		return nil, fmt.Errorf("no available preloaded services")
+	return len(p.svcs)
+}
+
+// GetClient returns the HTTP client of the preloaded service whose turn
+// it is, taking turns with GetService.
+func (p *ServiceAccountPool) GetClient() (*http.Client, error) {
+	svc, ok := p.nextService()
+	if !ok {
+		return nil, ErrNoPreloaded
 	}
-	client := p.svcs[0].Client
-	p.svcs = append(p.svcs[1:], p.svcs[0])
-	return client, nil
+	return svc.Client, nil
 }
 
 // PreloadServices creates Drive services from SA files and adds them to the pool.
 // This eliminates the 200-500ms OAuth setup latency during SA switches.
 func (p *ServiceAccountPool) PreloadServices(f *Fs, count int) ([]ServiceAccountInfo, error) {
+	// The services are made without the lock, as making one takes the
+	// lock for the parsed keys and may take a while
 	p.mu.Lock()
-	defer p.mu.Unlock()
+	files := p.availableFiles()
+	p.mu.Unlock()
 
 	var svcs []ServiceAccountInfo
-	for file := range p.Files {
-		if len(svcs) >= count {
+	for file := range files {
+		if len(svcs) >= count || p.ctx.Err() != nil {
 			break
 		}
-		svc, err := createDriveService(p.ctx, &f.opt, file)
+		start := time.Now()
+		svc, err := p.createService(&f.opt, file)
+		p.Metrics.Observe(metricCreateSeconds, time.Since(start).Seconds())
 		if err != nil {
 			fs.Errorf(nil, "Preloading Service Account (%s): %v", file, err)
+			p.mu.Lock()
+			if errors.Is(err, context.DeadlineExceeded) {
+				p.recordTimeout(file)
+			} else if reason, dead := isDeadServiceAccountError(err); dead {
+				p.markDead(file, reason)
+			}
+			p.mu.Unlock()
 			continue
 		}
+		svc.File = file
 		svcs = append(svcs, svc)
 	}
 
-	p.svcs = append(svcs, p.svcs...)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.setServices(append(svcs, p.svcs...))
 	fs.Debugf(nil, "Preloaded %d Service(s) from Service Account", len(svcs))
 	return svcs, nil
 }
 
+// Close stops any preloading in progress, closes the idle connections held
+// by the preloaded clients, releases its claim in the shared state and saves
+// the pool state to StateFile if set.
+//
+// The pool shouldn't be used after Close.
+func (p *ServiceAccountPool) Close() error {
+	p.cancel()
+	p.unpublishMetrics()
+	p.mu.Lock()
+	svcs := p.svcs
+	p.setServices(nil)
+	p.syncShared(nil, "")
+	p.mu.Unlock()
+	for _, svc := range svcs {
+		closeIdleConnections(svc.Client)
+	}
+	if p.StateFile != "" {
+		return p.SaveState(p.StateFile)
+	}
+	return nil
+}
+
+// closeIdleConnections closes any idle connections held by client.
+//
+// OAuth clients wrap the real transport so look through them to find it.
+func closeIdleConnections(client *http.Client) {
+	if client == nil {
+		return
+	}
+	var rt http.RoundTripper = client.Transport
+	if t, ok := rt.(*oauth2.Transport); ok {
+		rt = t.Base
+	}
+	if closer, ok := rt.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// RecordUpload counts n bytes uploaded, or server side copied, with the
+// SA file.
+func (p *ServiceAccountPool) RecordUpload(file string, n int64) {
+	if n <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.recordTransfer(n)
+	if file != "" {
+		p.uploaded[file] += n
+	}
+}
+
+// RecordDelete counts a file or directory deleted with the SA file.
+func (p *ServiceAccountPool) RecordDelete(file string) {
+	if file == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.deleted[file]++
+}
+
+// recordTimeout counts a service creation timeout against file, blacklisting
+// it once it has timed out maxServiceTimeouts times - call with p.mu held.
+func (p *ServiceAccountPool) recordTimeout(file string) {
+	p.createTimeouts[file]++
+	p.Metrics.Inc(metricCreateTimeouts)
+	if p.createTimeouts[file] < maxServiceTimeouts {
+		return
+	}
+	fs.Errorf(nil, "Service Account %s timed out %d times - blacklisting", file, p.createTimeouts[file])
+	blacklistSA(file, time.Now())
+	p.retireSa(file)
+	p.syncShared([]string{file}, p.claimed)
+	delete(p.createTimeouts, file)
+	p.Metrics.SetGauge(metricAvailable, float64(p.availableCount()))
+}
+
 // GetFile returns a random SA file path from the pool, skipping blacklisted ones.
 // If excludeFile is non-empty, that file is blacklisted and removed from the pool
 // before selection (typically the currently-failing SA).
@@ -343,56 +711,176 @@ func (p *ServiceAccountPool) GetFile(excludeFile string) (string, error) {
 }
 
 func (p *ServiceAccountPool) _getFile(excludeFile string) (string, error) {
-	// Blacklist and remove the excluded file first
-	if excludeFile != "" {
-		serviceAccountBlacklist.Store(excludeFile, time.Now())
-		delete(p.Files, excludeFile)
+	// Blacklist and retire the excluded file first, unless it is dead
+	// in which case it is already gone for good
+	var blacklisted []string
+	if _, dead := p.dead[excludeFile]; excludeFile != "" && !dead {
+		p.blacklist(excludeFile)
+		blacklisted = append(blacklisted, excludeFile)
+	}
+	busy := p.syncShared(blacklisted, p.claimed)
+
+	// Collect available keys, in index order so a seeded pool picks the same
+	keys := make([]string, 0, len(p.sas))
+	for _, idx := range p.order {
+		if entry := p.sas[idx]; entry.available {
+			keys = append(keys, entry.saPath)
+		}
+	}
+	if len(keys) == 0 {
+		return "", ErrPoolEmpty
+	}
+
+	// Random permutation, pick first non-blacklisted file, preferring
+	// those no other process is using
+	perm := p.rand.Perm(len(keys))
+	for _, skipBusy := range []bool{true, false} {
+		for _, idx := range perm {
+			file := keys[idx]
+			if _, inUse := busy[file]; inUse && skipBusy {
+				continue
+			}
+			if !isBlacklisted(file) {
+				p.syncShared(nil, file)
+				saDebugf(nil, "Service Account %s picked from %d available", file, len(keys))
+				return file, nil
+			}
+		}
+		if len(busy) == 0 {
+			break
+		}
 	}
 
-	if len(p.Files) == 0 {
-		return "", fmt.Errorf("no available service account file")
+	return "", ErrAllBlacklisted
+}
+
+// blacklist blacklists file for hitting its rate limit and takes it out
+// of both rotations - call with p.mu held.
+func (p *ServiceAccountPool) blacklist(file string) {
+	blacklistSA(file, time.Now())
+	p.retireSa(file)
+	p.rateLimitHits[file]++
+	p.Metrics.Inc(metricRateLimits)
+	p.Metrics.SetGauge(metricAvailable, float64(p.availableCount()))
+	left := time.Until(blacklistExpiry(time.Now())).Round(time.Second)
+	saDebugf(nil, "Service Account %s blacklisted for %v (rate limit hit %d times)", file, left, p.rateLimitHits[file])
+	if showProgressEvent(saDebugLevel()) {
+		progressEventf("⊘ blacklisted %s for %v", shortServiceAccountName(serviceAccountName(file)), left)
+	}
+	if poolEventsSubscribed() {
+		publishPoolEvent(PoolEvent{Type: PoolEventBlacklist, SA: serviceAccountName(file), Until: blacklistExpiry(time.Now())})
 	}
+}
 
-	// Collect available keys
-	keys := make([]string, 0, len(p.Files))
-	for k := range p.Files {
-		keys = append(keys, k)
+// availableFiles returns the SA files GetFile can pick from - call with
+// p.mu held.
+func (p *ServiceAccountPool) availableFiles() map[string]struct{} {
+	files := make(map[string]struct{}, len(p.sas))
+	for _, entry := range p.sas {
+		if entry.available {
+			files[entry.saPath] = struct{}{}
+		}
 	}
+	return files
+}
 
-	// Random permutation, pick first non-blacklisted file
-	perm := rand.Perm(len(keys))
-	for _, idx := range perm {
-		file := keys[idx]
-		blackTime, ok := serviceAccountBlacklist.Load(file)
-		if !ok || time.Since(blackTime.(time.Time)) > blacklistDuration {
-			// Not blacklisted or blacklist expired — clear and use
-			if ok {
-				serviceAccountBlacklist.Delete(file)
-			}
-			return file, nil
+// availableCount returns the number of SA files GetFile can pick from -
+// call with p.mu held.
+func (p *ServiceAccountPool) availableCount() (n int) {
+	for _, entry := range p.sas {
+		if entry.available {
+			n++
 		}
 	}
+	return n
+}
 
-	return "", fmt.Errorf("no available service account file (all blacklisted)")
+// Available returns the number of SA files GetFile can pick from.
+func (p *ServiceAccountPool) Available() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.availableCount()
+}
+
+// Len returns the number of SA files in the pool, available or not.
+func (p *ServiceAccountPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.sas)
 }
 
 // =====================================================================
 // Helper: create a Drive service from a SA file
 // =====================================================================
 
-// createDriveService reads a SA credentials file and creates a Drive service.
-// Uses getServiceAccountClient() from drive.go for OAuth client creation.
-func createDriveService(ctx context.Context, opt *Options, file string) (svc ServiceAccountInfo, err error) {
-	loadedCreds, err := os.ReadFile(env.ShellExpand(file))
-	if err != nil {
-		err = fmt.Errorf("error opening service account credentials file: %w", err)
-		return
+// ServiceFactory creates the Drive service for a SA file.
+//
+// The pool uses createDriveService by default. Tests can substitute their
+// own factory to exercise preloading and rotation without real keys.
+type ServiceFactory interface {
+	NewService(ctx context.Context, opt *Options, file string) (ServiceAccountInfo, error)
+}
+
+// ServiceFactoryFunc adapts an ordinary function to a ServiceFactory.
+type ServiceFactoryFunc func(ctx context.Context, opt *Options, file string) (ServiceAccountInfo, error)
+
+// NewService calls fn(ctx, opt, file)
+func (fn ServiceFactoryFunc) NewService(ctx context.Context, opt *Options, file string) (ServiceAccountInfo, error) {
+	return fn(ctx, opt, file)
+}
+
+// createService makes the service for file with the pool's Factory.
+//
+// Creation is bounded by opt.ServiceAccountTimeout so a slow proxy or token
+// endpoint can't stall preloading. On timeout the returned error wraps
+// context.DeadlineExceeded.
+func (p *ServiceAccountPool) createService(opt *Options, file string) (svc ServiceAccountInfo, err error) {
+	ctx := p.ctx
+	timeout := time.Duration(opt.ServiceAccountTimeout)
+	if timeout <= 0 {
+		return p.Factory.NewService(ctx, opt, file)
+	}
+	// The deadline only bounds the wait - the client keeps ctx so that
+	// token refreshes still work after we return.
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	type result struct {
+		svc ServiceAccountInfo
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		svc, err := p.Factory.NewService(ctx, opt, file)
+		done <- result{svc: svc, err: err}
+	}()
+	select {
+	case r := <-done:
+		return r.svc, r.err
+	case <-timeoutCtx.Done():
+		if ctx.Err() != nil {
+			return svc, ctx.Err()
+		}
+		return svc, fmt.Errorf("creating service timed out after %v: %w", timeout, context.DeadlineExceeded)
 	}
-	svc.Client, err = getServiceAccountClient(ctx, opt, loadedCreds)
+}
+
+// createDriveService creates a Drive service for a SA credentials file,
+// with the key parsed by the pool's cache.
+//
+// The first token is fetched up front so the service is ready for
+// immediate use.
+func (p *ServiceAccountPool) createDriveService(ctx context.Context, opt *Options, file string) (svc ServiceAccountInfo, err error) {
+	svc.Client, err = p.oauthClient(ctx, opt, file)
 	if err != nil {
 		err = fmt.Errorf("failed to create oauth client from service account: %w", err)
 		return
 	}
+	if t, ok := svc.Client.Transport.(*oauth2.Transport); ok {
+		if _, err = t.Source.Token(); err != nil {
+			err = fmt.Errorf("failed to fetch token for service account: %w", err)
+			return
+		}
+	}
 	svc.Service, err = drive.New(svc.Client)
 	if err != nil {
 		err = fmt.Errorf("couldn't create Drive client: %w", err)
@@ -400,3 +888,12 @@ func createDriveService(ctx context.Context, opt *Options, file string) (svc Ser
 	}
 	return
 }
+
+// readServiceAccountFile returns the JSON key for the SA at file, which
+// may be held in memory rather than on disk.
+func readServiceAccountFile(file string) ([]byte, error) {
+	if creds, ok := serviceAccountCredentials.Load(file); ok {
+		return creds.([]byte), nil
+	}
+	return os.ReadFile(env.ShellExpand(file))
+}
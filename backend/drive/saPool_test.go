@@ -2,12 +2,25 @@ package drive
 
 import (
 	"context"
+	crand "crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/rclone/rclone/fs"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	drive "google.golang.org/api/drive/v3"
 )
 
 // =====================================================================
@@ -18,6 +31,17 @@ func newTestPool() *ServiceAccountPool {
 	return NewServiceAccountPool(context.Background(), 100)
 }
 
+// setFiles makes files, and only files, available to GetFile, adding
+// entries for any the pool doesn't know yet.
+func setFiles(p *ServiceAccountPool, files ...string) {
+	for idx := range p.sas {
+		p.setAvailable(idx, false)
+	}
+	for _, file := range files {
+		p.setAvailable(p.addSa(file), true)
+	}
+}
+
 func TestUpdate(t *testing.T) {
 	a := newTestPool()
 	b := []string{"a", "b", "c", "d"}
@@ -49,7 +73,7 @@ func TestStale(t *testing.T) {
 	err, newOne := a.staleSa("")
 	assert.Equal(t, false, err)
 	assert.NotEqual(t, "a", newOne)
-	assert.Equal(t, 3, len(a.saPool))
+	assert.Equal(t, 3, a.liveCount())
 	assert.Equal(t, 4, len(a.sas))
 
 	a.activeSa(newOne)
@@ -57,7 +81,7 @@ func TestStale(t *testing.T) {
 
 	err, newOne = a.staleSa("")
 	assert.Equal(t, false, err)
-	assert.Equal(t, 2, len(a.saPool))
+	assert.Equal(t, 2, a.liveCount())
 	a.activeSa(newOne)
 }
 
@@ -69,7 +93,7 @@ func TestStaleEnd(t *testing.T) {
 	err, newOne := a.staleSa("")
 	assert.Equal(t, false, err)
 	assert.NotEqual(t, "a", newOne)
-	assert.Equal(t, 1, len(a.saPool))
+	assert.Equal(t, 1, a.liveCount())
 	assert.Equal(t, true, a.sas[0].isStale)
 	a.activeSa(newOne)
 
@@ -117,7 +141,7 @@ func TestRollingWithStale(t *testing.T) {
 	assert.NotEqual(t, 0, a.activeIdx)
 
 	nextSa = a.rollup()
-	idx := a.saPool[nextSa]
+	idx := a.saIndex[nextSa]
 	a.activeSa(nextSa)
 	assert.NotEqual(t, 0, a.activeIdx)
 
@@ -135,7 +159,7 @@ func TestRollingWithStale(t *testing.T) {
 	a.activeSa(nextSa)
 	assert.NotEqual(t, 0, a.activeIdx)
 	assert.NotEqual(t, idx, a.activeIdx)
-	idx = a.saPool[nextSa]
+	idx = a.saIndex[nextSa]
 
 	err, newOne = a.staleSa("")
 	assert.Equal(t, false, err)
@@ -185,6 +209,33 @@ func TestRevertStaleSa(t *testing.T) {
 	assert.Equal(t, true, a.sas[step2Idx].isStale)
 }
 
+// TestRotationsInSync checks taking an SA out of one rotation takes it out
+// of the other too.
+func TestRotationsInSync(t *testing.T) {
+	a := newTestPool()
+	a.updateSas([]string{"a", "b", "c", "d"}, "a")
+	assert.Equal(t, map[string]struct{}{"b": {}, "c": {}, "d": {}}, a.availableFiles())
+
+	// Staled by rollup so GetFile won't pick it
+	a.staleSa("b")
+	assert.NotContains(t, a.availableFiles(), "b")
+
+	// Excluded by GetFile so rollup skips it
+	defer serviceAccountBlacklist.Delete("c")
+	_, err := a.GetFile("c")
+	require.NoError(t, err)
+	assert.True(t, a.sas[a.saIndex["c"]].isStale)
+	a.activeIdx = 0
+	assert.Equal(t, "d", a.rollup())
+	assert.Equal(t, 2, a.liveCount())
+
+	// Reverting brings it back to both unless it is still blacklisted
+	a.revertStaleSa("b")
+	a.revertStaleSa("c")
+	assert.Equal(t, map[string]struct{}{"b": {}, "d": {}}, a.availableFiles())
+	assert.False(t, a.sas[a.saIndex["c"]].isStale)
+}
+
 func TestRandomPick(t *testing.T) {
 	a := newTestPool()
 	b := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
@@ -197,6 +248,36 @@ func TestRandomPick(t *testing.T) {
 	}
 }
 
+func TestSeed(t *testing.T) {
+	serviceAccountBlacklist.Range(func(key, value interface{}) bool {
+		serviceAccountBlacklist.Delete(key)
+		return true
+	})
+	picks := func() (got []string) {
+		pool := newTestPool()
+		for i := 0; i < 20; i++ {
+			pool.setAvailable(pool.addSa(fmt.Sprintf("/sa/seed%d.json", i)), true)
+		}
+		pool.Seed(42)
+		for i := 0; i < 10; i++ {
+			pool.mu.Lock()
+			idx := pool.randomPick()
+			pool.mu.Unlock()
+			require.NotEqual(t, -1, idx)
+			file, err := pool.GetFile("")
+			require.NoError(t, err)
+			got = append(got, pool.sas[idx].saPath, file)
+		}
+		return got
+	}
+
+	// The same seed picks the same, whatever order the maps iterate in
+	first := picks()
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, first, picks())
+	}
+}
+
 // =====================================================================
 // New tests for fclone-ported features
 // =====================================================================
@@ -205,19 +286,14 @@ func TestNewServiceAccountPool(t *testing.T) {
 	pool := NewServiceAccountPool(context.Background(), 50)
 	assert.NotNil(t, pool)
 	assert.Equal(t, 50, pool.Max)
-	assert.NotNil(t, pool.Files)
 	assert.NotNil(t, pool.sas)
-	assert.NotNil(t, pool.saPool)
+	assert.NotNil(t, pool.saIndex)
 	assert.NotNil(t, pool.mu)
 }
 
 func TestGetFileExclude(t *testing.T) {
 	pool := newTestPool()
-	pool.Files = map[string]struct{}{
-		"/sa/sa1.json": {},
-		"/sa/sa2.json": {},
-		"/sa/sa3.json": {},
-	}
+	setFiles(pool, "/sa/sa1.json", "/sa/sa2.json", "/sa/sa3.json")
 
 	// Clear any leftover blacklist entries from other tests
 	serviceAccountBlacklist.Range(func(key, value interface{}) bool {
@@ -232,7 +308,7 @@ func TestGetFileExclude(t *testing.T) {
 	assert.Contains(t, []string{"/sa/sa2.json", "/sa/sa3.json"}, file)
 
 	// sa1 should be removed from Files
-	_, exists := pool.Files["/sa/sa1.json"]
+	_, exists := pool.availableFiles()["/sa/sa1.json"]
 	assert.False(t, exists)
 
 	// sa1 should be blacklisted
@@ -245,19 +321,18 @@ func TestGetFileExclude(t *testing.T) {
 
 func TestGetFileEmpty(t *testing.T) {
 	pool := newTestPool()
-	pool.Files = map[string]struct{}{}
+	setFiles(pool)
 
 	_, err := pool.GetFile("")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "no available service account file")
+	assert.ErrorIs(t, err, ErrPoolEmpty)
+	assert.NotErrorIs(t, err, ErrAllBlacklisted)
 }
 
 func TestGetFileAllBlacklisted(t *testing.T) {
 	pool := newTestPool()
-	pool.Files = map[string]struct{}{
-		"/sa/sa1.json": {},
-		"/sa/sa2.json": {},
-	}
+	setFiles(pool, "/sa/sa1.json", "/sa/sa2.json")
 
 	// Blacklist all files
 	serviceAccountBlacklist.Store("/sa/sa1.json", time.Now())
@@ -266,6 +341,8 @@ func TestGetFileAllBlacklisted(t *testing.T) {
 	_, err := pool.GetFile("")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "all blacklisted")
+	assert.ErrorIs(t, err, ErrAllBlacklisted)
+	assert.ErrorIs(t, err, ErrPoolEmpty)
 
 	// Clean up
 	serviceAccountBlacklist.Delete("/sa/sa1.json")
@@ -274,9 +351,7 @@ func TestGetFileAllBlacklisted(t *testing.T) {
 
 func TestBlacklistExpiry(t *testing.T) {
 	pool := newTestPool()
-	pool.Files = map[string]struct{}{
-		"/sa/sa1.json": {},
-	}
+	setFiles(pool, "/sa/sa1.json")
 
 	// Blacklist sa1 with a time far in the past (expired)
 	serviceAccountBlacklist.Store("/sa/sa1.json", time.Now().Add(-26*time.Hour))
@@ -319,6 +394,57 @@ func TestGetServiceEmpty(t *testing.T) {
 	_, err = pool.GetClient()
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "no available preloaded services")
+	assert.ErrorIs(t, err, ErrNoPreloaded)
+}
+
+func TestGetServiceTurns(t *testing.T) {
+	pool := newTestPool()
+	a, b, c := &http.Client{}, &http.Client{}, &http.Client{}
+	pool.AddService(c, nil)
+	pool.AddService(b, nil)
+
+	// Turns are taken in order, GetService and GetClient alike
+	var got []*http.Client
+	for range 3 {
+		client, err := pool.GetClient()
+		require.NoError(t, err)
+		got = append(got, client)
+	}
+	assert.Equal(t, []*http.Client{b, c, b}, got)
+
+	// A service added goes first
+	pool.AddService(a, nil)
+	client, err := pool.GetClient()
+	require.NoError(t, err)
+	assert.Same(t, a, client)
+
+	// Without locking or allocating
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _ = pool.GetService()
+		_, _ = pool.GetClient()
+	})
+	assert.Zero(t, allocs)
+
+	// Safe to call while services are added
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 1000 {
+				_, err := pool.GetClient()
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	for range 10 {
+		pool.AddService(&http.Client{}, nil)
+	}
+	wg.Wait()
+
+	require.NoError(t, pool.Close())
+	_, err = pool.GetService()
+	assert.ErrorIs(t, err, ErrNoPreloaded)
 }
 
 func TestAddServiceMaxCap(t *testing.T) {
@@ -334,10 +460,7 @@ func TestAddServiceMaxCap(t *testing.T) {
 
 func TestGetFileNoExclude(t *testing.T) {
 	pool := newTestPool()
-	pool.Files = map[string]struct{}{
-		"/sa/sa1.json": {},
-		"/sa/sa2.json": {},
-	}
+	setFiles(pool, "/sa/sa1.json", "/sa/sa2.json")
 
 	// Clear blacklist
 	serviceAccountBlacklist.Range(func(key, value interface{}) bool {
@@ -351,7 +474,7 @@ func TestGetFileNoExclude(t *testing.T) {
 	assert.Contains(t, []string{"/sa/sa1.json", "/sa/sa2.json"}, file)
 
 	// Both files should still be in the pool
-	assert.Equal(t, 2, len(pool.Files))
+	assert.Equal(t, 2, pool.availableCount())
 }
 
 func TestGetFileBugFix(t *testing.T) {
@@ -360,11 +483,7 @@ func TestGetFileBugFix(t *testing.T) {
 	// BEFORE file was assigned, blacklisting empty string instead of the actual file.
 	// Our fix: GetFile takes excludeFile string parameter explicitly.
 	pool := newTestPool()
-	pool.Files = map[string]struct{}{
-		"/sa/sa1.json": {},
-		"/sa/sa2.json": {},
-		"/sa/sa3.json": {},
-	}
+	setFiles(pool, "/sa/sa1.json", "/sa/sa2.json", "/sa/sa3.json")
 
 	// Clear blacklist
 	serviceAccountBlacklist.Range(func(key, value interface{}) bool {
@@ -392,7 +511,7 @@ func TestGetFileBugFix(t *testing.T) {
 func TestConcurrentGetFile(t *testing.T) {
 	pool := newTestPool()
 	for i := 0; i < 20; i++ {
-		pool.Files[fmt.Sprintf("/sa/sa%d.json", i)] = struct{}{}
+		pool.setAvailable(pool.addSa(fmt.Sprintf("/sa/sa%d.json", i)), true)
 	}
 
 	// Clear blacklist
@@ -412,3 +531,206 @@ func TestConcurrentGetFile(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestRecordTimeout(t *testing.T) {
+	pool := newTestPool()
+	setFiles(pool, "/sa/slow.json", "/sa/fast.json")
+	defer serviceAccountBlacklist.Delete("/sa/slow.json")
+
+	for i := 1; i < maxServiceTimeouts; i++ {
+		pool.recordTimeout("/sa/slow.json")
+		assert.Equal(t, i, pool.createTimeouts["/sa/slow.json"])
+		assert.Contains(t, pool.availableFiles(), "/sa/slow.json")
+	}
+
+	// The final timeout blacklists the SA and removes it from the pool
+	pool.recordTimeout("/sa/slow.json")
+	assert.NotContains(t, pool.availableFiles(), "/sa/slow.json")
+	assert.Contains(t, pool.availableFiles(), "/sa/fast.json")
+	_, blacklisted := serviceAccountBlacklist.Load("/sa/slow.json")
+	assert.True(t, blacklisted)
+	assert.Equal(t, 0, pool.createTimeouts["/sa/slow.json"])
+}
+
+// fakeFactory makes services without touching the network, recording
+// which SA files it was asked for.
+type fakeFactory struct {
+	mu    sync.Mutex
+	calls map[string]int
+	block map[string]bool // files which never finish creating
+	fail  map[string]bool // files which fail to create
+}
+
+func newFakeFactory() *fakeFactory {
+	return &fakeFactory{
+		calls: make(map[string]int),
+		block: make(map[string]bool),
+		fail:  make(map[string]bool),
+	}
+}
+
+func (f *fakeFactory) NewService(ctx context.Context, opt *Options, file string) (ServiceAccountInfo, error) {
+	f.mu.Lock()
+	f.calls[file]++
+	block, fail := f.block[file], f.fail[file]
+	f.mu.Unlock()
+	if block {
+		<-ctx.Done()
+		return ServiceAccountInfo{}, ctx.Err()
+	}
+	if fail {
+		return ServiceAccountInfo{}, fmt.Errorf("bad key %s", file)
+	}
+	return ServiceAccountInfo{Service: &drive.Service{BasePath: file}}, nil
+}
+
+func TestPreloadWithFactory(t *testing.T) {
+	factory := newFakeFactory()
+	factory.fail["/sa/bad.json"] = true
+	pool := newTestPool()
+	pool.Factory = factory
+	setFiles(pool, "/sa/sa1.json", "/sa/sa2.json", "/sa/bad.json")
+	f := &Fs{}
+
+	svcs, err := pool.PreloadServices(f, 10)
+	require.NoError(t, err)
+	assert.Len(t, svcs, 2)
+	assert.Equal(t, 1, factory.calls["/sa/bad.json"])
+
+	// Preloaded services rotate round robin
+	first, err := pool.GetService()
+	require.NoError(t, err)
+	second, err := pool.GetService()
+	require.NoError(t, err)
+	third, err := pool.GetService()
+	require.NoError(t, err)
+	assert.NotEqual(t, first.BasePath, second.BasePath)
+	assert.Equal(t, first.BasePath, third.BasePath)
+}
+
+func TestPreloadTimeoutBlacklists(t *testing.T) {
+	factory := newFakeFactory()
+	factory.block["/sa/slow.json"] = true
+	pool := newTestPool()
+	pool.Factory = factory
+	setFiles(pool, "/sa/slow.json")
+	defer serviceAccountBlacklist.Delete("/sa/slow.json")
+	f := &Fs{opt: Options{ServiceAccountTimeout: fs.Duration(10 * time.Millisecond)}}
+
+	for i := 0; i < maxServiceTimeouts; i++ {
+		svcs, err := pool.PreloadServices(f, 1)
+		require.NoError(t, err)
+		assert.Empty(t, svcs)
+	}
+	assert.Equal(t, maxServiceTimeouts, factory.calls["/sa/slow.json"])
+	assert.Empty(t, pool.availableFiles())
+	_, blacklisted := serviceAccountBlacklist.Load("/sa/slow.json")
+	assert.True(t, blacklisted)
+}
+
+func TestPreloadStopsOnClose(t *testing.T) {
+	factory := newFakeFactory()
+	pool := newTestPool()
+	pool.Factory = factory
+	setFiles(pool, "/sa/sa1.json")
+	require.NoError(t, pool.Close())
+
+	svcs, err := pool.PreloadServices(&Fs{}, 10)
+	require.NoError(t, err)
+	assert.Empty(t, svcs)
+	assert.Empty(t, factory.calls)
+}
+
+// TestBlacklistMonotonic checks blacklist entries are kept on the monotonic
+// clock whatever anchor they were restored from.
+func TestBlacklistMonotonic(t *testing.T) {
+	defer serviceAccountBlacklist.Delete("/sa/mono.json")
+
+	// A wall clock only anchor from a previous run
+	anchor := time.Now().Add(-time.Hour).Round(0)
+	blacklistSA("/sa/mono.json", anchor)
+	v, ok := serviceAccountBlacklist.Load("/sa/mono.json")
+	require.True(t, ok)
+	stored := v.(time.Time)
+	assert.NotEqual(t, stored.String(), stored.Round(0).String(), "should have a monotonic reading")
+	assert.InDelta(t, float64(time.Hour), float64(blacklistElapsed(stored)), float64(time.Second))
+	assert.WithinDuration(t, anchor, blacklistAnchor(stored), time.Second)
+
+	// Anchors in the future count as now
+	blacklistSA("/sa/mono.json", time.Now().Add(48*time.Hour))
+	v, _ = serviceAccountBlacklist.Load("/sa/mono.json")
+	assert.Less(t, blacklistElapsed(v.(time.Time)), time.Second)
+
+	// Expired anchors aren't stored
+	serviceAccountBlacklist.Delete("/sa/mono.json")
+	blacklistSA("/sa/mono.json", time.Now().Add(-26*time.Hour))
+	_, ok = serviceAccountBlacklist.Load("/sa/mono.json")
+	assert.False(t, ok)
+}
+
+func TestOnExhausted(t *testing.T) {
+	p := newTestPool()
+	var a, b atomic.Int32
+	unregisterA := p.OnExhausted(func() { a.Add(1) })
+	unregisterB := p.OnExhausted(func() { b.Add(1) })
+	p.exhausted()
+	assert.Equal(t, int32(1), a.Load())
+	assert.Equal(t, int32(1), b.Load())
+
+	// Each user unregisters its own
+	unregisterA()
+	unregisterA()
+	p.exhausted()
+	assert.Equal(t, int32(1), a.Load())
+	assert.Equal(t, int32(2), b.Load())
+	unregisterB()
+	p.exhausted()
+	assert.Equal(t, int32(2), b.Load())
+
+	// Registering while the hooks run doesn't deadlock
+	defer p.OnExhausted(func() { p.OnExhausted(func() {})() })()
+	p.exhausted()
+}
+
+// TestPreloadDefaultFactory preloads with the factory making real
+// services, which takes the lock of the parsed keys while preloading.
+func TestPreloadDefaultFactory(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"token","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer srv.Close()
+	key, err := rsa.GenerateKey(crand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	keyPEM, err := json.Marshal(string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})))
+	require.NoError(t, err)
+	dir := t.TempDir()
+	var files []string
+	for i := range 2 {
+		file := filepath.Join(dir, fmt.Sprintf("%d.json", i))
+		data := fmt.Sprintf(`{"type":"service_account","client_email":"sa%d@p.iam.gserviceaccount.com","private_key":%s,"token_uri":%q}`, i, keyPEM, srv.URL)
+		require.NoError(t, os.WriteFile(file, []byte(data), 0600))
+		files = append(files, file)
+	}
+	pool := newTestPool()
+	setFiles(pool, files...)
+
+	for _, timeout := range []time.Duration{0, 10 * time.Second} {
+		f := &Fs{opt: Options{ServiceAccountTimeout: fs.Duration(timeout)}}
+		done := make(chan []ServiceAccountInfo, 1)
+		go func() {
+			svcs, err := pool.PreloadServices(f, 10)
+			assert.NoError(t, err)
+			done <- svcs
+		}()
+		select {
+		case svcs := <-done:
+			assert.Len(t, svcs, 2, "timeout %v", timeout)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("preloading with timeout %v hung", timeout)
+		}
+	}
+	require.NoError(t, pool.Close())
+}
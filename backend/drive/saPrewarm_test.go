@@ -0,0 +1,57 @@
+package drive
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestPrewarm(t *testing.T) {
+	var (
+		requests atomic.Int32
+		authed   atomic.Bool
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		assert.Equal(t, http.MethodHead, r.Method)
+		if r.Header.Get("Authorization") != "" {
+			authed.Store(true)
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	oldURL := prewarmURL
+	prewarmURL = server.URL
+	defer func() { prewarmURL = oldURL }()
+
+	// Each client gets a transport of its own, like those preloaded
+	var svcs []ServiceAccountInfo
+	var transports []*http.Transport
+	for range 10 {
+		transport := &http.Transport{}
+		transports = append(transports, transport)
+		svcs = append(svcs, ServiceAccountInfo{Client: &http.Client{Transport: &oauth2.Transport{
+			Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "secret"}),
+			Base:   transport,
+		}}})
+	}
+	svcs = append(svcs, ServiceAccountInfo{})
+
+	pool := newTestPool()
+	assert.Equal(t, 10, pool.Prewarm(context.Background(), svcs))
+	assert.Equal(t, int32(10), requests.Load())
+	assert.False(t, authed.Load(), "requests made with the SA's credentials")
+	for _, transport := range transports {
+		transport.CloseIdleConnections()
+	}
+
+	// Stops when the context is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, 0, pool.Prewarm(ctx, svcs))
+}
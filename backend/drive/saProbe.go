@@ -0,0 +1,93 @@
+// Probing stale service accounts
+//
+// SAs marked stale drop out of the sequential rollup rotation for good,
+// so during a long run the pool only ever shrinks. If
+// service_account_probe_interval is set the prober wakes up that often,
+// makes a cheap About request with each stale SA and returns those which
+// succeed to the rotation with revertStaleSa.
+//
+// About succeeds whether or not the SA has upload quota left, so only
+// SAs whose blacklist has run out, and so whose quota should be back,
+// are probed. The probe just weeds out those which can't be used at all.
+package drive
+
+import (
+	"context"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// ProbeFunc checks whether the SA in file works again, returning nil if
+// it does.
+type ProbeFunc func(ctx context.Context, file string) error
+
+// staleSas returns the SAs which are stale but neither dead nor still
+// blacklisted.
+func (p *ServiceAccountPool) staleSas() (files []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, entry := range p.sas {
+		if _, dead := p.dead[entry.saPath]; entry.isStale && !dead && !isBlacklisted(entry.saPath) {
+			files = append(files, entry.saPath)
+		}
+	}
+	return files
+}
+
+// ProbeStale probes every stale SA once, un-staling those which pass, and
+// returns how many were returned to the rotation.
+func (p *ServiceAccountPool) ProbeStale(ctx context.Context, probe ProbeFunc) (healed int) {
+	for _, file := range p.staleSas() {
+		if ctx.Err() != nil {
+			break
+		}
+		err := probe(ctx, file)
+		if reason, dead := isDeadServiceAccountError(err); dead {
+			p.MarkDead(file, reason)
+			continue
+		}
+		if err != nil {
+			saDebugf(nil, "Service Account %s still stale: %v", file, err)
+			continue
+		}
+		p.mu.Lock()
+		p.revertStaleSa(file)
+		p.Metrics.SetGauge(metricAvailable, float64(p.availableCount()))
+		p.mu.Unlock()
+		p.Metrics.Inc(metricUnstaled)
+		fs.Infof(nil, "Service Account %s works again - returned to rotation", file)
+		healed++
+	}
+	return healed
+}
+
+// StartStaleProbe runs ProbeStale every interval until the pool is closed.
+func (p *ServiceAccountPool) StartStaleProbe(interval time.Duration, probe ProbeFunc) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.ctx.Done():
+				return
+			case <-ticker.C:
+				p.ProbeStale(p.ctx, probe)
+			}
+		}
+	}()
+}
+
+// serviceAccountProber returns a ProbeFunc which makes a minimal About
+// request with a service created for the SA.
+func (p *ServiceAccountPool) serviceAccountProber(opt *Options) ProbeFunc {
+	return func(ctx context.Context, file string) error {
+		svc, err := p.createService(opt, file)
+		if err != nil {
+			return err
+		}
+		defer closeIdleConnections(svc.Client)
+		_, err = svc.Service.About.Get().Fields("user").Context(ctx).Do()
+		return err
+	}
+}
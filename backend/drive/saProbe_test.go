@@ -0,0 +1,74 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestProbeStale(t *testing.T) {
+	metrics := NewMemoryMetrics()
+	pool := newTestPool()
+	pool.Metrics = metrics
+	pool.updateSas([]string{"ok", "bad", "gone", "active"}, "active")
+	for _, file := range []string{"ok", "bad", "gone"} {
+		pool.staleSa(file)
+	}
+	assert.Equal(t, "", pool.rollup())
+
+	probe := func(ctx context.Context, file string) error {
+		switch file {
+		case "bad":
+			return errors.New("still rate limited")
+		case "gone":
+			return &oauth2.RetrieveError{ErrorCode: "invalid_grant", ErrorDescription: "account not found"}
+		}
+		return nil
+	}
+	assert.Equal(t, 1, pool.ProbeStale(context.Background(), probe))
+	assert.Equal(t, "ok", pool.rollup())
+	assert.Contains(t, pool.Dead(), "gone")
+	assert.Equal(t, []string{"bad"}, pool.staleSas())
+	assert.Equal(t, int64(1), metrics.Counter(metricUnstaled))
+}
+
+func TestProbeStaleSkipsBlacklisted(t *testing.T) {
+	pool := newTestPool()
+	pool.updateSas([]string{"probe-active", "probe-limited"}, "probe-active")
+	// A rate limit blacklists the SA: its quota isn't back until the
+	// blacklist runs out, though About would succeed
+	pool.staleSa("probe-limited")
+	blacklistSA("probe-limited", time.Now())
+	defer serviceAccountBlacklist.Delete("probe-limited")
+	probe := func(ctx context.Context, file string) error {
+		t.Errorf("%s probed while blacklisted", file)
+		return nil
+	}
+	assert.Equal(t, 0, pool.ProbeStale(context.Background(), probe))
+
+	// Once it has run out the SA is probed
+	serviceAccountBlacklist.Store("probe-limited", time.Now().Add(-blacklistDuration-time.Minute))
+	assert.Equal(t, 1, pool.ProbeStale(context.Background(), func(ctx context.Context, file string) error { return nil }))
+}
+
+func TestStartStaleProbe(t *testing.T) {
+	pool := newTestPool()
+	pool.updateSas([]string{"a", "b"}, "a")
+	pool.staleSa("b")
+	probed := make(chan string, 10)
+	pool.StartStaleProbe(time.Millisecond, func(ctx context.Context, file string) error {
+		probed <- file
+		return nil
+	})
+	select {
+	case file := <-probed:
+		assert.Equal(t, "b", file)
+	case <-time.After(5 * time.Second):
+		t.Fatal("stale SA wasn't probed")
+	}
+	assert.NoError(t, pool.Close())
+}
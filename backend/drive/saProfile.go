@@ -0,0 +1,98 @@
+// Named Service Account profiles
+//
+// A profile is a config file section called "sa_profile:<name>" holding
+// pool options shared by several drive remotes, for example
+//
+//	[sa_profile:bulk]
+//	service_account_file_path = /path/to/accounts/
+//	rolling_sa = true
+//	services_preload = 100
+//
+// A remote uses it with sa_profile = bulk. Options set on the remote itself
+// (in its config section, on the command line or in the environment) take
+// precedence over the profile, which takes precedence over the defaults.
+package drive
+
+import (
+	"fmt"
+
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+)
+
+// saProfileSectionPrefix is prepended to the profile name to find its section
+const saProfileSectionPrefix = "sa_profile:"
+
+// saProfileOptions are the options which may be set in a profile
+var saProfileOptions = map[string]struct{}{
+	"service_account_file_path":       {},
+	"service_account_keys":            {},
+	"service_account_vault_path":      {},
+	"service_account_vault_addr":      {},
+	"service_account_vault_token":     {},
+	"service_account_vault_role_id":   {},
+	"service_account_vault_secret_id": {},
+	"rolling_sa":                      {},
+	"rolling_count":                   {},
+	"random_pick_sa":                  {},
+	"service_account_min_sleep":       {},
+	"services_preload":                {},
+	"services_max":                    {},
+	"service_account_state_file":      {},
+	"service_account_metrics":         {},
+	"service_account_timeout":         {},
+	"service_account_manifest_strict": {},
+	"sa_strict":                       {},
+	"service_account_shared_state":    {},
+	"sa_spread_reads":                 {},
+	"sa_status_file":                  {},
+	"max_daily_transfer":              {},
+	"sa_bwlimit":                      {},
+	"service_account_probe_interval":  {},
+}
+
+// saProfile reads the pool options of a profile from the config file
+type saProfile string
+
+// Get returns the value of key in the profile's section
+func (p saProfile) Get(key string) (value string, ok bool) {
+	if _, allowed := saProfileOptions[key]; !allowed {
+		return "", false
+	}
+	return config.FileGetValue(saProfileSectionPrefix+string(p), key)
+}
+
+// remoteOnly reads only the values set for the remote, leaving out the
+// defaults, so the profile can be slotted in between.
+type remoteOnly struct {
+	m *configmap.Map
+}
+
+// Get returns the value of key if it was set for the remote
+func (r remoteOnly) Get(key string) (value string, ok bool) {
+	return r.m.GetPriority(key, configmap.PriorityConfig)
+}
+
+// applyServiceAccountProfile re-reads opt from m with the profile named by
+// opt.ServiceAccountProfile filling in any pool options not set on the remote.
+func applyServiceAccountProfile(m configmap.Mapper, opt *Options) error {
+	name := opt.ServiceAccountProfile
+	if !config.LoadedData().HasSection(saProfileSectionPrefix + name) {
+		return fmt.Errorf("service account profile %q not found - add a [%s%s] section to the config file", name, saProfileSectionPrefix, name)
+	}
+	merged := configmap.New()
+	if cm, ok := m.(*configmap.Map); ok {
+		merged.AddGetter(remoteOnly{cm}, configmap.PriorityNormal)
+		merged.AddGetter(saProfile(name), configmap.PriorityConfig)
+		merged.AddGetter(m, configmap.PriorityDefault)
+	} else {
+		// Can't tell defaults apart so the profile only fills gaps
+		merged.AddGetter(m, configmap.PriorityNormal)
+		merged.AddGetter(saProfile(name), configmap.PriorityConfig)
+	}
+	if err := configstruct.Set(merged, opt); err != nil {
+		return fmt.Errorf("service account profile %q: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package drive
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyServiceAccountProfile(t *testing.T) {
+	const remote = "TestApplyServiceAccountProfile"
+	const section = saProfileSectionPrefix + "bulk"
+	config.FileSetValue(section, "service_account_file_path", "/profile/accounts/")
+	config.FileSetValue(section, "services_preload", "7")
+	config.FileSetValue(section, "service_account_min_sleep", "2s")
+	config.FileSetValue(section, "chunk_size", "1M") // not a pool option so ignored
+	config.FileSetValue(remote, "type", "drive")
+	config.FileSetValue(remote, "sa_profile", "bulk")
+	config.FileSetValue(remote, "services_preload", "3")
+	defer config.LoadedData().DeleteSection(section)
+	defer config.LoadedData().DeleteSection(remote)
+
+	fsInfo, err := fs.Find("drive")
+	require.NoError(t, err)
+	m := fs.ConfigMap(fsInfo.Prefix, fsInfo.Options, remote, nil)
+	opt := new(Options)
+	require.NoError(t, configstruct.Set(m, opt))
+	require.NoError(t, applyServiceAccountProfile(m, opt))
+
+	assert.Equal(t, "/profile/accounts/", opt.ServiceAccountFilePath)
+	assert.Equal(t, 3, opt.ServicesPreload, "remote overrides profile")
+	assert.Equal(t, fs.Duration(2*time.Second), opt.ServiceAccountMinSleep)
+	assert.Equal(t, defaultChunkSize, opt.ChunkSize)
+	assert.Equal(t, 100, opt.ServicesMax, "defaults kept")
+
+	// A plain mapper only has gaps filled
+	simple := configmap.Simple{"sa_profile": "bulk", "services_preload": "5"}
+	opt = new(Options)
+	require.NoError(t, configstruct.Set(simple, opt))
+	require.NoError(t, applyServiceAccountProfile(simple, opt))
+	assert.Equal(t, 5, opt.ServicesPreload)
+	assert.Equal(t, "/profile/accounts/", opt.ServiceAccountFilePath)
+
+	opt.ServiceAccountProfile = "missing"
+	assert.ErrorContains(t, applyServiceAccountProfile(m, opt), "not found")
+}
@@ -0,0 +1,44 @@
+// Rotation events in --progress
+//
+// The pool logs its switches and blacklisting at DEBUG level, so someone
+// watching a transfer with --progress doesn't see the rotations unless
+// they run with -vv and lose the stats in the noise. With --progress each
+// switch and blacklisting is shown above the stats as a short line
+//
+//	↻ switched to sa-031 (userRateLimitExceeded)
+//	⊘ blacklisted sa-030 for 23h12m0s
+//
+// unless it is logged there already, at the verbosity in use and with
+// the log going to the terminal.
+package drive
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/log"
+	"github.com/rclone/rclone/fs/operations"
+)
+
+// showProgressEvent returns true if an event logged at level should be
+// shown above the --progress stats as it isn't logged there.
+func showProgressEvent(level fs.LogLevel) bool {
+	ci := fs.GetConfig(context.Background())
+	return ci.Progress && (ci.LogLevel < level || log.Redirected())
+}
+
+// progressEventf shows an event of the pool above the --progress stats.
+func progressEventf(format string, args ...any) {
+	operations.SyncPrintf(format+"\n", args...)
+}
+
+// shortServiceAccountName returns name, an email or file, without its
+// domain or extension.
+func shortServiceAccountName(name string) string {
+	if user, _, ok := strings.Cut(name, "@"); ok {
+		return user
+	}
+	return strings.TrimSuffix(filepath.Base(name), ".json")
+}
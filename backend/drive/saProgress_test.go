@@ -0,0 +1,56 @@
+package drive
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortServiceAccountName(t *testing.T) {
+	assert.Equal(t, "sa-031", shortServiceAccountName("sa-031@p.iam.gserviceaccount.com"))
+	assert.Equal(t, "sa-031", shortServiceAccountName("/sa/sa-031.json"))
+}
+
+func TestProgressEvents(t *testing.T) {
+	ci := fs.GetConfig(context.Background())
+	oldProgress, oldLevel, oldPrintf := ci.Progress, ci.LogLevel, operations.SyncPrintf
+	defer func() { ci.Progress, ci.LogLevel, operations.SyncPrintf = oldProgress, oldLevel, oldPrintf }()
+	var lines []string
+	operations.SyncPrintf = func(format string, a ...any) {
+		lines = append(lines, fmt.Sprintf(format, a...))
+	}
+	ci.LogLevel = fs.LogLevelNotice
+
+	ci.Progress = false
+	assert.False(t, showProgressEvent(fs.LogLevelDebug))
+	ci.Progress = true
+	assert.True(t, showProgressEvent(fs.LogLevelDebug))
+	assert.False(t, showProgressEvent(fs.LogLevelNotice), "logged already")
+
+	f := &Fs{
+		opt:                 Options{ServiceAccountFile: "/sa/sa-031.json"},
+		ServiceAccountFiles: NewServiceAccountPool(context.Background(), 10),
+	}
+	f.logSwitch("userRateLimitExceeded")
+	assert.Equal(t, []string{"↻ switched to sa-031 (userRateLimitExceeded)\n"}, lines)
+
+	// Logged with -v
+	ci.LogLevel = fs.LogLevelInfo
+	f.opt.ServiceAccountLogSwitches = true
+	f.logSwitch("userRateLimitExceeded")
+	assert.Len(t, lines, 1)
+
+	ci.LogLevel = fs.LogLevelNotice
+	pool := newTestPool()
+	setFiles(pool, "/sa/sa-030.json", "/sa/sa-031.json")
+	defer serviceAccountBlacklist.Delete("/sa/sa-030.json")
+	_, err := pool.GetFile("/sa/sa-030.json")
+	require.NoError(t, err)
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[1], "⊘ blacklisted sa-030 for ")
+}
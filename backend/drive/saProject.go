@@ -0,0 +1,101 @@
+// Project level quota exhaustion
+//
+// Some Drive quotas are per GCP project rather than per SA. Once a project
+// runs out every SA created in it fails the same way, so switching between
+// them one by one only burns requests. When projectQuotaThreshold different
+// SAs of a project fail with the same reason within projectQuotaWindow the
+// whole project is taken to be exhausted and all its SAs are blacklisted.
+package drive
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+const (
+	// projectQuotaThreshold is how many SAs of one project must fail
+	projectQuotaThreshold = 3
+	// projectQuotaWindow is how close together the failures must be
+	projectQuotaWindow = 2 * time.Minute
+)
+
+// quotaFailure is a quota error seen on one SA
+type quotaFailure struct {
+	file   string
+	reason string
+	at     time.Time
+}
+
+// projectOf returns the project_id of the SA in file, or "" if it can't be
+// read - call with p.mu held.
+func (p *ServiceAccountPool) projectOf(file string) string {
+	if project, ok := p.projects[file]; ok {
+		return project
+	}
+	var key struct {
+		ProjectID string `json:"project_id"`
+	}
+	if data, err := readServiceAccountFile(file); err == nil {
+		_ = json.Unmarshal(data, &key)
+	}
+	p.projects[file] = key.ProjectID
+	return key.ProjectID
+}
+
+// RecordQuotaError notes that file failed with the quota error reason.
+//
+// If enough SAs from the same project have now failed with that reason the
+// project is assumed to be exhausted: every SA in it is blacklisted and
+// removed from the pool, and the number removed is returned.
+func (p *ServiceAccountPool) RecordQuotaError(file, reason string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	project := p.projectOf(file)
+	if project == "" {
+		return 0
+	}
+
+	// Keep only recent failures, at most one per SA
+	now := time.Now()
+	failures := p.quotaFailures[project][:0]
+	for _, failure := range p.quotaFailures[project] {
+		if now.Sub(failure.at) <= projectQuotaWindow && failure.file != file {
+			failures = append(failures, failure)
+		}
+	}
+	failures = append(failures, quotaFailure{file: file, reason: reason, at: now})
+	p.quotaFailures[project] = failures
+
+	matching := 0
+	for _, failure := range failures {
+		if failure.reason == reason {
+			matching++
+		}
+	}
+	if matching < projectQuotaThreshold {
+		return 0
+	}
+
+	// Blacklist every SA of the project
+	delete(p.quotaFailures, project)
+	removed := 0
+	var blacklisted []string
+	for _, entry := range p.sas {
+		if p.projectOf(entry.saPath) != project {
+			continue
+		}
+		blacklistSA(entry.saPath, now)
+		blacklisted = append(blacklisted, entry.saPath)
+		if entry.available {
+			removed++
+		}
+		p.retireSa(entry.saPath)
+	}
+	p.syncShared(blacklisted, p.claimed)
+	fs.Errorf(nil, "Project %s looks out of quota (%s on %d SAs) - blacklisted its %d remaining SA(s)", project, reason, matching, removed)
+	p.Metrics.Inc(metricProjectExhausted)
+	p.Metrics.SetGauge(metricAvailable, float64(p.availableCount()))
+	return removed
+}
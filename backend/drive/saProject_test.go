@@ -0,0 +1,50 @@
+package drive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordQuotaError(t *testing.T) {
+	dir := t.TempDir()
+	pool := newTestPool()
+	metrics := NewMemoryMetrics()
+	pool.Metrics = metrics
+	files := map[string][]string{}
+	for i, project := range []string{"p1", "p1", "p1", "p1", "p2"} {
+		file := filepath.Join(dir, fmt.Sprintf("%d.json", i))
+		require.NoError(t, os.WriteFile(file, []byte(`{"type":"service_account","project_id":"`+project+`"}`), 0600))
+		pool.setAvailable(pool.addSa(file), true)
+		files[project] = append(files[project], file)
+	}
+	defer func() {
+		for _, project := range files {
+			for _, file := range project {
+				serviceAccountBlacklist.Delete(file)
+			}
+		}
+	}()
+
+	// Different reasons and repeats of one SA don't count
+	assert.Equal(t, 0, pool.RecordQuotaError(files["p1"][0], "userRateLimitExceeded"))
+	assert.Equal(t, 0, pool.RecordQuotaError(files["p1"][0], "userRateLimitExceeded"))
+	assert.Equal(t, 0, pool.RecordQuotaError(files["p1"][1], "rateLimitExceeded"))
+	assert.Equal(t, 0, pool.RecordQuotaError(files["p2"][0], "userRateLimitExceeded"))
+	assert.Equal(t, 0, pool.RecordQuotaError(files["p1"][2], "userRateLimitExceeded"))
+	assert.Len(t, pool.availableFiles(), 5)
+
+	// The third SA of p1 with the same reason takes the project out
+	assert.Equal(t, 4, pool.RecordQuotaError(files["p1"][1], "userRateLimitExceeded"))
+	assert.Equal(t, map[string]struct{}{files["p2"][0]: {}}, pool.availableFiles())
+	_, blacklisted := serviceAccountBlacklist.Load(files["p1"][3])
+	assert.True(t, blacklisted)
+	assert.Equal(t, int64(1), metrics.Counter(metricProjectExhausted))
+
+	// Keys without a project are ignored
+	assert.Equal(t, 0, pool.RecordQuotaError(filepath.Join(dir, "missing.json"), "userRateLimitExceeded"))
+}
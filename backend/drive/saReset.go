@@ -0,0 +1,67 @@
+// Blacklisting until the quota resets
+//
+// A blacklisted SA sits out blacklistDuration, 25h, so that it is sure
+// to have passed Google's daily quota reset. The quotas reset at midnight
+// Pacific time though, so an SA which ran out of quota in the evening, by
+// Pacific time, sits out most of a day more than it has to.
+//
+// With blacklist_until_reset set an SA comes off the blacklist just after
+// the first reset following the time it was blacklisted, never later than
+// blacklistDuration. The setting is process wide, like the blacklist.
+package drive
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// blacklistUntilReset is set if SAs come off the blacklist at the quota reset
+var blacklistUntilReset atomic.Bool
+
+// quotaResetMargin is how long after midnight Pacific time SAs come off
+// the blacklist, so one picked on the dot doesn't find its quota not yet
+// reset and sit out another day.
+const quotaResetMargin = 10 * time.Minute
+
+// quotaResetLocation returns the time zone of the quota reset, falling
+// back to Pacific standard time if the time zone database is missing.
+var quotaResetLocation = sync.OnceValue(func() *time.Location {
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		return time.FixedZone("PST", -8*60*60)
+	}
+	return loc
+})
+
+// nextQuotaReset returns when the quota resets first after t.
+func nextQuotaReset(t time.Time) time.Time {
+	pacific := t.In(quotaResetLocation())
+	reset := time.Date(pacific.Year(), pacific.Month(), pacific.Day(), 0, 0, 0, 0, pacific.Location()).Add(quotaResetMargin)
+	if !reset.After(t) {
+		reset = time.Date(pacific.Year(), pacific.Month(), pacific.Day()+1, 0, 0, 0, 0, pacific.Location()).Add(quotaResetMargin)
+	}
+	return reset
+}
+
+// blacklistExpiry returns when an SA blacklisted at the wall clock time
+// since comes off the blacklist.
+func blacklistExpiry(since time.Time) time.Time {
+	expiry := since.Add(blacklistDuration)
+	if blacklistUntilReset.Load() {
+		if reset := nextQuotaReset(since); reset.Before(expiry) {
+			return reset
+		}
+	}
+	return expiry
+}
+
+// blacklistLeft returns how long an SA blacklisted at t, a blacklist
+// time, still sits out, which is negative once it has expired.
+func blacklistLeft(t time.Time) time.Duration {
+	left := blacklistDuration - blacklistElapsed(t)
+	if blacklistUntilReset.Load() {
+		left = min(left, time.Until(nextQuotaReset(blacklistAnchor(t))))
+	}
+	return left
+}
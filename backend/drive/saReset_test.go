@@ -0,0 +1,60 @@
+package drive
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextQuotaReset(t *testing.T) {
+	loc := quotaResetLocation()
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.March, day, hour, minute, 0, 0, loc)
+	}
+	for _, test := range []struct {
+		t, want time.Time
+	}{
+		{at(10, 20, 0), at(11, 0, 10)},
+		{at(10, 0, 5), at(10, 0, 10)},
+		{at(10, 0, 10), at(11, 0, 10)},
+		{at(10, 23, 59), at(11, 0, 10)},
+		{at(31, 12, 0), time.Date(2026, time.April, 1, 0, 10, 0, 0, loc)},
+		{at(10, 20, 0).UTC(), at(11, 0, 10)},
+	} {
+		assert.True(t, test.want.Equal(nextQuotaReset(test.t)), "%v: got %v want %v", test.t, nextQuotaReset(test.t), test.want)
+	}
+}
+
+func TestBlacklistExpiryReset(t *testing.T) {
+	defer blacklistUntilReset.Store(false)
+	loc := quotaResetLocation()
+	evening := time.Date(2026, time.March, 10, 20, 0, 0, 0, loc)
+	afterReset := time.Date(2026, time.March, 10, 0, 20, 0, 0, loc)
+
+	assert.Equal(t, evening.Add(blacklistDuration), blacklistExpiry(evening))
+	blacklistUntilReset.Store(true)
+	assert.Equal(t, time.Date(2026, time.March, 11, 0, 10, 0, 0, loc), blacklistExpiry(evening))
+	assert.Equal(t, time.Date(2026, time.March, 11, 0, 10, 0, 0, loc), blacklistExpiry(afterReset))
+}
+
+func TestBlacklistUntilReset(t *testing.T) {
+	defer blacklistUntilReset.Store(false)
+	defer serviceAccountBlacklist.Delete("reset-a")
+	now := time.Now()
+	lastReset := nextQuotaReset(now.Add(-24 * time.Hour))
+	beforeReset := lastReset.Add(-time.Minute)
+
+	// Blacklisted before the last reset but within 25h
+	blacklistSA("reset-a", beforeReset)
+	assert.True(t, isBlacklisted("reset-a"))
+	blacklistUntilReset.Store(true)
+	assert.False(t, isBlacklisted("reset-a"), "expired at the reset")
+	blacklistSA("reset-a", beforeReset)
+	assert.False(t, isBlacklisted("reset-a"), "not stored")
+
+	blacklistSA("reset-a", now)
+	assert.True(t, isBlacklisted("reset-a"))
+	blackTime, _ := serviceAccountBlacklist.Load("reset-a")
+	assert.InDelta(t, float64(time.Until(nextQuotaReset(now))), float64(blacklistLeft(blackTime.(time.Time))), float64(time.Second))
+}
@@ -0,0 +1,246 @@
+// Coordinating service accounts between processes
+//
+// Each eclone process keeps its blacklist in memory, so two processes
+// using the same SA folder happily pick SAs the other has already used up
+// or is busy with. With service_account_shared_state set they share a JSON
+// file, guarded by a lock file, in which they record:
+//   - the SAs each has blacklisted, with when, so the others skip them too
+//   - the SA each is using, renewed every sharedLeaseRenew, so the others
+//     prefer a different one while the lease is fresh
+//
+// The file is read and rewritten under the lock whenever GetFile picks a
+// new SA or an SA is blacklisted, which only happens on a switch, so the
+// overhead is small.
+package drive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/rclone/rclone/fs"
+)
+
+const (
+	// sharedLeaseDuration is how long a claim on an SA lasts without renewal
+	sharedLeaseDuration = 5 * time.Minute
+	// sharedLeaseRenew is how often a process renews its claim
+	sharedLeaseRenew = sharedLeaseDuration / 3
+	// sharedLockTimeout is how long to wait for another process to unlock
+	sharedLockTimeout = 10 * time.Second
+)
+
+// sharedSaState is what the processes share about one SA.
+type sharedSaState struct {
+	Blacklisted time.Time            `json:"blacklisted,omitzero"` // when it was blacklisted, if it is
+	Users       map[string]time.Time `json:"users,omitempty"`      // processes using it, with when they last said so
+}
+
+// sharedState is the content of the shared state file.
+type sharedState struct {
+	Accounts map[string]*sharedSaState `json:"accounts"`
+}
+
+// account returns the state of file, adding it if necessary.
+func (s *sharedState) account(file string) *sharedSaState {
+	account, ok := s.Accounts[file]
+	if !ok {
+		account = &sharedSaState{}
+		s.Accounts[file] = account
+	}
+	return account
+}
+
+// claim records that the process id is using the SA.
+func (s *sharedSaState) claim(id string, now time.Time) {
+	if s.Users == nil {
+		s.Users = make(map[string]time.Time)
+	}
+	s.Users[id] = now
+}
+
+// prune drops expired blacklists and leases and the SAs left with neither.
+func (s *sharedState) prune(now time.Time) {
+	for file, account := range s.Accounts {
+		if now.After(blacklistExpiry(account.Blacklisted)) {
+			account.Blacklisted = time.Time{}
+		}
+		for user, seen := range account.Users {
+			if now.Sub(seen) > sharedLeaseDuration {
+				delete(account.Users, user)
+			}
+		}
+		if account.Blacklisted.IsZero() && len(account.Users) == 0 {
+			delete(s.Accounts, file)
+		}
+	}
+}
+
+// sharedStateFile is a state file shared with other processes.
+type sharedStateFile struct {
+	path string
+	id   string // identifies this process in Users
+	lock *flock.Flock
+}
+
+// newSharedStateFile returns the shared state file at path.
+func newSharedStateFile(path string) *sharedStateFile {
+	host, _ := os.Hostname()
+	return &sharedStateFile{
+		path: path,
+		id:   fmt.Sprintf("%s:%d", host, os.Getpid()),
+		lock: flock.New(path + ".lock"),
+	}
+}
+
+// update locks the file, reads it, calls fn with its content and writes
+// it back.
+func (s *sharedStateFile) update(fn func(state *sharedState)) (err error) {
+	if err = os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to create shared state directory: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sharedLockTimeout)
+	defer cancel()
+	locked, err := s.lock.TryLockContext(ctx, 10*time.Millisecond)
+	if err != nil || !locked {
+		return fmt.Errorf("failed to lock shared state: %w", errors.Join(err, ctx.Err()))
+	}
+	defer func() {
+		if unlockErr := s.lock.Unlock(); err == nil && unlockErr != nil {
+			err = fmt.Errorf("failed to unlock shared state: %w", unlockErr)
+		}
+	}()
+
+	state := sharedState{Accounts: make(map[string]*sharedSaState)}
+	buf, err := os.ReadFile(s.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("failed to read shared state: %w", err)
+	default:
+		if err = json.Unmarshal(buf, &state); err != nil {
+			// Start afresh rather than wedging every process
+			fs.Errorf(nil, "Ignoring corrupt shared service account state %q: %v", s.path, err)
+			state.Accounts = make(map[string]*sharedSaState)
+		}
+		if state.Accounts == nil {
+			state.Accounts = make(map[string]*sharedSaState)
+		}
+	}
+
+	state.prune(time.Now())
+	fn(&state)
+
+	if buf, err = json.Marshal(&state); err != nil {
+		return fmt.Errorf("failed to encode shared state: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err = os.WriteFile(tmp, buf, 0600); err != nil {
+		return fmt.Errorf("failed to write shared state: %w", err)
+	}
+	if err = os.Rename(tmp, s.path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write shared state: %w", err)
+	}
+	return nil
+}
+
+// UseSharedState makes the pool coordinate with other processes through
+// the shared state file at path, claiming active, the SA in use, and
+// renewing the claim until the pool is closed.
+func (p *ServiceAccountPool) UseSharedState(path, active string) {
+	p.mu.Lock()
+	p.shared = newSharedStateFile(path)
+	p.syncShared(nil, active)
+	p.mu.Unlock()
+	go func() {
+		ticker := time.NewTicker(sharedLeaseRenew)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.ctx.Done():
+				return
+			case <-ticker.C:
+				p.mu.Lock()
+				p.syncShared(nil, p.claimed)
+				p.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// claimShared claims file in the shared state, if there is one.
+func (p *ServiceAccountPool) claimShared(file string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.syncShared(nil, file)
+}
+
+// syncShared publishes the SAs in blacklisted and a claim on the SA in
+// use, if any, to the shared state, and imports the blacklists of the
+// other processes. It returns the SAs other processes are using - call
+// with p.mu held.
+//
+// Failures are logged, the pool carrying on without coordination.
+func (p *ServiceAccountPool) syncShared(blacklisted []string, use string) (busy map[string]struct{}) {
+	if p.shared == nil {
+		return nil
+	}
+	now := time.Now()
+	var imported []string
+	err := p.shared.update(func(state *sharedState) {
+		for _, file := range blacklisted {
+			state.account(file).Blacklisted = now
+		}
+		busy = make(map[string]struct{})
+		for file, account := range state.Accounts {
+			delete(account.Users, p.shared.id)
+			if len(account.Users) > 0 {
+				busy[file] = struct{}{}
+			}
+			if _, known := p.saIndex[file]; known && !account.Blacklisted.IsZero() && !isBlacklisted(file) {
+				blacklistSA(file, account.Blacklisted)
+				imported = append(imported, file)
+			}
+		}
+		if use != "" {
+			state.account(use).claim(p.shared.id, now)
+		}
+	})
+	if err != nil {
+		fs.Errorf(nil, "Failed to share service account state: %v", err)
+		return nil
+	}
+	p.claimed = use
+	for _, file := range imported {
+		saDebugf(nil, "Service Account %s was blacklisted by another process", file)
+		p.retireSa(file)
+	}
+	if len(imported) > 0 {
+		p.Metrics.SetGauge(metricAvailable, float64(p.availableCount()))
+	}
+	return busy
+}
+
+// clearShared drops the blacklist of files from the shared state, if
+// there is one - call with p.mu held.
+func (p *ServiceAccountPool) clearShared(files []string) {
+	if p.shared == nil || len(files) == 0 {
+		return
+	}
+	err := p.shared.update(func(state *sharedState) {
+		for _, file := range files {
+			if account, ok := state.Accounts[file]; ok {
+				account.Blacklisted = time.Time{}
+			}
+		}
+	})
+	if err != nil {
+		fs.Errorf(nil, "Failed to share service account state: %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package drive
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSharedTestPool makes a pool using the shared state in path as the
+// process called id.
+func newSharedTestPool(t *testing.T, path, id string, files ...string) *ServiceAccountPool {
+	p := newTestPool()
+	t.Cleanup(func() { p.cancel() })
+	setFiles(p, files...)
+	p.shared = newSharedStateFile(path)
+	p.shared.id = id
+	return p
+}
+
+func TestSharedState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shared", "sa.json")
+	a := newSharedTestPool(t, path, "a", "x", "y", "z")
+	b := newSharedTestPool(t, path, "b", "x", "y", "z")
+	defer serviceAccountBlacklist.Delete("x")
+
+	// a uses up x and moves on, claiming what it picked
+	aFile, err := a.GetFile("x")
+	require.NoError(t, err)
+	assert.Equal(t, aFile, a.claimed)
+
+	// b only sees the blacklist through the shared file
+	serviceAccountBlacklist.Delete("x")
+	for range 10 {
+		bFile, err := b.GetFile("")
+		require.NoError(t, err)
+		assert.NotEqual(t, "x", bFile)
+		assert.NotEqual(t, aFile, bFile, "should prefer the SA a isn't using")
+	}
+	assert.NotContains(t, b.availableFiles(), "x")
+	assert.True(t, isBlacklisted("x"))
+
+	// Closing releases the claim
+	require.NoError(t, a.Close())
+	buf, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var state sharedState
+	require.NoError(t, json.Unmarshal(buf, &state))
+	assert.NotContains(t, state.Accounts[aFile].Users, "a")
+	assert.False(t, state.Accounts["x"].Blacklisted.IsZero())
+
+	// With a claim on every SA left, a busy one is still handed out
+	c := newSharedTestPool(t, path, "c", "y")
+	c.claimShared("y")
+	file, err := b.GetFile("")
+	require.NoError(t, err)
+	assert.Contains(t, []string{"y", "z"}, file)
+}
+
+func TestSharedStateCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sa.json")
+	require.NoError(t, os.WriteFile(path, []byte("{nope"), 0600))
+	a := newSharedTestPool(t, path, "a", "x")
+	a.claimShared("x")
+	buf, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(buf), `"a"`)
+}
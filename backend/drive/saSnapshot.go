@@ -0,0 +1,251 @@
+// Service Account Pool snapshot and restore
+//
+// A PoolSnapshot captures everything needed to rebuild the rotation state of
+// a ServiceAccountPool: the indexed SA entries with their stale and
+// available flags, the active SA, blacklist timers and per-SA rate-limit
+// counters. It is plain data so it can be JSON encoded for
+// persistence or dumped over rc for debugging.
+//
+// It also holds the bytes transferred with the pool over the last day, for
+// max_daily_transfer.
+package drive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+)
+
+// SaState is the serializable state of a single service account.
+type SaState struct {
+	Path          string    `json:"path"`
+	Index         int       `json:"index"`
+	Stale         bool      `json:"stale"`
+	Available     bool      `json:"available"`                // present in the GetFile pool
+	Blacklisted   time.Time `json:"blacklisted,omitzero"`     // when it was blacklisted, if it is
+	RateLimitHits int64     `json:"rate_limit_hits,omitzero"` // times it was excluded for rate limiting
+	Uploaded      int64     `json:"uploaded,omitzero"`        // bytes uploaded with it
+	Deleted       int64     `json:"deleted,omitzero"`         // files and directories deleted with it
+	Dead          string    `json:"dead,omitempty"`           // why it can never be used again, if it can't
+}
+
+// PoolSnapshot is a serializable view of a ServiceAccountPool.
+type PoolSnapshot struct {
+	Time     time.Time `json:"time"`
+	Active   string    `json:"active"`
+	Accounts []SaState `json:"accounts"`
+
+	// Transfers holds the bytes transferred by hour over the last day
+	Transfers map[time.Time]int64 `json:"transfers,omitempty"`
+}
+
+// Snapshot returns a copy of the current pool state.
+//
+// Blacklist timers are read from the process-wide blacklist, so only
+// entries for SAs known to this pool are included.
+func (p *ServiceAccountPool) Snapshot() *PoolSnapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	snap := &PoolSnapshot{
+		Time:     time.Now(),
+		Accounts: make([]SaState, 0, len(p.sas)),
+	}
+	if p.dailyTransferred() > 0 {
+		snap.Transfers = maps.Clone(p.transfers)
+	}
+	if entry, ok := p.sas[p.activeIdx]; ok {
+		snap.Active = entry.saPath
+	}
+	for idx, entry := range p.sas {
+		snap.Accounts = append(snap.Accounts, p.saState(idx, entry))
+	}
+	// Dead SAs which Load has since left out are still reported
+	for file := range p.dead {
+		if _, ok := p.saIndex[file]; !ok {
+			snap.Accounts = append(snap.Accounts, p.saState(-1, SaEntry{saPath: file, isStale: true}))
+		}
+	}
+	sort.Slice(snap.Accounts, func(i, j int) bool {
+		a, b := snap.Accounts[i], snap.Accounts[j]
+		if a.Index != b.Index {
+			return a.Index < b.Index
+		}
+		return a.Path < b.Path
+	})
+	return snap
+}
+
+// saState builds the SaState for a single SA - call with p.mu held.
+func (p *ServiceAccountPool) saState(idx int, entry SaEntry) SaState {
+	state := SaState{
+		Path:          entry.saPath,
+		Index:         idx,
+		Stale:         entry.isStale,
+		Available:     entry.available,
+		RateLimitHits: p.rateLimitHits[entry.saPath],
+		Uploaded:      p.uploaded[entry.saPath],
+		Deleted:       p.deleted[entry.saPath],
+		Dead:          p.dead[entry.saPath],
+	}
+	if blackTime, ok := serviceAccountBlacklist.Load(entry.saPath); ok {
+		state.Blacklisted = blacklistAnchor(blackTime.(time.Time))
+	}
+	return state
+}
+
+// Restore replaces the pool state with the one in snap.
+//
+// Blacklist entries which have already expired are not restored.
+func (p *ServiceAccountPool) Restore(snap *PoolSnapshot) error {
+	if snap == nil {
+		return fmt.Errorf("can't restore from nil snapshot")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sas := make(map[int]SaEntry, len(snap.Accounts))
+	saIndex := make(map[string]int, len(snap.Accounts))
+	hits := make(map[string]int64, len(snap.Accounts))
+	uploaded := make(map[string]int64)
+	deleted := make(map[string]int64)
+	dead := make(map[string]string)
+	next := 0
+	for _, state := range snap.Accounts {
+		if state.Index >= next {
+			next = state.Index + 1
+		}
+	}
+	for _, state := range snap.Accounts {
+		if state.Path == "" {
+			return fmt.Errorf("can't restore service account with empty path")
+		}
+		idx := state.Index
+		if idx < 0 {
+			idx = next
+			next++
+		}
+		if _, dup := sas[idx]; dup {
+			return fmt.Errorf("duplicate service account index %d in snapshot", idx)
+		}
+		sas[idx] = SaEntry{saPath: state.Path, isStale: state.Stale, available: state.Available}
+		saIndex[state.Path] = idx
+		if state.RateLimitHits != 0 {
+			hits[state.Path] = state.RateLimitHits
+		}
+		if state.Uploaded != 0 {
+			uploaded[state.Path] = state.Uploaded
+		}
+		if state.Deleted != 0 {
+			deleted[state.Path] = state.Deleted
+		}
+		if state.Dead != "" {
+			dead[state.Path] = state.Dead
+		}
+		if !state.Blacklisted.IsZero() {
+			blacklistSA(state.Path, state.Blacklisted)
+		}
+	}
+
+	p.sas = sas
+	p.order = slices.Sorted(maps.Keys(sas))
+	p.saIndex = saIndex
+	p.rateLimitHits = hits
+	p.uploaded = uploaded
+	p.deleted = deleted
+	p.dead = dead
+	p.transfers = make(map[time.Time]int64, len(snap.Transfers))
+	maps.Copy(p.transfers, snap.Transfers)
+	p.activeIdx = -1
+	for idx, entry := range sas {
+		if entry.saPath == snap.Active {
+			p.activeIdx = idx
+			break
+		}
+	}
+	return nil
+}
+
+// SaveState writes a snapshot of the pool to file as JSON.
+//
+// The file is written to a temporary name and renamed into place so a
+// crash part way through doesn't leave a truncated state file behind.
+func (p *ServiceAccountPool) SaveState(file string) error {
+	buf, err := json.MarshalIndent(p.Snapshot(), "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to encode service account state: %w", err)
+	}
+	if err = os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return fmt.Errorf("failed to create service account state directory: %w", err)
+	}
+	tmp := file + ".tmp"
+	if err = os.WriteFile(tmp, buf, 0600); err != nil {
+		return fmt.Errorf("failed to write service account state: %w", err)
+	}
+	if err = os.Rename(tmp, file); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write service account state: %w", err)
+	}
+	return nil
+}
+
+// LoadState merges the state saved in file by SaveState into the pool.
+//
+// Unlike Restore this keeps the SAs the pool already has, carrying over
+// only the unexpired blacklist timers, rate limit counters and dead marks
+// for SAs which are still present. A missing file is not an error.
+//
+// The bytes transferred with the pool over the last day are carried over
+// too, so that max_daily_transfer counts them over successive runs.
+func (p *ServiceAccountPool) LoadState(file string) error {
+	buf, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read service account state: %w", err)
+	}
+	var snap PoolSnapshot
+	if err = json.Unmarshal(buf, &snap); err != nil {
+		return fmt.Errorf("failed to decode service account state: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, state := range snap.Accounts {
+		if _, known := p.saIndex[state.Path]; !known {
+			continue
+		}
+		if state.RateLimitHits != 0 {
+			p.rateLimitHits[state.Path] = state.RateLimitHits
+		}
+		if state.Uploaded != 0 {
+			p.uploaded[state.Path] = state.Uploaded
+		}
+		if state.Deleted != 0 {
+			p.deleted[state.Path] = state.Deleted
+		}
+		if state.Dead != "" {
+			p.dead[state.Path] = state.Dead
+			p.retireSa(state.Path)
+		}
+		if !state.Blacklisted.IsZero() {
+			blacklistSA(state.Path, state.Blacklisted)
+			// Blacklisting made it stale, which lasts only as long as
+			// the blacklist does
+			if state.Stale && isBlacklisted(state.Path) {
+				p.retireSa(state.Path)
+			}
+		}
+	}
+	for bucket, n := range snap.Transfers {
+		p.transfers[bucket] = max(p.transfers[bucket], n)
+	}
+	return nil
+}
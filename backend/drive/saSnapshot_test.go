@@ -0,0 +1,200 @@
+package drive
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	a := newTestPool()
+	a.updateSas([]string{"a", "b", "c"}, "a")
+	setFiles(a, "a", "b", "c")
+	a.activeSa("b")
+	a.staleSa("c")
+	a.activeSa("b")
+
+	// Exclude "a" so it gets blacklisted and counted
+	_, err := a.GetFile("a")
+	require.NoError(t, err)
+	defer serviceAccountBlacklist.Delete("a")
+	a.RecordUpload("b", 100)
+	a.RecordDelete("b")
+
+	snap := a.Snapshot()
+	assert.Equal(t, "b", snap.Active)
+	require.Len(t, snap.Accounts, 3)
+	assert.Equal(t, "a", snap.Accounts[0].Path)
+	assert.False(t, snap.Accounts[0].Available)
+	assert.False(t, snap.Accounts[0].Blacklisted.IsZero())
+	assert.Equal(t, int64(1), snap.Accounts[0].RateLimitHits)
+	assert.Equal(t, int64(100), snap.Accounts[1].Uploaded)
+	assert.Equal(t, int64(1), snap.Accounts[1].Deleted)
+	assert.True(t, snap.Accounts[2].Stale)
+
+	// Round trip through JSON into a fresh pool
+	buf, err := json.Marshal(snap)
+	require.NoError(t, err)
+	var decoded PoolSnapshot
+	require.NoError(t, json.Unmarshal(buf, &decoded))
+
+	serviceAccountBlacklist.Delete("a")
+	b := newTestPool()
+	require.NoError(t, b.Restore(&decoded))
+	assert.Equal(t, 1, b.activeIdx)
+	assert.Equal(t, a.sas, b.sas)
+	assert.Equal(t, a.saIndex, b.saIndex)
+	assert.Equal(t, a.availableFiles(), b.availableFiles())
+	assert.Equal(t, int64(1), b.rateLimitHits["a"])
+	assert.Equal(t, map[string]int64{"b": 100}, b.uploaded)
+	assert.Equal(t, map[string]int64{"b": 1}, b.deleted)
+	_, blacklisted := serviceAccountBlacklist.Load("a")
+	assert.True(t, blacklisted)
+}
+
+func TestRestoreExpiredBlacklist(t *testing.T) {
+	a := newTestPool()
+	err := a.Restore(&PoolSnapshot{
+		Accounts: []SaState{
+			{Path: "/sa/old.json", Index: 0, Available: true, Blacklisted: time.Now().Add(-26 * time.Hour)},
+			{Path: "/sa/new.json", Index: -1, Available: true},
+		},
+	})
+	require.NoError(t, err)
+	_, blacklisted := serviceAccountBlacklist.Load("/sa/old.json")
+	assert.False(t, blacklisted)
+	assert.Equal(t, "/sa/new.json", a.sas[1].saPath)
+	assert.Equal(t, -1, a.activeIdx)
+	assert.Len(t, a.availableFiles(), 2)
+}
+
+func TestRestoreKeepsOrder(t *testing.T) {
+	a := newTestPool()
+	require.NoError(t, a.Restore(&PoolSnapshot{
+		Accounts: []SaState{
+			{Path: "c", Index: 5},
+			{Path: "a", Index: 0},
+			{Path: "b", Index: 2},
+		},
+	}))
+	assert.Equal(t, []int{0, 2, 5}, a.order)
+
+	// New SAs go after the others, without reusing an index
+	assert.Equal(t, 6, a.addSa("d"))
+	assert.Equal(t, []int{0, 2, 5, 6}, a.order)
+	assert.Equal(t, "c", a.sas[5].saPath)
+}
+
+func TestRestoreInvalid(t *testing.T) {
+	a := newTestPool()
+	assert.Error(t, a.Restore(nil))
+	assert.Error(t, a.Restore(&PoolSnapshot{Accounts: []SaState{{Path: ""}}}))
+	assert.Error(t, a.Restore(&PoolSnapshot{Accounts: []SaState{
+		{Path: "a", Index: 0},
+		{Path: "b", Index: 0},
+	}}))
+}
+
+func TestCloseSavesState(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state", "sa.json")
+	a := newTestPool()
+	a.updateSas([]string{"/sa/a.json", "/sa/b.json"}, "/sa/a.json")
+	setFiles(a, "/sa/a.json", "/sa/b.json")
+	a.StateFile = stateFile
+	a.AddService(nil, nil)
+
+	_, err := a.GetFile("/sa/a.json")
+	require.NoError(t, err)
+	defer serviceAccountBlacklist.Delete("/sa/a.json")
+
+	require.NoError(t, a.Close())
+	assert.Empty(t, a.svcs)
+	assert.Error(t, a.ctx.Err())
+
+	// A fresh pool loaded from the folder picks the state back up,
+	// ignoring SAs which have since gone away
+	serviceAccountBlacklist.Delete("/sa/a.json")
+	b := newTestPool()
+	b.updateSas([]string{"/sa/a.json"}, "/sa/a.json")
+	setFiles(b, "/sa/a.json")
+	require.NoError(t, b.LoadState(stateFile))
+	assert.Equal(t, int64(1), b.rateLimitHits["/sa/a.json"])
+	_, blacklisted := serviceAccountBlacklist.Load("/sa/a.json")
+	assert.True(t, blacklisted)
+	assert.Len(t, b.sas, 1)
+
+	// A missing state file is fine
+	assert.NoError(t, b.LoadState(filepath.Join(t.TempDir(), "missing.json")))
+}
+
+func TestLoadStateExpiredBlacklist(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "sa.json")
+	files := []string{"/sa/expired.json", "/sa/recent.json"}
+	defer func() {
+		for _, file := range files {
+			serviceAccountBlacklist.Delete(file)
+		}
+	}()
+	a := newTestPool()
+	a.updateSas(files, files[0])
+	setFiles(a, files...)
+	for _, file := range files {
+		_, _ = a.GetFile(file)
+	}
+	require.NoError(t, a.SaveState(stateFile))
+
+	// Load it once the blacklist of one of them has expired
+	buf, err := os.ReadFile(stateFile)
+	require.NoError(t, err)
+	var snap PoolSnapshot
+	require.NoError(t, json.Unmarshal(buf, &snap))
+	for i := range snap.Accounts {
+		assert.True(t, snap.Accounts[i].Stale)
+		if snap.Accounts[i].Path == "/sa/expired.json" {
+			snap.Accounts[i].Blacklisted = snap.Accounts[i].Blacklisted.Add(-blacklistDuration - time.Hour)
+		}
+	}
+	buf, err = json.Marshal(snap)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(stateFile, buf, 0600))
+	for _, file := range files {
+		serviceAccountBlacklist.Delete(file)
+	}
+
+	b := newTestPool()
+	b.updateSas(files, files[0])
+	setFiles(b, files...)
+	require.NoError(t, b.LoadState(stateFile))
+	assert.False(t, isBlacklisted("/sa/expired.json"))
+	assert.True(t, isBlacklisted("/sa/recent.json"))
+	available := b.availableFiles()
+	assert.Contains(t, available, "/sa/expired.json")
+	assert.NotContains(t, available, "/sa/recent.json")
+	assert.False(t, b.sas[b.saIndex["/sa/expired.json"]].isStale)
+}
+
+func TestNewFsFailureSavesState(t *testing.T) {
+	dir := t.TempDir()
+	saDir := filepath.Join(dir, "sa")
+	require.NoError(t, os.Mkdir(saDir, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(saDir, "1.json"), []byte("{}"), 0o600))
+	state := filepath.Join(dir, "state.json")
+
+	// The chunk size is checked after the pool has started probing
+	_, err := newFs(context.Background(), "remote", "", configmap.Simple{
+		"service_account_file_path":      saDir,
+		"service_account_state_file":     state,
+		"service_account_probe_interval": "1h",
+		"chunk_size":                     "3",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "chunk size")
+	assert.FileExists(t, state, "pool wasn't closed")
+}
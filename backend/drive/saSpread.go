@@ -0,0 +1,83 @@
+// Spreading reads over the preloaded service accounts
+//
+// Every read normally goes through the SA the remote is using, so a server
+// streaming to many clients at once, e.g. eclone serve http, funnels them
+// all through one account. With sa_spread_reads each file opened for
+// reading picks one of the preloaded SAs instead - the one with the fewest
+// reads in flight, or the least recently picked of those - and keeps it
+// until the file is closed.
+package drive
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// readLoad is the reads going through one preloaded client.
+type readLoad struct {
+	inFlight int    // reads open
+	picked   uint64 // value of readSeq when last picked
+}
+
+// ReadClient returns the preloaded client with the fewest reads in flight,
+// breaking ties by picking the least recently used, and a function to call
+// when the read is done. It returns ErrNoPreloaded if there are no
+// preloaded clients.
+func (p *ServiceAccountPool) ReadClient() (client *http.Client, release func(), err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.reads == nil {
+		p.reads = make(map[*http.Client]*readLoad)
+	}
+	preloaded := make(map[*http.Client]struct{}, len(p.svcs))
+	var best *readLoad
+	for _, svc := range p.svcs {
+		if svc.Client == nil {
+			continue
+		}
+		preloaded[svc.Client] = struct{}{}
+		load, ok := p.reads[svc.Client]
+		if !ok {
+			load = &readLoad{}
+			p.reads[svc.Client] = load
+		}
+		if best == nil || load.inFlight < best.inFlight ||
+			(load.inFlight == best.inFlight && load.picked < best.picked) {
+			client, best = svc.Client, load
+		}
+	}
+	// Forget clients which have been dropped from the pool once idle
+	for c, load := range p.reads {
+		if _, ok := preloaded[c]; !ok && load.inFlight == 0 {
+			delete(p.reads, c)
+		}
+	}
+	if best == nil {
+		return nil, nil, ErrNoPreloaded
+	}
+	p.readSeq++
+	best.inFlight++
+	best.picked = p.readSeq
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			p.mu.Lock()
+			best.inFlight--
+			p.mu.Unlock()
+		})
+	}
+	return client, release, nil
+}
+
+// releaseOnClose calls release when the body is closed.
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+// Close the body and release its client
+func (r *releaseOnClose) Close() error {
+	defer r.release()
+	return r.ReadCloser.Close()
+}
@@ -0,0 +1,100 @@
+package drive
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/pacer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadClient(t *testing.T) {
+	p := newTestPool()
+	_, _, err := p.ReadClient()
+	assert.ErrorIs(t, err, ErrNoPreloaded)
+
+	a, b, c := &http.Client{}, &http.Client{}, &http.Client{}
+	p.AddService(c, nil)
+	p.AddService(b, nil)
+	p.AddService(a, nil)
+
+	// Idle clients are picked least recently used first
+	got1, release1, err := p.ReadClient()
+	require.NoError(t, err)
+	got2, release2, err := p.ReadClient()
+	require.NoError(t, err)
+	got3, release3, err := p.ReadClient()
+	require.NoError(t, err)
+	assert.Equal(t, []*http.Client{a, b, c}, []*http.Client{got1, got2, got3})
+
+	// The client with the fewest reads in flight wins
+	release2()
+	release2() // twice is harmless
+	got, release, err := p.ReadClient()
+	require.NoError(t, err)
+	assert.Same(t, b, got)
+	release()
+	release1()
+	release3()
+
+	// Clients dropped from the pool are forgotten once idle
+	p.mu.Lock()
+	p.svcs = p.svcs[:1]
+	p.mu.Unlock()
+	got, release, err = p.ReadClient()
+	require.NoError(t, err)
+	assert.Same(t, a, got)
+	release()
+	assert.Len(t, p.reads, 1)
+}
+
+func TestOpenSpreadsReads(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Header.Get("X-Test-SA"))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	pool := NewServiceAccountPool(ctx, 10)
+	f := &Fs{
+		client:              clientNamed("active"),
+		pacer:               fs.NewPacer(ctx, pacer.NewGoogleDrive(pacer.MinSleep(time.Millisecond))),
+		ServiceAccountFiles: pool,
+	}
+	f.opt.ServiceAccountSpreadReads = true
+	o := &baseObject{fs: f, remote: "file", bytes: 5}
+
+	read := func() (string, io.ReadCloser) {
+		in, err := o.open(ctx, srv.URL)
+		require.NoError(t, err)
+		data, err := io.ReadAll(in)
+		require.NoError(t, err)
+		return string(data), in
+	}
+
+	// Without preloaded SAs reads use the Fs's own
+	who, in := read()
+	assert.Equal(t, "active", who)
+	require.NoError(t, in.Close())
+
+	// With them open files are spread over them
+	pool.AddService(clientNamed("two"), nil)
+	pool.AddService(clientNamed("one"), nil)
+	who1, in1 := read()
+	who2, in2 := read()
+	assert.Equal(t, []string{"one", "two"}, []string{who1, who2})
+	require.NoError(t, in1.Close())
+	who3, in3 := read()
+	assert.Equal(t, "one", who3)
+	require.NoError(t, in2.Close())
+	require.NoError(t, in3.Close())
+	for _, load := range pool.reads {
+		assert.Zero(t, load.inFlight)
+	}
+}
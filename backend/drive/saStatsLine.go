@@ -0,0 +1,93 @@
+// Pool health in the stats
+//
+// The pool only reports what it does at debug level, so a normal run
+// gives no hint that it is down to its last few SAs until it fails. With
+// sa_stats a line on the health of the pool is logged after the stats,
+// at the same interval and level:
+//
+//	SAs: 87 available, 12 blacklisted, 1 dead, active: sa-045@project.iam.gserviceaccount.com
+//
+// The interval is that of --stats, so the line is only logged by commands
+// run from the command line, and not with --progress which redraws the
+// stats in place.
+package drive
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/spf13/pflag"
+)
+
+// poolHealth is what the stats line says about the pool.
+type poolHealth struct {
+	available   int    // SAs which can be switched to
+	blacklisted int    // SAs resting after a rate limit
+	dead        int    // SAs which can never be used again
+	active      string // email of the SA in use, or its file if unreadable
+}
+
+// health returns the health of the pool.
+func (p *ServiceAccountPool) health() poolHealth {
+	snap := p.Snapshot()
+	var h poolHealth
+	for _, state := range snap.Accounts {
+		switch {
+		case state.Dead != "":
+			h.dead++
+		case isBlacklisted(state.Path):
+			h.blacklisted++
+		case !state.Stale:
+			h.available++
+		}
+	}
+	if snap.Active != "" {
+		h.active = serviceAccountEmail(snap.Active)
+		if h.active == "" {
+			h.active = filepath.Base(snap.Active)
+		}
+	}
+	return h
+}
+
+// String returns the line logged with the stats
+func (h poolHealth) String() string {
+	active := h.active
+	if active == "" {
+		active = "none"
+	}
+	return fmt.Sprintf("SAs: %d available, %d blacklisted, %d dead, active: %s", h.available, h.blacklisted, h.dead, active)
+}
+
+// statsInterval returns the --stats interval, 0 if stats aren't printed.
+func statsInterval(ci *fs.ConfigInfo) time.Duration {
+	flag := pflag.Lookup("stats")
+	if flag == nil || ci.Progress {
+		return 0
+	}
+	interval, ok := flag.Value.(*fs.Duration)
+	if !ok {
+		return 0
+	}
+	return time.Duration(*interval)
+}
+
+// StartStatsLine logs the health of the pool every interval until the
+// pool is closed.
+func (p *ServiceAccountPool) StartStatsLine(interval time.Duration) {
+	ci := fs.GetConfig(p.ctx)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.ctx.Done():
+				return
+			case <-ticker.C:
+				fs.LogLevelPrintf(ci.StatsLogLevel, nil, "%v", p.health())
+			}
+		}
+	}()
+}
@@ -0,0 +1,49 @@
+package drive
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolHealth(t *testing.T) {
+	const active = "bundle:sa-045@p.iam.gserviceaccount.com"
+	serviceAccountCredentials.Store(active, []byte(`{"client_email":"sa-045@p.iam.gserviceaccount.com"}`))
+	defer serviceAccountCredentials.Delete(active)
+
+	p := newTestPool()
+	setFiles(p, active, "b.json", "c.json", "d.json")
+	p.activeSa(active)
+	p.dead["c.json"] = "deleted"
+	blacklistSA("d.json", time.Now())
+	defer serviceAccountBlacklist.Delete("d.json")
+	// Expired blacklist entries don't count
+	serviceAccountBlacklist.Store("b.json", time.Now().Add(-2*blacklistDuration))
+
+	h := p.health()
+	assert.Equal(t, poolHealth{available: 2, blacklisted: 1, dead: 1, active: "sa-045@p.iam.gserviceaccount.com"}, h)
+	assert.Equal(t, "SAs: 2 available, 1 blacklisted, 1 dead, active: sa-045@p.iam.gserviceaccount.com", h.String())
+
+	// Keys which can't be read show their file name
+	p.activeSa("c.json")
+	assert.Equal(t, "c.json", p.health().active)
+
+	assert.Equal(t, "SAs: 0 available, 0 blacklisted, 0 dead, active: none", newTestPool().health().String())
+}
+
+func TestStatsInterval(t *testing.T) {
+	ci := &fs.ConfigInfo{}
+	// No --stats flag outside the command line
+	assert.Equal(t, time.Duration(0), statsInterval(ci))
+
+	interval := fs.Duration(30 * time.Second)
+	pflag.Var(&interval, "stats", "")
+	assert.Equal(t, 30*time.Second, statsInterval(ci))
+
+	// --progress draws the stats itself
+	ci.Progress = true
+	assert.Equal(t, time.Duration(0), statsInterval(ci))
+}
@@ -0,0 +1,209 @@
+// Virtual status file
+//
+// With sa_status_file the remote has an extra file, .eclone/sa-status.json,
+// which doesn't exist on Drive. Reading it returns the live pool state so
+// scripts watching a long running job can see which SA is in use, when
+// each blacklist expires and how much has been uploaded with each SA
+// without going through rc.
+//
+// The file is only there when asked for by its path, or that of its
+// directory, and never shows up in the listing of the root, so copies
+// and syncs from the remote don't pick it up. A mount of .eclone shows
+// it.
+//
+// Mounts take the size of a file from its listing, so the size reported is
+// that of the state at listing time plus statusSlack. Reads render the
+// state afresh and pad it with spaces, which JSON ignores, to that size.
+package drive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+const (
+	// statusDir is the virtual directory holding the status file
+	statusDir = ".eclone"
+	// statusName is the name of the status file
+	statusName = "sa-status.json"
+	// statusFile is the path of the status file from the top of the remote
+	statusFile = statusDir + "/" + statusName
+	// statusSlack is how much the status may grow between listing and reading
+	statusSlack = 4096
+)
+
+// errStatusReadOnly is returned when trying to change the status file
+var errStatusReadOnly = errors.New("the service account status file is read only")
+
+// saStatusAccount is the status of one SA.
+type saStatusAccount struct {
+	SaState
+	BlacklistExpires time.Time `json:"blacklist_expires,omitzero"` // when the blacklist expires, if blacklisted
+}
+
+// saStatus is the content of the status file.
+type saStatus struct {
+	Time      time.Time         `json:"time"`
+	Active    string            `json:"active"`
+	Available int               `json:"available"`
+	Preloaded int               `json:"preloaded"`
+	Accounts  []saStatusAccount `json:"accounts"`
+}
+
+// status returns the current state of the pool as shown in the status file.
+func (p *ServiceAccountPool) status() *saStatus {
+	snap := p.Snapshot()
+	status := &saStatus{
+		Time:      snap.Time,
+		Active:    snap.Active,
+		Available: p.Available(),
+		Preloaded: p.Preloaded(),
+		Accounts:  make([]saStatusAccount, len(snap.Accounts)),
+	}
+	for i, state := range snap.Accounts {
+		status.Accounts[i].SaState = state
+		if !state.Blacklisted.IsZero() {
+			status.Accounts[i].BlacklistExpires = blacklistExpiry(state.Blacklisted)
+		}
+	}
+	return status
+}
+
+// statusObject is the virtual status file.
+type statusObject struct {
+	fs      *Fs
+	remote  string
+	modTime time.Time
+	size    int64
+}
+
+// newStatusObject returns the status file at remote sized for the state
+// now.
+func (f *Fs) newStatusObject(remote string) *statusObject {
+	buf, _ := json.MarshalIndent(f.ServiceAccountFiles.status(), "", "\t")
+	return &statusObject{
+		fs:      f,
+		remote:  remote,
+		modTime: time.Now(),
+		size:    int64(len(buf)) + statusSlack,
+	}
+}
+
+// statusPath returns the path of remote from the top of the remote, to
+// compare with statusDir and statusFile, or "" if the status file is off.
+func (f *Fs) statusPath(remote string) string {
+	if !f.opt.ServiceAccountStatusFile {
+		return ""
+	}
+	return path.Join(f.root, remote)
+}
+
+// statusEntries returns the listing of dir if it is the status
+// directory, nil otherwise.
+func (f *Fs) statusEntries(dir string) fs.DirEntries {
+	if f.statusPath(dir) != statusDir {
+		return nil
+	}
+	return fs.DirEntries{f.newStatusObject(path.Join(dir, statusName))}
+}
+
+// render returns the status padded to the size of o.
+//
+// If the state has grown beyond that it is written without indentation
+// and, failing that, truncated.
+func (o *statusObject) render() []byte {
+	status := o.fs.ServiceAccountFiles.status()
+	buf, _ := json.MarshalIndent(status, "", "\t")
+	if int64(len(buf)) > o.size {
+		buf, _ = json.Marshal(status)
+	}
+	if int64(len(buf)) > o.size {
+		fs.Errorf(o, "Service account status truncated - list the directory again to see it all")
+		return buf[:o.size]
+	}
+	return append(buf, bytes.Repeat([]byte{' '}, int(o.size)-len(buf))...)
+}
+
+// Fs returns the parent Fs
+func (o *statusObject) Fs() fs.Info {
+	return o.fs
+}
+
+// String returns a description of the Object
+func (o *statusObject) String() string {
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *statusObject) Remote() string {
+	return o.remote
+}
+
+// Hash is unsupported as the content changes on every read
+func (o *statusObject) Hash(ctx context.Context, t hash.Type) (string, error) {
+	return "", hash.ErrUnsupported
+}
+
+// ModTime returns when the status file was listed
+func (o *statusObject) ModTime(ctx context.Context) time.Time {
+	return o.modTime
+}
+
+// Size returns the size of the status file
+func (o *statusObject) Size() int64 {
+	return o.size
+}
+
+// Storable returns true
+func (o *statusObject) Storable() bool {
+	return true
+}
+
+// SetModTime is not supported
+func (o *statusObject) SetModTime(ctx context.Context, modTime time.Time) error {
+	return fs.ErrorCantSetModTime
+}
+
+// Open renders the current status for reading
+func (o *statusObject) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	data := o.render()
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.RangeOption:
+			offset, limit = x.Decode(int64(len(data)))
+		case *fs.SeekOption:
+			offset = x.Offset
+		default:
+			if option.Mandatory() {
+				fs.Logf(o, "Unsupported mandatory option: %v", option)
+			}
+		}
+	}
+	data = data[min(offset, int64(len(data))):]
+	if limit >= 0 && limit < int64(len(data)) {
+		data = data[:limit]
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Update is not supported
+func (o *statusObject) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	return errStatusReadOnly
+}
+
+// Remove is not supported
+func (o *statusObject) Remove(ctx context.Context) error {
+	return errStatusReadOnly
+}
+
+// Check the interfaces are satisfied
+var _ fs.Object = (*statusObject)(nil)
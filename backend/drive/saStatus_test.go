@@ -0,0 +1,105 @@
+package drive
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusFile(t *testing.T) {
+	ctx := context.Background()
+	p := newTestPool()
+	setFiles(p, "sa1.json", "sa2.json")
+	p.activeSa("sa1.json")
+	p.RecordUpload("sa1.json", 1234)
+	blacklistSA("sa2.json", time.Now().Add(-time.Hour))
+	defer serviceAccountBlacklist.Delete("sa2.json")
+	f := &Fs{ServiceAccountFiles: p}
+
+	// Off by default
+	assert.Nil(t, f.statusEntries(statusDir))
+	assert.Equal(t, "", f.statusPath(statusFile))
+
+	// Only the status directory itself is listed, not the root
+	f.opt.ServiceAccountStatusFile = true
+	assert.Nil(t, f.statusEntries(""))
+	assert.Nil(t, f.statusEntries("other"))
+
+	for _, listFn := range []func(context.Context, string, fs.ListRCallback) error{f.ListP, f.ListR} {
+		var entries fs.DirEntries
+		require.NoError(t, listFn(ctx, statusDir, func(e fs.DirEntries) error {
+			entries = append(entries, e...)
+			return nil
+		}))
+		require.Len(t, entries, 1)
+		assert.Equal(t, statusFile, entries[0].Remote())
+	}
+
+	_, err := f.NewObject(ctx, statusDir)
+	assert.ErrorIs(t, err, fs.ErrorIsDir)
+	o, err := f.NewObject(ctx, statusFile)
+	require.NoError(t, err)
+	assert.ErrorIs(t, o.Remove(ctx), errStatusReadOnly)
+
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, o.Size(), int64(len(data)))
+
+	var status saStatus
+	require.NoError(t, json.Unmarshal(data, &status))
+	assert.Equal(t, "sa1.json", status.Active)
+	require.Len(t, status.Accounts, 2)
+	assert.Equal(t, int64(1234), status.Accounts[0].Uploaded)
+	expires := status.Accounts[1].BlacklistExpires
+	assert.WithinDuration(t, time.Now().Add(blacklistDuration-time.Hour), expires, time.Minute)
+
+	// Ranges are served from the rendered status
+	in, err = o.Open(ctx, &fs.RangeOption{Start: 0, End: 0})
+	require.NoError(t, err)
+	data, err = io.ReadAll(in)
+	require.NoError(t, err)
+	assert.Equal(t, "{", string(data))
+}
+
+func TestStatusFileRoot(t *testing.T) {
+	ctx := context.Background()
+	p := newTestPool()
+	setFiles(p, "sa1.json")
+	f := &Fs{ServiceAccountFiles: p, root: statusDir}
+	f.opt.ServiceAccountStatusFile = true
+
+	// With the status directory as the root, as when mounting it
+	entries := f.statusEntries("")
+	require.Len(t, entries, 1)
+	assert.Equal(t, statusName, entries[0].Remote())
+	o, err := f.NewObject(ctx, statusName)
+	require.NoError(t, err)
+	assert.Equal(t, statusName, o.Remote())
+	assert.Nil(t, f.statusEntries(statusName))
+}
+
+func TestStatusFileGrowth(t *testing.T) {
+	p := newTestPool()
+	setFiles(p, "sa1.json")
+	f := &Fs{ServiceAccountFiles: p}
+	o := f.newStatusObject(statusFile)
+
+	// Small growth is absorbed by the padding
+	setFiles(p, "sa1.json", "sa2.json")
+	data := o.render()
+	assert.Equal(t, o.Size(), int64(len(data)))
+	assert.True(t, json.Valid(data))
+
+	// Beyond that the status is cut off at the listed size
+	o.size = 10
+	assert.Len(t, o.render(), 10)
+}
@@ -0,0 +1,47 @@
+// Service account switch log
+//
+// Each switch to another SA is logged with the client_email of the SA
+// switched to, how many are left in the pool and the reason of the error
+// it switched for:
+//
+//	Switched to service account sa-002@p.iam.gserviceaccount.com after userRateLimitExceeded (97 left)
+//
+// That is at DEBUG level, or NOTICE while drive/sadebug is on, unless
+// sa_log_switches is set which logs it at INFO level, so the rotations
+// can be followed with -v without the rest of -vv.
+package drive
+
+import (
+	"path/filepath"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// serviceAccountName returns the client_email of the SA in file, or the
+// name of the file if that can't be read.
+func serviceAccountName(file string) string {
+	if email := serviceAccountEmail(file); email != "" {
+		return email
+	}
+	return filepath.Base(file)
+}
+
+// logSwitch logs the switch to the SA now in use for an error with
+// reason.
+func (f *Fs) logSwitch(reason string) {
+	if reason == "" {
+		reason = "an error"
+	}
+	name := serviceAccountName(f.opt.ServiceAccountFile)
+	level := saDebugLevel()
+	if f.opt.ServiceAccountLogSwitches {
+		level = fs.LogLevelInfo
+	}
+	fs.LogLevelPrintf(level, f, "Switched to service account %s after %s (%d left)", name, reason, f.ServiceAccountFiles.Available())
+	if showProgressEvent(level) {
+		progressEventf("↻ switched to %s (%s)", shortServiceAccountName(name), reason)
+	}
+	if poolEventsSubscribed() {
+		publishPoolEvent(PoolEvent{Type: PoolEventSwitch, SA: name, Reason: reason, Left: f.ServiceAccountFiles.Available()})
+	}
+}
@@ -0,0 +1,27 @@
+package drive
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceAccountName(t *testing.T) {
+	const a = "bundle:a@p.iam.gserviceaccount.com"
+	serviceAccountCredentials.Store(a, []byte(`{"client_email":"a@p.iam.gserviceaccount.com"}`))
+	defer serviceAccountCredentials.Delete(a)
+
+	assert.Equal(t, "a@p.iam.gserviceaccount.com", serviceAccountName(a))
+	assert.Equal(t, "missing.json", serviceAccountName("/sa/missing.json"))
+}
+
+func TestLogSwitch(t *testing.T) {
+	f := &Fs{
+		opt:                 Options{ServiceAccountFile: "/sa/1.json"},
+		ServiceAccountFiles: NewServiceAccountPool(context.Background(), 10),
+	}
+	f.logSwitch("userRateLimitExceeded")
+	f.opt.ServiceAccountLogSwitches = true
+	f.logSwitch("")
+}
@@ -0,0 +1,129 @@
+// Access tokens kept across runs
+//
+// Every SA the pool preloads exchanges its key for an access token, one
+// request each, so a process starting with a big pool made hundreds of
+// them before it could do anything, every time it started. With
+// sa_token_cache the tokens are kept in the cache directory, one file
+// per client_email, and a later run uses one until it expires instead of
+// asking for a new one.
+package drive
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/jwt"
+)
+
+// saTokenDir returns the directory the tokens are kept in, replaced by
+// the tests
+var saTokenDir = func() string {
+	return filepath.Join(config.GetCacheDir(), "drive-sa-tokens")
+}
+
+// savedToken is the file a token is kept in. A token is only good for
+// the scopes and subject it was issued for.
+type savedToken struct {
+	Scopes  []string     `json:"scopes"`
+	Subject string       `json:"subject,omitempty"`
+	Token   oauth2.Token `json:"token"`
+}
+
+// savingTokenSource saves the tokens of src for conf as they are made.
+type savingTokenSource struct {
+	conf *jwt.Config
+	src  oauth2.TokenSource
+}
+
+// Token gets a new token from the source and saves it.
+func (s *savingTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.src.Token()
+	if err != nil {
+		return nil, err
+	}
+	saveToken(s.conf, token)
+	return token, nil
+}
+
+// cachedTokenSource returns the token source for conf, starting with the
+// token saved by an earlier run if it is still valid.
+func cachedTokenSource(conf *jwt.Config, src oauth2.TokenSource) oauth2.TokenSource {
+	return oauth2.ReuseTokenSource(loadToken(conf), &savingTokenSource{conf: conf, src: src})
+}
+
+// tokenFile returns the file the token for conf is kept in, "" if it
+// has no client_email.
+func tokenFile(conf *jwt.Config) string {
+	if conf.Email == "" || filepath.Base(conf.Email) != conf.Email {
+		return ""
+	}
+	return filepath.Join(saTokenDir(), conf.Email+".json")
+}
+
+// loadToken returns the token saved for conf, nil if there isn't a valid
+// one.
+func loadToken(conf *jwt.Config) *oauth2.Token {
+	name := tokenFile(conf)
+	if name == "" {
+		return nil
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil
+	}
+	var saved savedToken
+	if err := json.Unmarshal(data, &saved); err != nil {
+		fs.Debugf(nil, "Ignoring saved token for %s: %v", conf.Email, err)
+		return nil
+	}
+	if !slices.Equal(saved.Scopes, conf.Scopes) || saved.Subject != conf.Subject || !saved.Token.Valid() {
+		return nil
+	}
+	saDebugf(nil, "Using saved token for %s, valid until %v", conf.Email, saved.Token.Expiry)
+	return &saved.Token
+}
+
+// saveToken saves token for conf for later runs. Failing to is only
+// logged.
+func saveToken(conf *jwt.Config, token *oauth2.Token) {
+	name := tokenFile(conf)
+	if name == "" || token.Expiry.IsZero() {
+		return
+	}
+	if err := writeToken(name, savedToken{Scopes: conf.Scopes, Subject: conf.Subject, Token: *token}); err != nil {
+		fs.Debugf(nil, "Failed to save token for %s: %v", conf.Email, err)
+	}
+}
+
+// writeToken writes saved to name. It is written to a temporary file
+// and renamed into place so a run starting alongside never reads half
+// of it.
+func writeToken(name string, saved savedToken) error {
+	buf, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(buf)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package drive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/jwt"
+)
+
+// countingTokenSource hands out tokens expiring after expiry
+type countingTokenSource struct {
+	calls  int
+	expiry time.Duration
+}
+
+func (s *countingTokenSource) Token() (*oauth2.Token, error) {
+	s.calls++
+	return &oauth2.Token{AccessToken: "token", TokenType: "Bearer", Expiry: time.Now().Add(s.expiry)}, nil
+}
+
+func TestCachedTokenSource(t *testing.T) {
+	dir := t.TempDir()
+	oldDir := saTokenDir
+	saTokenDir = func() string { return dir }
+	defer func() { saTokenDir = oldDir }()
+
+	conf := &jwt.Config{Email: "a@p.iam.gserviceaccount.com", Scopes: []string{scopePrefix + "drive"}}
+	src := &countingTokenSource{expiry: time.Hour}
+	token, err := cachedTokenSource(conf, src).Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token", token.AccessToken)
+	assert.Equal(t, 1, src.calls)
+	info, err := os.Stat(filepath.Join(dir, conf.Email+".json"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// A later run uses the saved token
+	src = &countingTokenSource{expiry: time.Hour}
+	token, err = cachedTokenSource(conf, src).Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token", token.AccessToken)
+	assert.Equal(t, 0, src.calls)
+
+	// But not for another subject or scopes
+	for _, other := range []*jwt.Config{
+		{Email: conf.Email, Scopes: conf.Scopes, Subject: "user@example.com"},
+		{Email: conf.Email, Scopes: []string{scopePrefix + "drive.readonly"}},
+	} {
+		src = &countingTokenSource{expiry: time.Second}
+		_, err = cachedTokenSource(other, src).Token()
+		require.NoError(t, err)
+		assert.Equal(t, 1, src.calls)
+	}
+
+	// Nor once it has expired, as the last one saved has
+	src = &countingTokenSource{expiry: time.Hour}
+	_, err = cachedTokenSource(conf, src).Token()
+	require.NoError(t, err)
+	assert.Equal(t, 1, src.calls)
+
+	// Emails which can't be file names aren't saved
+	src = &countingTokenSource{expiry: time.Hour}
+	for range 2 {
+		_, err = cachedTokenSource(&jwt.Config{Email: "../a"}, src).Token()
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, src.calls)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
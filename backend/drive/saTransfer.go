@@ -0,0 +1,78 @@
+// Daily transfer cap
+//
+// Each SA can upload about 750 GiB a day, so a big enough pool can move far
+// more than the user wants to in a day. With max_daily_transfer the bytes
+// uploaded and server side copied with any SA of the pool are added up in
+// hourly buckets over the last 24 hours, and once the sum reaches the limit
+// further transfers fail with a fatal error, like --max-transfer does.
+//
+// The buckets are saved with the pool state, so with
+// service_account_state_file the limit holds over successive runs too.
+package drive
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/fserrors"
+)
+
+const (
+	// transferWindow is how far back transfers count towards the limit
+	transferWindow = 24 * time.Hour
+	// transferBucket is the granularity transfers are counted with
+	transferBucket = time.Hour
+)
+
+// ErrDailyTransferLimit is returned once max_daily_transfer is reached.
+var ErrDailyTransferLimit = errors.New("daily transfer limit reached as set by --drive-max-daily-transfer")
+
+// recordTransfer counts n bytes transferred now - call with p.mu held.
+func (p *ServiceAccountPool) recordTransfer(n int64) {
+	if n <= 0 {
+		return
+	}
+	p.transfers[time.Now().Truncate(transferBucket)] += n
+}
+
+// dailyTransferred returns the bytes transferred over the last
+// transferWindow, dropping older buckets - call with p.mu held.
+func (p *ServiceAccountPool) dailyTransferred() (total int64) {
+	since := time.Now().Add(-transferWindow)
+	for bucket, n := range p.transfers {
+		if !bucket.Add(transferBucket).After(since) {
+			delete(p.transfers, bucket)
+			continue
+		}
+		total += n
+	}
+	return total
+}
+
+// DailyTransferred returns the bytes uploaded and copied with the pool over
+// the last 24 hours.
+func (p *ServiceAccountPool) DailyTransferred() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dailyTransferred()
+}
+
+// CheckDailyTransfer returns a fatal error if transferring size more bytes
+// would go over MaxDailyTransfer. Transfers of unknown size (size < 0) are
+// refused only once the limit has been reached.
+func (p *ServiceAccountPool) CheckDailyTransfer(size int64) error {
+	if p.MaxDailyTransfer < 0 {
+		return nil
+	}
+	p.mu.Lock()
+	done := p.dailyTransferred()
+	p.mu.Unlock()
+	if size < 0 && done < p.MaxDailyTransfer || size >= 0 && done+size <= p.MaxDailyTransfer {
+		return nil
+	}
+	p.Metrics.Inc(metricDailyLimit)
+	return fserrors.FatalError(fmt.Errorf("%w: %v transferred in the last 24h, limit is %v", ErrDailyTransferLimit,
+		fs.SizeSuffix(done).ByteUnit(), fs.SizeSuffix(p.MaxDailyTransfer).ByteUnit()))
+}
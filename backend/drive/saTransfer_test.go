@@ -0,0 +1,71 @@
+package drive
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckDailyTransfer(t *testing.T) {
+	p := newTestPool()
+	metrics := NewMemoryMetrics()
+	p.Metrics = metrics
+
+	// No limit by default
+	p.RecordUpload("sa1.json", 1<<40)
+	assert.NoError(t, p.CheckDailyTransfer(1<<40))
+
+	p = newTestPool()
+	p.Metrics = metrics
+	p.MaxDailyTransfer = 100
+	p.RecordUpload("sa1.json", 40)
+	p.RecordUpload("sa2.json", 40)
+	p.RecordUpload("", 10) // SA unknown, still counted
+	p.RecordUpload("sa1.json", -1)
+	assert.Equal(t, int64(90), p.DailyTransferred())
+
+	assert.NoError(t, p.CheckDailyTransfer(10))
+	assert.NoError(t, p.CheckDailyTransfer(-1))
+	err := p.CheckDailyTransfer(11)
+	assert.ErrorIs(t, err, ErrDailyTransferLimit)
+	assert.True(t, fserrors.IsFatalError(err))
+	assert.Equal(t, int64(1), metrics.Counter(metricDailyLimit))
+
+	p.RecordUpload("sa2.json", 10)
+	assert.NoError(t, p.CheckDailyTransfer(0))
+	assert.ErrorIs(t, p.CheckDailyTransfer(-1), ErrDailyTransferLimit)
+
+	// Transfers older than a day no longer count
+	p.mu.Lock()
+	p.transfers = map[time.Time]int64{
+		time.Now().Add(-transferWindow - transferBucket).Truncate(transferBucket): 100,
+		time.Now().Truncate(transferBucket):                                       30,
+	}
+	p.mu.Unlock()
+	assert.Equal(t, int64(30), p.DailyTransferred())
+	assert.Len(t, p.transfers, 1)
+}
+
+func TestDailyTransferState(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "state.json")
+	a := newTestPool()
+	a.addSa("sa1.json")
+	a.RecordUpload("sa1.json", 50)
+	require.NoError(t, a.SaveState(file))
+
+	// The bytes transferred are carried over to the next run
+	b := newTestPool()
+	b.addSa("sa1.json")
+	b.MaxDailyTransfer = 60
+	require.NoError(t, b.LoadState(file))
+	assert.Equal(t, int64(50), b.DailyTransferred())
+	assert.ErrorIs(t, b.CheckDailyTransfer(20), ErrDailyTransferLimit)
+
+	c := newTestPool()
+	require.NoError(t, c.Restore(a.Snapshot()))
+	assert.Equal(t, int64(50), c.DailyTransferred())
+}
@@ -0,0 +1,32 @@
+// Connection settings of the service account clients
+//
+// Each SA of the pool has an HTTP client, and a transport, of its own.
+// The transport defaults suit a single client: every one keeps up to
+// twice --checkers plus --transfers idle connections for a minute, so a
+// pool of a hundred preloaded clients can hold thousands open and run
+// into the limits of the host or of a proxy. These options size the
+// transports of the clients for a pool.
+package drive
+
+import (
+	"net/http"
+	"time"
+)
+
+// tuneTransport applies the connection options of opt to t, leaving the
+// defaults for those not set.
+func tuneTransport(t *http.Transport, opt *Options) {
+	if opt.ServiceAccountMaxIdleConns > 0 {
+		t.MaxIdleConnsPerHost = opt.ServiceAccountMaxIdleConns
+		t.MaxIdleConns = 2 * opt.ServiceAccountMaxIdleConns
+	}
+	if opt.ServiceAccountIdleTimeout > 0 {
+		t.IdleConnTimeout = time.Duration(opt.ServiceAccountIdleTimeout)
+	}
+	if opt.ServiceAccountHTTP2Ping > 0 {
+		if t.HTTP2 == nil {
+			t.HTTP2 = &http.HTTP2Config{}
+		}
+		t.HTTP2.SendPingTimeout = time.Duration(opt.ServiceAccountHTTP2Ping)
+	}
+}
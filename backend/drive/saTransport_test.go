@@ -0,0 +1,30 @@
+package drive
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTuneTransport(t *testing.T) {
+	// Defaults are left alone
+	tr := &http.Transport{MaxIdleConnsPerHost: 10, MaxIdleConns: 20, IdleConnTimeout: time.Minute}
+	tuneTransport(tr, &Options{})
+	assert.Equal(t, 10, tr.MaxIdleConnsPerHost)
+	assert.Equal(t, 20, tr.MaxIdleConns)
+	assert.Equal(t, time.Minute, tr.IdleConnTimeout)
+	assert.Nil(t, tr.HTTP2)
+
+	tuneTransport(tr, &Options{
+		ServiceAccountMaxIdleConns: 2,
+		ServiceAccountIdleTimeout:  fs.Duration(15 * time.Second),
+		ServiceAccountHTTP2Ping:    fs.Duration(30 * time.Second),
+	})
+	assert.Equal(t, 2, tr.MaxIdleConnsPerHost)
+	assert.Equal(t, 4, tr.MaxIdleConns)
+	assert.Equal(t, 15*time.Second, tr.IdleConnTimeout)
+	assert.Equal(t, 30*time.Second, tr.HTTP2.SendPingTimeout)
+}
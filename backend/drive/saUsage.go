@@ -0,0 +1,54 @@
+// Service account usage over a run
+//
+// The pool counters cover the life of the pool, and with
+// service_account_state_file earlier runs too. Usage compares them with a
+// snapshot taken when the run started to tell what each SA did in it, for
+// the end of run report.
+package drive
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// SaUsage is what a service account did since a snapshot.
+type SaUsage struct {
+	Account       string `json:"account"`         // email of the SA, or its file if unreadable
+	Uploaded      int64  `json:"uploaded"`        // bytes uploaded
+	RateLimitHits int64  `json:"rate_limit_hits"` // times it was excluded for rate limiting
+	Deleted       int64  `json:"deleted"`         // files and directories deleted
+	Dead          string `json:"dead,omitempty"`  // why it can never be used again, if it died since
+}
+
+// Usage returns what each SA of the pool did since before was taken,
+// leaving out those which did nothing. A nil before counts from zero.
+func (p *ServiceAccountPool) Usage(before *PoolSnapshot) []SaUsage {
+	was := map[string]SaState{}
+	if before != nil {
+		for _, state := range before.Accounts {
+			was[state.Path] = state
+		}
+	}
+	var usage []SaUsage
+	for _, state := range p.Snapshot().Accounts {
+		old := was[state.Path]
+		u := SaUsage{
+			Uploaded:      state.Uploaded - old.Uploaded,
+			RateLimitHits: state.RateLimitHits - old.RateLimitHits,
+			Deleted:       state.Deleted - old.Deleted,
+		}
+		if state.Dead != old.Dead {
+			u.Dead = state.Dead
+		}
+		if u == (SaUsage{}) {
+			continue
+		}
+		u.Account = serviceAccountEmail(state.Path)
+		if u.Account == "" {
+			u.Account = filepath.Base(state.Path)
+		}
+		usage = append(usage, u)
+	}
+	sort.SliceStable(usage, func(i, j int) bool { return usage[i].Uploaded > usage[j].Uploaded })
+	return usage
+}
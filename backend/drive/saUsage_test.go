@@ -0,0 +1,36 @@
+package drive
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolUsage(t *testing.T) {
+	const a = "bundle:a@p.iam.gserviceaccount.com"
+	serviceAccountCredentials.Store(a, []byte(`{"client_email":"a@p.iam.gserviceaccount.com"}`))
+	defer serviceAccountCredentials.Delete(a)
+
+	p := newTestPool()
+	setFiles(p, a, "b.json", "c.json", "d.json")
+	p.uploaded[a] = 100
+	p.rateLimitHits["b.json"] = 2
+	before := p.Snapshot()
+
+	p.uploaded[a] += 50
+	p.uploaded["b.json"] += 500
+	p.rateLimitHits["b.json"]++
+	p.deleted["c.json"]++
+	assert.Equal(t, []SaUsage{
+		{Account: "b.json", Uploaded: 500, RateLimitHits: 1},
+		{Account: "a@p.iam.gserviceaccount.com", Uploaded: 50},
+		{Account: "c.json", Deleted: 1},
+	}, p.Usage(before))
+
+	p.dead["d.json"] = "deleted"
+	usage := p.Usage(before)
+	assert.Equal(t, SaUsage{Account: "d.json", Dead: "deleted"}, usage[len(usage)-1])
+
+	// Without a snapshot everything counts
+	assert.Equal(t, int64(150), p.Usage(nil)[1].Uploaded)
+}
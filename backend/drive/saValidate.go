@@ -0,0 +1,90 @@
+// Validating service account keys before a run
+//
+// A malformed key would otherwise only show up when the pool first
+// switches to it, which can be hours into a transfer. Load checks every
+// key and the configured scopes up front and logs a summary. With
+// sa_strict any problem stops the run before it starts.
+package drive
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// knownDriveScopes are the scopes a service account can be used with
+var knownDriveScopes = []string{
+	"drive",
+	"drive.readonly",
+	"drive.file",
+	"drive.appfolder",
+	"drive.metadata.readonly",
+}
+
+// saValidation counts the outcome of validating the pool's keys
+type saValidation struct {
+	valid      int
+	malformed  int
+	duplicates int
+}
+
+// String returns the summary logged after Load
+func (v saValidation) String() string {
+	return fmt.Sprintf("%d valid, %d malformed, %d duplicates", v.valid, v.malformed, v.duplicates)
+}
+
+// validateScopes returns an error if the scope option has a scope
+// service accounts can't be used with.
+func validateScopes(scopeOption string) error {
+	for _, scope := range driveScopes(scopeOption) {
+		if name := strings.TrimPrefix(scope, scopePrefix); !slices.Contains(knownDriveScopes, name) {
+			return fmt.Errorf("unknown scope %q", name)
+		}
+	}
+	return nil
+}
+
+// validateServiceAccounts checks the key in each of files and the
+// configured scopes, logs a summary and returns files with duplicate keys
+// collapsed.
+//
+// Malformed keys are logged and kept unless opt.ServiceAccountStrict is
+// set, in which case they, or a bad scope, make it return an error.
+func validateServiceAccounts(files []string, opt *Options) ([]string, error) {
+	errs := make([]error, len(files))
+	forEachServiceAccount(files, func(i int, file string) {
+		data, err := readServiceAccountFile(file)
+		if err == nil {
+			_, err = validateServiceAccountKey(data)
+		}
+		errs[i] = err
+	})
+	var summary saValidation
+	for i, file := range files {
+		if err := errs[i]; err != nil {
+			fs.Errorf(nil, "Malformed service account %q: %v", file, err)
+			summary.malformed++
+			continue
+		}
+		summary.valid++
+	}
+	deduped := dedupeServiceAccounts(files)
+	summary.duplicates = len(files) - len(deduped)
+	fs.Infof(nil, "Service accounts: %v", summary)
+
+	scopeErr := validateScopes(opt.Scope)
+	if scopeErr != nil {
+		fs.Errorf(nil, "Service accounts can't be used: %v", scopeErr)
+	}
+	if opt.ServiceAccountStrict {
+		if scopeErr != nil {
+			return nil, scopeErr
+		}
+		if summary.malformed > 0 {
+			return nil, fmt.Errorf("%d malformed service account key(s) (%v) - fix or remove them, or turn off sa_strict", summary.malformed, summary)
+		}
+	}
+	return deduped, nil
+}
@@ -0,0 +1,52 @@
+package drive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateServiceAccounts(t *testing.T) {
+	dir := t.TempDir()
+	key := func(email string) string {
+		return `{"type":"service_account","client_email":"` + email + `","private_key":"` + testPrivateKey + `"}`
+	}
+	var files []string
+	for i, body := range []string{key("a@p"), key("b@p"), key("a@p"), `{"type":"service_account"}`} {
+		file := filepath.Join(dir, string(rune('1'+i))+".json")
+		require.NoError(t, os.WriteFile(file, []byte(body), 0600))
+		files = append(files, file)
+	}
+
+	// Malformed keys are kept unless strict, duplicates always dropped
+	got, err := validateServiceAccounts(files, &Options{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{files[0], files[1], files[3]}, got)
+
+	_, err = validateServiceAccounts(files, &Options{ServiceAccountStrict: true})
+	assert.ErrorContains(t, err, "1 malformed service account key(s) (3 valid, 1 malformed, 1 duplicates)")
+
+	got, err = validateServiceAccounts(files[:3], &Options{ServiceAccountStrict: true})
+	require.NoError(t, err)
+	assert.Len(t, got, 2)
+
+	// A scope SAs can't use is only fatal when strict
+	_, err = validateServiceAccounts(files[:3], &Options{Scope: "drive,drive.bogus"})
+	assert.NoError(t, err)
+	_, err = validateServiceAccounts(files[:3], &Options{Scope: "drive,drive.bogus", ServiceAccountStrict: true})
+	assert.ErrorContains(t, err, `unknown scope "drive.bogus"`)
+}
+
+func TestLoadStrict(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "1.json"), []byte(`{}`), 0600))
+	pool := newTestPool()
+	_, err := pool.Load(&Options{ServiceAccountFilePath: dir, ServiceAccountStrict: true})
+	assert.ErrorContains(t, err, "malformed")
+	files, err := pool.Load(&Options{ServiceAccountFilePath: dir})
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+}
@@ -0,0 +1,183 @@
+// Service Account keys from HashiCorp Vault
+//
+// Keys are read from a KV version 2 secrets engine. Every secret under
+// service_account_vault_path is one SA key, either stored as the key's own
+// fields (type, project_id, private_key, ...) or as a JSON string in a
+// field called "json", "key" or "credentials". Keys are never written to
+// disk - they are kept in serviceAccountCredentials under a "vault:" pseudo
+// path which the pool uses in place of a file name.
+package drive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/rclone/rclone/fs/fshttp"
+)
+
+// vaultPrefix marks pool entries whose key came from Vault
+const vaultPrefix = "vault:"
+
+// vaultClient is a minimal client for the Vault HTTP API.
+type vaultClient struct {
+	addr   string
+	token  string
+	client *http.Client
+}
+
+// newVaultClient makes a client from the options, falling back to the
+// standard VAULT_ADDR and VAULT_TOKEN environment variables, and logs in
+// with AppRole if a role ID is configured.
+func newVaultClient(ctx context.Context, opt *Options) (*vaultClient, error) {
+	v := &vaultClient{
+		addr:   opt.ServiceAccountVaultAddr,
+		token:  opt.ServiceAccountVaultToken,
+		client: fshttp.NewClient(ctx),
+	}
+	if v.addr == "" {
+		v.addr = os.Getenv("VAULT_ADDR")
+	}
+	if v.addr == "" {
+		return nil, errors.New("no vault address - set service_account_vault_addr or VAULT_ADDR")
+	}
+	v.addr = strings.TrimRight(v.addr, "/")
+	if opt.ServiceAccountVaultRoleID != "" {
+		if err := v.login(ctx, opt.ServiceAccountVaultRoleID, opt.ServiceAccountVaultSecretID); err != nil {
+			return nil, fmt.Errorf("approle login failed: %w", err)
+		}
+	}
+	if v.token == "" {
+		v.token = os.Getenv("VAULT_TOKEN")
+	}
+	if v.token == "" {
+		return nil, errors.New("no vault token - set service_account_vault_token, VAULT_TOKEN or an AppRole")
+	}
+	return v, nil
+}
+
+// call does a request against the Vault API decoding the response into out
+func (v *vaultClient) call(ctx context.Context, method, apiPath string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		buf, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(buf)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, v.addr+"/v1/"+apiPath, body)
+	if err != nil {
+		return err
+	}
+	if v.token != "" {
+		req.Header.Set("X-Vault-Token", v.token)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&vaultErr)
+		return fmt.Errorf("%s %s: %s: %s", method, apiPath, resp.Status, strings.Join(vaultErr.Errors, ", "))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// login exchanges an AppRole role ID and secret ID for a token
+func (v *vaultClient) login(ctx context.Context, roleID, secretID string) error {
+	var result struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	in := map[string]string{"role_id": roleID, "secret_id": secretID}
+	if err := v.call(ctx, "POST", "auth/approle/login", in, &result); err != nil {
+		return err
+	}
+	if result.Auth.ClientToken == "" {
+		return errors.New("no token returned")
+	}
+	v.token = result.Auth.ClientToken
+	return nil
+}
+
+// kvPaths splits a KV v2 path like "secret/eclone/sa" into its metadata
+// and data API paths.
+func kvPaths(secretPath string) (metadataPath, dataPath string, err error) {
+	secretPath = strings.Trim(secretPath, "/")
+	mount, sub, ok := strings.Cut(secretPath, "/")
+	if !ok || mount == "" || sub == "" {
+		return "", "", fmt.Errorf("vault path %q must be of the form mount/path", secretPath)
+	}
+	return mount + "/metadata/" + sub, mount + "/data/" + sub, nil
+}
+
+// vaultSecretToKey turns the data of a KV secret into a JSON SA key
+func vaultSecretToKey(data map[string]any) ([]byte, error) {
+	if data["type"] == "service_account" {
+		return json.Marshal(data)
+	}
+	for _, field := range []string{"json", "key", "credentials"} {
+		if s, ok := data[field].(string); ok {
+			if !json.Valid([]byte(s)) {
+				return nil, fmt.Errorf("field %q isn't valid JSON", field)
+			}
+			return []byte(s), nil
+		}
+	}
+	return nil, errors.New("secret doesn't contain a service account key")
+}
+
+// loadVaultServiceAccounts reads every SA key under the configured Vault
+// path into serviceAccountCredentials, returning their pseudo paths.
+func loadVaultServiceAccounts(ctx context.Context, opt *Options) (names []string, err error) {
+	metadataPath, dataPath, err := kvPaths(opt.ServiceAccountVaultPath)
+	if err != nil {
+		return nil, err
+	}
+	v, err := newVaultClient(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}
+	if err = v.call(ctx, "GET", metadataPath+"?list=true", nil, &list); err != nil {
+		return nil, fmt.Errorf("failed to list keys: %w", err)
+	}
+	for _, key := range list.Data.Keys {
+		if strings.HasSuffix(key, "/") {
+			continue // sub folder
+		}
+		var secret struct {
+			Data struct {
+				Data map[string]any `json:"data"`
+			} `json:"data"`
+		}
+		if err = v.call(ctx, "GET", dataPath+"/"+url.PathEscape(key), nil, &secret); err != nil {
+			return nil, fmt.Errorf("failed to read key %q: %w", key, err)
+		}
+		creds, err := vaultSecretToKey(secret.Data.Data)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", key, err)
+		}
+		name := vaultPrefix + strings.Trim(opt.ServiceAccountVaultPath, "/") + "/" + key
+		serviceAccountCredentials.Store(name, creds)
+		names = append(names, name)
+	}
+	return names, nil
+}
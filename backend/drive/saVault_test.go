@@ -0,0 +1,113 @@
+package drive
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestVault makes a fake Vault server holding two SA keys in KV v2,
+// one stored as fields and one as a JSON string.
+func newTestVault(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/auth/approle/login", func(w http.ResponseWriter, r *http.Request) {
+		var in map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+		if in["role_id"] != "role" || in["secret_id"] != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["invalid role or secret ID"]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"auth":{"client_token":"approle-token"}}`))
+	})
+	check := func(w http.ResponseWriter, r *http.Request) bool {
+		token := r.Header.Get("X-Vault-Token")
+		if token != "token" && token != "approle-token" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return false
+		}
+		return true
+	}
+	mux.HandleFunc("/v1/secret/metadata/eclone/sa", func(w http.ResponseWriter, r *http.Request) {
+		if check(w, r) {
+			assert.Equal(t, "true", r.URL.Query().Get("list"))
+			_, _ = w.Write([]byte(`{"data":{"keys":["sa1","sa2","nested/"]}}`))
+		}
+	})
+	mux.HandleFunc("/v1/secret/data/eclone/sa/sa1", func(w http.ResponseWriter, r *http.Request) {
+		if check(w, r) {
+			_, _ = w.Write([]byte(`{"data":{"data":{"type":"service_account","client_email":"sa1@p.iam.gserviceaccount.com"}}}`))
+		}
+	})
+	mux.HandleFunc("/v1/secret/data/eclone/sa/sa2", func(w http.ResponseWriter, r *http.Request) {
+		if check(w, r) {
+			_, _ = w.Write([]byte(`{"data":{"data":{"json":"{\"type\":\"service_account\",\"client_email\":\"sa2@p.iam.gserviceaccount.com\"}"}}}`))
+		}
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestLoadVaultServiceAccounts(t *testing.T) {
+	srv := newTestVault(t)
+	ctx := context.Background()
+	for _, opt := range []*Options{
+		{ServiceAccountVaultAddr: srv.URL, ServiceAccountVaultPath: "secret/eclone/sa", ServiceAccountVaultToken: "token"},
+		{ServiceAccountVaultAddr: srv.URL, ServiceAccountVaultPath: "/secret/eclone/sa/", ServiceAccountVaultRoleID: "role", ServiceAccountVaultSecretID: "secret"},
+	} {
+		names, err := loadVaultServiceAccounts(ctx, opt)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"vault:secret/eclone/sa/sa1", "vault:secret/eclone/sa/sa2"}, names)
+
+		creds, err := readServiceAccountFile("vault:secret/eclone/sa/sa2")
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"type":"service_account","client_email":"sa2@p.iam.gserviceaccount.com"}`, string(creds))
+	}
+
+	// Load puts the Vault keys in the pool
+	pool := newTestPool()
+	files, err := pool.Load(&Options{
+		ServiceAccountFile:       "vault:secret/eclone/sa/sa1",
+		ServiceAccountVaultAddr:  srv.URL,
+		ServiceAccountVaultPath:  "secret/eclone/sa",
+		ServiceAccountVaultToken: "token",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]struct{}{"vault:secret/eclone/sa/sa2": {}}, files)
+	assert.Len(t, pool.sas, 2)
+}
+
+func TestLoadVaultServiceAccountsErrors(t *testing.T) {
+	srv := newTestVault(t)
+	ctx := context.Background()
+	t.Setenv("VAULT_ADDR", "")
+	t.Setenv("VAULT_TOKEN", "")
+
+	_, err := loadVaultServiceAccounts(ctx, &Options{ServiceAccountVaultPath: "secret"})
+	assert.ErrorContains(t, err, "mount/path")
+	_, err = loadVaultServiceAccounts(ctx, &Options{ServiceAccountVaultPath: "secret/eclone/sa"})
+	assert.ErrorContains(t, err, "no vault address")
+	_, err = loadVaultServiceAccounts(ctx, &Options{ServiceAccountVaultAddr: srv.URL, ServiceAccountVaultPath: "secret/eclone/sa"})
+	assert.ErrorContains(t, err, "no vault token")
+	_, err = loadVaultServiceAccounts(ctx, &Options{ServiceAccountVaultAddr: srv.URL, ServiceAccountVaultPath: "secret/eclone/sa", ServiceAccountVaultToken: "wrong"})
+	assert.ErrorContains(t, err, "permission denied")
+	_, err = loadVaultServiceAccounts(ctx, &Options{ServiceAccountVaultAddr: srv.URL, ServiceAccountVaultPath: "secret/eclone/sa", ServiceAccountVaultRoleID: "role", ServiceAccountVaultSecretID: "wrong"})
+	assert.ErrorContains(t, err, "invalid role or secret ID")
+}
+
+func TestVaultSecretToKey(t *testing.T) {
+	_, err := vaultSecretToKey(map[string]any{"foo": "bar"})
+	assert.Error(t, err)
+	_, err = vaultSecretToKey(map[string]any{"key": "not json"})
+	assert.Error(t, err)
+	key, err := vaultSecretToKey(map[string]any{"credentials": `{"type":"service_account"}`})
+	require.NoError(t, err)
+	assert.Equal(t, `{"type":"service_account"}`, string(key))
+}
@@ -0,0 +1,362 @@
+// Splitting large files
+//
+// Drive won't hold a file over 5 TiB, so transferring a bigger one used to
+// fail after uploading most of it. With split_size set, files bigger than
+// it are uploaded as parts of split_size named after the file
+//
+//	video.mkv.eclone-part.001
+//	video.mkv.eclone-part.002
+//
+// followed by a manifest under the name of the file itself, a small JSON
+// file listing the IDs and sizes of the parts. The size and MD5 of the
+// whole file are kept in the appProperties of the manifest, so listings
+// show the manifest as the file without reading it, and the parts are
+// hidden from them. Reading the manifest reads the parts in turn.
+//
+// Removing or moving the file does the same to its parts. Server side
+// copies aren't possible as the copy would share the parts of the original,
+// so they fall back to downloading and uploading the file again.
+package drive
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/object"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	driveMaxFileSize      = 5 * fs.Tebi         // the biggest file Drive holds
+	splitManifestMimeType = "application/json"  // MIME type of the manifests
+	splitManifestMaxSize  = 16 * 1024 * 1024    // bigger manifests aren't read
+	splitSizeProperty     = "ecloneSplitSize"   // appProperty with the size of a split file
+	splitMD5Property      = "ecloneSplitMD5"    // appProperty with the MD5 of a split file
+	splitPartSuffix       = ".eclone-part.%03d" // added to the name of a split file for its parts
+)
+
+// splitPartRe matches the names of the parts of split files
+var splitPartRe = regexp.MustCompile(`\.eclone-part\.\d{3,}$`)
+
+// splitPart is a part of a split file.
+type splitPart struct {
+	ID   string `json:"id"`
+	Size int64  `json:"size"`
+}
+
+// splitManifest is the content of the manifest of a split file.
+type splitManifest struct {
+	Version int         `json:"version"`
+	Size    int64       `json:"size"`
+	MD5     string      `json:"md5"`
+	Parts   []splitPart `json:"parts"`
+}
+
+// checkSplitSize checks split_size is off or within Drive's limit.
+func checkSplitSize(size fs.SizeSuffix) error {
+	if size == 0 || size > driveMaxFileSize {
+		return fmt.Errorf("split_size must be more than 0 and at most %v", fs.SizeSuffix(driveMaxFileSize))
+	}
+	return nil
+}
+
+// isSplitPart returns true if name is that of a part of a split file.
+func isSplitPart(name string) bool {
+	return splitPartRe.MatchString(name)
+}
+
+// splitPartName returns the name of part i, counting from 1, of remote.
+func splitPartName(remote string, i int) string {
+	return remote + fmt.Sprintf(splitPartSuffix, i)
+}
+
+// splits returns true if a file of size is uploaded in parts.
+func (f *Fs) splits(size int64) bool {
+	return f.opt.SplitSize > 0 && size > int64(f.opt.SplitSize)
+}
+
+// splitObject makes o the file a manifest stands for if info is one,
+// returning true if it was.
+func (f *Fs) splitObject(o *Object, info *drive.File) bool {
+	sizeProperty, ok := info.AppProperties[splitSizeProperty]
+	if !ok {
+		return false
+	}
+	size, err := strconv.ParseInt(sizeProperty, 10, 64)
+	if err != nil {
+		fs.Debugf(o, "Ignoring bad size of split file %q: %v", sizeProperty, err)
+		return false
+	}
+	o.split = true
+	o.bytes = size
+	o.md5sum = info.AppProperties[splitMD5Property]
+	o.sha1sum, o.sha256sum = "", ""
+	o.v2Download = false
+	return true
+}
+
+// partURL returns the download URL of the part with id.
+func (f *Fs) partURL(id string) string {
+	return fmt.Sprintf("%sfiles/%s?alt=media", f.svc.BasePath, actualID(id))
+}
+
+// putSplit uploads src in parts of split_size followed by their manifest.
+// The parts uploaded are removed if it fails.
+func (f *Fs) putSplit(ctx context.Context, in io.Reader, src fs.ObjectInfo) (fs.Object, error) {
+	remote, size, modTime := src.Remote(), src.Size(), src.ModTime(ctx)
+	partSize := int64(f.opt.SplitSize)
+	count := ceilDiv(size, partSize)
+	fs.Debugf(src, "Uploading in %d parts of %v", count, f.opt.SplitSize)
+	md5sum := md5.New()
+	in = io.TeeReader(in, md5sum)
+	m := splitManifest{Version: 1, Size: size}
+	for i := 1; int64(i) <= count; i++ {
+		n := min(partSize, size-int64(i-1)*partSize)
+		partSrc := object.NewStaticObjectInfo(splitPartName(remote, i), modTime, n, true, nil, f)
+		part, err := f.PutUnchecked(ctx, io.LimitReader(in, n), partSrc)
+		if err != nil {
+			_ = f.removeSplitParts(ctx, m.Parts)
+			return nil, fmt.Errorf("failed to upload part %d of %d: %w", i, count, err)
+		}
+		m.Parts = append(m.Parts, splitPart{ID: part.(fs.IDer).ID(), Size: n})
+	}
+	m.MD5 = hex.EncodeToString(md5sum.Sum(nil))
+	info, err := f.createManifest(ctx, remote, modTime, &m)
+	if err != nil {
+		_ = f.removeSplitParts(ctx, m.Parts)
+		return nil, err
+	}
+	return f.newObjectWithInfo(ctx, remote, info)
+}
+
+// createManifest creates the manifest m at remote.
+func (f *Fs) createManifest(ctx context.Context, remote string, modTime time.Time, m *splitManifest) (info *drive.File, err error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	createInfo, err := f.createFileInfo(ctx, remote, modTime)
+	if err != nil {
+		return nil, err
+	}
+	createInfo.MimeType = splitManifestMimeType
+	createInfo.AppProperties = map[string]string{
+		splitSizeProperty: strconv.FormatInt(m.Size, 10),
+		splitMD5Property:  m.MD5,
+	}
+	err = f.pacer.CallNoRetry(func() (bool, error) {
+		info, err = f.svc.Files.Create(createInfo).
+			Media(bytes.NewReader(data), googleapi.ContentType(splitManifestMimeType), googleapi.ChunkSize(0)).
+			Fields(f.getFileFields(ctx)).
+			SupportsAllDrives(true).
+			KeepRevisionForever(f.opt.KeepRevisionForever).
+			Context(ctx).Do()
+		return f.shouldRetry(ctx, err)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload the manifest: %w", err)
+	}
+	f.itemCreated(ctx, createInfo.Parents[0])
+	return info, nil
+}
+
+// removeSplitParts removes parts, carrying on past errors and returning
+// the first.
+func (f *Fs) removeSplitParts(ctx context.Context, parts []splitPart) (err error) {
+	for _, part := range parts {
+		if partErr := f.delete(ctx, part.ID, f.opt.UseTrash); partErr != nil {
+			fs.Errorf(f, "Failed to remove part %s of a split file: %v", part.ID, partErr)
+			if err == nil {
+				err = partErr
+			}
+		}
+	}
+	return err
+}
+
+// splitParts reads the parts of o from its manifest.
+func (o *Object) splitParts(ctx context.Context) (parts []splitPart, err error) {
+	in, err := o.baseObject.open(ctx, o.url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the manifest: %w", err)
+	}
+	defer fs.CheckClose(in, &err)
+	var m splitManifest
+	if err = json.NewDecoder(io.LimitReader(in, splitManifestMaxSize)).Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to read the manifest: %w", err)
+	}
+	var size int64
+	for _, part := range m.Parts {
+		size += part.Size
+	}
+	if m.Version != 1 || size != m.Size {
+		return nil, fmt.Errorf("bad manifest: version %d with %d bytes in parts for %d", m.Version, size, m.Size)
+	}
+	return m.Parts, nil
+}
+
+// openSplit opens the parts of o for reading as one file.
+func (o *Object) openSplit(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	var offset, limit int64 = 0, -1
+	var partOptions []fs.OpenOption
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.RangeOption:
+			offset, limit = x.Decode(o.bytes)
+		case *fs.SeekOption:
+			offset, limit = x.Offset, -1
+		default:
+			partOptions = append(partOptions, option)
+		}
+	}
+	parts, err := o.splitParts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &splitReader{ctx: ctx, o: o, parts: parts, offset: offset, limit: limit, options: partOptions}, nil
+}
+
+// splitReader reads the parts of a split file in turn.
+type splitReader struct {
+	ctx     context.Context
+	o       *Object
+	parts   []splitPart     // parts left to read
+	offset  int64           // where to start in the first of parts
+	limit   int64           // bytes left to read, -1 for all
+	options []fs.OpenOption // options for opening the parts
+	in      io.ReadCloser   // part being read, nil between parts
+}
+
+// Read reads from the parts, opening the next when one ends.
+func (r *splitReader) Read(p []byte) (n int, err error) {
+	for {
+		if r.in == nil {
+			if err = r.next(); err != nil {
+				return 0, err
+			}
+		}
+		n, err = r.in.Read(p)
+		if err == io.EOF {
+			err = r.in.Close()
+			r.in = nil
+			if n > 0 || err != nil {
+				return n, err
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// next opens the next part with anything left to read.
+func (r *splitReader) next() error {
+	for len(r.parts) > 0 && r.offset >= r.parts[0].Size {
+		r.offset -= r.parts[0].Size
+		r.parts = r.parts[1:]
+	}
+	if len(r.parts) == 0 || r.limit == 0 {
+		return io.EOF
+	}
+	part := r.parts[0]
+	end := part.Size - 1
+	if r.limit >= 0 {
+		end = min(end, r.offset+r.limit-1)
+		r.limit -= end - r.offset + 1
+	}
+	options := append(slices.Clip(r.options), &fs.RangeOption{Start: r.offset, End: end})
+	in, err := r.o.baseObject.open(r.ctx, r.o.fs.partURL(part.ID), options...)
+	if err != nil {
+		return fmt.Errorf("failed to open part %s: %w", part.ID, err)
+	}
+	r.in, r.offset, r.parts = in, 0, r.parts[1:]
+	return nil
+}
+
+// Close closes the part being read.
+func (r *splitReader) Close() error {
+	if r.in == nil {
+		return nil
+	}
+	err := r.in.Close()
+	r.in = nil
+	return err
+}
+
+// updateSplit replaces o, which is split or is about to be, by uploading
+// src as a new file and removing o.
+func (o *Object) updateSplit(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	var newObj fs.Object
+	var err error
+	if o.fs.splits(src.Size()) {
+		newObj, err = o.fs.putSplit(ctx, in, src)
+	} else {
+		newObj, err = o.fs.PutUnchecked(ctx, in, src, options...)
+	}
+	if err != nil {
+		return err
+	}
+	newO, ok := newObj.(*Object)
+	if !ok {
+		return errors.New("object type changed by update")
+	}
+	if err = o.Remove(ctx); err != nil {
+		return fmt.Errorf("failed to remove the old version: %w", err)
+	}
+	*o = *newO
+	return nil
+}
+
+// Remove an object, with its parts if it is split
+func (o *Object) Remove(ctx context.Context) error {
+	if o.split {
+		parts, err := o.splitParts(ctx)
+		if err != nil {
+			return err
+		}
+		if err = o.fs.removeSplitParts(ctx, parts); err != nil {
+			return err
+		}
+	}
+	return o.baseObject.Remove(ctx)
+}
+
+// moveSplit moves the parts of src next to remote and then its manifest
+// to remote. The parts keep their IDs so the manifest stays valid.
+func (f *Fs) moveSplit(ctx context.Context, src *Object, remote string) (fs.Object, error) {
+	if src.fs != f {
+		fs.Debugf(src, "Can't move - split into parts on another remote")
+		return nil, fs.ErrorCantMove
+	}
+	parts, err := src.splitParts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i, part := range parts {
+		partObj := &Object{baseObject: baseObject{
+			fs:           f,
+			remote:       splitPartName(src.remote, i+1),
+			id:           part.ID,
+			modifiedDate: src.modifiedDate,
+			bytes:        part.Size,
+			parents:      src.parents,
+		}}
+		if _, err = f.Move(ctx, partObj, splitPartName(remote, i+1)); err != nil {
+			return nil, fmt.Errorf("failed to move part %d of %d: %w", i+1, len(parts), err)
+		}
+	}
+	manifest := *src
+	manifest.split = false
+	return f.Move(ctx, &manifest, remote)
+}
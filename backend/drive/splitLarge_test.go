@@ -0,0 +1,182 @@
+package drive
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/lib/dircache"
+	"github.com/rclone/rclone/lib/pacer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+func TestSplitNames(t *testing.T) {
+	assert.Equal(t, "dir/video.mkv.eclone-part.001", splitPartName("dir/video.mkv", 1))
+	assert.Equal(t, "video.mkv.eclone-part.1000", splitPartName("video.mkv", 1000))
+	assert.True(t, isSplitPart("video.mkv.eclone-part.001"))
+	assert.True(t, isSplitPart("video.mkv.eclone-part.1000"))
+	assert.False(t, isSplitPart("video.mkv"))
+	assert.False(t, isSplitPart("video.mkv.eclone-part.01"))
+	assert.False(t, isSplitPart("video.mkv.eclone-part.001.bak"))
+}
+
+func TestCheckSplitSize(t *testing.T) {
+	assert.NoError(t, checkSplitSize(-1))
+	assert.NoError(t, checkSplitSize(fs.SizeSuffix(fs.Tebi)))
+	assert.NoError(t, checkSplitSize(driveMaxFileSize))
+	assert.Error(t, checkSplitSize(0))
+	assert.Error(t, checkSplitSize(driveMaxFileSize+1))
+}
+
+// splitServer fakes the Drive API, holding the files uploaded to it.
+type splitServer struct {
+	*httptest.Server
+	mu    sync.Mutex
+	files map[string]*drive.File
+	data  map[string][]byte
+}
+
+func newSplitServer(t *testing.T) *splitServer {
+	s := &splitServer{files: map[string]*drive.File{}, data: map[string][]byte{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		id := path.Base(r.URL.Path)
+		switch r.Method {
+		case http.MethodPost:
+			_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			require.NoError(t, err)
+			mr := multipart.NewReader(r.Body, params["boundary"])
+			part, err := mr.NextPart()
+			require.NoError(t, err)
+			info := new(drive.File)
+			require.NoError(t, json.NewDecoder(part).Decode(info))
+			part, err = mr.NextPart()
+			require.NoError(t, err)
+			data, err := io.ReadAll(part)
+			require.NoError(t, err)
+			info.Id = fmt.Sprintf("id%d", len(s.data)+1)
+			info.Size = int64(len(data))
+			info.Md5Checksum = fmt.Sprintf("%x", md5.Sum(data))
+			s.files[info.Id], s.data[info.Id] = info, data
+			_ = json.NewEncoder(w).Encode(info)
+		case http.MethodGet:
+			data, ok := s.data[id]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			http.ServeContent(w, r, id, time.Time{}, bytes.NewReader(data))
+		case http.MethodDelete:
+			delete(s.files, id)
+			delete(s.data, id)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	return s
+}
+
+// names returns the names of the files held.
+func (s *splitServer) names() (names []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, info := range s.files {
+		names = append(names, info.Name)
+	}
+	return names
+}
+
+func newSplitFs(ctx context.Context, t *testing.T, srv *splitServer) *Fs {
+	svc, err := drive.NewService(ctx, option.WithHTTPClient(srv.Client()), option.WithEndpoint(srv.URL+"/"))
+	require.NoError(t, err)
+	f := &Fs{
+		name:                "remote",
+		svc:                 svc,
+		client:              srv.Client(),
+		ci:                  fs.GetConfig(ctx),
+		pacer:               fs.NewPacer(ctx, pacer.NewGoogleDrive(pacer.MinSleep(time.Millisecond))),
+		ServiceAccountFiles: NewServiceAccountPool(ctx, 10),
+	}
+	f.opt.SplitSize = 4
+	f.opt.UploadCutoff = fs.SizeSuffix(fs.Mebi)
+	f.dirCache = dircache.New("", "root", f)
+	return f
+}
+
+func TestSplitPutOpenRemove(t *testing.T) {
+	ctx := context.Background()
+	srv := newSplitServer(t)
+	defer srv.Close()
+	f := newSplitFs(ctx, t, srv)
+
+	content := "0123456789"
+	src := object.NewStaticObjectInfo("big.bin", time.Now(), int64(len(content)), true, nil, nil)
+	obj, err := f.PutUnchecked(ctx, strings.NewReader(content), src)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"big.bin.eclone-part.001", "big.bin.eclone-part.002", "big.bin.eclone-part.003", "big.bin"}, srv.names())
+
+	// The manifest stands for the whole file
+	o := obj.(*Object)
+	assert.True(t, o.split)
+	assert.Equal(t, int64(len(content)), o.Size())
+	md5sum, err := o.Hash(ctx, hash.MD5)
+	require.NoError(t, err)
+	assert.Equal(t, "781e5e245d69b566979b86e28d23f2c7", md5sum)
+
+	read := func(options ...fs.OpenOption) string {
+		in, err := o.Open(ctx, options...)
+		require.NoError(t, err)
+		data, err := io.ReadAll(in)
+		require.NoError(t, err)
+		require.NoError(t, in.Close())
+		return string(data)
+	}
+	assert.Equal(t, content, read())
+	assert.Equal(t, "3456", read(&fs.RangeOption{Start: 3, End: 6}))
+	assert.Equal(t, "456789", read(&fs.SeekOption{Offset: 4}))
+	assert.Equal(t, "789", read(&fs.RangeOption{Start: -1, End: 3}))
+
+	// Small files aren't split
+	small := object.NewStaticObjectInfo("small.bin", time.Now(), 3, true, nil, nil)
+	obj, err = f.PutUnchecked(ctx, strings.NewReader("abc"), small)
+	require.NoError(t, err)
+	assert.False(t, obj.(*Object).split)
+
+	require.NoError(t, o.Remove(ctx))
+	assert.Equal(t, []string{"small.bin"}, srv.names())
+}
+
+func TestSplitObject(t *testing.T) {
+	f := &Fs{}
+	o := &Object{baseObject: baseObject{bytes: 120}, md5sum: "abc", sha1sum: "def"}
+	assert.False(t, f.splitObject(o, &drive.File{}))
+	assert.False(t, o.split)
+	assert.False(t, f.splitObject(o, &drive.File{AppProperties: map[string]string{splitSizeProperty: "x"}}))
+
+	assert.True(t, f.splitObject(o, &drive.File{AppProperties: map[string]string{
+		splitSizeProperty: "10000000000000",
+		splitMD5Property:  "0123",
+	}}))
+	assert.True(t, o.split)
+	assert.Equal(t, int64(10000000000000), o.bytes)
+	assert.Equal(t, "0123", o.md5sum)
+	assert.Equal(t, "", o.sha1sum)
+}
@@ -0,0 +1,53 @@
+// State filter
+//
+// With state_filter listings only return the files in the given Drive
+// states, all of which must hold:
+//
+//   - starred: files the account has starred
+//   - shared: files in "Shared with me", i.e. shared with the account
+//     directly rather than through a folder
+//   - trashed: files trashed explicitly, leaving out those only in the
+//     trash because their folder is
+//
+// Like owner_filter the states go into the search query of the listings
+// made for a filter-aware walk, and folders are always listed so the
+// files are found at any depth. Drive can't search for explicitly trashed
+// files, so trashed lists the trash as trashed_only does and the files
+// trashed with their folder are dropped from the results.
+package drive
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// Values of state_filter
+const (
+	stateStarred = "starred"
+	stateShared  = "shared"
+	stateTrashed = "trashed"
+)
+
+// stateQuery returns the search term listing the files in states, "" if
+// there is none, and whether only explicitly trashed files are wanted.
+func stateQuery(states fs.CommaSepList) (query string, trashed bool, err error) {
+	var terms []string
+	for _, state := range states {
+		switch strings.TrimSpace(state) {
+		case stateStarred:
+			terms = append(terms, "starred=true")
+		case stateShared:
+			terms = append(terms, "sharedWithMe=true")
+		case stateTrashed:
+			trashed = true
+		default:
+			return "", false, fmt.Errorf("unknown state_filter %q - use %q, %q or %q", state, stateStarred, stateShared, stateTrashed)
+		}
+	}
+	if len(terms) == 0 {
+		return "", trashed, nil
+	}
+	return fmt.Sprintf("(mimeType='%s' or (%s))", driveFolderType, strings.Join(terms, " and ")), trashed, nil
+}
@@ -0,0 +1,34 @@
+package drive
+
+import (
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateQuery(t *testing.T) {
+	folder := "mimeType='application/vnd.google-apps.folder'"
+	for _, test := range []struct {
+		states  fs.CommaSepList
+		want    string
+		trashed bool
+		err     string
+	}{
+		{nil, "", false, ""},
+		{fs.CommaSepList{"starred"}, "(" + folder + " or (starred=true))", false, ""},
+		{fs.CommaSepList{"starred", " shared"}, "(" + folder + " or (starred=true and sharedWithMe=true))", false, ""},
+		{fs.CommaSepList{"trashed"}, "", true, ""},
+		{fs.CommaSepList{"shared", "trashed"}, "(" + folder + " or (sharedWithMe=true))", true, ""},
+		{fs.CommaSepList{"archived"}, "", false, `unknown state_filter "archived"`},
+	} {
+		got, trashed, err := stateQuery(test.states)
+		if test.err != "" {
+			assert.ErrorContains(t, err, test.err, "%v", test.states)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, test.want, got, "%v", test.states)
+		assert.Equal(t, test.trashed, trashed, "%v", test.states)
+	}
+}
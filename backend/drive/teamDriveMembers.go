@@ -0,0 +1,239 @@
+// Shared drive membership
+//
+// Giving hundreds of SAs access to a shared drive by hand is the slowest
+// step of setting up a pool. The members, member-add and member-remove
+// commands list, add and remove the members of the remote's shared drive,
+// or the one given with -o drive=ID. Members are users given as
+// arguments, the SAs of the pool with -o sa and a group with -o group.
+// Adding a member which is already there with another role changes its
+// role.
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+	"google.golang.org/api/drive/v3"
+)
+
+// defaultMemberRole is the role members are given, Content manager
+const defaultMemberRole = "fileOrganizer"
+
+// teamDriveMember is an account to add to or remove from a shared drive
+type teamDriveMember struct {
+	kind  string // "user" or "group"
+	email string
+}
+
+// memberInfo is a member of a shared drive as listed by members
+type memberInfo struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	Role  string `json:"role"`
+	Email string `json:"email,omitempty"`
+	Name  string `json:"name,omitempty"`
+}
+
+// memberChanges sums up what member-add or member-remove did
+type memberChanges struct {
+	Added     int `json:"added,omitempty"`
+	Updated   int `json:"updated,omitempty"`
+	Removed   int `json:"removed,omitempty"`
+	Unchanged int `json:"unchanged,omitempty"`
+	Failed    int `json:"failed,omitempty"`
+}
+
+// memberRole returns the role asked for in opt.
+func memberRole(opt map[string]string) string {
+	if role, ok := opt["role"]; ok && role != "" {
+		return role
+	}
+	return defaultMemberRole
+}
+
+// teamDriveMembersFor returns the users in emails, the SAs of the pool
+// if opt has sa and the group in opt.
+func (f *Fs) teamDriveMembersFor(emails []string, opt map[string]string) ([]teamDriveMember, error) {
+	var members []teamDriveMember
+	for _, email := range emails {
+		members = append(members, teamDriveMember{kind: "user", email: email})
+	}
+	if _, ok := opt["sa"]; ok {
+		emails := f.ServiceAccountFiles.emails()
+		if len(emails) == 0 {
+			return nil, errors.New("no service accounts in the pool to add")
+		}
+		for _, email := range emails {
+			members = append(members, teamDriveMember{kind: "user", email: email})
+		}
+	}
+	if group, ok := opt["group"]; ok {
+		members = append(members, teamDriveMember{kind: "group", email: group})
+	}
+	return members, nil
+}
+
+// memberDriveID returns the shared drive the member commands work on.
+func (f *Fs) memberDriveID(opt map[string]string) (string, error) {
+	if id, ok := opt["drive"]; ok && id != "" {
+		return id, nil
+	}
+	if f.opt.TeamDriveID == "" {
+		return "", errors.New("not a shared drive remote - give the shared drive with -o drive=ID")
+	}
+	return f.opt.TeamDriveID, nil
+}
+
+// listTeamDriveMembers returns the members of the shared drive driveID.
+func (f *Fs) listTeamDriveMembers(ctx context.Context, driveID string) (members []memberInfo, err error) {
+	list := f.svc.Permissions.List(driveID).
+		SupportsAllDrives(true).
+		PageSize(100).
+		Fields("permissions(id,type,role,emailAddress,displayName),nextPageToken")
+	for {
+		var perms *drive.PermissionList
+		err = f.pacer.Call(func() (bool, error) {
+			perms, err = list.Context(ctx).Do()
+			return f.shouldRetry(ctx, err)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list members of shared drive %q: %w", driveID, err)
+		}
+		for _, perm := range perms.Permissions {
+			members = append(members, memberInfo{
+				ID:    perm.Id,
+				Type:  perm.Type,
+				Role:  perm.Role,
+				Email: perm.EmailAddress,
+				Name:  perm.DisplayName,
+			})
+		}
+		if perms.NextPageToken == "" {
+			return members, nil
+		}
+		list.PageToken(perms.NextPageToken)
+	}
+}
+
+// addTeamDriveMember gives member role on the shared drive driveID.
+func (f *Fs) addTeamDriveMember(ctx context.Context, driveID string, member teamDriveMember, role string) (err error) {
+	permission := &drive.Permission{
+		Type:         member.kind,
+		Role:         role,
+		EmailAddress: member.email,
+	}
+	return f.pacer.Call(func() (bool, error) {
+		_, err = f.svc.Permissions.Create(driveID, permission).
+			Fields("").
+			SupportsAllDrives(true).
+			SendNotificationEmail(false).
+			Context(ctx).Do()
+		return f.shouldRetry(ctx, err)
+	})
+}
+
+// byEmail indexes members by lower case email.
+func byEmail(members []memberInfo) map[string]memberInfo {
+	index := make(map[string]memberInfo, len(members))
+	for _, member := range members {
+		if member.Email != "" {
+			index[strings.ToLower(member.Email)] = member
+		}
+	}
+	return index
+}
+
+// addTeamDriveMembers adds members to the shared drive driveID with role,
+// changing the role of those already there with another.
+func (f *Fs) addTeamDriveMembers(ctx context.Context, driveID string, members []teamDriveMember, role string) (changes memberChanges, err error) {
+	current, err := f.listTeamDriveMembers(ctx, driveID)
+	if err != nil {
+		return changes, err
+	}
+	existing := byEmail(current)
+	for _, member := range members {
+		have, ok := existing[strings.ToLower(member.email)]
+		switch {
+		case ok && have.Role == role:
+			changes.Unchanged++
+			continue
+		case ok:
+			err = f.pacer.Call(func() (bool, error) {
+				_, err = f.svc.Permissions.Update(driveID, have.ID, &drive.Permission{Role: role}).
+					Fields("").
+					SupportsAllDrives(true).
+					Context(ctx).Do()
+				return f.shouldRetry(ctx, err)
+			})
+			if err == nil {
+				changes.Updated++
+			}
+		default:
+			err = f.addTeamDriveMember(ctx, driveID, member, role)
+			if err == nil {
+				changes.Added++
+			}
+		}
+		if err != nil {
+			fs.Errorf(f, "Failed to add %s %q to shared drive %q: %v", member.kind, member.email, driveID, err)
+			changes.Failed++
+		}
+	}
+	return changes, nil
+}
+
+// removeTeamDriveMembers removes members from the shared drive driveID.
+// Members which aren't there are counted as unchanged.
+func (f *Fs) removeTeamDriveMembers(ctx context.Context, driveID string, members []teamDriveMember) (changes memberChanges, err error) {
+	current, err := f.listTeamDriveMembers(ctx, driveID)
+	if err != nil {
+		return changes, err
+	}
+	existing := byEmail(current)
+	for _, member := range members {
+		have, ok := existing[strings.ToLower(member.email)]
+		if !ok {
+			changes.Unchanged++
+			continue
+		}
+		err = f.pacer.Call(func() (bool, error) {
+			err = f.svc.Permissions.Delete(driveID, have.ID).
+				SupportsAllDrives(true).
+				Context(ctx).Do()
+			return f.shouldRetry(ctx, err)
+		})
+		if err != nil {
+			fs.Errorf(f, "Failed to remove %s %q from shared drive %q: %v", member.kind, member.email, driveID, err)
+			changes.Failed++
+			continue
+		}
+		changes.Removed++
+	}
+	return changes, nil
+}
+
+// memberCommand runs the members, member-add and member-remove backend
+// commands.
+func (f *Fs) memberCommand(ctx context.Context, name string, arg []string, opt map[string]string) (any, error) {
+	driveID, err := f.memberDriveID(opt)
+	if err != nil {
+		return nil, err
+	}
+	if name == "members" {
+		return f.listTeamDriveMembers(ctx, driveID)
+	}
+	members, err := f.teamDriveMembersFor(arg, opt)
+	if err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return nil, errors.New("need the emails of the members, -o sa or -o group=EMAIL")
+	}
+	if name == "member-add" {
+		return f.addTeamDriveMembers(ctx, driveID, members, memberRole(opt))
+	}
+	return f.removeTeamDriveMembers(ctx, driveID, members)
+}
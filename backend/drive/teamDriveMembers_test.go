@@ -0,0 +1,102 @@
+package drive
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/pacer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+func TestTeamDriveMembersFor(t *testing.T) {
+	const sa = "mem:member.json"
+	serviceAccountCredentials.Store(sa, []byte(`{"client_email":"sa@p.iam.gserviceaccount.com"}`))
+	defer serviceAccountCredentials.Delete(sa)
+	f := &Fs{ServiceAccountFiles: newTestPool()}
+
+	members, err := f.teamDriveMembersFor([]string{"alice@example.com"}, map[string]string{"group": "team@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, []teamDriveMember{{"user", "alice@example.com"}, {"group", "team@example.com"}}, members)
+
+	_, err = f.teamDriveMembersFor(nil, map[string]string{"sa": ""})
+	assert.ErrorContains(t, err, "no service accounts")
+	setFiles(f.ServiceAccountFiles, sa)
+	members, err = f.teamDriveMembersFor(nil, map[string]string{"sa": ""})
+	require.NoError(t, err)
+	assert.Equal(t, []teamDriveMember{{"user", "sa@p.iam.gserviceaccount.com"}}, members)
+
+	assert.Equal(t, "fileOrganizer", memberRole(nil))
+	assert.Equal(t, "organizer", memberRole(map[string]string{"role": "organizer"}))
+}
+
+func TestMemberDriveID(t *testing.T) {
+	f := &Fs{}
+	_, err := f.memberDriveID(nil)
+	assert.ErrorContains(t, err, "not a shared drive remote")
+	f.opt.TeamDriveID = "td"
+	id, _ := f.memberDriveID(nil)
+	assert.Equal(t, "td", id)
+	id, _ = f.memberDriveID(map[string]string{"drive": "other"})
+	assert.Equal(t, "other", id)
+}
+
+func TestTeamDriveMemberChanges(t *testing.T) {
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodGet {
+			_, _ = io.WriteString(w, `{"permissions":[
+				{"id":"p1","type":"user","role":"fileOrganizer","emailAddress":"Same@example.com"},
+				{"id":"p2","type":"user","role":"reader","emailAddress":"reader@example.com"}]}`)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		_, _ = io.WriteString(w, `{}`)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	svc, err := drive.NewService(ctx, option.WithHTTPClient(srv.Client()), option.WithEndpoint(srv.URL+"/"))
+	require.NoError(t, err)
+	f := &Fs{
+		svc:                 svc,
+		pacer:               fs.NewPacer(ctx, pacer.NewGoogleDrive(pacer.MinSleep(time.Millisecond))),
+		ServiceAccountFiles: newTestPool(),
+	}
+	f.opt.TeamDriveID = "td"
+
+	members, err := f.memberCommand(ctx, "members", nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, members, 2)
+
+	changes, err := f.memberCommand(ctx, "member-add", []string{"same@example.com", "reader@example.com", "new@example.com"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, memberChanges{Added: 1, Updated: 1, Unchanged: 1}, changes)
+
+	changes, err = f.memberCommand(ctx, "member-remove", []string{"reader@example.com", "gone@example.com"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, memberChanges{Removed: 1, Unchanged: 1}, changes)
+
+	assert.Equal(t, []string{
+		"GET /files/td/permissions",
+		"GET /files/td/permissions",
+		"PATCH /files/td/permissions/p2",
+		"POST /files/td/permissions",
+		"GET /files/td/permissions",
+		"DELETE /files/td/permissions/p2",
+	}, calls)
+
+	_, err = f.memberCommand(ctx, "member-add", nil, nil)
+	assert.ErrorContains(t, err, "need the emails of the members")
+}
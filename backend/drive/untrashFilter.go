@@ -0,0 +1,200 @@
+// Untrashing selected files
+//
+// A sync run the wrong way, or with --delete-excluded and a bad filter,
+// trashes a lot of files at once, often among others trashed on purpose,
+// so untrashing everything under a directory isn't the answer.
+//
+// With the filter flags, or -o by, the untrash command only restores the
+// items they select. Paths are matched by the filter rules and the
+// --min-age and --max-age flags apply to the time an item was trashed,
+// so --max-age 2h restores what was trashed in the last two hours. -o by
+// only restores the items trashed by the users given, and -o sa by the
+// SAs of the pool. Drive only records who trashed an item, and when, in
+// shared drives: elsewhere the age applies to the modification time and
+// -o by selects nothing.
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/operations"
+	"google.golang.org/api/drive/v3"
+)
+
+// untrashSelection is what the untrash command restores
+type untrashSelection struct {
+	fi *filter.Filter
+	by map[string]bool // emails of those who trashed the items, or nil for anyone
+}
+
+// untrashSelectionFor returns the selection made by the filters in ctx
+// and opt, or nil if everything is restored.
+func (f *Fs) untrashSelectionFor(ctx context.Context, opt map[string]string) (*untrashSelection, error) {
+	sel := &untrashSelection{fi: filter.GetConfig(ctx)}
+	var emails []string
+	if by := opt["by"]; by != "" {
+		emails = append(emails, strings.Split(by, ",")...)
+	}
+	if _, ok := opt["sa"]; ok {
+		pool := f.ServiceAccountFiles.emails()
+		if len(pool) == 0 {
+			return nil, errors.New("no service accounts in the pool to select")
+		}
+		emails = append(emails, pool...)
+	}
+	for _, email := range emails {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			if sel.by == nil {
+				sel.by = map[string]bool{}
+			}
+			sel.by[email] = true
+		}
+	}
+	if sel.by == nil && sel.fi.InActive() {
+		return nil, nil
+	}
+	return sel, nil
+}
+
+// byAge returns true if the filters select items by age.
+func (sel *untrashSelection) byAge() bool {
+	return !sel.fi.ModTimeFrom.IsZero() || !sel.fi.ModTimeTo.IsZero()
+}
+
+// selects returns true if the trashed item at remote in f, with the
+// trash details in info, should be restored.
+func (sel *untrashSelection) selects(ctx context.Context, f fs.Fs, remote string, info *drive.File) (bool, error) {
+	if sel.by != nil {
+		if info.TrashingUser == nil || !sel.by[strings.ToLower(info.TrashingUser.EmailAddress)] {
+			fs.Debugf(remote, "Excluded (trashed by another user)")
+			return false, nil
+		}
+	}
+	trashed := info.TrashedTime
+	if trashed == "" {
+		trashed = info.ModifiedTime
+	}
+	var when time.Time
+	if sel.byAge() {
+		var err error
+		when, err = time.Parse(time.RFC3339, trashed)
+		if err != nil {
+			return false, fmt.Errorf("bad trashed time %q: %w", trashed, err)
+		}
+	}
+	if info.MimeType == driveFolderType {
+		include, err := sel.fi.IncludeDirectory(ctx, f)(remote)
+		if err != nil || !include {
+			return false, err
+		}
+		if (!sel.fi.ModTimeFrom.IsZero() && when.Before(sel.fi.ModTimeFrom)) ||
+			(!sel.fi.ModTimeTo.IsZero() && when.After(sel.fi.ModTimeTo)) {
+			fs.Debugf(remote, "Excluded (ModTime Filter)")
+			return false, nil
+		}
+		return true, nil
+	}
+	return sel.fi.Include(remote, info.Size, when, nil), nil
+}
+
+// unTrashSelected restores the trashed items from dir, directoryID,
+// selected by sel, recursing.
+func (f *Fs) unTrashSelected(ctx context.Context, dir string, directoryID string, sel *untrashSelection) (r unTrashResult, err error) {
+	directoryID = actualID(directoryID)
+	fs.Debugf(dir, "finding selected trash to restore in directory %q", directoryID)
+	_, err = f.list(ctx, []string{directoryID}, "", false, false, f.opt.TrashedOnly, true, func(item *drive.File) bool {
+		remote := path.Join(dir, item.Name)
+		if item.ExplicitlyTrashed {
+			info := item
+			if sel.by != nil || sel.byAge() {
+				var err error
+				info, err = f.getFile(ctx, item.Id, "id,mimeType,size,modifiedTime,trashedTime,trashingUser(emailAddress)")
+				if err != nil {
+					r.Errors++
+					fs.Errorf(remote, "failed to read trash details: %v", err)
+					return false
+				}
+			}
+			selected, err := sel.selects(ctx, f, remote, info)
+			if err != nil {
+				r.Errors++
+				fs.Errorf(remote, "%v", err)
+				return false
+			}
+			if selected {
+				fs.Infof(remote, "restoring %q", item.Id)
+				if operations.SkipDestructive(ctx, remote, "restore") {
+					return false
+				}
+				update := drive.File{
+					ForceSendFields: []string{"Trashed"}, // necessary to set false value
+					Trashed:         false,
+				}
+				err := f.pacer.Call(func() (bool, error) {
+					_, err := f.svc.Files.Update(item.Id, &update).
+						SupportsAllDrives(true).
+						Fields("trashed").
+						Context(ctx).Do()
+					return f.shouldRetry(ctx, err)
+				})
+				if err != nil {
+					r.Errors++
+					fs.Errorf(remote, "failed to restore: %v", err)
+				} else {
+					r.Untrashed++
+				}
+			}
+		}
+		if item.MimeType == driveFolderType && !isShortcutID(item.Id) {
+			// Only descend into directories the filters could select from
+			include, err := sel.fi.IncludeDirectory(ctx, f)(remote)
+			if err != nil {
+				r.Errors++
+				fs.Errorf(remote, "%v", err)
+			} else if include {
+				rNew, _ := f.unTrashSelected(ctx, remote, item.Id, sel)
+				r.Untrashed += rNew.Untrashed
+				r.Errors += rNew.Errors
+			}
+		}
+		return false
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to list directory: %w", err)
+		r.Errors++
+		fs.Errorf(dir, "%v", err)
+	}
+	if r.Errors != 0 {
+		return r, r
+	}
+	return r, nil
+}
+
+// unTrashCommand runs the untrash backend command, restoring only what
+// the filters and opt select if they select anything.
+func (f *Fs) unTrashCommand(ctx context.Context, arg []string, opt map[string]string) (r unTrashResult, err error) {
+	dir := ""
+	if len(arg) > 0 {
+		dir = arg[0]
+	}
+	sel, err := f.untrashSelectionFor(ctx, opt)
+	if err != nil {
+		return r, err
+	}
+	if sel == nil {
+		return f.unTrashDir(ctx, dir, true)
+	}
+	directoryID, err := f.dirCache.FindDir(ctx, dir, false)
+	if err != nil {
+		r.Errors++
+		return r, err
+	}
+	return f.unTrashSelected(ctx, dir, directoryID, sel)
+}
@@ -0,0 +1,127 @@
+package drive
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/lib/pacer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+func TestUntrashSelectionFor(t *testing.T) {
+	ctx := context.Background()
+	f := &Fs{ServiceAccountFiles: newTestPool()}
+	sel, err := f.untrashSelectionFor(ctx, map[string]string{})
+	require.NoError(t, err)
+	assert.Nil(t, sel)
+
+	sel, err = f.untrashSelectionFor(ctx, map[string]string{"by": "A@example.com, b@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"a@example.com": true, "b@example.com": true}, sel.by)
+
+	_, err = f.untrashSelectionFor(ctx, map[string]string{"sa": ""})
+	assert.ErrorContains(t, err, "no service accounts")
+
+	const a = "mem:untrash.json"
+	serviceAccountCredentials.Store(a, []byte(`{"client_email":"sa@p.iam.gserviceaccount.com"}`))
+	defer serviceAccountCredentials.Delete(a)
+	setFiles(f.ServiceAccountFiles, a)
+	sel, err = f.untrashSelectionFor(ctx, map[string]string{"sa": ""})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"sa@p.iam.gserviceaccount.com": true}, sel.by)
+
+	fi, err := filter.NewFilter(nil)
+	require.NoError(t, err)
+	require.NoError(t, fi.AddRule("+ /photos/**"))
+	sel, err = f.untrashSelectionFor(filter.ReplaceConfig(ctx, fi), map[string]string{})
+	require.NoError(t, err)
+	require.NotNil(t, sel)
+	assert.Nil(t, sel.by)
+}
+
+func TestUnTrashSelected(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	ago := func(d time.Duration) string { return now.Add(-d).Format(time.RFC3339) }
+	const sa, human = "sa@p.iam.gserviceaccount.com", "human@example.com"
+	items := map[string]*drive.File{
+		"old":   {Id: "old", Name: "old.txt", MimeType: "text/plain", ExplicitlyTrashed: true, TrashedTime: ago(72 * time.Hour), TrashingUser: &drive.User{EmailAddress: sa}},
+		"new":   {Id: "new", Name: "new.txt", MimeType: "text/plain", ExplicitlyTrashed: true, TrashedTime: ago(time.Hour), TrashingUser: &drive.User{EmailAddress: sa}},
+		"other": {Id: "other", Name: "other.txt", MimeType: "text/plain", ExplicitlyTrashed: true, TrashedTime: ago(time.Hour), TrashingUser: &drive.User{EmailAddress: human}},
+		"keep":  {Id: "keep", Name: "keep.txt", MimeType: "text/plain"},
+		"dir":   {Id: "dir", Name: "dir", MimeType: driveFolderType},
+		"x":     {Id: "x", Name: "x.txt", MimeType: "text/plain", ExplicitlyTrashed: true, TrashedTime: ago(time.Hour), TrashingUser: &drive.User{EmailAddress: sa}},
+	}
+	children := map[string][]string{"root": {"old", "new", "other", "keep", "dir"}, "dir": {"x"}}
+	var (
+		mu       sync.Mutex
+		restored []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/files/")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/files":
+			var list drive.FileList
+			for parent, ids := range children {
+				if strings.Contains(r.URL.Query().Get("q"), "'"+parent+"' in parents") {
+					for _, id := range ids {
+						item := *items[id]
+						// Listings don't carry the trash details
+						item.TrashedTime, item.TrashingUser = "", nil
+						list.Files = append(list.Files, &item)
+					}
+				}
+			}
+			_ = json.NewEncoder(w).Encode(list)
+		case r.Method == http.MethodGet:
+			_ = json.NewEncoder(w).Encode(items[id])
+		case r.Method == http.MethodPatch:
+			mu.Lock()
+			restored = append(restored, id)
+			mu.Unlock()
+			_ = json.NewEncoder(w).Encode(drive.File{})
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL)
+		}
+	}))
+	defer srv.Close()
+	svc, err := drive.NewService(ctx, option.WithHTTPClient(srv.Client()), option.WithEndpoint(srv.URL+"/"))
+	require.NoError(t, err)
+	f := &Fs{
+		svc:             svc,
+		ci:              fs.GetConfig(ctx),
+		pacer:           fs.NewPacer(ctx, pacer.NewGoogleDrive(pacer.MinSleep(time.Millisecond))),
+		dirResourceKeys: new(sync.Map),
+	}
+
+	opt := filter.Opt
+	opt.MaxAge = fs.Duration(2 * time.Hour)
+	fi, err := filter.NewFilter(&opt)
+	require.NoError(t, err)
+	sel := &untrashSelection{fi: fi, by: map[string]bool{sa: true}}
+	r, err := f.unTrashSelected(ctx, "", "root", sel)
+	require.NoError(t, err)
+	assert.Equal(t, unTrashResult{Untrashed: 2}, r)
+	assert.ElementsMatch(t, []string{"new", "x"}, restored)
+
+	restored = nil
+	fi, err = filter.NewFilter(nil)
+	require.NoError(t, err)
+	require.NoError(t, fi.AddRule("- /dir/**"))
+	sel = &untrashSelection{fi: fi}
+	r, err = f.unTrashSelected(ctx, "", "root", sel)
+	require.NoError(t, err)
+	assert.Equal(t, unTrashResult{Untrashed: 3}, r)
+	assert.ElementsMatch(t, []string{"old", "new", "other"}, restored)
+}
@@ -19,6 +19,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/fserrors"
@@ -47,6 +48,22 @@ type resumableUpload struct {
 	ContentLength int64
 	// Return value
 	ret *drive.File
+	//-----------------------------------------------------------
+	// client is the one the session was started with. The chunks are sent
+	// with it even if the Fs switches SA meanwhile, until handOff moves the
+	// session to the new one.
+	client *http.Client
+	// file is the SA file of client, which the bytes sent are counted against
+	file string
+	// fileID is the file updated, empty for a new file
+	fileID string
+	// modified is the modification time uploaded with the file
+	modified string
+	// offset is where the upload starts, after what an earlier run sent
+	offset int64
+	// started is when the session was started, if by an earlier run
+	started time.Time
+	//-----------------------------------------------------------
 }
 
 // Upload the io.Reader in of size bytes with contentType and info
@@ -60,6 +77,14 @@ func (f *Fs) Upload(ctx context.Context, in io.Reader, size int64, contentType,
 	if f.opt.KeepRevisionForever {
 		params.Set("keepRevisionForever", "true")
 	}
+	//-----------------------------------------------------------
+	if rx, err := f.resumeUpload(ctx, in, size, contentType, fileID, remote, info); err != nil || rx != nil {
+		if err != nil {
+			return nil, err
+		}
+		return rx.Upload(ctx)
+	}
+	//-----------------------------------------------------------
 	urls := "https://www.googleapis.com/upload/drive/v3/files"
 	method := "POST"
 	if fileID != "" {
@@ -70,6 +95,8 @@ func (f *Fs) Upload(ctx context.Context, in io.Reader, size int64, contentType,
 	urls += "?" + params.Encode()
 	var res *http.Response
 	var err error
+	var client *http.Client
+	var file string
 	err = f.pacer.Call(func() (bool, error) {
 		var body io.Reader
 		body, err = googleapi.WithoutDataWrapper.JSONReader(info)
@@ -89,7 +116,8 @@ func (f *Fs) Upload(ctx context.Context, in io.Reader, size int64, contentType,
 		if size >= 0 {
 			req.Header.Set("X-Upload-Content-Length", fmt.Sprintf("%v", size))
 		}
-		res, err = f.client.Do(req)
+		client, file = f.client, f.opt.ServiceAccountFile
+		res, err = client.Do(req)
 		if err == nil {
 			defer googleapi.CloseBody(res)
 			err = googleapi.CheckResponse(res)
@@ -107,6 +135,10 @@ func (f *Fs) Upload(ctx context.Context, in io.Reader, size int64, contentType,
 		Media:         in,
 		MediaType:     contentType,
 		ContentLength: size,
+		client:        client,
+		file:          file,
+		fileID:        fileID,
+		modified:      info.ModifiedTime,
 	}
 	return rx.Upload(ctx)
 }
@@ -132,7 +164,7 @@ func (rx *resumableUpload) makeRequest(ctx context.Context, start int64, body io
 func (rx *resumableUpload) transferChunk(ctx context.Context, start int64, chunk io.ReadSeeker, chunkSize int64) (int, error) {
 	_, _ = chunk.Seek(0, io.SeekStart)
 	req := rx.makeRequest(ctx, start, chunk, chunkSize)
-	res, err := rx.f.client.Do(req)
+	res, err := rx.client.Do(req)
 	if err != nil {
 		return 599, err
 	}
@@ -165,7 +197,10 @@ func (rx *resumableUpload) transferChunk(ctx context.Context, start int64, chunk
 // Upload uploads the chunks from the input
 // It retries each chunk using the pacer and --low-level-retries
 func (rx *resumableUpload) Upload(ctx context.Context) (*drive.File, error) {
-	start := int64(0)
+	//-----------------------------------------------------------
+	defer rx.track()()
+	start := rx.offset
+	//-----------------------------------------------------------
 	var StatusCode int
 	var err error
 	buf := make([]byte, int(rx.f.opt.ChunkSize))
@@ -204,13 +239,24 @@ func (rx *resumableUpload) Upload(ctx context.Context) (*drive.File, error) {
 				again = false
 				err = nil
 			}
+			//-----------------------------------------------------------
+			if err != nil && rx.f.client != rx.client {
+				rx.handOff(ctx, start)
+			}
+			//-----------------------------------------------------------
 			return again, err
 		})
 		if err != nil {
 			return nil, err
 		}
+		//-----------------------------------------------------------
+		rx.f.ServiceAccountFiles.RecordUpload(rx.file, reqSize)
+		//-----------------------------------------------------------
 
 		start += reqSize
+		//-----------------------------------------------------------
+		rx.progress(start)
+		//-----------------------------------------------------------
 	}
 	// Resume or retry uploads that fail due to connection interruptions or
 	// any 5xx errors, including:
@@ -237,3 +283,49 @@ func (rx *resumableUpload) Upload(ctx context.Context) (*drive.File, error) {
 	}
 	return rx.ret, nil
 }
+
+//-----------------------------------------------------------
+
+// handOff tries to move the upload session to the SA the Fs has switched
+// to, so the rest of the chunks aren't sent with one which has been
+// blacklisted. start is the offset of the chunk being sent.
+//
+// It asks the server how much of the upload it has through the new client.
+// The session is only moved if that works and the server has everything
+// before start, so the chunk can be resent as is. Otherwise the upload
+// carries on with the SA which started it.
+func (rx *resumableUpload) handOff(ctx context.Context, start int64) {
+	client := rx.f.client
+	if client == nil {
+		return
+	}
+	req := rx.makeRequest(ctx, start, nil, 0)
+	res, err := client.Do(req)
+	if err != nil {
+		fs.Debugf(rx.remote, "Keeping upload on its service account: %v", err)
+		return
+	}
+	defer googleapi.CloseBody(res)
+	if res.StatusCode != statusResumeIncomplete {
+		fs.Debugf(rx.remote, "Keeping upload on its service account: status query returned %d", res.StatusCode)
+		return
+	}
+	if received := uploadReceived(res.Header.Get("Range")); received != start {
+		fs.Debugf(rx.remote, "Keeping upload on its service account: server has %d bytes, resending from %d", received, start)
+		return
+	}
+	fs.Debugf(rx.remote, "Service account changed - continuing upload from %d with the new one", start)
+	rx.client, rx.file = client, rx.f.opt.ServiceAccountFile
+}
+
+// uploadReceived returns the number of bytes the server has from the Range
+// header of a status query response, e.g. "bytes=0-1023" gives 1024.
+func uploadReceived(rangeHeader string) int64 {
+	var first, last int64
+	if _, err := fmt.Sscanf(rangeHeader, "bytes=%d-%d", &first, &last); err != nil || first != 0 {
+		return 0
+	}
+	return last + 1
+}
+
+//-----------------------------------------------------------
@@ -0,0 +1,179 @@
+// Upload dedupe
+//
+// Media libraries often hold the same content under several names. With
+// upload_dedupe the MD5 and size of every file uploaded or listed are
+// remembered, and a file with content already on the remote is made with a
+// server side copy, or a shortcut, of the file holding it instead of being
+// uploaded again. Uploads of the same content running at once wait for the
+// first one to finish.
+//
+// Drive can't search by checksum, so only content this process has seen is
+// deduped.
+package drive
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// Values of upload_dedupe
+const (
+	dedupeCopy     = "copy"
+	dedupeShortcut = "shortcut"
+)
+
+// uploadDedupe remembers which remote holds each content.
+type uploadDedupe struct {
+	mode     string
+	mu       sync.Mutex
+	done     map[string]string        // remote holding each content
+	inFlight map[string]chan struct{} // closed when the first upload of a content ends
+}
+
+// newUploadDedupe returns the dedupe for the upload_dedupe mode, nil if
+// it is off.
+func newUploadDedupe(mode string) (*uploadDedupe, error) {
+	switch mode {
+	case "":
+		return nil, nil
+	case dedupeCopy, dedupeShortcut:
+	default:
+		return nil, fmt.Errorf("unknown upload_dedupe %q - use %q or %q", mode, dedupeCopy, dedupeShortcut)
+	}
+	return &uploadDedupe{
+		mode:     mode,
+		done:     make(map[string]string),
+		inFlight: make(map[string]chan struct{}),
+	}, nil
+}
+
+// dedupeKey identifies a content by MD5 and size.
+func dedupeKey(md5 string, size int64) string {
+	return fmt.Sprintf("%s/%d", md5, size)
+}
+
+// record notes that remote holds the content key, unless one already does.
+func (d *uploadDedupe) record(key, remote string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.done[key]; !ok {
+		d.done[key] = remote
+	}
+}
+
+// forget drops remote as holder of key, as it has gone or changed.
+func (d *uploadDedupe) forget(key, remote string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.done[key] == remote {
+		delete(d.done, key)
+	}
+}
+
+// claim returns the remote holding the content key. If there is none it
+// returns owner true and the caller must upload the content and call
+// release. While another caller is uploading the content it waits.
+func (d *uploadDedupe) claim(ctx context.Context, key string) (remote string, owner bool, err error) {
+	for {
+		d.mu.Lock()
+		if remote, ok := d.done[key]; ok {
+			d.mu.Unlock()
+			return remote, false, nil
+		}
+		wait, busy := d.inFlight[key]
+		if !busy {
+			d.inFlight[key] = make(chan struct{})
+			d.mu.Unlock()
+			return "", true, nil
+		}
+		d.mu.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return "", false, ctx.Err()
+		}
+	}
+}
+
+// release ends the upload of key claimed with claim, recording remote as
+// holding it if the upload worked ("" if not).
+func (d *uploadDedupe) release(key, remote string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if remote != "" {
+		d.done[key] = remote
+	}
+	close(d.inFlight[key])
+	delete(d.inFlight, key)
+}
+
+// noteObject records the content of o for dedupe, if on.
+func (f *Fs) noteObject(o *Object) {
+	if f.dedupe != nil && o.md5sum != "" && o.bytes >= int64(f.opt.UploadCutoff) {
+		f.dedupe.record(dedupeKey(o.md5sum, o.bytes), o.remote)
+	}
+}
+
+// putDedupe puts src with upload, unless its content is already on the
+// remote, in which case a copy or shortcut of that is made instead.
+func (f *Fs) putDedupe(ctx context.Context, src fs.ObjectInfo, upload func() (fs.Object, error)) (fs.Object, error) {
+	size := src.Size()
+	if f.dedupe == nil || size < int64(f.opt.UploadCutoff) {
+		return upload()
+	}
+	md5, err := src.Hash(ctx, hash.MD5)
+	if err != nil || md5 == "" {
+		return upload()
+	}
+	key := dedupeKey(md5, size)
+	holder, owner, err := f.dedupe.claim(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if owner {
+		o, err := upload()
+		remote := ""
+		if err == nil {
+			remote = o.Remote()
+		}
+		f.dedupe.release(key, remote)
+		return o, err
+	}
+	o, err := f.putFrom(ctx, holder, key, src)
+	if err == nil {
+		return o, nil
+	}
+	fs.Debugf(src, "Can't dedupe from %q, uploading: %v", holder, err)
+	f.dedupe.forget(key, holder)
+	return upload()
+}
+
+// putFrom makes src as a copy or shortcut of holder, which should have the
+// content key.
+func (f *Fs) putFrom(ctx context.Context, holder, key string, src fs.ObjectInfo) (fs.Object, error) {
+	o, err := f.NewObject(ctx, holder)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := o.(*Object)
+	if !ok || dedupeKey(obj.md5sum, obj.bytes) != key {
+		return nil, fmt.Errorf("content of %q has changed", holder)
+	}
+	if f.dedupe.mode == dedupeShortcut {
+		fs.Infof(src, "Duplicate of %q - making a shortcut to it", holder)
+		return f.makeShortcut(ctx, holder, f, src.Remote())
+	}
+	fs.Infof(src, "Duplicate of %q - copying it server side", holder)
+	newObj, err := f.Copy(ctx, o, src.Remote())
+	if err != nil {
+		return nil, err
+	}
+	if err = newObj.SetModTime(ctx, src.ModTime(ctx)); err != nil {
+		return nil, err
+	}
+	return newObj, nil
+}
@@ -0,0 +1,118 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewUploadDedupe(t *testing.T) {
+	d, err := newUploadDedupe("")
+	require.NoError(t, err)
+	assert.Nil(t, d)
+	d, err = newUploadDedupe("shortcut")
+	require.NoError(t, err)
+	assert.Equal(t, dedupeShortcut, d.mode)
+	_, err = newUploadDedupe("hardlink")
+	assert.ErrorContains(t, err, `unknown upload_dedupe "hardlink"`)
+}
+
+func TestUploadDedupeClaim(t *testing.T) {
+	ctx := context.Background()
+	d, err := newUploadDedupe("copy")
+	require.NoError(t, err)
+	key := dedupeKey("abc", 10)
+
+	_, owner, err := d.claim(ctx, key)
+	require.NoError(t, err)
+	assert.True(t, owner)
+
+	// Others wait for the first upload of a content
+	got := make(chan string)
+	go func() {
+		remote, owner, err := d.claim(ctx, key)
+		assert.NoError(t, err)
+		assert.False(t, owner)
+		got <- remote
+	}()
+	select {
+	case <-got:
+		t.Fatal("claim didn't wait for the upload")
+	case <-time.After(20 * time.Millisecond):
+	}
+	d.release(key, "first.mkv")
+	assert.Equal(t, "first.mkv", <-got)
+
+	// Listed files don't replace the holder, gone ones are forgotten
+	d.record(key, "second.mkv")
+	d.forget(key, "second.mkv")
+	remote, _, _ := d.claim(ctx, key)
+	assert.Equal(t, "first.mkv", remote)
+	d.forget(key, "first.mkv")
+	_, owner, _ = d.claim(ctx, key)
+	assert.True(t, owner)
+
+	// A failed upload lets the next one try
+	d.release(key, "")
+	_, owner, _ = d.claim(ctx, key)
+	assert.True(t, owner)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, _, err = d.claim(cancelled, key)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestPutDedupeUploads(t *testing.T) {
+	ctx := context.Background()
+	f := &Fs{}
+	f.opt.UploadCutoff = 5
+	uploads := 0
+	upload := func(err error) func() (fs.Object, error) {
+		return func() (fs.Object, error) {
+			uploads++
+			return &Object{baseObject: baseObject{remote: "up.bin"}}, err
+		}
+	}
+	src := func(size int64, md5 string) fs.ObjectInfo {
+		var hashes map[hash.Type]string
+		if md5 != "" {
+			hashes = map[hash.Type]string{hash.MD5: md5}
+		}
+		return object.NewStaticObjectInfo("file.bin", time.Now(), size, true, hashes, nil)
+	}
+
+	// Off
+	_, err := f.putDedupe(ctx, src(10, "abc"), upload(nil))
+	require.NoError(t, err)
+
+	f.dedupe, _ = newUploadDedupe("copy")
+	// Small files and files without MD5 are uploaded
+	_, err = f.putDedupe(ctx, src(4, "abc"), upload(nil))
+	require.NoError(t, err)
+	_, err = f.putDedupe(ctx, src(10, ""), upload(nil))
+	require.NoError(t, err)
+	assert.Empty(t, f.dedupe.done)
+
+	// The first upload of a content records it, failed or not
+	_, err = f.putDedupe(ctx, src(10, "bad"), upload(errors.New("failed")))
+	assert.Error(t, err)
+	_, err = f.putDedupe(ctx, src(10, "abc"), upload(nil))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{dedupeKey("abc", 10): "up.bin"}, f.dedupe.done)
+	assert.Empty(t, f.dedupe.inFlight)
+	assert.Equal(t, 5, uploads)
+
+	// Listed objects are noted
+	f.noteObject(&Object{baseObject: baseObject{remote: "listed.bin", bytes: 20}, md5sum: "def"})
+	f.noteObject(&Object{baseObject: baseObject{remote: "tiny.bin", bytes: 2}, md5sum: "ghi"})
+	assert.Equal(t, "listed.bin", f.dedupe.done[dedupeKey("def", 20)])
+	assert.Len(t, f.dedupe.done, 2)
+}
@@ -0,0 +1,176 @@
+// Resuming uploads in a later run
+//
+// Drive keeps a resumable upload session for a week, so an upload cut
+// short because the process was stopped, e.g. a spot instance being
+// reclaimed, can carry on in a later run from the last chunk the server
+// has instead of from the start.
+//
+// UploadSessions lists the sessions of the uploads in progress, to be
+// saved with the checkpoint of the run, and ResumeUploads hands them to
+// the next run. Its first upload of the same file, with the same size,
+// asks the server how much it has, skips that much of the input and
+// sends the rest through the session. Sessions the server no longer
+// knows, or won't let the SA in use continue, are uploaded from scratch.
+package drive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	drive "google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// UploadSession is an upload in progress which a later run can resume.
+type UploadSession struct {
+	Fs       string    `json:"fs"` // config string of the remote uploading
+	Remote   string    `json:"remote"`
+	FileID   string    `json:"file_id,omitempty"` // the file updated, empty for a new file
+	Size     int64     `json:"size"`
+	Modified string    `json:"modified,omitempty"` // modification time of the file uploaded
+	URI      string    `json:"uri"`
+	Sent     int64     `json:"sent"` // bytes the server has confirmed
+	Started  time.Time `json:"started"`
+}
+
+// uploadSessionLife is how long Drive keeps an upload session
+const uploadSessionLife = 7 * 24 * time.Hour
+
+var (
+	uploadsMu sync.Mutex
+	uploads   = map[*resumableUpload]*UploadSession{} // the uploads in progress
+	resumable = map[string]UploadSession{}            // sessions to resume, by key
+)
+
+// key returns the key of the session in resumable.
+func (s *UploadSession) key() string {
+	return s.Fs + "\x00" + s.Remote
+}
+
+// UploadSessions returns the sessions of the uploads in progress which
+// the server has confirmed some of.
+func UploadSessions() (sessions []UploadSession) {
+	uploadsMu.Lock()
+	defer uploadsMu.Unlock()
+	for _, session := range uploads {
+		if session.Sent > 0 {
+			sessions = append(sessions, *session)
+		}
+	}
+	return sessions
+}
+
+// ResumeUploads hands sessions saved by UploadSessions to the uploads of
+// this run, dropping those Drive will have expired.
+func ResumeUploads(sessions []UploadSession) {
+	uploadsMu.Lock()
+	defer uploadsMu.Unlock()
+	for _, session := range sessions {
+		if time.Since(session.Started) < uploadSessionLife {
+			resumable[session.key()] = session
+		}
+	}
+}
+
+// track records rx as in progress until the returned function is called.
+func (rx *resumableUpload) track() func() {
+	if rx.ContentLength < 0 {
+		return func() {}
+	}
+	session := &UploadSession{
+		Fs:       fs.ConfigString(rx.f),
+		Remote:   rx.remote,
+		FileID:   rx.fileID,
+		Size:     rx.ContentLength,
+		Modified: rx.modified,
+		URI:      rx.URI,
+		Sent:     rx.offset,
+		Started:  rx.started,
+	}
+	if session.Started.IsZero() {
+		session.Started = time.Now()
+	}
+	uploadsMu.Lock()
+	uploads[rx] = session
+	uploadsMu.Unlock()
+	return func() {
+		uploadsMu.Lock()
+		delete(uploads, rx)
+		uploadsMu.Unlock()
+	}
+}
+
+// progress records that the server has the first sent bytes of rx.
+func (rx *resumableUpload) progress(sent int64) {
+	uploadsMu.Lock()
+	if session, ok := uploads[rx]; ok {
+		session.Sent = sent
+	}
+	uploadsMu.Unlock()
+}
+
+// resumeUpload returns the upload of remote continuing the session saved
+// by an earlier run, with what the server has of it skipped from in, or
+// nil if there is none to continue.
+func (f *Fs) resumeUpload(ctx context.Context, in io.Reader, size int64, contentType, fileID, remote string, info *drive.File) (*resumableUpload, error) {
+	if size < 0 {
+		return nil, nil
+	}
+	key := (&UploadSession{Fs: fs.ConfigString(f), Remote: remote}).key()
+	uploadsMu.Lock()
+	session, ok := resumable[key]
+	delete(resumable, key)
+	uploadsMu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	if session.Size != size || session.FileID != fileID || session.Modified != info.ModifiedTime {
+		fs.Debugf(remote, "Not resuming upload: the file has changed since")
+		return nil, nil
+	}
+	rx := &resumableUpload{
+		f:             f,
+		remote:        remote,
+		URI:           session.URI,
+		Media:         in,
+		MediaType:     contentType,
+		ContentLength: size,
+		client:        f.client,
+		file:          f.opt.ServiceAccountFile,
+		fileID:        fileID,
+		modified:      info.ModifiedTime,
+		started:       session.Started,
+	}
+	// Ask the server how much it has
+	res, err := rx.client.Do(rx.makeRequest(ctx, 0, nil, 0))
+	if err != nil {
+		fs.Debugf(remote, "Not resuming upload: %v", err)
+		return nil, nil
+	}
+	defer googleapi.CloseBody(res)
+	switch res.StatusCode {
+	case statusResumeIncomplete:
+		rx.offset = uploadReceived(res.Header.Get("Range"))
+	case http.StatusOK, http.StatusCreated:
+		// Finished before the last run could see it
+		if err := json.NewDecoder(res.Body).Decode(&rx.ret); err != nil {
+			fs.Debugf(remote, "Not resuming upload: %v", err)
+			return nil, nil
+		}
+		rx.offset = size
+	default:
+		fs.Debugf(remote, "Not resuming upload: status query returned %d", res.StatusCode)
+		return nil, nil
+	}
+	if _, err := io.CopyN(io.Discard, in, rx.offset); err != nil {
+		return nil, fmt.Errorf("failed to skip the %d bytes uploaded already: %w", rx.offset, err)
+	}
+	fs.Infof(remote, "Resuming upload from %d of %d bytes", rx.offset, size)
+	return rx, nil
+}
@@ -0,0 +1,155 @@
+package drive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/pacer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	drive "google.golang.org/api/drive/v3"
+)
+
+// resumeServer is an upload session which has the first received bytes
+type resumeServer struct {
+	status   int // answer to the status query
+	received int64
+	data     []byte
+}
+
+func (s *resumeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var start, end, total int64
+	if _, err := fmt.Sscanf(r.Header.Get("Content-Range"), "bytes */%d", &total); err == nil {
+		if s.status == statusResumeIncomplete {
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", s.received-1))
+		}
+		w.WriteHeader(s.status)
+		if s.status == http.StatusOK {
+			_, _ = io.WriteString(w, `{"id":"finished"}`)
+		}
+		return
+	}
+	if _, err := fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total); err != nil || start != s.received {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	s.data = append(s.data, body...)
+	s.received = end + 1
+	if s.received < total {
+		w.WriteHeader(statusResumeIncomplete)
+		return
+	}
+	_, _ = io.WriteString(w, `{"id":"done"}`)
+}
+
+func newResumeFs(srv *httptest.Server) *Fs {
+	ctx := context.Background()
+	f := &Fs{
+		name:                "remote",
+		root:                "root",
+		client:              srv.Client(),
+		pacer:               fs.NewPacer(ctx, pacer.NewGoogleDrive(pacer.MinSleep(time.Millisecond))),
+		ServiceAccountFiles: newTestPool(),
+	}
+	f.opt.ChunkSize = 4
+	return f
+}
+
+func TestResumeUpload(t *testing.T) {
+	ctx := context.Background()
+	modified := "2026-01-02T03:04:05Z"
+	for _, test := range []struct {
+		name     string
+		status   int
+		received int64
+		size     int64
+		modified string
+		want     string // id of the file returned, empty if not resumed
+		sent     string
+	}{
+		{name: "partial", status: statusResumeIncomplete, received: 5, size: 8, modified: modified, want: "done", sent: "fgh"},
+		{name: "finished", status: http.StatusOK, received: 8, size: 8, modified: modified, want: "finished"},
+		{name: "expired", status: http.StatusNotFound, size: 8, modified: modified},
+		{name: "size changed", status: statusResumeIncomplete, received: 5, size: 9, modified: modified},
+		{name: "modified", status: statusResumeIncomplete, received: 5, size: 8, modified: "2026-02-02T03:04:05Z"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s := &resumeServer{status: test.status, received: test.received}
+			srv := httptest.NewServer(s)
+			defer srv.Close()
+			f := newResumeFs(srv)
+			ResumeUploads([]UploadSession{{
+				Fs:       fs.ConfigString(f),
+				Remote:   "file",
+				Size:     8,
+				Modified: modified,
+				URI:      srv.URL,
+				Sent:     4,
+				Started:  time.Now().Add(-time.Hour),
+			}})
+			in := strings.NewReader("abcdefgh")
+			rx, err := f.resumeUpload(ctx, in, test.size, "text/plain", "", "file", &drive.File{ModifiedTime: test.modified})
+			require.NoError(t, err)
+			if test.want == "" {
+				assert.Nil(t, rx)
+				return
+			}
+			require.NotNil(t, rx)
+			info, err := rx.Upload(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, info.Id)
+			assert.Equal(t, test.sent, string(s.data))
+			// Only resumed once
+			rx, err = f.resumeUpload(ctx, strings.NewReader("abcdefgh"), test.size, "text/plain", "", "file", &drive.File{ModifiedTime: test.modified})
+			require.NoError(t, err)
+			assert.Nil(t, rx)
+		})
+	}
+}
+
+func TestUploadSessions(t *testing.T) {
+	ctx := context.Background()
+	s := &resumeServer{}
+	var sessions []UploadSession
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Look at the sessions before each chunk
+		sessions = append(sessions, UploadSessions()...)
+		s.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	f := newResumeFs(srv)
+	rx := &resumableUpload{
+		f:             f,
+		remote:        "file",
+		URI:           srv.URL,
+		Media:         strings.NewReader("abcdefgh"),
+		ContentLength: 8,
+		client:        srv.Client(),
+		modified:      "2026-01-02T03:04:05Z",
+	}
+	_, err := rx.Upload(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, UploadSessions())
+	// Nothing confirmed before the first chunk
+	require.Len(t, sessions, 1)
+	assert.Equal(t, fs.ConfigString(f), sessions[0].Fs)
+	assert.Equal(t, "file", sessions[0].Remote)
+	assert.Equal(t, int64(8), sessions[0].Size)
+	assert.Equal(t, int64(4), sessions[0].Sent)
+	assert.Equal(t, srv.URL, sessions[0].URI)
+	assert.Equal(t, "2026-01-02T03:04:05Z", sessions[0].Modified)
+
+	// Expired sessions aren't resumed
+	ResumeUploads([]UploadSession{{Fs: fs.ConfigString(f), Remote: "old", Size: 8, URI: srv.URL, Started: time.Now().Add(-8 * 24 * time.Hour)}})
+	rx, err = f.resumeUpload(ctx, strings.NewReader("abcdefgh"), 8, "text/plain", "", "old", &drive.File{})
+	require.NoError(t, err)
+	assert.Nil(t, rx)
+}
@@ -0,0 +1,108 @@
+// Verify only mode
+//
+// Auditors checking drives need to be sure nothing is changed, whatever
+// the command or backend command they run and whatever it is configured
+// to do. With --verify-only the HTTP clients of the drive backend refuse
+// any request other than GET and HEAD, bar fetching OAuth tokens, before
+// it is sent, so only listing, reading and hashing can happen. It also
+// sets --dry-run so that the commands report what they would have done
+// rather than fail on the first change.
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/spf13/pflag"
+)
+
+// verifyOptions are the global options of the verify only mode
+type verifyOptions struct {
+	VerifyOnly bool `config:"verify_only"`
+}
+
+var verifyOptionsInfo = fs.Options{{
+	Name:    "verify_only",
+	Default: false,
+	Help:    "Refuse any drive API call which could modify anything, implies --dry-run",
+	Groups:  "Config",
+}}
+
+// verifyOpt holds the global options of the verify only mode
+var verifyOpt verifyOptions
+
+func init() {
+	fs.RegisterGlobalOptions(fs.OptionsInfo{Name: "verify", Opt: &verifyOpt, Options: verifyOptionsInfo, Reload: reloadVerifyOnly})
+	flags.AddFlagsFromOptions(pflag.CommandLine, "", verifyOptionsInfo)
+}
+
+// reloadVerifyOnly sets --dry-run in verify only mode.
+func reloadVerifyOnly(ctx context.Context) error {
+	if verifyOpt.VerifyOnly {
+		fs.GetConfig(ctx).DryRun = true
+	}
+	return nil
+}
+
+// errVerifyOnly is returned for the requests refused in verify only mode
+var errVerifyOnly = errors.New("refused in --verify-only mode")
+
+// tokenRequest returns true if u is a Google OAuth token endpoint.
+func tokenRequest(u *url.URL) bool {
+	switch u.Host {
+	case "oauth2.googleapis.com", "accounts.google.com", "www.googleapis.com":
+		return strings.HasSuffix(u.Path, "/token")
+	}
+	return false
+}
+
+// readOnlyRequest returns true if req can't modify anything.
+func readOnlyRequest(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	case http.MethodPost:
+		return tokenRequest(req.URL)
+	}
+	return false
+}
+
+// verifyOnlyTransport refuses the requests which could modify anything
+type verifyOnlyTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *verifyOnlyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !readOnlyRequest(req) {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, fserrors.NoRetryError(fmt.Errorf("%w: %s %s", errVerifyOnly, req.Method, req.URL.Path))
+	}
+	return t.base.RoundTrip(req)
+}
+
+// guardVerifyOnly makes client refuse the requests which could modify
+// anything in verify only mode.
+func guardVerifyOnly(client *http.Client) *http.Client {
+	if !verifyOpt.VerifyOnly {
+		return client
+	}
+	if _, ok := client.Transport.(*verifyOnlyTransport); ok {
+		return client
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client.Transport = &verifyOnlyTransport{base: base}
+	return client
+}
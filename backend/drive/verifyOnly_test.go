@@ -0,0 +1,78 @@
+package drive
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnlyRequest(t *testing.T) {
+	for _, test := range []struct {
+		method string
+		url    string
+		want   bool
+	}{
+		{http.MethodGet, "https://www.googleapis.com/drive/v3/files", true},
+		{http.MethodHead, "https://www.googleapis.com/drive/v3/files/id", true},
+		{http.MethodPost, "https://oauth2.googleapis.com/token", true},
+		{http.MethodPost, "https://www.googleapis.com/oauth2/v4/token", true},
+		{http.MethodPost, "https://www.googleapis.com/upload/drive/v3/files", false},
+		{http.MethodPost, "https://www.googleapis.com/drive/v3/files/id/copy", false},
+		{http.MethodPost, "https://example.com/token", false},
+		{http.MethodPatch, "https://www.googleapis.com/drive/v3/files/id", false},
+		{http.MethodPut, "https://www.googleapis.com/upload/drive/v3/files/id", false},
+		{http.MethodDelete, "https://www.googleapis.com/drive/v3/files/id", false},
+	} {
+		u, err := url.Parse(test.url)
+		require.NoError(t, err)
+		assert.Equal(t, test.want, readOnlyRequest(&http.Request{Method: test.method, URL: u}), "%s %s", test.method, test.url)
+	}
+}
+
+func TestGuardVerifyOnly(t *testing.T) {
+	ctx := context.Background()
+	var methods []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+	}))
+	defer srv.Close()
+
+	client := guardVerifyOnly(srv.Client())
+	_, isGuarded := client.Transport.(*verifyOnlyTransport)
+	assert.False(t, isGuarded)
+
+	old := verifyOpt
+	oldDryRun := fs.GetConfig(ctx).DryRun
+	defer func() {
+		verifyOpt = old
+		fs.GetConfig(ctx).DryRun = oldDryRun
+	}()
+	verifyOpt.VerifyOnly = true
+	require.NoError(t, reloadVerifyOnly(ctx))
+	assert.True(t, fs.GetConfig(ctx).DryRun)
+
+	client = guardVerifyOnly(srv.Client())
+	client = guardVerifyOnly(client)
+	guard, isGuarded := client.Transport.(*verifyOnlyTransport)
+	require.True(t, isGuarded)
+	_, isGuarded = guard.base.(*verifyOnlyTransport)
+	assert.False(t, isGuarded, "guarded twice")
+
+	res, err := client.Get(srv.URL + "/drive/v3/files")
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	_, err = client.Post(srv.URL+"/drive/v3/files", "application/json", strings.NewReader("{}"))
+	assert.ErrorIs(t, err, errVerifyOnly)
+	req, err := http.NewRequest(http.MethodDelete, srv.URL+"/drive/v3/files/id", nil)
+	require.NoError(t, err)
+	_, err = client.Do(req)
+	assert.ErrorIs(t, err, errVerifyOnly)
+	assert.Equal(t, []string{http.MethodGet}, methods)
+}
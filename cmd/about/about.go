@@ -0,0 +1,127 @@
+// Package about makes the about command show the SA pool of drive
+// remotes as well as the quota of the account in use.
+//
+// The about command is rclone's. For a drive remote with service
+// accounts the quota it prints is that of whichever SA the remote
+// started with, which says little about what the remote can upload, so
+// this adds the number of SAs, how many are blacklisted or dead and an
+// estimate of the upload left today across the pool, in both the text
+// and the --json output.
+package about
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ebadenes/eclone/backend/drive"
+	"github.com/rclone/rclone/cmd"
+	_ "github.com/rclone/rclone/cmd/about" // the command this extends
+	"github.com/rclone/rclone/fs"
+	"github.com/spf13/cobra"
+)
+
+// help is added to the help of the about command
+// Note: "|" will be replaced by backticks below
+var help = strings.ReplaceAll(`
+For a drive remote with service accounts the pool is shown too: the
+number of SAs, how many are blacklisted and dead, and an estimate of
+what the pool can still upload today, at 750 GiB for each SA less what
+the |service_account_state| file says it uploaded. With |--json| these
+are in a |pool| object:
+
+    {
+    	"total": 16106127360,
+    	...
+    	"pool": {
+    		"serviceAccounts": 100,
+    		"blacklisted": 2,
+    		"dead": 0,
+    		"uploadLeft": 78920024064000,
+    		"withQuota": 98
+    	}
+    }
+`, "|", "`")
+
+func init() {
+	command, _, err := cmd.Root.Find([]string{"about"})
+	if err != nil || command.Name() != "about" {
+		panic("about command not found")
+	}
+	command.Long += help
+	run := command.Run
+	command.Run = func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		f := cmd.NewFsSrc(args)
+		pool, ok := drive.GetPoolUsage(f)
+		if !ok {
+			run(command, args)
+			return
+		}
+		jsonOutput, _ := command.Flags().GetBool("json")
+		fullOutput, _ := command.Flags().GetBool("full")
+		cmd.Run(false, false, command, func() error {
+			u, err := f.Features().About(context.Background())
+			if err != nil {
+				return fmt.Errorf("about call failed: %w", err)
+			}
+			if u == nil {
+				return errors.New("nil usage returned")
+			}
+			if jsonOutput {
+				return printJSON(os.Stdout, u, &pool)
+			}
+			printText(os.Stdout, u, &pool, fullOutput)
+			return nil
+		})
+	}
+}
+
+// usage is the about output of a remote with a pool
+type usage struct {
+	*fs.Usage
+	Pool *drive.PoolUsage `json:"pool"`
+}
+
+// printJSON writes u and pool to w as JSON.
+func printJSON(w io.Writer, u *fs.Usage, pool *drive.PoolUsage) error {
+	out := json.NewEncoder(w)
+	out.SetIndent("", "\t")
+	return out.Encode(usage{Usage: u, Pool: pool})
+}
+
+// printText writes u and pool to w as the about command does, with
+// the full numbers if full is set.
+func printText(w io.Writer, u *fs.Usage, pool *drive.PoolUsage, full bool) {
+	printValue := func(what string, uv *int64, isSize bool) {
+		if uv == nil {
+			return
+		}
+		var val string
+		if full {
+			val = fmt.Sprintf("%d", *uv)
+		} else if isSize {
+			val = fs.SizeSuffix(*uv).ByteUnit()
+		} else {
+			val = fs.CountSuffix(*uv).String()
+		}
+		_, _ = fmt.Fprintf(w, "%-13s%v\n", what+":", val)
+	}
+	printValue("Total", u.Total, true)
+	printValue("Used", u.Used, true)
+	printValue("Free", u.Free, true)
+	printValue("Trashed", u.Trashed, true)
+	printValue("Other", u.Other, true)
+	printValue("Objects", u.Objects, false)
+	sas := int64(pool.ServiceAccounts)
+	blacklisted := int64(pool.Blacklisted)
+	dead := int64(pool.Dead)
+	printValue("SAs", &sas, false)
+	printValue("Blacklisted", &blacklisted, false)
+	printValue("Dead", &dead, false)
+	printValue("Upload left", &pool.UploadLeft, true)
+}
@@ -0,0 +1,56 @@
+package about
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ebadenes/eclone/backend/drive"
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testUsage() (*fs.Usage, *drive.PoolUsage) {
+	total, used := int64(15*fs.Gibi), int64(fs.Gibi)
+	return &fs.Usage{Total: &total, Used: &used}, &drive.PoolUsage{
+		ServiceAccounts: 3,
+		Blacklisted:     1,
+		UploadLeft:      1500 * int64(fs.Gibi),
+		WithQuota:       2,
+	}
+}
+
+func TestPrintText(t *testing.T) {
+	u, pool := testUsage()
+	var buf bytes.Buffer
+	printText(&buf, u, pool, false)
+	assert.Equal(t, `Total:       15 GiB
+Used:        1 GiB
+SAs:         3
+Blacklisted: 1
+Dead:        0
+Upload left: 1.465 TiB
+`, buf.String())
+
+	buf.Reset()
+	printText(&buf, u, pool, true)
+	assert.Contains(t, buf.String(), "Total:       16106127360\n")
+	assert.Contains(t, buf.String(), "Upload left: 1610612736000\n")
+}
+
+func TestPrintJSON(t *testing.T) {
+	u, pool := testUsage()
+	var buf bytes.Buffer
+	require.NoError(t, printJSON(&buf, u, pool))
+	assert.JSONEq(t, `{
+		"total": 16106127360,
+		"used": 1073741824,
+		"pool": {
+			"serviceAccounts": 3,
+			"blacklisted": 1,
+			"dead": 0,
+			"uploadLeft": 1610612736000,
+			"withQuota": 2
+		}
+	}`, buf.String())
+}
@@ -3,8 +3,24 @@ package all
 
 import (
 	// Active commands
+	_ "github.com/ebadenes/eclone/cmd/about"
+	_ "github.com/ebadenes/eclone/cmd/batch"
+	_ "github.com/ebadenes/eclone/cmd/check"
+	_ "github.com/ebadenes/eclone/cmd/configmigrate"
 	_ "github.com/ebadenes/eclone/cmd/copy"
+	_ "github.com/ebadenes/eclone/cmd/fanout"
+	_ "github.com/ebadenes/eclone/cmd/history"
+	_ "github.com/ebadenes/eclone/cmd/manifest"
+	_ "github.com/ebadenes/eclone/cmd/migrate"
+	_ "github.com/ebadenes/eclone/cmd/move"
+	_ "github.com/ebadenes/eclone/cmd/rcd"
+	_ "github.com/ebadenes/eclone/cmd/rmdirs"
+	_ "github.com/ebadenes/eclone/cmd/scheduler"
 	_ "github.com/ebadenes/eclone/cmd/selfupdate"
+	_ "github.com/ebadenes/eclone/cmd/serve/s3"
+	_ "github.com/ebadenes/eclone/cmd/serve/sftp"
+	_ "github.com/ebadenes/eclone/cmd/serve/webdav"
+	_ "github.com/ebadenes/eclone/cmd/sync"
 	_ "github.com/ebadenes/eclone/cmd/version"
 	_ "github.com/rclone/rclone/cmd"
 	_ "github.com/rclone/rclone/cmd/about"
@@ -53,10 +69,8 @@ import (
 	_ "github.com/rclone/rclone/cmd/purge"
 	_ "github.com/rclone/rclone/cmd/rc"
 	_ "github.com/rclone/rclone/cmd/rcat"
-	_ "github.com/rclone/rclone/cmd/rcd"
 	_ "github.com/rclone/rclone/cmd/reveal"
 	_ "github.com/rclone/rclone/cmd/rmdir"
-	_ "github.com/rclone/rclone/cmd/rmdirs"
 	_ "github.com/rclone/rclone/cmd/serve"
 	_ "github.com/rclone/rclone/cmd/serve/dlna"
 	_ "github.com/rclone/rclone/cmd/serve/docker"
@@ -70,7 +84,6 @@ import (
 	_ "github.com/rclone/rclone/cmd/settier"
 	_ "github.com/rclone/rclone/cmd/sha1sum"
 	_ "github.com/rclone/rclone/cmd/size"
-	_ "github.com/rclone/rclone/cmd/sync"
 	_ "github.com/rclone/rclone/cmd/test"
 	_ "github.com/rclone/rclone/cmd/test/changenotify"
 	_ "github.com/rclone/rclone/cmd/test/histogram"
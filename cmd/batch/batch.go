@@ -0,0 +1,320 @@
+// Package batch provides the batch command.
+package batch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/ebadenes/eclone/cmd/jobrun"
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/sync"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	parallel    = 1
+	stopOnError = false
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	cmdFlags := commandDefinition.Flags()
+	flags.IntVarP(cmdFlags, &parallel, "parallel", "", parallel, "Number of jobs run at once (0 for all)", "")
+	flags.BoolVarP(cmdFlags, &stopOnError, "stop-on-error", "", stopOnError, "Don't start any more jobs once one has failed", "")
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "batch jobs.yaml",
+	Short: `Run the copy, sync and move jobs in the file given.`,
+	// Note: "|" will be replaced by backticks below
+	Long: strings.ReplaceAll(`Run the copy, sync and move jobs listed in the YAML file given, in this
+process, in the order given.
+
+    jobs:
+      - name: projects
+        op: move
+        src: gdrive:Projects
+        dst: gc:{id}/Projects
+        delete_empty_src_dirs: true
+      - name: photos
+        op: copy
+        src: gdrive:Photos
+        dst: gc:{id}/Photos
+        filters:
+          include: ["*.jpg", "*.png"]
+          max-age: 30d
+        flags:
+          transfers: 8
+          checksum: true
+      - op: sync
+        src: /data
+        dst: gc:{id}/data
+        create_empty_src_dirs: true
+
+|op| is |copy|, |sync| or |move|, and is |copy| if left out. A job with
+no |name| is named after its destination.
+
+|filters| and |flags| take the names of the filter and other global
+flags, with or without their leading |--|, and override the ones given
+on the command line for that job. Lists can be given as YAML lists.
+
+Each remote is created once, so jobs on the same remote share its
+service account pool, with its rotation state and blacklist, rather
+than each building its own and preloading it again.
+
+|--parallel| sets how many jobs run at once, one by default. Each job
+has its own stats and is retried on its own, up to |--retries| times,
+when it fails with errors which can be retried. A failed job doesn't
+stop the others unless |--stop-on-error| is given. A table of the
+bytes, files, checks and errors of each job is printed at the end, and
+the command fails if any job did.
+`, "|", "`"),
+	Annotations: map[string]string{
+		"groups": "Copy,Filter,Listing,Important",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		cmd.Run(false, false, command, func() error {
+			ctx := context.Background()
+			b, err := Load(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			results, err := b.Run(ctx, parallel, stopOnError)
+			jobrun.Print(os.Stdout, "JOB", results)
+			return err
+		})
+	},
+}
+
+// Job is a job of the jobs file.
+type Job struct {
+	Name               string         `yaml:"name"`
+	Op                 string         `yaml:"op"` // copy, sync or move
+	Src                string         `yaml:"src"`
+	Dst                string         `yaml:"dst"`
+	Filters            map[string]any `yaml:"filters"`
+	Flags              map[string]any `yaml:"flags"`
+	CreateEmptySrcDirs bool           `yaml:"create_empty_src_dirs"`
+	DeleteEmptySrcDirs bool           `yaml:"delete_empty_src_dirs"` // move only
+}
+
+// jobsFile is the format of the jobs file
+type jobsFile struct {
+	Jobs []Job `yaml:"jobs"`
+}
+
+// job is a job with its remotes and context
+type job struct {
+	Job
+	src fs.Fs
+	dst fs.Fs
+	ctx context.Context // with the filters, flags and stats group of the job
+}
+
+// Batch is a list of jobs to run.
+type Batch struct {
+	jobs []*job
+}
+
+// Load reads the jobs in the file at path and returns them as a Batch.
+func Load(ctx context.Context, path string) (*Batch, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jobs: %w", err)
+	}
+	var file jobsFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("failed to parse jobs %q: %w", path, err)
+	}
+	return New(ctx, file.Jobs)
+}
+
+// New checks jobs, creates their remotes, each once, and returns them
+// as a Batch.
+func New(ctx context.Context, jobs []Job) (*Batch, error) {
+	b := &Batch{}
+	names := map[string]bool{}
+	for i, j := range jobs {
+		if j.Src == "" || j.Dst == "" {
+			return nil, fmt.Errorf("job %d: src and dst must be set", i+1)
+		}
+		if j.Name == "" {
+			j.Name = j.Dst
+		}
+		if names[j.Name] {
+			return nil, fmt.Errorf("job %q: duplicate name", j.Name)
+		}
+		names[j.Name] = true
+		if j.Op == "" {
+			j.Op = "copy"
+		}
+		if !slices.Contains([]string{"copy", "sync", "move"}, j.Op) {
+			return nil, fmt.Errorf("job %q: unknown op %q", j.Name, j.Op)
+		}
+		if j.DeleteEmptySrcDirs && j.Op != "move" {
+			return nil, fmt.Errorf("job %q: delete_empty_src_dirs can only be used with move", j.Name)
+		}
+		jobCtx, err := jobContext(ctx, j)
+		if err != nil {
+			return nil, fmt.Errorf("job %q: %w", j.Name, err)
+		}
+		b.jobs = append(b.jobs, &job{Job: j, ctx: jobCtx})
+	}
+	if len(b.jobs) == 0 {
+		return nil, errors.New("no jobs")
+	}
+	remotes := map[string]fs.Fs{}
+	for _, j := range b.jobs {
+		for _, remote := range []string{j.Src, j.Dst} {
+			if _, ok := remotes[remote]; ok {
+				continue
+			}
+			f, err := cache.Get(ctx, remote)
+			if errors.Is(err, fs.ErrorIsFile) {
+				return nil, fmt.Errorf("job %q: %q is a file, not a directory", j.Name, remote)
+			} else if err != nil {
+				return nil, fmt.Errorf("job %q: %w", j.Name, err)
+			}
+			// Kept for the life of the batch so the jobs share it
+			cache.Pin(f)
+			remotes[remote] = f
+		}
+		j.src, j.dst = remotes[j.Src], remotes[j.Dst]
+	}
+	return b, nil
+}
+
+// jobContext returns ctx with the filters and flags of j and a stats
+// group of its own.
+func jobContext(ctx context.Context, j Job) (context.Context, error) {
+	if len(j.Flags) > 0 {
+		var ci *fs.ConfigInfo
+		ctx, ci = fs.AddConfig(ctx)
+		if err := setOptions(j.Flags, ci); err != nil {
+			return nil, fmt.Errorf("flags: %w", err)
+		}
+	}
+	if len(j.Filters) > 0 {
+		opt := filter.GetConfig(ctx).Opt
+		if err := setOptions(j.Filters, &opt); err != nil {
+			return nil, fmt.Errorf("filters: %w", err)
+		}
+		fi, err := filter.NewFilter(&opt)
+		if err != nil {
+			return nil, fmt.Errorf("filters: %w", err)
+		}
+		ctx = filter.ReplaceConfig(ctx, fi)
+	}
+	return accounting.WithStatsGroup(ctx, "batch/"+j.Name), nil
+}
+
+// setOptions sets the fields of opt named by the flag names in values,
+// failing on names opt doesn't have.
+func setOptions(values map[string]any, opt any) error {
+	items, err := configstruct.Items(opt)
+	if err != nil {
+		return err
+	}
+	config := make(map[string]any, len(values))
+	for name, value := range values {
+		key := strings.ReplaceAll(strings.TrimPrefix(name, "--"), "-", "_")
+		if !slices.ContainsFunc(items, func(item configstruct.Item) bool { return item.Name == key }) {
+			return fmt.Errorf("unknown flag %q", name)
+		}
+		if list, ok := value.([]any); ok {
+			strs := make([]string, len(list))
+			for i, v := range list {
+				strs[i] = fmt.Sprint(v)
+			}
+			value = strs
+		}
+		config[key] = value
+	}
+	return configstruct.SetAny(config, opt)
+}
+
+// Run runs the jobs in order, parallel at a time, and returns their
+// results in the order given, failing if any job did. With stopOnError
+// no more jobs are started once one has failed.
+func (b *Batch) Run(ctx context.Context, parallel int, stopOnError bool) ([]jobrun.Result, error) {
+	if parallel <= 0 || parallel > len(b.jobs) {
+		parallel = len(b.jobs)
+	}
+	results := make([]jobrun.Result, len(b.jobs))
+	var (
+		wg     gosync.WaitGroup
+		mu     gosync.Mutex // protects failed
+		failed bool
+	)
+	slots := make(chan struct{}, parallel)
+	for i, j := range b.jobs {
+		slots <- struct{}{}
+		mu.Lock()
+		stop := failed && stopOnError
+		mu.Unlock()
+		if stop || ctx.Err() != nil {
+			<-slots
+			results[i] = jobrun.Result{Name: j.Name, Op: j.Op, Err: jobrun.ErrNotStarted}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i] = j.run(ctx)
+			if results[i].Err != nil {
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if nFailed := jobrun.Failed(results); nFailed > 0 {
+		return results, fmt.Errorf("%d of %d jobs failed", nFailed, len(results))
+	}
+	return results, nil
+}
+
+// run runs j, retrying it as cmd.Run would, and cancelled with ctx.
+func (j *job) run(ctx context.Context) jobrun.Result {
+	jobCtx, cancel := context.WithCancel(j.ctx)
+	defer cancel()
+	stopCancel := context.AfterFunc(ctx, cancel)
+	defer stopCancel()
+	fs.Logf(nil, "Batch: starting %s %s: %s -> %s", j.Op, j.Name, j.Src, j.Dst)
+	result := jobrun.Run(jobCtx, j.Name, "Batch: "+j.Name, func(ctx context.Context) error {
+		switch j.Op {
+		case "sync":
+			return sync.Sync(ctx, j.dst, j.src, j.CreateEmptySrcDirs)
+		case "move":
+			return sync.MoveDir(ctx, j.dst, j.src, j.DeleteEmptySrcDirs, j.CreateEmptySrcDirs)
+		}
+		return sync.CopyDir(ctx, j.dst, j.src, j.CreateEmptySrcDirs)
+	})
+	result.Op = j.Op
+	if result.Err != nil {
+		fs.Errorf(nil, "Batch: %s failed after %v: %v", j.Name, result.Duration.Round(time.Second), result.Err)
+	} else {
+		fs.Logf(nil, "Batch: %s finished in %v: %v, %d files, %d checks", j.Name, result.Duration.Round(time.Second), fs.SizeSuffix(result.Bytes), result.Transfers, result.Checks)
+	}
+	return result
+}
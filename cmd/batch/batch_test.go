@@ -0,0 +1,150 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ebadenes/eclone/cmd/jobrun"
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// write makes file in dir with content
+func write(t *testing.T, dir, file, content string) {
+	t.Helper()
+	file = filepath.Join(dir, file)
+	require.NoError(t, os.MkdirAll(filepath.Dir(file), 0777))
+	require.NoError(t, os.WriteFile(file, []byte(content), 0666))
+}
+
+func TestNew(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	write(t, dir, "file.txt", "x")
+	for _, bad := range [][]Job{
+		nil,
+		{{Src: dir}},
+		{{Src: dir, Dst: dir + "/a"}, {Src: dir, Dst: dir + "/a"}},
+		{{Op: "delete", Src: dir, Dst: dir + "/a"}},
+		{{Op: "copy", Src: dir, Dst: dir + "/a", DeleteEmptySrcDirs: true}},
+		{{Src: dir, Dst: dir + "/a", Flags: map[string]any{"no-such-flag": true}}},
+		{{Src: dir, Dst: dir + "/a", Filters: map[string]any{"transfers": 4}}},
+		{{Src: dir, Dst: dir + "/a", Flags: map[string]any{"transfers": "many"}}},
+		{{Src: filepath.Join(dir, "file.txt"), Dst: dir + "/a"}},
+	} {
+		_, err := New(ctx, bad)
+		assert.Error(t, err, bad)
+	}
+
+	b, err := New(ctx, []Job{
+		{Name: "one", Src: dir, Dst: dir + "/a", Flags: map[string]any{"--transfers": 7, "dry-run": true}},
+		{Src: dir, Dst: dir + "/b", Filters: map[string]any{"include": []any{"*.txt", "*.md"}, "max_size": "1M"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, b.jobs, 2)
+	one, two := b.jobs[0], b.jobs[1]
+	assert.Equal(t, "copy", one.Op)
+	assert.Equal(t, dir+"/b", two.Name)
+	assert.Same(t, one.src, two.src)
+	ci := fs.GetConfig(one.ctx)
+	assert.Equal(t, 7, ci.Transfers)
+	assert.True(t, ci.DryRun)
+	assert.False(t, fs.GetConfig(ctx).DryRun)
+	opt := filter.GetConfig(two.ctx).Opt
+	assert.Equal(t, []string{"*.txt", "*.md"}, opt.IncludeRule)
+	assert.Equal(t, fs.SizeSuffix(1<<20), opt.MaxSize)
+	assert.True(t, filter.GetConfig(one.ctx).InActive())
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	write(t, root, "src/a.txt", "aaa")
+	write(t, root, "src/b.jpg", "bb")
+	write(t, root, "move/c.txt", "c")
+	write(t, root, "synced/extra.txt", "extra")
+	path := filepath.Join(root, "jobs.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf(`jobs:
+  - name: run-copy
+    src: %[1]s/src
+    dst: %[1]s/copied
+    filters:
+      include: ["*.txt"]
+  - name: run-sync
+    op: sync
+    src: %[1]s/src
+    dst: %[1]s/synced
+  - name: run-move
+    op: move
+    src: %[1]s/move
+    dst: %[1]s/moved
+    delete_empty_src_dirs: true
+`, root)), 0600))
+	b, err := Load(ctx, path)
+	require.NoError(t, err)
+	results, err := b.Run(ctx, 1, false)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+
+	assert.FileExists(t, filepath.Join(root, "copied", "a.txt"))
+	assert.NoFileExists(t, filepath.Join(root, "copied", "b.jpg"))
+	assert.Equal(t, int64(1), results[0].Transfers)
+	assert.FileExists(t, filepath.Join(root, "synced", "b.jpg"))
+	assert.NoFileExists(t, filepath.Join(root, "synced", "extra.txt"))
+	assert.Equal(t, int64(1), results[1].Deletes)
+	assert.FileExists(t, filepath.Join(root, "moved", "c.txt"))
+	assert.NoDirExists(t, filepath.Join(root, "move"))
+	assert.Equal(t, "move", results[2].Op)
+
+	var out bytes.Buffer
+	jobrun.Print(&out, "JOB", results)
+	assert.Regexp(t, `run-copy +copy +3 +1 +0 +0 +0 +0s +ok`, out.String())
+	assert.Regexp(t, `TOTAL +8 +3 +1 +1 +0 +3 of 3 ok`, out.String())
+
+	// Unknown fields are errors
+	require.NoError(t, os.WriteFile(path, []byte("jobs:\n  - src: a\n    dest: b\n"), 0600))
+	_, err = Load(ctx, path)
+	assert.ErrorContains(t, err, "dest")
+}
+
+func TestStopOnError(t *testing.T) {
+	ctx, ci := fs.AddConfig(context.Background())
+	ci.Retries = 1
+	accounting.Start(ctx) // count the errors
+	root := t.TempDir()
+	write(t, root, "src/a.txt", "a")
+	jobs := []Job{
+		{Name: "stop-bad", Src: filepath.Join(root, "missing"), Dst: filepath.Join(root, "dst1")},
+		{Name: "stop-ok", Src: filepath.Join(root, "src"), Dst: filepath.Join(root, "dst2")},
+	}
+	b, err := New(ctx, jobs)
+	require.NoError(t, err)
+	results, err := b.Run(ctx, 1, true)
+	assert.EqualError(t, err, "2 of 2 jobs failed")
+	assert.Error(t, results[0].Err)
+	assert.Equal(t, jobrun.ErrNotStarted, results[1].Err)
+	assert.NoDirExists(t, filepath.Join(root, "dst2"))
+
+	// Without --stop-on-error the rest carry on
+	jobs[1].Name = "carry-on-ok"
+	jobs[0].Name = "carry-on-bad"
+	b, err = New(ctx, jobs)
+	require.NoError(t, err)
+	results, err = b.Run(ctx, 0, false)
+	assert.EqualError(t, err, "1 of 2 jobs failed")
+	assert.NoError(t, results[1].Err)
+	assert.FileExists(t, filepath.Join(root, "dst2", "a.txt"))
+
+	var out bytes.Buffer
+	jobrun.Print(&out, "JOB", results)
+	assert.Contains(t, out.String(), "failed: ")
+	assert.Contains(t, out.String(), "1 of 2 ok")
+}
@@ -0,0 +1,120 @@
+// Package check makes the check command compare crypt remotes over drive
+// remotes using the plaintext checksums recorded with checksum_db.
+//
+// The check command is rclone's, as cryptcheck and others share its
+// flags. This replaces what it runs, when the source or destination is
+// such a crypt remote and neither --download nor --checkfile is given,
+// with a check comparing MD5s which are looked up in the database for
+// crypt files, so neither side is downloaded.
+package check
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ebadenes/eclone/backend/drive"
+	"github.com/rclone/rclone/backend/crypt"
+	"github.com/rclone/rclone/cmd"
+	rcheck "github.com/rclone/rclone/cmd/check"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/spf13/cobra"
+)
+
+// help is added to the help of the check command
+// Note: "|" will be replaced by backticks below
+var help = strings.ReplaceAll(`
+If the source or the destination is a crypt remote over a drive remote
+with |checksum_db| set, the MD5s of the crypt files are looked up in
+the database, which records the MD5 of the plaintext of every file
+uploaded through crypt, and compared with those of the other side, so
+nothing is downloaded. Files with no record, or changed since theirs,
+count as having no hash.
+`, "|", "`")
+
+func init() {
+	command, _, err := cmd.Root.Find([]string{"check"})
+	if err != nil || command.Name() != "check" {
+		panic("check command not found")
+	}
+	command.Long += help
+	runE := command.RunE
+	command.RunE = func(command *cobra.Command, args []string) error {
+		download, _ := command.Flags().GetBool("download")
+		checkFile, _ := command.Flags().GetString("checkfile")
+		if download || checkFile != "" {
+			return runE(command, args)
+		}
+		cmd.CheckArgs(2, 2, command, args)
+		fsrc, fdst := cmd.NewFsSrcDst(args)
+		if !hasChecksums(fsrc) && !hasChecksums(fdst) {
+			return runE(command, args)
+		}
+		cmd.Run(false, true, command, func() error {
+			return Check(context.Background(), fdst, fsrc)
+		})
+		return nil
+	}
+}
+
+// hasChecksums returns true if f is a crypt remote over a drive remote
+// with checksum_db set.
+func hasChecksums(f fs.Fs) bool {
+	cf, ok := f.(*crypt.Fs)
+	if !ok {
+		return false
+	}
+	df, ok := cf.UnWrap().(*drive.Fs)
+	return ok && df.HasChecksums()
+}
+
+// Check checks the files in fsrc and fdst match, with the check flags,
+// comparing the MD5s recorded for crypt files.
+func Check(ctx context.Context, fdst, fsrc fs.Fs) error {
+	opt, close, err := rcheck.GetCheckOpt(fsrc, fdst)
+	if err != nil {
+		return err
+	}
+	defer close()
+	fs.Infof(nil, "Using MD5 for hash comparisons, from the checksum database for crypt files")
+	opt.Check = func(ctx context.Context, dst, src fs.Object) (differ bool, noHash bool, err error) {
+		srcHash, err := md5Of(ctx, src)
+		if err != nil {
+			return true, false, err
+		}
+		dstHash, err := md5Of(ctx, dst)
+		if err != nil {
+			return true, false, err
+		}
+		if srcHash == "" || dstHash == "" {
+			return false, true, nil
+		}
+		if srcHash != dstHash {
+			err = fmt.Errorf("md5 differ (%v) %q vs (%v) %q", fsrc, srcHash, fdst, dstHash)
+			fs.Errorf(src, "%v", err)
+			return true, false, nil
+		}
+		return false, false, nil
+	}
+	return operations.CheckFn(ctx, opt)
+}
+
+// md5Of returns the MD5 of o, from the checksum database if it is a crypt
+// file, or "" if it has none.
+func md5Of(ctx context.Context, o fs.Object) (string, error) {
+	if co, ok := o.(*crypt.Object); ok {
+		md5, err := drive.PlaintextMD5(co.UnWrap())
+		if err != nil {
+			return "", fmt.Errorf("failed to look up the checksum of %v: %w", o, err)
+		}
+		return md5, nil
+	}
+	md5, err := o.Hash(ctx, hash.MD5)
+	if errors.Is(err, hash.ErrUnsupported) {
+		return "", nil
+	}
+	return md5, err
+}
@@ -0,0 +1,34 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/crypt"
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHasChecksums(t *testing.T) {
+	ctx := context.Background()
+	local, err := fs.NewFs(ctx, t.TempDir())
+	require.NoError(t, err)
+	assert.False(t, hasChecksums(local))
+	crypt, err := fs.NewFs(ctx, fmt.Sprintf(":crypt,remote=%q,password=%s:", t.TempDir(), obscure.MustObscure("secret")))
+	require.NoError(t, err)
+	assert.False(t, hasChecksums(crypt))
+}
+
+func TestMD5Of(t *testing.T) {
+	ctx := context.Background()
+	o := object.NewMemoryObject("file.txt", time.Now(), []byte("hello"))
+	md5, err := md5Of(ctx, o)
+	require.NoError(t, err)
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", md5)
+}
@@ -0,0 +1,175 @@
+// Package configmigrate provides the config migrate command.
+package configmigrate
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rclone/rclone/cmd"
+	_ "github.com/rclone/rclone/cmd/config" // make sure the config command exists
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	configCommand, _, err := cmd.Root.Find([]string{"config"})
+	if err != nil {
+		fs.Fatalf(nil, "config command not found: %v", err)
+	}
+	configCommand.AddCommand(commandDefinition)
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "migrate [source.conf] [dest.conf]",
+	Short: `Convert a gclone or fclone config file for use with eclone.`,
+	// Note: "|" will be replaced by backticks below
+	Long: strings.ReplaceAll(`
+Read a config file written for gclone or fclone and write it for use
+with eclone, reporting the service account options found in its drive
+remotes.
+
+gclone and fclone name the service account options of a drive remote
+|service_account_file|, |service_account_file_path|, |rolling_sa|,
+|rolling_count| and |random_pick_sa|, which eclone reads under the same
+names, so these are kept as they are. Everything else, including
+comments and other remotes, is copied unchanged.
+
+If source.conf isn't given the current config file is read. The
+result is written to dest.conf, or to standard output if it isn't given.
+
+    eclone config migrate ~/.config/rclone/gclone.conf ~/.config/rclone/rclone.conf
+`, "|", "`"),
+	RunE: func(command *cobra.Command, args []string) error {
+		cmd.CheckArgs(0, 2, command, args)
+		source := config.GetConfigPath()
+		if len(args) > 0 {
+			source = args[0]
+		}
+		in, err := os.ReadFile(source)
+		if err != nil {
+			return fmt.Errorf("failed to read config: %w", err)
+		}
+		var out bytes.Buffer
+		changes, err := Migrate(bytes.NewReader(in), &out)
+		if err != nil {
+			return err
+		}
+		for _, change := range changes {
+			fs.Logf(nil, "%s", change)
+		}
+		if len(changes) == 0 {
+			fs.Logf(nil, "No gclone or fclone service account options found in the drive remotes of %q", source)
+		}
+		if len(args) < 2 {
+			_, err = os.Stdout.Write(out.Bytes())
+			return err
+		}
+		if _, err := os.Stat(args[1]); err == nil && args[1] != source {
+			return fmt.Errorf("%q already exists - remove it first or write to a new file", args[1])
+		}
+		return os.WriteFile(args[1], out.Bytes(), 0600)
+	},
+}
+
+// saOptions are the SA options of the drive remotes of gclone and fclone
+// configs, as in
+//
+//	[gc]
+//	type = drive
+//	service_account_file = /root/accounts/1.json
+//	service_account_file_path = /root/accounts/
+//	rolling_sa = true
+//
+// eclone reads them under the same names, so they are kept as they are.
+var saOptions = map[string]struct{}{
+	"service_account_file":      {},
+	"service_account_file_path": {},
+	"rolling_sa":                {},
+	"rolling_count":             {},
+	"random_pick_sa":            {},
+}
+
+// Change describes one SA option found by Migrate.
+type Change struct {
+	Remote string
+	Option string
+}
+
+// String describes the change for logging
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %q is read by eclone as it is", c.Remote, c.Option)
+}
+
+// parseLine splits an INI line into a section name, or a key
+func parseLine(line string) (section, key string) {
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+		return trimmed[1 : len(trimmed)-1], ""
+	}
+	if trimmed == "" || trimmed[0] == '#' || trimmed[0] == ';' {
+		return "", ""
+	}
+	key, _, ok := strings.Cut(trimmed, "=")
+	if !ok {
+		return "", ""
+	}
+	return "", strings.TrimSpace(key)
+}
+
+// Migrate copies the config in in to out with the SA options of the
+// drive remotes under their eclone names, returning those found.
+func Migrate(in io.Reader, out io.Writer) (changes []Change, err error) {
+	var lines []string
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "RCLONE_ENCRYPT_") {
+		return nil, errors.New("config is encrypted - decrypt it with \"config encryption remove\" first")
+	}
+
+	// First pass - find the drive remotes
+	isDrive := map[string]bool{}
+	section := ""
+	for _, line := range lines {
+		name, key := parseLine(line)
+		switch {
+		case name != "":
+			section = name
+		case key == "type" && section != "":
+			_, value, _ := strings.Cut(line, "=")
+			isDrive[section] = strings.TrimSpace(value) == "drive"
+		}
+	}
+
+	// Second pass - copy the config finding the SA options
+	section = ""
+	w := bufio.NewWriter(out)
+	for _, line := range lines {
+		name, key := parseLine(line)
+		if name != "" {
+			section = name
+		}
+		if key != "" && isDrive[section] {
+			if _, ok := saOptions[key]; ok {
+				changes = append(changes, Change{Remote: section, Option: key})
+			}
+		}
+		if _, err = w.WriteString(line + "\n"); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Remote < changes[j].Remote })
+	return changes, w.Flush()
+}
@@ -0,0 +1,45 @@
+package configmigrate
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate(t *testing.T) {
+	// A gclone remote as in its README and an fclone one with rolling
+	in, err := os.ReadFile("testdata/gclone.conf")
+	require.NoError(t, err)
+	var out bytes.Buffer
+	changes, err := Migrate(bytes.NewReader(in), &out)
+	require.NoError(t, err)
+	assert.Equal(t, string(in), out.String())
+	assert.Equal(t, []Change{
+		{Remote: "fc", Option: "service_account_file"},
+		{Remote: "fc", Option: "service_account_file_path"},
+		{Remote: "fc", Option: "rolling_sa"},
+		{Remote: "fc", Option: "rolling_count"},
+		{Remote: "fc", Option: "random_pick_sa"},
+		{Remote: "gc", Option: "service_account_file"},
+		{Remote: "gc", Option: "service_account_file_path"},
+	}, changes)
+	assert.Equal(t, `gc: "rolling_sa" is read by eclone as it is`, Change{Remote: "gc", Option: "rolling_sa"}.String())
+}
+
+func TestMigrateNotDrive(t *testing.T) {
+	in := "[s3]\nservice_account_file_path = untouched\ntype = s3\n"
+	var out bytes.Buffer
+	changes, err := Migrate(strings.NewReader(in), &out)
+	require.NoError(t, err)
+	assert.Equal(t, in, out.String())
+	assert.Empty(t, changes)
+}
+
+func TestMigrateEncrypted(t *testing.T) {
+	_, err := Migrate(strings.NewReader("RCLONE_ENCRYPT_V0:\nabc\n"), &bytes.Buffer{})
+	assert.ErrorContains(t, err, "encrypted")
+}
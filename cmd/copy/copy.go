@@ -3,9 +3,22 @@ package copy
 
 import (
 	"context"
+	"os"
 	"strings"
 
+	"github.com/ebadenes/eclone/cmd/cryptcopy"
+	"github.com/ebadenes/eclone/cmd/estimate"
+	"github.com/ebadenes/eclone/cmd/hooks"
+	"github.com/ebadenes/eclone/cmd/notify"
+	"github.com/ebadenes/eclone/cmd/orderby"
+	"github.com/ebadenes/eclone/cmd/publish"
+	"github.com/ebadenes/eclone/cmd/quotaretry"
+	"github.com/ebadenes/eclone/cmd/report"
+	"github.com/ebadenes/eclone/cmd/resume"
+	"github.com/ebadenes/eclone/cmd/revision"
+	"github.com/ebadenes/eclone/cmd/verify"
 	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/config/flags"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/fs/operations/operationsflags"
@@ -17,12 +30,32 @@ var (
 	createEmptySrcDirs = false
 	loggerOpt          = operations.LoggerOpt{}
 	loggerFlagsOpt     = operationsflags.AddLoggerFlagsOptions{}
+	quotaRetryOpt      = quotaretry.Options{}
+	publishDst         = false
+	reportFile         = ""
+	estimateOnly       = false
+	capacityOpt        = estimate.Options{}
+	notifyOpt          = notify.Options{}
+	hooksOpt           = hooks.Options{}
+	resumeOpt          = resume.Options{Grace: resume.DefaultGrace}
+	verifyAfter        = false
+	compareRevision    = false
 )
 
 func init() {
 	cmd.Root.AddCommand(commandDefinition)
 	cmdFlags := commandDefinition.Flags()
 	flags.BoolVarP(cmdFlags, &createEmptySrcDirs, "create-empty-src-dirs", "", createEmptySrcDirs, "Create empty source dirs on destination after copy", "")
+	quotaretry.AddFlags(cmdFlags, &quotaRetryOpt)
+	flags.BoolVarP(cmdFlags, &publishDst, "publish", "", publishDst, "Copy into a hidden folder and swap it in for the destination when done", "")
+	flags.StringVarP(cmdFlags, &reportFile, "report-file", "", reportFile, "Write a JSON summary of the run to this file", "")
+	notify.AddFlags(cmdFlags, &notifyOpt)
+	hooks.AddFlags(cmdFlags, &hooksOpt)
+	resume.AddFlags(cmdFlags, &resumeOpt)
+	flags.BoolVarP(cmdFlags, &verifyAfter, "verify-after", "", verifyAfter, "Compare the hashes of source and destination after the copy, copying files which differ again", "")
+	flags.BoolVarP(cmdFlags, &compareRevision, "compare-revision", "", compareRevision, "Compare files between drive remotes by the Drive revision of the source instead of size and modification time", "")
+	flags.BoolVarP(cmdFlags, &estimateOnly, "estimate", "", estimateOnly, "Size the source and report the service accounts and days it needs, without transferring", "")
+	estimate.AddFlags(cmdFlags, &capacityOpt)
 	operationsflags.AddLoggerFlags(cmdFlags, &loggerOpt, &loggerFlagsOpt)
 	loggerOpt.LoggerFn = operations.NewDefaultLoggerFn(&loggerOpt)
 }
@@ -96,7 +129,56 @@ for more info.
 
 **Note**: Use the |--dry-run| or the |--interactive|/|-i| flag to test without copying anything.
 
-`, "|", "`") + operationsflags.Help(),
+With |--order-by quota| files are ordered by size, and the share of
+transfers taking the largest files follows the share of the
+destination's service accounts which still have quota. A fresh pool
+moves the big files first, while they can still complete, and small
+files are left for when it thins out. The order is picked as each pass
+starts.
+
+With |--publish| readers of the destination never see a half finished
+copy. The destination is copied server side into a hidden
+|.DEST.publish| folder beside it, the copy goes there, and once it has
+succeeded the destination is moved aside, the new folder moved into its
+place and the old one purged. Between the two moves the destination is
+briefly missing; if the second fails the old folder is moved back. A
+failed copy leaves |.DEST.publish| for
+the next run to carry on with. The published folder is a new folder, so
+links to and shares of the old one don't carry over.
+
+With |--report-file| a JSON summary of the run is written to the file
+given at the end of each attempt: when it ran, the files transferred,
+skipped and failed, with the error of each failure, and the bytes
+uploaded and rate limits hit by each service account.
+
+With |--estimate| nothing is transferred. The source is sized, with the
+filters given, and the number of service accounts it needs at 750 GiB
+a day each is printed, along with the pool of the destination: whether
+the transfer fits in the quota left today and how many days it takes
+otherwise. Files already at the destination are counted too.
+
+With |--verify-after| the hashes of the source and the destination are
+compared once the copy has succeeded, using the MD5s Drive keeps so
+nothing is downloaded. Files which differ are copied again, once, and
+fail the copy if they still differ.
+
+Between two crypt remotes over drive remotes with the same password and
+salt, files are copied server side without being decrypted and
+encrypted again, even though the remotes are configured separately.
+Files the destination's drive remote can't read are copied the usual
+way.
+
+With |--compare-revision|, between drive remotes, the revision Drive
+gives the content of each source file is recorded on its copy, and
+files are compared by it instead of by size and modification time: a
+copy whose source still has the revision recorded is left alone, even
+if its modification time differs, and one whose source has a new
+revision is copied again, even if it kept its size and modification
+time. Copies without a revision recorded but with the MD5 of their
+source get it recorded without being copied; other files are compared
+as usual and get theirs recorded on the next run.
+
+`, "|", "`") + notify.Help() + "\n" + hooks.Help() + "\n" + resume.Help() + "\n" + quotaretry.Help() + "\n" + estimate.Help() + "\n" + operationsflags.Help(),
 	Annotations: map[string]string{
 		"groups": "Copy,Filter,Listing,Important",
 	},
@@ -106,6 +188,31 @@ for more info.
 		if len(fsrc.Root()) > 7 && fsrc.Root()[0:7] == "isFile:" {
 			srcFileName = fsrc.Root()[7:]
 		}
+		if estimateOnly {
+			cmd.Run(false, false, command, func() error {
+				return estimate.Estimate(context.Background(), os.Stdout, fsrc, srcFileName, fdst)
+			})
+			return
+		}
+		if publishDst && srcFileName != "" {
+			fs.Fatalf(nil, "--publish can only be used to copy a directory")
+		}
+		if compareRevision && srcFileName != "" {
+			fs.Fatalf(nil, "--compare-revision can only be used to copy a directory")
+		}
+		if err := estimate.Check(context.Background(), &capacityOpt, fsrc, srcFileName, fdst); err != nil {
+			fs.Fatalf(nil, "%v", err)
+		}
+		run := report.New(reportFile, "copy", fsrc, fdst)
+		resumer, err := resume.New(&resumeOpt, "copy", fsrc, fdst)
+		if err != nil {
+			fs.Fatalf(nil, "%v", err)
+		}
+		notifier, err := notify.New(context.Background(), &notifyOpt, "copy", fsrc, fdst)
+		if err != nil {
+			fs.Fatalf(nil, "%v", err)
+		}
+		hooker := hooks.New(&hooksOpt, "copy", fsrc, fdst)
 		cmd.Run(true, true, command, func() error {
 			ctx := context.Background()
 			close, err := operationsflags.ConfigureLoggers(ctx, fdst, command, &loggerOpt, loggerFlagsOpt)
@@ -117,11 +224,46 @@ for more info.
 			if loggerFlagsOpt.AnySet() {
 				ctx = operations.WithSyncLogger(ctx, loggerOpt)
 			}
+			run.Start(ctx)
+			ctx = resumer.Start(ctx)
+			notifier.Start(ctx)
+			if err = hooker.Start(ctx); err != nil {
+				return notifier.Finish(ctx, run.Finish(ctx, resumer.Finish(err)))
+			}
 
-			if srcFileName == "" {
-				return sync.CopyDir(ctx, fdst, fsrc, createEmptySrcDirs)
+			transfer := func(ctx context.Context, fdst fs.Fs) (err error) {
+				cryptcopy.Enable(fdst, fsrc)
+				copyCtx := ctx
+				if compareRevision {
+					if copyCtx, err = revision.Compare(ctx, fdst, fsrc); err != nil {
+						return err
+					}
+				}
+				copyFn := func(ctx context.Context) error {
+					ctx = orderby.Resolve(ctx, fdst)
+					if srcFileName == "" {
+						return sync.CopyDir(ctx, fdst, fsrc, createEmptySrcDirs)
+					}
+					return operations.CopyFile(ctx, fdst, fsrc, srcFileName, srcFileName)
+				}
+				err = quotaretry.Run(copyCtx, &quotaRetryOpt, srcFileName, copyFn, func(ctx context.Context, files []string) error {
+					ctx, err := quotaretry.Only(ctx, files)
+					if err != nil {
+						return err
+					}
+					return copyFn(ctx)
+				})
+				if err == nil && verifyAfter {
+					err = verify.Verify(ctx, fdst, fsrc, srcFileName)
+				}
+				return err
+			}
+			if publishDst {
+				err = publish.Publish(ctx, fdst, transfer)
+			} else {
+				err = transfer(ctx, fdst)
 			}
-			return operations.CopyFile(ctx, fdst, fsrc, srcFileName, srcFileName)
+			return notifier.Finish(ctx, run.Finish(ctx, resumer.Finish(hooker.Finish(ctx, err))))
 		})
 	},
 }
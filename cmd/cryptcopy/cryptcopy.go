@@ -0,0 +1,136 @@
+// Package cryptcopy lets copy and sync copy server side between crypt
+// remotes which share their keys.
+//
+// Two crypt remotes over drive remotes which were set up with the same
+// password and salt encrypt file contents identically, so a file of one
+// can be copied to the other server side as it is, leaving only its name
+// to be encrypted again. rclone only does that within one crypt remote,
+// or between any two with --server-side-across-configs, which would be
+// wrong for remotes with different keys, so each file was downloaded,
+// decrypted, encrypted again and uploaded.
+//
+// The keys are compared by encrypting a block with the source's cipher
+// and decrypting it with the destination's. The copies are made by the
+// destination's drive remote, so they rotate its service accounts as
+// usual, and files it can't read fall back to an ordinary copy.
+package cryptcopy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+
+	"github.com/ebadenes/eclone/backend/drive"
+	"github.com/rclone/rclone/backend/crypt"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"google.golang.org/api/googleapi"
+)
+
+// probe is the block encrypted to compare the keys
+var probe = []byte("eclone crypt key check")
+
+// Enable lets fdst copy from fsrc server side if both are crypt remotes
+// over drive remotes with the same keys. It does nothing otherwise.
+func Enable(fdst, fsrc fs.Fs) {
+	if !wrapsDrive(fdst) || !wrapsDrive(fsrc) || operations.SameConfig(fdst, fsrc) {
+		return
+	}
+	features := fdst.Features()
+	if features.Copy == nil || features.ServerSideAcrossConfigs {
+		return
+	}
+	same, err := sameKeys(fdst, fsrc)
+	if err != nil {
+		fs.Debugf(fdst, "Can't compare the keys of %v with its own: %v", fsrc, err)
+		return
+	}
+	if !same {
+		return
+	}
+	fs.Infof(fdst, "Copying server side from %v as they share their keys", fsrc)
+	features.ServerSideAcrossConfigs = true
+	features.Copy = fallback(fdst, features.Copy)
+}
+
+// wrapsDrive returns true if f is a crypt remote over a drive remote.
+func wrapsDrive(f fs.Fs) bool {
+	cf, ok := f.(*crypt.Fs)
+	if !ok {
+		return false
+	}
+	_, ok = cf.UnWrap().(*drive.Fs)
+	return ok
+}
+
+// cipher returns the cipher f was configured with.
+func cipher(f fs.Fs) (*crypt.Cipher, error) {
+	_, _, _, config, err := fs.ConfigFs(fs.ConfigStringFull(f))
+	if err != nil {
+		return nil, err
+	}
+	return crypt.NewCipher(config)
+}
+
+// sameKeys returns true if the crypt remotes fdst and fsrc encrypt file
+// contents with the same key.
+func sameKeys(fdst, fsrc fs.Fs) (bool, error) {
+	src, err := cipher(fsrc)
+	if err != nil {
+		return false, err
+	}
+	dst, err := cipher(fdst)
+	if err != nil {
+		return false, err
+	}
+	in, err := src.EncryptData(bytes.NewReader(probe))
+	if err != nil {
+		return false, err
+	}
+	encrypted, err := io.ReadAll(in)
+	if err != nil {
+		return false, err
+	}
+	out, err := dst.DecryptData(io.NopCloser(bytes.NewReader(encrypted)))
+	if err != nil {
+		return false, nil
+	}
+	decrypted, err := io.ReadAll(out)
+	if err != nil {
+		return false, nil
+	}
+	return bytes.Equal(decrypted, probe), nil
+}
+
+// fallback wraps the Copy of fdst so files from another remote which its
+// drive remote can't read are copied the ordinary way instead.
+func fallback(fdst fs.Fs, copyFn func(ctx context.Context, src fs.Object, remote string) (fs.Object, error)) func(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	return func(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+		dst, err := copyFn(ctx, src, remote)
+		if err != nil && !operations.SameConfig(src.Fs(), fdst) && cantRead(err) {
+			fs.Debugf(src, "Can't copy server side, copying it instead: %v", err)
+			return nil, fs.ErrorCantCopy
+		}
+		return dst, err
+	}
+}
+
+// cantRead returns true if err says the drive remote can't read the file
+// it was copying.
+func cantRead(err error) bool {
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) {
+		return false
+	}
+	if gerr.Code == 404 {
+		return true
+	}
+	for _, item := range gerr.Errors {
+		switch item.Reason {
+		case "insufficientFilePermissions", "cannotCopyFile":
+			return true
+		}
+	}
+	return false
+}
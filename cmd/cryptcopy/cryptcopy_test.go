@@ -0,0 +1,56 @@
+package cryptcopy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/crypt"
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+)
+
+// newCrypt returns a crypt remote over a temporary directory.
+func newCrypt(t *testing.T, password, salt, encryption string) fs.Fs {
+	f, err := fs.NewFs(context.Background(), fmt.Sprintf(":crypt,remote=%q,password=%s,password2=%s,filename_encryption=%s:",
+		t.TempDir(), obscure.MustObscure(password), obscure.MustObscure(salt), encryption))
+	require.NoError(t, err)
+	return f
+}
+
+func TestSameKeys(t *testing.T) {
+	a := newCrypt(t, "secret", "salt", "standard")
+	for _, test := range []struct {
+		name string
+		f    fs.Fs
+		want bool
+	}{
+		{"same keys", newCrypt(t, "secret", "salt", "standard"), true},
+		{"other name encryption", newCrypt(t, "secret", "salt", "off"), true},
+		{"other password", newCrypt(t, "other", "salt", "standard"), false},
+		{"other salt", newCrypt(t, "secret", "pepper", "standard"), false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			same, err := sameKeys(test.f, a)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, same)
+		})
+	}
+
+	// Crypts over local remotes are left alone
+	b := newCrypt(t, "secret", "salt", "standard")
+	Enable(b, a)
+	assert.False(t, b.Features().ServerSideAcrossConfigs)
+}
+
+func TestCantRead(t *testing.T) {
+	assert.True(t, cantRead(fmt.Errorf("copy: %w", &googleapi.Error{Code: 404})))
+	assert.True(t, cantRead(&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "insufficientFilePermissions"}}}))
+	assert.False(t, cantRead(&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}}}))
+	assert.False(t, cantRead(errors.New("network down")))
+}
@@ -0,0 +1,134 @@
+// Package estimate sizes a transfer against the service account pool of
+// its destination before it starts, for --estimate, --sa-capacity-check
+// and --sa-require-capacity.
+package estimate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ebadenes/eclone/backend/drive"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/spf13/pflag"
+)
+
+// Options are the capacity check flags.
+type Options struct {
+	Check   bool // warn if the pool can't take the transfer today
+	Require bool // fail if the pool can't take the transfer today
+}
+
+// AddFlags adds the capacity check flags to flagSet.
+func AddFlags(flagSet *pflag.FlagSet, opt *Options) {
+	flags.BoolVarP(flagSet, &opt.Check, "sa-capacity-check", "", opt.Check, "Size the transfer first and warn if the destination's service accounts can't upload it today", "")
+	flags.BoolVarP(flagSet, &opt.Require, "sa-require-capacity", "", opt.Require, "Size the transfer first and fail if the destination's service accounts can't upload it today", "")
+}
+
+// Help returns the help of the capacity check flags, to append to the
+// help of the commands.
+func Help() string {
+	return strings.ReplaceAll(`### Pool capacity
+
+|--sa-capacity-check| sizes the source, with the filters given, before
+the transfer starts and compares it with the quota the service accounts
+of the destination's drive remote have left today, at 750 GiB each. If
+even the source less what is already at the destination doesn't fit a
+warning is logged with the days it will take. |--sa-require-capacity|
+fails instead, before anything is transferred.
+`, "|", "`")
+}
+
+// sizeSource returns the number of files in fsrc, or only the file
+// srcFileName in it if set, their size and how many of them have no size.
+func sizeSource(ctx context.Context, fsrc fs.Fs, srcFileName string) (files, size, sizeless int64, err error) {
+	if srcFileName == "" {
+		return operations.Count(ctx, fsrc)
+	}
+	o, err := fsrc.NewObject(ctx, srcFileName)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if o.Size() < 0 {
+		return 1, 0, 1, nil
+	}
+	return 1, o.Size(), 0, nil
+}
+
+// Estimate sizes the source of a transfer from fsrc, or only the file
+// srcFileName in it if set, to fdst with the filters in ctx and writes to
+// out how many service accounts and days it needs.
+//
+// Files already at the destination are counted too, so for a transfer
+// which was started before this is the most it needs.
+func Estimate(ctx context.Context, out io.Writer, fsrc fs.Fs, srcFileName string, fdst fs.Fs) error {
+	files, size, sizeless, err := sizeSource(ctx, fsrc, srcFileName)
+	if err != nil {
+		return fmt.Errorf("failed to size the source: %w", err)
+	}
+	if _, err := fmt.Fprintf(out, "Source: %d files, %v\n", files, fs.SizeSuffix(size).ByteUnit()); err != nil {
+		return err
+	}
+	if sizeless > 0 {
+		if _, err := fmt.Fprintf(out, "%d files of unknown size, such as Google Docs, aren't counted\n", sizeless); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprint(out, drive.EstimateTransfer(fdst, size))
+	return err
+}
+
+// fitsToday returns true if the transfer e fits in the quota its pool
+// has left today, or there is no pool to check.
+func fitsToday(e drive.TransferEstimate) bool {
+	return !e.Pool || e.Days == 1
+}
+
+// Check sizes a transfer from fsrc, or only the file srcFileName in it if
+// set, to fdst before it starts and warns, or with opt.Require returns an
+// error, if the pool of fdst can't upload it today.
+//
+// The size of the destination is taken off that of the source, as files
+// already there aren't uploaded again, so the warning is only given when
+// the pool clearly can't finish.
+func Check(ctx context.Context, opt *Options, fsrc fs.Fs, srcFileName string, fdst fs.Fs) error {
+	if !opt.Check && !opt.Require {
+		return nil
+	}
+	if !drive.EstimateTransfer(fdst, 0).Pool {
+		fs.Debugf(fdst, "Not a drive remote, so no service account capacity to check")
+		return nil
+	}
+	_, size, _, err := sizeSource(ctx, fsrc, srcFileName)
+	if err != nil {
+		return fmt.Errorf("failed to size the source: %w", err)
+	}
+	e := drive.EstimateTransfer(fdst, size)
+	if !fitsToday(e) && srcFileName == "" {
+		_, dstSize, _, err := operations.Count(ctx, fdst)
+		if err != nil && !errors.Is(err, fs.ErrorDirNotFound) {
+			return fmt.Errorf("failed to size the destination: %w", err)
+		}
+		e = drive.EstimateTransfer(fdst, max(size-dstSize, 0))
+	}
+	if fitsToday(e) {
+		fs.Infof(fdst, "The service accounts can upload the %v transfer with the quota left today", fs.SizeSuffix(e.Size).ByteUnit())
+		return nil
+	}
+	days := fmt.Sprintf("will take %d days", e.Days)
+	if e.Days < 0 {
+		days = "will never finish"
+	}
+	msg := fmt.Sprintf("the service accounts can't upload this transfer today: at least %v to upload with %v left today on %d of %d SAs - it %s, add service accounts or use --max-transfer",
+		fs.SizeSuffix(e.Size).ByteUnit(), fs.SizeSuffix(e.QuotaLeft).ByteUnit(), e.SAsWithQuota, e.SAs, days)
+	if opt.Require {
+		return fserrors.FatalError(errors.New(msg))
+	}
+	fs.Logf(fdst, "WARNING: %s", msg)
+	return nil
+}
@@ -0,0 +1,60 @@
+package estimate
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ebadenes/eclone/backend/drive"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimate(t *testing.T) {
+	ctx := context.Background()
+	fsrc, err := mockfs.NewFs(ctx, "src", "", nil)
+	require.NoError(t, err)
+	fdst, err := mockfs.NewFs(ctx, "dst", "", nil)
+	require.NoError(t, err)
+	src := fsrc.(*mockfs.Fs)
+	src.AddObject(mockobject.New("a.txt").WithContent(make([]byte, 1024), mockobject.SeekModeNone))
+	src.AddObject(mockobject.New("b.txt").WithContent(make([]byte, 2048), mockobject.SeekModeNone))
+	doc := mockobject.New("doc").WithContent(nil, mockobject.SeekModeNone)
+	doc.SetUnknownSize(true)
+	src.AddObject(doc)
+
+	var out bytes.Buffer
+	require.NoError(t, Estimate(ctx, &out, fsrc, "", fdst))
+	assert.Equal(t, `Source: 3 files, 3 KiB
+1 files of unknown size, such as Google Docs, aren't counted
+Transfer size: 3 KiB, needing 1 service accounts at 750 GiB a day each
+The destination isn't a drive remote, so there is no pool to check
+`, out.String())
+
+	out.Reset()
+	require.NoError(t, Estimate(ctx, &out, fsrc, "b.txt", fdst))
+	assert.Contains(t, out.String(), "Source: 1 files, 2 KiB\n")
+
+	assert.ErrorContains(t, Estimate(ctx, &out, fsrc, "missing.txt", fdst), "failed to size the source")
+}
+
+func TestFitsToday(t *testing.T) {
+	assert.True(t, fitsToday(drive.TransferEstimate{Days: -1}), "no pool")
+	assert.True(t, fitsToday(drive.TransferEstimate{Pool: true, Days: 1}))
+	assert.False(t, fitsToday(drive.TransferEstimate{Pool: true, Days: 3}))
+	assert.False(t, fitsToday(drive.TransferEstimate{Pool: true, Days: -1}))
+}
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	fsrc, err := mockfs.NewFs(ctx, "src", "", nil)
+	require.NoError(t, err)
+	fdst, err := mockfs.NewFs(ctx, "dst", "", nil)
+	require.NoError(t, err)
+
+	// Nothing is sized, so a missing file doesn't fail
+	assert.NoError(t, Check(ctx, &Options{}, fsrc, "missing.txt", fdst))
+	assert.NoError(t, Check(ctx, &Options{Require: true}, fsrc, "missing.txt", fdst), "not a drive remote")
+}
@@ -0,0 +1,175 @@
+// Package events streams what the transfers and service account pools of
+// a daemon do as server-sent events, for the rcd command's --events-addr.
+//
+// A dashboard following a run had to poll core/stats and work out from
+// one answer to the next what had changed. GET /events on the events
+// address instead sends each event as it happens, as a line of JSON:
+//
+//	event: transfer
+//	data: {"name":"a.txt","size":1024,"bytes":1024,"error":"",...}
+//
+// The events are stats, the output of core/stats every second,
+// transfer_start and transfer, when a transfer or check starts and ends,
+// and sa_switch, sa_blacklist and sa_dead from the service account pools.
+// The stream uses the TLS and authentication of the rc server.
+//
+// The transfers are polled with the stats, so one which starts and ends
+// between two polls only gets its transfer_start just before its
+// transfer.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ebadenes/eclone/backend/drive"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/lib/atexit"
+	libhttp "github.com/rclone/rclone/lib/http"
+)
+
+// Tunables, replaced by the tests
+var (
+	clientBuffer  = 256              // events queued for a client before they are dropped
+	keepAlive     = 15 * time.Second // time between comments sent to keep the stream open
+	statsInterval = time.Second      // time between stats events
+)
+
+// Hub sends the events published to the clients connected.
+type Hub struct {
+	mu      sync.Mutex
+	clients map[chan []byte]struct{}
+	done    chan struct{} // closed to end the streams
+	closed  sync.Once
+}
+
+// NewHub returns a hub with no clients.
+func NewHub() *Hub {
+	return &Hub{
+		clients: make(map[chan []byte]struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Close ends the streams of the clients, so the server can stop.
+func (h *Hub) Close() {
+	h.closed.Do(func() { close(h.done) })
+}
+
+// Publish sends event with data, encoded as JSON, to the clients. A
+// client too slow to take it misses it rather than holding up the rest.
+func (h *Hub) Publish(event string, data any) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.clients) == 0 {
+		return
+	}
+	buf, err := json.Marshal(data)
+	if err != nil {
+		fs.Errorf(nil, "Failed to encode %s event: %v", event, err)
+		return
+	}
+	msg := fmt.Appendf(nil, "event: %s\ndata: %s\n\n", event, buf)
+	for client := range h.clients {
+		select {
+		case client <- msg:
+		default:
+			fs.Debugf(nil, "Event stream client too slow - dropped %s event", event)
+		}
+	}
+}
+
+// subscribe adds a client, returning its events and the function to
+// remove it.
+func (h *Hub) subscribe() (<-chan []byte, func()) {
+	client := make(chan []byte, clientBuffer)
+	h.mu.Lock()
+	h.clients[client] = struct{}{}
+	h.mu.Unlock()
+	return client, func() {
+		h.mu.Lock()
+		delete(h.clients, client)
+		h.mu.Unlock()
+	}
+}
+
+// ServeHTTP streams the events to a client until it goes away.
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctl := http.NewResponseController(w)
+	// The stream outlives the write timeout of the server
+	_ = ctl.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := ctl.Flush(); err != nil {
+		fs.Errorf(nil, "Event stream can't be flushed: %v", err)
+		return
+	}
+	events, unsubscribe := h.subscribe()
+	defer unsubscribe()
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		var msg []byte
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.done:
+			return
+		case msg = <-events:
+		case <-ticker.C:
+			msg = []byte(": keep-alive\n\n")
+		}
+		if _, err := w.Write(msg); err != nil {
+			return
+		}
+		if err := ctl.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// Serve serves the events on addr until the returned function is called.
+func Serve(ctx context.Context, addr string) (stop func(), err error) {
+	cfg := rc.Opt.HTTP
+	cfg.ListenAddr = []string{addr}
+	s, err := libhttp.NewServer(ctx, libhttp.WithConfig(cfg), libhttp.WithAuth(rc.Opt.Auth))
+	if err != nil {
+		return nil, fmt.Errorf("failed to start the event stream: %w", err)
+	}
+	h := NewHub()
+	s.Router().Get("/events", h.ServeHTTP)
+	unsubscribe := drive.SubscribePoolEvents(func(e drive.PoolEvent) {
+		h.Publish("sa_"+e.Type, e)
+	})
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		newWatcher(h).run(ctx, statsInterval)
+	}()
+	s.Serve()
+	for _, url := range s.URLs() {
+		fs.Logf(nil, "Serving events on %sevents", url)
+	}
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			unsubscribe()
+			cancel()
+			<-done
+			// End the streams first or the server waits for them
+			h.Close()
+			if err := s.Shutdown(); err != nil {
+				fs.Errorf(nil, "Failed to stop the event stream: %v", err)
+			}
+		})
+	}
+	atexit.Register(stop)
+	return stop, nil
+}
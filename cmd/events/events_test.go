@@ -0,0 +1,103 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readEvent returns the next event and its data from r, skipping
+// comments.
+func readEvent(t *testing.T, r *bufio.Reader) (event, data string) {
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		case line == "" && event != "":
+			return event, data
+		}
+	}
+}
+
+// connect connects to the events at url, returning the stream once the
+// hub h has it as a client.
+func connect(t *testing.T, h *Hub, url string) *bufio.Reader {
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	require.Eventually(t, func() bool {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return len(h.clients) > 0
+	}, 5*time.Second, time.Millisecond)
+	return bufio.NewReader(resp.Body)
+}
+
+func TestHub(t *testing.T) {
+	oldKeepAlive := keepAlive
+	keepAlive = 10 * time.Millisecond
+	defer func() { keepAlive = oldKeepAlive }()
+
+	h := NewHub()
+	h.Publish("lost", "nobody listening")
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	r := connect(t, h, srv.URL)
+
+	h.Publish("transfer", map[string]any{"name": "a.txt", "size": 1})
+	event, data := readEvent(t, r)
+	assert.Equal(t, "transfer", event)
+	assert.JSONEq(t, `{"name":"a.txt","size":1}`, data)
+
+	// Keep alive comments are skipped
+	time.Sleep(30 * time.Millisecond)
+	h.Publish("stats", map[string]any{"bytes": 2})
+	event, _ = readEvent(t, r)
+	assert.Equal(t, "stats", event)
+
+	// Close ends the stream
+	h.Close()
+	_, err := r.ReadString('\n')
+	for err == nil {
+		_, err = r.ReadString('\n')
+	}
+	require.Eventually(t, func() bool {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return len(h.clients) == 0
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestHubSlowClient(t *testing.T) {
+	oldBuffer := clientBuffer
+	clientBuffer = 1
+	defer func() { clientBuffer = oldBuffer }()
+
+	h := NewHub()
+	events, unsubscribe := h.subscribe()
+	defer unsubscribe()
+	h.Publish("a", 1)
+	h.Publish("b", 2) // dropped
+	assert.Equal(t, "event: a\ndata: 1\n\n", string(<-events))
+	assert.Empty(t, events)
+}
+
+func TestServe(t *testing.T) {
+	stop, err := Serve(context.Background(), "127.0.0.1:0")
+	require.NoError(t, err)
+	stop()
+	stop()
+}
@@ -0,0 +1,122 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/rc"
+)
+
+// watcher publishes the stats and the transfers starting and ending.
+type watcher struct {
+	hub      *Hub
+	running  map[string]struct{} // transfers in flight by group and name
+	finished map[string]struct{} // transfers completed by group, name and start
+}
+
+// newWatcher returns a watcher publishing to hub.
+func newWatcher(hub *Hub) *watcher {
+	return &watcher{
+		hub:      hub,
+		running:  map[string]struct{}{},
+		finished: map[string]struct{}{},
+	}
+}
+
+// run polls the stats every interval until ctx is done.
+func (w *watcher) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		w.poll(ctx)
+	}
+}
+
+// call returns the output of the rc call path, or nil if it failed.
+func call(ctx context.Context, path string) rc.Params {
+	out, err := rc.Calls.Get(path).Fn(ctx, rc.Params{})
+	if err != nil {
+		fs.Errorf(nil, "Event stream failed to read %s: %v", path, err)
+		return nil
+	}
+	return out
+}
+
+// poll publishes the stats and the transfers which started or ended
+// since the last poll.
+//
+// A transfer which started and ended between two polls is never seen
+// running, so its transfer_start is published from what the stats kept
+// of it, just before its transfer, so that every transfer has a start.
+func (w *watcher) poll(ctx context.Context) {
+	stats := call(ctx, "core/stats")
+	if stats == nil {
+		return
+	}
+	if out := call(ctx, "core/transferred"); out != nil {
+		finished := map[string]struct{}{}
+		transferred, _ := out["transferred"].([]accounting.TransferSnapshot)
+		for _, tr := range transferred {
+			key := tr.Group + "\x00" + tr.Name + "\x00" + tr.StartedAt.String()
+			finished[key] = struct{}{}
+			if _, ok := w.finished[key]; ok {
+				continue
+			}
+			if !w.ended(tr) {
+				w.hub.Publish("transfer_start", startOf(tr))
+			}
+			w.hub.Publish("transfer", tr)
+		}
+		// Only those still listed can be seen again
+		w.finished = finished
+	}
+
+	running := map[string]struct{}{}
+	transferring, _ := stats["transferring"].([]rc.Params)
+	for _, tr := range transferring {
+		group, _ := tr["group"].(string)
+		name, _ := tr["name"].(string)
+		key := group + "\x00" + name
+		running[key] = struct{}{}
+		if _, ok := w.running[key]; !ok {
+			w.hub.Publish("transfer_start", tr)
+		}
+	}
+	w.running = running
+	w.hub.Publish("stats", stats)
+}
+
+// ended returns true if tr was seen running, forgetting it so that one
+// starting with the same name is seen as another. The transfers running
+// only have a group while they have an account, which server side copies
+// don't, so those are looked for without one too.
+func (w *watcher) ended(tr accounting.TransferSnapshot) bool {
+	for _, key := range []string{tr.Group + "\x00" + tr.Name, "\x00" + tr.Name} {
+		if _, ok := w.running[key]; ok {
+			delete(w.running, key)
+			return true
+		}
+	}
+	return false
+}
+
+// startOf returns the transfer_start of tr, a transfer which was never
+// seen running, with what the stats kept of it.
+func startOf(tr accounting.TransferSnapshot) rc.Params {
+	return rc.Params{
+		"name":       tr.Name,
+		"size":       tr.Size,
+		"bytes":      0,
+		"group":      tr.Group,
+		"srcFs":      tr.SrcFs,
+		"dstFs":      tr.DstFs,
+		"started_at": tr.StartedAt,
+	}
+}
@@ -0,0 +1,111 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// received returns the events queued for a client, with their data
+// decoded.
+func received(t *testing.T, events <-chan []byte) (got []string, data []map[string]any) {
+	for {
+		select {
+		case msg := <-events:
+			var event, raw string
+			for line := range strings.Lines(string(msg)) {
+				line = strings.TrimSuffix(line, "\n")
+				if after, ok := strings.CutPrefix(line, "event: "); ok {
+					event = after
+				} else if after, ok := strings.CutPrefix(line, "data: "); ok {
+					raw = after
+				}
+			}
+			var d map[string]any
+			require.NoError(t, json.Unmarshal([]byte(raw), &d))
+			got = append(got, event)
+			data = append(data, d)
+		default:
+			return got, data
+		}
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	ctx := accounting.WithStatsGroup(context.Background(), "TestWatcher")
+	f, err := mockfs.NewFs(ctx, "events", "root", nil)
+	require.NoError(t, err)
+	h := NewHub()
+	events, unsubscribe := h.subscribe()
+	defer unsubscribe()
+	w := newWatcher(h)
+	w.poll(ctx) // past the transfers of the other tests
+	received(t, events)
+
+	stats := accounting.Stats(ctx)
+	tr := stats.NewTransferRemoteSize("a.txt", 10, f, f)
+	w.poll(ctx)
+	got, data := received(t, events)
+	assert.Equal(t, []string{"transfer_start", "stats"}, got)
+	assert.Equal(t, "a.txt", data[0]["name"])
+
+	// Nothing new
+	w.poll(ctx)
+	got, _ = received(t, events)
+	assert.Equal(t, []string{"stats"}, got)
+
+	tr.Done(ctx, errors.New("boom"))
+	w.poll(ctx)
+	got, data = received(t, events)
+	require.Equal(t, []string{"transfer", "stats"}, got)
+	assert.Equal(t, "a.txt", data[0]["name"])
+	assert.Equal(t, "boom", data[0]["error"])
+	assert.Equal(t, "TestWatcher", data[0]["group"])
+
+	w.poll(ctx)
+	got, _ = received(t, events)
+	assert.Equal(t, []string{"stats"}, got)
+}
+
+func TestWatcherShortTransfer(t *testing.T) {
+	ctx := context.Background()
+	accounting.NewStatsGroup(ctx, "TestWatcherShortTransfer")
+	ctx = accounting.WithStatsGroup(ctx, "TestWatcherShortTransfer")
+	h := NewHub()
+	events, unsubscribe := h.subscribe()
+	defer unsubscribe()
+	w := newWatcher(h)
+	stats := accounting.Stats(ctx)
+	w.poll(ctx) // past the transfers of the other tests
+	received(t, events)
+
+	// Over between two polls, it still gets a start before its end
+	stats.NewTransferRemoteSize("quick.txt", 5, nil, nil).Done(ctx, nil)
+	w.poll(ctx)
+	got, data := received(t, events)
+	require.Equal(t, []string{"transfer_start", "transfer", "stats"}, got)
+	assert.Equal(t, "quick.txt", data[0]["name"])
+	assert.Equal(t, float64(5), data[0]["size"])
+	assert.Equal(t, "TestWatcherShortTransfer", data[0]["group"])
+
+	// One seen running doesn't get a second start, and one starting
+	// again with the same name gets its own
+	tr := stats.NewTransferRemoteSize("again.txt", 5, nil, nil)
+	w.poll(ctx)
+	got, _ = received(t, events)
+	require.Equal(t, []string{"transfer_start", "stats"}, got)
+	tr.Done(ctx, nil)
+	tr = stats.NewTransferRemoteSize("again.txt", 5, nil, nil)
+	w.poll(ctx)
+	got, data = received(t, events)
+	require.Equal(t, []string{"transfer", "transfer_start", "stats"}, got)
+	assert.Equal(t, "again.txt", data[1]["name"])
+	tr.Done(ctx, nil)
+}
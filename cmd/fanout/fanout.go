@@ -0,0 +1,218 @@
+// Package fanout provides the fanout command.
+package fanout
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/ebadenes/eclone/cmd/jobrun"
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/sync"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Options control how the transfers are run.
+type Options struct {
+	FanIn              bool // copy several sources into one destination
+	Delete             bool // sync rather than copy
+	Parallel           int  // transfers run at once, 0 for all
+	CreateEmptySrcDirs bool
+	StatsInterval      time.Duration // how often the stats of the jobs are logged, 0 for never
+}
+
+var opt = Options{}
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	cmdFlags := commandDefinition.Flags()
+	flags.BoolVarP(cmdFlags, &opt.FanIn, "fan-in", "", opt.FanIn, "Copy every remote but the last into the last one", "")
+	flags.BoolVarP(cmdFlags, &opt.Delete, "delete", "", opt.Delete, "Sync each destination, deleting the files not in the source", "")
+	flags.IntVarP(cmdFlags, &opt.Parallel, "parallel", "", opt.Parallel, "Number of transfers run at once (0 for all)", "")
+	flags.BoolVarP(cmdFlags, &opt.CreateEmptySrcDirs, "create-empty-src-dirs", "", opt.CreateEmptySrcDirs, "Create empty source dirs on destination after copy", "")
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "fanout source:path dest:path [dest:path...]",
+	Short: `Copy a source to several destinations, or several sources to one, in one run.`,
+	// Note: "|" will be replaced by backticks below
+	Long: strings.ReplaceAll(`Copy the source to each of the destinations given, in this process,
+rather than running a copy per destination.
+
+    eclone fanout /data gc:{id1}/backup gc:{id2}/backup s3:bucket/backup
+
+With |--fan-in| every remote but the last is a source, each copied into
+the last:
+
+    eclone fanout --fan-in gdrive:Team1 gdrive:Team2 gc:{id}/archive
+
+Each source and destination is created once, so transfers between the
+same remotes share their service account pool, with its rotation state
+and blacklist. |--parallel| limits how many of the transfers run at
+once, each with |--transfers| transfers of its own; by default they all
+run together.
+
+With |--delete| each destination is synced rather than copied, deleting
+the files not in the source. It can't be used with |--fan-in|, where
+each source would delete the files of the others.
+
+Each transfer has its own stats, logged at |--stats| intervals, and is
+retried on its own, up to |--retries| times, when it fails with errors
+which can be retried. A table of the bytes, files, checks and errors of
+each, with the totals, is printed at the end, and the command fails if
+any did.
+`, "|", "`"),
+	Annotations: map[string]string{
+		"groups": "Copy,Filter,Listing,Important",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(2, math.MaxInt, command, args)
+		if opt.FanIn && opt.Delete {
+			fs.Fatalf(nil, "--delete can't be used with --fan-in")
+		}
+		jobs := newJobs(args, opt.FanIn)
+		opt.StatsInterval = statsInterval()
+		cmd.Run(false, false, command, func() error {
+			results, err := Run(context.Background(), jobs, &opt)
+			jobrun.Print(os.Stdout, "REMOTE", results)
+			return err
+		})
+	},
+}
+
+// Job is a transfer of the run.
+type Job struct {
+	Name string // labels the stats: the destination, or the source with --fan-in
+	Src  fs.Fs
+	Dst  fs.Fs
+}
+
+// newJobs makes the jobs of the remotes in args, creating each once.
+func newJobs(args []string, fanIn bool) (jobs []Job) {
+	remotes := make([]fs.Fs, len(args))
+	for i, arg := range args {
+		remotes[i] = cmd.NewFsDir([]string{arg})
+	}
+	if fanIn {
+		dst := remotes[len(remotes)-1]
+		for i, src := range remotes[:len(remotes)-1] {
+			jobs = append(jobs, Job{Name: args[i], Src: src, Dst: dst})
+		}
+		return jobs
+	}
+	for i, dst := range remotes[1:] {
+		jobs = append(jobs, Job{Name: args[i+1], Src: remotes[0], Dst: dst})
+	}
+	return jobs
+}
+
+// Run runs the jobs, opt.Parallel at a time, and returns their results
+// in the order given, failing if any job did.
+func Run(ctx context.Context, jobs []Job, opt *Options) ([]jobrun.Result, error) {
+	parallel := opt.Parallel
+	if parallel <= 0 || parallel > len(jobs) {
+		parallel = len(jobs)
+	}
+	results := make([]jobrun.Result, len(jobs))
+	ctxs := make([]context.Context, len(jobs))
+	for i, job := range jobs {
+		results[i].Name = job.Name
+		ctxs[i] = accounting.WithStatsGroup(ctx, "fanout/"+job.Name)
+	}
+	stopStats := logStats(ctx, opt.StatsInterval, jobs, ctxs)
+	defer stopStats()
+
+	var wg gosync.WaitGroup
+	slots := make(chan struct{}, parallel)
+	for i, job := range jobs {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i] = runJob(ctxs[i], job, opt)
+		}()
+	}
+	wg.Wait()
+
+	if failed := jobrun.Failed(results); failed > 0 {
+		return results, fmt.Errorf("%d of %d transfers failed", failed, len(jobs))
+	}
+	return results, nil
+}
+
+// runJob runs job with ctx, retrying it as cmd.Run would.
+func runJob(ctx context.Context, job Job, opt *Options) jobrun.Result {
+	fs.Infof(nil, "Fanout: starting %s -> %s", fs.ConfigString(job.Src), fs.ConfigString(job.Dst))
+	result := jobrun.Run(ctx, job.Name, "Fanout: "+job.Name, func(ctx context.Context) error {
+		if opt.Delete {
+			return sync.Sync(ctx, job.Dst, job.Src, opt.CreateEmptySrcDirs)
+		}
+		return sync.CopyDir(ctx, job.Dst, job.Src, opt.CreateEmptySrcDirs)
+	})
+	if result.Err != nil {
+		fs.Errorf(nil, "Fanout: %s failed after %v: %v", job.Name, result.Duration.Round(time.Second), result.Err)
+	} else {
+		fs.Infof(nil, "Fanout: %s finished in %v", job.Name, result.Duration.Round(time.Second))
+	}
+	return result
+}
+
+// statsInterval returns the interval of --stats, or 0 with --progress
+// or if stats are off.
+func statsInterval() time.Duration {
+	flag := pflag.Lookup("stats")
+	if flag == nil || fs.GetConfig(context.Background()).Progress {
+		return 0
+	}
+	interval, ok := flag.Value.(*fs.Duration)
+	if !ok {
+		return 0
+	}
+	return time.Duration(*interval)
+}
+
+// logStats logs a line of stats per job every interval until the
+// returned function is called.
+func logStats(ctx context.Context, interval time.Duration, jobs []Job, ctxs []context.Context) (stop func()) {
+	ci := fs.GetConfig(ctx)
+	if interval <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				for i, job := range jobs {
+					fs.LogLevelPrintf(ci.StatsLogLevel, nil, "Fanout: %s", statsLine(job.Name, accounting.Stats(ctxs[i])))
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// statsLine returns a line of stats of the job called name.
+func statsLine(name string, stats *accounting.StatsInfo) string {
+	out, _ := stats.RemoteStats(true)
+	speed, _ := out.GetFloat64("speed")
+	return fmt.Sprintf("%s: %v, %d files, %d checks, %d errors, %v/s", name, fs.SizeSuffix(stats.GetBytes()), stats.GetTransfers(), stats.GetChecks(), stats.GetErrors(), fs.SizeSuffix(int64(speed)))
+}
@@ -0,0 +1,118 @@
+package fanout
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ebadenes/eclone/cmd/jobrun"
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// write makes file in dir with content
+func write(t *testing.T, dir, file, content string) {
+	t.Helper()
+	file = filepath.Join(dir, file)
+	require.NoError(t, os.MkdirAll(filepath.Dir(file), 0777))
+	require.NoError(t, os.WriteFile(file, []byte(content), 0666))
+}
+
+// newFs returns the local Fs of dir
+func newFs(t *testing.T, dir string) fs.Fs {
+	t.Helper()
+	f, err := fs.NewFs(context.Background(), dir)
+	require.NoError(t, err)
+	return f
+}
+
+func TestFanOut(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	src, dst1, dst2 := filepath.Join(root, "src"), filepath.Join(root, "dst1"), filepath.Join(root, "dst2")
+	write(t, src, "a.txt", "aaa")
+	write(t, src, "dir/b.txt", "bb")
+	write(t, dst2, "a.txt", "aaa")
+	write(t, dst2, "extra.txt", "extra")
+
+	fsrc := newFs(t, src)
+	jobs := []Job{{Name: "dst1", Src: fsrc, Dst: newFs(t, dst1)}, {Name: "dst2", Src: fsrc, Dst: newFs(t, dst2)}}
+	for _, parallel := range []int{1, 0} {
+		results, err := Run(ctx, jobs, &Options{Parallel: parallel, Delete: parallel == 0})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		for _, dst := range []string{dst1, dst2} {
+			assert.FileExists(t, filepath.Join(dst, "dir", "b.txt"))
+		}
+		if parallel == 1 {
+			assert.Equal(t, jobrun.Result{Name: "dst1", Bytes: 5, Transfers: 2, Attempts: 1}, withoutDuration(results[0]))
+			assert.Equal(t, "dst2", results[1].Name)
+			assert.Equal(t, int64(1), results[1].Transfers)
+			assert.FileExists(t, filepath.Join(dst2, "extra.txt"))
+		} else {
+			// Synced, with stats of its own
+			assert.Equal(t, int64(1), results[1].Deletes)
+			assert.NoFileExists(t, filepath.Join(dst2, "extra.txt"))
+		}
+	}
+}
+
+func TestFanIn(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	src1, src2, dst := filepath.Join(root, "src1"), filepath.Join(root, "src2"), filepath.Join(root, "dst")
+	write(t, src1, "one.txt", "1")
+	write(t, src2, "two.txt", "2")
+	fdst := newFs(t, dst)
+	results, err := Run(ctx, []Job{{Name: "src1", Src: newFs(t, src1), Dst: fdst}, {Name: "src2", Src: newFs(t, src2), Dst: fdst}}, &Options{})
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dst, "one.txt"))
+	assert.FileExists(t, filepath.Join(dst, "two.txt"))
+	assert.Equal(t, []string{"src1", "src2"}, []string{results[0].Name, results[1].Name})
+}
+
+func TestFailed(t *testing.T) {
+	ctx, ci := fs.AddConfig(context.Background())
+	ci.Retries = 2
+	accounting.Start(ctx) // count the errors
+	root := t.TempDir()
+	write(t, root, "src/a.txt", "a")
+	fsrc := newFs(t, filepath.Join(root, "src"))
+	missing := newFs(t, filepath.Join(root, "missing"))
+	results, err := Run(ctx, []Job{
+		{Name: "ok", Src: fsrc, Dst: newFs(t, filepath.Join(root, "dst"))},
+		{Name: "bad", Src: missing, Dst: newFs(t, filepath.Join(root, "dst2"))},
+	}, &Options{})
+	assert.EqualError(t, err, "1 of 2 transfers failed")
+	assert.NoError(t, results[0].Err)
+	assert.Error(t, results[1].Err)
+	assert.Equal(t, 1, results[0].Attempts)
+	assert.Equal(t, 2, results[1].Attempts)
+	assert.Equal(t, int64(1), results[1].Errors)
+
+	var out bytes.Buffer
+	jobrun.Print(&out, "REMOTE", results)
+	assert.Contains(t, out.String(), "REMOTE")
+	assert.Regexp(t, `ok +1 +1 +0 +0 +0 +0s +ok`, out.String())
+	assert.Contains(t, out.String(), "failed: ")
+	assert.Contains(t, out.String(), "1 of 2 ok")
+}
+
+func TestStatsLine(t *testing.T) {
+	ctx := accounting.WithStatsGroup(context.Background(), "TestStatsLine")
+	stats := accounting.Stats(ctx)
+	stats.Bytes(2048)
+	assert.Contains(t, statsLine("gc:", stats), "gc:: 2Ki, 0 files, 0 checks, 0 errors")
+}
+
+// withoutDuration returns r without its duration, for comparing
+func withoutDuration(r jobrun.Result) jobrun.Result {
+	r.Duration = time.Duration(0)
+	return r
+}
@@ -0,0 +1,115 @@
+// Package finished passes the transfers and checks of a run to a function
+// as they finish.
+//
+// Copy and sync only say which files went wrong through a logger of the
+// operations, and nothing at all when a transfer succeeds, and with a
+// logger they list the directories only on the destination too. The
+// stats see every transfer finish, but keep only the last few, so
+// keeping them all for the end of a run grows with the number of files.
+// A Watcher reads them every so often instead, and passes each on once.
+package finished
+
+import (
+	"context"
+	"sort"
+	gosync "sync"
+	"time"
+
+	"github.com/rclone/rclone/fs/accounting"
+)
+
+const (
+	interval = 250 * time.Millisecond // how often the stats are read
+	keep     = 10000                  // finished transfers the stats keep between reads
+)
+
+// Watcher passes the transfers finishing in the stats of a run on.
+type Watcher struct {
+	stats *accounting.StatsInfo
+	fn    func(tr accounting.TransferSnapshot)
+	mu    gosync.Mutex
+	seen  map[string]struct{} // finished transfers passed on, while the stats keep them
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// Watch calls fn with each transfer or check which finishes in the stats
+// of ctx from now on until Stop is called. fn is called from one
+// goroutine at a time, with those finished since it was last called in
+// the order they started, so that the check of a file comes before its
+// transfer.
+//
+// The stats keep up to 10,000 finished transfers, which covers those of
+// many thousand files a second.
+func Watch(ctx context.Context, fn func(tr accounting.TransferSnapshot)) *Watcher {
+	w := &Watcher{
+		stats: accounting.Stats(ctx).SetMaxCompletedTransfers(keep),
+		fn:    fn,
+		seen:  make(map[string]struct{}),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	// Those finished already are not ours
+	for _, tr := range w.stats.Transferred() {
+		w.seen[key(tr)] = struct{}{}
+	}
+	go w.run()
+	return w
+}
+
+// run reads the stats every interval until stopped.
+func (w *Watcher) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+		w.read()
+	}
+}
+
+// key identifies tr among the finished transfers.
+func key(tr accounting.TransferSnapshot) string {
+	return tr.What + "\x00" + tr.Name + "\x00" + tr.StartedAt.String()
+}
+
+// read passes on the transfers which finished since the last read.
+func (w *Watcher) read() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	seen := make(map[string]struct{}, len(w.seen))
+	var fresh []accounting.TransferSnapshot
+	for _, tr := range w.stats.Transferred() {
+		k := key(tr)
+		seen[k] = struct{}{}
+		if _, ok := w.seen[k]; !ok {
+			fresh = append(fresh, tr)
+		}
+	}
+	// Only those still kept can be seen again
+	w.seen = seen
+	sort.SliceStable(fresh, func(i, j int) bool { return fresh[i].StartedAt.Before(fresh[j].StartedAt) })
+	for _, tr := range fresh {
+		w.fn(tr)
+	}
+}
+
+// Stop stops watching, once fn has been called with every transfer which
+// finished before it. It is safe to call on a nil Watcher.
+func (w *Watcher) Stop() {
+	if w == nil {
+		return
+	}
+	select {
+	case <-w.stop:
+		return
+	default:
+	}
+	close(w.stop)
+	<-w.done
+	w.read()
+}
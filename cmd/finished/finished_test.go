@@ -0,0 +1,56 @@
+package finished
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+)
+
+// done finishes a transfer, or check with what set, of remote in ctx.
+func done(ctx context.Context, remote, what string, err error) {
+	stats := accounting.Stats(ctx)
+	tr := stats.NewTransferRemoteSize(remote, 1, nil, nil)
+	if what != "" {
+		tr = stats.NewCheckingTransfer(mockobject.Object(remote), what)
+	}
+	tr.Done(ctx, err)
+}
+
+func TestWatch(t *testing.T) {
+	ctx := context.Background()
+	accounting.NewStatsGroup(ctx, "TestWatch")
+	ctx = accounting.WithStatsGroup(ctx, "TestWatch")
+	done(ctx, "before.txt", "", nil)
+
+	var got []string
+	w := Watch(ctx, func(tr accounting.TransferSnapshot) {
+		got = append(got, tr.What+" "+tr.Name)
+	})
+	done(ctx, "a.txt", "checking", nil)
+	done(ctx, "a.txt", "", nil)
+	done(ctx, "b.txt", "", errors.New("failed"))
+	w.read()
+	done(ctx, "c.txt", "", nil)
+	w.Stop()
+	w.Stop()
+	done(ctx, "after.txt", "", nil)
+	assert.Equal(t, []string{"checking a.txt", "transferring a.txt", "transferring b.txt", "transferring c.txt"}, got)
+
+	// More than the stats used to keep
+	got = nil
+	w = Watch(ctx, func(tr accounting.TransferSnapshot) {
+		got = append(got, tr.Name)
+	})
+	for range 1000 {
+		done(ctx, "many.txt", "", nil)
+	}
+	w.Stop()
+	assert.Len(t, got, 1000)
+
+	var nilWatcher *Watcher
+	nilWatcher.Stop()
+}
@@ -0,0 +1,111 @@
+// Package history provides the history command.
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ebadenes/eclone/backend/drive"
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/spf13/cobra"
+)
+
+var (
+	filter  = drive.HistoryQuery{}
+	since   = fs.Duration(0)
+	jsonOut = false
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	cmdFlags := commandDefinition.Flags()
+	flags.StringVarP(cmdFlags, &filter.Path, "path", "", filter.Path, "Only show transfers of this file or under this directory", "")
+	flags.StringVarP(cmdFlags, &filter.ServiceAccount, "sa", "", filter.ServiceAccount, "Only show transfers made with this service account", "")
+	flags.FVarP(cmdFlags, &since, "since", "", "Only show transfers made in this long before now", "")
+	flags.BoolVarP(cmdFlags, &jsonOut, "json", "", jsonOut, "Write the transfers as a JSON array", "")
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "history history.db",
+	Short: `Show the transfers recorded by a drive remote.`,
+	// Note: "|" will be replaced by backticks below
+	Long: strings.ReplaceAll(`List the transfers recorded in the history database given, which a
+drive remote with |history_file| set records every upload, overwrite
+and server side copy in, oldest first. Each line has when the transfer
+finished, the size, how long it took, the service account used and the
+path on the remote; server side copies are marked "copy".
+
+The database can be read while eclone is recording in it, though the
+last few seconds of transfers may not be in it yet.
+
+Use |--path| to show only the transfers of a file or of those under a
+directory, as a path from the root of the drive, |--sa| to show only
+those made with a service account, by email, the name before the @ or,
+for keys which couldn't be read, file name, and |--since| to show only
+the last part of the history. The database is indexed on these, so
+they read only the transfers they show. With |--json| the transfers
+are written as a JSON array with all their fields, including the Drive
+ID and MD5.
+
+    eclone history ~/.config/rclone/history.db --since 24h
+    eclone history ~/.config/rclone/history.db --path backup/Photos/2026 --json
+`, "|", "`"),
+	RunE: func(command *cobra.Command, args []string) error {
+		cmd.CheckArgs(1, 1, command, args)
+		if since > 0 {
+			filter.Since = time.Now().Add(-time.Duration(since))
+		}
+		return List(os.Stdout, args[0], filter, jsonOut)
+	},
+}
+
+// List writes the transfers selected by q in the history database in
+// file to out, as a table or with asJSON as a JSON array.
+func List(out io.Writer, file string, q drive.HistoryQuery, asJSON bool) error {
+	var entries []drive.HistoryEntry
+	err := drive.ReadHistory(file, q, func(entry drive.HistoryEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		if entries == nil {
+			entries = []drive.HistoryEntry{}
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "\t")
+		return enc.Encode(entries)
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	var total int64
+	for _, entry := range entries {
+		kind := "upload"
+		if entry.ServerSide {
+			kind = "copy"
+		}
+		sa := entry.ServiceAccount
+		if sa == "" {
+			sa = "-"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%v\t%s\t%s\t%s:%s\n",
+			entry.Time.Local().Format("2006-01-02 15:04:05"),
+			fs.SizeSuffix(entry.Size).ByteUnit(),
+			entry.Duration.Truncate(time.Millisecond),
+			kind, sa, entry.Remote, entry.Path)
+		total += entry.Size
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "%d transfers, %s\n", len(entries), fs.SizeSuffix(total).ByteUnit())
+	return err
+}
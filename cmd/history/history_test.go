@@ -0,0 +1,52 @@
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ebadenes/eclone/backend/drive"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeHistory writes entries to a history database
+func writeHistory(t *testing.T, file string, entries ...drive.HistoryEntry) {
+	require.NoError(t, drive.WriteHistory(file, entries))
+}
+
+func TestList(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history.db")
+	var out bytes.Buffer
+	assert.Error(t, List(&out, file, drive.HistoryQuery{}, false))
+
+	writeHistory(t, file,
+		drive.HistoryEntry{Time: time.Now(), Remote: "gd", Path: "a.txt", Size: 1024, Duration: 1500 * time.Millisecond, ServiceAccount: "sa-1@p"},
+		drive.HistoryEntry{Time: time.Now(), Remote: "gd", Path: "b.txt", Size: 2048, ServerSide: true},
+	)
+
+	require.NoError(t, List(&out, file, drive.HistoryQuery{}, false))
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	require.Len(t, lines, 3)
+	assert.Contains(t, string(lines[0]), "1 KiB")
+	assert.Contains(t, string(lines[0]), "1.5s")
+	assert.Contains(t, string(lines[0]), "upload")
+	assert.Contains(t, string(lines[0]), "sa-1@p")
+	assert.Contains(t, string(lines[0]), "gd:a.txt")
+	assert.Contains(t, string(lines[1]), "copy")
+	assert.Contains(t, string(lines[1]), " - ")
+	assert.Equal(t, "2 transfers, 3 KiB", string(lines[2]))
+
+	out.Reset()
+	require.NoError(t, List(&out, file, drive.HistoryQuery{Path: "b.txt"}, true))
+	var entries []drive.HistoryEntry
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entries))
+	require.Len(t, entries, 1)
+	assert.Equal(t, "b.txt", entries[0].Path)
+
+	out.Reset()
+	require.NoError(t, List(&out, file, drive.HistoryQuery{Path: "none"}, true))
+	assert.Equal(t, "[]\n", out.String())
+}
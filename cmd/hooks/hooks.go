@@ -0,0 +1,224 @@
+// Package hooks runs user commands before and after a run, for the
+// --pre-exec and --post-exec flags of copy, sync and migrate.
+//
+// They save wrapper scripts for the jobs around a transfer: taking a
+// snapshot of the source before it, refreshing an index or sending a
+// notification of a kind the webhooks of notify don't cover after it.
+// Each command is run by the shell, with the run described in ECLONE_*
+// environment variables and as JSON on its standard input.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/ebadenes/eclone/cmd/runinfo"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/spf13/pflag"
+)
+
+// Hooks run
+const (
+	HookPre  = "pre"
+	HookPost = "post"
+)
+
+// Options are the hook flags.
+type Options struct {
+	Pre  []string // commands run before the run
+	Post []string // commands run after the run
+}
+
+// AddFlags adds the hook flags to flagSet.
+func AddFlags(flagSet *pflag.FlagSet, opt *Options) {
+	flags.StringArrayVarP(flagSet, &opt.Pre, "pre-exec", "", opt.Pre, "Run this command before the transfer, stopping if it fails (can be repeated)", "")
+	flags.StringArrayVarP(flagSet, &opt.Post, "post-exec", "", opt.Post, "Run this command after the transfer, with its stats (can be repeated)", "")
+}
+
+// Help returns the help of the hook flags, to append to the help of the
+// commands.
+func Help() string {
+	return strings.ReplaceAll(`### Hooks
+
+|--pre-exec| runs a command before the transfer starts, and
+|--post-exec| one after it has finished, whether it succeeded or not,
+unless it is about to be retried. Both can be repeated, the commands
+running in the order given. They are run by the shell (|sh -c|, or
+|cmd /C| on Windows) and their output is logged.
+
+A command gets the run in its environment, as |ECLONE_HOOK| (|pre| or
+|post|), |ECLONE_COMMAND|, |ECLONE_SOURCE| and |ECLONE_DESTINATION|,
+and after the transfer |ECLONE_STATUS| (|ok| or |failed|),
+|ECLONE_ERROR|, |ECLONE_BYTES|, |ECLONE_TRANSFERS|, |ECLONE_CHECKS|,
+|ECLONE_DELETES|, |ECLONE_ERRORS| and |ECLONE_DURATION| in seconds. The
+same is given as JSON on its standard input.
+
+A |--pre-exec| command which fails stops the run before anything is
+transferred. A |--post-exec| command which fails fails the run.
+`, "|", "`")
+}
+
+// Event is what a hook is given about the run.
+type Event struct {
+	Hook string `json:"hook"`
+	runinfo.Info
+	Status    string  `json:"status,omitempty"` // ok or failed, after the run
+	Error     string  `json:"error,omitempty"`
+	Duration  float64 `json:"duration"` // seconds
+	Bytes     int64   `json:"bytes"`
+	Transfers int64   `json:"transfers"`
+	Checks    int64   `json:"checks"`
+	Deletes   int64   `json:"deletes"`
+	Errors    int64   `json:"errors"`
+}
+
+// env returns the environment variables of e.
+func (e *Event) env() []string {
+	env := []string{
+		"ECLONE_HOOK=" + e.Hook,
+		"ECLONE_COMMAND=" + e.Command,
+		"ECLONE_SOURCE=" + e.Source,
+		"ECLONE_DESTINATION=" + e.Destination,
+	}
+	if e.Hook == HookPost {
+		env = append(env,
+			"ECLONE_STATUS="+e.Status,
+			"ECLONE_ERROR="+e.Error,
+			"ECLONE_DURATION="+strconv.FormatFloat(e.Duration, 'f', 0, 64),
+			"ECLONE_BYTES="+strconv.FormatInt(e.Bytes, 10),
+			"ECLONE_TRANSFERS="+strconv.FormatInt(e.Transfers, 10),
+			"ECLONE_CHECKS="+strconv.FormatInt(e.Checks, 10),
+			"ECLONE_DELETES="+strconv.FormatInt(e.Deletes, 10),
+			"ECLONE_ERRORS="+strconv.FormatInt(e.Errors, 10),
+		)
+	}
+	return env
+}
+
+// Hooks runs the hook commands of a run.
+type Hooks struct {
+	opt      *Options
+	attempts *runinfo.Run
+	mu       gosync.Mutex
+	failed   bool // a pre-exec command failed
+}
+
+// New returns the hooks of command run from fsrc to fdst. It returns nil,
+// which runs nothing, if opt has no commands.
+func New(opt *Options, command string, fsrc, fdst fs.Fs) *Hooks {
+	if len(opt.Pre) == 0 && len(opt.Post) == 0 {
+		return nil
+	}
+	return &Hooks{
+		opt:      opt,
+		attempts: runinfo.New(command, fsrc, fdst),
+	}
+}
+
+// Start starts an attempt run with ctx, running the --pre-exec commands
+// before the first. It returns a fatal error if one fails, so the run
+// isn't retried.
+func (h *Hooks) Start(ctx context.Context) error {
+	if h == nil {
+		return nil
+	}
+	if h.attempts.StartAttempt() > 1 {
+		return nil
+	}
+	for _, command := range h.opt.Pre {
+		if err := h.run(ctx, command, h.newEvent(ctx, HookPre, nil)); err != nil {
+			h.mu.Lock()
+			h.failed = true
+			h.mu.Unlock()
+			return fserrors.FatalError(err)
+		}
+	}
+	return nil
+}
+
+// Finish ends an attempt which returned err, running the --post-exec
+// commands unless it is going to be retried. It returns err, or the
+// error of the first command which failed if err is nil.
+func (h *Hooks) Finish(ctx context.Context, err error) error {
+	if h == nil {
+		return err
+	}
+	h.mu.Lock()
+	failed := h.failed
+	h.mu.Unlock()
+	if failed || !h.attempts.Last(ctx, err) {
+		return err
+	}
+	// Run even if the run was stopped
+	ctx = context.WithoutCancel(ctx)
+	e := h.newEvent(ctx, HookPost, err)
+	for _, command := range h.opt.Post {
+		if postErr := h.run(ctx, command, e); postErr != nil && err == nil {
+			err = postErr
+		}
+	}
+	return err
+}
+
+// newEvent returns the event of hook, after a run which returned err for
+// the post hook.
+func (h *Hooks) newEvent(ctx context.Context, hook string, err error) *Event {
+	e := Event{Hook: hook, Info: h.attempts.Info()}
+	if hook != HookPost {
+		return &e
+	}
+	stats := accounting.Stats(ctx)
+	e.Status = "ok"
+	if err != nil {
+		e.Status = "failed"
+		e.Error = err.Error()
+	}
+	e.Duration = e.Time.Sub(e.Start).Round(time.Second).Seconds()
+	e.Bytes = stats.GetBytes()
+	e.Transfers = stats.GetTransfers()
+	e.Checks = stats.GetChecks()
+	e.Deletes = stats.GetDeletes()
+	e.Errors = stats.GetErrors()
+	return &e
+}
+
+// run runs command by the shell with e, logging its output.
+func (h *Hooks) run(ctx context.Context, command string, e *Event) error {
+	input, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	cmd := shell(ctx, command)
+	cmd.Env = append(os.Environ(), e.env()...)
+	cmd.Stdin = bytes.NewReader(input)
+	fs.Infof(nil, "Running %s-exec command %q", e.Hook, command)
+	out, err := cmd.CombinedOutput()
+	for line := range strings.Lines(string(out)) {
+		fs.Logf(nil, "%s-exec: %s", e.Hook, strings.TrimRight(line, "\r\n"))
+	}
+	if err != nil {
+		fs.Errorf(nil, "%s-exec command %q failed: %v", e.Hook, command, err)
+		return fmt.Errorf("%s-exec command %q failed: %w", e.Hook, command, err)
+	}
+	return nil
+}
+
+// shell returns the command running command by the shell.
+func shell(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "/bin/sh", "-c", command)
+}
@@ -0,0 +1,132 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFs(t *testing.T) (fsrc, fdst fs.Fs) {
+	ctx := context.Background()
+	fsrc, err := mockfs.NewFs(ctx, "src", "a", nil)
+	require.NoError(t, err)
+	fdst, err = mockfs.NewFs(ctx, "dst", "b", nil)
+	require.NoError(t, err)
+	return fsrc, fdst
+}
+
+// readEnv returns the ECLONE_ variables written by env to path
+func readEnv(t *testing.T, path string) map[string]string {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	env := map[string]string{}
+	for line := range strings.Lines(string(data)) {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok && strings.HasPrefix(key, "ECLONE_") {
+			env[key] = value
+		}
+	}
+	return env
+}
+
+func TestNil(t *testing.T) {
+	fsrc, fdst := newFs(t)
+	h := New(&Options{}, "copy", fsrc, fdst)
+	assert.Nil(t, h)
+	assert.NoError(t, h.Start(context.Background()))
+	err := errors.New("boom")
+	assert.Equal(t, err, h.Finish(context.Background(), err))
+}
+
+func TestHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	ctx := accounting.WithStatsGroup(context.Background(), "TestHooks")
+	dir := t.TempDir()
+	fsrc, fdst := newFs(t)
+	h := New(&Options{
+		Pre:  []string{"env > " + filepath.Join(dir, "pre.env")},
+		Post: []string{"env > " + filepath.Join(dir, "post.env"), "cat > " + filepath.Join(dir, "post.json"), "echo done"},
+	}, "copy", fsrc, fdst)
+
+	require.NoError(t, h.Start(ctx))
+	pre := readEnv(t, filepath.Join(dir, "pre.env"))
+	assert.Equal(t, "pre", pre["ECLONE_HOOK"])
+	assert.Equal(t, "copy", pre["ECLONE_COMMAND"])
+	assert.Equal(t, "src:a", pre["ECLONE_SOURCE"])
+	assert.Equal(t, "dst:b", pre["ECLONE_DESTINATION"])
+	assert.NotContains(t, pre, "ECLONE_STATUS")
+
+	// Not run again for a retry
+	require.NoError(t, os.Remove(filepath.Join(dir, "pre.env")))
+	require.NoError(t, h.Start(ctx))
+	assert.NoFileExists(t, filepath.Join(dir, "pre.env"))
+
+	stats := accounting.Stats(ctx)
+	stats.Bytes(2048)
+	stats.NewTransferRemoteSize("a.txt", 2048, fsrc, fdst).Done(ctx, nil)
+	require.NoError(t, h.Finish(ctx, nil))
+	post := readEnv(t, filepath.Join(dir, "post.env"))
+	assert.Equal(t, "post", post["ECLONE_HOOK"])
+	assert.Equal(t, "ok", post["ECLONE_STATUS"])
+	assert.Equal(t, "2048", post["ECLONE_BYTES"])
+	assert.Equal(t, "1", post["ECLONE_TRANSFERS"])
+	data, err := os.ReadFile(filepath.Join(dir, "post.json"))
+	require.NoError(t, err)
+	var e Event
+	require.NoError(t, json.Unmarshal(data, &e))
+	assert.Equal(t, "post", e.Hook)
+	assert.Equal(t, int64(2048), e.Bytes)
+	assert.Equal(t, 2, e.Attempt)
+
+	// A failed run is passed on, as is a failing command after a good one
+	err = errors.New("boom")
+	assert.Equal(t, err, h.Finish(ctx, err))
+	assert.Equal(t, "failed", readEnv(t, filepath.Join(dir, "post.env"))["ECLONE_STATUS"])
+	h.opt.Post = []string{"exit 3"}
+	assert.ErrorContains(t, h.Finish(ctx, nil), `post-exec command "exit 3" failed: exit status 3`)
+}
+
+func TestPreFailed(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+	fsrc, fdst := newFs(t)
+	marker := filepath.Join(dir, "post")
+	h := New(&Options{Pre: []string{"false"}, Post: []string{"touch " + marker}}, "sync", fsrc, fdst)
+	err := h.Start(ctx)
+	require.Error(t, err)
+	assert.True(t, fserrors.IsFatalError(err))
+	assert.Equal(t, err, h.Finish(ctx, err))
+	assert.NoFileExists(t, marker)
+}
+
+func TestRetried(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	ctx, ci := fs.AddConfig(accounting.WithStatsGroup(context.Background(), "TestRetried"))
+	ci.Retries = 3
+	dir := t.TempDir()
+	fsrc, fdst := newFs(t)
+	marker := filepath.Join(dir, "post")
+	h := New(&Options{Post: []string{"touch " + marker}}, "sync", fsrc, fdst)
+	require.NoError(t, h.Start(ctx))
+	err := accounting.Stats(ctx).Error(errors.New("retry me"))
+	assert.Equal(t, err, h.Finish(ctx, err))
+	assert.NoFileExists(t, marker, "run while the attempt is retried")
+}
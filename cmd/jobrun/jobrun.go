@@ -0,0 +1,125 @@
+// Package jobrun runs the transfers of the batch and fanout commands,
+// each retried on its own, and prints a table of their results.
+//
+// cmd.Run retries the whole command, which for a command running
+// several transfers would run the ones which went fine again too, so
+// each transfer is retried here instead, with the stats of its own
+// context.
+package jobrun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+)
+
+// ErrNotStarted is the error of the jobs which weren't run at all.
+var ErrNotStarted = errors.New("not started")
+
+// Result is the outcome of a job.
+type Result struct {
+	Name      string
+	Op        string // may be left blank
+	Bytes     int64
+	Transfers int64
+	Checks    int64
+	Deletes   int64
+	Errors    int64
+	Attempts  int
+	Duration  time.Duration
+	Err       error
+}
+
+// Run calls fn with ctx, retrying it as cmd.Run would, up to --retries
+// times while it fails with errors which can be retried, and returns the
+// result, with the stats of ctx, under name. what is how the retries of
+// the job are logged.
+func Run(ctx context.Context, name, what string, fn func(ctx context.Context) error) (result Result) {
+	ci := fs.GetConfig(ctx)
+	stats := accounting.Stats(ctx)
+	result.Name = name
+	start := time.Now()
+	for try := 1; try <= max(ci.Retries, 1); try++ {
+		result.Attempts = try
+		err := fs.CountError(ctx, fn(ctx))
+		if err == nil {
+			err = stats.GetLastError()
+		}
+		result.Err = err
+		if !stats.Errored() || stats.HadFatalError() || !stats.HadRetryError() || try == ci.Retries {
+			break
+		}
+		fs.Errorf(nil, "%s attempt %d/%d failed with %d errors and: %v", what, try, ci.Retries, stats.GetErrors(), err)
+		stats.ResetErrors()
+		if ci.RetriesInterval > 0 {
+			time.Sleep(time.Duration(ci.RetriesInterval))
+		}
+	}
+	result.Duration = time.Since(start)
+	result.Bytes = stats.GetBytes()
+	result.Transfers = stats.GetTransfers()
+	result.Checks = stats.GetChecks()
+	result.Deletes = stats.GetDeletes()
+	result.Errors = stats.GetErrors()
+	return result
+}
+
+// Failed returns the number of results with errors.
+func Failed(results []Result) (n int) {
+	for _, result := range results {
+		if result.Err != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Print prints a table of the results to out, with the totals. heading
+// heads the column of the names, and the ops are only shown if some
+// results have one.
+func Print(out io.Writer, heading string, results []Result) {
+	if len(results) == 0 {
+		return
+	}
+	withOp := slices.ContainsFunc(results, func(r Result) bool { return r.Op != "" })
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	row := func(name, op string, cells ...any) {
+		line := []string{name}
+		if withOp {
+			line = append(line, op)
+		}
+		for _, cell := range cells {
+			line = append(line, fmt.Sprint(cell))
+		}
+		_, _ = fmt.Fprintln(w, strings.Join(line, "\t"))
+	}
+	row(heading, "OP", "BYTES", "FILES", "CHECKS", "DELETES", "ERRORS", "TIME", "RESULT")
+	total := Result{Name: "TOTAL"}
+	for _, r := range results {
+		status := "ok"
+		if r.Err != nil {
+			status = "failed: " + r.Err.Error()
+			if errors.Is(r.Err, context.Canceled) {
+				status = "cancelled"
+			} else if r.Err == ErrNotStarted {
+				status = r.Err.Error()
+			}
+		}
+		row(r.Name, r.Op, fs.SizeSuffix(r.Bytes), r.Transfers, r.Checks, r.Deletes, r.Errors, r.Duration.Round(time.Second), status)
+		total.Bytes += r.Bytes
+		total.Transfers += r.Transfers
+		total.Checks += r.Checks
+		total.Deletes += r.Deletes
+		total.Errors += r.Errors
+	}
+	row(total.Name, "", fs.SizeSuffix(total.Bytes), total.Transfers, total.Checks, total.Deletes, total.Errors, "", fmt.Sprintf("%d of %d ok", len(results)-Failed(results), len(results)))
+	_ = w.Flush()
+}
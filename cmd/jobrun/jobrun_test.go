@@ -0,0 +1,81 @@
+package jobrun
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/stretchr/testify/assert"
+)
+
+// withStats returns ctx with new stats called group
+func withStats(ctx context.Context, group string) context.Context {
+	accounting.NewStatsGroup(ctx, group)
+	return accounting.WithStatsGroup(ctx, group)
+}
+
+func TestRun(t *testing.T) {
+	ctx, ci := fs.AddConfig(context.Background())
+	ci.Retries = 3
+	accounting.Start(ctx) // count the errors
+
+	// Retried until it works
+	calls := 0
+	result := Run(withStats(ctx, "TestRun/retry"), "retry", "Test: retry", func(ctx context.Context) error {
+		calls++
+		if calls < 2 {
+			return fserrors.RetryErrorf("try again")
+		}
+		accounting.Stats(ctx).Bytes(10)
+		return nil
+	})
+	assert.NoError(t, result.Err)
+	assert.Equal(t, 2, result.Attempts)
+	assert.Equal(t, "retry", result.Name)
+	assert.Equal(t, int64(10), result.Bytes)
+	assert.Equal(t, int64(0), result.Errors)
+
+	// Errors which can't be retried aren't
+	calls = 0
+	result = Run(withStats(ctx, "TestRun/fatal"), "fatal", "Test: fatal", func(ctx context.Context) error {
+		calls++
+		return fserrors.FatalError(errors.New("boom"))
+	})
+	assert.ErrorContains(t, result.Err, "boom")
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, int64(1), result.Errors)
+}
+
+func TestPrint(t *testing.T) {
+	results := []Result{
+		{Name: "one", Op: "copy", Bytes: 3, Transfers: 1, Duration: time.Second},
+		{Name: "two", Op: "sync", Errors: 1, Err: errors.New("boom")},
+		{Name: "three", Op: "move", Err: ErrNotStarted},
+	}
+	var out bytes.Buffer
+	Print(&out, "JOB", results)
+	assert.Regexp(t, `JOB +OP +BYTES`, out.String())
+	assert.Regexp(t, `one +copy +3 +1 +0 +0 +0 +1s +ok`, out.String())
+	assert.Contains(t, out.String(), "failed: boom")
+	assert.Regexp(t, `three +move .* not started`, out.String())
+	assert.Regexp(t, `TOTAL +3 +1 +0 +0 +1 +1 of 3 ok`, out.String())
+
+	// Without ops there is no op column
+	for i := range results {
+		results[i].Op = ""
+	}
+	out.Reset()
+	Print(&out, "REMOTE", results)
+	assert.Regexp(t, `REMOTE +BYTES`, out.String())
+	assert.Regexp(t, `one +3 +1 +0 +0 +0 +1s +ok`, out.String())
+
+	out.Reset()
+	Print(&out, "JOB", nil)
+	assert.Empty(t, out.String())
+	assert.Equal(t, 0, Failed(nil))
+}
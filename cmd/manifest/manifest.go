@@ -0,0 +1,308 @@
+// Package manifest provides the manifest command.
+package manifest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ebadenes/eclone/backend/drive"
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+var (
+	output  = ""
+	keyFile = ""
+	verify  = ""
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	cmdFlags := commandDefinition.Flags()
+	flags.StringVarP(cmdFlags, &output, "output", "o", output, "Write the manifest to this file instead of the standard output", "")
+	flags.StringVarP(cmdFlags, &keyFile, "key-file", "", keyFile, "Sign the manifest with the key in this file, or check it was signed with it", "")
+	flags.StringVarP(cmdFlags, &verify, "verify", "", verify, "Check the path against this manifest instead of writing one", "")
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "manifest remote:path",
+	Short: `Write a signed listing of the files under the path, or check it.`,
+	// Note: "|" will be replaced by backticks below
+	Long: strings.ReplaceAll(`Write a manifest of the files under the path given: a JSON document
+with the path, size, MD5 and modification time of each, sorted by
+path, and a signature over all of it.
+
+A drive remote is listed |--checkers| directories at a time, each with
+the next service account preloaded with |--drive-services-preload|, so
+no single service account carries the rate limits, and its MD5s come
+with the listing. Other remotes are listed as usual and hashed
+|--checkers| files at a time, which reads the files on remotes without
+MD5s of their own, like a local disk.
+
+The signature is the SHA-256 of the manifest, which shows it was
+damaged but not that it was altered, unless |--key-file| is given, when
+it is an HMAC-SHA256 keyed with the contents of that file.
+
+With |--verify| the path is listed in the same way and compared with
+the manifest given instead of writing one, after checking its
+signature. Files in the manifest which are missing, or whose size or
+MD5 has changed, are logged as errors and fail the command; files
+which weren't there when it was made are logged. Files without an MD5
+on either side are compared by size and modification time.
+
+    eclone manifest gdrive:Archive -o archive.json --key-file ~/.config/eclone/manifest.key
+    eclone manifest gc:{id}/Archive --verify archive.json --key-file ~/.config/eclone/manifest.key
+
+The filter flags select the files listed in both cases.
+`, "|", "`"),
+	RunE: func(command *cobra.Command, args []string) error {
+		cmd.CheckArgs(1, 1, command, args)
+		f := cmd.NewFsDir(args)
+		var key []byte
+		if keyFile != "" {
+			var err error
+			key, err = os.ReadFile(keyFile)
+			if err != nil {
+				return fmt.Errorf("failed to read key: %w", err)
+			}
+		}
+		cmd.Run(false, false, command, func() error {
+			ctx := context.Background()
+			if verify != "" {
+				return Verify(ctx, f, verify, key)
+			}
+			m, err := Build(ctx, f)
+			if err != nil {
+				return err
+			}
+			if output == "" {
+				return m.Write(os.Stdout, key)
+			}
+			return m.WriteFile(output, key)
+		})
+		return nil
+	},
+}
+
+// Entry is a file in a manifest.
+type Entry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	MD5     string    `json:"md5,omitempty"`
+	ModTime time.Time `json:"modtime"`
+}
+
+// Manifest is a listing of the files under a remote path.
+type Manifest struct {
+	Remote    string    `json:"remote"`
+	Created   time.Time `json:"created"`
+	Files     []Entry   `json:"files"`
+	Signature string    `json:"signature"` // "sha256:" or "hmac-sha256:" and the hex digest of the rest
+}
+
+// Build lists the files in f, with the filters, and returns their
+// manifest.
+func Build(ctx context.Context, f fs.Fs) (*Manifest, error) {
+	var (
+		mu      sync.Mutex
+		objects []fs.Object
+	)
+	fi := filter.GetConfig(ctx)
+	callback := func(entries fs.DirEntries) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, entry := range entries {
+			if o, ok := entry.(fs.Object); ok && fi.IncludeObject(ctx, o) {
+				objects = append(objects, o)
+			}
+		}
+		return nil
+	}
+	var err error
+	if _, ok := f.(*drive.Fs); ok {
+		err = drive.SpreadListR(ctx, f, "", callback)
+	} else {
+		err = walk.ListR(ctx, f, "", true, -1, walk.ListObjects, callback)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list: %w", err)
+	}
+	m := &Manifest{
+		Remote:  fs.ConfigString(f),
+		Created: time.Now().UTC(),
+		Files:   make([]Entry, len(objects)),
+	}
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(fs.GetConfig(ctx).Checkers)
+	for i, o := range objects {
+		g.Go(func() error {
+			md5, err := o.Hash(gCtx, hash.MD5)
+			if errors.Is(err, hash.ErrUnsupported) {
+				md5, err = "", nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to hash %v: %w", o, err)
+			}
+			m.Files[i] = Entry{
+				Path:    o.Remote(),
+				Size:    o.Size(),
+				MD5:     md5,
+				ModTime: o.ModTime(gCtx).UTC(),
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Path < m.Files[j].Path })
+	fs.Infof(f, "Listed %d files for the manifest", len(m.Files))
+	return m, nil
+}
+
+// sign returns the signature of m, an HMAC with key or a SHA-256 digest
+// if key is empty.
+func (m *Manifest) sign(key []byte) (string, error) {
+	unsigned := *m
+	unsigned.Signature = ""
+	data, err := json.Marshal(unsigned)
+	if err != nil {
+		return "", err
+	}
+	if len(key) == 0 {
+		sum := sha256.Sum256(data)
+		return "sha256:" + hex.EncodeToString(sum[:]), nil
+	}
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write(data)
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Write signs m with key and writes it to out.
+func (m *Manifest) Write(out io.Writer, key []byte) (err error) {
+	m.Signature, err = m.sign(key)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "\t")
+	return enc.Encode(m)
+}
+
+// WriteFile signs m with key and writes it to file.
+func (m *Manifest) WriteFile(file string, key []byte) (err error) {
+	out, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(out, &err)
+	return m.Write(out, key)
+}
+
+// Read reads the manifest in file, checking it is signed with key.
+func Read(file string, key []byte) (*Manifest, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err = json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %q: %w", file, err)
+	}
+	want, err := m.sign(key)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(m.Signature), []byte(want)) {
+		if len(key) == 0 && strings.HasPrefix(m.Signature, "hmac-sha256:") {
+			return nil, fmt.Errorf("manifest %q is signed with a key: use --key-file", file)
+		}
+		return nil, fmt.Errorf("manifest %q doesn't match its signature: it was altered or signed with another key", file)
+	}
+	return &m, nil
+}
+
+// Differences are the changes in a tree since its manifest was made.
+type Differences struct {
+	Missing []string // in the manifest but not the tree
+	Changed []string // with a different size or MD5
+	Added   []string // in the tree but not the manifest
+}
+
+// Compare returns the differences between the manifest old and the
+// manifest of the same tree now.
+func Compare(old, now *Manifest) (d Differences) {
+	files := make(map[string]Entry, len(now.Files))
+	for _, entry := range now.Files {
+		files[entry.Path] = entry
+	}
+	for _, was := range old.Files {
+		is, ok := files[was.Path]
+		if !ok {
+			d.Missing = append(d.Missing, was.Path)
+			continue
+		}
+		delete(files, was.Path)
+		changed := was.Size != is.Size
+		if was.MD5 != "" && is.MD5 != "" {
+			changed = changed || was.MD5 != is.MD5
+		} else {
+			changed = changed || !was.ModTime.Equal(is.ModTime)
+		}
+		if changed {
+			d.Changed = append(d.Changed, was.Path)
+		}
+	}
+	for _, entry := range now.Files {
+		if _, ok := files[entry.Path]; ok {
+			d.Added = append(d.Added, entry.Path)
+		}
+	}
+	return d
+}
+
+// Verify checks the files in f against the manifest in file, signed
+// with key, returning an error if any are missing or changed.
+func Verify(ctx context.Context, f fs.Fs, file string, key []byte) error {
+	old, err := Read(file, key)
+	if err != nil {
+		return err
+	}
+	now, err := Build(ctx, f)
+	if err != nil {
+		return err
+	}
+	d := Compare(old, now)
+	for _, remote := range d.Missing {
+		fs.Errorf(remote, "Missing since the manifest was made")
+	}
+	for _, remote := range d.Changed {
+		fs.Errorf(remote, "Changed since the manifest was made")
+	}
+	for _, remote := range d.Added {
+		fs.Logf(remote, "Not in the manifest")
+	}
+	fs.Logf(f, "%d files in the manifest: %d missing, %d changed, %d not in the manifest",
+		len(old.Files), len(d.Missing), len(d.Changed), len(d.Added))
+	if len(d.Missing) > 0 || len(d.Changed) > 0 {
+		return fmt.Errorf("%d files missing and %d changed since the manifest was made", len(d.Missing), len(d.Changed))
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package manifest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildVerify(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0666))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte("world"), 0666))
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+
+	m, err := Build(ctx, f)
+	require.NoError(t, err)
+	require.Len(t, m.Files, 2)
+	assert.Equal(t, "a.txt", m.Files[0].Path)
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", m.Files[0].MD5)
+	assert.Equal(t, "sub/b.txt", m.Files[1].Path)
+	assert.Equal(t, int64(5), m.Files[1].Size)
+
+	key := []byte("secret")
+	file := filepath.Join(t.TempDir(), "manifest.json")
+	require.NoError(t, m.WriteFile(file, key))
+	require.NoError(t, Verify(ctx, f, file, key))
+
+	// The signature needs the key and covers the contents
+	_, err = Read(file, nil)
+	assert.ErrorContains(t, err, "--key-file")
+	_, err = Read(file, []byte("other"))
+	assert.ErrorContains(t, err, "altered")
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	tampered := filepath.Join(t.TempDir(), "tampered.json")
+	require.NoError(t, os.WriteFile(tampered, []byte(strings.Replace(string(data), `"size": 5`, `"size": 6`, 1)), 0666))
+	_, err = Read(tampered, key)
+	assert.ErrorContains(t, err, "altered")
+
+	// Changing a file is caught even with the same size
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("HELLO"), 0666))
+	assert.ErrorContains(t, Verify(ctx, f, file, key), "1 changed")
+}
+
+func TestSignature(t *testing.T) {
+	m := &Manifest{Remote: "remote:", Files: []Entry{{Path: "a", Size: 1, MD5: "aa"}}}
+	plain, err := m.sign(nil)
+	require.NoError(t, err)
+	assert.Regexp(t, "^sha256:[0-9a-f]{64}$", plain)
+	keyed, err := m.sign([]byte("key"))
+	require.NoError(t, err)
+	assert.Regexp(t, "^hmac-sha256:[0-9a-f]{64}$", keyed)
+	m.Signature = keyed
+	again, err := m.sign([]byte("key"))
+	require.NoError(t, err)
+	assert.Equal(t, keyed, again)
+	m.Files[0].MD5 = "ab"
+	changed, err := m.sign([]byte("key"))
+	require.NoError(t, err)
+	assert.NotEqual(t, keyed, changed)
+}
+
+func TestCompare(t *testing.T) {
+	tm := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	old := &Manifest{Files: []Entry{
+		{Path: "same", Size: 1, MD5: "aa", ModTime: tm},
+		{Path: "touched", Size: 1, MD5: "aa", ModTime: tm},
+		{Path: "flipped", Size: 1, MD5: "aa", ModTime: tm},
+		{Path: "gone", Size: 1, MD5: "aa", ModTime: tm},
+		{Path: "nohash", Size: 1, ModTime: tm},
+	}}
+	now := &Manifest{Files: []Entry{
+		{Path: "same", Size: 1, MD5: "aa", ModTime: tm},
+		{Path: "touched", Size: 1, MD5: "aa", ModTime: tm.Add(time.Hour)},
+		{Path: "flipped", Size: 1, MD5: "ab", ModTime: tm},
+		{Path: "nohash", Size: 1, ModTime: tm.Add(time.Hour)},
+		{Path: "new", Size: 1, MD5: "aa", ModTime: tm},
+	}}
+	assert.Equal(t, Differences{
+		Missing: []string{"gone"},
+		Changed: []string{"flipped", "nohash"},
+		Added:   []string{"new"},
+	}, Compare(old, now))
+}
@@ -0,0 +1,124 @@
+// Package migrate provides the migrate command.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/ebadenes/eclone/backend/drive"
+	"github.com/ebadenes/eclone/cmd/hooks"
+	"github.com/ebadenes/eclone/cmd/notify"
+	"github.com/ebadenes/eclone/cmd/report"
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/sync"
+	"github.com/spf13/cobra"
+)
+
+var (
+	copyOnly   = false
+	reportFile = ""
+	notifyOpt  = notify.Options{}
+	hooksOpt   = hooks.Options{}
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	cmdFlags := commandDefinition.Flags()
+	flags.BoolVarP(cmdFlags, &copyOnly, "copy", "", copyOnly, "Copy the files, leaving the source as it is", "")
+	flags.StringVarP(cmdFlags, &reportFile, "report-file", "", reportFile, "Write a JSON summary of the run to this file", "")
+	notify.AddFlags(cmdFlags, &notifyOpt)
+	hooks.AddFlags(cmdFlags, &hooksOpt)
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "migrate source:path dest:path",
+	Short: `Move a My Drive into a shared drive.`,
+	// Note: "|" will be replaced by backticks below
+	Long: strings.ReplaceAll(`Move the contents of a Google Drive My Drive, or a folder in it, into
+a shared drive, keeping the folder structure, empty folders included,
+and the modification times.
+
+The source must be a drive remote on a My Drive and the destination a
+drive remote on a shared drive. Each file is moved server side where
+Drive allows it. Drive refuses to move some files into a shared drive,
+typically those owned by someone outside it; these are copied server
+side instead, and if that is refused too downloaded and uploaded again.
+The source file is only deleted once its copy is in place. This is
+|--drive-server-side-across-configs| with |--drive-move-fallback
+copy,transfer|, which migrate sets unless given.
+
+With |--copy| the files are copied and the source is left as it is.
+
+Files left in the source at the end, because they failed, are counted
+so the command can be run again to retry them.
+
+With |--report-file| a JSON summary of the run is written to the file
+given at the end of each attempt, to archive with the migration: when
+it ran, the files moved, skipped and failed, with the error of each
+failure, and the bytes uploaded and rate limits hit by each service
+account.
+
+    eclone migrate gdrive: gc:{id}/from-gdrive --dry-run
+    eclone migrate gdrive: gc:{id}/from-gdrive
+
+**Note**: Use the |--dry-run| or the |--interactive|/|-i| flag to test without moving anything.
+`, "|", "`") + "\n" + notify.Help() + "\n" + hooks.Help(),
+	Annotations: map[string]string{
+		"groups": "Copy,Filter,Listing,Important",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(2, 2, command, args)
+		if err := drive.SetMigrationOptions(); err != nil {
+			fs.Fatalf(nil, "%v", err)
+		}
+		fsrc, fdst := cmd.NewFsSrcDst(args)
+		if err := drive.CheckMigration(fsrc, fdst); err != nil {
+			fs.Fatalf(nil, "Can't migrate: %v", err)
+		}
+		run := report.New(reportFile, "migrate", fsrc, fdst)
+		notifier, err := notify.New(context.Background(), &notifyOpt, "migrate", fsrc, fdst)
+		if err != nil {
+			fs.Fatalf(nil, "%v", err)
+		}
+		hooker := hooks.New(&hooksOpt, "migrate", fsrc, fdst)
+		cmd.Run(true, true, command, func() error {
+			ctx := context.Background()
+			run.Start(ctx)
+			notifier.Start(ctx)
+			if err := hooker.Start(ctx); err != nil {
+				return notifier.Finish(ctx, run.Finish(ctx, err))
+			}
+			return notifier.Finish(ctx, run.Finish(ctx, hooker.Finish(ctx, migrate(ctx, fsrc, fdst))))
+		})
+	},
+}
+
+// migrate moves, or copies with --copy, fsrc to fdst and logs how many
+// files were left behind.
+func migrate(ctx context.Context, fsrc, fdst fs.Fs) error {
+	if copyOnly {
+		fs.Logf(nil, "Copying %s to %s", fs.ConfigString(fsrc), fs.ConfigString(fdst))
+		return sync.CopyDir(ctx, fdst, fsrc, true)
+	}
+	fs.Logf(nil, "Moving %s to %s", fs.ConfigString(fsrc), fs.ConfigString(fdst))
+	err := sync.MoveDir(ctx, fdst, fsrc, true, true)
+	if fs.GetConfig(ctx).DryRun {
+		return err
+	}
+	objects, size, _, countErr := operations.Count(ctx, fsrc)
+	switch {
+	case errors.Is(countErr, fs.ErrorDirNotFound):
+		fs.Logf(fsrc, "All files migrated")
+	case countErr != nil:
+		fs.Errorf(fsrc, "Failed to count the files left: %v", countErr)
+	case objects > 0:
+		fs.Logf(fsrc, "%d files (%s) left in the source - run migrate again to retry them", objects, fs.SizeSuffix(size))
+	default:
+		fs.Logf(fsrc, "All files migrated")
+	}
+	return err
+}
@@ -0,0 +1,88 @@
+// Package move adds --quota-retry to the move command.
+//
+// The move command is rclone's. A long move runs into the same Drive
+// quota errors as a long copy, so this gives it the quota retry of the
+// copy and sync commands: the files which failed with a quota error are
+// moved again, once, at the end.
+package move
+
+import (
+	"context"
+
+	"github.com/ebadenes/eclone/cmd/quotaretry"
+	"github.com/rclone/rclone/cmd"
+	_ "github.com/rclone/rclone/cmd/move" // the command this extends
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/operations/operationsflags"
+	"github.com/rclone/rclone/fs/sync"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var quotaRetryOpt = quotaretry.Options{}
+
+func init() {
+	command, _, err := cmd.Root.Find([]string{"move"})
+	if err != nil || command.Name() != "move" {
+		panic("move command not found")
+	}
+	quotaretry.AddFlags(command.Flags(), &quotaRetryOpt)
+	command.Long += "\n" + quotaretry.Help()
+	run := command.Run
+	command.Run = func(command *cobra.Command, args []string) {
+		if !quotaRetryOpt.Retry {
+			run(command, args)
+			return
+		}
+		cmd.CheckArgs(2, 2, command, args)
+		fsrc, srcFileName, fdst := cmd.NewFsSrcFileDst(args)
+		deleteEmptySrcDirs, _ := command.Flags().GetBool("delete-empty-src-dirs")
+		createEmptySrcDirs, _ := command.Flags().GetBool("create-empty-src-dirs")
+		cmd.Run(true, true, command, func() error {
+			ctx := context.Background()
+			loggerOpt, loggerFlagsOpt := loggerFlags(command.Flags())
+			close, err := operationsflags.ConfigureLoggers(ctx, fdst, command, &loggerOpt, loggerFlagsOpt)
+			if err != nil {
+				return err
+			}
+			defer close()
+			if loggerFlagsOpt.AnySet() {
+				ctx = operations.WithSyncLogger(ctx, loggerOpt)
+			}
+
+			moveFn := func(ctx context.Context) error {
+				if srcFileName == "" {
+					return sync.MoveDir(ctx, fdst, fsrc, deleteEmptySrcDirs, createEmptySrcDirs)
+				}
+				return operations.MoveFile(ctx, fdst, fsrc, srcFileName, srcFileName)
+			}
+			return quotaretry.Run(ctx, &quotaRetryOpt, srcFileName, moveFn, func(ctx context.Context, files []string) error {
+				if srcFileName != "" {
+					return moveFn(ctx)
+				}
+				ctx, err := quotaretry.Only(ctx, files)
+				if err != nil {
+					return err
+				}
+				return sync.MoveDir(ctx, fdst, fsrc, deleteEmptySrcDirs, false)
+			})
+		})
+	}
+}
+
+// loggerFlags returns the logger options the move command was given.
+//
+// The move command keeps them to itself, so they are read by adding the
+// logger flags to a flag set of their own and setting those the command
+// line set.
+func loggerFlags(cmdFlags *pflag.FlagSet) (opt operations.LoggerOpt, flagsOpt operationsflags.AddLoggerFlagsOptions) {
+	loggerFlags := pflag.NewFlagSet("logger", pflag.ContinueOnError)
+	operationsflags.AddLoggerFlags(loggerFlags, &opt, &flagsOpt)
+	cmdFlags.Visit(func(flag *pflag.Flag) {
+		if loggerFlags.Lookup(flag.Name) != nil {
+			_ = loggerFlags.Set(flag.Name, flag.Value.String())
+		}
+	})
+	opt.LoggerFn = operations.NewDefaultLoggerFn(&opt)
+	return opt, flagsOpt
+}
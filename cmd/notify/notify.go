@@ -0,0 +1,313 @@
+// Package notify posts notifications about a run to webhooks, for the
+// --notify-* flags of copy, sync and migrate.
+//
+// Team migrations run unattended, so the people waiting on them want to
+// hear when one finishes or goes wrong rather than watch the log. Three
+// events are sent:
+//
+//   - done when the run finishes, unless the attempt is going to be retried
+//   - errors when the errors of an attempt reach --notify-errors
+//   - exhausted when the service account pool of a drive remote has no SA
+//     left to switch to, once per pool
+//
+// Generic webhooks get the event as JSON, with the message made from its
+// template, and Slack incoming webhooks get the message as their text.
+// The messages come from templates which --notify-template can replace.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	gosync "sync"
+	"text/template"
+	"time"
+
+	"github.com/ebadenes/eclone/backend/drive"
+	"github.com/ebadenes/eclone/cmd/runinfo"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/fshttp"
+	"github.com/spf13/pflag"
+)
+
+// Events sent
+const (
+	EventDone      = "done"
+	EventErrors    = "errors"
+	EventExhausted = "exhausted"
+)
+
+// sendTimeout is how long a webhook has to answer
+const sendTimeout = 30 * time.Second
+
+// errorsInterval is how often the errors are checked against the
+// threshold
+var errorsInterval = 5 * time.Second
+
+// defaultTemplates are the messages of the events unless replaced
+const defaultTemplates = `
+{{- define "done" -}}
+eclone {{.Command}} {{.Source}} -> {{.Destination}} {{if .Error}}failed{{else}}finished{{end}} after {{.Duration}}: {{.Transfers}} files, {{size .Bytes}} transferred, {{.Errors}} errors
+{{- if .Error}}
+Error: {{.Error}}{{end}}
+{{- end}}
+{{- define "errors" -}}
+eclone {{.Command}} {{.Source}} -> {{.Destination}} has had {{.Errors}} errors in attempt {{.Attempt}}
+{{- if .Error}}, the last: {{.Error}}{{end}}
+{{- end}}
+{{- define "exhausted" -}}
+eclone {{.Command}} {{.Source}} -> {{.Destination}}: the service account pool of {{.Remote}} is exhausted, carrying on with the current SA
+{{- end}}`
+
+// Options are the notification flags.
+type Options struct {
+	Webhooks []string // generic webhooks getting the event as JSON
+	Slack    []string // Slack incoming webhooks
+	Errors   int64    // errors in an attempt to notify at, 0 for never
+	Template string   // file replacing the templates of the messages
+}
+
+// AddFlags adds the notification flags to flagSet.
+func AddFlags(flagSet *pflag.FlagSet, opt *Options) {
+	flags.StringArrayVarP(flagSet, &opt.Webhooks, "notify-webhook", "", opt.Webhooks, "POST the run's events as JSON to this URL (can be repeated)", "")
+	flags.StringArrayVarP(flagSet, &opt.Slack, "notify-slack", "", opt.Slack, "Post the run's events to this Slack incoming webhook (can be repeated)", "")
+	flags.Int64VarP(flagSet, &opt.Errors, "notify-errors", "", opt.Errors, "Notify when an attempt has had this many errors (0 to disable)", "")
+	flags.StringVarP(flagSet, &opt.Template, "notify-template", "", opt.Template, "File defining the done, errors and exhausted templates of the messages", "")
+}
+
+// Help returns the help of the notification flags, to append to the help
+// of the commands.
+func Help() string {
+	return strings.ReplaceAll(`### Notifications
+
+With |--notify-webhook| or |--notify-slack| the events of the run are
+posted to webhooks: "done" when it finishes, unless the attempt is
+about to be retried, "errors" when an attempt reaches |--notify-errors|
+errors, and "exhausted" when the service account pool of a drive remote
+runs out. Generic webhooks get the event as JSON, with the message in
+|message|, and Slack incoming webhooks get the message as their text.
+
+The messages are Go templates given the fields of the event, with
+|size| to format bytes. A file given with |--notify-template| can
+replace any of them with |{{define "done"}}...{{end}}|, and the same
+for "errors" and "exhausted".
+`, "|", "`")
+}
+
+// Event is what is posted about the run.
+type Event struct {
+	Event string `json:"event"`
+	runinfo.Info
+	Duration  string `json:"duration"`
+	Transfers int64  `json:"transfers"`
+	Bytes     int64  `json:"bytes"`
+	Errors    int64  `json:"errors"`
+	Error     string `json:"error,omitempty"`  // why the run failed, or the last error
+	Remote    string `json:"remote,omitempty"` // remote whose pool is exhausted
+	Message   string `json:"message"`
+}
+
+// Notifier posts the events of a run.
+type Notifier struct {
+	opt       *Options
+	templates *template.Template
+	client    *http.Client
+	attempts  *runinfo.Run
+	mu        gosync.Mutex
+	stop      func()           // stops watching the errors of the attempt
+	sent      gosync.WaitGroup // events being posted
+	hooks     []func()         // unregister the exhausted hooks of the pools
+}
+
+// New returns the notifier of command run from fsrc to fdst. It returns
+// nil, which sends nothing, if opt has no webhooks.
+func New(ctx context.Context, opt *Options, command string, fsrc, fdst fs.Fs) (*Notifier, error) {
+	if len(opt.Webhooks) == 0 && len(opt.Slack) == 0 {
+		return nil, nil
+	}
+	templates := template.New("notify").Funcs(template.FuncMap{
+		"size": func(n int64) string { return fs.SizeSuffix(n).ByteUnit() },
+	})
+	templates = template.Must(templates.Parse(defaultTemplates))
+	if opt.Template != "" {
+		if _, err := templates.ParseFiles(opt.Template); err != nil {
+			return nil, fmt.Errorf("failed to read notification templates: %w", err)
+		}
+	}
+	n := &Notifier{
+		opt:       opt,
+		templates: templates,
+		client:    fshttp.NewClient(ctx),
+		attempts:  runinfo.New(command, fsrc, fdst),
+		stop:      func() {},
+	}
+	var pools []*drive.ServiceAccountPool
+	for _, f := range []fs.Fs{fsrc, fdst} {
+		df, ok := f.(*drive.Fs)
+		if !ok || df.ServiceAccountFiles == nil || df.ServiceAccountFiles.Len() == 0 {
+			continue
+		}
+		pool := df.ServiceAccountFiles
+		if len(pools) > 0 && pools[0] == pool {
+			continue
+		}
+		pools = append(pools, pool)
+		remote := fs.ConfigString(f)
+		var once gosync.Once
+		n.hooks = append(n.hooks, pool.OnExhausted(func() {
+			once.Do(func() {
+				n.send(ctx, EventExhausted, func(e *Event) { e.Remote = remote })
+			})
+		}))
+	}
+	return n, nil
+}
+
+// Start starts an attempt run with ctx, watching its errors if
+// --notify-errors is set.
+func (n *Notifier) Start(ctx context.Context) {
+	if n == nil {
+		return
+	}
+	n.attempts.StartAttempt()
+	if n.opt.Errors <= 0 {
+		return
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(errorsInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if accounting.Stats(ctx).GetErrors() >= n.opt.Errors {
+					n.send(ctx, EventErrors, nil)
+					return
+				}
+			}
+		}
+	}()
+	n.mu.Lock()
+	n.stop = func() {
+		close(stop)
+		<-done
+	}
+	n.mu.Unlock()
+}
+
+// Finish ends an attempt which returned err, sending the done event
+// unless it is going to be retried, and returns err.
+func (n *Notifier) Finish(ctx context.Context, err error) error {
+	if n == nil {
+		return err
+	}
+	n.mu.Lock()
+	stop := n.stop
+	n.stop = func() {}
+	n.mu.Unlock()
+	stop()
+	if n.attempts.Last(ctx, err) {
+		// The run is over, so the pools have nothing more to tell
+		for _, unregister := range n.hooks {
+			unregister()
+		}
+		n.send(ctx, EventDone, func(e *Event) {
+			if err != nil {
+				e.Error = err.Error()
+			}
+		})
+	}
+	n.sent.Wait()
+	return err
+}
+
+// send posts the event called kind, with the fields set by set, to the
+// webhooks in the background.
+func (n *Notifier) send(ctx context.Context, kind string, set func(e *Event)) {
+	stats := accounting.Stats(ctx)
+	e := Event{Event: kind, Info: n.attempts.Info()}
+	e.Duration = e.Time.Sub(e.Start).Truncate(time.Second).String()
+	e.Transfers = stats.GetTransfers()
+	e.Bytes = stats.GetBytes()
+	e.Errors = stats.GetErrors()
+	if lastErr := stats.GetLastError(); lastErr != nil {
+		e.Error = lastErr.Error()
+	}
+	if set != nil {
+		set(&e)
+	}
+	var message strings.Builder
+	if err := n.templates.ExecuteTemplate(&message, kind, e); err != nil {
+		fs.Errorf(nil, "Failed to make %s notification: %v", kind, err)
+		return
+	}
+	e.Message = message.String()
+	slack := map[string]string{"text": e.Message}
+	for _, rawURL := range n.opt.Webhooks {
+		n.post(ctx, rawURL, e)
+	}
+	for _, rawURL := range n.opt.Slack {
+		n.post(ctx, rawURL, slack)
+	}
+}
+
+// post posts body as JSON to rawURL in the background.
+func (n *Notifier) post(ctx context.Context, rawURL string, body any) {
+	n.sent.Add(1)
+	go func() {
+		defer n.sent.Done()
+		if err := n.postJSON(ctx, rawURL, body); err != nil {
+			fs.Errorf(nil, "Failed to send notification: %v", err)
+		}
+	}()
+}
+
+// postJSON posts body as JSON to rawURL.
+func (n *Notifier) postJSON(ctx context.Context, rawURL string, body any) error {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", rawURL, bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// The error has the URL, which is a secret for Slack
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("POST %s: %w", redact(rawURL), err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("POST %s: %s", redact(rawURL), resp.Status)
+	}
+	return nil
+}
+
+// redact returns rawURL without its path and query, which carry the
+// secrets of webhooks, for logging.
+func redact(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "webhook"
+	}
+	return u.Scheme + "://" + u.Host + "/..."
+}
@@ -0,0 +1,174 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receiver records what is posted to it by path.
+type receiver struct {
+	mu    gosync.Mutex
+	posts map[string][]map[string]any
+}
+
+func newReceiver(t *testing.T) (*receiver, *httptest.Server) {
+	r := &receiver{posts: map[string][]map[string]any{}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/broken" {
+			http.Error(w, "no", http.StatusForbidden)
+			return
+		}
+		body, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		var post map[string]any
+		require.NoError(t, json.Unmarshal(body, &post))
+		r.mu.Lock()
+		r.posts[req.URL.Path] = append(r.posts[req.URL.Path], post)
+		r.mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+	return r, server
+}
+
+func (r *receiver) get(path string) []map[string]any {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.posts[path]
+}
+
+func newFs(t *testing.T) (fsrc, fdst fs.Fs) {
+	ctx := context.Background()
+	fsrc, err := mockfs.NewFs(ctx, "src", "a", nil)
+	require.NoError(t, err)
+	fdst, err = mockfs.NewFs(ctx, "dst", "b", nil)
+	require.NoError(t, err)
+	return fsrc, fdst
+}
+
+func TestNil(t *testing.T) {
+	fsrc, fdst := newFs(t)
+	n, err := New(context.Background(), &Options{}, "copy", fsrc, fdst)
+	require.NoError(t, err)
+	assert.Nil(t, n)
+	n.Start(context.Background())
+	runErr := errors.New("failed")
+	assert.Equal(t, runErr, n.Finish(context.Background(), runErr))
+}
+
+func TestDone(t *testing.T) {
+	r, server := newReceiver(t)
+	fsrc, fdst := newFs(t)
+	ctx := accounting.WithStatsGroup(context.Background(), "TestDone")
+	opt := &Options{
+		Webhooks: []string{server.URL + "/hook", server.URL + "/broken"},
+		Slack:    []string{server.URL + "/slack"},
+	}
+	n, err := New(ctx, opt, "copy", fsrc, fdst)
+	require.NoError(t, err)
+	n.Start(ctx)
+	accounting.Stats(ctx).Bytes(2048)
+	require.NoError(t, n.Finish(ctx, nil))
+
+	hook := r.get("/hook")
+	require.Len(t, hook, 1)
+	assert.Equal(t, "done", hook[0]["event"])
+	assert.Equal(t, "copy", hook[0]["command"])
+	assert.Equal(t, "src:a", hook[0]["source"])
+	assert.Equal(t, "dst:b", hook[0]["destination"])
+	assert.Equal(t, float64(1), hook[0]["attempt"])
+	assert.Equal(t, float64(2048), hook[0]["bytes"])
+	assert.Equal(t, "eclone copy src:a -> dst:b finished after 0s: 0 files, 2 KiB transferred, 0 errors", hook[0]["message"])
+	assert.Equal(t, []map[string]any{{"text": hook[0]["message"]}}, r.get("/slack"))
+
+	// A failed run which won't be retried is notified with its error
+	ci := fs.GetConfig(ctx)
+	oldRetries := ci.Retries
+	ci.Retries = 1
+	defer func() { ci.Retries = oldRetries }()
+	n.Start(ctx)
+	require.Error(t, n.Finish(ctx, errors.New("quota exceeded")))
+	slack := r.get("/slack")
+	require.Len(t, slack, 2)
+	assert.Equal(t, "eclone copy src:a -> dst:b failed after 0s: 0 files, 2 KiB transferred, 0 errors\nError: quota exceeded", slack[1]["text"])
+}
+
+func TestRetried(t *testing.T) {
+	r, server := newReceiver(t)
+	fsrc, fdst := newFs(t)
+	ctx := accounting.WithStatsGroup(context.Background(), "TestRetried")
+	n, err := New(ctx, &Options{Slack: []string{server.URL + "/slack"}}, "sync", fsrc, fdst)
+	require.NoError(t, err)
+
+	// An attempt with retryable errors and attempts left isn't done
+	ci := fs.GetConfig(ctx)
+	oldRetries := ci.Retries
+	ci.Retries = 3
+	defer func() { ci.Retries = oldRetries }()
+	n.Start(ctx)
+	runErr := accounting.Stats(ctx).Error(fserrors.RetryError(errors.New("EOF")))
+	assert.Equal(t, runErr, n.Finish(ctx, runErr))
+	assert.Empty(t, r.get("/slack"))
+}
+
+func TestErrors(t *testing.T) {
+	oldInterval := errorsInterval
+	errorsInterval = 10 * time.Millisecond
+	defer func() { errorsInterval = oldInterval }()
+
+	r, server := newReceiver(t)
+	fsrc, fdst := newFs(t)
+	ctx := accounting.WithStatsGroup(context.Background(), "TestErrors")
+	n, err := New(ctx, &Options{Webhooks: []string{server.URL + "/hook"}, Errors: 2}, "migrate", fsrc, fdst)
+	require.NoError(t, err)
+	n.Start(ctx)
+	_ = accounting.Stats(ctx).Error(errors.New("first"))
+	_ = accounting.Stats(ctx).Error(errors.New("second"))
+	assert.Eventually(t, func() bool { return len(r.get("/hook")) == 1 }, time.Second, 10*time.Millisecond)
+	hook := r.get("/hook")
+	assert.Equal(t, "errors", hook[0]["event"])
+	assert.Equal(t, "eclone migrate src:a -> dst:b has had 2 errors in attempt 1, the last: second", hook[0]["message"])
+	n.mu.Lock()
+	stop := n.stop
+	n.stop = func() {}
+	n.mu.Unlock()
+	stop()
+	// Only notified once
+	assert.Len(t, r.get("/hook"), 1)
+}
+
+func TestTemplate(t *testing.T) {
+	r, server := newReceiver(t)
+	fsrc, fdst := newFs(t)
+	file := filepath.Join(t.TempDir(), "notify.tmpl")
+	require.NoError(t, os.WriteFile(file, []byte(`{{define "exhausted"}}:warning: *{{.Remote}}* is out of SAs{{end}}`), 0600))
+	ctx := context.Background()
+	n, err := New(ctx, &Options{Slack: []string{server.URL + "/slack"}, Template: file}, "copy", fsrc, fdst)
+	require.NoError(t, err)
+	n.send(ctx, EventExhausted, func(e *Event) { e.Remote = "gc:" })
+	n.sent.Wait()
+	assert.Equal(t, []map[string]any{{"text": ":warning: *gc:* is out of SAs"}}, r.get("/slack"))
+
+	_, err = New(ctx, &Options{Slack: []string{server.URL}, Template: file + ".missing"}, "copy", fsrc, fdst)
+	assert.ErrorContains(t, err, "failed to read notification templates")
+}
+
+func TestRedact(t *testing.T) {
+	assert.Equal(t, "https://hooks.slack.com/...", redact("https://hooks.slack.com/services/T0/B0/secret"))
+	assert.Equal(t, "webhook", redact("not a url"))
+}
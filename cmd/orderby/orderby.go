@@ -0,0 +1,54 @@
+// Package orderby provides the quota aware --order-by policy for the
+// commands transferring through a service account pool.
+//
+// With --order-by quota the transfers are ordered by size, and the share
+// of transfers working on the largest files follows the share of the
+// destination's service accounts which still have quota. A fresh pool
+// moves the big files first, while they can still complete, and as the
+// pool thins out more and more transfers go to the small files.
+//
+// The order is picked when a pass starts, as rclone can't change it
+// during one, so each retry picks it again.
+package orderby
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ebadenes/eclone/backend/drive"
+	"github.com/rclone/rclone/fs"
+)
+
+// Quota is the --order-by value selecting the quota aware order
+const Quota = "quota"
+
+// forPool returns the --order-by to use with available of total SAs
+// having quota.
+func forPool(available, total int) string {
+	if total <= 0 {
+		return "size,descending"
+	}
+	fresh := 100 * min(available, total) / total
+	// Transfers with a fraction below the mixed one take the smallest files
+	return fmt.Sprintf("size,mixed,%d", 100-fresh)
+}
+
+// Resolve returns ctx with --order-by quota replaced by the size order
+// suiting the pool of fdst now. Other orders are left alone.
+func Resolve(ctx context.Context, fdst fs.Fs) context.Context {
+	if fs.GetConfig(ctx).OrderBy != Quota {
+		return ctx
+	}
+	available, total := 0, 0
+	if f, ok := fdst.(*drive.Fs); ok && f.ServiceAccountFiles != nil {
+		available, total = f.ServiceAccountFiles.Available(), f.ServiceAccountFiles.Len()
+	}
+	ctx, ci := fs.AddConfig(ctx)
+	ci.OrderBy = forPool(available, total)
+	if total > 0 {
+		fs.Infof(fdst, "--order-by quota: %d of %d service accounts have quota - ordering by %q", available, total, ci.OrderBy)
+	} else {
+		fs.Infof(fdst, "--order-by quota: no service account pool - ordering by %q", ci.OrderBy)
+	}
+	return ctx
+}
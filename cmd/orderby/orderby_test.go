@@ -0,0 +1,42 @@
+package orderby
+
+import (
+	"context"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/memory"
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForPool(t *testing.T) {
+	for _, test := range []struct {
+		available, total int
+		want             string
+	}{
+		{0, 0, "size,descending"},
+		{10, 10, "size,mixed,0"},
+		{5, 10, "size,mixed,50"},
+		{1, 4, "size,mixed,75"},
+		{0, 10, "size,mixed,100"},
+	} {
+		assert.Equal(t, test.want, forPool(test.available, test.total), "%d/%d", test.available, test.total)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	f, err := fs.NewFs(context.Background(), ":memory:")
+	require.NoError(t, err)
+
+	// Other orders are left alone
+	ctx, ci := fs.AddConfig(context.Background())
+	ci.OrderBy = "name"
+	assert.Equal(t, ctx, Resolve(ctx, f))
+
+	// Without a pool the largest files go first
+	ci.OrderBy = Quota
+	got := Resolve(ctx, f)
+	assert.Equal(t, "size,descending", fs.GetConfig(got).OrderBy)
+	assert.Equal(t, Quota, ci.OrderBy)
+}
@@ -0,0 +1,142 @@
+// Package publish provides --publish for the commands writing a tree,
+// which builds the new tree beside the destination and swaps it in once
+// complete, so readers of the destination never see half of it.
+//
+// The destination folder DEST is seeded with a server side copy into the
+// hidden folder .DEST.publish beside it, and the transfer writes there.
+// When it succeeds the folders are swapped in two folder moves: DEST is
+// moved aside to .DEST.old, then .DEST.publish is moved to DEST, and the
+// old folder purged. Readers see either the whole of the old tree or the
+// whole of the new one, but DEST is missing for the moment between the
+// two moves. If the second move fails .DEST.old is moved back to DEST.
+//
+// A transfer which fails leaves .DEST.publish in place, and the next run
+// carries on with it.
+package publish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/sync"
+)
+
+// Suffixes of the hidden folders beside the destination
+const (
+	newSuffix = ".publish"
+	oldSuffix = ".old"
+)
+
+// Publish runs transfer into a hidden folder seeded with the content of
+// fdst, then swaps that folder in for fdst.
+func Publish(ctx context.Context, fdst fs.Fs, transfer func(ctx context.Context, fdst fs.Fs) error) error {
+	if fs.GetConfig(ctx).DryRun {
+		fs.Logf(fdst, "--publish: dry run so transferring to the destination directly")
+		return transfer(ctx, fdst)
+	}
+	parentPath, live, err := fspath.Split(fs.ConfigStringFull(fdst))
+	if err != nil {
+		return err
+	}
+	if live == "" {
+		return fmt.Errorf("--publish needs a folder to publish, not the root of %v", fdst)
+	}
+	parent, err := cache.Get(ctx, parentPath)
+	if err != nil {
+		return err
+	}
+	if parent.Features().DirMove == nil {
+		return fmt.Errorf("--publish needs a destination which can move folders, which %v can't", parent)
+	}
+	building := "." + live + newSuffix
+	fbuild, err := cache.Get(ctx, fspath.JoinRootPath(parentPath, building))
+	if err != nil {
+		return err
+	}
+
+	liveExists, err := dirExists(ctx, fdst, "")
+	if err != nil {
+		return err
+	}
+	if liveExists {
+		if err = seed(ctx, fbuild, fdst); err != nil {
+			return fmt.Errorf("--publish: failed to seed %q: %w", building, err)
+		}
+	}
+	if err = transfer(ctx, fbuild); err != nil {
+		return err
+	}
+	return swap(ctx, parent, live, liveExists)
+}
+
+// seed copies everything in fdst to fbuild, ignoring the filters as files
+// excluded from the transfer must still be published.
+func seed(ctx context.Context, fbuild, fdst fs.Fs) error {
+	everything, err := filter.NewFilter(&filter.Options{
+		// The defaults of filter.Opt
+		MinAge:  fs.DurationOff,
+		MaxAge:  fs.DurationOff,
+		MinSize: fs.SizeSuffix(-1),
+		MaxSize: fs.SizeSuffix(-1),
+	})
+	if err != nil {
+		return err
+	}
+	fs.Infof(fbuild, "--publish: seeding from %v", fdst)
+	return sync.CopyDir(filter.ReplaceConfig(ctx, everything), fbuild, fdst, true)
+}
+
+// swap moves the folder built beside live in parent into its place.
+func swap(ctx context.Context, parent fs.Fs, live string, liveExists bool) error {
+	doDirMove := parent.Features().DirMove
+	building, old := "."+live+newSuffix, "."+live+oldSuffix
+	// A run which failed to purge it leaves the old folder behind
+	if err := purge(ctx, parent, old); err != nil {
+		return err
+	}
+	if liveExists {
+		if err := doDirMove(ctx, parent, live, old); err != nil {
+			return fmt.Errorf("--publish: failed to move %q aside: %w", live, err)
+		}
+	}
+	if err := doDirMove(ctx, parent, building, live); err != nil {
+		if liveExists {
+			if undoErr := doDirMove(ctx, parent, old, live); undoErr != nil {
+				fs.Errorf(parent, "--publish: failed to move %q back to %q: %v", old, live, undoErr)
+			}
+		}
+		return fmt.Errorf("--publish: failed to move %q to %q: %w", building, live, err)
+	}
+	fs.Logf(parent, "--publish: published %q", live)
+	if err := purge(ctx, parent, old); err != nil {
+		fs.Errorf(parent, "--publish: %v", err)
+	}
+	return nil
+}
+
+// dirExists returns whether dir is in f.
+func dirExists(ctx context.Context, f fs.Fs, dir string) (bool, error) {
+	_, err := f.List(ctx, dir)
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// purge removes dir from f if it is there.
+func purge(ctx context.Context, f fs.Fs, dir string) error {
+	exists, err := dirExists(ctx, f, dir)
+	if err == nil && exists {
+		err = operations.Purge(ctx, f, dir)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove %q: %w", dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package publish
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// write makes file in dir with content
+func write(t *testing.T, dir, file, content string) {
+	t.Helper()
+	file = filepath.Join(dir, file)
+	require.NoError(t, os.MkdirAll(filepath.Dir(file), 0777))
+	require.NoError(t, os.WriteFile(file, []byte(content), 0666))
+}
+
+// entries returns the names in dir
+func entries(t *testing.T, dir string) (names []string) {
+	t.Helper()
+	list, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, entry := range list {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestPublish(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	live := filepath.Join(root, "live")
+	write(t, live, "kept.txt", "kept")
+	write(t, live, "sub/old.txt", "old")
+	fdst, err := fs.NewFs(ctx, live)
+	require.NoError(t, err)
+
+	// A failed transfer leaves the live folder alone
+	failed := errors.New("failed")
+	err = Publish(ctx, fdst, func(ctx context.Context, fbuild fs.Fs) error {
+		write(t, filepath.Join(root, ".live.publish"), "new.txt", "half")
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+	assert.Equal(t, []string{"kept.txt", "sub"}, entries(t, live))
+
+	// The next run carries on from the seeded folder, which the
+	// filters don't apply to
+	ctx, fi := filter.AddConfig(ctx)
+	require.NoError(t, fi.AddRule("- kept.txt"))
+	err = Publish(ctx, fdst, func(ctx context.Context, fbuild fs.Fs) error {
+		assert.Equal(t, []string{"kept.txt", "new.txt", "sub"}, entries(t, filepath.Join(root, ".live.publish")))
+		assert.Equal(t, []string{"kept.txt", "sub"}, entries(t, live), "live changed before the transfer finished")
+		write(t, filepath.Join(root, ".live.publish"), "new.txt", "new")
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"live"}, entries(t, root))
+	assert.Equal(t, []string{"kept.txt", "new.txt", "sub"}, entries(t, live))
+	content, err := os.ReadFile(filepath.Join(live, "new.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(content))
+
+	// A destination which isn't there yet is just moved into place
+	fnew, err := fs.NewFs(ctx, filepath.Join(root, "fresh"))
+	require.NoError(t, err)
+	err = Publish(ctx, fnew, func(ctx context.Context, fbuild fs.Fs) error {
+		write(t, filepath.Join(root, ".fresh.publish"), "first.txt", "first")
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first.txt"}, entries(t, filepath.Join(root, "fresh")))
+	assert.Equal(t, []string{"fresh", "live"}, entries(t, root))
+}
+
+func TestSwapMovesBack(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	write(t, filepath.Join(root, "live"), "old.txt", "old")
+	write(t, filepath.Join(root, ".live.publish"), "new.txt", "new")
+	parent, err := fs.NewFs(ctx, root)
+	require.NoError(t, err)
+	dirMove := parent.Features().DirMove
+	failed := errors.New("failed")
+	parent.Features().DirMove = func(ctx context.Context, src fs.Fs, srcRemote, dstRemote string) error {
+		if srcRemote == ".live.publish" {
+			return failed
+		}
+		return dirMove(ctx, src, srcRemote, dstRemote)
+	}
+	err = swap(ctx, parent, "live", true)
+	assert.ErrorIs(t, err, failed)
+	assert.Equal(t, []string{".live.publish", "live"}, entries(t, root))
+	assert.Equal(t, []string{"old.txt"}, entries(t, filepath.Join(root, "live")))
+}
@@ -0,0 +1,575 @@
+// Package queue runs rc commands from a persistent queue for the rcd
+// command's --queue-file.
+//
+// A controller adds jobs with queue/add, each an rc command with its
+// parameters, a priority and the jobs which must succeed before it, and
+// the daemon runs them --queue-max-jobs at a time, highest priority
+// first, then oldest first. Every job is kept in a bbolt database, so
+// the queue survives restarts: jobs which were running are run again
+// from the start, which copies and syncs tolerate.
+package queue
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/rc/jobs"
+	bolt "go.etcd.io/bbolt"
+)
+
+// States of the jobs in the queue
+const (
+	Queued    = "queued"
+	Running   = "running"
+	Done      = "done"
+	Failed    = "failed"
+	Cancelled = "cancelled"
+)
+
+// databaseLockTimeout is how long to wait for another daemon to close
+// the queue
+const databaseLockTimeout = 5 * time.Second
+
+// queueBucket is the bucket holding the jobs
+var queueBucket = []byte("jobs")
+
+// Item is a job in the queue.
+type Item struct {
+	ID       int64     `json:"id"`
+	Command  string    `json:"command"`
+	Params   rc.Params `json:"params,omitempty"`
+	Priority int64     `json:"priority"`
+	After    []int64   `json:"after,omitempty"` // jobs which must be done first
+	State    string    `json:"state"`
+	Added    time.Time `json:"added"`
+	Started  time.Time `json:"started"`
+	Ended    time.Time `json:"ended"`
+	JobID    int64     `json:"jobId,omitempty"` // rc job of the last run
+	Error    string    `json:"error,omitempty"`
+}
+
+// finished returns true if item won't run again.
+func (item *Item) finished() bool {
+	return item.State == Done || item.State == Failed || item.State == Cancelled
+}
+
+// Queue runs the jobs in a persistent queue.
+type Queue struct {
+	db      *bolt.DB
+	maxJobs int
+	wake    chan struct{}
+	wg      sync.WaitGroup // running jobs
+
+	mu       sync.Mutex // protects the fields below
+	items    map[int64]*Item
+	running  int
+	cancels  map[int64]context.CancelFunc // of the running jobs
+	stopping map[int64]bool               // running jobs being cancelled
+}
+
+// Open opens the queue in file, to run maxJobs jobs at a time, putting
+// the jobs which were running back in the queue.
+func Open(file string, maxJobs int) (*Queue, error) {
+	if maxJobs < 1 {
+		return nil, errors.New("need to run at least one job at a time")
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(file, 0600, &bolt.Options{Timeout: databaseLockTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open queue: %w", err)
+	}
+	q := &Queue{
+		db:       db,
+		maxJobs:  maxJobs,
+		wake:     make(chan struct{}, 1),
+		items:    map[int64]*Item{},
+		cancels:  map[int64]context.CancelFunc{},
+		stopping: map[int64]bool{},
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(queueBucket)
+		if err != nil {
+			return err
+		}
+		return b.ForEach(func(key, value []byte) error {
+			item := new(Item)
+			if err := json.Unmarshal(value, item); err != nil {
+				return fmt.Errorf("corrupt queue record %x: %w", key, err)
+			}
+			if item.State == Running {
+				fs.Logf(nil, "Queue: job %d was running - queueing it again", item.ID)
+				item.State = Queued
+			}
+			q.items[item.ID] = item
+			return nil
+		})
+	})
+	if err == nil {
+		// Save the jobs put back in the queue
+		for _, item := range q.items {
+			if item.State == Queued {
+				if err = q.save(item); err != nil {
+					break
+				}
+			}
+		}
+	}
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to read queue: %w", err)
+	}
+	return q, nil
+}
+
+// Close closes the queue database.
+func (q *Queue) Close() error {
+	return q.db.Close()
+}
+
+// save writes item to the database.
+func (q *Queue) save(item *Item) error {
+	value, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return q.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(queueBucket).Put(binary.BigEndian.AppendUint64(nil, uint64(item.ID)), value)
+	})
+}
+
+// kick wakes the loop starting the jobs.
+func (q *Queue) kick() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Add adds a job running command with params to the queue, to run once
+// the jobs in after are done, and returns it.
+func (q *Queue) Add(command string, params rc.Params, priority int64, after []int64) (*Item, error) {
+	if rc.Calls.Get(command) == nil {
+		return nil, fmt.Errorf("unknown command %q", command)
+	}
+	if _, ok := params["_async"]; ok {
+		return nil, errors.New("_async can't be set")
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, id := range after {
+		if q.items[id] == nil {
+			return nil, fmt.Errorf("no job %d to run after", id)
+		}
+	}
+	item := &Item{
+		Command:  command,
+		Params:   params,
+		Priority: priority,
+		After:    after,
+		State:    Queued,
+		Added:    time.Now(),
+	}
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		seq, err := tx.Bucket(queueBucket).NextSequence()
+		item.ID = int64(seq)
+		return err
+	})
+	if err == nil {
+		err = q.save(item)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to add job: %w", err)
+	}
+	q.items[item.ID] = item
+	q.kick()
+	return item, nil
+}
+
+// List returns copies of the jobs in the queue in state, or all of them
+// if state is empty, by ID.
+func (q *Queue) List(state string) []Item {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var items []Item
+	for _, item := range q.items {
+		if state == "" || item.State == state {
+			items = append(items, *item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return items
+}
+
+// Cancel cancels the job with id, stopping it if it is running.
+func (q *Queue) Cancel(id int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	item := q.items[id]
+	switch {
+	case item == nil:
+		return fmt.Errorf("no job %d", id)
+	case item.finished():
+		return fmt.Errorf("job %d is already %s", id, item.State)
+	case item.State == Running:
+		// The job is marked cancelled when it returns
+		q.stopping[id] = true
+		q.cancels[id]()
+		return nil
+	}
+	item.State, item.Ended = Cancelled, time.Now()
+	q.kick()
+	return q.save(item)
+}
+
+// Clear removes the finished jobs from the queue, bar those others
+// still wait for, and returns how many were removed.
+func (q *Queue) Clear() (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	needed := map[int64]bool{}
+	for _, item := range q.items {
+		if !item.finished() {
+			for _, id := range item.After {
+				needed[id] = true
+			}
+		}
+	}
+	var ids []int64
+	for id, item := range q.items {
+		if item.finished() && !needed[id] {
+			ids = append(ids, id)
+		}
+	}
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(queueBucket)
+		for _, id := range ids {
+			if err := b.Delete(binary.BigEndian.AppendUint64(nil, uint64(id))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		delete(q.items, id)
+	}
+	return len(ids), nil
+}
+
+// ready returns the state a queued item can move to given the jobs it
+// waits for: Running if they are done, Failed if one can't be, with the
+// reason, or Queued.
+func (q *Queue) ready(item *Item) (state string, reason string) {
+	for _, id := range item.After {
+		dep := q.items[id]
+		switch {
+		case dep == nil:
+			return Failed, fmt.Sprintf("job %d it waits for is gone", id)
+		case dep.State == Failed || dep.State == Cancelled:
+			return Failed, fmt.Sprintf("job %d it waits for is %s", id, dep.State)
+		case dep.State != Done:
+			return Queued, ""
+		}
+	}
+	return Running, ""
+}
+
+// next returns the next job to start, or nil, failing those waiting for
+// jobs which failed. Call with q.mu held.
+func (q *Queue) next() *Item {
+	var best *Item
+	for {
+		failedAny := false
+		best = nil
+		for _, item := range q.items {
+			if item.State != Queued {
+				continue
+			}
+			state, reason := q.ready(item)
+			switch state {
+			case Failed:
+				item.State, item.Error, item.Ended = Failed, reason, time.Now()
+				fs.Errorf(nil, "Queue: job %d failed: %s", item.ID, reason)
+				if err := q.save(item); err != nil {
+					fs.Errorf(nil, "Queue: failed to save job %d: %v", item.ID, err)
+				}
+				failedAny = true
+			case Running:
+				if best == nil || item.Priority > best.Priority || (item.Priority == best.Priority && item.ID < best.ID) {
+					best = item
+				}
+			}
+		}
+		// Failing a job may fail those waiting for it
+		if !failedAny {
+			return best
+		}
+	}
+}
+
+// start runs item in the background. Call with q.mu held.
+func (q *Queue) start(ctx context.Context, item *Item) {
+	item.State, item.Started, item.Error = Running, time.Now(), ""
+	item.Ended, item.JobID = time.Time{}, 0
+	if err := q.save(item); err != nil {
+		fs.Errorf(nil, "Queue: failed to save job %d: %v", item.ID, err)
+	}
+	q.running++
+	jobCtx, cancel := context.WithCancel(ctx)
+	q.cancels[item.ID] = cancel
+	call := rc.Calls.Get(item.Command)
+	params := item.Params.Copy()
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		defer cancel()
+		fs.Infof(nil, "Queue: starting job %d: %s", item.ID, item.Command)
+		var err error
+		if call == nil {
+			err = fmt.Errorf("unknown command %q", item.Command)
+		} else {
+			_, _, err = jobs.NewJob(jobCtx, func(ctx context.Context, in rc.Params) (rc.Params, error) {
+				// Show the rc job while it runs
+				if job, ok := jobs.GetJob(ctx); ok {
+					q.mu.Lock()
+					item.JobID = job.ID
+					q.mu.Unlock()
+				}
+				return call.Fn(ctx, in)
+			}, params)
+		}
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		q.running--
+		stopping := q.stopping[item.ID]
+		delete(q.cancels, item.ID)
+		delete(q.stopping, item.ID)
+		item.Ended = time.Now()
+		switch {
+		case ctx.Err() != nil:
+			// Shutting down: leave it to be run again
+			item.State = Queued
+		case stopping:
+			item.State, item.Error = Cancelled, "cancelled while running"
+		case err != nil:
+			item.State, item.Error = Failed, err.Error()
+			fs.Errorf(nil, "Queue: job %d failed: %v", item.ID, err)
+		default:
+			item.State = Done
+			fs.Infof(nil, "Queue: job %d done in %v", item.ID, item.Ended.Sub(item.Started).Round(time.Second))
+		}
+		if err := q.save(item); err != nil {
+			fs.Errorf(nil, "Queue: failed to save job %d: %v", item.ID, err)
+		}
+		q.kick()
+	}()
+}
+
+// startReady starts jobs until maxJobs are running or none is ready.
+func (q *Queue) startReady(ctx context.Context) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.running < q.maxJobs {
+		item := q.next()
+		if item == nil {
+			return
+		}
+		q.start(ctx, item)
+	}
+}
+
+var (
+	activeMu sync.Mutex
+	active   *Queue // the running queue, for the rc
+)
+
+// Run runs the jobs in the queue as they become ready until ctx is done,
+// then waits for those running, which are put back in the queue.
+func (q *Queue) Run(ctx context.Context) {
+	activeMu.Lock()
+	active = q
+	activeMu.Unlock()
+	defer func() {
+		activeMu.Lock()
+		active = nil
+		activeMu.Unlock()
+		q.wg.Wait()
+	}()
+	for {
+		q.startReady(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		}
+	}
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:  "queue/add",
+		Fn:    rcAdd,
+		Title: "Add a job to the queue of the daemon",
+		Help: `
+Adds an rc command to the persistent queue of an rcd started with
+--queue-file, to run once a slot is free, highest priority first, then
+oldest first.
+
+Params:
+  - command = the rc command to run, eg sync/copy
+  - params = its parameters, as a JSON object (optional)
+  - priority = jobs with a higher priority run first (optional, default 0)
+  - after = IDs of the jobs which must be done first, as a JSON list (optional)
+
+Returns:
+  - id = the ID of the job in the queue
+
+A job waiting for one which fails or is cancelled fails too.
+
+Eg
+
+    eclone rc queue/add command=sync/copy params='{"srcFs":"gc:{id}/a","dstFs":"gc:{id2}/a"}'
+    eclone rc queue/add command=operations/check priority=5 after='[1]' params='{"srcFs":"gc:{id}/a","dstFs":"gc:{id2}/a"}'
+`,
+	})
+	rc.Add(rc.Call{
+		Path:  "queue/list",
+		Fn:    rcList,
+		Title: "List the jobs in the queue of the daemon",
+		Help: `
+Lists the jobs in the queue with their command, parameters, priority,
+the jobs they wait for, state, times, the rc job of their last run and
+its error.
+
+Params:
+  - state = only list the jobs queued, running, done, failed or cancelled (optional)
+
+Eg
+
+    eclone rc queue/list state=failed
+`,
+	})
+	rc.Add(rc.Call{
+		Path:  "queue/cancel",
+		Fn:    rcCancel,
+		Title: "Cancel a job in the queue of the daemon",
+		Help: `
+Cancels a queued job, or stops a running one.
+
+Params:
+  - id = the ID of the job in the queue
+
+Eg
+
+    eclone rc queue/cancel id=12
+`,
+	})
+	rc.Add(rc.Call{
+		Path:  "queue/clear",
+		Fn:    rcClear,
+		Title: "Remove the finished jobs from the queue of the daemon",
+		Help: `
+Removes the jobs which are done, failed or cancelled from the queue,
+bar those others still wait for.
+
+Returns:
+  - removed = how many jobs were removed
+
+Eg
+
+    eclone rc queue/clear
+`,
+	})
+}
+
+// getActive returns the running queue.
+func getActive() (*Queue, error) {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	if active == nil {
+		return nil, errors.New("no queue - start rcd with --queue-file")
+	}
+	return active, nil
+}
+
+// rcAdd implements the queue/add rc call.
+func rcAdd(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	q, err := getActive()
+	if err != nil {
+		return nil, err
+	}
+	command, err := in.GetString("command")
+	if err != nil {
+		return nil, err
+	}
+	params := rc.Params{}
+	if err = in.GetStructMissingOK("params", &params); err != nil {
+		return nil, err
+	}
+	priority, err := in.GetInt64("priority")
+	if err != nil && !rc.IsErrParamNotFound(err) {
+		return nil, err
+	}
+	var after []int64
+	if err = in.GetStructMissingOK("after", &after); err != nil {
+		return nil, err
+	}
+	item, err := q.Add(command, params, priority, after)
+	if err != nil {
+		return nil, err
+	}
+	return rc.Params{"id": item.ID}, nil
+}
+
+// rcList implements the queue/list rc call.
+func rcList(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	q, err := getActive()
+	if err != nil {
+		return nil, err
+	}
+	state, err := in.GetString("state")
+	if err != nil && !rc.IsErrParamNotFound(err) {
+		return nil, err
+	}
+	return rc.Params{"jobs": q.List(state)}, nil
+}
+
+// rcCancel implements the queue/cancel rc call.
+func rcCancel(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	q, err := getActive()
+	if err != nil {
+		return nil, err
+	}
+	id, err := in.GetInt64("id")
+	if err != nil {
+		return nil, err
+	}
+	return rc.Params{}, q.Cancel(id)
+}
+
+// rcClear implements the queue/clear rc call.
+func rcClear(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	q, err := getActive()
+	if err != nil {
+		return nil, err
+	}
+	removed, err := q.Clear()
+	if err != nil {
+		return nil, err
+	}
+	return rc.Params{"removed": removed}, nil
+}
@@ -0,0 +1,209 @@
+package queue
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// block is closed to let the queue/test-block jobs finish
+var block chan struct{}
+
+func init() {
+	rc.Add(rc.Call{
+		Path: "queue/test-block",
+		Fn: func(ctx context.Context, in rc.Params) (rc.Params, error) {
+			select {
+			case <-block:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			return rc.Params{}, nil
+		},
+	})
+}
+
+// states returns the states of the jobs in q by ID.
+func states(q *Queue) map[int64]string {
+	states := map[int64]string{}
+	for _, item := range q.List("") {
+		states[item.ID] = item.State
+	}
+	return states
+}
+
+// waitFor waits until the job with id in q is in state.
+func waitFor(t *testing.T, q *Queue, id int64, state string) {
+	require.Eventually(t, func() bool { return states(q)[id] == state }, 5*time.Second, time.Millisecond, "job %d %s", id, state)
+}
+
+func TestQueueRun(t *testing.T) {
+	block = make(chan struct{})
+	q, err := Open(filepath.Join(t.TempDir(), "queue.db"), 2)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, q.Close()) }()
+
+	_, err = q.Add("no/such", nil, 0, nil)
+	assert.Error(t, err)
+	_, err = q.Add("rc/noop", rc.Params{"_async": true}, 0, nil)
+	assert.Error(t, err)
+	_, err = q.Add("rc/noop", nil, 0, []int64{99})
+	assert.Error(t, err)
+
+	a, err := q.Add("rc/noop", rc.Params{"a": 1}, 0, nil)
+	require.NoError(t, err)
+	b, err := q.Add("rc/error", nil, 0, nil)
+	require.NoError(t, err)
+	c, err := q.Add("rc/noop", nil, 0, []int64{a.ID})
+	require.NoError(t, err)
+	d, err := q.Add("rc/noop", nil, 0, []int64{b.ID})
+	require.NoError(t, err)
+	e, err := q.Add("rc/noop", nil, 0, []int64{d.ID})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+	waitFor(t, q, c.ID, Done)
+	waitFor(t, q, e.ID, Failed)
+	assert.Equal(t, map[int64]string{a.ID: Done, b.ID: Failed, c.ID: Done, d.ID: Failed, e.ID: Failed}, states(q))
+	items := q.List(Failed)
+	require.Len(t, items, 3)
+	assert.Contains(t, items[1].Error, "is failed")
+	assert.NotZero(t, q.List(Done)[0].JobID)
+
+	// Nothing is removed which a job still waits for
+	f, err := q.Add("queue/test-block", nil, 0, []int64{c.ID})
+	require.NoError(t, err)
+	waitFor(t, q, f.ID, Running)
+	removed, err := q.Clear()
+	require.NoError(t, err)
+	assert.Equal(t, 4, removed)
+	assert.Equal(t, map[int64]string{c.ID: Done, f.ID: Running}, states(q))
+
+	require.NoError(t, q.Cancel(f.ID))
+	waitFor(t, q, f.ID, Cancelled)
+	assert.Error(t, q.Cancel(f.ID))
+	cancel()
+	<-done
+}
+
+func TestQueueNext(t *testing.T) {
+	q, err := Open(filepath.Join(t.TempDir(), "queue.db"), 1)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, q.Close()) }()
+	low, err := q.Add("rc/noop", nil, 0, nil)
+	require.NoError(t, err)
+	high, err := q.Add("rc/noop", nil, 5, nil)
+	require.NoError(t, err)
+	high2, err := q.Add("rc/noop", nil, 5, nil)
+	require.NoError(t, err)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	assert.Equal(t, high.ID, q.next().ID)
+	q.items[high.ID].State = Done
+	assert.Equal(t, high2.ID, q.next().ID)
+	q.items[high2.ID].State = Cancelled
+	assert.Equal(t, low.ID, q.next().ID)
+}
+
+func TestQueuePersists(t *testing.T) {
+	block = make(chan struct{})
+	file := filepath.Join(t.TempDir(), "queue.db")
+	q, err := Open(file, 1)
+	require.NoError(t, err)
+	a, err := q.Add("queue/test-block", nil, 0, nil)
+	require.NoError(t, err)
+	b, err := q.Add("rc/noop", rc.Params{"x": "y"}, 3, []int64{a.ID})
+	require.NoError(t, err)
+	cancelled, err := q.Add("rc/noop", nil, 0, []int64{a.ID})
+	require.NoError(t, err)
+	require.NoError(t, q.Cancel(cancelled.ID))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+	waitFor(t, q, a.ID, Running)
+	// Stopping the daemon puts the running job back in the queue
+	cancel()
+	<-done
+	assert.Equal(t, Queued, states(q)[a.ID])
+
+	// As does a crash
+	q.items[a.ID].State = Running
+	require.NoError(t, q.save(q.items[a.ID]))
+	require.NoError(t, q.Close())
+
+	q, err = Open(file, 1)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, q.Close()) }()
+	assert.Equal(t, map[int64]string{a.ID: Queued, b.ID: Queued, cancelled.ID: Cancelled}, states(q))
+	items := q.List(Queued)
+	require.Len(t, items, 2)
+	assert.Equal(t, rc.Params{"x": "y"}, items[1].Params)
+	assert.Equal(t, int64(3), items[1].Priority)
+	assert.Equal(t, []int64{a.ID}, items[1].After)
+
+	// New IDs carry on from the old ones
+	c, err := q.Add("rc/noop", nil, 0, nil)
+	require.NoError(t, err)
+	assert.Greater(t, c.ID, cancelled.ID)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	done = make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+	close(block)
+	waitFor(t, q, b.ID, Done)
+	cancel()
+	<-done
+}
+
+func TestRC(t *testing.T) {
+	_, err := rcList(context.Background(), rc.Params{})
+	assert.ErrorContains(t, err, "--queue-file")
+
+	q, err := Open(filepath.Join(t.TempDir(), "queue.db"), 1)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, q.Close()) }()
+	activeMu.Lock()
+	active = q
+	activeMu.Unlock()
+	defer func() {
+		activeMu.Lock()
+		active = nil
+		activeMu.Unlock()
+	}()
+
+	out, err := rcAdd(context.Background(), rc.Params{"command": "rc/noop", "params": `{"a":"b"}`})
+	require.NoError(t, err)
+	id := out["id"].(int64)
+	require.Equal(t, int64(1), id)
+	_, err = rcAdd(context.Background(), rc.Params{"command": "rc/noop", "priority": "2", "after": "[1]"})
+	require.NoError(t, err)
+	out, err = rcList(context.Background(), rc.Params{"state": Queued})
+	require.NoError(t, err)
+	items := out["jobs"].([]Item)
+	require.Len(t, items, 2)
+	assert.Equal(t, rc.Params{"a": "b"}, items[0].Params)
+	assert.Equal(t, []int64{id}, items[1].After)
+
+	_, err = rcCancel(context.Background(), rc.Params{"id": id})
+	require.NoError(t, err)
+	out, err = rcClear(context.Background(), rc.Params{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, out["removed"], "job 2 still waits for it")
+}
@@ -0,0 +1,184 @@
+// Package quotaretry retries the files which failed with Drive quota
+// errors once the rest of a copy, sync or move is done, for
+// --quota-retry.
+//
+// A long run can go through the quota of several service accounts, and
+// the files which fail while the pool switches account fail for good,
+// leaving a second run to find them. With --quota-retry the files which
+// failed with a quota error are collected and transferred again, once,
+// at the end of the run, by which time the pool has moved on to accounts
+// with quota left. If they all make it the errors they caused are taken
+// off the stats, so the run only fails if something else did.
+package quotaretry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/ebadenes/eclone/backend/drive"
+	"github.com/ebadenes/eclone/cmd/finished"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/spf13/pflag"
+)
+
+// Options are the quota retry flags.
+type Options struct {
+	Retry bool        // retry the files which failed with quota errors
+	Wait  fs.Duration // how long to wait before retrying
+}
+
+// AddFlags adds the quota retry flags to flagSet.
+func AddFlags(flagSet *pflag.FlagSet, opt *Options) {
+	flags.BoolVarP(flagSet, &opt.Retry, "quota-retry", "", opt.Retry, "Retry files which failed with Drive quota errors at the end of the run", "")
+	flags.FVarP(flagSet, &opt.Wait, "quota-retry-wait", "", "Time to wait before the quota retry pass", "")
+}
+
+// Help returns the help of the quota retry flags, to append to the help
+// of the commands.
+func Help() string {
+	return strings.ReplaceAll(`### Retrying quota failures
+
+With |--quota-retry| files which fail because a Google Drive quota or
+rate limit ran out are collected and transferred again once the rest
+of the run is done, by which time the service account pool has moved
+on to accounts with quota left. Use |--quota-retry-wait| to wait first,
+e.g. for the quota to reset. If they all make it the run only fails if
+something else did.
+`, "|", "`")
+}
+
+// failures collects the source files which failed with a quota error.
+type failures struct {
+	mu     gosync.Mutex
+	files  map[string]struct{}
+	errors int64 // errors counted in the stats for them
+}
+
+func newFailures() *failures {
+	return &failures{files: make(map[string]struct{})}
+}
+
+// finished records the file of tr if its transfer failed with a quota
+// error.
+func (q *failures) finished(tr accounting.TransferSnapshot) {
+	if (tr.What == "transferring" || tr.What == "moving") && drive.IsQuotaError(tr.Error) {
+		q.add(tr.Name)
+	}
+}
+
+// add records remote as having failed with a quota error, which was
+// counted as an error in the stats.
+func (q *failures) add(remote string) {
+	q.mu.Lock()
+	q.files[remote] = struct{}{}
+	q.errors++
+	q.mu.Unlock()
+}
+
+// has returns true if remote is recorded as having failed.
+func (q *failures) has(remote string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, ok := q.files[remote]
+	return ok
+}
+
+// take returns the files collected so far, sorted, and the number of
+// errors they caused, and forgets them.
+func (q *failures) take() (files []string, errors int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	files = make([]string, 0, len(q.files))
+	for file := range q.files {
+		files = append(files, file)
+	}
+	errors = q.errors
+	q.files = make(map[string]struct{})
+	q.errors = 0
+	sort.Strings(files)
+	return files, errors
+}
+
+// Run calls fn and, with --quota-retry, then calls retry with the files
+// which failed with quota errors. srcFileName is the file fn transfers,
+// if it transfers only one.
+//
+// The failures are collected from the transfers finishing in the stats,
+// as a logger of the operations would make copy list the directories
+// only on the destination too.
+func Run(ctx context.Context, opt *Options, srcFileName string, fn func(ctx context.Context) error, retry func(ctx context.Context, files []string) error) error {
+	if !opt.Retry {
+		return fn(ctx)
+	}
+	q := newFailures()
+	watcher := finished.Watch(ctx, q.finished)
+	err := fn(ctx)
+	watcher.Stop()
+	if srcFileName != "" && drive.IsQuotaError(err) && !q.has(srcFileName) {
+		// Single files can fail before their transfer starts
+		q.add(srcFileName)
+	}
+	return q.retry(ctx, opt, retry, err)
+}
+
+// retry calls retry with the files in q, once, after waiting opt.Wait.
+// By then the drive backend will have moved on to service accounts which
+// still have quota.
+//
+// If every file makes it the errors they caused are taken off the stats,
+// and firstErr is dropped if no other error is left.
+func (q *failures) retry(ctx context.Context, opt *Options, retry func(ctx context.Context, files []string) error, firstErr error) error {
+	files, quotaErrors := q.take()
+	if len(files) == 0 {
+		return firstErr
+	}
+	fs.Logf(nil, "Retrying %d file(s) which failed with quota errors", len(files))
+	if opt.Wait > 0 {
+		fs.Logf(nil, "Waiting %v before retrying", opt.Wait)
+		select {
+		case <-ctx.Done():
+			return firstErr
+		case <-time.After(time.Duration(opt.Wait)):
+		}
+	}
+	watcher := finished.Watch(ctx, q.finished)
+	err := retry(ctx, files)
+	watcher.Stop()
+	if err != nil {
+		return err
+	}
+	if left, _ := q.take(); len(left) > 0 {
+		return fmt.Errorf("%d file(s) still failed with quota errors after retrying", len(left))
+	}
+	fs.Logf(nil, "Quota retry transferred all %d file(s)", len(files))
+	stats := accounting.Stats(ctx)
+	stats.Errors(-min(quotaErrors, stats.GetErrors()))
+	if stats.GetErrors() > 0 {
+		return firstErr
+	}
+	// Everything that went wrong has now been transferred
+	stats.ResetErrors()
+	return nil
+}
+
+// Only returns ctx with a filter letting through files and nothing else,
+// for a retry to transfer only those.
+func Only(ctx context.Context, files []string) (context.Context, error) {
+	fi, err := filter.NewFilter(nil)
+	if err != nil {
+		return nil, fmt.Errorf("quota retry: %w", err)
+	}
+	for _, file := range files {
+		if err := fi.AddFile(file); err != nil {
+			return nil, fmt.Errorf("quota retry: %w", err)
+		}
+	}
+	return filter.ReplaceConfig(ctx, fi), nil
+}
@@ -0,0 +1,127 @@
+package quotaretry
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+)
+
+var errQuota = &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded", Message: "User rate limit exceeded."}}}
+
+// snapshot returns the snapshot of a transfer, or check with what set,
+// of remote which finished with err.
+func snapshot(remote, what string, err error) accounting.TransferSnapshot {
+	if what == "" {
+		what = "transferring"
+	}
+	return accounting.TransferSnapshot{Name: remote, What: what, Error: err}
+}
+
+func TestFailuresFinished(t *testing.T) {
+	q := newFailures()
+	q.finished(snapshot("b.txt", "", errQuota))
+	q.finished(snapshot("a.txt", "", errQuota))
+	q.finished(snapshot("a.txt", "moving", errQuota))
+	q.finished(snapshot("c.txt", "", errors.New("other")))
+	q.finished(snapshot("d.txt", "", nil))
+	q.finished(snapshot("e.txt", "checking", errQuota))
+	assert.True(t, q.has("a.txt"))
+	assert.False(t, q.has("c.txt"))
+	files, errs := q.take()
+	assert.Equal(t, []string{"a.txt", "b.txt"}, files)
+	assert.Equal(t, int64(3), errs)
+	files, errs = q.take()
+	assert.Empty(t, files)
+	assert.Zero(t, errs)
+}
+
+// failWith returns a transfer which fails each of files with a quota
+// error, counting it in the stats, and returns err.
+func failWith(err error, files ...string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		for _, file := range files {
+			tr := accounting.Stats(ctx).NewTransferRemoteSize(file, 1, nil, nil)
+			tr.Done(ctx, errQuota)
+		}
+		return err
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	accounting.NewStatsGroup(ctx, "TestRun")
+	ctx = accounting.WithStatsGroup(ctx, "TestRun")
+	stats := accounting.Stats(ctx)
+	firstErr := errors.New("first pass failed")
+	opt := &Options{Retry: true}
+
+	// Off
+	called := false
+	err := Run(ctx, &Options{}, "", failWith(firstErr), func(ctx context.Context, files []string) error {
+		called = true
+		return nil
+	})
+	assert.Equal(t, firstErr, err)
+	assert.False(t, called)
+
+	// Nothing to retry, and no logger which would change what copy lists
+	err = Run(ctx, opt, "", func(ctx context.Context) error {
+		_, usingLogger := operations.GetLogger(ctx)
+		assert.False(t, usingLogger)
+		return firstErr
+	}, nil)
+	assert.Equal(t, firstErr, err)
+
+	// The retry gets the failed files and clears their errors
+	var retried []string
+	err = Run(ctx, opt, "", failWith(firstErr, "dir/a.txt", "dir/b.txt"), func(ctx context.Context, files []string) error {
+		retried = files
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dir/a.txt", "dir/b.txt"}, retried)
+	assert.False(t, stats.Errored())
+
+	// Other errors are left in place
+	stats.Error(errors.New("other"))
+	err = Run(ctx, opt, "", failWith(firstErr, "a.txt"), func(ctx context.Context, files []string) error {
+		return nil
+	})
+	assert.Equal(t, firstErr, err)
+	assert.Equal(t, int64(1), stats.GetErrors())
+	stats.ResetErrors()
+
+	// Files failing again are reported
+	err = Run(ctx, opt, "", failWith(firstErr, "a.txt"), func(ctx context.Context, files []string) error {
+		return failWith(nil, files...)(ctx)
+	})
+	assert.ErrorContains(t, err, "1 file(s) still failed")
+	stats.ResetErrors()
+
+	// A single file failing with a quota error is retried
+	retried = nil
+	err = Run(ctx, opt, "file.txt", func(ctx context.Context) error {
+		return stats.Error(errQuota)
+	}, func(ctx context.Context, files []string) error {
+		retried = files
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"file.txt"}, retried)
+	assert.False(t, stats.Errored())
+}
+
+func TestOnly(t *testing.T) {
+	ctx, err := Only(context.Background(), []string{"dir/a.txt"})
+	require.NoError(t, err)
+	fi := filter.GetConfig(ctx)
+	assert.True(t, fi.IncludeRemote("dir/a.txt"))
+	assert.False(t, fi.IncludeRemote("dir/b.txt"))
+}
@@ -0,0 +1,171 @@
+// Package rcd provides the rcd command.
+package rcd
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ebadenes/eclone/cmd/events"
+	"github.com/ebadenes/eclone/cmd/queue"
+	"github.com/ebadenes/eclone/cmd/sdnotify"
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/rc/rcflags"
+	"github.com/rclone/rclone/fs/rc/rcserver"
+	"github.com/rclone/rclone/lib/atexit"
+	libhttp "github.com/rclone/rclone/lib/http"
+	"github.com/spf13/cobra"
+)
+
+var (
+	preloadRemotes []string
+	queueFile      = ""
+	queueMaxJobs   = 1
+	eventsAddr     = ""
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	cmdFlags := commandDefinition.Flags()
+	flags.StringArrayVarP(cmdFlags, &preloadRemotes, "preload-remote", "", preloadRemotes, "Remote to create at startup, preloading its SA pool (may be repeated)", "")
+	flags.StringVarP(cmdFlags, &queueFile, "queue-file", "", queueFile, "Run the jobs added with queue/add, keeping them in this file", "")
+	flags.IntVarP(cmdFlags, &queueMaxJobs, "queue-max-jobs", "", queueMaxJobs, "Number of queued jobs to run at once", "")
+	flags.StringVarP(cmdFlags, &eventsAddr, "events-addr", "", eventsAddr, "IPaddress:Port or :Port to stream transfer and SA pool events on as server-sent events", "")
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "rcd <path to files to serve>*",
+	Short: `Run rclone listening to remote control commands only.`,
+	Long: `This runs rclone so that it only listens to remote control commands.
+
+This is useful if you are controlling rclone via the rc API.
+
+If you pass in a path to a directory, rclone will serve that directory
+for GET requests on the URL passed in.  It will also open the URL in
+the browser when rclone is run.
+
+See the [rc documentation](/rc/) for more info on the rc flags.
+
+Creating a drive remote with a service account pool preloads its
+services, which can take a while. Use ` + "`--preload-remote`" + ` to create
+remotes when the daemon starts instead of on the first job using them,
+e.g. ` + "`--preload-remote gc: --preload-remote backup:`" + `. The rc server
+starts listening once they are ready and they are kept for the life of
+the daemon.
+
+With ` + "`--queue-file FILE`" + ` the daemon also runs a persistent job queue:
+the rc commands added with ` + "`queue/add`" + `, each with a priority and the
+jobs it waits for, are run ` + "`--queue-max-jobs`" + ` at a time and kept in
+FILE, so a controller can add hundreds of jobs and leave the daemon to
+work through them, across restarts. ` + "`queue/list`" + `, ` + "`queue/cancel`" + `
+and ` + "`queue/clear`" + ` look after them.
+
+Run as a systemd service with ` + "`Type=notify`" + `, rcd tells systemd it
+is ready once the remotes are preloaded and, with ` + "`WatchdogSec`" + ` set,
+pings the watchdog while the transfers of its jobs are making progress,
+so a daemon whose transfers hang is restarted.
+
+With ` + "`--events-addr ADDR`" + ` the daemon streams what its transfers and
+service account pools do to ` + "`GET /events`" + ` on ADDR as server-sent
+events, each a line of JSON, so a dashboard can follow the runs as they
+happen instead of polling ` + "`core/stats`" + `: ` + "`stats`" + ` every second,
+` + "`transfer_start`" + ` and ` + "`transfer`" + ` as each transfer starts and
+ends, and ` + "`sa_switch`" + `, ` + "`sa_blacklist`" + ` and ` + "`sa_dead`" + `. It uses
+the TLS and authentication options of the rc server. The transfers are
+polled every second, so one over within a second may only get its
+` + "`transfer_start`" + ` just before its ` + "`transfer`" + `.
+
+` + strings.TrimSpace(libhttp.Help(rcflags.FlagPrefix)+libhttp.TemplateHelp(rcflags.FlagPrefix)+libhttp.AuthHelp(rcflags.FlagPrefix)),
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.45",
+		"groups":            "RC",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(0, 1, command, args)
+		if rc.Opt.Enabled {
+			fs.Fatalf(nil, "Don't supply --rc flag when using rcd")
+		}
+
+		// Start the rc
+		rc.Opt.Enabled = true
+		if len(args) > 0 {
+			rc.Opt.Files = args[0]
+		}
+
+		Preload(context.Background(), preloadRemotes)
+
+		if queueFile != "" {
+			startQueue(queueFile, queueMaxJobs)
+		}
+
+		s, err := rcserver.Start(context.Background(), &rc.Opt)
+		if err != nil {
+			fs.Fatalf(nil, "Failed to start remote control: %v", err)
+		}
+		if s == nil {
+			fs.Fatal(nil, "rc server not configured")
+		}
+
+		if eventsAddr != "" {
+			stopEvents, err := events.Serve(context.Background(), eventsAddr)
+			if err != nil {
+				fs.Fatalf(nil, "%v", err)
+			}
+			defer stopEvents()
+		}
+
+		// Notify ready, and stopping on exit
+		defer sdnotify.Ready(context.Background())()
+
+		s.Wait()
+	},
+}
+
+// Preload creates the remotes in parallel, pinning them in the Fs cache so
+// the rc jobs using them find them ready. Failures are logged.
+func Preload(ctx context.Context, remotes []string) {
+	var wg sync.WaitGroup
+	for _, remote := range remotes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			f, err := cache.Get(ctx, remote)
+			if err != nil && !errors.Is(err, fs.ErrorIsFile) {
+				fs.Errorf(nil, "Failed to preload remote %q: %v", remote, err)
+				return
+			}
+			cache.Pin(f)
+			fs.Infof(f, "Preloaded remote in %v", time.Since(start).Round(time.Millisecond))
+		}()
+	}
+	wg.Wait()
+}
+
+// startQueue runs the job queue in file, stopping the jobs running and
+// closing it on exit.
+func startQueue(file string, maxJobs int) {
+	q, err := queue.Open(file, maxJobs)
+	if err != nil {
+		fs.Fatalf(nil, "Failed to start the queue: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+	atexit.Register(func() {
+		cancel()
+		<-done
+		if err := q.Close(); err != nil {
+			fs.Errorf(nil, "Failed to close the queue: %v", err)
+		}
+	})
+}
@@ -0,0 +1,24 @@
+package rcd
+
+import (
+	"context"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/memory"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreload(t *testing.T) {
+	cache.Clear()
+	defer cache.Clear()
+	// Load the config up front as the command does before running
+	config.LoadedData()
+
+	// The remote which can't be created is logged and skipped
+	Preload(context.Background(), []string{":memory:", "not-a-remote-xyz:"})
+	pinned, unpinned := cache.EntriesWithPinCount()
+	assert.Equal(t, 1, pinned)
+	assert.Equal(t, 0, unpinned)
+}
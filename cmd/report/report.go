@@ -0,0 +1,211 @@
+// Package report writes the end of run summary of --report-file.
+//
+// The report is a JSON file meant to be archived with each migration job:
+// when the run started and how long it took, how many files were
+// transferred, skipped as identical and failed, with the error of each
+// failure, and what each service account of the drive remotes involved
+// did. It is written at the end of every attempt, so a run which fails
+// still leaves one behind.
+//
+// The files are counted from the transfers and checks of the stats as
+// they finish, rather than with a logger of the operations, as copy and
+// sync list the directories only on the destination too when there is a
+// logger.
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	gosync "sync"
+	"time"
+
+	"github.com/ebadenes/eclone/backend/drive"
+	"github.com/ebadenes/eclone/cmd/finished"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+)
+
+// Report is the content of the report file.
+type Report struct {
+	Command         string          `json:"command"`
+	Source          string          `json:"source"`
+	Destination     string          `json:"destination"`
+	Start           time.Time       `json:"start"`
+	End             time.Time       `json:"end"`
+	Duration        string          `json:"duration"`
+	Attempts        int             `json:"attempts"`
+	DryRun          bool            `json:"dry_run,omitempty"`
+	Error           string          `json:"error,omitempty"` // why the last attempt failed, if it did
+	Bytes           int64           `json:"bytes"`
+	Files           Files           `json:"files"`
+	Failures        []Failure       `json:"failures,omitempty"`
+	ServiceAccounts []drive.SaUsage `json:"service_accounts,omitempty"`
+}
+
+// Files counts the files of the run.
+type Files struct {
+	Transferred int64 `json:"transferred"`
+	Skipped     int64 `json:"skipped"` // identical on the destination when the run started
+	Failed      int64 `json:"failed"`
+	Deleted     int64 `json:"deleted"`
+}
+
+// Failure is a file which couldn't be transferred.
+type Failure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// pool is a service account pool used by the run.
+type pool struct {
+	pool   *drive.ServiceAccountPool
+	before *drive.PoolSnapshot
+}
+
+// Run collects the report of a run.
+type Run struct {
+	file    string
+	watcher *finished.Watcher
+	mu      gosync.Mutex
+	report  Report
+	pools   []pool
+	failed  map[string]string   // error by path of the files failing
+	checked map[string]struct{} // files checked by the first attempt and not transferred
+}
+
+// New returns the collector for the report of command run from fsrc to
+// fdst, to be written to file. It returns nil, which collects nothing,
+// if file is empty.
+func New(file, command string, fsrc, fdst fs.Fs) *Run {
+	if file == "" {
+		return nil
+	}
+	r := &Run{
+		file: file,
+		report: Report{
+			Command:     command,
+			Source:      fs.ConfigString(fsrc),
+			Destination: fs.ConfigString(fdst),
+			Start:       time.Now(),
+		},
+		failed:  make(map[string]string),
+		checked: make(map[string]struct{}),
+	}
+	for _, f := range []fs.Fs{fsrc, fdst} {
+		df, ok := f.(*drive.Fs)
+		if !ok || df.ServiceAccountFiles == nil || df.ServiceAccountFiles.Len() == 0 || r.hasPool(df.ServiceAccountFiles) {
+			continue
+		}
+		r.pools = append(r.pools, pool{pool: df.ServiceAccountFiles, before: df.ServiceAccountFiles.Snapshot()})
+	}
+	return r
+}
+
+// hasPool returns true if p is already collected.
+func (r *Run) hasPool(p *drive.ServiceAccountPool) bool {
+	for _, known := range r.pools {
+		if known.pool == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Start starts an attempt run with ctx.
+func (r *Run) Start(ctx context.Context) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.report.Attempts++
+	r.mu.Unlock()
+	r.watcher = finished.Watch(ctx, r.finished)
+}
+
+// finished counts the file of tr, a transfer or check of the attempt
+// running.
+//
+// A file fails if its last transfer, move or delete did, and is skipped
+// if the first attempt checked it and it was never transferred: the
+// retries check the files transferred by earlier attempts again, which
+// doesn't make them identical when the run started.
+func (r *Run) finished(tr accounting.TransferSnapshot) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch tr.What {
+	case "checking":
+		if r.report.Attempts == 1 {
+			r.checked[tr.Name] = struct{}{}
+		}
+		return
+	case "transferring", "moving":
+		delete(r.checked, tr.Name)
+	}
+	if tr.Error != nil {
+		r.failed[tr.Name] = tr.Error.Error()
+	} else {
+		delete(r.failed, tr.Name)
+	}
+}
+
+// Finish ends an attempt which returned err, writing the report. It
+// returns err, or the error writing the report if there was none.
+func (r *Run) Finish(ctx context.Context, err error) error {
+	if r == nil {
+		return err
+	}
+	r.watcher.Stop()
+	r.mu.Lock()
+	report := r.build(ctx, err)
+	r.mu.Unlock()
+	if writeErr := write(r.file, report); writeErr != nil {
+		if err != nil {
+			fs.Errorf(nil, "%v", writeErr)
+			return err
+		}
+		return writeErr
+	}
+	fs.Infof(nil, "Wrote report to %q", r.file)
+	return err
+}
+
+// build returns the report as it stands - call with r.mu held.
+func (r *Run) build(ctx context.Context, err error) Report {
+	report := r.report
+	stats := accounting.Stats(ctx)
+	report.End = time.Now()
+	report.Duration = report.End.Sub(report.Start).Truncate(time.Millisecond).String()
+	report.DryRun = fs.GetConfig(ctx).DryRun
+	report.Bytes = stats.GetBytes()
+	report.Files.Transferred = stats.GetTransfers()
+	report.Files.Deleted = stats.GetDeletes()
+	if err != nil {
+		report.Error = err.Error()
+	}
+	report.Failures = make([]Failure, 0, len(r.failed))
+	for path, reason := range r.failed {
+		report.Failures = append(report.Failures, Failure{Path: path, Error: reason})
+	}
+	sort.Slice(report.Failures, func(i, j int) bool { return report.Failures[i].Path < report.Failures[j].Path })
+	report.Files.Failed = int64(len(report.Failures))
+	report.Files.Skipped = int64(len(r.checked))
+	for _, p := range r.pools {
+		report.ServiceAccounts = append(report.ServiceAccounts, p.pool.Usage(p.before)...)
+	}
+	return report
+}
+
+// write writes report to file as JSON.
+func write(file string, report Report) error {
+	data, err := json.MarshalIndent(report, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
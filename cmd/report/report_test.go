@@ -0,0 +1,107 @@
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func read(t *testing.T, file string) (report Report) {
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &report))
+	return report
+}
+
+func TestNil(t *testing.T) {
+	run := New("", "copy", nil, nil)
+	assert.Nil(t, run)
+	ctx := context.Background()
+	run.Start(ctx)
+	err := errors.New("failed")
+	assert.Equal(t, err, run.Finish(ctx, err))
+}
+
+// done finishes a transfer, or check with what set, of remote in ctx.
+func done(ctx context.Context, remote, what string, err error) {
+	stats := accounting.Stats(ctx)
+	tr := stats.NewTransferRemoteSize(remote, 1, nil, nil)
+	if what != "" {
+		tr = stats.NewCheckingTransfer(mockobject.Object(remote), what)
+	}
+	tr.Done(ctx, err)
+}
+
+func TestReport(t *testing.T) {
+	ctx := context.Background()
+	accounting.NewStatsGroup(ctx, "TestReport")
+	ctx = accounting.WithStatsGroup(ctx, "TestReport")
+	fsrc, err := mockfs.NewFs(ctx, "src", "a", nil)
+	require.NoError(t, err)
+	fdst, err := mockfs.NewFs(ctx, "dst", "b", nil)
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "report.json")
+	run := New(file, "copy", fsrc, fdst)
+
+	// The files come from the stats, without a logger which would
+	// change what copy and sync list
+	run.Start(ctx)
+	_, usingLogger := operations.GetLogger(ctx)
+	assert.False(t, usingLogger)
+	done(ctx, "same.txt", "checking", nil)
+	done(ctx, "changed.txt", "checking", nil)
+	done(ctx, "changed.txt", "", nil)
+	done(ctx, "new.txt", "", errors.New("quota exceeded"))
+	done(ctx, "bad.txt", "", errors.New("permission denied"))
+	accounting.Stats(ctx).Bytes(1000)
+	require.NoError(t, run.Finish(ctx, nil))
+
+	report := read(t, file)
+	assert.Equal(t, "copy", report.Command)
+	assert.Equal(t, "src:a", report.Source)
+	assert.Equal(t, "dst:b", report.Destination)
+	assert.Equal(t, 1, report.Attempts)
+	assert.Equal(t, int64(1000), report.Bytes)
+	assert.Equal(t, Files{Transferred: 1, Skipped: 1, Failed: 2}, report.Files)
+	assert.Equal(t, []Failure{{Path: "bad.txt", Error: "permission denied"}, {Path: "new.txt", Error: "quota exceeded"}}, report.Failures)
+	assert.Empty(t, report.Error)
+	assert.False(t, report.End.Before(report.Start))
+
+	// A retry which transfers new.txt clears its failure and doesn't
+	// count the files it checks again as skipped
+	run.Start(ctx)
+	done(ctx, "same.txt", "checking", nil)
+	done(ctx, "changed.txt", "checking", nil)
+	done(ctx, "new.txt", "", nil)
+	done(ctx, "bad.txt", "", errors.New("permission denied"))
+	runErr := errors.New("1 error")
+	assert.Equal(t, runErr, run.Finish(ctx, runErr))
+
+	report = read(t, file)
+	assert.Equal(t, 2, report.Attempts)
+	assert.Equal(t, Files{Transferred: 2, Skipped: 1, Failed: 1}, report.Files)
+	assert.Equal(t, []Failure{{Path: "bad.txt", Error: "permission denied"}}, report.Failures)
+	assert.Equal(t, "1 error", report.Error)
+}
+
+func TestFinishWriteError(t *testing.T) {
+	ctx := context.Background()
+	f, err := mockfs.NewFs(ctx, "src", "", nil)
+	require.NoError(t, err)
+	run := New(filepath.Join(t.TempDir(), "missing", "report.json"), "sync", f, f)
+	run.Start(ctx)
+	// The error of the run wins over that writing the report
+	runErr := errors.New("failed")
+	assert.Equal(t, runErr, run.Finish(ctx, runErr))
+	assert.ErrorContains(t, run.Finish(ctx, nil), "failed to write report")
+}
@@ -0,0 +1,244 @@
+// Package resume stops copy and sync gracefully on SIGTERM or SIGINT and
+// lets a later run carry on where they stopped, for --resume.
+//
+// Spot instances get a signal shortly before they are reclaimed. Without
+// --resume the run is killed there and then: the uploads in progress are
+// lost, with the quota they used, and the state of the service account
+// pools isn't saved. With --resume a signal gives the transfers in
+// progress --resume-grace to finish. Then a checkpoint is written to the
+// file given, with the transfers still in progress and their upload
+// sessions, the run is cancelled, the backends are shut down, saving the
+// state of their pools, and the process exits.
+//
+// The next run with the same --resume file continues those uploads from
+// the last chunk Drive has, and the rest of the run skips what is already
+// there as usual. The checkpoint is removed once a run succeeds.
+package resume
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/ebadenes/eclone/backend/drive"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/lib/atexit"
+	"github.com/spf13/pflag"
+)
+
+// DefaultGrace is how long transfers in progress get to finish unless
+// --resume-grace says otherwise.
+const DefaultGrace = fs.Duration(time.Minute)
+
+// Options are the resume flags.
+type Options struct {
+	File  string      // the checkpoint file
+	Grace fs.Duration // how long transfers in progress get to finish
+}
+
+// AddFlags adds the resume flags to flagSet.
+func AddFlags(flagSet *pflag.FlagSet, opt *Options) {
+	flags.StringVarP(flagSet, &opt.File, "resume", "", opt.File, "Stop gracefully on SIGTERM or SIGINT, checkpointing to this file, and resume from it", "")
+	flags.FVarP(flagSet, &opt.Grace, "resume-grace", "", "Time the transfers in progress get to finish when stopped with --resume", "")
+}
+
+// Help returns the help of the resume flags, to append to the help of
+// the commands.
+func Help() string {
+	return strings.ReplaceAll(`### Stopping and resuming
+
+With |--resume FILE| a SIGTERM or SIGINT stops the run gracefully: the
+transfers in progress get |--resume-grace| to finish. Then a checkpoint
+is written to |FILE|, recording the transfers cut short and their Drive
+upload sessions, the run is cancelled, the state of the service account
+pools is saved and the process exits. Running the same command again
+with the same |--resume FILE| continues those uploads from where they
+stopped, and skips what is already at the destination as usual. The
+checkpoint is removed once a run succeeds.
+`, "|", "`")
+}
+
+// Checkpoint is the content of the checkpoint file.
+type Checkpoint struct {
+	Command     string                `json:"command"`
+	Source      string                `json:"source"`
+	Destination string                `json:"destination"`
+	Stopped     time.Time             `json:"stopped"`
+	Interrupted []string              `json:"interrupted,omitempty"` // transfers still in progress when stopped
+	Uploads     []drive.UploadSession `json:"uploads,omitempty"`     // their upload sessions, to continue
+}
+
+// Run stops a run gracefully on a signal and checkpoints it.
+type Run struct {
+	opt        *Options
+	checkpoint Checkpoint // the fields common to all checkpoints
+	mu         gosync.Mutex
+	ctx        context.Context    // of the attempt in progress
+	cancel     context.CancelFunc // cancels it
+	stopping   bool
+	finished   chan struct{} // closed when the attempt stopped has returned
+}
+
+// New returns the Run of command from fsrc to fdst, resuming it from the
+// checkpoint in opt.File if there is one. It returns nil, which does
+// nothing, if opt.File is empty.
+func New(opt *Options, command string, fsrc, fdst fs.Fs) (*Run, error) {
+	if opt.File == "" {
+		return nil, nil
+	}
+	r := &Run{
+		opt: opt,
+		checkpoint: Checkpoint{
+			Command:     command,
+			Source:      fs.ConfigString(fsrc),
+			Destination: fs.ConfigString(fdst),
+		},
+		finished: make(chan struct{}),
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	atexit.Register(func() {
+		if atexit.Signalled() {
+			r.stop()
+		}
+	})
+	return r, nil
+}
+
+// load resumes from the checkpoint file if there is one.
+func (r *Run) load() error {
+	data, err := os.ReadFile(r.opt.File)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return fmt.Errorf("failed to parse checkpoint %q: %w", r.opt.File, err)
+	}
+	if cp.Command != r.checkpoint.Command || cp.Source != r.checkpoint.Source || cp.Destination != r.checkpoint.Destination {
+		return fmt.Errorf("checkpoint %q is of %s %s -> %s, not of this run", r.opt.File, cp.Command, cp.Source, cp.Destination)
+	}
+	fs.Logf(nil, "Resuming the %s stopped at %v: %d transfers were cut short, %d uploads to continue", cp.Command, cp.Stopped.Format(time.RFC3339), len(cp.Interrupted), len(cp.Uploads))
+	drive.ResumeUploads(cp.Uploads)
+	return nil
+}
+
+// Start starts an attempt run with ctx and returns the ctx to run it
+// with, which a signal cancels.
+func (r *Run) Start(ctx context.Context) context.Context {
+	if r == nil {
+		return ctx
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	r.mu.Lock()
+	r.ctx, r.cancel = ctx, cancel
+	r.mu.Unlock()
+	return ctx
+}
+
+// Finish ends an attempt which returned err. An attempt stopped by a
+// signal returns a fatal error, so it isn't retried, and the signal
+// handler exits once the checkpoint is written. A run which succeeded
+// removes the checkpoint.
+func (r *Run) Finish(err error) error {
+	if r == nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopping {
+		close(r.finished)
+		r.finished = make(chan struct{})
+		return fserrors.FatalError(fmt.Errorf("stopped by a signal - run again with --resume %q to carry on", r.opt.File))
+	}
+	if err == nil {
+		if removeErr := os.Remove(r.opt.File); removeErr == nil {
+			fs.Infof(nil, "Run complete - removed checkpoint %q", r.opt.File)
+		} else if !errors.Is(removeErr, os.ErrNotExist) {
+			fs.Errorf(nil, "Failed to remove checkpoint: %v", removeErr)
+		}
+	}
+	return err
+}
+
+// stop waits up to the grace time for the attempt in progress, then
+// writes the checkpoint, cancels the attempt and shuts the backends down.
+func (r *Run) stop() {
+	r.mu.Lock()
+	ctx, cancel, finished := r.ctx, r.cancel, r.finished
+	r.stopping = ctx != nil
+	r.mu.Unlock()
+	if ctx != nil {
+		grace := time.Duration(r.opt.Grace)
+		fs.Logf(nil, "Stopping: waiting up to %v for the transfers in progress", grace)
+		timer := time.NewTimer(grace)
+		select {
+		case <-finished:
+		case <-timer.C:
+			fs.Logf(nil, "Stopping: grace time over - cutting the transfers in progress short")
+		}
+		timer.Stop()
+		// Before cancelling, while the uploads cut short still have
+		// their sessions
+		cp := r.build(ctx)
+		if err := write(r.opt.File, cp); err != nil {
+			fs.Errorf(nil, "%v", err)
+		} else {
+			fs.Logf(nil, "Wrote checkpoint to %q: %d transfers cut short, %d uploads to continue - run again with --resume to carry on", r.opt.File, len(cp.Interrupted), len(cp.Uploads))
+		}
+		cancel()
+	}
+	// Shut the backends down, saving the state of their pools
+	cache.Clear()
+}
+
+// build returns the checkpoint of the attempt run with ctx.
+func (r *Run) build(ctx context.Context) Checkpoint {
+	cp := r.checkpoint
+	cp.Stopped = time.Now()
+	cp.Interrupted = inProgress(ctx)
+	cp.Uploads = drive.UploadSessions()
+	return cp
+}
+
+// inProgress returns the names of the transfers in progress, sorted.
+func inProgress(ctx context.Context) (names []string) {
+	stats, err := accounting.Stats(ctx).RemoteStats(false)
+	if err != nil {
+		return nil
+	}
+	transferring, _ := stats["transferring"].([]rc.Params)
+	for _, tr := range transferring {
+		if name, ok := tr["name"].(string); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// write writes cp to file as JSON.
+func write(file string, cp Checkpoint) error {
+	data, err := json.MarshalIndent(cp, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
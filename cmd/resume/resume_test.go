@@ -0,0 +1,116 @@
+package resume
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func read(t *testing.T, file string) (cp Checkpoint) {
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &cp))
+	return cp
+}
+
+func newFs(t *testing.T, name string) fs.Fs {
+	f, err := mockfs.NewFs(context.Background(), name, "root", nil)
+	require.NoError(t, err)
+	return f
+}
+
+func TestNil(t *testing.T) {
+	r, err := New(&Options{}, "copy", nil, nil)
+	require.NoError(t, err)
+	assert.Nil(t, r)
+	ctx := context.Background()
+	assert.Equal(t, ctx, r.Start(ctx))
+	err = errors.New("failed")
+	assert.Equal(t, err, r.Finish(err))
+}
+
+func TestStop(t *testing.T) {
+	ctx, ci := fs.AddConfig(accounting.WithStatsGroup(context.Background(), "TestStop"))
+	fsrc, fdst := newFs(t, "src"), newFs(t, "dst")
+	file := filepath.Join(t.TempDir(), "resume.json")
+	opt := &Options{File: file, Grace: fs.Duration(time.Minute)}
+	r, err := New(opt, "copy", fsrc, fdst)
+	require.NoError(t, err)
+	ctx = r.Start(ctx)
+
+	// One transfer still going when stopped
+	tr := accounting.Stats(ctx).NewTransfer(mockobject.Object("big.bin"), fdst)
+	defer tr.Done(ctx, nil)
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		r.stop()
+	}()
+	require.Eventually(t, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return r.stopping
+	}, 5*time.Second, time.Millisecond)
+	err = r.Finish(nil)
+	assert.True(t, fserrors.IsFatalError(err))
+	<-stopped
+	// The config shared with the transfers is left alone
+	assert.Equal(t, fs.SizeSuffix(-1), ci.MaxTransfer)
+	assert.Equal(t, fs.CutoffModeHard, ci.CutoffMode)
+
+	cp := read(t, file)
+	assert.Equal(t, "copy", cp.Command)
+	assert.Equal(t, fs.ConfigString(fsrc), cp.Source)
+	assert.Equal(t, fs.ConfigString(fdst), cp.Destination)
+	assert.Equal(t, []string{"big.bin"}, cp.Interrupted)
+	assert.WithinDuration(t, time.Now(), cp.Stopped, time.Minute)
+
+	// Resumed by the same run only
+	_, err = New(opt, "copy", fsrc, newFs(t, "other"))
+	assert.ErrorContains(t, err, "not of this run")
+	_, err = New(opt, "sync", fsrc, fdst)
+	assert.ErrorContains(t, err, "not of this run")
+	r, err = New(opt, "copy", fsrc, fdst)
+	require.NoError(t, err)
+
+	// Kept while the run fails, removed once it succeeds
+	r.Start(context.Background())
+	failed := errors.New("failed")
+	assert.Equal(t, failed, r.Finish(failed))
+	assert.FileExists(t, file)
+	assert.NoError(t, r.Finish(nil))
+	assert.NoFileExists(t, file)
+}
+
+func TestStopGrace(t *testing.T) {
+	ctx, _ := fs.AddConfig(context.Background())
+	file := filepath.Join(t.TempDir(), "resume.json")
+	r, err := New(&Options{File: file, Grace: fs.Duration(10 * time.Millisecond)}, "sync", newFs(t, "src"), newFs(t, "dst"))
+	require.NoError(t, err)
+	ctx = r.Start(ctx)
+	// The attempt doesn't finish in time, so is cancelled once the
+	// checkpoint is written
+	r.stop()
+	assert.Equal(t, "sync", read(t, file).Command)
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+}
+
+func TestBadCheckpoint(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "resume.json")
+	require.NoError(t, os.WriteFile(file, []byte("{"), 0644))
+	_, err := New(&Options{File: file}, "copy", newFs(t, "src"), newFs(t, "dst"))
+	assert.ErrorContains(t, err, "failed to parse checkpoint")
+}
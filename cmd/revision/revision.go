@@ -0,0 +1,202 @@
+// Package revision compares the files of a copy or sync between drive
+// remotes by Drive revision, for --compare-revision.
+//
+// Both sides are listed with their revisions before the transfer. A file
+// whose copy has the revision of its source recorded is up to date if
+// that is still the revision of the source, whatever its size and
+// modification time, and changed if not, in which case it is copied
+// straight away, even if its size and modification time are the same.
+// A copy with no revision recorded, or an out of date one, which has the
+// MD5 of the source just has the revision recorded. The files left, new
+// ones and those which differ without a revision recorded, are left to
+// the copy or sync, through a filter listing them, and have their
+// revision recorded on the next run.
+package revision
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ebadenes/eclone/backend/drive"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+	"golang.org/x/sync/errgroup"
+)
+
+// decision is what is done with a file found on both sides.
+type decision int
+
+const (
+	undecided decision = iota // left to the copy or sync
+	unchanged                 // up to date
+	record                    // up to date, recording the revision
+	changed                   // copied again
+)
+
+// decide returns what to do with dst, the copy of src, given the revision
+// of src and that recorded on dst.
+func decide(ctx context.Context, src, dst fs.Object, revision, recorded string) decision {
+	if revision == "" {
+		return undecided
+	}
+	if recorded == revision {
+		return unchanged
+	}
+	if src.Size() == dst.Size() {
+		srcMD5, srcErr := src.Hash(ctx, hash.MD5)
+		dstMD5, dstErr := dst.Hash(ctx, hash.MD5)
+		if srcErr == nil && dstErr == nil && srcMD5 != "" && srcMD5 == dstMD5 {
+			return record
+		}
+	}
+	if recorded != "" {
+		return changed
+	}
+	return undecided
+}
+
+// list returns the objects in f by remote, with the filters.
+func list(ctx context.Context, f fs.Fs) (map[string]fs.Object, error) {
+	objects := map[string]fs.Object{}
+	err := walk.ListR(ctx, f, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			if o, ok := entry.(fs.Object); ok {
+				objects[o.Remote()] = o
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		return objects, nil
+	}
+	return objects, err
+}
+
+// onlyFilter returns a filter with the options of that in ctx to which
+// the files left to the copy or sync are added.
+func onlyFilter(ctx context.Context) (*filter.Filter, error) {
+	opt := filter.GetConfig(ctx).Opt
+	opt.FilesFrom, opt.FilesFromRaw = nil, nil
+	// The files compared here are excluded from the sync, which must
+	// not delete them on the destination
+	opt.DeleteExcluded = false
+	return filter.NewFilter(&opt)
+}
+
+// Compare compares the files of fsrc and fdst by revision, copying those
+// changed and recording the revisions of those up to date, and returns
+// ctx with a filter leaving the copy or sync only the other files.
+func Compare(ctx context.Context, fdst, fsrc fs.Fs) (context.Context, error) {
+	if !drive.EnableRevisions(fsrc) || !drive.EnableRevisions(fdst) {
+		return ctx, errors.New("--compare-revision needs drive remotes on both sides")
+	}
+	srcs, err := list(ctx, fsrc)
+	if err != nil {
+		return ctx, fmt.Errorf("failed to list the source revisions: %w", err)
+	}
+	dsts, err := list(ctx, fdst)
+	if err != nil {
+		return ctx, fmt.Errorf("failed to list the destination revisions: %w", err)
+	}
+	only, err := onlyFilter(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	ci := fs.GetConfig(ctx)
+	var (
+		mu                       sync.Mutex // protects only
+		left, upToDate           int
+		recorded, copied, failed atomic.Int64
+		checkers                 errgroup.Group
+		transfers                errgroup.Group
+	)
+	checkers.SetLimit(ci.Checkers)
+	transfers.SetLimit(ci.Transfers)
+	leave := func(remote string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		left++
+		return only.AddFile(remote)
+	}
+	fail := func(o fs.Object, err error) {
+		fs.Errorf(o, "Compare revision: %v", err)
+		_ = fs.CountError(ctx, err)
+		failed.Add(1)
+	}
+	for remote, src := range srcs {
+		dst, ok := dsts[remote]
+		if !ok {
+			if err := leave(remote); err != nil {
+				return ctx, err
+			}
+			continue
+		}
+		checkers.Go(func() error {
+			switch decide(ctx, src, dst, drive.Revision(src), drive.SourceRevision(dst)) {
+			case undecided:
+				return leave(remote)
+			case unchanged:
+				mu.Lock()
+				upToDate++
+				mu.Unlock()
+			case record:
+				if ci.DryRun {
+					fs.Logf(dst, "Not recording the source revision as --dry-run is set")
+				} else if err := drive.SetSourceRevision(ctx, dst, drive.Revision(src)); err != nil {
+					fail(dst, err)
+				} else {
+					recorded.Add(1)
+				}
+			case changed:
+				transfers.Go(func() error {
+					fs.Infof(src, "Revision changed from %s to %s - copying", drive.SourceRevision(dst), drive.Revision(src))
+					newDst, err := operations.Copy(ctx, fdst, dst, remote, src)
+					if err != nil {
+						fail(src, err)
+						return nil
+					}
+					if newDst == nil {
+						return nil
+					}
+					if err := drive.SetSourceRevision(ctx, newDst, drive.Revision(src)); err != nil {
+						fail(newDst, err)
+						return nil
+					}
+					copied.Add(1)
+					return nil
+				})
+			}
+			return nil
+		})
+	}
+	err = checkers.Wait()
+	if transfersErr := transfers.Wait(); err == nil {
+		err = transfersErr
+	}
+	if err != nil {
+		return ctx, err
+	}
+	// Files only on the destination are left for sync to delete
+	for remote := range dsts {
+		if _, ok := srcs[remote]; !ok {
+			if err := leave(remote); err != nil {
+				return ctx, err
+			}
+		}
+	}
+	fs.Infof(fdst, "Compared revisions: %d up to date, %d revisions recorded, %d changed files copied, %d failed, %d left to compare as usual",
+		upToDate, recorded.Load(), copied.Load(), failed.Load(), left)
+	if left == 0 {
+		// An empty --files-from selects everything
+		if err := only.Add(false, "**"); err != nil {
+			return ctx, err
+		}
+	}
+	return filter.ReplaceConfig(ctx, only), nil
+}
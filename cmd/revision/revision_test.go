@@ -0,0 +1,60 @@
+package revision
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecide(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	src := object.NewMemoryObject("file", now, []byte("hello"))
+	same := object.NewMemoryObject("file", now.Add(-time.Hour), []byte("hello"))
+	edited := object.NewMemoryObject("file", now, []byte("HELLO"))
+	for _, test := range []struct {
+		name     string
+		dst      fs.Object
+		revision string
+		recorded string
+		want     decision
+	}{
+		{"no revision", same, "", "", undecided},
+		{"same revision", edited, "r2", "r2", unchanged},
+		{"not recorded same content", same, "r2", "", record},
+		{"new revision same content", same, "r2", "r1", record},
+		{"new revision", edited, "r2", "r1", changed},
+		{"not recorded", edited, "r2", "", undecided},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, decide(ctx, src, test.dst, test.revision, test.recorded))
+		})
+	}
+}
+
+func TestCompareNeedsDrive(t *testing.T) {
+	ctx := context.Background()
+	f, err := fs.NewFs(ctx, t.TempDir())
+	require.NoError(t, err)
+	_, err = Compare(ctx, f, f)
+	assert.ErrorContains(t, err, "drive remotes")
+}
+
+func TestOnlyFilter(t *testing.T) {
+	ctx, fi := filter.AddConfig(context.Background())
+	fi.Opt.DeleteExcluded = true
+	require.NoError(t, fi.Add(false, "*.tmp"))
+	only, err := onlyFilter(ctx)
+	require.NoError(t, err)
+	require.NoError(t, only.AddFile("a.txt"))
+	assert.False(t, only.Opt.DeleteExcluded, "the files up to date would be deleted")
+	assert.True(t, only.IncludeRemote("a.txt"))
+	assert.False(t, only.IncludeRemote("b.txt"))
+}
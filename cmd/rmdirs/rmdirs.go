@@ -0,0 +1,67 @@
+// Package rmdir provides the rmdirs command.
+package rmdir
+
+import (
+	"context"
+
+	"github.com/ebadenes/eclone/backend/drive"
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/spf13/cobra"
+)
+
+var (
+	leaveRoot = false
+	saSpread  = false
+)
+
+func init() {
+	cmd.Root.AddCommand(rmdirsCmd)
+	rmdirsCmd.Flags().BoolVarP(&leaveRoot, "leave-root", "", leaveRoot, "Do not remove root directory if empty")
+	rmdirsCmd.Flags().BoolVarP(&saSpread, "sa-spread", "", saSpread, "Remove whole empty trees of a drive remote, spreading the calls over the preloaded service accounts")
+}
+
+var rmdirsCmd = &cobra.Command{
+	Use:   "rmdirs remote:path",
+	Short: `Remove empty directories under the path.`,
+	Long: `This recursively removes any empty directories (including directories
+that only contain empty directories), that it finds under the path.
+The root path itself will also be removed if it is empty, unless
+you supply the ` + "`--leave-root`" + ` flag.
+
+Use command [rmdir](/commands/rclone_rmdir/) to delete just the empty
+directory given by path, not recurse.
+
+This is useful for tidying up remotes that rclone has left a lot of
+empty directories in. For example the [delete](/commands/rclone_delete/)
+command will delete files but leave the directory structure (unless
+used with option ` + "`--rmdirs`" + `).
+
+This will delete ` + "`--checkers`" + ` directories concurrently so
+if you have thousands of empty directories consider increasing this number.
+
+With ` + "`--sa-spread`" + ` on a Google Drive remote the tree is listed once and
+only the top directory of each empty tree is removed, taking everything
+below it with it, instead of every directory one by one. The calls are
+made ` + "`--checkers`" + ` at a time, each with the next service account
+preloaded with ` + "`--drive-services-preload`" + `, so no single service
+account carries the rate limits. A file added to an empty tree while
+the command runs is removed with it.
+
+To delete a path and any objects in it, use the [purge](/commands/rclone_purge/)
+command.`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.35",
+		"groups":            "Important",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		fdst := cmd.NewFsDir(args)
+		cmd.Run(true, false, command, func() error {
+			if saSpread {
+				return drive.SpreadRmdirs(context.Background(), fdst, "", leaveRoot)
+			}
+			return operations.Rmdirs(context.Background(), fdst, "", leaveRoot)
+		})
+	},
+}
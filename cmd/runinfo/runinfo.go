@@ -0,0 +1,78 @@
+// Package runinfo follows the attempts cmd.Run makes at a copy, sync or
+// migrate, for the packages telling the world about the run.
+//
+// The notifications of notify and the commands of hooks are both sent
+// when an attempt starts and once the run is over, which is when an
+// attempt ends without cmd.Run going to retry it, and both describe the
+// run the same way.
+package runinfo
+
+import (
+	"context"
+	gosync "sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+)
+
+// Info describes a run, in the events about it.
+type Info struct {
+	Command     string    `json:"command"`
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	Start       time.Time `json:"start"`
+	Time        time.Time `json:"time"`
+	Attempt     int       `json:"attempt"`
+}
+
+// Run follows the attempts at a run.
+type Run struct {
+	mu   gosync.Mutex
+	info Info
+}
+
+// New returns the run of command from fsrc to fdst, starting now.
+func New(command string, fsrc, fdst fs.Fs) *Run {
+	return &Run{
+		info: Info{
+			Command:     command,
+			Source:      fs.ConfigString(fsrc),
+			Destination: fs.ConfigString(fdst),
+			Start:       time.Now(),
+		},
+	}
+}
+
+// StartAttempt starts an attempt, returning its number from 1.
+func (r *Run) StartAttempt() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.info.Attempt++
+	return r.info.Attempt
+}
+
+// Last returns true if the attempt run with ctx, which returned err, is
+// the last: it succeeded or cmd.Run isn't going to retry it.
+func (r *Run) Last(ctx context.Context, err error) bool {
+	r.mu.Lock()
+	attempt := r.info.Attempt
+	r.mu.Unlock()
+	return err == nil || !retried(ctx, attempt)
+}
+
+// Info returns the description of the run as of now.
+func (r *Run) Info() Info {
+	r.mu.Lock()
+	info := r.info
+	r.mu.Unlock()
+	info.Time = time.Now()
+	return info
+}
+
+// retried returns true if cmd.Run is going to retry the attempt, which
+// it does while there are attempts left and the errors can be retried.
+func retried(ctx context.Context, attempt int) bool {
+	stats := accounting.Stats(ctx)
+	return attempt < fs.GetConfig(ctx).Retries && !stats.HadFatalError() && stats.HadRetryError()
+}
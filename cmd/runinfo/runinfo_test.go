@@ -0,0 +1,45 @@
+package runinfo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	ctx, ci := fs.AddConfig(context.Background())
+	ci.Retries = 2
+	group := "TestRun"
+	accounting.NewStatsGroup(ctx, group)
+	ctx = accounting.WithStatsGroup(ctx, group)
+	fsrc, err := mockfs.NewFs(ctx, "src", "a", nil)
+	require.NoError(t, err)
+	fdst, err := mockfs.NewFs(ctx, "dst", "b", nil)
+	require.NoError(t, err)
+
+	r := New("sync", fsrc, fdst)
+	assert.Equal(t, 1, r.StartAttempt())
+	info := r.Info()
+	assert.Equal(t, "sync", info.Command)
+	assert.Equal(t, "src:a", info.Source)
+	assert.Equal(t, "dst:b", info.Destination)
+	assert.Equal(t, 1, info.Attempt)
+	assert.False(t, info.Time.Before(info.Start))
+
+	// Successful attempts are the last
+	assert.True(t, r.Last(ctx, nil))
+
+	// Retryable errors with attempts left aren't
+	err = fserrors.RetryError(errors.New("again"))
+	err = accounting.Stats(ctx).Error(err)
+	assert.False(t, r.Last(ctx, err))
+	assert.Equal(t, 2, r.StartAttempt())
+	assert.True(t, r.Last(ctx, err), "no attempts left")
+}
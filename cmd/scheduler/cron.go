@@ -0,0 +1,165 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule is a parsed cron expression
+type schedule struct {
+	minute, hour, dom, month, dow uint64 // bit i set if value i matches
+	domAny, dowAny                bool   // day of month or week was *
+	every                         time.Duration
+}
+
+// field describes a cron field
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// macros are the shorthands for common schedules
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseSchedule parses a cron expression of five fields, minute, hour,
+// day of month, month and day of week, each a *, a number, a range a-b
+// or a comma separated list of these, optionally with a /step, or one of
+// the macros or "@every DURATION".
+func parseSchedule(spec string) (*schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if every, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(every))
+		if err != nil {
+			return nil, fmt.Errorf("bad @every duration: %w", err)
+		}
+		if d < time.Minute {
+			return nil, errors.New("@every must be at least a minute")
+		}
+		return &schedule{every: d}, nil
+	}
+	if expanded, ok := macros[spec]; ok {
+		spec = expanded
+	}
+	parts := strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("need %d fields in %q", len(fields), spec)
+	}
+	var s schedule
+	sets := []*uint64{&s.minute, &s.hour, &s.dom, &s.month, &s.dow}
+	for i, part := range parts {
+		set, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("bad %s %q: %w", fields[i].name, part, err)
+		}
+		*sets[i] = set
+	}
+	// Sunday is 0 or 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny = strings.HasPrefix(parts[2], "*")
+	s.dowAny = strings.HasPrefix(parts[4], "*")
+	return &s, nil
+}
+
+// parseField returns the set of values part of field f matches.
+func parseField(part string, f field) (set uint64, err error) {
+	for item := range strings.SplitSeq(part, ",") {
+		lo, hi, step := f.min, f.max, 1
+		rangeSpec, stepSpec, hasStep := strings.Cut(item, "/")
+		if hasStep {
+			step, err = strconv.Atoi(stepSpec)
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("bad step %q", stepSpec)
+			}
+		}
+		if rangeSpec != "*" {
+			loSpec, hiSpec, isRange := strings.Cut(rangeSpec, "-")
+			if lo, err = strconv.Atoi(loSpec); err != nil {
+				return 0, fmt.Errorf("bad value %q", loSpec)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(hiSpec); err != nil {
+					return 0, fmt.Errorf("bad value %q", hiSpec)
+				}
+			} else if hasStep {
+				hi = f.max
+			}
+		}
+		if lo < f.min || hi > f.max || lo > hi {
+			return 0, fmt.Errorf("%d-%d out of range %d-%d", lo, hi, f.min, f.max)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// matchesDay returns true if the day of t matches s. As in cron, if
+// both the day of month and day of week are restricted either matches.
+func (s *schedule) matchesDay(t time.Time) bool {
+	dom := s.dom&(1<<t.Day()) != 0
+	dow := s.dow&(1<<int(t.Weekday())) != 0
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+// next returns the first time after t matching s, or the zero time if
+// there is none within five years.
+func (s *schedule) next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every).Truncate(time.Minute)
+	}
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<t.Minute()) == 0:
+			// Skip straight to the next matching minute of the hour
+			later := s.minute >> t.Minute()
+			if later == 0 {
+				t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			} else {
+				t = t.Add(time.Duration(bits.TrailingZeros64(later)) * time.Minute)
+			}
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
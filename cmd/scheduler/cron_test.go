@@ -0,0 +1,62 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchedule(t *testing.T) {
+	s, err := parseSchedule("0,30 9-17/4 * * 1-5")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1|1<<30), s.minute)
+	assert.Equal(t, uint64(1<<9|1<<13|1<<17), s.hour)
+	assert.True(t, s.domAny)
+	assert.False(t, s.dowAny)
+
+	s, err = parseSchedule("*/15 * * * 7")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1|1<<15|1<<30|1<<45), s.minute)
+	assert.Equal(t, uint64(1|1<<7), s.dow, "7 is Sunday too")
+
+	s, err = parseSchedule("@every 90m")
+	require.NoError(t, err)
+	assert.Equal(t, 90*time.Minute, s.every)
+
+	for _, bad := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "a * * * *", "@every 10s", "@every soon"} {
+		_, err := parseSchedule(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	at := func(s string) time.Time {
+		tm, err := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+		require.NoError(t, err)
+		return tm
+	}
+	for _, test := range []struct {
+		spec string
+		from string
+		want string
+	}{
+		{"30 2 * * *", "2026-10-16 01:00", "2026-10-16 02:30"},
+		{"30 2 * * *", "2026-10-16 02:30", "2026-10-17 02:30"},
+		{"@hourly", "2026-10-16 01:59", "2026-10-16 02:00"},
+		{"*/20 * * * *", "2026-10-16 01:41", "2026-10-16 02:00"},
+		{"0 0 * * 0", "2026-10-16 12:00", "2026-10-18 00:00"}, // Friday to Sunday
+		{"0 0 31 * *", "2026-11-01 00:00", "2026-12-31 00:00"},
+		{"0 0 29 2 *", "2026-10-16 00:00", "2028-02-29 00:00"},
+		{"0 0 13 * 5", "2026-10-14 00:00", "2026-10-16 00:00"}, // the 13th or a Friday
+		{"@every 90m", "2026-10-16 01:00", "2026-10-16 02:30"},
+	} {
+		s, err := parseSchedule(test.spec)
+		require.NoError(t, err)
+		assert.Equal(t, at(test.want), s.next(at(test.from)), "%s from %s", test.spec, test.from)
+	}
+	s, err := parseSchedule("0 0 30 2 *")
+	require.NoError(t, err)
+	assert.True(t, s.next(at("2026-10-16 00:00")).IsZero())
+}
@@ -0,0 +1,384 @@
+// Package scheduler provides the scheduler command.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ebadenes/eclone/cmd/rcd"
+	"github.com/ebadenes/eclone/cmd/sdnotify"
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/rc/jobs"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "scheduler jobs.json",
+	Short: `Run the jobs in the file given on their schedules.`,
+	// Note: "|" will be replaced by backticks below
+	Long: strings.ReplaceAll(`Run the jobs in the file given on their cron schedules, in this
+process, until stopped.
+
+Each job is an rc command, like |sync/copy| or |operations/check|,
+with its parameters and a schedule:
+
+    {
+      "jobs": [
+        {
+          "name": "nightly",
+          "schedule": "30 2 * * *",
+          "command": "sync/sync",
+          "params": {"srcFs": "/data", "dstFs": "gc:{id}/backup"}
+        },
+        {
+          "name": "audit",
+          "schedule": "@every 6h",
+          "command": "operations/check",
+          "params": {"srcFs": "gc:{id}/backup", "dstFs": "gc:{id2}/backup"}
+        }
+      ]
+    }
+
+The schedule has the five fields of cron, minute, hour, day of month,
+month and day of week, in local time, each a |*|, a number, a range or
+a list of these, optionally with a |/step|, or is one of |@hourly|,
+|@daily|, |@weekly|, |@monthly|, |@yearly| or |@every DURATION|.
+
+The remotes in |fs|, |srcFs| and |dstFs| are created when the scheduler
+starts and kept for its life, so jobs using the same remote share its
+service account pool, with its rotation state and blacklist, rather
+than each building its own. A job still running when it is next due is
+not started again, so no lock files are needed.
+
+Each run is an rc job, which |job/status| and |core/stats| report on.
+With |--rc| the scheduler is controlled over rc too: |scheduler/list|
+shows the state of every job and |scheduler/run name=NAME| runs one
+straight away.
+
+Run as a systemd service with |Type=notify|, the scheduler tells
+systemd it is ready once the remotes are created and, with
+|WatchdogSec| set, pings the watchdog while the transfers of its jobs
+are making progress, so one which hangs gets it restarted.
+`, "|", "`"),
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		cmd.Run(false, false, command, func() error {
+			ctx := context.Background()
+			s, err := Load(args[0])
+			if err != nil {
+				return err
+			}
+			rcd.Preload(ctx, s.remotes())
+			defer sdnotify.Ready(ctx)()
+			return s.Run(ctx)
+		})
+	},
+}
+
+// Job is a job of the jobs file.
+type Job struct {
+	Name     string    `json:"name"`
+	Schedule string    `json:"schedule"`
+	Command  string    `json:"command"`
+	Params   rc.Params `json:"params,omitempty"`
+}
+
+// jobsFile is the format of the jobs file
+type jobsFile struct {
+	Jobs []Job `json:"jobs"`
+}
+
+// JobStatus is the state of a job, as shown by scheduler/list.
+type JobStatus struct {
+	Name      string    `json:"name"`
+	Schedule  string    `json:"schedule"`
+	Command   string    `json:"command"`
+	Next      time.Time `json:"next"`
+	Running   bool      `json:"running"`
+	Runs      int       `json:"runs"`
+	Failures  int       `json:"failures"`
+	Skipped   int       `json:"skipped"` // runs not started as the job was still running
+	LastJobID int64     `json:"lastJobId,omitempty"`
+	LastStart time.Time `json:"lastStart"`
+	LastEnd   time.Time `json:"lastEnd"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// job is a job with its schedule and state
+type job struct {
+	Job
+	schedule *schedule
+	call     *rc.Call
+
+	mu     sync.Mutex // protects status
+	status JobStatus
+}
+
+// Scheduler runs jobs on their schedules.
+type Scheduler struct {
+	jobs []*job
+	now  func() time.Time
+	wg   sync.WaitGroup // running jobs
+}
+
+// New returns a Scheduler for jobs, checking them.
+func New(jobs []Job) (*Scheduler, error) {
+	s := &Scheduler{now: time.Now}
+	names := map[string]bool{}
+	for _, j := range jobs {
+		if j.Name == "" {
+			return nil, errors.New("a job has no name")
+		}
+		if names[j.Name] {
+			return nil, fmt.Errorf("job %q: duplicate name", j.Name)
+		}
+		names[j.Name] = true
+		sched, err := parseSchedule(j.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("job %q: %w", j.Name, err)
+		}
+		call := rc.Calls.Get(j.Command)
+		if call == nil {
+			return nil, fmt.Errorf("job %q: unknown command %q", j.Name, j.Command)
+		}
+		if _, ok := j.Params["_async"]; ok {
+			return nil, fmt.Errorf("job %q: _async can't be set", j.Name)
+		}
+		s.jobs = append(s.jobs, &job{
+			Job:      j,
+			schedule: sched,
+			call:     call,
+			status:   JobStatus{Name: j.Name, Schedule: j.Schedule, Command: j.Command},
+		})
+	}
+	if len(s.jobs) == 0 {
+		return nil, errors.New("no jobs")
+	}
+	return s, nil
+}
+
+// Load returns a Scheduler for the jobs in the file at path.
+func Load(path string) (*Scheduler, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jobs: %w", err)
+	}
+	var file jobsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse jobs %q: %w", path, err)
+	}
+	return New(file.Jobs)
+}
+
+// remotes returns the remotes the jobs use, to be created up front.
+func (s *Scheduler) remotes() (remotes []string) {
+	for _, j := range s.jobs {
+		for _, key := range []string{"fs", "srcFs", "dstFs"} {
+			if remote, err := j.Params.GetString(key); err == nil && remote != "" && !slices.Contains(remotes, remote) {
+				remotes = append(remotes, remote)
+			}
+		}
+	}
+	return remotes
+}
+
+// find returns the job called name, or nil.
+func (s *Scheduler) find(name string) *job {
+	for _, j := range s.jobs {
+		if j.Name == name {
+			return j
+		}
+	}
+	return nil
+}
+
+// start runs j in the background unless it is still running, and
+// returns whether it was started.
+func (s *Scheduler) start(ctx context.Context, j *job) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status.Running {
+		j.status.Skipped++
+		fs.Logf(nil, "Scheduler: job %q still running - not starting it again", j.Name)
+		return false
+	}
+	j.status.Running = true
+	j.status.LastStart = s.now()
+	j.status.Runs++
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		fs.Infof(nil, "Scheduler: starting job %q", j.Name)
+		// The params are used again on the next run, so each run gets its
+		// own copy rather than relying on NewJob to leave them alone
+		rcJob, _, err := jobs.NewJob(ctx, j.call.Fn, j.Params.Copy())
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		j.status.Running = false
+		j.status.LastEnd = s.now()
+		j.status.LastError = ""
+		if rcJob != nil {
+			j.status.LastJobID = rcJob.ID
+		}
+		if err != nil {
+			j.status.Failures++
+			j.status.LastError = err.Error()
+			fs.Errorf(nil, "Scheduler: job %q failed: %v", j.Name, err)
+			return
+		}
+		fs.Infof(nil, "Scheduler: job %q finished in %v", j.Name, j.status.LastEnd.Sub(j.status.LastStart).Round(time.Second))
+	}()
+	return true
+}
+
+// runDue starts the jobs due at now and returns when the next one is.
+func (s *Scheduler) runDue(ctx context.Context, now time.Time) (next time.Time) {
+	for _, j := range s.jobs {
+		j.mu.Lock()
+		due := !j.status.Next.IsZero() && !j.status.Next.After(now)
+		j.mu.Unlock()
+		if due {
+			s.start(ctx, j)
+		}
+		j.mu.Lock()
+		if j.status.Next.IsZero() || due {
+			j.status.Next = j.schedule.next(now)
+		}
+		if !j.status.Next.IsZero() && (next.IsZero() || j.status.Next.Before(next)) {
+			next = j.status.Next
+		}
+		j.mu.Unlock()
+	}
+	return next
+}
+
+var (
+	activeMu sync.Mutex
+	active   *Scheduler // the running scheduler, for the rc
+)
+
+// Run runs the jobs on their schedules until ctx is done, then waits for
+// those running.
+func (s *Scheduler) Run(ctx context.Context) error {
+	activeMu.Lock()
+	active = s
+	activeMu.Unlock()
+	defer func() {
+		activeMu.Lock()
+		active = nil
+		activeMu.Unlock()
+		s.wg.Wait()
+	}()
+	for {
+		next := s.runDue(ctx, s.now())
+		if next.IsZero() {
+			return errors.New("no job is due again")
+		}
+		fs.Debugf(nil, "Scheduler: next job due at %v", next.Format(time.RFC3339))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// Status returns the state of the jobs.
+func (s *Scheduler) Status() []JobStatus {
+	status := make([]JobStatus, len(s.jobs))
+	for i, j := range s.jobs {
+		j.mu.Lock()
+		status[i] = j.status
+		j.mu.Unlock()
+	}
+	return status
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:  "scheduler/list",
+		Fn:    rcList,
+		Title: "Show the state of the scheduler's jobs",
+		Help: `
+Shows, for every job of the running scheduler, its schedule, when it is
+next due, whether it is running, how many times it ran and failed, and
+the rc job ID, times and error of its last run.
+
+Eg
+
+    eclone rc scheduler/list
+`,
+	})
+	rc.Add(rc.Call{
+		Path:         "scheduler/run",
+		Fn:           rcRun,
+		AuthRequired: true,
+		Title:        "Run a job of the scheduler now",
+		Help: `
+Starts the job given straight away, unless it is running, without
+changing when it is next due.
+
+Params:
+  - name = the name of the job
+
+Returns:
+  - started = whether it was started
+
+Eg
+
+    eclone rc scheduler/run name=nightly
+`,
+	})
+}
+
+// getActive returns the running scheduler.
+func getActive() (*Scheduler, error) {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	if active == nil {
+		return nil, errors.New("the scheduler isn't running")
+	}
+	return active, nil
+}
+
+// rcList implements the scheduler/list rc call.
+func rcList(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	s, err := getActive()
+	if err != nil {
+		return nil, err
+	}
+	return rc.Params{"jobs": s.Status()}, nil
+}
+
+// rcRun implements the scheduler/run rc call.
+func rcRun(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	s, err := getActive()
+	if err != nil {
+		return nil, err
+	}
+	name, err := in.GetString("name")
+	if err != nil {
+		return nil, err
+	}
+	j := s.find(name)
+	if j == nil {
+		return nil, fmt.Errorf("no job %q", name)
+	}
+	// Not tied to the rc call, which ends straight away
+	return rc.Params{"started": s.start(context.Background(), j)}, nil
+}
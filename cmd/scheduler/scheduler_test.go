@@ -0,0 +1,146 @@
+package scheduler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	for _, bad := range [][]Job{
+		nil,
+		{{Schedule: "@daily", Command: "rc/noop"}},
+		{{Name: "a", Schedule: "@daily", Command: "rc/noop"}, {Name: "a", Schedule: "@hourly", Command: "rc/noop"}},
+		{{Name: "a", Schedule: "daily", Command: "rc/noop"}},
+		{{Name: "a", Schedule: "@daily", Command: "no/such"}},
+		{{Name: "a", Schedule: "@daily", Command: "rc/noop", Params: rc.Params{"_async": true}}},
+	} {
+		_, err := New(bad)
+		assert.Error(t, err, bad)
+	}
+
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"jobs": [
+		{"name": "nightly", "schedule": "30 2 * * *", "command": "rc/noop", "params": {"srcFs": "/data", "dstFs": "gc:backup"}},
+		{"name": "audit", "schedule": "@every 6h", "command": "rc/noop", "params": {"fs": "gc:backup"}}
+	]}`), 0600))
+	s, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/data", "gc:backup"}, s.remotes())
+}
+
+func TestRunDue(t *testing.T) {
+	ctx := context.Background()
+	release := make(chan struct{})
+	rc.Add(rc.Call{
+		Path: "scheduler/test-block",
+		Fn: func(ctx context.Context, in rc.Params) (rc.Params, error) {
+			<-release
+			return rc.Params{}, nil
+		},
+	})
+	s, err := New([]Job{
+		{Name: "ok", Schedule: "*/10 * * * *", Command: "rc/noop"},
+		{Name: "fail", Schedule: "0 * * * *", Command: "rc/error"},
+		{Name: "slow", Schedule: "*/10 * * * *", Command: "scheduler/test-block"},
+	})
+	require.NoError(t, err)
+	now := time.Date(2026, 10, 16, 1, 55, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	// The first pass only works out when the jobs are due
+	next := s.runDue(ctx, now)
+	assert.Equal(t, now.Add(5*time.Minute), next)
+	for _, status := range s.Status() {
+		assert.Equal(t, 0, status.Runs)
+	}
+
+	now = next
+	next = s.runDue(ctx, now)
+	assert.Equal(t, now.Add(10*time.Minute), next)
+	// Wait for the quick jobs
+	require.Eventually(t, func() bool {
+		status := s.Status()
+		return !status[0].Running && !status[1].Running
+	}, 5*time.Second, time.Millisecond)
+	status := s.Status()
+	assert.Equal(t, 1, status[0].Runs)
+	assert.Equal(t, 0, status[0].Failures)
+	assert.NotZero(t, status[0].LastJobID)
+	assert.Equal(t, 1, status[1].Failures)
+	assert.NotEmpty(t, status[1].LastError)
+	assert.Equal(t, now.Add(time.Hour), status[1].Next)
+	assert.True(t, status[2].Running)
+
+	// The slow job is still running when due again
+	now = next
+	s.runDue(ctx, now)
+	status = s.Status()
+	assert.Equal(t, 1, status[2].Runs)
+	assert.Equal(t, 1, status[2].Skipped)
+	close(release)
+	s.wg.Wait()
+	assert.False(t, s.Status()[2].Running)
+}
+
+func TestStartKeepsParams(t *testing.T) {
+	ctx := context.Background()
+	var groups []string
+	rc.Add(rc.Call{
+		Path: "scheduler/test-group",
+		Fn: func(ctx context.Context, in rc.Params) (rc.Params, error) {
+			group, _ := accounting.StatsGroupFromContext(ctx)
+			groups = append(groups, group)
+			return rc.Params{}, nil
+		},
+	})
+	s, err := New([]Job{
+		{Name: "grouped", Schedule: "@daily", Command: "scheduler/test-group", Params: rc.Params{"_group": "nightly"}},
+	})
+	require.NoError(t, err)
+	for range 2 {
+		require.True(t, s.start(ctx, s.jobs[0]))
+		s.wg.Wait()
+	}
+	assert.Equal(t, []string{"nightly", "nightly"}, groups)
+	assert.Equal(t, rc.Params{"_group": "nightly"}, s.jobs[0].Params)
+}
+
+func TestRC(t *testing.T) {
+	_, err := rcList(context.Background(), rc.Params{})
+	assert.ErrorContains(t, err, "isn't running")
+
+	s, err := New([]Job{{Name: "ok", Schedule: "@yearly", Command: "rc/noop"}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+	require.Eventually(t, func() bool {
+		_, err := rcList(ctx, rc.Params{})
+		return err == nil
+	}, 5*time.Second, time.Millisecond)
+
+	out, err := rcRun(ctx, rc.Params{"name": "ok"})
+	require.NoError(t, err)
+	assert.Equal(t, true, out["started"])
+	_, err = rcRun(ctx, rc.Params{"name": "missing"})
+	assert.Error(t, err)
+	require.Eventually(t, func() bool {
+		out, err := rcList(ctx, rc.Params{})
+		require.NoError(t, err)
+		status := out["jobs"].([]JobStatus)
+		return status[0].Runs == 1 && !status[0].Running
+	}, 5*time.Second, time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+	_, err = rcList(context.Background(), rc.Params{})
+	assert.Error(t, err)
+}
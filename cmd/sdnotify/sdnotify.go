@@ -0,0 +1,120 @@
+// Package sdnotify tells systemd when a long running command, like rcd,
+// scheduler or sync --watch, is ready, and pings its watchdog while the
+// transfers are making progress.
+//
+// Under a unit with Type=notify READY is sent once the remotes, and so
+// their service account pools, are loaded, so units ordered after it
+// start when it can take work. With WatchdogSec set the watchdog is
+// pinged at half that interval, but not while transfers or checks are
+// in flight and none of them has moved on since the last ping. A daemon
+// whose transfers hang then stops pinging and systemd restarts it,
+// while an idle one, or one paused until its pool comes off the
+// blacklist, carries on.
+package sdnotify
+
+import (
+	"context"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/daemon"
+	"github.com/ebadenes/eclone/backend/drive"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/lib/systemd"
+)
+
+// These are replaced by the tests
+var (
+	watchdogInterval = func() (time.Duration, error) { return daemon.SdWatchdogEnabled(false) }
+	sdNotify         = daemon.SdNotify
+	pausing          = drive.Pausing
+)
+
+// Ready tells systemd the command is ready and starts pinging the
+// watchdog, if the unit has one. It returns the function to call when
+// the command stops, which is also called on exit by a signal.
+func Ready(ctx context.Context) (stop func()) {
+	stopNotify := systemd.Notify()
+	interval, err := watchdogInterval()
+	if err != nil {
+		fs.Errorf(nil, "Failed to read the systemd watchdog interval: %v", err)
+	}
+	if interval <= 0 {
+		return stopNotify
+	}
+	stopWatchdog := startWatchdog(ctx, interval/2)
+	return func() {
+		stopWatchdog()
+		stopNotify()
+	}
+}
+
+// progress is a snapshot of the stats of all the transfers
+type progress struct {
+	done int64 // bytes, checks, transfers, deletes and listings done
+	busy bool  // transfers or checks are in flight
+}
+
+// currentProgress returns the progress summed over every stats group.
+func currentProgress(ctx context.Context) (p progress) {
+	out, err := rc.Calls.Get("core/stats").Fn(ctx, rc.Params{})
+	if err != nil {
+		return p
+	}
+	for _, key := range []string{"bytes", "checks", "transfers", "deletes", "listed"} {
+		n, _ := out.GetInt64(key)
+		p.done += n
+	}
+	_, transferring := out["transferring"]
+	_, checking := out["checking"]
+	p.busy = transferring || checking
+	return p
+}
+
+// alive returns true if the transfers aren't hung: nothing is in flight,
+// something was done since last, or the pool is paused.
+func alive(last, now progress) bool {
+	return !now.busy || now.done != last.done || pausing()
+}
+
+// startWatchdog pings the watchdog every interval while the transfers
+// are alive, until the returned function is called.
+func startWatchdog(ctx context.Context, interval time.Duration) (stop func()) {
+	fs.Infof(nil, "Pinging the systemd watchdog every %v", interval)
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		last := currentProgress(ctx)
+		stalled := false
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			now := currentProgress(ctx)
+			if !alive(last, now) {
+				if !stalled {
+					fs.Errorf(nil, "Transfers have made no progress for %v - not pinging the systemd watchdog", interval)
+				}
+				stalled = true
+				continue
+			}
+			if stalled {
+				fs.Logf(nil, "Transfers making progress again - pinging the systemd watchdog")
+			}
+			stalled = false
+			last = now
+			if _, err := sdNotify(false, daemon.SdNotifyWatchdog); err != nil {
+				fs.Errorf(nil, "Failed to ping the systemd watchdog: %v", err)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
@@ -0,0 +1,74 @@
+package sdnotify
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlive(t *testing.T) {
+	paused := false
+	oldPausing := pausing
+	pausing = func() bool { return paused }
+	defer func() { pausing = oldPausing }()
+
+	for _, test := range []struct {
+		last, now progress
+		paused    bool
+		want      bool
+	}{
+		{progress{10, false}, progress{10, false}, false, true},
+		{progress{10, true}, progress{11, true}, false, true},
+		{progress{10, true}, progress{10, true}, false, false},
+		{progress{10, false}, progress{10, true}, false, false},
+		{progress{10, true}, progress{10, true}, true, true},
+	} {
+		paused = test.paused
+		assert.Equal(t, test.want, alive(test.last, test.now), test)
+	}
+}
+
+func TestReady(t *testing.T) {
+	ctx := context.Background()
+	var pings atomic.Int32
+	oldInterval, oldNotify := watchdogInterval, sdNotify
+	defer func() { watchdogInterval, sdNotify = oldInterval, oldNotify }()
+	sdNotify = func(unsetEnvironment bool, state string) (bool, error) {
+		if state == "WATCHDOG=1" {
+			pings.Add(1)
+		}
+		return true, nil
+	}
+
+	// No watchdog
+	watchdogInterval = func() (time.Duration, error) { return 0, nil }
+	Ready(ctx)()
+	assert.Zero(t, pings.Load())
+
+	// Idle, so pinged
+	watchdogInterval = func() (time.Duration, error) { return 20 * time.Millisecond, nil }
+	stop := Ready(ctx)
+	defer stop()
+	require.Eventually(t, func() bool { return pings.Load() >= 2 }, 5*time.Second, time.Millisecond)
+
+	// A transfer in flight which doesn't move stops the pings
+	f, err := mockfs.NewFs(ctx, "sdnotify", "root", nil)
+	require.NoError(t, err)
+	stats := accounting.GlobalStats()
+	tr := stats.NewTransferRemoteSize("file", 100, f, f)
+	time.Sleep(50 * time.Millisecond)
+	stalled := pings.Load()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, stalled, pings.Load())
+
+	// Until it does
+	stats.Bytes(1)
+	require.Eventually(t, func() bool { return pings.Load() > stalled }, 5*time.Second, time.Millisecond)
+	tr.Done(ctx, nil)
+}
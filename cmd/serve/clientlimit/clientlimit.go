@@ -0,0 +1,137 @@
+// Package clientlimit caps how many requests each client of a server can
+// have in flight at once.
+//
+// A media server pointed at a big drive can fire off hundreds of
+// concurrent requests, enough to run through the quota of every service
+// account in the pool. With a limit each client waits for one of its own
+// requests to finish instead, leaving room for the others. The limit is
+// applied by a Front put before the server.
+package clientlimit
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/rclone/rclone/fs/config/flags"
+	libhttp "github.com/rclone/rclone/lib/http"
+	"github.com/spf13/pflag"
+)
+
+// Help describes the limit, for the help of the serve commands
+// Note: "|" will be replaced by backticks below
+var Help = strings.ReplaceAll(`### Limiting the requests of each client
+
+|--max-client-requests| limits how many requests each client can have in
+flight at once, counting clients by user if authentication is in use,
+otherwise by IP address. Further requests wait for an earlier one to
+finish. Clients scanning a large drive can otherwise issue enough
+parallel requests to use up the quota of a service account pool. The
+default of 0 means no limit.
+
+The limit is applied by eclone in front of the server, which then
+listens on a private unix socket.
+`, "|", "`")
+
+// AddFlags adds the flag setting the limit in opt to flagSet.
+func AddFlags(flagSet *pflag.FlagSet, opt *Options) {
+	flags.IntVarP(flagSet, &opt.MaxClientRequests, "max-client-requests", "", opt.MaxClientRequests, "Max requests each client can have in flight, 0 for no limit", "")
+}
+
+// Options controls the limit
+type Options struct {
+	MaxClientRequests int // requests in flight per client, 0 for no limit
+}
+
+// client is the in flight requests of one client
+type client struct {
+	slots chan struct{}
+	users int // requests using or waiting for a slot
+}
+
+// Limiter limits the requests in flight per client.
+type Limiter struct {
+	max     int
+	mu      sync.Mutex
+	clients map[string]*client
+}
+
+// New makes a Limiter allowing max requests per client in flight, or any
+// number if max <= 0.
+func New(opt Options) *Limiter {
+	return &Limiter{
+		max:     opt.MaxClientRequests,
+		clients: make(map[string]*client),
+	}
+}
+
+// ClientID returns the name of the client making r: the user of its
+// certificate or basic authentication if there is one, otherwise the
+// remote IP address. The password is checked by the server behind.
+func ClientID(r *http.Request) string {
+	if user, ok := libhttp.CtxGetUser(r.Context()); ok && user != "" {
+		return "user:" + user
+	}
+	if user, _, ok := r.BasicAuth(); ok && user != "" {
+		return "user:" + user
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// acquire waits for a slot for id, returning false if done is closed first.
+func (l *Limiter) acquire(id string, done <-chan struct{}) (*client, bool) {
+	l.mu.Lock()
+	c, ok := l.clients[id]
+	if !ok {
+		c = &client{slots: make(chan struct{}, l.max)}
+		l.clients[id] = c
+	}
+	c.users++
+	l.mu.Unlock()
+	select {
+	case c.slots <- struct{}{}:
+		return c, true
+	case <-done:
+		l.release(id, c, false)
+		return nil, false
+	}
+}
+
+// release gives back the slot of c if held and forgets id once idle.
+func (l *Limiter) release(id string, c *client, held bool) {
+	if held {
+		<-c.slots
+	}
+	l.mu.Lock()
+	c.users--
+	if c.users == 0 {
+		delete(l.clients, id)
+	}
+	l.mu.Unlock()
+}
+
+// Middleware returns next wrapped so requests over the limit wait for one
+// of the client's earlier requests to finish.
+//
+// It must come after any authentication middleware for the limit to be
+// per user rather than per address.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	if l.max <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := ClientID(r)
+		c, ok := l.acquire(id, r.Context().Done())
+		if !ok {
+			// The client went away while waiting
+			return
+		}
+		defer l.release(id, c, true)
+		next.ServeHTTP(w, r)
+	})
+}
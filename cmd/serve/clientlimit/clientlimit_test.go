@@ -0,0 +1,123 @@
+package clientlimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientID(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	assert.Equal(t, "addr:10.0.0.1", ClientID(r))
+	r.RemoteAddr = "@"
+	assert.Equal(t, "addr:@", ClientID(r))
+	r.SetBasicAuth("alice", "secret")
+	assert.Equal(t, "user:alice", ClientID(r))
+}
+
+func TestMiddlewareUnlimited(t *testing.T) {
+	var inFlight atomic.Int32
+	release := make(chan struct{})
+	l := New(Options{})
+	h := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight.Add(1)
+		<-release
+	}))
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		}()
+	}
+	assert.Eventually(t, func() bool { return inFlight.Load() == 5 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Empty(t, l.clients)
+}
+
+func TestMiddlewareLimitsPerClient(t *testing.T) {
+	const max = 2
+	l := New(Options{MaxClientRequests: max})
+	var inFlight, peak atomic.Int32
+	release := make(chan struct{})
+	h := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		for {
+			old := peak.Load()
+			if n <= old || peak.CompareAndSwap(old, n) {
+				break
+			}
+		}
+		<-release
+		inFlight.Add(-1)
+	}))
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = "10.0.0.1:1234"
+			h.ServeHTTP(httptest.NewRecorder(), r)
+		}()
+	}
+
+	// Another client isn't held up by the first
+	other := make(chan struct{})
+	go func() {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = "10.0.0.2:1234"
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		close(other)
+	}()
+
+	assert.Eventually(t, func() bool { return inFlight.Load() == max+1 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+	<-other
+	assert.Equal(t, int32(max+1), peak.Load())
+	assert.Empty(t, l.clients)
+}
+
+func TestMiddlewareClientGone(t *testing.T) {
+	l := New(Options{MaxClientRequests: 1})
+	release := make(chan struct{})
+	called := 0
+	h := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called++
+		<-release
+	}))
+
+	first := make(chan struct{})
+	go func() {
+		r := httptest.NewRequest("GET", "/", nil)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		close(first)
+	}()
+	assert.Eventually(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return len(l.clients) == 1
+	}, time.Second, time.Millisecond)
+
+	// A waiting request whose client goes away returns without being served
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	close(release)
+	<-first
+	assert.Equal(t, 1, called)
+	assert.Empty(t, l.clients)
+}
@@ -0,0 +1,108 @@
+package clientlimit
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/atexit"
+	libhttp "github.com/rclone/rclone/lib/http"
+)
+
+// Front applies a limit in front of one of rclone's HTTP servers.
+//
+// Those servers can't be given more middleware, so the front listens on
+// the addresses of the server, with its TLS, and forwards the requests
+// the limit lets through to the server, which listens on a unix socket
+// in a private directory instead. Passwords are checked by the server.
+type Front struct {
+	server *libhttp.Server
+	dir    string // holding the socket of the server
+	closed sync.Once
+	err    error // from closing
+}
+
+// NewFront starts serving with the limit l on the addresses of cfg,
+// the config of the server to put it in front of, and changes cfg to
+// listen on a private unix socket without TLS.
+func NewFront(ctx context.Context, cfg *libhttp.Config, l *Limiter) (*Front, error) {
+	dir, err := os.MkdirTemp("", "eclone-serve-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to make the server socket directory: %w", err)
+	}
+	socket := filepath.Join(dir, "serve.sock")
+	frontCfg := *cfg
+	// The server behind deals with these
+	frontCfg.BaseURL = ""
+	frontCfg.AllowOrigin = ""
+	s, err := libhttp.NewServer(ctx, libhttp.WithConfig(frontCfg))
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to start the client limit: %w", err)
+	}
+	proxy := newProxy(socket)
+	router := s.Router()
+	router.Use(l.Middleware)
+	router.Handle("/*", proxy)
+	// Methods unknown to the router, such as those of WebDAV, too
+	router.MethodNotAllowed(proxy.ServeHTTP)
+
+	cfg.ListenAddr = []string{socket}
+	cfg.TLSCert, cfg.TLSKey, cfg.ClientCA = "", "", ""
+	cfg.TLSCertBody, cfg.TLSKeyBody = nil, nil
+
+	f := &Front{server: s, dir: dir}
+	s.Serve()
+	for _, url := range s.URLs() {
+		fs.Logf(nil, "Limiting each client to %d requests in flight on %s", l.max, url)
+	}
+	atexit.Register(func() { _ = f.Close() })
+	return f, nil
+}
+
+// newProxy returns a proxy forwarding requests as they are to the
+// server listening on socket.
+func newProxy(socket string) *httputil.ReverseProxy {
+	target := &url.URL{Scheme: "http", Host: "localhost"}
+	var dialer net.Dialer
+	return &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			// S3 signatures and WebDAV destinations depend on the host
+			r.Out.Host = r.In.Host
+			r.SetXForwarded()
+		},
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+			MaxIdleConnsPerHost: 64,
+		},
+		// Stream responses as they come
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if r.Context().Err() == nil {
+				fs.Errorf(nil, "Failed to forward %s %s: %v", r.Method, r.URL.Path, err)
+			}
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+}
+
+// Close stops the front and removes the socket directory.
+func (f *Front) Close() error {
+	f.closed.Do(func() {
+		f.err = f.server.Shutdown()
+		if err := os.RemoveAll(f.dir); f.err == nil {
+			f.err = err
+		}
+	})
+	return f.err
+}
@@ -0,0 +1,55 @@
+package clientlimit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+
+	libhttp "github.com/rclone/rclone/lib/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFront(t *testing.T) {
+	ctx := context.Background()
+	cfg := libhttp.DefaultCfg()
+	cfg.ListenAddr = []string{"127.0.0.1:0"}
+	cfg.BaseURL = "/base"
+	f, err := NewFront(ctx, &cfg, New(Options{MaxClientRequests: 1}))
+	require.NoError(t, err)
+	require.Len(t, cfg.ListenAddr, 1)
+	socket := cfg.ListenAddr[0]
+	assert.Equal(t, "/base", cfg.BaseURL)
+
+	// The server behind, on the socket, echoing what it is sent
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	go func() {
+		_ = http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprintf(w, "%s %s %s", r.Method, r.Host, r.URL.Path)
+		}))
+	}()
+
+	url := f.server.URLs()[0]
+	host := f.server.Addr().String()
+	for _, method := range []string{"GET", "PROPFIND"} {
+		req, err := http.NewRequest(method, url+"base/dir/file.txt", nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, method+" "+host+" /base/dir/file.txt", string(body))
+	}
+
+	require.NoError(t, f.Close())
+	require.NoError(t, f.Close())
+	_, err = os.Stat(f.dir)
+	assert.True(t, os.IsNotExist(err))
+}
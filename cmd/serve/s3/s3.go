@@ -0,0 +1,55 @@
+// Package s3 adds a limit on the requests of each client to the serve s3
+// command and documents serving a drive remote with an SA pool.
+//
+// The command is rclone's, which already serves a drive remote through
+// its SA pool like any other command. S3 clients send many requests in
+// parallel, so --max-client-requests puts a clientlimit.Front before the
+// server to stop one of them using up the pool.
+package s3
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ebadenes/eclone/cmd/serve/clientlimit"
+	"github.com/rclone/rclone/cmd"
+	rs3 "github.com/rclone/rclone/cmd/serve/s3"
+	"github.com/spf13/cobra"
+)
+
+// help is added to the help of the serve s3 command
+// Note: "|" will be replaced by backticks below
+var help = strings.ReplaceAll(`
+### Serving a drive with a service account pool
+
+Served from a drive remote with a service account pool, requests go
+through the pool like any other eclone command, switching account when
+one is rate limited. Add |--drive-sa-spread-reads| to spread objects
+being read at the same time over the preloaded accounts. S3 clients
+tend to send many requests in parallel, so limit them with
+|--max-client-requests|:
+
+    eclone serve s3 --auth-key ACCESS_KEY_ID,SECRET_ACCESS_KEY --max-client-requests 8 --drive-sa-spread-reads gc:
+
+`, "|", "`")
+
+// limit is set by the command line flags
+var limit clientlimit.Options
+
+func init() {
+	command, _, err := cmd.Root.Find([]string{"serve", "s3"})
+	if err != nil || command.Name() != "s3" {
+		panic("serve s3 command not found")
+	}
+	clientlimit.AddFlags(command.Flags(), &limit)
+	command.Long += help + clientlimit.Help
+	runE := command.RunE
+	command.RunE = func(command *cobra.Command, args []string) error {
+		if limit.MaxClientRequests > 0 {
+			if _, err := clientlimit.NewFront(context.Background(), &rs3.Opt.HTTP, clientlimit.New(limit)); err != nil {
+				return err
+			}
+		}
+		return runE(command, args)
+	}
+}
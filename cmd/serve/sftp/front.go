@@ -0,0 +1,129 @@
+//go:build !plan9
+
+package sftp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	rsftp "github.com/rclone/rclone/cmd/serve/sftp"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/atexit"
+)
+
+// front listens on the address of the server and forwards each
+// connection to the server, which listens on a local port instead,
+// logging the traffic of the session when it ends.
+type front struct {
+	listener net.Listener
+	server   string // address the server listens on
+}
+
+// newFront starts forwarding from the address in opt and changes opt to
+// have the server listen on a free local port.
+func newFront(opt *rsftp.Options) (*front, error) {
+	listener, err := net.Listen("tcp", opt.ListenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for connection: %w", err)
+	}
+	server, err := freeAddr()
+	if err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	opt.ListenAddr = server
+	f := &front{listener: listener, server: server}
+	go f.serve()
+	fs.Logf(nil, "Logging SFTP session stats on %v", listener.Addr())
+	atexit.Register(func() { _ = f.listener.Close() })
+	return f, nil
+}
+
+// freeAddr returns a local address no one is listening on.
+func freeAddr() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("failed to find a port for the server: %w", err)
+	}
+	addr := l.Addr().String()
+	return addr, l.Close()
+}
+
+// serve forwards connections until the listener is closed
+func (f *front) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			fs.Errorf(nil, "Failed to accept incoming connection: %v", err)
+			continue
+		}
+		go func() {
+			what := "serve sftp " + conn.RemoteAddr().String()
+			if s := f.forward(what, conn); s != nil {
+				fs.Infof(what, "Session ended: %v", s)
+			}
+		}()
+	}
+}
+
+// forward copies between client and a new connection to the server
+// until either closes, returning what went through or nil if the server
+// couldn't be reached.
+func (f *front) forward(what string, client net.Conn) *session {
+	server, err := net.Dial("tcp", f.server)
+	if err != nil {
+		fs.Errorf(what, "Failed to connect to the server: %v", err)
+		_ = client.Close()
+		return nil
+	}
+	fs.Debugf(what, "Forwarding from %v", server.LocalAddr())
+	s := &session{start: time.Now()}
+	var wg sync.WaitGroup
+	pipe := func(dst, src net.Conn, n *atomic.Int64) {
+		defer wg.Done()
+		_, _ = io.Copy(countingWriter{w: dst, n: n}, src)
+		// Ends the copy the other way too
+		_ = dst.Close()
+		_ = src.Close()
+	}
+	wg.Add(2)
+	go pipe(server, client, &s.received)
+	go pipe(client, server, &s.sent)
+	wg.Wait()
+	return s
+}
+
+// session is the traffic of one SSH session
+type session struct {
+	start    time.Time
+	received atomic.Int64 // bytes from the client
+	sent     atomic.Int64 // bytes to the client
+}
+
+// String returns a summary of the session for the log
+func (s *session) String() string {
+	return fmt.Sprintf("received %v, sent %v in %v",
+		fs.SizeSuffix(s.received.Load()).ByteUnit(), fs.SizeSuffix(s.sent.Load()).ByteUnit(),
+		time.Since(s.start).Round(time.Second))
+}
+
+// countingWriter counts the bytes written to w in n.
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+// Write writes p to w, counting the bytes written
+func (c countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,62 @@
+//go:build !plan9
+
+package sftp
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	rsftp "github.com/rclone/rclone/cmd/serve/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFront(t *testing.T) {
+	opt := rsftp.Options{ListenAddr: "127.0.0.1:0"}
+	f, err := newFront(&opt)
+	require.NoError(t, err)
+	defer func() { _ = f.listener.Close() }()
+	assert.NotEqual(t, f.listener.Addr().String(), opt.ListenAddr)
+
+	// A server answering "hello" with "hi"
+	server, err := net.Listen("tcp", opt.ListenAddr)
+	require.NoError(t, err)
+	defer func() { _ = server.Close() }()
+	go func() {
+		conn, err := server.Accept()
+		if err != nil {
+			return
+		}
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(conn, buf); err == nil {
+			_, _ = conn.Write([]byte("hi"))
+		}
+		_ = conn.Close()
+	}()
+
+	client, peer := net.Pipe()
+	sessions := make(chan *session)
+	go func() { sessions <- f.forward("test", peer) }()
+	_, err = client.Write([]byte("hello"))
+	require.NoError(t, err)
+	reply, err := io.ReadAll(client)
+	require.NoError(t, err)
+	assert.Equal(t, "hi", string(reply))
+	_ = client.Close()
+
+	s := <-sessions
+	require.NotNil(t, s)
+	assert.Equal(t, int64(5), s.received.Load())
+	assert.Equal(t, int64(2), s.sent.Load())
+	assert.Contains(t, s.String(), "received 5 B, sent 2 B in ")
+}
+
+func TestFrontNoServer(t *testing.T) {
+	addr, err := freeAddr()
+	require.NoError(t, err)
+	f := &front{server: addr}
+	client, peer := net.Pipe()
+	defer func() { _ = client.Close() }()
+	assert.Nil(t, f.forward("test", peer))
+}
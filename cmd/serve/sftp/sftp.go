@@ -0,0 +1,60 @@
+//go:build !plan9
+
+// Package sftp adds per session stats to the serve sftp command.
+//
+// The command is rclone's, which already serves a drive remote through
+// its SA pool like any other command. Tools which only speak SFTP push
+// into a drive session by session, and rclone only logs the total of all
+// of them, so --session-stats puts a front before the server which logs
+// the traffic of each SSH session when it ends.
+package sftp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rclone/rclone/cmd"
+	rsftp "github.com/rclone/rclone/cmd/serve/sftp"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/spf13/cobra"
+)
+
+// help is added to the help of the serve sftp command
+// Note: "|" will be replaced by backticks below
+var help = strings.ReplaceAll(`
+### Session stats
+
+With |--session-stats| the traffic of each SSH session is logged at
+INFO level when it ends, with the address of the client:
+
+    serve sftp 192.0.2.7:51234: Session ended: received 48.2 GiB, sent 3.1 MiB in 1h5m3s
+
+The counts are of the encrypted SSH traffic, so they are a little more
+than the files read and written. eclone listens on |--addr| and
+forwards each connection to the server, which listens on a local port
+instead, so the server logs every client as coming from 127.0.0.1. The
+"Forwarding" line at DEBUG level gives the local address of each client
+to follow it in those logs. The stats are not available with |--stdio|.
+`, "|", "`")
+
+// sessionStats is set by the command line flags
+var sessionStats bool
+
+func init() {
+	command, _, err := cmd.Root.Find([]string{"serve", "sftp"})
+	if err != nil || command.Name() != "sftp" {
+		panic("serve sftp command not found")
+	}
+	flags.BoolVarP(command.Flags(), &sessionStats, "session-stats", "", false, "Log the traffic of each SSH session when it ends", "")
+	command.Long += help
+	run := command.Run
+	command.Run = func(command *cobra.Command, args []string) {
+		if sessionStats && !rsftp.Opt.Stdio {
+			if _, err := newFront(&rsftp.Opt); err != nil {
+				fs.Fatal(nil, fmt.Sprint(err))
+			}
+		}
+		run(command, args)
+	}
+}
@@ -0,0 +1,7 @@
+// Build for sftp for unsupported platforms to stop go complaining
+// about "no buildable Go source files "
+
+//go:build plan9
+
+// Package sftp adds per session stats to the serve sftp command
+package sftp
@@ -0,0 +1,38 @@
+// Package webdav adds a limit on the requests of each client to the serve
+// webdav command.
+//
+// The command is rclone's, which already serves a drive remote through
+// its SA pool like any other command. Media servers pointed at a huge
+// drive can still send enough requests at once to use up the pool, so
+// --max-client-requests puts a clientlimit.Front before the server.
+package webdav
+
+import (
+	"context"
+
+	"github.com/ebadenes/eclone/cmd/serve/clientlimit"
+	"github.com/rclone/rclone/cmd"
+	rwebdav "github.com/rclone/rclone/cmd/serve/webdav"
+	"github.com/spf13/cobra"
+)
+
+// limit is set by the command line flags
+var limit clientlimit.Options
+
+func init() {
+	command, _, err := cmd.Root.Find([]string{"serve", "webdav"})
+	if err != nil || command.Name() != "webdav" {
+		panic("serve webdav command not found")
+	}
+	clientlimit.AddFlags(command.Flags(), &limit)
+	command.Long += "\n" + clientlimit.Help
+	runE := command.RunE
+	command.RunE = func(command *cobra.Command, args []string) error {
+		if limit.MaxClientRequests > 0 {
+			if _, err := clientlimit.NewFront(context.Background(), &rwebdav.Opt.HTTP, clientlimit.New(limit)); err != nil {
+				return err
+			}
+		}
+		return runE(command, args)
+	}
+}
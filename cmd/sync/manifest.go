@@ -0,0 +1,211 @@
+package sync
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	gosync "sync"
+
+	"github.com/ebadenes/eclone/cmd/finished"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/sync"
+)
+
+// manifestEntry is one line of a manifest: a file which was in sync.
+type manifestEntry struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	Hash string `json:"hash,omitempty"` // type:value, if it could be had cheaply
+}
+
+// manifest appends the files found or made identical by a sync to a file,
+// one JSON entry per line.
+//
+// Files already identical are written as soon as the sync sees them, and
+// transferred files as soon as their transfer succeeds, so a run cut
+// short, or killed, keeps what it did. The transfers are only seen
+// succeed by the stats, which don't have the objects, so transferred
+// files are written without their hash.
+type manifest struct {
+	mu     gosync.Mutex
+	out    *os.File
+	enc    *json.Encoder
+	ht     hash.Type
+	dryRun bool
+}
+
+// newManifest opens file for appending the files synced from fsrc to fdst.
+func newManifest(file string, fsrc, fdst fs.Info) (*manifest, error) {
+	out, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	// A run killed part way through may have left half a line
+	if info, err := out.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err = out.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			_, _ = out.Write([]byte{'\n'})
+		}
+	}
+	return &manifest{
+		out: out,
+		enc: json.NewEncoder(out),
+		ht:  fsrc.Hashes().Overlap(fdst.Hashes()).GetOne(),
+	}, nil
+}
+
+// entry returns the manifest entry for src, taking its hash from whichever
+// of src and dst has it without reading the data.
+func (m *manifest) entry(ctx context.Context, src fs.Object, dst fs.DirEntry) manifestEntry {
+	e := manifestEntry{Path: src.Remote(), Size: src.Size()}
+	if m.ht == hash.None {
+		return e
+	}
+	for _, o := range []fs.DirEntry{src, dst} {
+		if o, ok := o.(fs.Object); ok && !o.Fs().Features().SlowHash {
+			if sum, err := o.Hash(ctx, m.ht); err == nil && sum != "" {
+				e.Hash = m.ht.String() + ":" + sum
+				break
+			}
+		}
+	}
+	return e
+}
+
+// write appends e to the manifest - call with m.mu held.
+func (m *manifest) write(e manifestEntry) {
+	if err := m.enc.Encode(e); err != nil {
+		fs.Errorf(nil, "Failed to write manifest: %v", err)
+	}
+}
+
+// wrap returns a logger which records the files already in sync before
+// passing everything on to next.
+func (m *manifest) wrap(next operations.LoggerFn) operations.LoggerFn {
+	return func(ctx context.Context, sigil operations.Sigil, src, dst fs.DirEntry, err error) {
+		if o, ok := src.(fs.Object); ok && sigil == operations.Match && err == nil {
+			e := m.entry(ctx, o, dst)
+			m.mu.Lock()
+			m.write(e)
+			m.mu.Unlock()
+		}
+		next(ctx, sigil, src, dst, err)
+	}
+}
+
+// finished records the file of tr if it was transferred, unless in a
+// dry run.
+func (m *manifest) finished(tr accounting.TransferSnapshot) {
+	if tr.What != "transferring" || tr.Error != nil || m.dryRun {
+		return
+	}
+	m.mu.Lock()
+	m.write(manifestEntry{Path: tr.Name, Size: tr.Size})
+	m.mu.Unlock()
+}
+
+// Close closes the manifest file
+func (m *manifest) Close() error {
+	return m.out.Close()
+}
+
+// syncManifest syncs fsrc to fdst, appending the files in sync to the
+// manifest file if set.
+func syncManifest(ctx context.Context, fdst, fsrc fs.Fs, file string) error {
+	if file == "" {
+		return sync.Sync(ctx, fdst, fsrc, createEmptySrcDirs)
+	}
+	m, err := newManifest(file, fsrc, fdst)
+	if err != nil {
+		return err
+	}
+	m.dryRun = fs.GetConfig(ctx).DryRun
+	watcher := finished.Watch(ctx, m.finished)
+	logger, _ := operations.GetLogger(ctx)
+	err = sync.Sync(operations.WithLogger(ctx, m.wrap(logger)), fdst, fsrc, createEmptySrcDirs)
+	watcher.Stop()
+	if closeErr := m.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// loadManifest returns the paths in the manifest file. A missing file is
+// an empty manifest and lines which can't be decoded, as left by a run
+// killed part way through, are skipped.
+func loadManifest(file string) (map[string]struct{}, error) {
+	done := make(map[string]struct{})
+	in, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		fs.Logf(nil, "Manifest %q not found - syncing everything", file)
+		return done, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer func() { _ = in.Close() }()
+	r := bufio.NewReader(in)
+	for lineNo := 1; ; lineNo++ {
+		line, readErr := r.ReadBytes('\n')
+		if len(line) > 1 {
+			var e manifestEntry
+			if err := json.Unmarshal(line, &e); err != nil || e.Path == "" {
+				fs.Logf(nil, "Skipping bad line %d of manifest %q", lineNo, file)
+			} else {
+				done[e.Path] = struct{}{}
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, fmt.Errorf("failed to read manifest: %w", readErr)
+		}
+	}
+	fs.Infof(nil, "Skipping %d file(s) listed in manifest %q", len(done), file)
+	return done, nil
+}
+
+// skipFs hides the files in skip from the listings of the Fs it wraps so
+// a sync neither checks, transfers nor deletes them.
+//
+// Listings go through List, so ListR and ListP are left out of the
+// features.
+type skipFs struct {
+	fs.Fs
+	skip map[string]struct{}
+}
+
+// Features returns the optional features of the wrapped Fs but for the
+// listing ones
+func (f *skipFs) Features() *fs.Features {
+	features := *f.Fs.Features()
+	features.ListR = nil
+	features.ListP = nil
+	return &features
+}
+
+// List lists dir in the wrapped Fs, leaving out the files to skip
+func (f *skipFs) List(ctx context.Context, dir string) (fs.DirEntries, error) {
+	entries, err := f.Fs.List(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	kept := entries[:0]
+	for _, entry := range entries {
+		if _, ok := entry.(fs.Object); ok {
+			if _, done := f.skip[entry.Remote()]; done {
+				continue
+			}
+		}
+		kept = append(kept, entry)
+	}
+	return kept, nil
+}
@@ -0,0 +1,130 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/memory"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// put uploads content as remote to f
+func put(t *testing.T, f fs.Fs, remote, content string) {
+	t.Helper()
+	src := object.NewStaticObjectInfo(remote, time.Now(), int64(len(content)), true, nil, nil)
+	_, err := f.Put(context.Background(), bytes.NewBufferString(content), src)
+	require.NoError(t, err)
+}
+
+// read returns the content of remote in f
+func read(t *testing.T, f fs.Fs, remote string) string {
+	t.Helper()
+	o, err := f.NewObject(context.Background(), remote)
+	require.NoError(t, err)
+	content, err := operations.ReadFile(context.Background(), o)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestSyncManifest(t *testing.T) {
+	ctx := context.Background()
+	fsrc, err := fs.NewFs(ctx, ":memory:manifest-src")
+	require.NoError(t, err)
+	fdst, err := fs.NewFs(ctx, ":memory:manifest-dst")
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "sync.jsonl")
+
+	put(t, fsrc, "same.txt", "same")
+	put(t, fdst, "same.txt", "same")
+	put(t, fsrc, "dir/new.txt", "new")
+	require.NoError(t, syncManifest(ctx, fdst, fsrc, file))
+
+	buf, err := os.ReadFile(file)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(buf)), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, string(buf), `{"path":"same.txt","size":4,"hash":"md5:`)
+	assert.Contains(t, string(buf), `{"path":"dir/new.txt","size":3}`)
+
+	// Half a line left by a killed run is skipped and ended
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0666)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"path":"trunc`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	// Files in the manifest are neither checked, transferred nor deleted
+	done, err := loadManifest(file)
+	require.NoError(t, err)
+	assert.Len(t, done, 2)
+	put(t, fsrc, "dir/new.txt", "changed")
+	put(t, fdst, "same.txt", "other")
+	put(t, fsrc, "later.txt", "later")
+	src, dst := &skipFs{Fs: fsrc, skip: done}, &skipFs{Fs: fdst, skip: done}
+	assert.Nil(t, src.Features().ListR)
+	require.NoError(t, syncManifest(ctx, dst, src, file))
+	assert.Equal(t, "new", read(t, fdst, "dir/new.txt"))
+	assert.Equal(t, "other", read(t, fdst, "same.txt"))
+	assert.Equal(t, "later", read(t, fdst, "later.txt"))
+
+	done, err = loadManifest(file)
+	require.NoError(t, err)
+	assert.Len(t, done, 3)
+	assert.Contains(t, done, "later.txt")
+
+	// A missing manifest is empty
+	done, err = loadManifest(filepath.Join(t.TempDir(), "missing.jsonl"))
+	require.NoError(t, err)
+	assert.Empty(t, done)
+}
+
+func TestManifestCutShort(t *testing.T) {
+	ctx, ci := fs.AddConfig(context.Background())
+	ci.Transfers = 1
+	ci.MaxTransfer = 3
+	ci.CutoffMode = fs.CutoffModeSoft
+	accounting.NewStatsGroup(ctx, "TestManifestCutShort")
+	ctx = accounting.WithStatsGroup(ctx, "TestManifestCutShort")
+	root := fmt.Sprintf(":memory:manifest-short-%d", time.Now().UnixNano())
+	fsrc, err := fs.NewFs(ctx, root+"-src")
+	require.NoError(t, err)
+	fdst, err := fs.NewFs(ctx, root+"-dst")
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "sync.jsonl")
+
+	// The file transferred before the limit is kept
+	put(t, fsrc, "a.txt", "aaa")
+	put(t, fsrc, "b.txt", "bbb")
+	err = syncManifest(ctx, fdst, fsrc, file)
+	assert.ErrorIs(t, err, accounting.ErrorMaxTransferLimitReached)
+	buf, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, `{"path":"a.txt","size":3}`+"\n", string(buf))
+}
+
+func TestManifestDryRun(t *testing.T) {
+	ctx, ci := fs.AddConfig(context.Background())
+	ci.DryRun = true
+	fsrc, err := fs.NewFs(ctx, ":memory:manifest-dry-src")
+	require.NoError(t, err)
+	fdst, err := fs.NewFs(ctx, ":memory:manifest-dry-dst")
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "sync.jsonl")
+
+	put(t, fsrc, "file.txt", "file")
+	require.NoError(t, syncManifest(ctx, fdst, fsrc, file))
+	buf, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Empty(t, buf)
+}
@@ -0,0 +1,116 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/walk"
+)
+
+// fileState is what a listing keeps of a file to tell it changed
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// listing is the files and directories of a source
+type listing struct {
+	files map[string]fileState
+	dirs  map[string]struct{}
+}
+
+// pollChanges reports the changes to fsrc to notify, for sources which
+// can't report their own, like local disks. fsrc is listed now and then
+// every interval until ctx is done, each listing compared with the last.
+func pollChanges(ctx context.Context, fsrc fs.Fs, interval time.Duration, notify func(string, fs.EntryType)) error {
+	if interval <= 0 {
+		return errors.New("it doesn't report changes and --watch-interval is 0")
+	}
+	last, err := listSource(ctx, fsrc)
+	if err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			fs.Debugf(fsrc, "Listing to check for changes")
+			next, err := listSource(ctx, fsrc)
+			if err != nil {
+				fs.Errorf(fsrc, "Failed to list to check for changes: %v", err)
+				continue
+			}
+			for _, remote := range changedDirs(last, next) {
+				notify(remote, fs.EntryDirectory)
+			}
+			for _, remote := range changedFiles(last, next) {
+				notify(remote, fs.EntryObject)
+			}
+			last = next
+		}
+	}()
+	return nil
+}
+
+// listSource lists the files and directories of f, an empty listing if it
+// doesn't exist yet.
+func listSource(ctx context.Context, f fs.Fs) (*listing, error) {
+	l := &listing{files: map[string]fileState{}, dirs: map[string]struct{}{}}
+	err := walk.ListR(ctx, f, "", false, -1, walk.ListAll, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			switch x := entry.(type) {
+			case fs.Object:
+				l.files[x.Remote()] = fileState{size: x.Size(), modTime: x.ModTime(ctx)}
+			case fs.Directory:
+				l.dirs[x.Remote()] = struct{}{}
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		err = nil
+	}
+	return l, err
+}
+
+// changedFiles returns the files added, changed or removed between the
+// listings old and new.
+func changedFiles(old, new *listing) (changed []string) {
+	for remote, state := range new.files {
+		if was, ok := old.files[remote]; !ok || was.size != state.size || !was.modTime.Equal(state.modTime) {
+			changed = append(changed, remote)
+		}
+	}
+	for remote := range old.files {
+		if _, ok := new.files[remote]; !ok {
+			changed = append(changed, remote)
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
+
+// changedDirs returns the directories added or removed between the
+// listings old and new.
+func changedDirs(old, new *listing) (changed []string) {
+	for remote := range new.dirs {
+		if _, ok := old.dirs[remote]; !ok {
+			changed = append(changed, remote)
+		}
+	}
+	for remote := range old.dirs {
+		if _, ok := new.dirs[remote]; !ok {
+			changed = append(changed, remote)
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
@@ -0,0 +1,46 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChanged(t *testing.T) {
+	now := time.Now()
+	old := &listing{
+		files: map[string]fileState{"same.txt": {1, now}, "grown.txt": {1, now}, "touched.txt": {1, now}, "gone/file.txt": {1, now}},
+		dirs:  map[string]struct{}{"kept": {}, "gone": {}},
+	}
+	new := &listing{
+		files: map[string]fileState{"same.txt": {1, now}, "grown.txt": {2, now}, "touched.txt": {1, now.Add(time.Second)}, "new/file.txt": {1, now}},
+		dirs:  map[string]struct{}{"kept": {}, "new": {}},
+	}
+	assert.Equal(t, []string{"gone/file.txt", "grown.txt", "new/file.txt", "touched.txt"}, changedFiles(old, new))
+	assert.Equal(t, []string{"gone", "new"}, changedDirs(old, new))
+	assert.Empty(t, changedFiles(new, new))
+}
+
+func TestPollChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fsrc, err := fs.NewFs(ctx, ":memory:poll-src")
+	require.NoError(t, err)
+	put(t, fsrc, "a/old.txt", "old")
+
+	// Reported through a watcher, as the memory backend has no ChangeNotify
+	w, err := startWatch(ctx, fsrc, 10*time.Millisecond, 0, 0)
+	require.NoError(t, err)
+	put(t, fsrc, "a/old.txt", "changed")
+	put(t, fsrc, "b/new.txt", "new")
+	require.Eventually(t, func() bool {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return len(w.dirs) == 2
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.Equal(t, map[string]bool{"a": false, "b": true}, w.take())
+}
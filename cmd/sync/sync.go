@@ -0,0 +1,370 @@
+// Package sync provides the sync command.
+package sync
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ebadenes/eclone/cmd/cryptcopy"
+	"github.com/ebadenes/eclone/cmd/estimate"
+	"github.com/ebadenes/eclone/cmd/hooks"
+	"github.com/ebadenes/eclone/cmd/notify"
+	"github.com/ebadenes/eclone/cmd/orderby"
+	"github.com/ebadenes/eclone/cmd/publish"
+	"github.com/ebadenes/eclone/cmd/quotaretry"
+	"github.com/ebadenes/eclone/cmd/report"
+	"github.com/ebadenes/eclone/cmd/resume"
+	"github.com/ebadenes/eclone/cmd/revision"
+	"github.com/ebadenes/eclone/cmd/sdnotify"
+	"github.com/ebadenes/eclone/cmd/verify"
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/operations/operationsflags"
+	"github.com/spf13/cobra"
+)
+
+var (
+	createEmptySrcDirs = false
+	loggerOpt          = operations.LoggerOpt{}
+	loggerFlagsOpt     = operationsflags.AddLoggerFlagsOptions{}
+	manifestFile       = ""
+	fromManifest       = ""
+	watch              = false
+	watchInterval      = time.Minute
+	watchDebounce      = 10 * time.Second
+	watchMaxDelay      = 5 * time.Minute
+	publishDst         = false
+	reportFile         = ""
+	estimateOnly       = false
+	capacityOpt        = estimate.Options{}
+	notifyOpt          = notify.Options{}
+	hooksOpt           = hooks.Options{}
+	resumeOpt          = resume.Options{Grace: resume.DefaultGrace}
+	verifyAfter        = false
+	compareRevision    = false
+	quotaRetryOpt      = quotaretry.Options{}
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	cmdFlags := commandDefinition.Flags()
+	flags.BoolVarP(cmdFlags, &createEmptySrcDirs, "create-empty-src-dirs", "", createEmptySrcDirs, "Create empty source dirs on destination after sync", "")
+	flags.StringVarP(cmdFlags, &manifestFile, "manifest", "", manifestFile, "Append the files found in sync or transferred to this manifest", "")
+	flags.StringVarP(cmdFlags, &fromManifest, "from-manifest", "", fromManifest, "Skip the files listed in this manifest without checking them", "")
+	flags.BoolVarP(cmdFlags, &watch, "watch", "", watch, "Keep running and sync the changes made to the source", "")
+	flags.DurationVarP(cmdFlags, &watchInterval, "watch-interval", "", watchInterval, "Time between checks for changes with --watch", "")
+	flags.DurationVarP(cmdFlags, &watchDebounce, "watch-debounce", "", watchDebounce, "Time without changes to wait for before syncing them with --watch", "")
+	flags.DurationVarP(cmdFlags, &watchMaxDelay, "watch-max-delay", "", watchMaxDelay, "Longest changes wait with --watch while more keep coming (0 for no limit)", "")
+	flags.BoolVarP(cmdFlags, &publishDst, "publish", "", publishDst, "Sync into a hidden folder and swap it in for the destination when done", "")
+	flags.StringVarP(cmdFlags, &reportFile, "report-file", "", reportFile, "Write a JSON summary of the run to this file", "")
+	notify.AddFlags(cmdFlags, &notifyOpt)
+	hooks.AddFlags(cmdFlags, &hooksOpt)
+	resume.AddFlags(cmdFlags, &resumeOpt)
+	quotaretry.AddFlags(cmdFlags, &quotaRetryOpt)
+	flags.BoolVarP(cmdFlags, &verifyAfter, "verify-after", "", verifyAfter, "Compare the hashes of source and destination after the sync, copying files which differ again", "")
+	flags.BoolVarP(cmdFlags, &compareRevision, "compare-revision", "", compareRevision, "Compare files between drive remotes by the Drive revision of the source instead of size and modification time", "")
+	flags.BoolVarP(cmdFlags, &estimateOnly, "estimate", "", estimateOnly, "Size the source and report the service accounts and days it needs, without transferring", "")
+	estimate.AddFlags(cmdFlags, &capacityOpt)
+	operationsflags.AddLoggerFlags(cmdFlags, &loggerOpt, &loggerFlagsOpt)
+	loggerOpt.LoggerFn = operations.NewDefaultLoggerFn(&loggerOpt)
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "sync source:path dest:path",
+	Short: `Make source and dest identical, modifying destination only.`,
+	// Warning! "|" will be replaced by backticks below
+	Long: strings.ReplaceAll(`Sync the source to the destination, changing the destination
+only.  Doesn't transfer files that are identical on source and
+destination, testing by size and modification time or MD5SUM.
+Destination is updated to match source, including deleting files
+if necessary (except duplicate objects, see below). If you don't
+want to delete files from destination, use the
+[copy](/commands/rclone_copy/) command instead.
+
+**Important**: Since this can cause data loss, test first with the
+|--dry-run| or the |--interactive|/|i| flag.
+
+|||sh
+rclone sync --interactive SOURCE remote:DESTINATION
+|||
+
+Files in the destination won't be deleted if there were any errors at any
+point. Duplicate objects (files with the same name, on those providers that
+support it) are not yet handled. Files that are excluded won't be deleted
+unless |--delete-excluded| is used. Symlinks won't be transferred or
+deleted from local file systems unless |--links| is used.
+
+It is always the contents of the directory that is synced, not the
+directory itself. So when source:path is a directory, it's the contents of
+source:path that are copied, not the directory name and contents.  See
+extended explanation in the [copy](/commands/rclone_copy/) command if unsure.
+
+If dest:path doesn't exist, it is created and the source:path contents
+go there.
+
+It is not possible to sync overlapping remotes. However, you may exclude
+the destination from the sync with a filter rule or by putting an
+exclude-if-present file inside the destination directory and sync to a
+destination that is inside the source directory.
+
+Rclone will sync the modification times of files and directories if
+the backend supports it. If metadata syncing is required then use the
+|--metadata| flag.
+
+Note that the modification time and metadata for the root directory
+will **not** be synced. See <https://github.com/rclone/rclone/issues/7652>
+for more info.
+
+**Note**: Use the |-P|/|--progress| flag to view real-time transfer statistics
+
+**Note**: Use the |rclone dedupe| command to deal with "Duplicate
+object/directory found in source/destination - ignoring" errors.
+See [this forum post](https://forum.rclone.org/t/sync-not-clearing-duplicates/14372)
+for more info.
+
+### Resuming with a manifest
+
+Restarting a sync of millions of files spends most of its time checking
+the files which were already done. With |--manifest FILE| every file
+found identical or transferred is appended to FILE as a line of JSON
+with its path, size and, for the files found identical, hash if it can
+be had without reading the file. A later run given |--from-manifest
+FILE| leaves those files out of both listings, so they are neither
+checked, transferred nor deleted.
+Directories are still listed, so new files are picked up.
+
+|||sh
+eclone sync source:path dest:path --manifest sync.jsonl --from-manifest sync.jsonl
+|||
+
+Files are added as soon as they are found identical or their transfer
+succeeds, so a run stopped part way through, by |--max-transfer|,
+|--max-duration| or a kill, records what it got done. Files changed on
+the source after they were recorded are not noticed - delete the
+manifest to check everything again. |--fast-list| isn't used with
+|--from-manifest|.
+
+With |--order-by quota| files are ordered by size, and the share of
+transfers taking the largest files follows the share of the
+destination's service accounts which still have quota. A fresh pool
+moves the big files first, while they can still complete, and small
+files are left for when it thins out. The order is picked as each pass
+starts.
+
+### Publishing in one go
+
+With |--publish| readers of the destination never see a half finished
+sync. The destination is copied server side into a hidden
+|.DEST.publish| folder beside it, the sync goes there, and once it has
+succeeded the destination is moved aside, the new folder moved into its
+place and the old one purged. Between the two moves the destination is
+briefly missing; if the second fails the old folder is moved back. A
+failed sync leaves |.DEST.publish| for
+the next run to carry on with. The published folder is a new folder, so
+links to and shares of the old one don't carry over. |--publish| can't
+be used with |--watch| or |--from-manifest|.
+
+### Watching for changes
+
+With |--watch| eclone keeps running after the sync and applies the
+changes made to the source as they happen. It asks the source for its
+changes every |--watch-interval| (default 1m) - Drive keeps a changes
+page token for this, taken before the first sync starts so nothing made
+while it runs is missed. Sources which don't report their changes, like
+local disks, are listed every |--watch-interval| instead, starting
+before the first sync, and each listing compared with the last. Each
+pass syncs only the directories with changes: a changed file has the
+files beside it synced, a changed directory everything under it. The
+copies go through the destination's service account pool like any
+other.
+
+Changes are collected until none has come for |--watch-debounce|
+(default 10s), or for at most |--watch-max-delay| (default 5m) while
+more keep coming, so a burst of them, like a folder being unpacked, is
+synced in one pass. Drive reports the changes of each
+|--watch-interval| at once, so set |--watch-debounce| above it to wait
+out bursts spanning several checks.
+
+|||sh
+eclone sync drive:media td:media --watch --watch-interval 30s
+eclone sync /data td:data --watch --watch-debounce 2m
+|||
+
+Files deleted for good from Drive, rather than trashed, and files moved
+out of a directory aren't reported with their old path, so they stay on
+the destination until the next full sync. |--manifest| and
+|--from-manifest| only apply to the first sync. A pass that fails is
+tried again after |--watch-interval|.
+
+Run as a systemd service with |Type=notify|, |--watch| tells systemd
+it is ready once the remotes are loaded and, with |WatchdogSec| set,
+pings the watchdog while the transfers are making progress, so a sync
+which hangs is restarted.
+
+With |--report-file| a JSON summary of the run is written to the file
+given at the end of each attempt: when it ran, the files transferred,
+skipped and failed, with the error of each failure, and the bytes
+uploaded and rate limits hit by each service account.
+
+With |--estimate| nothing is transferred. The source is sized, with the
+filters given, and the number of service accounts it needs at 750 GiB
+a day each is printed, along with the pool of the destination: whether
+the transfer fits in the quota left today and how many days it takes
+otherwise. Files already at the destination are counted too.
+
+With |--verify-after| the hashes of the source and the destination are
+compared once the sync has succeeded, using the MD5s Drive keeps so
+nothing is downloaded. Files which differ are copied again, once, and
+fail the sync if they still differ. With |--watch| only the first sync
+is verified.
+
+Between two crypt remotes over drive remotes with the same password and
+salt, files are copied server side without being decrypted and
+encrypted again, even though the remotes are configured separately.
+Files the destination's drive remote can't read are copied the usual
+way.
+
+With |--compare-revision|, between drive remotes, the revision Drive
+gives the content of each source file is recorded on its copy, and
+files are compared by it instead of by size and modification time: a
+copy whose source still has the revision recorded is left alone, even
+if its modification time differs, and one whose source has a new
+revision is copied again, even if it kept its size and modification
+time. Copies without a revision recorded but with the MD5 of their
+source get it recorded without being copied; other files are compared
+as usual and get theirs recorded on the next run. With |--watch| only the first
+sync compares revisions. It can't be used with |--delete-excluded|.
+
+With |--quota-retry| the retry is a second full sync, which also makes
+the deletions the first one skipped because of the failures. With
+|--watch| only the first sync is retried.
+
+`, "|", "`") + notify.Help() + "\n" + hooks.Help() + "\n" + resume.Help() + "\n" + quotaretry.Help() + "\n" + estimate.Help() + "\n" + operationsflags.Help(),
+	Annotations: map[string]string{
+		"groups": "Sync,Copy,Filter,Listing,Important",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(2, 2, command, args)
+		fsrc, srcFileName, fdst := cmd.NewFsSrcFileDst(args)
+		srcFs, dstFs := fsrc, fdst
+		if estimateOnly {
+			cmd.Run(false, false, command, func() error {
+				return estimate.Estimate(context.Background(), os.Stdout, fsrc, srcFileName, fdst)
+			})
+			return
+		}
+		cryptcopy.Enable(fdst, fsrc)
+		if publishDst && (srcFileName != "" || watch || fromManifest != "") {
+			fs.Fatalf(nil, "--publish can only be used to sync a directory, without --watch or --from-manifest")
+		}
+		if compareRevision && (srcFileName != "" || fromManifest != "") {
+			fs.Fatalf(nil, "--compare-revision can only be used to sync a directory, without --from-manifest")
+		}
+		if compareRevision && filter.GetConfig(context.Background()).Opt.DeleteExcluded {
+			fs.Fatalf(nil, "--compare-revision can't be used with --delete-excluded")
+		}
+		if err := estimate.Check(context.Background(), &capacityOpt, fsrc, srcFileName, fdst); err != nil {
+			fs.Fatalf(nil, "%v", err)
+		}
+		var changes *watcher
+		if watch {
+			if srcFileName != "" {
+				fs.Fatalf(nil, "--watch can only be used to sync a directory")
+			}
+			var err error
+			changes, err = startWatch(context.Background(), srcFs, watchInterval, watchDebounce, watchMaxDelay)
+			if err != nil {
+				fs.Fatalf(nil, "%v", err)
+			}
+			// Ready to take changes, with the remotes and their pools loaded
+			defer sdnotify.Ready(context.Background())()
+		}
+		if fromManifest != "" && srcFileName == "" {
+			done, err := loadManifest(fromManifest)
+			if err != nil {
+				fs.Fatalf(nil, "%v", err)
+			}
+			fsrc, fdst = &skipFs{Fs: fsrc, skip: done}, &skipFs{Fs: fdst, skip: done}
+		}
+		run := report.New(reportFile, "sync", srcFs, dstFs)
+		resumer, err := resume.New(&resumeOpt, "sync", srcFs, dstFs)
+		if err != nil {
+			fs.Fatalf(nil, "%v", err)
+		}
+		notifier, err := notify.New(context.Background(), &notifyOpt, "sync", srcFs, dstFs)
+		if err != nil {
+			fs.Fatalf(nil, "%v", err)
+		}
+		hooker := hooks.New(&hooksOpt, "sync", srcFs, dstFs)
+		cmd.Run(true, true, command, func() error {
+			ctx := context.Background()
+			close, err := operationsflags.ConfigureLoggers(ctx, fdst, command, &loggerOpt, loggerFlagsOpt)
+			if err != nil {
+				return err
+			}
+			defer close()
+
+			if loggerFlagsOpt.AnySet() {
+				ctx = operations.WithSyncLogger(ctx, loggerOpt)
+			}
+			ctx = orderby.Resolve(ctx, dstFs)
+			run.Start(ctx)
+			ctx = resumer.Start(ctx)
+			notifier.Start(ctx)
+			if err = hooker.Start(ctx); err != nil {
+				return notifier.Finish(ctx, run.Finish(ctx, resumer.Finish(err)))
+			}
+
+			switch {
+			case srcFileName != "":
+				copyFile := func(ctx context.Context) error {
+					return operations.CopyFile(ctx, fdst, fsrc, srcFileName, srcFileName)
+				}
+				err = quotaretry.Run(ctx, &quotaRetryOpt, srcFileName, copyFile, func(ctx context.Context, _ []string) error {
+					return copyFile(ctx)
+				})
+				if err == nil && verifyAfter {
+					err = verify.Verify(ctx, fdst, fsrc, srcFileName)
+				}
+			case publishDst:
+				err = publish.Publish(ctx, fdst, func(ctx context.Context, fdst fs.Fs) error {
+					cryptcopy.Enable(fdst, srcFs)
+					return syncVerified(ctx, fdst, fsrc)
+				})
+			default:
+				err = syncVerified(ctx, fdst, fsrc)
+				if err == nil && changes != nil {
+					return notifier.Finish(ctx, run.Finish(ctx, resumer.Finish(hooker.Finish(ctx, changes.run(ctx, dstFs, srcFs, watchInterval)))))
+				}
+			}
+			return notifier.Finish(ctx, run.Finish(ctx, resumer.Finish(hooker.Finish(ctx, err))))
+		})
+	},
+}
+
+// syncVerified syncs fsrc to fdst and, with --verify-after, verifies the
+// hashes of the result.
+func syncVerified(ctx context.Context, fdst, fsrc fs.Fs) (err error) {
+	syncCtx := ctx
+	if compareRevision {
+		if syncCtx, err = revision.Compare(ctx, fdst, fsrc); err != nil {
+			return err
+		}
+	}
+	syncFn := func(ctx context.Context) error {
+		return syncManifest(ctx, fdst, fsrc, manifestFile)
+	}
+	err = quotaretry.Run(syncCtx, &quotaRetryOpt, "", syncFn, func(ctx context.Context, _ []string) error {
+		// All of it, to make the deletions the first sync skipped
+		return syncFn(ctx)
+	})
+	if err == nil && verifyAfter {
+		err = verify.Verify(ctx, fdst, fsrc, "")
+	}
+	return err
+}
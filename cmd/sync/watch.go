@@ -0,0 +1,240 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	gosync "sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/sync"
+	"github.com/rclone/rclone/fs/walk"
+)
+
+// watcher collects the directories changed on the source, as reported by
+// its ChangeNotify or found by polling it, between the passes of --watch.
+//
+// A changed file marks its directory to be synced without going into
+// subdirectories, a changed directory marks it to be synced with all of
+// them.
+type watcher struct {
+	debounce time.Duration // quiet time to wait for after a change
+	maxDelay time.Duration // longest a change waits, 0 for no limit
+	changed  chan struct{} // signalled on each change
+
+	mu    gosync.Mutex
+	dirs  map[string]bool // changed directory -> subdirectories changed too
+	first time.Time       // when the oldest change in dirs came
+	last  time.Time       // when the latest change came
+}
+
+// startWatch starts following the changes to fsrc, polling every interval.
+// A pass is run once none has come for debounce, or the oldest has
+// waited maxDelay.
+//
+// Drive keeps the changes page token from the moment this is called, so
+// changes made while the first sync runs are not missed. Sources without
+// ChangeNotify are listed now, for the same reason, and then every
+// interval.
+func startWatch(ctx context.Context, fsrc fs.Fs, interval, debounce, maxDelay time.Duration) (*watcher, error) {
+	w := &watcher{
+		debounce: debounce,
+		maxDelay: maxDelay,
+		changed:  make(chan struct{}, 1),
+		dirs:     make(map[string]bool),
+	}
+	doChangeNotify := fsrc.Features().ChangeNotify
+	if doChangeNotify == nil {
+		if err := pollChanges(ctx, fsrc, interval, w.notify); err != nil {
+			return nil, fmt.Errorf("can't watch %v: %w", fsrc, err)
+		}
+		return w, nil
+	}
+	pollInterval := make(chan time.Duration, 1)
+	pollInterval <- interval
+	doChangeNotify(ctx, w.notify, pollInterval)
+	return w, nil
+}
+
+// parentDir returns the directory holding remote, "" for the root.
+func parentDir(remote string) string {
+	dir := path.Dir(remote)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// notify records a change to remote.
+func (w *watcher) notify(remote string, entryType fs.EntryType) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.last = time.Now()
+	if len(w.dirs) == 0 {
+		w.first = w.last
+	}
+	if entryType == fs.EntryDirectory {
+		w.dirs[remote] = true
+	} else {
+		dir := parentDir(remote)
+		if _, ok := w.dirs[dir]; !ok {
+			w.dirs[dir] = false
+		}
+	}
+	select {
+	case w.changed <- struct{}{}:
+	default:
+	}
+}
+
+// settle waits until no change has come for w.debounce, or the oldest
+// has waited w.maxDelay.
+func (w *watcher) settle(ctx context.Context) error {
+	for {
+		w.mu.Lock()
+		wait := w.debounce - time.Since(w.last)
+		if w.maxDelay > 0 && !w.first.IsZero() {
+			wait = min(wait, w.maxDelay-time.Since(w.first))
+		}
+		w.mu.Unlock()
+		if wait <= 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// take returns the changed directories and clears them, leaving out
+// those inside a directory which is synced with its subdirectories.
+func (w *watcher) take() map[string]bool {
+	w.mu.Lock()
+	dirs := w.dirs
+	w.dirs = make(map[string]bool)
+	w.first = time.Time{}
+	w.mu.Unlock()
+	for dir := range dirs {
+		for parent := dir; parent != ""; {
+			parent = parentDir(parent)
+			if dirs[parent] {
+				delete(dirs, dir)
+				break
+			}
+		}
+	}
+	return dirs
+}
+
+// requeue puts back dirs whose sync failed for the next pass.
+func (w *watcher) requeue(dirs map[string]bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.dirs) == 0 {
+		w.first = time.Now()
+	}
+	for dir, recurse := range dirs {
+		w.dirs[dir] = w.dirs[dir] || recurse
+	}
+}
+
+// run syncs the changes from fsrc to fdst as they settle until ctx is
+// done or a fatal error stops it. A pass which fails is tried again after
+// interval.
+func (w *watcher) run(ctx context.Context, fdst, fsrc fs.Fs, interval time.Duration) error {
+	fs.Logf(fsrc, "Watching for changes every %v", interval)
+	var retry <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-w.changed:
+		case <-retry:
+		}
+		if err := w.settle(ctx); err != nil {
+			return err
+		}
+		dirs := w.take()
+		if len(dirs) == 0 {
+			continue
+		}
+		retry = nil
+		// sync won't delete anything after an error, so don't let one
+		// from an earlier pass stop this one
+		accounting.Stats(ctx).ResetErrors()
+		fs.Infof(fsrc, "Syncing changes in %d directories", len(dirs))
+		err := syncChanges(ctx, fdst, fsrc, dirs)
+		if fserrors.IsFatalError(err) {
+			return err
+		}
+		if err != nil {
+			fs.Errorf(fsrc, "Failed to sync changes - will try again: %v", err)
+			w.requeue(dirs)
+			retry = time.After(interval)
+		}
+	}
+}
+
+// syncChanges syncs dirs from fsrc to fdst.
+//
+// The files in them on either side are listed and the sync is run with
+// just those as --files-from, so files gone from the source are deleted
+// from the destination. Directories gone from the source with their
+// subdirectories have the empty directories left removed.
+func syncChanges(ctx context.Context, fdst, fsrc fs.Fs, dirs map[string]bool) error {
+	opt := filter.GetConfig(ctx).Opt
+	opt.FilesFrom, opt.FilesFromRaw = nil, nil
+	only, err := filter.NewFilter(&opt)
+	if err != nil {
+		return err
+	}
+	files := 0
+	var gone []string
+	for dir, recurse := range dirs {
+		maxLevel := 1
+		if recurse {
+			maxLevel = -1
+		}
+		srcGone := false
+		for _, f := range []fs.Fs{fsrc, fdst} {
+			err := walk.ListR(ctx, f, dir, false, maxLevel, walk.ListObjects, func(entries fs.DirEntries) error {
+				for _, entry := range entries {
+					files++
+					if err := only.AddFile(entry.Remote()); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if errors.Is(err, fs.ErrorDirNotFound) {
+				srcGone = f == fsrc
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if f == fdst && srcGone && recurse && dir != "" {
+				gone = append(gone, dir)
+			}
+		}
+	}
+	if files > 0 {
+		if err = sync.Sync(filter.ReplaceConfig(ctx, only), fdst, fsrc, createEmptySrcDirs); err != nil {
+			return err
+		}
+	}
+	for _, dir := range gone {
+		if err = operations.Rmdirs(ctx, fdst, dir, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcherTake(t *testing.T) {
+	w := &watcher{dirs: make(map[string]bool)}
+	w.notify("top.txt", fs.EntryObject)
+	w.notify("a/b/file.txt", fs.EntryObject)
+	w.notify("a", fs.EntryDirectory)
+	w.notify("c/file.txt", fs.EntryObject)
+	w.notify("c", fs.EntryDirectory)
+	w.notify("c/d/file.txt", fs.EntryObject)
+	assert.Equal(t, map[string]bool{"": false, "a": true, "c": true}, w.take())
+	assert.Empty(t, w.take())
+
+	w.notify("c/file.txt", fs.EntryObject)
+	w.requeue(map[string]bool{"c": true, "e": false})
+	assert.Equal(t, map[string]bool{"c": true, "e": false}, w.take())
+
+	w.notify("", fs.EntryDirectory)
+	w.notify("a/file.txt", fs.EntryObject)
+	assert.Equal(t, map[string]bool{"": true}, w.take())
+}
+
+func TestSettle(t *testing.T) {
+	ctx := context.Background()
+	w := &watcher{debounce: 50 * time.Millisecond, dirs: make(map[string]bool)}
+
+	// Waits until the changes stop coming
+	w.notify("a/file.txt", fs.EntryObject)
+	go func() {
+		for range 3 {
+			time.Sleep(20 * time.Millisecond)
+			w.notify("b/file.txt", fs.EntryObject)
+		}
+	}()
+	start := time.Now()
+	require.NoError(t, w.settle(ctx))
+	assert.GreaterOrEqual(t, time.Since(start), 110*time.Millisecond)
+	assert.Len(t, w.take(), 2)
+
+	// But no longer than maxDelay after the first
+	w.debounce, w.maxDelay = time.Hour, 50*time.Millisecond
+	w.notify("a/file.txt", fs.EntryObject)
+	require.NoError(t, w.settle(ctx))
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	w.maxDelay = 0
+	w.notify("a/file.txt", fs.EntryObject)
+	assert.ErrorIs(t, w.settle(ctx), context.Canceled)
+}
+
+func TestStartWatch(t *testing.T) {
+	f, err := fs.NewFs(context.Background(), ":memory:watch")
+	require.NoError(t, err)
+	_, err = startWatch(context.Background(), f, 0, 0, 0)
+	assert.ErrorContains(t, err, "doesn't report changes")
+}
+
+func TestSyncChanges(t *testing.T) {
+	ctx := context.Background()
+	fsrc, err := fs.NewFs(ctx, ":memory:watch-src")
+	require.NoError(t, err)
+	fdst, err := fs.NewFs(ctx, ":memory:watch-dst")
+	require.NoError(t, err)
+
+	put(t, fsrc, "a/new.txt", "new")
+	put(t, fsrc, "a/sub/deep.txt", "deep")
+	put(t, fsrc, "b/untouched.txt", "source")
+	put(t, fdst, "a/removed.txt", "removed")
+	put(t, fdst, "b/untouched.txt", "dest")
+	put(t, fdst, "gone/sub/old.txt", "old")
+
+	require.NoError(t, syncChanges(ctx, fdst, fsrc, map[string]bool{"a": false, "gone": true}))
+
+	assert.Equal(t, "new", read(t, fdst, "a/new.txt"))
+	_, err = fdst.NewObject(ctx, "a/sub/deep.txt")
+	assert.ErrorIs(t, err, fs.ErrorObjectNotFound, "subdirectory of a file change synced")
+	_, err = fdst.NewObject(ctx, "a/removed.txt")
+	assert.ErrorIs(t, err, fs.ErrorObjectNotFound)
+	assert.Equal(t, "dest", read(t, fdst, "b/untouched.txt"))
+	_, err = fdst.NewObject(ctx, "gone/sub/old.txt")
+	assert.ErrorIs(t, err, fs.ErrorObjectNotFound)
+
+	require.NoError(t, syncChanges(ctx, fdst, fsrc, map[string]bool{"a": true}))
+	assert.Equal(t, "deep", read(t, fdst, "a/sub/deep.txt"))
+
+	// Nothing to sync
+	require.NoError(t, syncChanges(ctx, fdst, fsrc, map[string]bool{"missing": true}))
+	assert.Equal(t, "dest", read(t, fdst, "b/untouched.txt"))
+}
@@ -0,0 +1,141 @@
+// Package verify checks the hashes of a finished transfer, for
+// --verify-after.
+//
+// Drive keeps the MD5 of every file it holds, so comparing those of the
+// source and the destination proves the content arrived intact without
+// downloading anything. The comparison is made with operations.Check in a
+// stats group of its own, so the differences it finds don't count as
+// errors of the run. The files which differ are copied again, once, and
+// only those still differing after that are errors.
+package verify
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+)
+
+// Verify compares the hashes of the files in fsrc, or only srcFileName
+// if set, with those of their copies in fdst, copying those which differ
+// again. Files missing from fdst are left alone as their transfer has
+// already failed.
+func Verify(ctx context.Context, fdst, fsrc fs.Fs, srcFileName string) error {
+	if fs.GetConfig(ctx).DryRun {
+		fs.Logf(fdst, "Not verifying the transfer as it was a dry run")
+		return nil
+	}
+	ht := fdst.Hashes().Overlap(fsrc.Hashes()).GetOne()
+	if ht == hash.None {
+		return fmt.Errorf("can't verify - %v and %v have no hash in common", fsrc, fdst)
+	}
+	var differ []string
+	if srcFileName != "" {
+		same, err := sameFile(ctx, fdst, fsrc, srcFileName)
+		if err != nil {
+			return err
+		}
+		if !same {
+			differ = append(differ, srcFileName)
+		}
+	} else {
+		var err error
+		differ, err = check(ctx, fdst, fsrc)
+		if err != nil {
+			return err
+		}
+	}
+	if len(differ) == 0 {
+		fs.Infof(fdst, "Verified the %v hashes of the transfer", ht)
+		return nil
+	}
+	fs.Logf(fdst, "%d files differ from the source - copying them again", len(differ))
+	failed := 0
+	for _, remote := range differ {
+		if err := recopy(ctx, fdst, fsrc, remote); err != nil {
+			fs.Errorf(remote, "Verification failed: %v", err)
+			_ = fs.CountError(ctx, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d files still differ from the source after copying them again", failed)
+	}
+	fs.Logf(fdst, "Copied %d files again and verified their %v hashes", len(differ), ht)
+	return nil
+}
+
+// check returns the files of fsrc whose hashes differ in fdst.
+func check(ctx context.Context, fdst, fsrc fs.Fs) (differ []string, err error) {
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(pr)
+		for scanner.Scan() {
+			differ = append(differ, scanner.Text())
+		}
+		_, _ = io.Copy(io.Discard, pr)
+	}()
+	checkCtx := accounting.WithStatsGroup(ctx, "verify")
+	err = operations.Check(checkCtx, &operations.CheckOpt{
+		Fdst:   fdst,
+		Fsrc:   fsrc,
+		OneWay: true,
+		Differ: pw,
+	})
+	_ = pw.Close()
+	<-done
+	// Finding differences returns an error which is already counted
+	if err != nil && !fserrors.IsCounted(err) {
+		return nil, fmt.Errorf("failed to verify: %w", err)
+	}
+	return differ, nil
+}
+
+// sameFile returns true if remote has the same hash in fsrc and fdst.
+func sameFile(ctx context.Context, fdst, fsrc fs.Fs, remote string) (bool, error) {
+	src, err := fsrc.NewObject(ctx, remote)
+	if err != nil {
+		return false, fmt.Errorf("failed to verify: %w", err)
+	}
+	dst, err := fdst.NewObject(ctx, remote)
+	if errors.Is(err, fs.ErrorObjectNotFound) {
+		return true, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to verify: %w", err)
+	}
+	same, _, err := operations.CheckHashes(ctx, src, dst)
+	return same, err
+}
+
+// recopy copies remote from fsrc to fdst again and checks its hash.
+func recopy(ctx context.Context, fdst, fsrc fs.Fs, remote string) error {
+	src, err := fsrc.NewObject(ctx, remote)
+	if err != nil {
+		return err
+	}
+	dst, err := fdst.NewObject(ctx, remote)
+	if err != nil && !errors.Is(err, fs.ErrorObjectNotFound) {
+		return err
+	}
+	dst, err = operations.Copy(ctx, fdst, dst, remote, src)
+	if err != nil {
+		return err
+	}
+	same, ht, err := operations.CheckHashes(ctx, src, dst)
+	if err != nil {
+		return err
+	}
+	if !same {
+		return fmt.Errorf("%v still differs after copying it again", ht)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package verify
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func write(t *testing.T, dir, name, content string) {
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+}
+
+func read(t *testing.T, dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	require.NoError(t, err)
+	return string(data)
+}
+
+func newFs(t *testing.T) (fdst, fsrc fs.Fs, dst, src string) {
+	ctx := context.Background()
+	src, dst = t.TempDir(), t.TempDir()
+	fsrc, err := fs.NewFs(ctx, src)
+	require.NoError(t, err)
+	fdst, err = fs.NewFs(ctx, dst)
+	require.NoError(t, err)
+	return fdst, fsrc, dst, src
+}
+
+func TestVerify(t *testing.T) {
+	ctx := accounting.WithStatsGroup(context.Background(), "TestVerify")
+	fdst, fsrc, dst, src := newFs(t)
+	write(t, src, "same.txt", "same")
+	write(t, dst, "same.txt", "same")
+	write(t, src, "corrupt.txt", "good")
+	write(t, dst, "corrupt.txt", "evil")
+	write(t, src, "missing.txt", "missing")
+
+	require.NoError(t, Verify(ctx, fdst, fsrc, ""))
+	assert.Equal(t, "good", read(t, dst, "corrupt.txt"))
+	// Files whose transfer failed aren't copied
+	assert.NoFileExists(t, filepath.Join(dst, "missing.txt"))
+	// The differences found aren't errors of the run
+	assert.Equal(t, int64(0), accounting.Stats(ctx).GetErrors())
+	assert.Equal(t, int64(1), accounting.Stats(ctx).GetTransfers())
+
+	require.NoError(t, Verify(ctx, fdst, fsrc, ""))
+	assert.Equal(t, int64(1), accounting.Stats(ctx).GetTransfers())
+}
+
+func TestVerifyFile(t *testing.T) {
+	ctx := accounting.WithStatsGroup(context.Background(), "TestVerifyFile")
+	fdst, fsrc, dst, src := newFs(t)
+	write(t, src, "a.txt", "good")
+	write(t, dst, "a.txt", "evil")
+	write(t, src, "b.txt", "not copied")
+
+	require.NoError(t, Verify(ctx, fdst, fsrc, "a.txt"))
+	assert.Equal(t, "good", read(t, dst, "a.txt"))
+	require.NoError(t, Verify(ctx, fdst, fsrc, "b.txt"))
+	assert.Error(t, Verify(ctx, fdst, fsrc, "none.txt"))
+}
+
+func TestVerifyNoHash(t *testing.T) {
+	ctx := context.Background()
+	f, err := mockfs.NewFs(ctx, "mock", "", nil)
+	require.NoError(t, err)
+	assert.ErrorContains(t, Verify(ctx, f, f, ""), "no hash in common")
+
+	ctx, ci := fs.AddConfig(ctx)
+	ci.DryRun = true
+	assert.NoError(t, Verify(ctx, f, f, ""))
+}